@@ -1,22 +1,31 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"sync"
 
 	"github.com/kardianos/service"
 	"github.com/stone-age-io/agent/internal/agent"
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
 )
 
 var (
-	version = "1.0.0" // Set via -ldflags during build
+	// Set via -ldflags during build
+	version   = "1.0.0"
+	commit    = ""
+	buildDate = ""
 )
 
 // program implements the service.Interface
 type program struct {
+	mu         sync.Mutex // Guards agent and stopping across config reloads
 	agent      *agent.Agent
+	stopping   bool
 	configPath string
 	logger     service.Logger
 }
@@ -86,32 +95,74 @@ func main() {
 
 // Start implements service.Interface
 func (p *program) Start(s service.Service) error {
-	p.logger.Infof("Starting agent version %s", version)
+	build := tasks.NewBuildInfo(version, commit, buildDate)
+	p.logger.Infof("Starting agent version %s (commit %s, built %s)", build.Version, build.Commit, build.BuildDate)
 
 	// Create agent
-	ag, err := agent.New(p.configPath, version)
+	ag, err := agent.New(p.configPath, build)
 	if err != nil {
 		return fmt.Errorf("failed to create agent: %w", err)
 	}
 
+	p.mu.Lock()
 	p.agent = ag
+	p.mu.Unlock()
 
 	// Start agent in goroutine
-	go func() {
-		if err := p.agent.Run(); err != nil {
-			p.logger.Errorf("Agent error: %v", err)
-		}
-	}()
+	go p.run(ag)
 
 	return nil
 }
 
+// run runs the agent, replacing it with a new one from the same config path
+// each time a config reload is requested via agentctl
+func (p *program) run(ag *agent.Agent) {
+	for {
+		err := ag.Run()
+		if errors.Is(err, agent.ErrRestart) {
+			// Exit non-zero so the service manager starts a fresh process
+			p.logger.Errorf("Agent restarting: %v", err)
+			os.Exit(1)
+		}
+		if !errors.Is(err, agent.ErrReload) {
+			if err != nil {
+				p.logger.Errorf("Agent error: %v", err)
+			}
+			return
+		}
+
+		p.mu.Lock()
+		stopping := p.stopping
+		p.mu.Unlock()
+		if stopping {
+			return
+		}
+
+		p.logger.Info("Restarting agent with reloaded config")
+		ag, err = agent.New(p.configPath, tasks.NewBuildInfo(version, commit, buildDate))
+		if err != nil {
+			// Exit non-zero so the service manager restarts the agent
+			p.logger.Errorf("Failed to restart agent after config reload: %v", err)
+			os.Exit(1)
+		}
+
+		p.mu.Lock()
+		p.agent = ag
+		p.mu.Unlock()
+	}
+}
+
 // Stop implements service.Interface
 func (p *program) Stop(s service.Service) error {
 	p.logger.Info("Stopping agent")
 
-	if p.agent != nil {
-		if err := p.agent.Shutdown(); err != nil {
+	p.mu.Lock()
+	p.stopping = true
+	ag := p.agent
+	p.mu.Unlock()
+
+	if ag != nil {
+		if err := ag.Shutdown(); err != nil {
 			p.logger.Errorf("Error during shutdown: %v", err)
 			return err
 		}
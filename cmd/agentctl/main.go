@@ -0,0 +1,87 @@
+// agentctl talks to a running agent over its local control channel (unix
+// socket or named pipe), for on-site technicians without NATS access.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/control"
+)
+
+const usage = `Usage: agentctl [-socket path] [-timeout d] <command>
+
+Commands:
+  status                 Show agent health (same as cmd.health)
+  task run <task>        Run a scheduled task now (e.g. system_metrics, plugin.modbus)
+  config reload          Validate the config file and restart the agent with it
+  log level [<level>]    Show or set the log level (debug, info, warn, error)
+
+Flags:
+`
+
+func main() {
+	var socket string
+	var timeout time.Duration
+
+	flag.StringVar(&socket, "socket", config.GetPlatformDefaults().ControlSocket, "Agent control socket (control.socket)")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "Time to wait for the agent's response")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	req, err := parseRequest(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agentctl: %v\n\n", err)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	resp, err := control.Do(socket, req, timeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agentctl: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.Status != "success" {
+		fmt.Fprintf(os.Stderr, "agentctl: %s\n", resp.Error)
+		os.Exit(1)
+	}
+
+	if len(resp.Data) > 0 {
+		var out bytes.Buffer
+		if err := json.Indent(&out, resp.Data, "", "  "); err != nil {
+			out.Reset()
+			out.Write(resp.Data)
+		}
+		fmt.Println(out.String())
+		return
+	}
+	fmt.Println(resp.Message)
+}
+
+// parseRequest maps command-line arguments to a control request
+func parseRequest(args []string) (*control.Request, error) {
+	switch {
+	case len(args) == 1 && args[0] == "status":
+		return &control.Request{Command: control.CommandStatus}, nil
+	case len(args) == 3 && args[0] == "task" && args[1] == "run":
+		return &control.Request{Command: control.CommandTaskRun, Task: args[2]}, nil
+	case len(args) == 2 && args[0] == "config" && args[1] == "reload":
+		return &control.Request{Command: control.CommandReload}, nil
+	case len(args) == 2 && args[0] == "log" && args[1] == "level":
+		return &control.Request{Command: control.CommandLogLevel}, nil
+	case len(args) == 3 && args[0] == "log" && args[1] == "level":
+		return &control.Request{Command: control.CommandLogLevel, Level: args[2]}, nil
+	case len(args) == 0:
+		return nil, fmt.Errorf("no command given")
+	default:
+		return nil, fmt.Errorf("unknown command: %v", args)
+	}
+}
@@ -2,59 +2,178 @@ package agent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	rtdebug "runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/stone-age-io/agent/internal/bootstrap"
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/control"
+	"github.com/stone-age-io/agent/internal/debug"
+	"github.com/stone-age-io/agent/internal/gpio"
+	"github.com/stone-age-io/agent/internal/logship"
+	"github.com/stone-age-io/agent/internal/logsink"
+	"github.com/stone-age-io/agent/internal/mqtt"
 	natsclient "github.com/stone-age-io/agent/internal/nats"
 	"github.com/stone-age-io/agent/internal/scheduler"
+	"github.com/stone-age-io/agent/internal/secrets"
 	"github.com/stone-age-io/agent/internal/tasks"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// ErrReload is returned by Run when a config reload was requested over the
+// control channel. The caller creates a new Agent from the same config path.
+var ErrReload = errors.New("config reload requested")
+
+// ErrRestart is returned by Run when the memory watchdog tripped. The
+// process should exit non-zero so the service manager starts a fresh one.
+var ErrRestart = errors.New("restart requested by memory watchdog")
+
 // Agent represents the main agent
 type Agent struct {
-	config    *config.Config
-	logger    *zap.Logger
-	nats      *natsclient.Client
-	scheduler *scheduler.Scheduler
-	handlers  *natsclient.CommandHandlers
-	version   string
-	ctx       context.Context    // ADDED: Root context for clean shutdown
-	cancel    context.CancelFunc // ADDED: Cancel function for shutdown
+	config     *config.Config
+	configPath string
+	logger     *zap.Logger
+	level      zap.AtomicLevel // File/console log level, changeable via agentctl
+	logFile    *logFile        // Rotated log file, paused by the disk guard
+	diskLow    atomic.Bool     // Disk guard tripped: periodic state files aren't written
+	nats       *natsclient.Client
+	scheduler  *scheduler.Scheduler
+	handlers   *natsclient.CommandHandlers
+	executor   *tasks.Executor
+	build      tasks.BuildInfo
+	provider   string                   // Bootstrap provider (pocketbase/vault/http), empty if not bootstrapped
+	rotateMu   sync.Mutex               // Serializes credential rotation
+	debug      *debug.Server            // Local pprof/expvar endpoint, nil if disabled
+	shipper    *logship.Shipper         // NATS log shipper, nil if disabled
+	queue      *natsclient.CommandQueue // Durable command queue, nil if disabled
+	control    *control.Server          // Local agentctl channel, nil if disabled
+	bridge     *mqtt.Bridge             // Site-local MQTT bridge, nil if disabled
+	gpio       *gpio.Controller         // Whitelisted GPIO pins, nil if disabled
+	reload     chan struct{}            // Signalled by a validated config.reload
+	restart    chan struct{}            // Signalled by the memory watchdog
+	stopOnce   sync.Once                // Publishes the stopping lifecycle message once
+	crash      *tasks.CrashReport       // Previous run's unpublished crash report, nil if none
+	ctx        context.Context          // ADDED: Root context for clean shutdown
+	cancel     context.CancelFunc       // ADDED: Cancel function for shutdown
 }
 
 // New creates a new agent instance
-func New(configPath string, version string) (*Agent, error) {
+func New(configPath string, build tasks.BuildInfo) (*Agent, error) {
+	// Replace a minimal bootstrap config with the full config from the
+	// platform on first start. Runs before the real logger exists, so log to
+	// stderr where the service manager captures it.
+	bootLogger, err := zap.NewProduction()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize bootstrap logger: %w", err)
+	}
+	if err := bootstrap.FetchConfig(configPath, bootLogger); err != nil {
+		return nil, fmt.Errorf("failed to bootstrap config: %w", err)
+	}
+
 	// Load configuration
 	cfg, err := config.Load(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// On an immutable image, fail now with the paths to fix rather than on
+	// the first write
+	if err := checkImmutable(cfg); err != nil {
+		return nil, err
+	}
+
+	// Pick up a crash left by the previous run before this run's log lines
+	// follow its log tail, then catch this run's own panics and fatal errors
+	var crash *tasks.CrashReport
+	var crashErr, armErr error
+	if !config.StateInMemory(cfg) {
+		crash, crashErr = tasks.CollectCrashReport(cfg.DataDir, cfg.Logging.File)
+		armErr = tasks.ArmCrashOutput(cfg.DataDir)
+	}
+
 	// Initialize logger
-	logger, err := initLogger(cfg.Logging)
+	logger, level, logFile, err := initLogger(cfg.Logging)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
 	}
 
+	// Tee WARN+ entries into the NATS log shipper; they are buffered until
+	// NATS connects, so startup errors are shipped too
+	var shipper *logship.Shipper
+	if cfg.Logging.Ship.Enabled {
+		shipper, err = logship.New(cfg.Logging.Ship, cfg.Code, cfg.Location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize log shipping: %w", err)
+		}
+		logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(c, shipper.Core())
+		}))
+	}
+
 	logger.Info("Starting agent",
-		zap.String("version", version),
+		zap.String("version", build.Version),
+		zap.String("commit", build.Commit),
 		zap.String("code", cfg.Code),
 		zap.String("location", cfg.Location))
-
-	// Bootstrap NATS credentials from PocketBase if configured
-	if cfg.NATS.Auth.Type == "pocketbase" {
+	if crashErr != nil {
+		logger.Warn("Failed to collect crash report", zap.Error(crashErr))
+	} else if crash != nil {
+		logger.Warn("Previous run crashed, crash report will be published", zap.String("crashed_at", crash.CrashedAt))
+	}
+	if armErr != nil {
+		logger.Warn("Failed to set up crash capture", zap.Error(armErr))
+	}
+	applyRuntimeLimits(cfg.Runtime, logger)
+
+	// After boot the network may come up after the agent; wait for it
+	// rather than failing the first connection and exiting
+	waitForNetwork(cfg, logger)
+
+	// Bootstrap NATS credentials from PocketBase, Vault, or an HTTP endpoint if configured.
+	// The original type is kept as the provider for later credential refresh.
+	var provider string
+	switch cfg.NATS.Auth.Type {
+	case "pocketbase":
+		provider = "pocketbase"
 		if err := bootstrap.FetchCredentials(cfg, logger); err != nil {
 			return nil, fmt.Errorf("failed to bootstrap credentials: %w", err)
 		}
 		// Switch auth type to creds for the NATS client — .creds file now exists
 		cfg.NATS.Auth.Type = "creds"
+	case "http":
+		provider = "http"
+		if err := bootstrap.FetchHTTPCredentials(cfg, logger); err != nil {
+			return nil, fmt.Errorf("failed to bootstrap credentials: %w", err)
+		}
+		cfg.NATS.Auth.Type = "creds"
+	case "vault":
+		provider = "vault"
+		if err := bootstrap.FetchVaultCredentials(cfg, logger); err != nil {
+			return nil, fmt.Errorf("failed to bootstrap credentials: %w", err)
+		}
+		// Switch to the auth type matching the file Vault gave us
+		if cfg.NATS.Auth.Vault.SecretType == "nkey" {
+			cfg.NATS.Auth.Type = "nkey"
+		} else {
+			cfg.NATS.Auth.Type = "creds"
+		}
+	}
+
+	// Move plaintext credential files into the protected secret store
+	if err := protectCredentialFiles(cfg, logger); err != nil {
+		return nil, fmt.Errorf("failed to protect credentials: %w", err)
 	}
 
 	// Create root context with cancellation
@@ -73,6 +192,58 @@ func New(configPath string, version string) (*Agent, error) {
 		return nil, fmt.Errorf("failed to create executor: %w", err)
 	}
 
+	// Probe for tools and files minimal OS images lack, so what depends on
+	// them is turned off once instead of failing on every run
+	stateDir := cfg.DataDir
+	if config.StateInMemory(cfg) {
+		stateDir = ""
+	}
+	executor.DetectCapabilities(stateDir, !strings.EqualFold(cfg.Tasks.SystemMetrics.Source, "exporter"))
+
+	// Bound metrics scrapes by the task timeout (0 = the interval)
+	scrapeTimeout := cfg.Tasks.SystemMetrics.Timeout
+	if scrapeTimeout == 0 {
+		scrapeTimeout = cfg.Tasks.SystemMetrics.Interval
+	}
+	executor.SetScrapeTimeout(scrapeTimeout)
+	executor.SetExporterRequest(&cfg.Tasks.SystemMetrics.ExporterRequest)
+	if err := executor.SetExporterTLS(cfg.Tasks.SystemMetrics.ExporterTLS); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to configure exporter TLS: %w", err)
+	}
+	if cfg.Tasks.SystemMetrics.Fallback.Enabled {
+		executor.SetExporterFallback(cfg.Tasks.SystemMetrics.Fallback.Failures, cfg.Tasks.SystemMetrics.Fallback.RetryInterval)
+	}
+
+	diskFilter, err := tasks.NewDiskFilter(cfg.Tasks.SystemMetrics.IncludeDisks, cfg.Tasks.SystemMetrics.ExcludeDisks)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("invalid disk filter: %w", err)
+	}
+	executor.SetDiskFilter(diskFilter)
+	executor.SetDiskIO(cfg.Tasks.SystemMetrics.DiskIO)
+	executor.SetExtraFamilies(cfg.Tasks.SystemMetrics.ExtraFamilies)
+	executor.SetCounters(cfg.Tasks.SystemMetrics.Counters)
+	executor.SetCgroups(cfg.Tasks.SystemMetrics.Cgroups)
+	executor.SetReloadPidfiles(cfg.Commands.ReloadPidfiles)
+	if executor.Unavailable("tasks.system_metrics.top_processes") == nil {
+		executor.SetTopProcesses(cfg.Tasks.SystemMetrics.TopProcesses)
+	}
+	if cfg.Tasks.SystemMetrics.Enabled && executor.Unavailable("tasks.system_metrics.cpu_sample_interval") == nil {
+		executor.StartCPUSampling(cfg.Tasks.SystemMetrics.CPUSampleInterval)
+	}
+
+	// Restore the CPU/disk counter baseline saved on the last shutdown so the
+	// first scrape after a restart already has rates
+	if cfg.Tasks.SystemMetrics.Enabled {
+		restored, err := executor.LoadMetricsBaseline(metricsBaselinePath(cfg))
+		if err != nil {
+			logger.Warn("Failed to load metrics baseline", zap.Error(err))
+		} else if restored {
+			logger.Info("Restored metrics baseline from previous run")
+		}
+	}
+
 	// Connect to NATS
 	logger.Info("Connecting to NATS...")
 	natsClient, err := natsclient.NewClient(&cfg.NATS, logger)
@@ -80,9 +251,24 @@ func New(configPath string, version string) (*Agent, error) {
 		cancel() // ADDED: Cancel context on error
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
+	natsClient.SetTags(cfg.Tags)
+	if cfg.Commands.Diag.Enabled {
+		natsClient.KeepRecentTelemetry(cfg.Commands.Diag.TelemetryPayloads)
+	}
+
+	// Claim GPIO lines now so outputs take their initial value at startup;
+	// a line that can't be claimed is retried when used
+	var pins *gpio.Controller
+	if cfg.GPIO.Enabled {
+		pins = gpio.New(cfg.GPIO)
+		if err := pins.Claim(); err != nil {
+			logger.Warn("Failed to claim gpio pins", zap.Error(err))
+		}
+		executor.SetGPIO(pins)
+	}
 
 	// Create command handlers (now with NATS client for health checks and version)
-	handlers := natsclient.NewCommandHandlers(logger, cfg, executor, natsClient, version)
+	handlers := natsclient.NewCommandHandlers(logger, cfg, executor, natsClient, build)
 
 	// Subscribe to commands
 	logger.Info("Subscribing to commands...")
@@ -92,25 +278,87 @@ func New(configPath string, version string) (*Agent, error) {
 		return nil, fmt.Errorf("failed to subscribe to commands: %w", err)
 	}
 
+	// Bind the durable command queue (commands issued while offline)
+	var queue *natsclient.CommandQueue
+	if cfg.Commands.Queue.Enabled {
+		queue, err = natsclient.NewCommandQueue(logger, cfg, natsClient, handlers)
+		if err != nil {
+			cancel()
+			natsClient.Close()
+			return nil, fmt.Errorf("failed to start command queue: %w", err)
+		}
+	}
+
 	// Create and start scheduler
 	logger.Info("Starting scheduler...")
-	sched, err := scheduler.New(logger, natsClient, executor, cfg, version, ctx)
+	sched, err := scheduler.New(logger, natsClient, executor, cfg, build, ctx)
 	if err != nil {
 		cancel() // ADDED: Cancel context on error
 		natsClient.Close()
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
 
-	return &Agent{
-		config:    cfg,
-		logger:    logger,
-		nats:      natsClient,
-		scheduler: sched,
-		handlers:  handlers,
-		version:   version,
-		ctx:       ctx,    // ADDED: Store context
-		cancel:    cancel, // ADDED: Store cancel function
-	}, nil
+	// Bridge the site-local MQTT broker into telemetry
+	var bridge *mqtt.Bridge
+	if cfg.MQTT.Enabled {
+		bridge = mqtt.New(cfg.MQTT, cfg.Code, cfg.Location, cfg.SubjectPrefix, logger)
+	}
+
+	agent := &Agent{
+		config:     cfg,
+		configPath: configPath,
+		logger:     logger,
+		level:      level,
+		logFile:    logFile,
+		nats:       natsClient,
+		scheduler:  sched,
+		handlers:   handlers,
+		executor:   executor,
+		build:      build,
+		provider:   provider,
+		shipper:    shipper,
+		queue:      queue,
+		bridge:     bridge,
+		gpio:       pins,
+		crash:      crash,
+		reload:     make(chan struct{}, 1),
+		restart:    make(chan struct{}, 1),
+		ctx:        ctx,    // ADDED: Store context
+		cancel:     cancel, // ADDED: Store cancel function
+	}
+
+	// Report scheduler state in cmd.health
+	handlers.SetSchedulerHealth(sched.Health)
+
+	// Command handlers raise events (e.g. firewall changes) through the
+	// scheduler, which owns the event sequence
+	handlers.SetEventPublisher(sched.PublishEvent)
+
+	// cmd.task.configure reschedules tasks, which the scheduler owns
+	handlers.SetTaskConfigurer(sched.ConfigureTask)
+
+	// A tripped memory watchdog restarts the process
+	sched.SetMemoryLimitHandler(func() {
+		select {
+		case agent.restart <- struct{}{}:
+		default:
+		}
+	})
+
+	// A low disk stops the agent's own disk writes until space is freed
+	sched.SetDiskLowHandler(func(low bool) {
+		agent.diskLow.Store(low)
+		if agent.logFile != nil {
+			agent.logFile.paused.Store(low)
+		}
+	})
+
+	// Bootstrapped credentials can be rotated on demand or periodically
+	if provider != "" {
+		handlers.SetCredentialRotator(agent.rotateCredentials)
+	}
+
+	return agent, nil
 }
 
 // Run starts the agent and blocks until shutdown
@@ -118,9 +366,75 @@ func (a *Agent) Run() error {
 	// Start the scheduler
 	a.scheduler.Start()
 
+	// Record that this run is live and tell the control plane why the agent
+	// (re)started; a run that never reaches Shutdown is reported as a crash
+	// by the next one
+	bootReason := tasks.BootReasonStart
+	if a.executor.Unavailable("data_dir") == nil {
+		var err error
+		bootReason, err = tasks.MarkRunning(lifecyclePath(a.config))
+		if err != nil {
+			a.logger.Warn("Failed to record lifecycle state", zap.Error(err))
+		}
+	}
+	a.scheduler.PublishOnline(bootReason)
+	if a.crash != nil {
+		go a.publishCrash()
+	}
+	go a.runtimeSnapshotLoop()
+
+	// Reload rotated TLS certificates without a restart
+	a.nats.WatchTLS(a.ctx)
+
+	// Run commands queued while the device was offline
+	if a.queue != nil {
+		a.queue.Run(a.ctx)
+	}
+
+	// Start the local pprof/expvar endpoint if enabled
+	if a.config.Debug.Enabled {
+		a.debug = debug.NewServer(&a.config.Debug, a.logger)
+		if err := a.debug.Start(); err != nil {
+			// Diagnostics must never take the agent down
+			a.logger.Error("Failed to start debug endpoint", zap.Error(err))
+			a.debug = nil
+		}
+	}
+
+	// Start the local agentctl channel if enabled
+	if a.config.Control.Enabled {
+		a.control = control.NewServer(a.config.Control.Socket, control.Actions{
+			Status:   a.handlers.HealthJSON,
+			RunTask:  a.scheduler.RunTask,
+			Reload:   a.requestReload,
+			LogLevel: a.setLogLevel,
+		}, a.logger)
+		if err := a.control.Start(); err != nil {
+			// Like the debug endpoint, the control channel is optional
+			a.logger.Error("Failed to start control channel", zap.Error(err))
+			a.control = nil
+		}
+	}
+
+	// Ship the agent's own log entries to NATS
+	if a.shipper != nil {
+		subject := fmt.Sprintf("%s.%s.agentlog", a.config.SubjectPrefix, a.config.Code)
+		go a.shipper.Run(a.ctx, a.nats, subject)
+	}
+
+	// Republish MQTT sensor messages; reconnects on its own
+	if a.bridge != nil {
+		go a.bridge.Run(a.ctx, a.nats)
+	}
+
+	// Start periodic credential refresh if configured
+	if a.provider != "" && a.config.NATS.Auth.RefreshInterval > 0 {
+		go a.credentialRefreshLoop(a.config.NATS.Auth.RefreshInterval)
+	}
+
 	a.logger.Info("Agent running",
 		zap.String("code", a.config.Code),
-		zap.String("version", a.version))
+		zap.String("version", a.build.Version))
 
 	// Wait for shutdown signal
 	sigChan := make(chan os.Signal, 1)
@@ -129,8 +443,21 @@ func (a *Agent) Run() error {
 	select {
 	case <-sigChan:
 		a.logger.Info("Received shutdown signal")
+		return a.shutdown(tasks.StopReasonSignal)
 	case <-a.ctx.Done():
 		a.logger.Info("Context cancelled")
+	case <-a.reload:
+		a.logger.Info("Restarting to apply reloaded config")
+		if err := a.shutdown(tasks.StopReasonReload); err != nil {
+			return err
+		}
+		return ErrReload
+	case <-a.restart:
+		a.logger.Warn("Restarting agent, memory watchdog limit exceeded")
+		if err := a.shutdown(tasks.StopReasonMemory); err != nil {
+			return err
+		}
+		return ErrRestart
 	}
 
 	return a.Shutdown()
@@ -138,7 +465,13 @@ func (a *Agent) Run() error {
 
 // Shutdown gracefully shuts down the agent
 func (a *Agent) Shutdown() error {
-	a.logger.Info("Shutting down agent gracefully")
+	return a.shutdown(tasks.StopReasonService)
+}
+
+// shutdown gracefully shuts down the agent, reporting reason (one of the
+// tasks.StopReason* constants) in the stopping lifecycle message
+func (a *Agent) shutdown(reason string) error {
+	a.logger.Info("Shutting down agent gracefully", zap.String("reason", reason))
 
 	// ADDED: Cancel context to signal all operations to stop
 	a.cancel()
@@ -148,6 +481,65 @@ func (a *Agent) Shutdown() error {
 		a.logger.Error("Error shutting down scheduler", zap.Error(err))
 	}
 
+	// Tell the control plane this stop is planned, before the connection
+	// drains. Shutdown may run twice (service stop, then Run returning).
+	a.stopOnce.Do(func() {
+		a.scheduler.PublishStopping(reason, stoppingTimeout)
+		if a.executor.Unavailable("data_dir") != nil {
+			return
+		}
+		if err := tasks.MarkStopped(lifecyclePath(a.config), reason); err != nil {
+			a.logger.Warn("Failed to record lifecycle state", zap.Error(err))
+		}
+	})
+
+	// Save the metrics baseline once no scrape can update it
+	if a.config.Tasks.SystemMetrics.Enabled && a.executor.Unavailable("data_dir") == nil {
+		if err := a.executor.SaveMetricsBaseline(metricsBaselinePath(a.config)); err != nil {
+			a.logger.Warn("Failed to save metrics baseline", zap.Error(err))
+		}
+	}
+
+	// Stop the control channel
+	if a.control != nil {
+		if err := a.control.Shutdown(); err != nil {
+			a.logger.Error("Error shutting down control channel", zap.Error(err))
+		}
+	}
+
+	// Stop the debug endpoint
+	if a.debug != nil {
+		if err := a.debug.Shutdown(); err != nil {
+			a.logger.Error("Error shutting down debug endpoint", zap.Error(err))
+		}
+	}
+
+	// Context cancellation makes the log shipper flush; let it finish
+	// before the connection drains
+	if a.shipper != nil {
+		a.shipper.Wait(5 * time.Second)
+	}
+
+	// Context cancellation disconnects the MQTT bridge
+	if a.bridge != nil {
+		a.bridge.Wait(5 * time.Second)
+	}
+
+	// Delayed broadcast replies would go out on a draining connection
+	if a.handlers != nil {
+		a.handlers.StopBroadcasts()
+	}
+
+	// Let an in-flight queued command finish and ack before draining
+	if a.queue != nil {
+		a.queue.Wait(a.config.Commands.Timeout)
+	}
+
+	// Release GPIO lines once no command or poll can use them
+	if a.gpio != nil {
+		a.gpio.Close()
+	}
+
 	// MODIFIED: Use context for drain timeout
 	drainCtx, drainCancel := context.WithTimeout(context.Background(), a.config.NATS.DrainTimeout)
 	defer drainCancel()
@@ -164,12 +556,309 @@ func (a *Agent) Shutdown() error {
 	return nil
 }
 
-// initLogger creates and configures the logger with log rotation
-func initLogger(cfg config.LoggingConfig) (*zap.Logger, error) {
+// publishCrash publishes the previous run's crash report, keeping it for
+// the next start if it isn't stored
+func (a *Agent) publishCrash() {
+	if !a.scheduler.PublishCrash(a.crash, crashPublishTimeout) {
+		return
+	}
+	if err := tasks.ClearCrashReport(a.config.DataDir); err != nil {
+		a.logger.Warn("Failed to remove published crash report", zap.Error(err))
+	}
+}
+
+// runtimeSnapshotLoop saves runtime stats for a crash report until
+// shutdown. On a read-only data dir there is nowhere to keep them.
+func (a *Agent) runtimeSnapshotLoop() {
+	if a.executor.Unavailable("data_dir") != nil {
+		return
+	}
+
+	ticker := time.NewTicker(tasks.RuntimeSnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		if a.diskLow.Load() {
+			// The disk guard has stopped disk writes
+		} else if err := a.executor.SaveRuntimeSnapshot(a.config.DataDir, a.build.Version); err != nil {
+			a.logger.Debug("Failed to save runtime stats", zap.Error(err))
+		}
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// crashPublishTimeout bounds the wait for the crash report's ack
+const crashPublishTimeout = 10 * time.Second
+
+// stoppingTimeout bounds the wait for the stopping lifecycle message's ack
+const stoppingTimeout = 2 * time.Second
+
+// lifecyclePath is where the run state used for the boot reason is kept
+func lifecyclePath(cfg *config.Config) string {
+	return filepath.Join(cfg.DataDir, "lifecycle.json")
+}
+
+// applyRuntimeLimits sets the Go soft memory limit, GC percent and
+// GOMAXPROCS from config; unset values leave GOMEMLIMIT/GOGC/GOMAXPROCS from
+// the environment in effect
+func applyRuntimeLimits(cfg config.RuntimeConfig, logger *zap.Logger) {
+	if cfg.MemoryLimitMB > 0 {
+		rtdebug.SetMemoryLimit(int64(cfg.MemoryLimitMB) * 1024 * 1024)
+	}
+	if cfg.GCPercent != 0 {
+		rtdebug.SetGCPercent(cfg.GCPercent)
+	}
+	if cfg.MaxProcs > 0 {
+		runtime.GOMAXPROCS(cfg.MaxProcs)
+	}
+	if cfg.MemoryLimitMB > 0 || cfg.GCPercent != 0 || cfg.MaxProcs > 0 {
+		logger.Info("Applied runtime memory settings",
+			zap.Int("memory_limit_mb", cfg.MemoryLimitMB),
+			zap.Int("gc_percent", cfg.GCPercent),
+			zap.Int("max_procs", cfg.MaxProcs))
+	}
+}
+
+// waitForNetwork waits up to startup.wait_timeout for the endpoints the
+// agent needs at startup: the NATS servers, the credential bootstrap
+// endpoint, and the exporter for the exporter and hybrid sources
+func waitForNetwork(cfg *config.Config, logger *zap.Logger) {
+	if cfg.Startup.WaitTimeout == 0 {
+		return
+	}
+
+	auth := cfg.NATS.Auth
+	candidates := []tasks.StartupTarget{tasks.StartupTargetFromURLs("nats", cfg.NATS.URLs...)}
+	switch auth.Type {
+	case "pocketbase":
+		candidates = append(candidates, tasks.StartupTargetFromURLs("bootstrap", auth.PocketBase.URL))
+	case "http":
+		candidates = append(candidates, tasks.StartupTargetFromURLs("bootstrap", auth.HTTP.URL))
+	case "vault":
+		candidates = append(candidates, tasks.StartupTargetFromURLs("bootstrap", auth.Vault.Address))
+	}
+	switch strings.ToLower(cfg.Tasks.SystemMetrics.Source) {
+	case "exporter", "hybrid":
+		if cfg.Tasks.SystemMetrics.Enabled {
+			candidates = append(candidates, tasks.StartupTargetFromURLs("exporter", cfg.Tasks.SystemMetrics.ExporterURL))
+		}
+	}
+	var targets []tasks.StartupTarget
+	for _, target := range candidates {
+		if len(target.Addrs) > 0 {
+			targets = append(targets, target)
+		}
+	}
+
+	start := time.Now()
+	unreachable := tasks.WaitForStartup(context.Background(), targets, cfg.Startup.WaitTimeout, cfg.Startup.MaxBackoff, logger)
+	if len(unreachable) > 0 {
+		logger.Warn("Startup dependencies still unreachable, starting anyway",
+			zap.Strings("targets", unreachable),
+			zap.Duration("waited", time.Since(start).Round(time.Second)))
+	}
+}
+
+// checkImmutable verifies, with immutable.enabled, that every directory the
+// agent writes to exists and is writable: data_dir (unless state is kept in
+// memory), the log file's directory, where bootstrapped credentials are
+// written, and where a missing secret key would be generated
+func checkImmutable(cfg *config.Config) error {
+	if !cfg.Immutable.Enabled {
+		return nil
+	}
+
+	var dirs []string
+	if !config.StateInMemory(cfg) {
+		dirs = append(dirs, cfg.DataDir)
+	}
+	if cfg.Logging.File != "" {
+		dirs = append(dirs, filepath.Dir(cfg.Logging.File))
+	}
+	auth := cfg.NATS.Auth
+	switch {
+	case auth.Type == "vault" && auth.Vault.SecretType == "nkey":
+		dirs = append(dirs, filepath.Dir(auth.NkeyFile))
+	case auth.Type == "pocketbase" || auth.Type == "http" || auth.Type == "vault":
+		dirs = append(dirs, filepath.Dir(auth.CredsFile))
+	}
+	if auth.SecretStore == secrets.StoreEncrypted {
+		if _, err := os.Stat(auth.SecretKeyFile); errors.Is(err, os.ErrNotExist) {
+			dirs = append(dirs, filepath.Dir(auth.SecretKeyFile))
+		}
+	}
+
+	var problems []string
+	checked := make(map[string]bool)
+	for _, dir := range dirs {
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if _, err := tasks.CheckWritable(dir); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("immutable mode: agent paths are not writable: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// withinDir reports whether path is dir or below it
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// metricsBaselinePath is where the metrics rate baseline is kept between runs
+func metricsBaselinePath(cfg *config.Config) string {
+	return filepath.Join(cfg.DataDir, "metrics-baseline.json")
+}
+
+// protectCredentialFiles re-writes existing plaintext .creds / nkey seed
+// files with the configured secret store, so switching secret_store on an
+// already provisioned device takes effect without re-bootstrapping
+func protectCredentialFiles(cfg *config.Config, logger *zap.Logger) error {
+	opts := secrets.Options{Store: cfg.NATS.Auth.SecretStore, KeyFile: cfg.NATS.Auth.SecretKeyFile}
+	if !opts.Protected() {
+		return nil
+	}
+
+	var path string
+	switch cfg.NATS.Auth.Type {
+	case "creds":
+		path = cfg.NATS.Auth.CredsFile
+	case "nkey":
+		path = cfg.NATS.Auth.NkeyFile
+	default:
+		return nil
+	}
+	if cfg.Immutable.Enabled && !withinDir(path, cfg.DataDir) {
+		// Part of the read-only image; it can't be re-written in place
+		logger.Info("Credential file left as provisioned on immutable image", zap.String("path", path))
+		return nil
+	}
+
+	migrated, err := secrets.Protect(path, opts)
+	if err != nil {
+		return err
+	}
+	if migrated {
+		logger.Info("Credential file moved to protected secret store",
+			zap.String("path", path),
+			zap.String("secret_store", opts.Store))
+	}
+	return nil
+}
+
+// rotateCredentials re-fetches credentials from the bootstrap provider and,
+// if they changed, forces a NATS reconnect so the new credentials are used.
+// Serialized so a command and the refresh loop can't race on the file.
+func (a *Agent) rotateCredentials() (bool, error) {
+	a.rotateMu.Lock()
+	defer a.rotateMu.Unlock()
+
+	changed, err := bootstrap.RefreshCredentials(a.config, a.provider, a.logger)
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if err := a.nats.Reconnect(); err != nil {
+		return true, fmt.Errorf("credentials written but reconnect failed: %w", err)
+	}
+	return true, nil
+}
+
+// requestReload validates the config file and, if it loads, makes Run shut
+// down and return ErrReload. An invalid config leaves the agent running.
+func (a *Agent) requestReload() error {
+	if _, err := config.Load(a.configPath); err != nil {
+		return err
+	}
+	select {
+	case a.reload <- struct{}{}:
+	default: // A reload is already pending
+	}
+	return nil
+}
+
+// setLogLevel changes the file/console log level until the next restart or
+// reload, and returns the level in effect. An empty level only reports it.
+func (a *Agent) setLogLevel(level string) (string, error) {
+	if level == "" {
+		return a.level.Level().String(), nil
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil || l < zapcore.DebugLevel || l > zapcore.ErrorLevel {
+		return "", fmt.Errorf("invalid log level: %s (must be debug, info, warn, or error)", level)
+	}
+	a.level.SetLevel(l)
+	a.logger.Info("Log level changed", zap.String("level", l.String()))
+	return l.String(), nil
+}
+
+// credentialRefreshLoop periodically refreshes bootstrapped credentials so
+// expiring JWTs are replaced before they take the device offline. Failures
+// keep the current credentials and are retried on the next tick.
+func (a *Agent) credentialRefreshLoop(interval time.Duration) {
+	a.logger.Info("Credential refresh enabled",
+		zap.String("provider", a.provider),
+		zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+			rotated, err := a.rotateCredentials()
+			if err != nil {
+				a.logger.Warn("Credential refresh failed, keeping current credentials", zap.Error(err))
+				continue
+			}
+			if rotated {
+				a.logger.Info("Credentials rotated and NATS reconnected")
+			}
+		}
+	}
+}
+
+// logFile is the rotated log file. While paused (the disk guard tripped)
+// entries are dropped rather than written; the console and the other
+// sinks still get them.
+type logFile struct {
+	*lumberjack.Logger
+	paused atomic.Bool
+}
+
+func (f *logFile) Write(p []byte) (int, error) {
+	if f.paused.Load() {
+		return len(p), nil
+	}
+	return f.Logger.Write(p)
+}
+
+// initLogger creates and configures the logger with log rotation. The
+// returned level controls the file and (if enabled) console cores.
+func initLogger(cfg config.LoggingConfig) (*zap.Logger, zap.AtomicLevel, *logFile, error) {
 	// Parse log level
-	var level zapcore.Level
-	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
-		return nil, fmt.Errorf("invalid log level: %w", err)
+	level, err := zap.ParseAtomicLevel(cfg.Level)
+	if err != nil {
+		return nil, level, nil, fmt.Errorf("invalid log level: %w", err)
 	}
 
 	// Create encoder config
@@ -180,25 +869,47 @@ func initLogger(cfg config.LoggingConfig) (*zap.Logger, error) {
 	// Create encoder for JSON logging
 	fileEncoder := zapcore.NewJSONEncoder(encoderConfig)
 
-	// Setup log rotation with lumberjack
-	fileWriter := &lumberjack.Logger{
-		Filename:   cfg.File,
-		MaxSize:    cfg.MaxSizeMB, // megabytes
-		MaxBackups: cfg.MaxBackups,
-		MaxAge:     28, // days
-		Compress:   true,
+	// Setup log rotation with lumberjack; no file at all without a path
+	// (immutable.state: memory), or lumberjack would pick one in the temp dir
+	var cores []zapcore.Core
+	var fileWriter *logFile
+	if cfg.File != "" {
+		fileWriter = &logFile{Logger: &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB, // megabytes
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays, // days
+			Compress:   cfg.Compress,
+		}}
+		cores = append(cores, zapcore.NewCore(fileEncoder, zapcore.AddSync(fileWriter), level))
+	}
+
+	// Console output for stdout (during development/debugging). Under
+	// systemd it duplicates the log file into the journal.
+	if cfg.Console {
+		consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
+		cores = append(cores, zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), level))
 	}
 
-	// Create console encoder for stdout (during development/debugging)
-	consoleEncoder := zapcore.NewConsoleEncoder(encoderConfig)
+	// Optional OS log sinks (each has its own minimum level)
+	if cfg.Syslog.Enabled {
+		syslogCore, err := logsink.NewSyslogCore(cfg.Syslog)
+		if err != nil {
+			return nil, level, nil, err
+		}
+		cores = append(cores, syslogCore)
+	}
+	if cfg.EventLog.Enabled {
+		eventLogCore, err := logsink.NewEventLogCore(cfg.EventLog)
+		if err != nil {
+			return nil, level, nil, err
+		}
+		cores = append(cores, eventLogCore)
+	}
 
-	// Create multi-writer core (file with rotation + console)
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, zapcore.AddSync(fileWriter), level),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), level),
-	)
+	core := zapcore.NewTee(cores...)
 
 	logger := zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel))
 
-	return logger, nil
+	return logger, level, fileWriter, nil
 }
@@ -0,0 +1,535 @@
+// Package bacnet is a minimal BACnet/IP client: it discovers devices with
+// Who-Is/I-Am and reads the points in the bacnet config section with
+// ReadProperty. Devices behind BACnet routers are reached through the
+// network number and MAC address in their I-Am. Segmented responses are
+// not supported, which limits reads to single values.
+package bacnet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// attempts is how many times a confirmed request is sent before it times
+// out; BACnet/IP runs over UDP, so single datagrams do get lost
+const attempts = 2
+
+// Confirmed and unconfirmed service choices
+const (
+	serviceReadProperty = 0x0C
+	serviceIAm          = 0x00
+	serviceWhoIs        = 0x08
+)
+
+// APDU types (high nibble of the first octet)
+const (
+	pduConfirmedRequest   = 0x0
+	pduUnconfirmedRequest = 0x1
+	pduSimpleAck          = 0x2
+	pduComplexAck         = 0x3
+	pduError              = 0x5
+	pduReject             = 0x6
+	pduAbort              = 0x7
+)
+
+// errTimeout is returned when a device doesn't answer a request
+var errTimeout = errors.New("timeout waiting for response")
+
+// Device is a device that answered Who-Is
+type Device struct {
+	Instance uint32 `json:"instance"`
+	Address  string `json:"address"`           // BACnet/IP address of the device, or of its router
+	Network  uint16 `json:"network,omitempty"` // Remote network number, for devices behind a router
+	MAC      string `json:"mac,omitempty"`     // Hex MAC address on the remote network
+	MaxAPDU  uint32 `json:"max_apdu"`
+	VendorID uint32 `json:"vendor_id"`
+
+	addr address
+	seen time.Time
+}
+
+// DeviceList is published on {prefix}.{code}.telemetry.bacnet.devices after
+// each discovery. Code/Location/MessageMeta are stamped by the scheduler.
+type DeviceList struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	tasks.MessageMeta
+
+	Devices []Device `json:"devices"`
+	TS      string   `json:"ts"`
+}
+
+// Reading is published on {prefix}.{code}.telemetry.bacnet.<device> after
+// each poll. Code/Location/MessageMeta are stamped by the scheduler.
+type Reading struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	tasks.MessageMeta
+
+	Device   string                 `json:"device"`
+	Instance uint32                 `json:"instance"`
+	Values   map[string]interface{} `json:"values"`           // By point name: number, bool, string or null
+	Errors   map[string]string      `json:"errors,omitempty"` // Points whose read failed, by name
+	TS       string                 `json:"ts"`
+}
+
+// Client shares one UDP socket between discovery and every device poll.
+// The socket is opened on first use, so a port conflict is reported by
+// each task rather than failing the agent.
+type Client struct {
+	cfg    config.BACnetConfig
+	logger *zap.Logger
+
+	mu         sync.Mutex
+	conn       *net.UDPConn
+	closed     bool
+	nextInvoke byte
+	pending    map[byte]chan []byte // Response APDUs by invoke ID
+	devices    map[uint32]*Device   // Devices seen in an I-Am, by instance
+	updated    chan struct{}        // Closed and replaced whenever devices changes
+}
+
+// NewClient creates a client. Call Close when done.
+func NewClient(cfg config.BACnetConfig, logger *zap.Logger) *Client {
+	return &Client{
+		cfg:     cfg,
+		logger:  logger.With(zap.String("component", "bacnet")),
+		pending: make(map[byte]chan []byte),
+		devices: make(map[uint32]*Device),
+		updated: make(chan struct{}),
+	}
+}
+
+// Close closes the socket. Requests in flight fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// open returns the socket, binding it on first use
+func (c *Client) open() (*net.UDPConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+	if c.conn != nil {
+		return c.conn, nil
+	}
+
+	laddr, err := net.ResolveUDPAddr("udp4", c.cfg.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp4", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind %s: %w", c.cfg.Listen, err)
+	}
+	c.conn = conn
+	go c.readLoop(conn)
+	return conn, nil
+}
+
+// readLoop dispatches responses to waiting requests and records I-Am
+// announcements until the socket is closed
+func (c *Client) readLoop(conn *net.UDPConn) {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			c.mu.Lock()
+			if c.conn == conn {
+				// Rebind on the next request
+				c.conn = nil
+				conn.Close()
+			}
+			c.mu.Unlock()
+			if !errors.Is(err, net.ErrClosed) {
+				c.logger.Warn("BACnet socket read failed", zap.Error(err))
+			}
+			return
+		}
+
+		src, apdu, err := decodeFrame(buf[:n], from)
+		if err != nil || len(apdu) < 2 {
+			continue
+		}
+
+		switch apdu[0] >> 4 {
+		case pduUnconfirmedRequest:
+			if apdu[1] == serviceIAm {
+				c.handleIAm(src, apdu[2:])
+			}
+		case pduSimpleAck, pduComplexAck, pduError, pduReject, pduAbort:
+			c.mu.Lock()
+			ch, ok := c.pending[apdu[1]]
+			c.mu.Unlock()
+			if ok {
+				select {
+				case ch <- append([]byte(nil), apdu...):
+				default:
+				}
+			}
+		}
+	}
+}
+
+// handleIAm records a device from its I-Am: device object identifier, max
+// APDU length, segmentation support and vendor ID
+func (c *Client) handleIAm(src address, body []byte) {
+	t, n, err := decodeTag(body)
+	if err != nil || t.context || t.number != tagObjectID || t.length != 4 || len(body) < n+4 {
+		return
+	}
+	id := objectID(binary.BigEndian.Uint32(body[n:]))
+	if id.objectType() != objectTypeDevice {
+		return
+	}
+	body = body[n+4:]
+
+	var fields [3]interface{}
+	for i := range fields {
+		v, n, err := decodeValue(body)
+		if err != nil {
+			return
+		}
+		fields[i] = v
+		body = body[n:]
+	}
+	maxAPDU, _ := fields[0].(float64)
+	vendorID, _ := fields[2].(float64)
+	instance := id.instance()
+
+	device := &Device{
+		Instance: instance,
+		Address:  src.udp.String(),
+		Network:  src.network,
+		MaxAPDU:  uint32(maxAPDU),
+		VendorID: uint32(vendorID),
+		addr:     src,
+		seen:     time.Now(),
+	}
+	if src.network != 0 {
+		device.MAC = fmt.Sprintf("%x", src.mac)
+	}
+
+	c.mu.Lock()
+	c.devices[instance] = device
+	close(c.updated)
+	c.updated = make(chan struct{})
+	c.mu.Unlock()
+}
+
+// whoIs broadcasts a Who-Is to every network, limited to one instance if
+// instance >= 0
+func (c *Client) whoIs(conn *net.UDPConn, instance int) error {
+	dest, err := net.ResolveUDPAddr("udp4", c.cfg.Broadcast)
+	if err != nil {
+		return fmt.Errorf("invalid broadcast address: %w", err)
+	}
+	apdu := []byte{pduUnconfirmedRequest << 4, serviceWhoIs}
+	if instance >= 0 {
+		apdu = appendContextUnsigned(apdu, 0, uint32(instance))
+		apdu = appendContextUnsigned(apdu, 1, uint32(instance))
+	}
+	frame := encodeFrame(bvlcOriginalBroadcast, globalBroadcast, nil, false, apdu)
+	if _, err := conn.WriteToUDP(frame, dest); err != nil {
+		return fmt.Errorf("failed to send who-is: %w", err)
+	}
+	return nil
+}
+
+// Discover broadcasts a Who-Is and returns every device that answered
+// within the discovery timeout, sorted by instance
+func (c *Client) Discover(ctx context.Context) ([]Device, error) {
+	conn, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := c.whoIs(conn, -1); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("discovery cancelled: %w", ctx.Err())
+	case <-time.After(c.cfg.DiscoveryTimeout):
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	devices := make([]Device, 0, len(c.devices))
+	for _, device := range c.devices {
+		if !device.seen.Before(start) {
+			devices = append(devices, *device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Instance < devices[j].Instance })
+	return devices, nil
+}
+
+// resolve returns the address of a device: its configured address, the
+// address from an earlier I-Am, or one found with a targeted Who-Is
+func (c *Client) resolve(ctx context.Context, conn *net.UDPConn, device *config.BACnetDeviceConfig) (address, error) {
+	if device.Address != "" {
+		udp, err := net.ResolveUDPAddr("udp4", device.Address)
+		if err != nil {
+			return address{}, fmt.Errorf("invalid address: %w", err)
+		}
+		return address{udp: udp}, nil
+	}
+
+	instance := uint32(device.Instance)
+	c.mu.Lock()
+	known, ok := c.devices[instance]
+	updated := c.updated
+	c.mu.Unlock()
+	if ok {
+		return known.addr, nil
+	}
+
+	if err := c.whoIs(conn, device.Instance); err != nil {
+		return address{}, err
+	}
+	timeout := time.NewTimer(c.cfg.DiscoveryTimeout)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return address{}, ctx.Err()
+		case <-timeout.C:
+			return address{}, fmt.Errorf("device %d did not answer who-is", instance)
+		case <-updated:
+		}
+		c.mu.Lock()
+		known, ok = c.devices[instance]
+		updated = c.updated
+		c.mu.Unlock()
+		if ok {
+			return known.addr, nil
+		}
+	}
+}
+
+// forget drops a device's cached address so the next poll resolves it
+// again, in case it moved
+func (c *Client) forget(instance uint32) {
+	c.mu.Lock()
+	delete(c.devices, instance)
+	c.mu.Unlock()
+}
+
+// request sends a confirmed request and returns the response APDU
+func (c *Client) request(ctx context.Context, conn *net.UDPConn, dest address, service byte, params []byte) ([]byte, error) {
+	ch := make(chan []byte, 1)
+	c.mu.Lock()
+	invoke, ok := c.allocateInvoke()
+	if ok {
+		c.pending[invoke] = ch
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("too many requests in flight")
+	}
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, invoke)
+		c.mu.Unlock()
+	}()
+
+	// No segmentation accepted, max APDU 1476 (one Ethernet frame)
+	apdu := append([]byte{pduConfirmedRequest << 4, 0x05, invoke, service}, params...)
+	frame := encodeFrame(bvlcOriginalUnicastNPDU, dest.network, dest.mac, true, apdu)
+
+	for i := 0; i < attempts; i++ {
+		if _, err := conn.WriteToUDP(frame, dest.udp); err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		timer := time.NewTimer(c.cfg.Timeout)
+		select {
+		case resp := <-ch:
+			timer.Stop()
+			return resp, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil, errTimeout
+}
+
+// allocateInvoke returns an invoke ID not in use. Caller holds mu.
+func (c *Client) allocateInvoke() (byte, bool) {
+	for i := 0; i < 256; i++ {
+		id := c.nextInvoke
+		c.nextInvoke++
+		if _, busy := c.pending[id]; !busy {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// readProperty reads one property of an object
+func (c *Client) readProperty(ctx context.Context, conn *net.UDPConn, dest address, object objectID, property uint32) (interface{}, error) {
+	params := appendContextObjectID(nil, 0, object)
+	params = appendContextUnsigned(params, 1, property)
+
+	resp, err := c.request(ctx, conn, dest, serviceReadProperty, params)
+	if err != nil {
+		return nil, err
+	}
+	return parseReadPropertyAck(resp)
+}
+
+// parseReadPropertyAck extracts the value from a ReadProperty response
+func parseReadPropertyAck(apdu []byte) (interface{}, error) {
+	if len(apdu) < 3 {
+		return nil, fmt.Errorf("truncated response")
+	}
+	switch apdu[0] >> 4 {
+	case pduComplexAck:
+	case pduError:
+		return nil, parseError(apdu)
+	case pduReject:
+		return nil, fmt.Errorf("request rejected (reason %d)", apdu[len(apdu)-1])
+	case pduAbort:
+		return nil, fmt.Errorf("request aborted (reason %d)", apdu[len(apdu)-1])
+	default:
+		return nil, fmt.Errorf("unexpected response type %d", apdu[0]>>4)
+	}
+	if apdu[0]&0x08 != 0 {
+		return nil, fmt.Errorf("segmented responses are not supported")
+	}
+	if apdu[2] != serviceReadProperty {
+		return nil, fmt.Errorf("unexpected response service")
+	}
+
+	// Skip the echoed object identifier, property and optional array index
+	// up to the opening tag of the value
+	body := apdu[3:]
+	for {
+		t, n, err := decodeTag(body)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < n+t.contentLength() {
+			return nil, fmt.Errorf("truncated response")
+		}
+		body = body[n+t.contentLength():]
+		if t.opening && t.number == 3 {
+			break
+		}
+	}
+
+	value, _, err := decodeValue(body)
+	return value, err
+}
+
+// parseError describes a BACnet Error PDU: error class and error code
+func parseError(apdu []byte) error {
+	if len(apdu) < 3 {
+		return fmt.Errorf("malformed error response")
+	}
+	body := apdu[3:]
+	class, n, err := decodeValue(body)
+	if err != nil {
+		return fmt.Errorf("malformed error response")
+	}
+	code, _, err := decodeValue(body[n:])
+	if err != nil {
+		return fmt.Errorf("malformed error response")
+	}
+
+	codes := map[float64]string{
+		31: "unknown object",
+		32: "unknown property",
+		27: "read access denied",
+		42: "value out of range",
+		50: "property is not an array",
+	}
+	if number, ok := code.(float64); ok {
+		if name, ok := codes[number]; ok {
+			return fmt.Errorf("bacnet error: %s", name)
+		}
+	}
+	return fmt.Errorf("bacnet error: class %v, code %v", class, code)
+}
+
+// Poll reads every point of device. A failed read is reported per point in
+// Errors. An error is returned if the device could not be reached or no
+// point could be read.
+func (c *Client) Poll(ctx context.Context, device *config.BACnetDeviceConfig) (*Reading, error) {
+	conn, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	dest, err := c.resolve(ctx, conn, device)
+	if err != nil {
+		return nil, err
+	}
+
+	reading := &Reading{
+		Device:   device.Name,
+		Instance: uint32(device.Instance),
+		Values:   make(map[string]interface{}),
+		TS:       utils.NowRFC3339(),
+	}
+
+	var lastErr error
+	for _, point := range device.Points {
+		var value interface{}
+		object, err := parseObject(point.Object)
+		if err == nil {
+			var property uint32
+			property, err = parseProperty(point.Property)
+			if err == nil {
+				value, err = c.readProperty(ctx, conn, dest, object, property)
+			}
+		}
+
+		if errors.Is(err, errTimeout) && len(reading.Values) == 0 {
+			// Don't wait out every point of a device that isn't answering
+			c.forget(uint32(device.Instance))
+			return nil, fmt.Errorf("device %s not responding: %w", dest, err)
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, fmt.Errorf("poll cancelled: %w", ctxErr)
+			}
+			lastErr = err
+			if reading.Errors == nil {
+				reading.Errors = make(map[string]string)
+			}
+			reading.Errors[point.Name] = err.Error()
+			continue
+		}
+		reading.Values[point.Name] = value
+	}
+
+	if len(reading.Values) == 0 {
+		return nil, fmt.Errorf("no points could be read: %w", lastErr)
+	}
+	return reading, nil
+}
@@ -0,0 +1,247 @@
+package bacnet
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestParseObject(t *testing.T) {
+	tests := []struct {
+		in       string
+		typ      uint32
+		instance uint32
+		wantErr  bool
+	}{
+		{"analog-input:1", 0, 1, false},
+		{"multi-state-value:4194302", 19, 4194302, false},
+		{"130:7", 130, 7, false},
+		{"analog-input", 0, 0, true},
+		{"bogus:1", 0, 0, true},
+		{"analog-input:4194303", 0, 0, true},
+	}
+	for _, tt := range tests {
+		o, err := parseObject(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseObject(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && (o.objectType() != tt.typ || o.instance() != tt.instance) {
+			t.Errorf("parseObject(%q) = %d:%d, want %d:%d", tt.in, o.objectType(), o.instance(), tt.typ, tt.instance)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	realValue := binary.BigEndian.AppendUint32([]byte{0x44}, math.Float32bits(72.5))
+	tests := []struct {
+		name string
+		in   []byte
+		want interface{}
+	}{
+		{"null", []byte{0x00}, nil},
+		{"boolean true", []byte{0x11}, true},
+		{"unsigned", []byte{0x22, 0x01, 0x00}, float64(256)},
+		{"signed", []byte{0x31, 0xFE}, float64(-2)},
+		{"real", realValue, 72.5},
+		{"enumerated", []byte{0x91, 0x01}, float64(1)},
+		{"character string", []byte{0x75, 0x04, 0x00, 'A', 'H', 'U'}, "AHU"},
+		{"bit string", []byte{0x82, 0x04, 0xA0}, "1010"},
+		{"object identifier", []byte{0xC4, 0x02, 0x00, 0x00, 0x05}, "8:5"},
+		{"extended length", append([]byte{0x75, 0x06, 0x00}, "hello"...), "hello"},
+	}
+	for _, tt := range tests {
+		got, n, err := decodeValue(tt.in)
+		if err != nil {
+			t.Errorf("%s: decodeValue() error = %v", tt.name, err)
+			continue
+		}
+		if got != tt.want || n != len(tt.in) {
+			t.Errorf("%s: decodeValue() = %v (%d bytes), want %v (%d bytes)", tt.name, got, n, tt.want, len(tt.in))
+		}
+	}
+
+	if _, _, err := decodeValue([]byte{0x44, 0x42}); err == nil {
+		t.Error("decodeValue() should reject a truncated real")
+	}
+}
+
+func TestDecodeFrameRouted(t *testing.T) {
+	// I-Am from device 5 on network 7 (MAC 0x0A), relayed by a router
+	frame := []byte{
+		0x81, 0x0A, 0x00, 0x00,
+		0x01, 0x08, 0x00, 0x07, 0x01, 0x0A, // NPDU: source network 7, MAC 0a
+		0x10, 0x00,
+	}
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(frame)))
+	router := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 47808}
+
+	src, apdu, err := decodeFrame(frame, router)
+	if err != nil {
+		t.Fatalf("decodeFrame() error = %v", err)
+	}
+	if src.network != 7 || !bytes.Equal(src.mac, []byte{0x0A}) || !bytes.Equal(apdu, []byte{0x10, 0x00}) {
+		t.Errorf("decodeFrame() = %v, % x", src, apdu)
+	}
+
+	// A request to it carries the destination and a hop count
+	out := encodeFrame(bvlcOriginalUnicastNPDU, src.network, src.mac, true, []byte{0x00})
+	want := []byte{0x81, 0x0A, 0x00, 0x0C, 0x01, 0x24, 0x00, 0x07, 0x01, 0x0A, 0xFF, 0x00}
+	if !bytes.Equal(out, want) {
+		t.Errorf("encodeFrame() = % x, want % x", out, want)
+	}
+}
+
+func TestParseReadPropertyAck(t *testing.T) {
+	// analog-input:1 present-value = 72.5
+	ack := []byte{0x30, 0x01, 0x0C, 0x0C, 0x00, 0x00, 0x00, 0x01, 0x19, 0x55, 0x3E, 0x44, 0x42, 0x91, 0x00, 0x00, 0x3F}
+	value, err := parseReadPropertyAck(ack)
+	if err != nil || value != 72.5 {
+		t.Errorf("parseReadPropertyAck() = %v, %v, want 72.5", value, err)
+	}
+
+	// Error: class object (1), code unknown-object (31)
+	_, err = parseReadPropertyAck([]byte{0x50, 0x01, 0x0C, 0x91, 0x01, 0x91, 0x1F})
+	if err == nil || !strings.Contains(err.Error(), "unknown object") {
+		t.Errorf("parseReadPropertyAck(error) = %v, want unknown object", err)
+	}
+
+	if _, err := parseReadPropertyAck([]byte{0x38, 0x01, 0x00, 0x01, 0x0C}); err == nil {
+		t.Error("parseReadPropertyAck() should reject a segmented response")
+	}
+}
+
+// fakeDevice answers Who-Is for its instance and ReadProperty for
+// analog-input:1 present-value (21.5) and object-name ("AHU-1"); any
+// other object gets an unknown-object error
+func fakeDevice(t *testing.T, instance uint32) string {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			_, apdu, err := decodeFrame(buf[:n], from)
+			if err != nil || len(apdu) < 2 {
+				continue
+			}
+
+			var resp []byte
+			switch {
+			case apdu[0] == pduUnconfirmedRequest<<4 && apdu[1] == serviceWhoIs:
+				resp = []byte{pduUnconfirmedRequest << 4, serviceIAm, 0xC4}
+				resp = binary.BigEndian.AppendUint32(resp, uint32(newObjectID(objectTypeDevice, instance)))
+				resp = append(resp, 0x22, 0x05, 0xC4, 0x91, 0x03, 0x21, 0x2A) // Max APDU 1476, no segmentation, vendor 42
+			case apdu[0] == pduConfirmedRequest<<4 && apdu[3] == serviceReadProperty:
+				invoke := apdu[2]
+				object := binary.BigEndian.Uint32(apdu[5:])
+				property := apdu[10]
+				if objectID(object) != newObjectID(0, 1) {
+					resp = []byte{pduError << 4, invoke, serviceReadProperty, 0x91, 0x01, 0x91, 0x1F}
+					break
+				}
+				resp = append([]byte{pduComplexAck << 4, invoke, serviceReadProperty}, apdu[4:11]...)
+				resp = append(resp, 0x3E)
+				if property == 77 {
+					resp = append(resp, 0x75, 0x06, 0x00, 'A', 'H', 'U', '-', '1')
+				} else {
+					resp = binary.BigEndian.AppendUint32(append(resp, 0x44), math.Float32bits(21.5))
+				}
+				resp = append(resp, 0x3F)
+			default:
+				continue
+			}
+			conn.WriteToUDP(encodeFrame(bvlcOriginalUnicastNPDU, 0, nil, false, resp), from)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func testClient(t *testing.T, broadcast string) *Client {
+	t.Helper()
+	c := NewClient(config.BACnetConfig{
+		Listen:           "127.0.0.1:0",
+		Broadcast:        broadcast,
+		Timeout:          200 * time.Millisecond,
+		DiscoveryTimeout: 300 * time.Millisecond,
+	}, zap.NewNop())
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestDiscoverAndPoll(t *testing.T) {
+	address := fakeDevice(t, 1001)
+	c := testClient(t, address)
+
+	devices, err := c.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(devices) != 1 || devices[0].Instance != 1001 || devices[0].Address != address || devices[0].VendorID != 42 || devices[0].MaxAPDU != 1476 {
+		t.Fatalf("Discover() = %+v", devices)
+	}
+
+	reading, err := c.Poll(context.Background(), &config.BACnetDeviceConfig{
+		Name:     "ahu-1",
+		Instance: 1001,
+		Points: []config.BACnetPointConfig{
+			{Name: "supply_temp", Object: "analog-input:1"},
+			{Name: "name", Object: "analog-input:1", Property: "object-name"},
+			{Name: "missing", Object: "analog-input:2"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	if reading.Values["supply_temp"] != 21.5 || reading.Values["name"] != "AHU-1" {
+		t.Errorf("Poll() values = %v", reading.Values)
+	}
+	if !strings.Contains(reading.Errors["missing"], "unknown object") {
+		t.Errorf("Poll() errors = %v, want unknown object for missing", reading.Errors)
+	}
+}
+
+func TestPollNotResponding(t *testing.T) {
+	// Nothing answers on this address
+	silent, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	c := testClient(t, silent.LocalAddr().String())
+
+	_, err = c.Poll(context.Background(), &config.BACnetDeviceConfig{
+		Name:     "ahu-1",
+		Address:  silent.LocalAddr().String(),
+		Points:   []config.BACnetPointConfig{{Name: "a", Object: "analog-input:1"}, {Name: "b", Object: "analog-input:2"}},
+		Instance: 1001,
+	})
+	if err == nil || !strings.Contains(err.Error(), "not responding") {
+		t.Errorf("Poll() error = %v, want not responding", err)
+	}
+
+	_, err = c.Poll(context.Background(), &config.BACnetDeviceConfig{
+		Name:     "ahu-2",
+		Instance: 2002,
+		Points:   []config.BACnetPointConfig{{Name: "a", Object: "analog-input:1"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "who-is") {
+		t.Errorf("Poll() error = %v, want who-is failure", err)
+	}
+}
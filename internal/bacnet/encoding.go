@@ -0,0 +1,306 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// objectTypes maps the standard object type names accepted in config to
+// their numbers
+var objectTypes = map[string]uint32{
+	"analog-input":       0,
+	"analog-output":      1,
+	"analog-value":       2,
+	"binary-input":       3,
+	"binary-output":      4,
+	"binary-value":       5,
+	"device":             8,
+	"loop":               12,
+	"multi-state-input":  13,
+	"multi-state-output": 14,
+	"multi-state-value":  19,
+	"accumulator":        23,
+}
+
+// properties maps the property names accepted in config to their
+// identifiers
+var properties = map[string]uint32{
+	"description":    28,
+	"event-state":    36,
+	"object-name":    77,
+	"out-of-service": 81,
+	"present-value":  85,
+	"reliability":    103,
+	"status-flags":   111,
+	"units":          117,
+}
+
+// propertyPresentValue is read when a point doesn't name a property
+const propertyPresentValue = 85
+
+// objectTypeDevice is the object type of a device's device object
+const objectTypeDevice = 8
+
+// maxInstance is the largest object instance number (22 bits, 4194303 is
+// reserved as "unspecified")
+const maxInstance = 4194302
+
+// objectID is an encoded object identifier: type in the high 10 bits,
+// instance in the low 22
+type objectID uint32
+
+func newObjectID(objectType, instance uint32) objectID {
+	return objectID(objectType<<22 | instance&0x3FFFFF)
+}
+
+func (o objectID) objectType() uint32 { return uint32(o) >> 22 }
+func (o objectID) instance() uint32   { return uint32(o) & 0x3FFFFF }
+
+// parseObject parses "analog-input:1" (or "0:1") into an object identifier
+func parseObject(s string) (objectID, error) {
+	typeName, instanceText, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("object must be type:instance (got: %q)", s)
+	}
+	objectType, ok := objectTypes[typeName]
+	if !ok {
+		n, err := strconv.ParseUint(typeName, 10, 10)
+		if err != nil {
+			return 0, fmt.Errorf("unknown object type: %s", typeName)
+		}
+		objectType = uint32(n)
+	}
+	instance, err := strconv.ParseUint(instanceText, 10, 32)
+	if err != nil || instance > maxInstance {
+		return 0, fmt.Errorf("invalid object instance: %s", instanceText)
+	}
+	return newObjectID(objectType, uint32(instance)), nil
+}
+
+// parseProperty parses a property name or number; empty means present-value
+func parseProperty(s string) (uint32, error) {
+	if s == "" {
+		return propertyPresentValue, nil
+	}
+	if id, ok := properties[s]; ok {
+		return id, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 22)
+	if err != nil {
+		return 0, fmt.Errorf("unknown property: %s", s)
+	}
+	return uint32(n), nil
+}
+
+// Application tag numbers
+const (
+	tagNull        = 0
+	tagBoolean     = 1
+	tagUnsigned    = 2
+	tagSigned      = 3
+	tagReal        = 4
+	tagDouble      = 5
+	tagOctetString = 6
+	tagCharString  = 7
+	tagBitString   = 8
+	tagEnumerated  = 9
+	tagDate        = 10
+	tagTime        = 11
+	tagObjectID    = 12
+)
+
+// tag is a decoded tag header
+type tag struct {
+	number  byte
+	context bool
+	opening bool
+	closing bool
+	length  int // Content length, or the value of an application boolean
+}
+
+// decodeTag decodes the tag header at the start of b and returns the number
+// of header bytes
+func decodeTag(b []byte) (tag, int, error) {
+	if len(b) == 0 {
+		return tag{}, 0, fmt.Errorf("truncated tag")
+	}
+	t := tag{number: b[0] >> 4, context: b[0]&0x08 != 0}
+	lvt := int(b[0] & 0x07)
+	n := 1
+
+	if t.number == 15 {
+		if len(b) < 2 {
+			return tag{}, 0, fmt.Errorf("truncated tag")
+		}
+		t.number = b[1]
+		n++
+	}
+
+	switch {
+	case t.context && lvt == 6:
+		t.opening = true
+		return t, n, nil
+	case t.context && lvt == 7:
+		t.closing = true
+		return t, n, nil
+	case lvt == 5:
+		if len(b) < n+1 {
+			return tag{}, 0, fmt.Errorf("truncated tag length")
+		}
+		switch ext := b[n]; ext {
+		case 254:
+			if len(b) < n+3 {
+				return tag{}, 0, fmt.Errorf("truncated tag length")
+			}
+			t.length = int(binary.BigEndian.Uint16(b[n+1:]))
+			n += 3
+		case 255:
+			if len(b) < n+5 {
+				return tag{}, 0, fmt.Errorf("truncated tag length")
+			}
+			t.length = int(binary.BigEndian.Uint32(b[n+1:]))
+			n += 5
+		default:
+			t.length = int(ext)
+			n++
+		}
+	default:
+		t.length = lvt
+	}
+	return t, n, nil
+}
+
+// contentLength is the number of content bytes following a tag header
+func (t tag) contentLength() int {
+	if t.opening || t.closing || (!t.context && t.number == tagBoolean) {
+		return 0
+	}
+	return t.length
+}
+
+// decodeUnsigned decodes big-endian unsigned content of 1-4 bytes
+func decodeUnsigned(b []byte) (uint32, error) {
+	if len(b) == 0 || len(b) > 4 {
+		return 0, fmt.Errorf("invalid unsigned length %d", len(b))
+	}
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v, nil
+}
+
+// decodeValue decodes the application-tagged value at the start of b into
+// a JSON-friendly value: numbers as float64, booleans as bool, strings as
+// string. It returns the number of bytes consumed.
+func decodeValue(b []byte) (interface{}, int, error) {
+	t, n, err := decodeTag(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	if t.context || t.opening || t.closing {
+		return nil, 0, fmt.Errorf("expected an application tag")
+	}
+	size := t.contentLength()
+	if len(b) < n+size {
+		return nil, 0, fmt.Errorf("truncated value")
+	}
+	content := b[n : n+size]
+	n += size
+
+	switch t.number {
+	case tagNull:
+		return nil, n, nil
+	case tagBoolean:
+		return t.length != 0, n, nil
+	case tagUnsigned, tagEnumerated:
+		v, err := decodeUnsigned(content)
+		return float64(v), n, err
+	case tagSigned:
+		if len(content) == 0 || len(content) > 4 {
+			return nil, 0, fmt.Errorf("invalid signed length %d", len(content))
+		}
+		v := int32(int8(content[0]))
+		for _, c := range content[1:] {
+			v = v<<8 | int32(c)
+		}
+		return float64(v), n, nil
+	case tagReal:
+		if len(content) != 4 {
+			return nil, 0, fmt.Errorf("invalid real length %d", len(content))
+		}
+		return finite(float64(math.Float32frombits(binary.BigEndian.Uint32(content)))), n, nil
+	case tagDouble:
+		if len(content) != 8 {
+			return nil, 0, fmt.Errorf("invalid double length %d", len(content))
+		}
+		return finite(math.Float64frombits(binary.BigEndian.Uint64(content))), n, nil
+	case tagOctetString:
+		return hex.EncodeToString(content), n, nil
+	case tagCharString:
+		// Character set 0 is UTF-8 (ANSI X3.4 before 2008); others are rare
+		if len(content) == 0 || content[0] != 0 || !utf8.Valid(content[1:]) {
+			return nil, 0, fmt.Errorf("unsupported character set")
+		}
+		return string(content[1:]), n, nil
+	case tagBitString:
+		// First octet is the number of unused bits in the last octet
+		if len(content) == 0 {
+			return nil, 0, fmt.Errorf("invalid bit string")
+		}
+		var bits strings.Builder
+		total := (len(content)-1)*8 - int(content[0])
+		for i := 0; i < total; i++ {
+			if content[1+i/8]&(0x80>>(i%8)) != 0 {
+				bits.WriteByte('1')
+			} else {
+				bits.WriteByte('0')
+			}
+		}
+		return bits.String(), n, nil
+	case tagObjectID:
+		if len(content) != 4 {
+			return nil, 0, fmt.Errorf("invalid object identifier length %d", len(content))
+		}
+		o := objectID(binary.BigEndian.Uint32(content))
+		return fmt.Sprintf("%d:%d", o.objectType(), o.instance()), n, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported value type (application tag %d)", t.number)
+	}
+}
+
+// finite maps NaN/Inf, which can't be encoded as JSON, to nil
+func finite(v float64) interface{} {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return v
+}
+
+// appendContextUnsigned appends an unsigned value with a context tag
+func appendContextUnsigned(b []byte, number byte, v uint32) []byte {
+	var content []byte
+	switch {
+	case v < 1<<8:
+		content = []byte{byte(v)}
+	case v < 1<<16:
+		content = binary.BigEndian.AppendUint16(nil, uint16(v))
+	case v < 1<<24:
+		content = []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		content = binary.BigEndian.AppendUint32(nil, v)
+	}
+	b = append(b, number<<4|0x08|byte(len(content)))
+	return append(b, content...)
+}
+
+// appendContextObjectID appends an object identifier with a context tag
+func appendContextObjectID(b []byte, number byte, o objectID) []byte {
+	b = append(b, number<<4|0x08|4)
+	return binary.BigEndian.AppendUint32(b, uint32(o))
+}
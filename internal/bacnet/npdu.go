@@ -0,0 +1,123 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+)
+
+// BACnet Virtual Link Control (Annex J) functions
+const (
+	bvlcType                = 0x81
+	bvlcForwardedNPDU       = 0x04
+	bvlcOriginalUnicastNPDU = 0x0A
+	bvlcOriginalBroadcast   = 0x0B
+)
+
+// NPDU control bits
+const (
+	npduNetworkMessage = 0x80
+	npduDestination    = 0x20
+	npduSource         = 0x08
+	npduExpectingReply = 0x04
+)
+
+// globalBroadcast is the destination network that routers forward to every
+// network
+const globalBroadcast = 0xFFFF
+
+// address locates a device: its BACnet/IP address, plus its network number
+// and MAC address when it sits behind a router
+type address struct {
+	udp     *net.UDPAddr
+	network uint16 // 0 = the local network
+	mac     []byte
+}
+
+func (a address) String() string {
+	if a.network == 0 {
+		return a.udp.String()
+	}
+	return fmt.Sprintf("%s/%d:%s", a.udp, a.network, hex.EncodeToString(a.mac))
+}
+
+// encodeFrame wraps an APDU in an NPDU and BVLC header. A non-zero network
+// routes it to mac on that network (0xFFFF with no mac broadcasts it to
+// every network); expectingReply marks confirmed requests.
+func encodeFrame(function byte, network uint16, mac []byte, expectingReply bool, apdu []byte) []byte {
+	npdu := []byte{0x01, 0x00} // Version 1, control
+	if expectingReply {
+		npdu[1] |= npduExpectingReply
+	}
+	if network != 0 {
+		npdu[1] |= npduDestination
+		npdu = binary.BigEndian.AppendUint16(npdu, network)
+		npdu = append(npdu, byte(len(mac)))
+		npdu = append(npdu, mac...)
+		npdu = append(npdu, 0xFF) // Hop count
+	}
+
+	frame := []byte{bvlcType, function, 0, 0}
+	frame = append(frame, npdu...)
+	frame = append(frame, apdu...)
+	binary.BigEndian.PutUint16(frame[2:], uint16(len(frame)))
+	return frame
+}
+
+// decodeFrame parses a received datagram and returns the sender's address
+// and the APDU. Network layer messages (router chatter) return a nil APDU.
+func decodeFrame(data []byte, from *net.UDPAddr) (address, []byte, error) {
+	src := address{udp: from}
+	if len(data) < 4 || data[0] != bvlcType {
+		return src, nil, fmt.Errorf("not a BACnet/IP frame")
+	}
+	if int(binary.BigEndian.Uint16(data[2:])) != len(data) {
+		return src, nil, fmt.Errorf("BVLC length mismatch")
+	}
+
+	npdu := data[4:]
+	switch data[1] {
+	case bvlcOriginalUnicastNPDU, bvlcOriginalBroadcast:
+	case bvlcForwardedNPDU:
+		// Relayed by a BBMD: the original sender's IP and port come first
+		if len(npdu) < 6 {
+			return src, nil, fmt.Errorf("truncated forwarded NPDU")
+		}
+		src.udp = &net.UDPAddr{IP: net.IP(append([]byte(nil), npdu[:4]...)), Port: int(binary.BigEndian.Uint16(npdu[4:]))}
+		npdu = npdu[6:]
+	default:
+		return src, nil, nil
+	}
+
+	if len(npdu) < 2 || npdu[0] != 0x01 {
+		return src, nil, fmt.Errorf("unsupported NPDU version")
+	}
+	control := npdu[1]
+	rest := npdu[2:]
+
+	if control&npduDestination != 0 {
+		if len(rest) < 3 || len(rest) < 3+int(rest[2]) {
+			return src, nil, fmt.Errorf("truncated NPDU destination")
+		}
+		rest = rest[3+int(rest[2]):]
+	}
+	if control&npduSource != 0 {
+		if len(rest) < 3 || len(rest) < 3+int(rest[2]) {
+			return src, nil, fmt.Errorf("truncated NPDU source")
+		}
+		src.network = binary.BigEndian.Uint16(rest)
+		src.mac = append([]byte(nil), rest[3:3+int(rest[2])]...)
+		rest = rest[3+int(rest[2]):]
+	}
+	if control&npduDestination != 0 {
+		if len(rest) < 1 {
+			return src, nil, fmt.Errorf("truncated NPDU hop count")
+		}
+		rest = rest[1:]
+	}
+	if control&npduNetworkMessage != 0 {
+		return src, nil, nil
+	}
+	return src, rest, nil
+}
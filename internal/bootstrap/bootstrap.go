@@ -11,15 +11,16 @@ package bootstrap
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/secrets"
 	"go.uber.org/zap"
 )
 
@@ -30,6 +31,10 @@ const httpTimeout = 15 * time.Second
 // schema (things → nats_user relation → creds_file).
 const thingsCollection = "things"
 
+// errAuthRejected is returned when the platform rejects the thing login
+// (unknown identity or wrong password), as opposed to a transport failure
+var errAuthRejected = errors.New("login rejected")
+
 // authResponse is the PocketBase auth-with-password response, narrowed to the
 // fields the bootstrap needs from the authenticated thing record.
 type authResponse struct {
@@ -47,6 +52,8 @@ type thingRecord struct {
 			Code string `json:"code"`
 		} `json:"location"`
 	} `json:"expand"`
+
+	Fields map[string]json.RawMessage `json:"-"` // All record fields, for config bootstrap
 }
 
 // FetchCredentials checks if the .creds file exists, and if not, fetches it
@@ -66,18 +73,45 @@ func FetchCredentials(cfg *config.Config, logger *zap.Logger) error {
 		zap.String("path", credsPath),
 		zap.String("platform_url", pb.URL))
 
+	creds, err := fetchPlatformCredentials(cfg, logger, pb.Registration.Enabled)
+	if err != nil {
+		return err
+	}
+
+	// Write .creds file to disk
+	if err := writeSecretFile(cfg, credsPath, creds); err != nil {
+		return fmt.Errorf("bootstrap: failed to write credentials file: %w", err)
+	}
+	logger.Info("Credentials file written", zap.String("path", credsPath))
+
+	return nil
+}
+
+// fetchPlatformCredentials authenticates as the thing and returns the .creds
+// content from its nats_user relation. When register is set, a rejected login
+// files a registration request and waits for approval.
+func fetchPlatformCredentials(cfg *config.Config, logger *zap.Logger, register bool) (string, error) {
+	pb := cfg.NATS.Auth.PocketBase
+
 	// Read password from environment variable
 	password := os.Getenv(pb.PasswordEnv)
 	if password == "" {
-		return fmt.Errorf("bootstrap: environment variable %s is not set or empty", pb.PasswordEnv)
+		return "", fmt.Errorf("bootstrap: environment variable %s is not set or empty", pb.PasswordEnv)
 	}
 
-	client := &http.Client{Timeout: httpTimeout}
+	client, err := newHTTPClient(cfg, logger)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: %w", err)
+	}
 
 	// Authenticate as the thing; the expanded record carries everything we need
 	record, err := authenticateThing(client, pb.URL, pb.Identity, password)
+	if err != nil && errors.Is(err, errAuthRejected) && register {
+		// Not provisioned yet: file a registration request and wait for approval
+		record, err = registerAndWait(cfg, client, password, logger)
+	}
 	if err != nil {
-		return fmt.Errorf("bootstrap: authentication failed: %w", err)
+		return "", fmt.Errorf("bootstrap: authentication failed: %w", err)
 	}
 	logger.Info("Authenticated with platform as thing", zap.String("thing_id", record.ID))
 
@@ -85,7 +119,7 @@ func FetchCredentials(cfg *config.Config, logger *zap.Logger) error {
 	// this device is running with the wrong config or the wrong thing login,
 	// and its telemetry would be attributed to the wrong device. Fail fast.
 	if record.Code != cfg.Code {
-		return fmt.Errorf("bootstrap: code mismatch: config has %q but the platform thing record has %q — fix the agent config or the thing record before starting", cfg.Code, record.Code)
+		return "", fmt.Errorf("bootstrap: code mismatch: config has %q but the platform thing record has %q — fix the agent config or the thing record before starting", cfg.Code, record.Code)
 	}
 
 	// Location is advisory (payload-only), so a mismatch warns instead of failing
@@ -97,17 +131,11 @@ func FetchCredentials(cfg *config.Config, logger *zap.Logger) error {
 
 	creds := record.Expand.NATSUser.CredsFile
 	if creds == "" {
-		return fmt.Errorf("bootstrap: thing record has no NATS credentials (is a nats_user assigned to this thing, and does it have creds generated?)")
+		return "", fmt.Errorf("bootstrap: thing record has no NATS credentials (is a nats_user assigned to this thing, and does it have creds generated?)")
 	}
 	logger.Info("Fetched credentials from platform")
 
-	// Write .creds file to disk
-	if err := writeCredsFile(credsPath, creds); err != nil {
-		return fmt.Errorf("bootstrap: failed to write credentials file: %w", err)
-	}
-	logger.Info("Credentials file written", zap.String("path", credsPath))
-
-	return nil
+	return creds, nil
 }
 
 // authenticateThing calls auth-with-password on the things collection with
@@ -131,13 +159,26 @@ func authenticateThing(client *http.Client, baseURL, identity, password string)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body) //nolint:errcheck // best-effort read for error message
+		if resp.StatusCode == http.StatusBadRequest {
+			return nil, fmt.Errorf("%w: auth returned %d: %s", errAuthRejected, resp.StatusCode, string(body))
+		}
 		return nil, fmt.Errorf("auth returned %d: %s", resp.StatusCode, string(body))
 	}
 
 	var authResp authResponse
-	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
+	var rawResp struct {
+		Record map[string]json.RawMessage `json:"record"`
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth response: %w", err)
+	}
+	if err := json.Unmarshal(body, &authResp); err != nil {
 		return nil, fmt.Errorf("failed to parse auth response: %w", err)
 	}
+	if err := json.Unmarshal(body, &rawResp); err == nil {
+		authResp.Record.Fields = rawResp.Record
+	}
 
 	if authResp.Record.ID == "" {
 		return nil, fmt.Errorf("auth response contained no thing record")
@@ -146,19 +187,23 @@ func authenticateThing(client *http.Client, baseURL, identity, password string)
 	return &authResp.Record, nil
 }
 
-// writeCredsFile writes the credentials content to disk, creating parent
-// directories if needed. File is written with restrictive permissions.
+// writeCredsFile writes plaintext content atomically with 0600 permissions,
+// creating parent directories if needed. Used for non-secret bookkeeping
+// files; credentials go through writeSecretFile.
 func writeCredsFile(path, content string) error {
-	// Ensure parent directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create directory %s: %w", dir, err)
-	}
+	return secrets.WriteFileAtomic(path, []byte(content))
+}
 
-	// Write with restrictive permissions (owner read/write only)
-	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
-	}
+// writeSecretFile writes a credential file (.creds or nkey seed) using the
+// configured secret store (plaintext, DPAPI, or encrypted)
+func writeSecretFile(cfg *config.Config, path, content string) error {
+	return secrets.Write(path, []byte(content), secretOptions(cfg))
+}
 
-	return nil
+// secretOptions returns the secret store settings from the auth config
+func secretOptions(cfg *config.Config) secrets.Options {
+	return secrets.Options{
+		Store:   cfg.NATS.Auth.SecretStore,
+		KeyFile: cfg.NATS.Auth.SecretKeyFile,
+	}
 }
@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// configBackupSuffix is appended to the config path to keep the original
+// minimal bootstrap config, so a device can be re-provisioned by restoring it
+const configBackupSuffix = ".bootstrap"
+
+// FetchConfig replaces a minimal bootstrap config with the full agent config
+// from the platform. It authenticates as the thing, reads the configured
+// record field, validates the result, and atomically rewrites configPath.
+// Returns nil without contacting the platform if the file is already a full
+// config (no config_bootstrap section, or a nats section is present).
+func FetchConfig(configPath string, logger *zap.Logger) error {
+	code, cb, err := config.ReadConfigBootstrap(configPath)
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+	if cb == nil {
+		return nil
+	}
+
+	logger.Info("Minimal config found, bootstrapping full config from platform",
+		zap.String("path", configPath),
+		zap.String("code", code),
+		zap.String("platform_url", cb.URL))
+
+	password := os.Getenv(cb.PasswordEnv)
+	if password == "" {
+		return fmt.Errorf("bootstrap: environment variable %s is not set or empty", cb.PasswordEnv)
+	}
+
+	client, err := newHTTPClientWithTLS(cb.TLS, logger)
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+
+	record, err := authenticateThing(client, cb.URL, cb.Identity, password)
+	if err != nil {
+		return fmt.Errorf("bootstrap: authentication failed: %w", err)
+	}
+	if record.Code != code {
+		return fmt.Errorf("bootstrap: code mismatch: config has %q but the platform thing record has %q — fix the agent config or the thing record before starting", code, record.Code)
+	}
+
+	data, err := configFieldContent(record.Fields[cb.Field])
+	if err != nil {
+		return fmt.Errorf("bootstrap: thing record field %q: %w", cb.Field, err)
+	}
+
+	out, err := config.PrepareBootstrappedConfig(data, code)
+	if err != nil {
+		return fmt.Errorf("bootstrap: %w", err)
+	}
+
+	// Keep the minimal config for re-provisioning before replacing it
+	original, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("bootstrap: failed to read config: %w", err)
+	}
+	if err := writeCredsFile(configPath+configBackupSuffix, string(original)); err != nil {
+		return fmt.Errorf("bootstrap: failed to back up bootstrap config: %w", err)
+	}
+
+	if err := writeCredsFile(configPath, string(out)); err != nil {
+		return fmt.Errorf("bootstrap: failed to write config: %w", err)
+	}
+	logger.Info("Full config written from platform",
+		zap.String("path", configPath),
+		zap.String("backup", configPath+configBackupSuffix))
+
+	return nil
+}
+
+// configFieldContent returns the config document held in a record field.
+// PocketBase text fields arrive as a JSON string (YAML or JSON text); json
+// fields arrive as an object, which is valid YAML as-is.
+func configFieldContent(raw json.RawMessage) ([]byte, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("not set (is a config assigned to this thing?)")
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if text == "" {
+			return nil, fmt.Errorf("is empty (is a config assigned to this thing?)")
+		}
+		return []byte(text), nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, fmt.Errorf("must be text or a JSON object")
+	}
+	return raw, nil
+}
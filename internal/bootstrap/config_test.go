@@ -0,0 +1,111 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const minimalConfig = `code: "server-01"
+config_bootstrap:
+  url: "%s"
+  identity: "thing@example.com"
+  password_env: "TEST_AGENT_PB_PASSWORD"
+`
+
+// newConfigServer mimics the platform's thing auth response with an
+// agent_config field holding the given raw JSON value
+func newConfigServer(t *testing.T, thingCode, agentConfig string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/collections/things/auth-with-password" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"record":{"id":"thing123","code":"` + thingCode + `","agent_config":` + agentConfig + `}}`)) //nolint:errcheck
+	}))
+}
+
+func writeMinimalConfig(t *testing.T, url string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(strings.Replace(minimalConfig, "%s", url, 1)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFetchConfigFromTextField(t *testing.T) {
+	agentConfig := `"nats:\n  urls: [\"nats://localhost:4222\"]\n  auth:\n    type: none\ntasks:\n  service_check:\n    enabled: false\ncommands:\n  scripts_directory: \"\"\n"`
+	srv := newConfigServer(t, "server-01", agentConfig)
+	defer srv.Close()
+
+	path := writeMinimalConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	if err := FetchConfig(path, zap.NewNop()); err != nil {
+		t.Fatalf("FetchConfig() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(path) //nolint:errcheck
+	if !strings.Contains(string(content), "nats://localhost:4222") || !strings.Contains(string(content), "server-01") {
+		t.Errorf("config not replaced with fetched content: %s", content)
+	}
+	if _, err := os.Stat(path + configBackupSuffix); err != nil {
+		t.Errorf("minimal config backup not written: %v", err)
+	}
+
+	// Second start: the file is now a full config and the platform is not contacted
+	srv.Close()
+	if err := FetchConfig(path, zap.NewNop()); err != nil {
+		t.Fatalf("FetchConfig() on full config error = %v", err)
+	}
+}
+
+func TestFetchConfigFromJSONField(t *testing.T) {
+	agentConfig := `{"nats":{"urls":["nats://localhost:4222"],"auth":{"type":"none"}},"tasks":{"service_check":{"enabled":false}},"commands":{"scripts_directory":""}}`
+	srv := newConfigServer(t, "server-01", agentConfig)
+	defer srv.Close()
+
+	path := writeMinimalConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	if err := FetchConfig(path, zap.NewNop()); err != nil {
+		t.Fatalf("FetchConfig() error = %v", err)
+	}
+}
+
+func TestFetchConfigInvalidLeavesMinimalConfig(t *testing.T) {
+	srv := newConfigServer(t, "server-01", `"nats:\n  urls: []\n"`)
+	defer srv.Close()
+
+	path := writeMinimalConfig(t, srv.URL)
+	original, _ := os.ReadFile(path) //nolint:errcheck
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	if err := FetchConfig(path, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "invalid fetched config") {
+		t.Fatalf("FetchConfig() error = %v, want validation error", err)
+	}
+	content, _ := os.ReadFile(path) //nolint:errcheck
+	if string(content) != string(original) {
+		t.Error("minimal config was modified despite invalid fetched config")
+	}
+}
+
+func TestFetchConfigCodeMismatch(t *testing.T) {
+	srv := newConfigServer(t, "other-thing", `"nats: {}"`)
+	defer srv.Close()
+
+	path := writeMinimalConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	if err := FetchConfig(path, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "code mismatch") {
+		t.Fatalf("FetchConfig() error = %v, want code mismatch", err)
+	}
+}
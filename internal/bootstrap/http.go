@@ -0,0 +1,141 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// maxHTTPResponseSize caps the provisioning API response. A .creds file is a
+// few KB; anything much larger is not what we asked for.
+const maxHTTPResponseSize = 1 << 20
+
+// FetchHTTPCredentials checks if the .creds file exists, and if not, fetches
+// it from the configured provisioning endpoint and writes it to disk.
+// Returns nil if the file already exists or was successfully created.
+func FetchHTTPCredentials(cfg *config.Config, logger *zap.Logger) error {
+	credsPath := cfg.NATS.Auth.CredsFile
+	h := cfg.NATS.Auth.HTTP
+
+	// If .creds file already exists, skip bootstrap
+	if _, err := os.Stat(credsPath); err == nil {
+		logger.Info("Credentials file exists, skipping HTTP bootstrap", zap.String("path", credsPath))
+		return nil
+	}
+
+	logger.Info("Credentials file not found, bootstrapping from provisioning endpoint",
+		zap.String("path", credsPath),
+		zap.String("url", h.URL))
+
+	creds, err := fetchHTTPCredentials(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSecretFile(cfg, credsPath, creds); err != nil {
+		return fmt.Errorf("bootstrap: failed to write credentials file: %w", err)
+	}
+	logger.Info("Credentials file written", zap.String("path", credsPath))
+
+	return nil
+}
+
+// fetchHTTPCredentials calls the provisioning endpoint and extracts the creds
+func fetchHTTPCredentials(cfg *config.Config, logger *zap.Logger) (string, error) {
+	h := cfg.NATS.Auth.HTTP
+
+	url := strings.ReplaceAll(h.URL, "{code}", cfg.Code)
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	if strings.HasPrefix(url, "http://") {
+		logger.Warn("Provisioning endpoint is not HTTPS - credentials will be fetched in cleartext")
+	}
+
+	var body io.Reader
+	if h.Body != "" {
+		body = strings.NewReader(os.ExpandEnv(h.Body))
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: failed to create request: %w", err)
+	}
+	for name, value := range h.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	client, err := newHTTPClient(cfg, logger)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPResponseSize))
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("bootstrap: provisioning endpoint returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	creds := string(respBody)
+	if h.JSONPath != "" {
+		var doc interface{}
+		if err := json.Unmarshal(respBody, &doc); err != nil {
+			return "", fmt.Errorf("bootstrap: failed to parse response as JSON: %w", err)
+		}
+		creds, err = lookupJSONPath(doc, h.JSONPath)
+		if err != nil {
+			return "", fmt.Errorf("bootstrap: %w", err)
+		}
+	}
+	if strings.TrimSpace(creds) == "" {
+		return "", fmt.Errorf("bootstrap: provisioning endpoint returned empty credentials")
+	}
+	logger.Info("Fetched credentials from provisioning endpoint", zap.String("method", method))
+
+	return creds, nil
+}
+
+// lookupJSONPath walks a decoded JSON document along a dotted path such as
+// "data.nats.creds" or "items.0.creds" and returns the string at the end
+func lookupJSONPath(doc interface{}, path string) (string, error) {
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return "", fmt.Errorf("json_path %q: key %q not found", path, key)
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", fmt.Errorf("json_path %q: invalid array index %q", path, key)
+			}
+			current = node[idx]
+		default:
+			return "", fmt.Errorf("json_path %q: cannot descend into %q", path, key)
+		}
+	}
+
+	value, ok := current.(string)
+	if !ok {
+		return "", fmt.Errorf("json_path %q does not point to a string", path)
+	}
+	return value, nil
+}
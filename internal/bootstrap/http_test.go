@@ -0,0 +1,132 @@
+package bootstrap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+func httpTestConfig(t *testing.T, url string) *config.Config {
+	t.Helper()
+	return &config.Config{
+		Code: "server-01",
+		NATS: config.NATSConfig{
+			Auth: config.AuthConfig{
+				Type:      "http",
+				CredsFile: filepath.Join(t.TempDir(), "device.creds"),
+				HTTP: config.HTTPAuth{
+					URL:      url + "/devices/{code}/creds",
+					Method:   "POST",
+					Headers:  map[string]string{"Authorization": "Bearer ${TEST_AGENT_PROVISION_TOKEN}"},
+					Body:     `{"device":"server-01"}`,
+					JSONPath: "result.nats.creds",
+				},
+			},
+		},
+	}
+}
+
+func TestFetchHTTPCredentialsJSONPath(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/devices/server-01/creds" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("Authorization = %q, want expanded env value", got)
+		}
+		body, _ := io.ReadAll(r.Body) //nolint:errcheck
+		if string(body) != `{"device":"server-01"}` {
+			t.Errorf("body = %q", body)
+		}
+		w.Write([]byte(`{"result":{"nats":{"creds":"` + strings.ReplaceAll(testCreds, "\n", `\n`) + `"}}}`)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := httpTestConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_PROVISION_TOKEN", "tok")
+
+	if err := FetchHTTPCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchHTTPCredentials() error = %v", err)
+	}
+
+	content, err := os.ReadFile(cfg.NATS.Auth.CredsFile)
+	if err != nil {
+		t.Fatalf("creds file not written: %v", err)
+	}
+	if string(content) != testCreds {
+		t.Errorf("creds file content = %q, want %q", content, testCreds)
+	}
+}
+
+func TestFetchHTTPCredentialsRawBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testCreds)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := httpTestConfig(t, srv.URL)
+	cfg.NATS.Auth.HTTP.Method = ""
+	cfg.NATS.Auth.HTTP.JSONPath = ""
+
+	if err := FetchHTTPCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchHTTPCredentials() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(cfg.NATS.Auth.CredsFile) //nolint:errcheck
+	if string(content) != testCreds {
+		t.Errorf("creds file content = %q, want %q", content, testCreds)
+	}
+}
+
+func TestFetchHTTPCredentialsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		errText string
+	}{
+		{"non-2xx status", http.StatusForbidden, `{"error":"denied"}`, "returned 403"},
+		{"missing key", http.StatusOK, `{"result":{}}`, `key "nats" not found`},
+		{"not a string", http.StatusOK, `{"result":{"nats":{"creds":42}}}`, "does not point to a string"},
+		{"invalid JSON", http.StatusOK, `not json`, "failed to parse response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body)) //nolint:errcheck
+			}))
+			defer srv.Close()
+
+			cfg := httpTestConfig(t, srv.URL)
+			err := FetchHTTPCredentials(cfg, zap.NewNop())
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Fatalf("FetchHTTPCredentials() error = %v, want error containing %q", err, tt.errText)
+			}
+			if _, statErr := os.Stat(cfg.NATS.Auth.CredsFile); statErr == nil {
+				t.Error("creds file should not be written on error")
+			}
+		})
+	}
+}
+
+func TestLookupJSONPathArrayIndex(t *testing.T) {
+	doc := map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"creds": "first"}},
+	}
+	got, err := lookupJSONPath(doc, "items.0.creds")
+	if err != nil || got != "first" {
+		t.Errorf("lookupJSONPath() = %q, %v; want %q", got, err, "first")
+	}
+	if _, err := lookupJSONPath(doc, "items.3.creds"); err == nil {
+		t.Error("lookupJSONPath() expected error for out-of-range index")
+	}
+}
@@ -0,0 +1,165 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// registrationSuffix is appended to the creds path to remember the pending
+// registration record across restarts, so a restarting agent keeps waiting
+// on the same request instead of filing a new one each time.
+const registrationSuffix = ".registration"
+
+// registrationRequest is the record the agent creates in the registration
+// collection. It carries enough for an operator to recognise the device.
+type registrationRequest struct {
+	Code        string   `json:"code"`
+	Location    string   `json:"location,omitempty"`
+	Identity    string   `json:"identity"`
+	Hostname    string   `json:"hostname"`
+	HardwareID  string   `json:"hardware_id,omitempty"`
+	IPAddresses []string `json:"ip_addresses"`
+	OS          string   `json:"os"`
+	Status      string   `json:"status"`
+}
+
+// registerAndWait files a registration request for this device (unless one
+// is already pending) and retries the thing login until an operator approves
+// the request by provisioning the thing, or the registration timeout expires.
+func registerAndWait(cfg *config.Config, client *http.Client, password string, logger *zap.Logger) (*thingRecord, error) {
+	pb := cfg.NATS.Auth.PocketBase
+	reg := pb.Registration
+	markerPath := cfg.NATS.Auth.CredsFile + registrationSuffix
+
+	if id, err := os.ReadFile(markerPath); err == nil && len(strings.TrimSpace(string(id))) > 0 {
+		logger.Info("Registration request already pending, waiting for approval",
+			zap.String("registration_id", strings.TrimSpace(string(id))))
+	} else {
+		req := buildRegistrationRequest(cfg)
+		id, err := submitRegistration(client, pb.URL, reg.Collection, req)
+		if err != nil {
+			return nil, fmt.Errorf("registration request failed: %w", err)
+		}
+		if err := writeCredsFile(markerPath, id); err != nil {
+			// Not fatal: worst case a restart files a duplicate request
+			logger.Warn("Failed to persist registration id", zap.String("path", markerPath), zap.Error(err))
+		}
+		logger.Info("Device not provisioned on platform, registration request submitted",
+			zap.String("registration_id", id),
+			zap.String("collection", reg.Collection),
+			zap.String("hostname", req.Hostname),
+			zap.String("hardware_id", req.HardwareID))
+	}
+
+	deadline := time.Now().Add(reg.Timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(reg.PollInterval)
+
+		record, err := authenticateThing(client, pb.URL, pb.Identity, password)
+		if err == nil {
+			logger.Info("Registration approved")
+			os.Remove(markerPath) //nolint:errcheck // best-effort cleanup
+			return record, nil
+		}
+		if !errors.Is(err, errAuthRejected) {
+			// Transient platform/network errors shouldn't abort the wait
+			logger.Warn("Platform unreachable while waiting for registration approval", zap.Error(err))
+		}
+	}
+
+	return nil, fmt.Errorf("registration not approved within %v (request remains pending; restart to keep waiting)", reg.Timeout)
+}
+
+// submitRegistration creates the registration record and returns its id
+func submitRegistration(client *http.Client, baseURL, collection string, reg registrationRequest) (string, error) {
+	url := fmt.Sprintf("%s/api/collections/%s/records", strings.TrimRight(baseURL, "/"), collection)
+
+	payload, err := json.Marshal(reg)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(payload)))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body) //nolint:errcheck // best-effort read for error message
+		return "", fmt.Errorf("create returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var record struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return "", fmt.Errorf("failed to parse create response: %w", err)
+	}
+	if record.ID == "" {
+		return "", fmt.Errorf("create response contained no record id")
+	}
+
+	return record.ID, nil
+}
+
+// buildRegistrationRequest gathers the identifying details an operator needs
+// to approve the device. Lookups are best-effort: missing fields are left empty.
+func buildRegistrationRequest(cfg *config.Config) registrationRequest {
+	hostname, _ := os.Hostname() //nolint:errcheck // best-effort
+	hostID, _ := host.HostID()   //nolint:errcheck // best-effort (machine-id / SMBIOS UUID)
+
+	return registrationRequest{
+		Code:        cfg.Code,
+		Location:    cfg.Location,
+		Identity:    cfg.NATS.Auth.PocketBase.Identity,
+		Hostname:    hostname,
+		HardwareID:  hostID,
+		IPAddresses: localIPAddresses(),
+		OS:          runtime.GOOS + "/" + runtime.GOARCH,
+		Status:      "pending",
+	}
+}
+
+// localIPAddresses returns the non-loopback unicast addresses of all up interfaces
+func localIPAddresses() []string {
+	ips := []string{}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return ips
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+	return ips
+}
@@ -0,0 +1,100 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// newRegistrationServer mimics a platform where the thing does not exist until
+// approveAfter logins have been rejected. It counts registration creates.
+func newRegistrationServer(t *testing.T, approveAfter int32, creates *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var logins atomic.Int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/collections/registrations/records":
+			var req registrationRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if req.Code != "server-01" || req.Identity != "thing@example.com" || req.Status != "pending" {
+				t.Errorf("unexpected registration request: %+v", req)
+			}
+			creates.Add(1)
+			w.Write([]byte(`{"id":"reg123"}`)) //nolint:errcheck
+		case "/api/collections/things/auth-with-password":
+			if logins.Add(1) <= approveAfter {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message":"Failed to authenticate."}`)) //nolint:errcheck
+				return
+			}
+			w.Write([]byte(`{"record":{"id":"thing123","code":"server-01","expand":{"nats_user":{"creds_file":` + //nolint:errcheck
+				strings.ReplaceAll(`"`+testCreds+`"`, "\n", `\n`) + `}}}}`))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestFetchCredentialsRegistrationApproved(t *testing.T) {
+	var creates atomic.Int32
+	srv := newRegistrationServer(t, 3, &creates)
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL)
+	cfg.NATS.Auth.PocketBase.Registration.Enabled = true
+	cfg.NATS.Auth.PocketBase.Registration.Collection = "registrations"
+	cfg.NATS.Auth.PocketBase.Registration.PollInterval = 10 * time.Millisecond
+	cfg.NATS.Auth.PocketBase.Registration.Timeout = 5 * time.Second
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	if err := FetchCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchCredentials() error = %v", err)
+	}
+
+	if got := creates.Load(); got != 1 {
+		t.Errorf("registration requests created = %d, want 1", got)
+	}
+	content, _ := os.ReadFile(cfg.NATS.Auth.CredsFile) //nolint:errcheck
+	if string(content) != testCreds {
+		t.Errorf("creds file content = %q, want %q", content, testCreds)
+	}
+	if _, err := os.Stat(cfg.NATS.Auth.CredsFile + registrationSuffix); err == nil {
+		t.Error("registration marker should be removed after approval")
+	}
+}
+
+func TestFetchCredentialsRegistrationTimeoutReusesRequest(t *testing.T) {
+	var creates atomic.Int32
+	srv := newRegistrationServer(t, 1000, &creates)
+	defer srv.Close()
+
+	cfg := testConfig(t, srv.URL)
+	cfg.NATS.Auth.PocketBase.Registration.Enabled = true
+	cfg.NATS.Auth.PocketBase.Registration.Collection = "registrations"
+	cfg.NATS.Auth.PocketBase.Registration.PollInterval = 10 * time.Millisecond
+	cfg.NATS.Auth.PocketBase.Registration.Timeout = 50 * time.Millisecond
+	t.Setenv("TEST_AGENT_PB_PASSWORD", "secret")
+
+	for i := 0; i < 2; i++ {
+		err := FetchCredentials(cfg, zap.NewNop())
+		if err == nil || !strings.Contains(err.Error(), "not approved") {
+			t.Fatalf("FetchCredentials() error = %v, want approval timeout", err)
+		}
+	}
+
+	// The second attempt (a restart) must wait on the same pending request
+	if got := creates.Load(); got != 1 {
+		t.Errorf("registration requests created = %d, want 1", got)
+	}
+}
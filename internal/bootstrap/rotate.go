@@ -0,0 +1,52 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/secrets"
+	"go.uber.org/zap"
+)
+
+// RefreshCredentials re-fetches credentials from the bootstrap provider
+// ("pocketbase", "vault", or "http") and atomically replaces the local file
+// when the content changed. Returns true if the file was replaced, so the
+// caller knows to reconnect NATS. On error the existing file is untouched.
+func RefreshCredentials(cfg *config.Config, provider string, logger *zap.Logger) (bool, error) {
+	var (
+		path  string
+		creds string
+		err   error
+	)
+
+	switch provider {
+	case "pocketbase":
+		path = cfg.NATS.Auth.CredsFile
+		// Refresh never registers: a rejected login here means the thing was
+		// removed or its password changed, which needs an operator
+		creds, err = fetchPlatformCredentials(cfg, logger, false)
+	case "vault":
+		path = vaultTargetPath(cfg)
+		creds, err = fetchVaultCredentials(cfg, logger)
+	case "http":
+		path = cfg.NATS.Auth.CredsFile
+		creds, err = fetchHTTPCredentials(cfg, logger)
+	default:
+		return false, fmt.Errorf("credential refresh not supported for auth type %q", provider)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if current, err := secrets.Read(path, secretOptions(cfg)); err == nil && string(current) == creds {
+		logger.Debug("Credentials unchanged", zap.String("path", path))
+		return false, nil
+	}
+
+	if err := writeSecretFile(cfg, path, creds); err != nil {
+		return false, fmt.Errorf("bootstrap: failed to write credentials file: %w", err)
+	}
+	logger.Info("Credentials file replaced", zap.String("path", path), zap.String("provider", provider))
+
+	return true, nil
+}
@@ -0,0 +1,68 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRefreshCredentials(t *testing.T) {
+	var current atomic.Value
+	current.Store(testCreds)
+	var fail atomic.Bool
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(current.Load().(string))) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cfg := httpTestConfig(t, srv.URL)
+	cfg.NATS.Auth.HTTP.JSONPath = ""
+	credsPath := cfg.NATS.Auth.CredsFile
+	if err := os.WriteFile(credsPath, []byte(testCreds), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same content: nothing to do
+	changed, err := RefreshCredentials(cfg, "http", zap.NewNop())
+	if err != nil || changed {
+		t.Fatalf("RefreshCredentials() = %v, %v; want false, nil", changed, err)
+	}
+
+	// New content: file replaced
+	rotated := "-----BEGIN NATS USER JWT-----\nrotated\n------END NATS USER JWT------\n"
+	current.Store(rotated)
+	changed, err = RefreshCredentials(cfg, "http", zap.NewNop())
+	if err != nil || !changed {
+		t.Fatalf("RefreshCredentials() = %v, %v; want true, nil", changed, err)
+	}
+	content, _ := os.ReadFile(credsPath) //nolint:errcheck
+	if string(content) != rotated {
+		t.Errorf("creds file content = %q, want %q", content, rotated)
+	}
+
+	// Provider failure: existing file untouched
+	fail.Store(true)
+	if _, err := RefreshCredentials(cfg, "http", zap.NewNop()); err == nil {
+		t.Fatal("RefreshCredentials() expected error when provider fails")
+	}
+	content, _ = os.ReadFile(credsPath) //nolint:errcheck
+	if string(content) != rotated {
+		t.Errorf("creds file changed after failed refresh: %q", content)
+	}
+}
+
+func TestRefreshCredentialsUnsupportedProvider(t *testing.T) {
+	cfg := httpTestConfig(t, "http://unused.example.com")
+	if _, err := RefreshCredentials(cfg, "creds", zap.NewNop()); err == nil {
+		t.Error("RefreshCredentials() expected error for non-bootstrap provider")
+	}
+}
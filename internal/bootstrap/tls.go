@@ -0,0 +1,65 @@
+package bootstrap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// newHTTPClient returns the HTTP client shared by all bootstrap providers,
+// applying the optional bootstrap_tls CA bundle and client certificate
+func newHTTPClient(cfg *config.Config, logger *zap.Logger) (*http.Client, error) {
+	return newHTTPClientWithTLS(cfg.NATS.Auth.BootstrapTLS, logger)
+}
+
+// newHTTPClientWithTLS builds a bootstrap HTTP client from explicit TLS settings
+func newHTTPClientWithTLS(bt config.BootstrapTLSConfig, logger *zap.Logger) (*http.Client, error) {
+	if bt == (config.BootstrapTLSConfig{}) {
+		return &http.Client{Timeout: httpTimeout}, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// Private CAs are added to the system roots so public endpoints keep working
+	if bt.CAFile != "" {
+		logger.Info("Loading bootstrap CA bundle", zap.String("file", bt.CAFile))
+
+		caCert, err := os.ReadFile(bt.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bootstrap CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse bootstrap CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if bt.CertFile != "" && bt.KeyFile != "" {
+		logger.Info("Loading bootstrap client certificate",
+			zap.String("cert", bt.CertFile),
+			zap.String("key", bt.KeyFile))
+
+		cert, err := tls.LoadX509KeyPair(bt.CertFile, bt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load bootstrap client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Timeout: httpTimeout, Transport: transport}, nil
+}
@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFetchHTTPCredentialsPrivateCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testCreds)) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	// Without the CA the self-signed test server must be rejected
+	cfg := httpTestConfig(t, srv.URL)
+	cfg.NATS.Auth.HTTP.JSONPath = ""
+	err := FetchHTTPCredentials(cfg, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("FetchHTTPCredentials() error = %v, want certificate verification error", err)
+	}
+
+	// With the server's certificate as the CA bundle it succeeds
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NATS.Auth.BootstrapTLS.CAFile = caFile
+
+	if err := FetchHTTPCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchHTTPCredentials() error = %v", err)
+	}
+	content, _ := os.ReadFile(cfg.NATS.Auth.CredsFile) //nolint:errcheck
+	if string(content) != testCreds {
+		t.Errorf("creds file content = %q, want %q", content, testCreds)
+	}
+}
+
+func TestNewHTTPClientInvalidCA(t *testing.T) {
+	cfg := httpTestConfig(t, "https://unused.example.com")
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NATS.Auth.BootstrapTLS.CAFile = caFile
+
+	if _, err := newHTTPClient(cfg, zap.NewNop()); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("newHTTPClient() error = %v, want parse error", err)
+	}
+}
@@ -0,0 +1,200 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// vaultLoginResponse is the Vault auth login response, narrowed to the token
+type vaultLoginResponse struct {
+	Auth struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+}
+
+// vaultSecretResponse is a Vault KV read response. KV v2 nests the secret
+// under data.data; KV v1 returns it directly under data.
+type vaultSecretResponse struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// FetchVaultCredentials checks if the credential file (.creds or nkey seed)
+// exists, and if not, logs in to Vault and writes the secret to disk.
+// Returns nil if the file already exists or was successfully created.
+func FetchVaultCredentials(cfg *config.Config, logger *zap.Logger) error {
+	vault := cfg.NATS.Auth.Vault
+	targetPath := vaultTargetPath(cfg)
+
+	// If the credential file already exists, skip bootstrap
+	if _, err := os.Stat(targetPath); err == nil {
+		logger.Info("Credentials file exists, skipping Vault bootstrap", zap.String("path", targetPath))
+		return nil
+	}
+
+	logger.Info("Credentials file not found, bootstrapping from Vault",
+		zap.String("path", targetPath),
+		zap.String("vault_address", vault.Address),
+		zap.String("auth_method", vault.AuthMethod))
+
+	secret, err := fetchVaultCredentials(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	if err := writeSecretFile(cfg, targetPath, secret); err != nil {
+		return fmt.Errorf("bootstrap: failed to write credentials file: %w", err)
+	}
+	logger.Info("Credentials file written", zap.String("path", targetPath))
+
+	return nil
+}
+
+// vaultTargetPath returns the file the Vault secret is written to
+func vaultTargetPath(cfg *config.Config) string {
+	if cfg.NATS.Auth.Vault.SecretType == "nkey" {
+		return cfg.NATS.Auth.NkeyFile
+	}
+	return cfg.NATS.Auth.CredsFile
+}
+
+// fetchVaultCredentials logs in to Vault and returns the configured secret field
+func fetchVaultCredentials(cfg *config.Config, logger *zap.Logger) (string, error) {
+	vault := cfg.NATS.Auth.Vault
+	client, err := newHTTPClient(cfg, logger)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: %w", err)
+	}
+
+	token, err := vaultLogin(client, &vault)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: vault login failed: %w", err)
+	}
+	logger.Info("Authenticated with Vault")
+
+	field := vault.SecretField
+	if field == "" {
+		field = "creds"
+	}
+	secret, err := vaultReadSecret(client, &vault, token, field)
+	if err != nil {
+		return "", fmt.Errorf("bootstrap: vault read failed: %w", err)
+	}
+	logger.Info("Fetched credentials from Vault", zap.String("secret_path", vault.SecretPath))
+
+	return secret, nil
+}
+
+// vaultLogin authenticates with the configured auth method and returns a
+// client token
+func vaultLogin(client *http.Client, vault *config.VaultAuth) (string, error) {
+	var payload map[string]string
+	switch vault.AuthMethod {
+	case "approle":
+		secretID := os.Getenv(vault.SecretIDEnv)
+		if secretID == "" {
+			return "", fmt.Errorf("environment variable %s is not set or empty", vault.SecretIDEnv)
+		}
+		payload = map[string]string{"role_id": vault.RoleID, "secret_id": secretID}
+	case "kubernetes":
+		jwt, err := os.ReadFile(vault.TokenPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read service account token: %w", err)
+		}
+		payload = map[string]string{"role": vault.Role, "jwt": strings.TrimSpace(string(jwt))}
+	default:
+		return "", fmt.Errorf("unsupported auth method: %s", vault.AuthMethod)
+	}
+
+	mount := vault.AuthMount
+	if mount == "" {
+		mount = vault.AuthMethod
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode login request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/auth/%s/login", strings.TrimRight(vault.Address, "/"), strings.Trim(mount, "/"))
+	req, err := http.NewRequest("POST", url, strings.NewReader(string(body)))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vault.Namespace)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body) //nolint:errcheck // best-effort read for error message
+		return "", fmt.Errorf("login returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var loginResp vaultLoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&loginResp); err != nil {
+		return "", fmt.Errorf("failed to parse login response: %w", err)
+	}
+	if loginResp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("login response contained no client token")
+	}
+
+	return loginResp.Auth.ClientToken, nil
+}
+
+// vaultReadSecret reads the secret at the configured path and returns the
+// string value of field
+func vaultReadSecret(client *http.Client, vault *config.VaultAuth, token, field string) (string, error) {
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(vault.Address, "/"), strings.TrimLeft(vault.SecretPath, "/"))
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if vault.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", vault.Namespace)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body) //nolint:errcheck // best-effort read for error message
+		return "", fmt.Errorf("secret read returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var secretResp vaultSecretResponse
+	if err := json.NewDecoder(resp.Body).Decode(&secretResp); err != nil {
+		return "", fmt.Errorf("failed to parse secret response: %w", err)
+	}
+
+	data := secretResp.Data
+	// KV v2 wraps the secret in data.data alongside metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+
+	value, ok := data[field].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("secret at %s has no string field %q", vault.SecretPath, field)
+	}
+
+	return value, nil
+}
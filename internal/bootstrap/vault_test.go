@@ -0,0 +1,173 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// newVaultServer returns an httptest server that mimics Vault's AppRole and
+// Kubernetes login endpoints and a KV v2 (or v1) read of secret/data/agents/server-01.
+func newVaultServer(t *testing.T, kvV2 bool, secret map[string]interface{}) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login", "/v1/auth/kubernetes/login":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if body["secret_id"] != "s3cret" && body["jwt"] != "sa-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"errors":["invalid credentials"]}`)) //nolint:errcheck
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"auth":{"client_token":"hvs.test"}}`)) //nolint:errcheck
+		case "/v1/secret/data/agents/server-01":
+			if r.Header.Get("X-Vault-Token") != "hvs.test" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":["permission denied"]}`)) //nolint:errcheck
+				return
+			}
+			resp := map[string]interface{}{"data": secret}
+			if kvV2 {
+				resp = map[string]interface{}{"data": map[string]interface{}{
+					"data":     secret,
+					"metadata": map[string]interface{}{"version": 1},
+				}}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp) //nolint:errcheck
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func vaultTestConfig(t *testing.T, url string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	return &config.Config{
+		Code: "server-01",
+		NATS: config.NATSConfig{
+			Auth: config.AuthConfig{
+				Type:      "vault",
+				CredsFile: filepath.Join(dir, "device.creds"),
+				NkeyFile:  filepath.Join(dir, "device.nk"),
+				Vault: config.VaultAuth{
+					Address:     url,
+					AuthMethod:  "approle",
+					RoleID:      "role-123",
+					SecretIDEnv: "TEST_AGENT_VAULT_SECRET_ID",
+					SecretPath:  "secret/data/agents/server-01",
+					SecretField: "creds",
+					SecretType:  "creds",
+				},
+			},
+		},
+	}
+}
+
+func TestFetchVaultCredentialsAppRoleKVv2(t *testing.T) {
+	srv := newVaultServer(t, true, map[string]interface{}{"creds": testCreds})
+	defer srv.Close()
+
+	cfg := vaultTestConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_VAULT_SECRET_ID", "s3cret")
+
+	if err := FetchVaultCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchVaultCredentials() error = %v", err)
+	}
+
+	content, err := os.ReadFile(cfg.NATS.Auth.CredsFile)
+	if err != nil {
+		t.Fatalf("creds file not written: %v", err)
+	}
+	if string(content) != testCreds {
+		t.Errorf("creds file content = %q, want %q", content, testCreds)
+	}
+}
+
+func TestFetchVaultCredentialsKubernetesNkeyKVv1(t *testing.T) {
+	const seed = "SUAIBDPBAUTWCWBKIO6XHQNINK5FWJW4OHLXC3HQ2KFE4PEJUA44CNHTC4"
+	srv := newVaultServer(t, false, map[string]interface{}{"seed": seed})
+	defer srv.Close()
+
+	cfg := vaultTestConfig(t, srv.URL)
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("sa-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.NATS.Auth.Vault.AuthMethod = "kubernetes"
+	cfg.NATS.Auth.Vault.Role = "agent"
+	cfg.NATS.Auth.Vault.TokenPath = tokenPath
+	cfg.NATS.Auth.Vault.SecretField = "seed"
+	cfg.NATS.Auth.Vault.SecretType = "nkey"
+
+	if err := FetchVaultCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchVaultCredentials() error = %v", err)
+	}
+
+	content, err := os.ReadFile(cfg.NATS.Auth.NkeyFile)
+	if err != nil {
+		t.Fatalf("nkey file not written: %v", err)
+	}
+	if string(content) != seed {
+		t.Errorf("nkey file content = %q, want %q", content, seed)
+	}
+}
+
+func TestFetchVaultCredentialsSkipsWhenFileExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("vault should not be contacted when creds file exists")
+	}))
+	defer srv.Close()
+
+	cfg := vaultTestConfig(t, srv.URL)
+	if err := os.WriteFile(cfg.NATS.Auth.CredsFile, []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := FetchVaultCredentials(cfg, zap.NewNop()); err != nil {
+		t.Fatalf("FetchVaultCredentials() error = %v", err)
+	}
+}
+
+func TestFetchVaultCredentialsBadSecretID(t *testing.T) {
+	srv := newVaultServer(t, true, map[string]interface{}{"creds": testCreds})
+	defer srv.Close()
+
+	cfg := vaultTestConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_VAULT_SECRET_ID", "wrong")
+
+	err := FetchVaultCredentials(cfg, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "vault login failed") {
+		t.Fatalf("FetchVaultCredentials() error = %v, want login error", err)
+	}
+}
+
+func TestFetchVaultCredentialsMissingField(t *testing.T) {
+	srv := newVaultServer(t, true, map[string]interface{}{"other": "value"})
+	defer srv.Close()
+
+	cfg := vaultTestConfig(t, srv.URL)
+	t.Setenv("TEST_AGENT_VAULT_SECRET_ID", "s3cret")
+
+	err := FetchVaultCredentials(cfg, zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), `no string field "creds"`) {
+		t.Fatalf("FetchVaultCredentials() error = %v, want missing field error", err)
+	}
+	if _, statErr := os.Stat(cfg.NATS.Auth.CredsFile); statErr == nil {
+		t.Error("creds file should not be written when the field is missing")
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+)
+
+// ConfigBootstrap lets an image ship with only a code and a platform login.
+// On first start the agent authenticates as its thing, pulls the full agent
+// config from the thing record, validates it, and replaces the local file.
+type ConfigBootstrap struct {
+	URL         string `mapstructure:"url"`          // Platform (PocketBase) base URL
+	Identity    string `mapstructure:"identity"`     // The thing's login email
+	PasswordEnv string `mapstructure:"password_env"` // Env var containing the thing's password
+	Field       string `mapstructure:"field"`        // Thing record field holding the config (default: agent_config)
+
+	TLS BootstrapTLSConfig `mapstructure:"tls"` // Private CA / mTLS for the platform
+}
+
+// ReadConfigBootstrap inspects the config file without applying defaults or
+// validation. It returns the agent code and bootstrap settings when the file
+// is a minimal bootstrap config (has config_bootstrap but no nats section),
+// or nil when the file is already a full config.
+func ReadConfigBootstrap(configPath string) (string, *ConfigBootstrap, error) {
+	v := viper.New()
+	v.SetConfigFile(configPath)
+	if err := v.ReadInConfig(); err != nil {
+		return "", nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if !v.IsSet("config_bootstrap") || v.IsSet("nats") {
+		return "", nil, nil
+	}
+
+	code := v.GetString("code")
+	if code == "" {
+		code = v.GetString("device_id")
+	}
+
+	var cb ConfigBootstrap
+	if err := v.UnmarshalKey("config_bootstrap", &cb); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal config_bootstrap: %w", err)
+	}
+
+	// Full validation happens on the fetched config; the code has to be
+	// usable now because it is checked against the platform record
+	if !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(code) {
+		return "", nil, fmt.Errorf("code is required and must contain only alphanumeric characters, dashes, and underscores (got: %q)", code)
+	}
+	if cb.URL == "" || cb.Identity == "" || cb.PasswordEnv == "" {
+		return "", nil, fmt.Errorf("config_bootstrap requires url, identity, and password_env")
+	}
+	if cb.Field == "" {
+		cb.Field = "agent_config"
+	}
+
+	return code, &cb, nil
+}
+
+// PrepareBootstrappedConfig takes a config document (YAML or JSON) fetched
+// from the control plane, pins it to the local code, and validates it with
+// the same defaults and rules as Load. Returns the YAML to write to disk.
+func PrepareBootstrappedConfig(data []byte, code string) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse fetched config: %w", err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("fetched config is empty")
+	}
+
+	// The local code is the device's identity; the fetched config may omit
+	// it (shared templates) but must not contradict it
+	if remote, ok := doc["code"]; ok && fmt.Sprint(remote) != code {
+		return nil, fmt.Errorf("fetched config has code %q but this device is %q", remote, code)
+	}
+	doc["code"] = code
+	delete(doc, "device_id")
+	delete(doc, "config_bootstrap")
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	setDefaults(v)
+	if err := v.ReadConfig(bytes.NewReader(out)); err != nil {
+		return nil, fmt.Errorf("failed to read fetched config: %w", err)
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fetched config: %w", err)
+	}
+	if err := validate(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid fetched config: %w", err)
+	}
+
+	return out, nil
+}
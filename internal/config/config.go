@@ -1,24 +1,58 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	_ "time/tzdata" // IANA zones for tasks.timezone on Windows, which has no zoneinfo
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/nats-io/nkeys"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/viper"
 )
 
 // Config represents the complete agent configuration
 type Config struct {
-	Code          string         `mapstructure:"code"`     // Agent identity token used in NATS subjects (was: device_id)
-	Location      string         `mapstructure:"location"` // Optional deployment location, carried in telemetry payloads
-	SubjectPrefix string         `mapstructure:"subject_prefix"`
-	NATS          NATSConfig     `mapstructure:"nats"`
-	Tasks         TasksConfig    `mapstructure:"tasks"`
-	Commands      CommandsConfig `mapstructure:"commands"`
-	Logging       LoggingConfig  `mapstructure:"logging"`
+	Code          string            `mapstructure:"code"`     // Agent identity token used in NATS subjects (was: device_id)
+	Location      string            `mapstructure:"location"` // Optional deployment location, carried in telemetry payloads
+	Tags          map[string]string `mapstructure:"tags"`     // Optional device metadata (site, role, ...) in heartbeats, inventory and message headers
+	Profile       string            `mapstructure:"profile"`  // Defaults for a device class: "standard" (default) or "low-resource"
+	SubjectPrefix string            `mapstructure:"subject_prefix"`
+	DataDir       string            `mapstructure:"data_dir"` // Agent state kept across restarts (metrics baselines)
+	Immutable     ImmutableConfig   `mapstructure:"immutable"`
+	Startup       StartupConfig     `mapstructure:"startup"`
+	NATS          NATSConfig        `mapstructure:"nats"`
+	Tasks         TasksConfig       `mapstructure:"tasks"`
+	Commands      CommandsConfig    `mapstructure:"commands"`
+	Logging       LoggingConfig     `mapstructure:"logging"`
+	Debug         DebugConfig       `mapstructure:"debug"`
+	Runtime       RuntimeConfig     `mapstructure:"runtime"`
+	Control       ControlConfig     `mapstructure:"control"`
+	Plugins       []PluginConfig    `mapstructure:"plugins"`
+	Gateway       GatewayConfig     `mapstructure:"gateway"`
+	Modbus        ModbusConfig      `mapstructure:"modbus"`
+	MQTT          MQTTConfig        `mapstructure:"mqtt"`
+	BACnet        BACnetConfig      `mapstructure:"bacnet"`
+	GPIO          GPIOConfig        `mapstructure:"gpio"`
+	Compliance    ComplianceConfig  `mapstructure:"compliance"`
+	ZFS           ZFSConfig         `mapstructure:"zfs"`
+	RAID          RAIDConfig        `mapstructure:"raid"`
+	UPS           UPSConfig         `mapstructure:"ups"`
+	Election      ElectionConfig    `mapstructure:"election"`
 }
 
 // NATSConfig holds NATS connection settings
@@ -29,16 +63,79 @@ type NATSConfig struct {
 	MaxReconnects int           `mapstructure:"max_reconnects"`
 	ReconnectWait time.Duration `mapstructure:"reconnect_wait"`
 	DrainTimeout  time.Duration `mapstructure:"drain_timeout"`
+
+	// Outbound buffering; 0 keeps the nats.go default
+	ReconnectBufSizeMB int                 `mapstructure:"reconnect_buf_size_mb"` // Publishes buffered while disconnected (default 8)
+	FlusherTimeout     time.Duration       `mapstructure:"flusher_timeout"`       // Max time a socket write may block (default 1m)
+	PendingLimits      PendingLimitsConfig `mapstructure:"pending_limits"`
+
+	// Keepalive and dial tuning; 0 keeps the nats.go default
+	PingInterval   time.Duration `mapstructure:"ping_interval"`   // Time between client PINGs (default 2m)
+	MaxPingsOut    int           `mapstructure:"max_pings_out"`   // Unanswered PINGs before the connection is dead (default 2)
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"` // Dial timeout per server (default 2s)
+
+	CommandConnection bool `mapstructure:"command_connection"` // Serve commands on a second connection, isolated from telemetry
+
+	PublishLimits PublishLimitsConfig `mapstructure:"publish_limits"`
+	Compression   CompressionConfig   `mapstructure:"compression"`
+
+	// JetStream domain for telemetry and the command queue, when connecting
+	// through a site-local leafnode whose streams live in another domain
+	// (empty = the domain of the server the agent connects to)
+	JetStreamDomain string `mapstructure:"jetstream_domain"`
+}
+
+// PublishLimitsConfig caps telemetry publishes per subject so a
+// misconfigured interval across a fleet can't overload JetStream
+type PublishLimitsConfig struct {
+	MaxPerMinute int    `mapstructure:"max_per_minute"` // Per telemetry subject (0 = unlimited)
+	QueueSize    int    `mapstructure:"queue_size"`     // Over-limit publishes held for the next minute
+	DropPolicy   string `mapstructure:"drop_policy"`    // Full queue: "oldest" (default) or "newest"
+}
+
+// CompressionConfig controls zstd compression of large payloads, for sites
+// on metered cellular links. Compressed messages carry Agent-Encoding: zstd.
+// Replies are only compressed for requesters that send
+// Agent-Accept-Encoding: zstd.
+type CompressionConfig struct {
+	Enabled   bool `mapstructure:"enabled"`   // Compress log fetch replies and diagnostics bundles for requesters that accept zstd
+	Inventory bool `mapstructure:"inventory"` // Also compress inventory telemetry; every consumer must decode it
+	MinBytes  int  `mapstructure:"min_bytes"` // Smaller payloads are sent as-is
+}
+
+// PendingLimitsConfig bounds messages queued in the client. 0 keeps the
+// nats.go default.
+type PendingLimitsConfig struct {
+	Publishes int `mapstructure:"publishes"` // Async JetStream publishes awaiting an ack (default 4000)
+	Messages  int `mapstructure:"messages"`  // Undelivered messages per command subscription (default 500000)
+	BytesMB   int `mapstructure:"bytes_mb"`  // Undelivered bytes per command subscription (default 64)
 }
 
 // AuthConfig holds NATS authentication credentials
 type AuthConfig struct {
-	Type       string         `mapstructure:"type"`       // creds, token, userpass, pocketbase, none
-	CredsFile  string         `mapstructure:"creds_file"` // for creds and pocketbase auth
+	Type       string         `mapstructure:"type"`       // creds, nkey, token, userpass, pocketbase, vault, http, none
+	CredsFile  string         `mapstructure:"creds_file"` // for creds, pocketbase, vault, and http auth
+	NkeyFile   string         `mapstructure:"nkey_file"`  // for nkey auth (and vault with secret_type nkey)
 	Token      string         `mapstructure:"token"`      // for token auth
 	Username   string         `mapstructure:"username"`   // for userpass auth
 	Password   string         `mapstructure:"password"`   // for userpass auth
 	PocketBase PocketBaseAuth `mapstructure:"pocketbase"` // for pocketbase bootstrap
+	Vault      VaultAuth      `mapstructure:"vault"`      // for vault bootstrap
+	HTTP       HTTPAuth       `mapstructure:"http"`       // for generic HTTPS bootstrap
+
+	RefreshInterval time.Duration      `mapstructure:"refresh_interval"` // Re-fetch bootstrapped creds periodically (0 = disabled)
+	BootstrapTLS    BootstrapTLSConfig `mapstructure:"bootstrap_tls"`    // TLS for the bootstrap HTTP client
+	SecretStore     string             `mapstructure:"secret_store"`     // file (default), dpapi (Windows), encrypted (Linux/FreeBSD)
+	SecretKeyFile   string             `mapstructure:"secret_key_file"`  // Key for the encrypted store (created on first use)
+}
+
+// BootstrapTLSConfig configures the HTTP client used by the pocketbase, vault,
+// and http bootstrap providers, for on-prem endpoints behind a private CA
+// and/or requiring client certificates. Independent of the NATS tls section.
+type BootstrapTLSConfig struct {
+	CAFile   string `mapstructure:"ca_file"`   // CA bundle added to the system roots
+	CertFile string `mapstructure:"cert_file"` // Client certificate for mTLS
+	KeyFile  string `mapstructure:"key_file"`  // Client private key for mTLS
 }
 
 // PocketBaseAuth configures first-start credential bootstrap against the
@@ -49,6 +146,46 @@ type PocketBaseAuth struct {
 	URL         string `mapstructure:"url"`          // Platform (PocketBase) base URL
 	Identity    string `mapstructure:"identity"`     // The thing's login email
 	PasswordEnv string `mapstructure:"password_env"` // Env var containing the thing's password
+
+	Registration RegistrationConfig `mapstructure:"registration"` // Optional zero-touch registration
+}
+
+// RegistrationConfig enables zero-touch provisioning: when the thing login is
+// rejected, the agent files a registration request on the platform and keeps
+// retrying the login until an operator approves it (creates the thing).
+type RegistrationConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Collection   string        `mapstructure:"collection"`    // Platform collection for requests (default: registrations)
+	PollInterval time.Duration `mapstructure:"poll_interval"` // How often to retry the login while pending
+	Timeout      time.Duration `mapstructure:"timeout"`       // Give up (and exit) after this long
+}
+
+// VaultAuth configures first-start credential bootstrap from HashiCorp Vault.
+// The agent logs in with AppRole or Kubernetes auth and reads its NATS .creds
+// (or nkey seed) from a KV secret. Both KV v1 and v2 responses are accepted.
+type VaultAuth struct {
+	Address     string `mapstructure:"address"`       // Vault base URL, e.g. https://vault.example.com:8200
+	Namespace   string `mapstructure:"namespace"`     // Optional Vault Enterprise namespace
+	AuthMethod  string `mapstructure:"auth_method"`   // "approle" or "kubernetes"
+	AuthMount   string `mapstructure:"auth_mount"`    // Auth method mount path (default: same as auth_method)
+	RoleID      string `mapstructure:"role_id"`       // AppRole role_id
+	SecretIDEnv string `mapstructure:"secret_id_env"` // Env var containing the AppRole secret_id
+	Role        string `mapstructure:"role"`          // Kubernetes auth role
+	TokenPath   string `mapstructure:"token_path"`    // Kubernetes service account token file
+	SecretPath  string `mapstructure:"secret_path"`   // API path of the secret, e.g. secret/data/agents/server-01
+	SecretField string `mapstructure:"secret_field"`  // Field holding the credential (default: creds)
+	SecretType  string `mapstructure:"secret_type"`   // "creds" (default) or "nkey"
+}
+
+// HTTPAuth configures first-start credential bootstrap from an arbitrary
+// provisioning API. Header values and the body are expanded with ${VAR}
+// environment references so secrets stay out of the config file.
+type HTTPAuth struct {
+	URL      string            `mapstructure:"url"`       // Endpoint URL; {code} is replaced with the agent code
+	Method   string            `mapstructure:"method"`    // GET (default), POST, or PUT
+	Headers  map[string]string `mapstructure:"headers"`   // Request headers, values support ${VAR}
+	Body     string            `mapstructure:"body"`      // Optional request body, supports ${VAR}
+	JSONPath string            `mapstructure:"json_path"` // Dotted path to the creds field; empty = raw response body
 }
 
 // TLSConfig holds TLS connection settings
@@ -58,10 +195,16 @@ type TLSConfig struct {
 	KeyFile            string `mapstructure:"key_file"`             // Client private key
 	CAFile             string `mapstructure:"ca_file"`              // CA certificate for server verification
 	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip server certificate verification (NOT recommended for production)
+
+	ReloadInterval time.Duration `mapstructure:"reload_interval"` // How often to check cert/key/CA for changes (0 = disabled)
+	HandshakeFirst bool          `mapstructure:"handshake_first"` // TLS handshake before the NATS INFO (servers with handshake_first)
 }
 
 // TasksConfig holds scheduled task configurations
 type TasksConfig struct {
+	Splay         time.Duration       `mapstructure:"splay"`    // Max random delay added before each task's first run
+	Jitter        time.Duration       `mapstructure:"jitter"`   // Max random +/- variation applied to every interval
+	Timezone      string              `mapstructure:"timezone"` // Zone cron schedules run in: "UTC" (default), "Local" or an IANA name
 	Heartbeat     HeartbeatConfig     `mapstructure:"heartbeat"`
 	SystemMetrics SystemMetricsConfig `mapstructure:"system_metrics"`
 	ServiceCheck  ServiceCheckConfig  `mapstructure:"service_check"`
@@ -72,36 +215,570 @@ type TasksConfig struct {
 type HeartbeatConfig struct {
 	Enabled  bool          `mapstructure:"enabled"`
 	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"` // Max run time per execution (0 = interval)
+
+	// FastInterval is the first gap between heartbeats after a reconnect or
+	// publish failure; it doubles per beat until it reaches Interval
+	// (0 = disabled)
+	FastInterval time.Duration `mapstructure:"fast_interval"`
+
+	// TimeSync adds the clock's sync state (chrony, ntpd, systemd-timesyncd
+	// or w32time) to each heartbeat, read at most every 5 minutes
+	TimeSync bool `mapstructure:"time_sync"`
 }
 
 // SystemMetricsConfig configures metrics collection
 type SystemMetricsConfig struct {
 	Enabled     bool          `mapstructure:"enabled"`
 	Interval    time.Duration `mapstructure:"interval"`
-	Source      string        `mapstructure:"source"`       // "builtin" (default) or "exporter"
-	ExporterURL string        `mapstructure:"exporter_url"` // Only used when Source="exporter"
+	Timeout     time.Duration `mapstructure:"timeout"`      // Max run time per execution (0 = interval)
+	Source      string        `mapstructure:"source"`       // "builtin" (default), "exporter", "hybrid" or "pdh" (Windows)
+	ExporterURL string        `mapstructure:"exporter_url"` // Only used when Source="exporter" or "hybrid"
+
+	// Headers and credentials for exporters behind an authenticating proxy
+	ExporterRequest ExporterRequestConfig `mapstructure:"exporter_request"`
+	ExporterTLS     ExporterTLSConfig     `mapstructure:"exporter_tls"` // https:// exporter_url only
+
+	// Exporter families added to each payload when Source="hybrid"
+	ExtraFamilies []string `mapstructure:"extra_families"`
+
+	// Performance counter paths added to each payload when Source="pdh",
+	// e.g. \Web Service(_Total)\Current Connections (wildcards allowed)
+	Counters []string `mapstructure:"counters"`
+
+	// cgroup v2 groups to report (Linux), relative to /sys/fs/cgroup; glob
+	// patterns allowed, e.g. system.slice/*.service
+	Cgroups []string `mapstructure:"cgroups"`
+
+	TopProcesses int `mapstructure:"top_processes"` // Heaviest processes by CPU/memory per payload (0 = disabled)
+
+	DiskIO bool `mapstructure:"disk_io"` // Per-disk read/write rates (builtin, hybrid and pdh sources)
+
+	// Sample CPU this often between scrapes and publish avg/max/p95 (0 = disabled)
+	CPUSampleInterval time.Duration `mapstructure:"cpu_sample_interval"`
+
+	// Drive/mountpoint glob patterns; a pattern also matches everything below
+	// a matching directory. Excludes win over includes.
+	IncludeDisks []string `mapstructure:"include_disks"` // Empty = all drives
+	ExcludeDisks []string `mapstructure:"exclude_disks"`
+
+	Retry RetryConfig `mapstructure:"retry"` // Retry a failed scrape before reporting the failure
+
+	Fallback ExporterFallbackConfig `mapstructure:"fallback"` // Exporter source: use builtin metrics while the exporter is down
+
+	DiskForecast DiskForecastConfig `mapstructure:"disk_forecast"` // Predict when drives fill up
+
+	RemoteWrite RemoteWriteConfig `mapstructure:"remote_write"` // Also push each scrape to a Prometheus-compatible TSDB
+}
+
+// ExporterRequestConfig is how exporter scrapes identify and authenticate
+// themselves, for exporters behind a reverse proxy
+type ExporterRequestConfig struct {
+	UserAgent      string            `mapstructure:"user_agent"`       // Empty = stone-age-agent/1.0
+	Headers        map[string]string `mapstructure:"headers"`          // Extra request headers, values support ${VAR}; Host sets the virtual host
+	Username       string            `mapstructure:"username"`         // Basic auth, optional
+	PasswordEnv    string            `mapstructure:"password_env"`     // Env var containing the basic auth password
+	BearerTokenEnv string            `mapstructure:"bearer_token_env"` // Env var containing a bearer token (instead of basic auth)
+}
+
+// ExporterTLSConfig configures TLS for an https:// exporter_url, separately
+// from the NATS TLS settings, for exporters bound to non-localhost
+// interfaces
+type ExporterTLSConfig struct {
+	CAFile             string `mapstructure:"ca_file"`              // CA bundle added to the system roots
+	CertFile           string `mapstructure:"cert_file"`            // Client certificate for mTLS
+	KeyFile            string `mapstructure:"key_file"`             // Client private key for mTLS
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Skip server certificate verification (NOT recommended)
+}
+
+// ExporterFallbackConfig switches the exporter source to the builtin
+// collector after consecutive failed scrapes (retries included) and back
+// once the exporter answers again, tried every RetryInterval
+type ExporterFallbackConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Failures      int           `mapstructure:"failures"`       // Failed scrapes in a row before falling back; 1-20
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // How often to try the exporter while falling back; interval to 24h
+}
+
+// RemoteWriteConfig pushes each scrape to a Prometheus remote_write
+// endpoint (Prometheus, Mimir, Thanos, VictoriaMetrics). Every series is
+// labelled with the agent code and location plus Labels.
+type RemoteWriteConfig struct {
+	Enabled        bool              `mapstructure:"enabled"`
+	URL            string            `mapstructure:"url"`              // e.g. https://mimir.example.com/api/v1/push
+	Timeout        time.Duration     `mapstructure:"timeout"`          // Per push; 1s to the system_metrics timeout
+	Username       string            `mapstructure:"username"`         // Basic auth, optional
+	PasswordEnv    string            `mapstructure:"password_env"`     // Env var containing the basic auth password
+	BearerTokenEnv string            `mapstructure:"bearer_token_env"` // Env var containing a bearer token (instead of basic auth)
+	Headers        map[string]string `mapstructure:"headers"`          // Extra request headers, e.g. X-Scope-OrgID; values support ${VAR}
+	CAFile         string            `mapstructure:"ca_file"`          // https:// only; empty = system roots
+	Labels         map[string]string `mapstructure:"labels"`           // Added to every series, e.g. env: prod
+	ExtraFamilies  bool              `mapstructure:"extra_families"`   // Also push the hybrid source's exporter families
+	SkipNATS       bool              `mapstructure:"skip_nats"`        // Don't publish telemetry.system; remote_write only
+}
+
+// DiskForecastConfig fits a line through each drive's free space over the
+// window and publishes a disk_full_predicted event when a drive is
+// projected to fill within the horizon. Samples are kept in data_dir, so
+// the trend survives restarts.
+type DiskForecastConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Window     time.Duration `mapstructure:"window"`      // Free space history fitted; 1h-30d
+	Horizon    time.Duration `mapstructure:"horizon"`     // Alert when a drive is projected to fill within this; 1h-90d
+	MinSamples int           `mapstructure:"min_samples"` // Samples needed before predicting; 3-288
 }
 
 // ServiceCheckConfig configures service status monitoring
 type ServiceCheckConfig struct {
 	Enabled  bool          `mapstructure:"enabled"`
 	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"` // Max run time per execution (0 = interval)
 	Services []string      `mapstructure:"services"`
+
+	// Track up/down history in data_dir and add rolling 24h/7d
+	// availability to each service in the payload
+	Availability bool `mapstructure:"availability"`
 }
 
 // InventoryConfig configures system inventory reporting
 type InventoryConfig struct {
-	Enabled  bool          `mapstructure:"enabled"`
-	Interval time.Duration `mapstructure:"interval"`
+	Enabled   bool          `mapstructure:"enabled"`
+	Interval  time.Duration `mapstructure:"interval"`
+	Timeout   time.Duration `mapstructure:"timeout"`   // Max run time per execution (0 = interval)
+	Neighbors bool          `mapstructure:"neighbors"` // Include the ARP/NDP table and LLDP neighbors (lldpd)
+	Retry     RetryConfig   `mapstructure:"retry"`     // Retry a failed collection before giving up until the next interval
+
+	// Cron expression (minute hour day month weekday) in tasks.timezone to
+	// run on instead of every interval, e.g. "0 3 * * *". The interval
+	// still bounds each run when timeout is 0.
+	Schedule string `mapstructure:"schedule"`
+}
+
+// RetryConfig retries a failed task run within the task's timeout, so a
+// transient failure doesn't cost a whole interval. The wait doubles after
+// each failed attempt.
+type RetryConfig struct {
+	Attempts int           `mapstructure:"attempts"` // Retries after the first failure (0 = none)
+	Backoff  time.Duration `mapstructure:"backoff"`  // Wait before the first retry
 }
 
 // CommandsConfig holds command execution settings
 type CommandsConfig struct {
-	ScriptsDirectory string        `mapstructure:"scripts_directory"` // Directory containing allowed PowerShell scripts
-	AllowedServices  []string      `mapstructure:"allowed_services"`
-	AllowedCommands  []string      `mapstructure:"allowed_commands"`
-	AllowedLogPaths  []string      `mapstructure:"allowed_log_paths"`
-	Timeout          time.Duration `mapstructure:"timeout"` // Command execution timeout
+	ScriptsDirectory      string         `mapstructure:"scripts_directory"` // Directory containing allowed PowerShell scripts
+	AllowedServices       []string       `mapstructure:"allowed_services"`
+	AllowedCommands       []string       `mapstructure:"allowed_commands"`
+	AllowedLogPaths       []string       `mapstructure:"allowed_log_paths"`
+	AllowedScheduledTasks []string       `mapstructure:"allowed_scheduled_tasks"` // Windows Scheduled Task paths, e.g. \Vendor\Sync
+	SerialPorts           []SerialConfig `mapstructure:"serial_ports"`            // Ports cmd.serial may use, with their line settings
+	Timeout               time.Duration  `mapstructure:"timeout"`                 // Command execution timeout
+	MaxOutputBytes        int            `mapstructure:"max_output_bytes"`        // cmd.exec stdout/stderr and cmd.logs pages are cut in the middle beyond this (0 = 10MB)
+
+	Queue         CommandQueueConfig `mapstructure:"queue"`
+	Authorization CommandAuthConfig  `mapstructure:"authorization"`
+	Firewall      FirewallConfig     `mapstructure:"firewall"`
+	Registry      RegistryConfig     `mapstructure:"registry"`
+	IIS           IISConfig          `mapstructure:"iis"`
+	NetTest       NetTestConfig      `mapstructure:"nettest"`
+	Traceroute    TracerouteConfig   `mapstructure:"traceroute"`
+	Broadcast     BroadcastConfig    `mapstructure:"broadcast"`
+	Diag          DiagConfig         `mapstructure:"diag"`
+	RateLimits    RateLimitsConfig   `mapstructure:"rate_limits"`
+
+	ServiceDependencies ServiceDependenciesConfig `mapstructure:"service_dependencies"`
+	ReloadPidfiles      []ReloadPidfile           `mapstructure:"reload_pidfiles"` // Linux/FreeBSD: reload by SIGHUP
+}
+
+// PluginConfig registers an external executable as a scheduled task
+// (telemetry.plugin.<name>) and/or a command (cmd.plugin.<name>). The agent
+// and plugin exchange JSON over stdin/stdout; see docs/plugins.md.
+type PluginConfig struct {
+	Name     string        `mapstructure:"name"`
+	Path     string        `mapstructure:"path"` // Absolute path to the executable (run without a shell)
+	Args     []string      `mapstructure:"args"`
+	Interval time.Duration `mapstructure:"interval"` // Scheduled run interval (0 = not scheduled)
+	Schedule string        `mapstructure:"schedule"` // Or a cron expression in tasks.timezone, e.g. "30 2 * * 0"
+	Timeout  time.Duration `mapstructure:"timeout"`  // Per run (0 = commands.timeout)
+	Command  bool          `mapstructure:"command"`  // Serve cmd.plugin.<name>
+}
+
+// GatewayConfig makes the agent report on behalf of downstream devices that
+// can't run it (e.g. dumb controllers). Each child has its own subjects
+// ({prefix}.{child}.*), heartbeat and sequences; a plugin does the talking.
+type GatewayConfig struct {
+	Children []ChildConfig `mapstructure:"children"`
+}
+
+// ChildConfig is one device proxied by the gateway
+type ChildConfig struct {
+	Code     string        `mapstructure:"code"`
+	Location string        `mapstructure:"location"` // Defaults to the agent's location
+	Plugin   string        `mapstructure:"plugin"`   // Name of the plugin that polls and commands the child
+	Interval time.Duration `mapstructure:"interval"` // Poll interval (0 = commands only)
+}
+
+// ModbusConfig lists Modbus TCP/RTU devices polled on a schedule. Each
+// device's register map is read and published on
+// {prefix}.{code}.telemetry.modbus.<name>.
+type ModbusConfig struct {
+	Devices []ModbusDeviceConfig `mapstructure:"devices"`
+}
+
+// ModbusDeviceConfig is one Modbus slave and its register map
+type ModbusDeviceConfig struct {
+	Name      string                 `mapstructure:"name"`
+	Transport string                 `mapstructure:"transport"` // tcp or rtu
+	Address   string                 `mapstructure:"address"`   // host:port (tcp)
+	Serial    SerialConfig           `mapstructure:"serial"`    // rtu only
+	UnitID    int                    `mapstructure:"unit_id"`   // Slave/unit identifier (rtu: 1-247)
+	Interval  time.Duration          `mapstructure:"interval"`
+	Timeout   time.Duration          `mapstructure:"timeout"` // Per request (0 = 5s)
+	Registers []ModbusRegisterConfig `mapstructure:"registers"`
+}
+
+// SerialConfig is a serial line: a Modbus RTU bus or a cmd.serial port.
+// Zero values use the common 9600 8N1.
+type SerialConfig struct {
+	Device   string `mapstructure:"device"` // e.g. /dev/ttyUSB0, /dev/cuaU0, COM3
+	BaudRate int    `mapstructure:"baud_rate"`
+	DataBits int    `mapstructure:"data_bits"` // 7 or 8
+	Parity   string `mapstructure:"parity"`    // none, even, odd
+	StopBits int    `mapstructure:"stop_bits"` // 1 or 2
+}
+
+// ModbusRegisterConfig maps one value in a device's register space. The
+// published value is raw * scale + offset (scale 0 = 1).
+type ModbusRegisterConfig struct {
+	Name      string  `mapstructure:"name"`
+	Type      string  `mapstructure:"type"`       // holding, input, coil, discrete
+	Address   int     `mapstructure:"address"`    // 0-based protocol address
+	Format    string  `mapstructure:"format"`     // uint16, int16, uint32, int32, float32 (default uint16; coil/discrete are always bool)
+	WordOrder string  `mapstructure:"word_order"` // 32-bit formats: big (default, high word first) or little
+	Scale     float64 `mapstructure:"scale"`
+	Offset    float64 `mapstructure:"offset"`
+}
+
+// MQTTConfig bridges a site-local MQTT broker into telemetry. Messages on
+// topics matching a rule are republished on
+// {prefix}.{code}.telemetry.mqtt.<subject>.
+type MQTTConfig struct {
+	Enabled     bool             `mapstructure:"enabled"`
+	Broker      string           `mapstructure:"broker"`       // tcp://host:1883 or tls://host:8883
+	ClientID    string           `mapstructure:"client_id"`    // Default: agent-{code}
+	Username    string           `mapstructure:"username"`     // Optional
+	PasswordEnv string           `mapstructure:"password_env"` // Env var containing the broker password
+	CAFile      string           `mapstructure:"ca_file"`      // tls:// only; empty = system roots
+	KeepAlive   time.Duration    `mapstructure:"keep_alive"`
+	Rules       []MQTTRuleConfig `mapstructure:"rules"`
+}
+
+// MQTTRuleConfig maps an MQTT topic filter to a telemetry subject
+type MQTTRuleConfig struct {
+	Topic   string `mapstructure:"topic"`   // Topic filter, may use + and #
+	Subject string `mapstructure:"subject"` // Subject suffix after telemetry.mqtt; {1}, {2}, ... insert the levels matched by each wildcard
+	QoS     int    `mapstructure:"qos"`     // 0 or 1
+}
+
+// BACnetConfig enables BACnet/IP discovery and point polling. Discovered
+// devices are published on {prefix}.{code}.telemetry.bacnet.devices and
+// each device's points on {prefix}.{code}.telemetry.bacnet.<name>.
+type BACnetConfig struct {
+	Enabled           bool                 `mapstructure:"enabled"`
+	Listen            string               `mapstructure:"listen"`             // Local UDP address (default :47808, where I-Am broadcasts arrive)
+	Broadcast         string               `mapstructure:"broadcast"`          // Who-Is destination (default 255.255.255.255:47808)
+	Timeout           time.Duration        `mapstructure:"timeout"`            // Per request
+	DiscoveryInterval time.Duration        `mapstructure:"discovery_interval"` // 0 = no device list
+	DiscoveryTimeout  time.Duration        `mapstructure:"discovery_timeout"`  // How long to collect I-Am answers
+	Devices           []BACnetDeviceConfig `mapstructure:"devices"`
+}
+
+// BACnetDeviceConfig is one BACnet device and the points read from it
+type BACnetDeviceConfig struct {
+	Name     string              `mapstructure:"name"`
+	Instance int                 `mapstructure:"instance"` // Device object instance
+	Address  string              `mapstructure:"address"`  // ip:port; empty = found with Who-Is
+	Interval time.Duration       `mapstructure:"interval"`
+	Points   []BACnetPointConfig `mapstructure:"points"`
+}
+
+// BACnetPointConfig names one property of one object
+type BACnetPointConfig struct {
+	Name     string `mapstructure:"name"`
+	Object   string `mapstructure:"object"`   // type:instance, e.g. analog-input:1
+	Property string `mapstructure:"property"` // Default present-value
+}
+
+// GPIOConfig exposes whitelisted pins of a single-board computer (Linux
+// only) to cmd.gpio, and optionally publishes their states on
+// {prefix}.{code}.telemetry.gpio.
+type GPIOConfig struct {
+	Enabled      bool            `mapstructure:"enabled"`
+	Driver       string          `mapstructure:"driver"`        // gpiod (character device, default) or sysfs (legacy)
+	Chip         string          `mapstructure:"chip"`          // gpiod: default chip (default gpiochip0)
+	PollInterval time.Duration   `mapstructure:"poll_interval"` // 0 = no telemetry
+	Pins         []GPIOPinConfig `mapstructure:"pins"`
+}
+
+// GPIOPinConfig is one pin the agent may use. Values are logical: with
+// active_low, 1 means the line is low.
+type GPIOPinConfig struct {
+	Name      string `mapstructure:"name"`
+	Chip      string `mapstructure:"chip"`      // gpiod: overrides gpio.chip
+	Line      int    `mapstructure:"line"`      // gpiod: offset on the chip; sysfs: global GPIO number
+	Direction string `mapstructure:"direction"` // input or output
+	ActiveLow bool   `mapstructure:"active_low"`
+	Bias      string `mapstructure:"bias"`    // input, gpiod only: pull-up, pull-down or disabled (default: as-is)
+	Initial   int    `mapstructure:"initial"` // output: value when the agent claims the line (0 or 1)
+}
+
+// ComplianceConfig evaluates a baseline of checks and publishes pass/fail
+// per rule on {prefix}.{code}.telemetry.compliance. The baseline is rules,
+// or a KV entry when kv_bucket is set (fetched before every run).
+type ComplianceConfig struct {
+	Enabled  bool             `mapstructure:"enabled"`
+	Interval time.Duration    `mapstructure:"interval"`
+	Timeout  time.Duration    `mapstructure:"timeout"`   // Max run time per execution (0 = interval)
+	KVBucket string           `mapstructure:"kv_bucket"` // Baseline from this KV bucket instead of rules
+	KVKey    string           `mapstructure:"kv_key"`    // Entry holding the baseline as JSON (default baseline)
+	Rules    []ComplianceRule `mapstructure:"rules"`
+}
+
+// ZFSConfig publishes ZFS pool health (state, errors, capacity, scrub age)
+// on {prefix}.{code}.telemetry.zfs, read with the zpool and zfs tools.
+// Linux and FreeBSD only. A pool leaving ONLINE raises a zfs_pool_health
+// event.
+type ZFSConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`  // Max run time per execution (0 = interval)
+	Datasets bool          `mapstructure:"datasets"` // Also report space used per filesystem and volume
+}
+
+// RAIDConfig publishes RAID array health on {prefix}.{code}.telemetry.raid:
+// Linux software RAID from /proc/mdstat, and hardware RAID through the
+// vendor CLI of each controller. An array leaving the ok state raises a
+// raid_health event.
+type RAIDConfig struct {
+	Enabled     bool                   `mapstructure:"enabled"`
+	Interval    time.Duration          `mapstructure:"interval"`
+	Timeout     time.Duration          `mapstructure:"timeout"` // Max run time per execution (0 = interval)
+	MDRaid      bool                   `mapstructure:"mdraid"`  // Linux software RAID (/proc/mdstat)
+	Controllers []RAIDControllerConfig `mapstructure:"controllers"`
+}
+
+// RAIDControllerConfig is a hardware RAID controller read through its
+// vendor CLI
+type RAIDControllerConfig struct {
+	Name    string `mapstructure:"name"`    // Source name in payloads and events
+	Type    string `mapstructure:"type"`    // megacli or ssacli
+	Command string `mapstructure:"command"` // Absolute path to the CLI, e.g. /opt/MegaRAID/MegaCli/MegaCli64
+}
+
+// UPSConfig polls UPS and battery power status: NUT-managed UPSes through
+// upsc, and on Windows the system battery (which includes USB HID UPSes).
+// The latest reading is added to system metrics, and a change (e.g. to on
+// battery) raises a power_change event at the next poll.
+type UPSConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"` // Time between polls; bounds how late a power loss is reported
+	NUT          []string      `mapstructure:"nut"`           // upsc targets: ups[@host[:port]]
+	Battery      bool          `mapstructure:"battery"`       // Windows: the system battery (GetSystemPowerStatus)
+}
+
+// StartupConfig holds startup back until the network is up, for agents
+// that start before the network stack after boot. The agent waits for the
+// NATS servers, the credential bootstrap endpoint and (exporter and hybrid
+// sources) the exporter to resolve and accept connections, then starts
+// either way; NATS still failing after WaitTimeout exits as before.
+type StartupConfig struct {
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"` // 0 = don't wait
+	MaxBackoff  time.Duration `mapstructure:"max_backoff"`  // Retry delay doubles from 1s up to this
+}
+
+// ImmutableConfig runs the agent on a read-only root filesystem (OSTree or
+// other immutable images). With State "data_dir" the log file and secret
+// key default to paths under data_dir, and every path the agent writes is
+// checked for writability at startup. With State "memory" nothing is
+// written: no log file unless one is configured, and state (baselines,
+// crash reports, boot reason, histories) only lasts until the agent stops.
+type ImmutableConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	State   string `mapstructure:"state"` // "data_dir" (default) or "memory"
+}
+
+// ElectionConfig runs tasks on one agent per site. Agents with the same
+// value of tags[tag] elect a leader through a lease key in a NATS KV bucket;
+// the bucket's TTL is the lease, so when the leader stops renewing another
+// agent takes over within about one TTL. Only the leader runs tasks.
+type ElectionConfig struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Bucket  string   `mapstructure:"bucket"` // Existing KV bucket with a TTL (e.g. 30s)
+	Tag     string   `mapstructure:"tag"`    // Tag naming the site
+	Tasks   []string `mapstructure:"tasks"`  // Task names, as in cmd.task.pause (e.g. plugin.snmp)
+}
+
+// ComplianceRule is one baseline check. The json tags are the format of a
+// KV baseline: a JSON array of rules.
+type ComplianceRule struct {
+	ID       string `mapstructure:"id" json:"id"`
+	Title    string `mapstructure:"title" json:"title,omitempty"`
+	Severity string `mapstructure:"severity" json:"severity,omitempty"` // low, medium, high or critical
+	Type     string `mapstructure:"type" json:"type"`                   // file, sysctl, registry, service or password_policy
+	Target   string `mapstructure:"target" json:"target"`               // Path, sysctl key, registry key, service name or policy setting
+	Name     string `mapstructure:"name" json:"name,omitempty"`         // registry: value name (empty = default value)
+	Op       string `mapstructure:"op" json:"op"`                       // See complianceOps
+	Value    string `mapstructure:"value" json:"value,omitempty"`       // Expected value; mode_max: octal, e.g. 0640
+}
+
+// CommandQueueConfig enables delivery of commands through a per-device
+// durable JetStream consumer on {prefix}.{code}.cmdq.>, in addition to
+// Core NATS request/reply, so commands issued while offline still run
+type CommandQueueConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Stream  string        `mapstructure:"stream"` // Existing stream binding {prefix}.*.cmdq.>
+	TTL     time.Duration `mapstructure:"ttl"`    // Older commands are reported as expired, not run (0 = never)
+}
+
+// CommandAuthConfig checks each command against the requester's role. The
+// requester is identified by nkey-signed Agent-* headers ("signed") or by
+// the Nats-Request-Info header the server adds to shared service imports
+// ("request_info"). Every decision is written to the audit log.
+type CommandAuthConfig struct {
+	Enabled     bool                `mapstructure:"enabled"`
+	Identity    string              `mapstructure:"identity"`     // signed or request_info
+	TrustedKeys []string            `mapstructure:"trusted_keys"` // nkey public keys allowed to sign requester headers
+	MaxSkew     time.Duration       `mapstructure:"max_skew"`     // Max age of a signature (plus commands.queue.ttl on a queued command)
+	DefaultRole string              `mapstructure:"default_role"` // Role of requests without identity ("" = denied)
+	Roles       map[string][]string `mapstructure:"roles"`        // Role -> allowed commands ("service", "task.*", "*")
+}
+
+// ReloadPidfile makes cmd.service reload send SIGHUP to the process in
+// Pidfile, for services whose unit or rc.d script has no reload of its
+// own. Only list daemons that reload on SIGHUP; most others exit on it.
+type ReloadPidfile struct {
+	Service string `mapstructure:"service"`
+	Pidfile string `mapstructure:"pidfile"` // Absolute path
+}
+
+// ServiceDependenciesConfig declares dependencies between allowed
+// services, so cmd.service restart of a service also restarts the
+// services depending on it, directly or not, each after its dependencies
+// and once they are running again. Replaces wrapper scripts for app stacks.
+type ServiceDependenciesConfig struct {
+	Services      []ServiceDependency `mapstructure:"services"`
+	VerifyTimeout time.Duration       `mapstructure:"verify_timeout"` // Wait for each restarted service to be running before the next
+}
+
+// ServiceDependency lists the services Service depends on
+type ServiceDependency struct {
+	Service   string   `mapstructure:"service"`
+	DependsOn []string `mapstructure:"depends_on"`
+}
+
+// RateLimitsConfig caps how often each requester may run a command, so an
+// automation bug can't hammer the device with thousands of requests.
+// Requesters are told apart by their authorized identity, or else by their
+// reply inbox; queued commands without identity share one count per queue
+// consumer. Over-limit commands get an error reply with code 429.
+type RateLimitsConfig struct {
+	Enabled bool               `mapstructure:"enabled"`
+	Limits  []CommandRateLimit `mapstructure:"limits"`
+}
+
+// CommandRateLimit is the limit of commands matching Command: a command
+// name, a prefix ending in .* (counted together) or * (each other command)
+type CommandRateLimit struct {
+	Command   string `mapstructure:"command"`
+	PerMinute int    `mapstructure:"per_minute"` // Per requester; 0 = unlimited
+}
+
+// FirewallConfig whitelists what cmd.firewall may change: the profiles it
+// may switch on or off, and pre-approved rules it may add or remove by name
+type FirewallConfig struct {
+	Enabled  bool                 `mapstructure:"enabled"`
+	Backend  string               `mapstructure:"backend"`  // netsh (Windows), nftables or ufw (Linux)
+	Profiles []string             `mapstructure:"profiles"` // netsh: domain, private, public, all; ufw: all (the whole firewall)
+	Table    string               `mapstructure:"table"`    // nftables: inet table holding the agent's rules (default agent)
+	Rules    []FirewallRuleConfig `mapstructure:"rules"`
+}
+
+// FirewallRuleConfig is a rule cmd.firewall may add or remove. The agent
+// tags it with its name (agent-<name> or comment agent:<name>) to find it
+// again.
+type FirewallRuleConfig struct {
+	Name      string `mapstructure:"name"`
+	Direction string `mapstructure:"direction"` // in or out
+	Action    string `mapstructure:"action"`    // allow or block
+	Protocol  string `mapstructure:"protocol"`  // tcp, udp or any
+	Ports     string `mapstructure:"ports"`     // tcp/udp: a port or range, e.g. 22 or 8000-8100 (empty = all)
+	Remote    string `mapstructure:"remote"`    // Remote address or CIDR (empty = any)
+}
+
+// RegistryConfig whitelists the registry keys cmd.registry may read or
+// write (Windows only)
+type RegistryConfig struct {
+	Enabled bool                `mapstructure:"enabled"`
+	Keys    []RegistryKeyConfig `mapstructure:"keys"`
+}
+
+// RegistryKeyConfig is a key cmd.registry may use, including its subkeys
+type RegistryKeyConfig struct {
+	Path   string `mapstructure:"path"`   // Under HKLM or HKU, e.g. HKLM\SOFTWARE\Vendor\App
+	Access string `mapstructure:"access"` // read (get) or write (get, set, delete)
+}
+
+// IISConfig whitelists the IIS app pools and sites cmd.iis may control
+// (Windows only). When enabled, the service check reports their state too.
+type IISConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	AppPools []string `mapstructure:"app_pools"`
+	Sites    []string `mapstructure:"sites"`
+}
+
+// NetTestConfig lists the endpoints cmd.nettest may measure throughput and
+// latency against. Tests are capped at max_duration.
+type NetTestConfig struct {
+	Enabled     bool                  `mapstructure:"enabled"`
+	MaxDuration time.Duration         `mapstructure:"max_duration"` // Longest test (and the default); must leave 5s of commands.timeout
+	Targets     []NetTestTargetConfig `mapstructure:"targets"`
+}
+
+// NetTestTargetConfig is an iperf3 server or an HTTPS download URL
+type NetTestTargetConfig struct {
+	Name    string `mapstructure:"name"`    // Requested by name; the address is never taken from the request
+	Type    string `mapstructure:"type"`    // iperf3 or https
+	Address string `mapstructure:"address"` // iperf3: host[:port] (default port 5201); https: an https:// URL
+}
+
+// TracerouteConfig enables cmd.traceroute. The connected NATS server can
+// always be traced (target "nats"); other hosts must be listed in targets.
+type TracerouteConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	MaxHops      int           `mapstructure:"max_hops"`      // Cap on hops (and the default); 1-64
+	ProbeTimeout time.Duration `mapstructure:"probe_timeout"` // Wait for each probe's reply; 1s-10s
+	Targets      []string      `mapstructure:"targets"`       // Hostnames or IPs that may be traced
+}
+
+// BroadcastConfig serves read-only commands on fleet-wide subjects:
+// {prefix}.broadcast.cmd.<command> reaches every agent, and
+// {prefix}.broadcast.<tag>.<value>.cmd.<command> every agent with that tag
+// value (e.g. a site). Each agent delays its reply by a fixed offset derived
+// from its code, so a requester gathering replies isn't hit all at once.
+type BroadcastConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Commands      []string      `mapstructure:"commands"`        // Commands served fleet-wide: ping, health, logs, traceroute
+	Tags          []string      `mapstructure:"tags"`            // Tags with a per-value subject; skipped if this agent lacks the tag
+	MaxDelay      time.Duration `mapstructure:"max_delay"`       // Replies are spread over [0, max_delay); 0-30s
+	MaxReplyBytes int           `mapstructure:"max_reply_bytes"` // Larger command replies are dropped from the broadcast reply
+}
+
+// DiagConfig enables cmd.diag.bundle: a support archive of recent logs, the
+// redacted config, health and recent telemetry, uploaded to a NATS Object
+// Store bucket
+type DiagConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	Bucket            string `mapstructure:"bucket"`             // Existing Object Store bucket; its TTL bounds how long bundles are kept
+	LogLines          int    `mapstructure:"log_lines"`          // Lines from the end of the agent log; 1-10000
+	TelemetryPayloads int    `mapstructure:"telemetry_payloads"` // Last telemetry payloads kept in memory for bundles; 0-200
 }
 
 // LoggingConfig holds logging settings
@@ -110,6 +787,87 @@ type LoggingConfig struct {
 	File       string `mapstructure:"file"`
 	MaxSizeMB  int    `mapstructure:"max_size_mb"`
 	MaxBackups int    `mapstructure:"max_backups"`
+	MaxAgeDays int    `mapstructure:"max_age_days"` // Rotated files older than this are removed, 0 = keep
+	Compress   bool   `mapstructure:"compress"`     // gzip rotated files
+	Console    bool   `mapstructure:"console"`      // Also log to stdout (off under systemd avoids journal duplicates)
+
+	Ship     LogShipConfig  `mapstructure:"ship"`     // Forward the agent's own log entries to NATS
+	Syslog   SyslogConfig   `mapstructure:"syslog"`   // Local or remote syslog (Linux/FreeBSD)
+	EventLog EventLogConfig `mapstructure:"eventlog"` // Windows Event Log
+}
+
+// SyslogConfig writes log entries to syslog in RFC 5424 format
+type SyslogConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	Level    string `mapstructure:"level"`    // Minimum level written: debug, info, warn, error
+	Facility string `mapstructure:"facility"` // daemon, user, local0-local7, ...
+	Tag      string `mapstructure:"tag"`      // APP-NAME field
+	Network  string `mapstructure:"network"`  // "" (local socket), udp, or tcp
+	Address  string `mapstructure:"address"`  // host:port, required with udp/tcp
+}
+
+// EventLogConfig writes log entries to the Windows Application event log
+type EventLogConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Level   string `mapstructure:"level"`  // Minimum level written: debug, info, warn, error
+	Source  string `mapstructure:"source"` // Event source (registered by the service installer)
+}
+
+// LogShipConfig forwards WARN+ (configurable) log entries to
+// {prefix}.{code}.agentlog as batched events
+type LogShipConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	Level         string        `mapstructure:"level"`          // Minimum level shipped: debug, info, warn, error
+	BatchSize     int           `mapstructure:"batch_size"`     // Max entries per message
+	FlushInterval time.Duration `mapstructure:"flush_interval"` // Max time an entry waits before publishing
+	RateLimit     int           `mapstructure:"rate_limit"`     // Max entries per minute; excess is counted as dropped
+}
+
+// DebugConfig holds the optional runtime debug endpoint (pprof and expvar).
+// Disabled by default; only loopback addresses are accepted because the
+// endpoint is unauthenticated.
+type DebugConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Listen  string `mapstructure:"listen"` // host:port, loopback only
+}
+
+// RuntimeConfig tunes the Go garbage collector and guards the agent's
+// memory use, for devices with little RAM
+type RuntimeConfig struct {
+	MemoryLimitMB     int                  `mapstructure:"memory_limit_mb"`     // Soft heap limit (GOMEMLIMIT); 0 = unset
+	GCPercent         int                  `mapstructure:"gc_percent"`          // GOGC; 0 = unset (Go default 100), -1 = off (needs memory_limit_mb)
+	MaxProcs          int                  `mapstructure:"max_procs"`           // GOMAXPROCS; 0 = unset (one per CPU)
+	MaxConcurrentJobs int                  `mapstructure:"max_concurrent_jobs"` // Scheduled tasks running at once, others wait; 0 = unlimited
+	Watchdog          MemoryWatchdogConfig `mapstructure:"watchdog"`
+	DiskGuard         DiskGuardConfig      `mapstructure:"disk_guard"`
+}
+
+// MemoryWatchdogConfig checks the agent's resident memory against a
+// ceiling. Crossing it logs an error and publishes a memory_limit event; with
+// Restart the agent also shuts down and exits non-zero so the service
+// manager restarts it before the kernel's OOM killer does.
+type MemoryWatchdogConfig struct {
+	RSSLimitMB int           `mapstructure:"rss_limit_mb"` // 0 = disabled
+	Interval   time.Duration `mapstructure:"interval"`
+	Restart    bool          `mapstructure:"restart"`
+}
+
+// DiskGuardConfig checks free space on the volumes holding the agent's log
+// file and data dir. Below MinFreeMB the agent deletes its rotated log
+// backups, stops writing its log file and runtime snapshots, and publishes a
+// disk_low event, so it doesn't fill the disk it is there to monitor.
+// Writes resume once free space is back above 1.5x MinFreeMB.
+type DiskGuardConfig struct {
+	MinFreeMB int           `mapstructure:"min_free_mb"` // 0 = disabled
+	Interval  time.Duration `mapstructure:"interval"`
+}
+
+// ControlConfig holds the local admin channel used by agentctl: a unix
+// socket (mode 0600) or, on Windows, a named pipe restricted to
+// Administrators and SYSTEM. It is never reachable over the network.
+type ControlConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Socket  string `mapstructure:"socket"` // Socket path, or \\.\pipe\<name> on Windows
 }
 
 // Load reads and parses the configuration file
@@ -127,6 +885,12 @@ func Load(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
+	// Profile defaults replace the base defaults, under the file's values
+	if err := applyProfile(v); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	applyImmutable(v)
+
 	// Accept the legacy device_id key as a fallback for code
 	if !v.IsSet("code") && v.IsSet("device_id") {
 		v.Set("code", v.GetString("device_id"))
@@ -153,30 +917,123 @@ func setDefaults(v *viper.Viper) {
 
 	// Subject prefix default
 	v.SetDefault("subject_prefix", "agents")
+	v.SetDefault("profile", ProfileStandard)
+	v.SetDefault("data_dir", defaults.DataDir)
+	v.SetDefault("immutable.enabled", false)
+	v.SetDefault("immutable.state", ImmutableStateDataDir)
+	v.SetDefault("startup.wait_timeout", "2m")
+	v.SetDefault("startup.max_backoff", "15s")
 
 	// NATS defaults
 	v.SetDefault("nats.max_reconnects", -1) // infinite
 	v.SetDefault("nats.reconnect_wait", "2s")
 	v.SetDefault("nats.drain_timeout", "30s")
+	v.SetDefault("nats.publish_limits.max_per_minute", 0) // unlimited
+	v.SetDefault("nats.publish_limits.queue_size", 100)
+	v.SetDefault("nats.publish_limits.drop_policy", "oldest")
+	v.SetDefault("nats.compression.enabled", true)
+	v.SetDefault("nats.compression.inventory", false)
+	v.SetDefault("nats.compression.min_bytes", 1024)
+
+	// TLS hot-reload: check cert files every minute
+	v.SetDefault("nats.tls.reload_interval", "1m")
+
+	// Secret storage: plaintext unless configured; the encrypted store's key
+	// lives next to the config, readable by root only
+	v.SetDefault("nats.auth.secret_store", "file")
+	v.SetDefault("nats.auth.secret_key_file", filepath.Join(filepath.Dir(defaults.ConfigPath), "secrets.key"))
+
+	// Credential refresh disabled by default
+	v.SetDefault("nats.auth.refresh_interval", "0s")
+
+	// Registration defaults
+	v.SetDefault("nats.auth.pocketbase.registration.enabled", false)
+	v.SetDefault("nats.auth.pocketbase.registration.collection", "registrations")
+	v.SetDefault("nats.auth.pocketbase.registration.poll_interval", "30s")
+	v.SetDefault("nats.auth.pocketbase.registration.timeout", "1h")
+
+	// Vault bootstrap defaults
+	v.SetDefault("nats.auth.vault.token_path", "/var/run/secrets/kubernetes.io/serviceaccount/token")
+	v.SetDefault("nats.auth.vault.secret_field", "creds")
+	v.SetDefault("nats.auth.vault.secret_type", "creds")
+
+	// HTTP bootstrap defaults
+	v.SetDefault("nats.auth.http.method", "GET")
 
 	// TLS defaults
 	v.SetDefault("nats.tls.enabled", false)
 	v.SetDefault("nats.tls.insecure_skip_verify", false)
 
+	// Scheduling spread defaults (disabled; fleets should opt in)
+	v.SetDefault("tasks.splay", "0s")
+	v.SetDefault("tasks.jitter", "0s")
+	v.SetDefault("tasks.timezone", "UTC")
+
 	// Task defaults with platform-specific exporter URL
 	v.SetDefault("tasks.heartbeat.enabled", true)
 	v.SetDefault("tasks.heartbeat.interval", "1m")
+	v.SetDefault("tasks.heartbeat.timeout", "10s")
+	v.SetDefault("tasks.heartbeat.fast_interval", "10s")
+	v.SetDefault("tasks.heartbeat.time_sync", false)
 	v.SetDefault("tasks.system_metrics.enabled", true)
 	v.SetDefault("tasks.system_metrics.interval", "5m")
+	v.SetDefault("tasks.system_metrics.timeout", "30s")
 	v.SetDefault("tasks.system_metrics.source", "builtin") // Default to builtin (gopsutil)
 	v.SetDefault("tasks.system_metrics.exporter_url", defaults.ExporterURL)
+	v.SetDefault("tasks.system_metrics.cpu_sample_interval", "0s")
+	v.SetDefault("tasks.system_metrics.disk_io", true)
+	v.SetDefault("tasks.system_metrics.retry.attempts", 2)
+	v.SetDefault("tasks.system_metrics.retry.backoff", "5s")
+	v.SetDefault("tasks.system_metrics.disk_forecast.enabled", false)
+	v.SetDefault("tasks.system_metrics.disk_forecast.window", "24h")
+	v.SetDefault("tasks.system_metrics.disk_forecast.horizon", "72h")
+	v.SetDefault("tasks.system_metrics.disk_forecast.min_samples", 12)
+	v.SetDefault("tasks.system_metrics.fallback.enabled", false)
+	v.SetDefault("tasks.system_metrics.fallback.failures", 3)
+	v.SetDefault("tasks.system_metrics.fallback.retry_interval", "15m")
+	v.SetDefault("tasks.system_metrics.remote_write.enabled", false)
+	v.SetDefault("tasks.system_metrics.remote_write.timeout", "10s")
 	v.SetDefault("tasks.service_check.enabled", true)
 	v.SetDefault("tasks.service_check.interval", "1m")
+	v.SetDefault("tasks.service_check.timeout", "1m")
+	v.SetDefault("tasks.service_check.availability", false)
 	v.SetDefault("tasks.inventory.enabled", true)
 	v.SetDefault("tasks.inventory.interval", "24h")
+	v.SetDefault("tasks.inventory.timeout", "2m")
+	v.SetDefault("tasks.inventory.neighbors", false)
+	v.SetDefault("tasks.inventory.retry.attempts", 2)
+	v.SetDefault("tasks.inventory.retry.backoff", "10s")
 
 	// Command defaults with platform-specific scripts directory
 	v.SetDefault("commands.timeout", "30s")
+	v.SetDefault("commands.max_output_bytes", 1024*1024)
+	v.SetDefault("commands.queue.enabled", false)
+	v.SetDefault("commands.queue.stream", "AGENT_COMMANDS")
+	v.SetDefault("commands.queue.ttl", "24h")
+	v.SetDefault("commands.authorization.enabled", false)
+	v.SetDefault("commands.authorization.identity", "signed")
+	v.SetDefault("commands.authorization.max_skew", "5m")
+	v.SetDefault("commands.firewall.enabled", false)
+	v.SetDefault("commands.firewall.backend", defaults.FirewallBackend)
+	v.SetDefault("commands.firewall.table", "agent")
+	v.SetDefault("commands.registry.enabled", false)
+	v.SetDefault("commands.iis.enabled", false)
+	v.SetDefault("commands.nettest.enabled", false)
+	v.SetDefault("commands.nettest.max_duration", "10s")
+	v.SetDefault("commands.traceroute.enabled", false)
+	v.SetDefault("commands.traceroute.max_hops", 30)
+	v.SetDefault("commands.traceroute.probe_timeout", "2s")
+	v.SetDefault("commands.diag.enabled", false)
+	v.SetDefault("commands.diag.bucket", "agent_diag")
+	v.SetDefault("commands.diag.log_lines", 500)
+	v.SetDefault("commands.diag.telemetry_payloads", 20)
+	v.SetDefault("commands.rate_limits.enabled", false)
+	v.SetDefault("commands.service_dependencies.verify_timeout", "30s")
+	v.SetDefault("commands.broadcast.enabled", false)
+	v.SetDefault("commands.broadcast.commands", []string{"ping", "health"})
+	v.SetDefault("commands.broadcast.tags", []string{"site"})
+	v.SetDefault("commands.broadcast.max_delay", "2s")
+	v.SetDefault("commands.broadcast.max_reply_bytes", 16384)
 	v.SetDefault("commands.scripts_directory", defaults.ScriptsDirectory)
 
 	// Logging defaults with platform-specific log file path
@@ -184,6 +1041,84 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("logging.file", defaults.LogFile)
 	v.SetDefault("logging.max_size_mb", 100)
 	v.SetDefault("logging.max_backups", 3)
+	v.SetDefault("logging.max_age_days", 28)
+	v.SetDefault("logging.compress", true)
+	v.SetDefault("logging.console", true)
+	v.SetDefault("logging.ship.enabled", false)
+	v.SetDefault("logging.ship.level", "warn")
+	v.SetDefault("logging.ship.batch_size", 50)
+	v.SetDefault("logging.ship.flush_interval", "10s")
+	v.SetDefault("logging.ship.rate_limit", 120)
+	v.SetDefault("logging.syslog.enabled", false)
+	v.SetDefault("logging.syslog.level", "info")
+	v.SetDefault("logging.syslog.facility", "daemon")
+	v.SetDefault("logging.syslog.tag", "agent")
+	v.SetDefault("logging.eventlog.enabled", false)
+	v.SetDefault("logging.eventlog.level", "warn")
+	v.SetDefault("logging.eventlog.source", "agent")
+
+	// Debug endpoint defaults
+	v.SetDefault("debug.enabled", false)
+	v.SetDefault("debug.listen", "127.0.0.1:6060")
+
+	// Runtime defaults (GC tuning unset, watchdog disabled, disk guard on)
+	v.SetDefault("runtime.memory_limit_mb", 0)
+	v.SetDefault("runtime.gc_percent", 0)
+	v.SetDefault("runtime.max_procs", 0)
+	v.SetDefault("runtime.max_concurrent_jobs", 0)
+	v.SetDefault("runtime.watchdog.rss_limit_mb", 0)
+	v.SetDefault("runtime.watchdog.interval", "30s")
+	v.SetDefault("runtime.watchdog.restart", false)
+	v.SetDefault("runtime.disk_guard.min_free_mb", 100)
+	v.SetDefault("runtime.disk_guard.interval", "1m")
+
+	// Local admin channel defaults
+	v.SetDefault("control.enabled", true)
+	v.SetDefault("control.socket", defaults.ControlSocket)
+
+	// MQTT bridge defaults
+	v.SetDefault("mqtt.enabled", false)
+	v.SetDefault("mqtt.keep_alive", "60s")
+
+	// BACnet defaults
+	v.SetDefault("bacnet.enabled", false)
+	v.SetDefault("bacnet.listen", ":47808")
+	v.SetDefault("bacnet.broadcast", "255.255.255.255:47808")
+	v.SetDefault("bacnet.timeout", "3s")
+	v.SetDefault("bacnet.discovery_interval", "1h")
+	v.SetDefault("bacnet.discovery_timeout", "5s")
+
+	// GPIO defaults
+	v.SetDefault("gpio.enabled", false)
+	v.SetDefault("gpio.driver", "gpiod")
+	v.SetDefault("gpio.chip", "gpiochip0")
+	v.SetDefault("gpio.poll_interval", "0s")
+
+	// Compliance defaults
+	v.SetDefault("compliance.enabled", false)
+	v.SetDefault("compliance.interval", "6h")
+	v.SetDefault("compliance.timeout", "0s")
+	v.SetDefault("compliance.kv_key", "baseline")
+
+	// ZFS defaults
+	v.SetDefault("zfs.enabled", false)
+	v.SetDefault("zfs.interval", "5m")
+	v.SetDefault("zfs.timeout", "0s")
+	v.SetDefault("zfs.datasets", false)
+
+	// RAID defaults
+	v.SetDefault("raid.enabled", false)
+	v.SetDefault("raid.interval", "5m")
+	v.SetDefault("raid.timeout", "0s")
+	v.SetDefault("raid.mdraid", false)
+
+	// UPS defaults
+	v.SetDefault("ups.enabled", false)
+	v.SetDefault("ups.poll_interval", "10s")
+	v.SetDefault("ups.battery", false)
+	v.SetDefault("election.enabled", false)
+	v.SetDefault("election.bucket", "agent_election")
+	v.SetDefault("election.tag", "site")
 }
 
 // validate checks that required fields are present and valid
@@ -207,6 +1142,21 @@ func validate(cfg *Config) error {
 		return fmt.Errorf("location must contain only alphanumeric characters, dashes, and underscores (got: %s)", cfg.Location)
 	}
 
+	if err := validateTags(cfg.Tags); err != nil {
+		return fmt.Errorf("invalid tags: %w", err)
+	}
+
+	if _, ok := profileDefaults[cfg.Profile]; cfg.Profile != "" && !ok {
+		return fmt.Errorf("unknown profile: %s (must be one of: %s)", cfg.Profile, strings.Join(profileNames(), ", "))
+	}
+
+	if err := validateImmutable(cfg); err != nil {
+		return fmt.Errorf("invalid immutable config: %w", err)
+	}
+	if err := validateStartup(&cfg.Startup); err != nil {
+		return fmt.Errorf("invalid startup config: %w", err)
+	}
+
 	// Validate subject_prefix format
 	// Allows hierarchical prefixes like "region.dev.agents" or simple prefixes like "agents"
 	if cfg.SubjectPrefix == "" {
@@ -248,6 +1198,42 @@ func validate(cfg *Config) error {
 		if pb.PasswordEnv == "" {
 			return fmt.Errorf("pocketbase.password_env is required for pocketbase auth type")
 		}
+		if reg := pb.Registration; reg.Enabled {
+			if reg.Collection == "" {
+				return fmt.Errorf("pocketbase.registration.collection is required when registration is enabled")
+			}
+			if reg.PollInterval < 5*time.Second {
+				return fmt.Errorf("pocketbase.registration.poll_interval must be at least 5s (got: %v)", reg.PollInterval)
+			}
+			if reg.Timeout < reg.PollInterval {
+				return fmt.Errorf("pocketbase.registration.timeout must be at least poll_interval (got: %v)", reg.Timeout)
+			}
+		}
+		// .creds file may not exist yet — bootstrap will create it
+	case "nkey":
+		if cfg.NATS.Auth.NkeyFile == "" {
+			return fmt.Errorf("nkey_file is required for nkey auth type")
+		}
+		if _, err := os.Stat(cfg.NATS.Auth.NkeyFile); err != nil {
+			return fmt.Errorf("nkey seed file not found: %s (%w)", cfg.NATS.Auth.NkeyFile, err)
+		}
+	case "vault":
+		if err := validateVaultAuth(&cfg.NATS.Auth); err != nil {
+			return err
+		}
+		// Target file may not exist yet — bootstrap will create it
+	case "http":
+		if cfg.NATS.Auth.CredsFile == "" {
+			return fmt.Errorf("creds_file is required for http auth type (path where .creds will be written)")
+		}
+		if cfg.NATS.Auth.HTTP.URL == "" {
+			return fmt.Errorf("http.url is required for http auth type")
+		}
+		switch strings.ToUpper(cfg.NATS.Auth.HTTP.Method) {
+		case "", "GET", "POST", "PUT":
+		default:
+			return fmt.Errorf("invalid http.method: %s (must be GET, POST, or PUT)", cfg.NATS.Auth.HTTP.Method)
+		}
 		// .creds file may not exist yet — bootstrap will create it
 	case "token":
 		if cfg.NATS.Auth.Token == "" {
@@ -260,7 +1246,50 @@ func validate(cfg *Config) error {
 	case "none":
 		// No validation needed
 	default:
-		return fmt.Errorf("invalid auth type: %s (must be creds, token, userpass, pocketbase, or none)", cfg.NATS.Auth.Type)
+		return fmt.Errorf("invalid auth type: %s (must be creds, nkey, token, userpass, pocketbase, vault, http, or none)", cfg.NATS.Auth.Type)
+	}
+
+	switch cfg.NATS.Auth.SecretStore {
+	case "", "file":
+	case "dpapi":
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("secret_store dpapi is only supported on Windows")
+		}
+	case "encrypted":
+		if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+			return fmt.Errorf("secret_store encrypted is only supported on Linux and FreeBSD (use dpapi on Windows)")
+		}
+		if cfg.NATS.Auth.SecretKeyFile == "" {
+			return fmt.Errorf("secret_key_file is required for secret_store encrypted")
+		}
+	default:
+		return fmt.Errorf("invalid secret_store: %s (must be file, dpapi, or encrypted)", cfg.NATS.Auth.SecretStore)
+	}
+
+	if refresh := cfg.NATS.Auth.RefreshInterval; refresh != 0 {
+		switch cfg.NATS.Auth.Type {
+		case "pocketbase", "vault", "http":
+		default:
+			return fmt.Errorf("refresh_interval requires a bootstrapped auth type (pocketbase, vault, or http), got: %s", cfg.NATS.Auth.Type)
+		}
+		if refresh < 5*time.Minute {
+			return fmt.Errorf("refresh_interval must be 0 (disabled) or at least 5m (got: %v)", refresh)
+		}
+	}
+
+	// Validate bootstrap HTTP client TLS
+	if bt := cfg.NATS.Auth.BootstrapTLS; bt != (BootstrapTLSConfig{}) {
+		if (bt.CertFile == "") != (bt.KeyFile == "") {
+			return fmt.Errorf("bootstrap_tls.cert_file and bootstrap_tls.key_file must be specified together")
+		}
+		for _, f := range []string{bt.CAFile, bt.CertFile, bt.KeyFile} {
+			if f == "" {
+				continue
+			}
+			if _, err := os.Stat(f); err != nil {
+				return fmt.Errorf("bootstrap TLS file not found: %s (%w)", f, err)
+			}
+		}
 	}
 
 	// Validate TLS configuration
@@ -290,10 +1319,68 @@ func validate(cfg *Config) error {
 			}
 		}
 
+		if cfg.NATS.TLS.ReloadInterval != 0 && cfg.NATS.TLS.ReloadInterval < 10*time.Second {
+			return fmt.Errorf("tls.reload_interval must be 0 (disabled) or at least 10s (got: %v)", cfg.NATS.TLS.ReloadInterval)
+		}
+
 		// Note: InsecureSkipVerify is allowed for development/testing.
 		// A warning is logged during NATS connection setup in nats/client.go.
 	}
 
+	if cfg.NATS.TLS.HandshakeFirst && !cfg.NATS.TLS.Enabled {
+		return fmt.Errorf("tls.handshake_first requires tls.enabled")
+	}
+
+	// Validate outbound buffering (0 = nats.go default)
+	if cfg.NATS.ReconnectBufSizeMB < 0 || cfg.NATS.ReconnectBufSizeMB > 1024 {
+		return fmt.Errorf("reconnect_buf_size_mb must be between 0 and 1024 (got: %d)", cfg.NATS.ReconnectBufSizeMB)
+	}
+	if cfg.NATS.FlusherTimeout != 0 && cfg.NATS.FlusherTimeout < time.Second {
+		return fmt.Errorf("flusher_timeout must be 0 (default) or at least 1s (got: %v)", cfg.NATS.FlusherTimeout)
+	}
+	if limits := cfg.NATS.PendingLimits; limits.Publishes < 0 || limits.Messages < 0 || limits.BytesMB < 0 {
+		return fmt.Errorf("pending_limits values cannot be negative (got: publishes=%d messages=%d bytes_mb=%d)",
+			limits.Publishes, limits.Messages, limits.BytesMB)
+	}
+	if cfg.NATS.PendingLimits.BytesMB > 1024 {
+		return fmt.Errorf("pending_limits.bytes_mb must be at most 1024 (got: %d)", cfg.NATS.PendingLimits.BytesMB)
+	}
+
+	if cfg.NATS.JetStreamDomain != "" {
+		validDomain := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+		if !validDomain.MatchString(cfg.NATS.JetStreamDomain) {
+			return fmt.Errorf("jetstream_domain must contain only alphanumeric characters, dashes, and underscores (got: %q)", cfg.NATS.JetStreamDomain)
+		}
+	}
+
+	// Validate telemetry publish limits (0 = unlimited)
+	if limits := cfg.NATS.PublishLimits; limits.MaxPerMinute != 0 {
+		if limits.MaxPerMinute < 0 || limits.MaxPerMinute > 6000 {
+			return fmt.Errorf("publish_limits.max_per_minute must be between 0 and 6000 (got: %d)", limits.MaxPerMinute)
+		}
+		if limits.QueueSize < 1 || limits.QueueSize > 10000 {
+			return fmt.Errorf("publish_limits.queue_size must be between 1 and 10000 (got: %d)", limits.QueueSize)
+		}
+		if limits.DropPolicy != "oldest" && limits.DropPolicy != "newest" {
+			return fmt.Errorf("invalid publish_limits.drop_policy: %s (must be oldest or newest)", limits.DropPolicy)
+		}
+	}
+
+	if cfg.NATS.Compression.MinBytes < 0 {
+		return fmt.Errorf("compression.min_bytes must not be negative (got: %d)", cfg.NATS.Compression.MinBytes)
+	}
+
+	// Validate keepalive tuning (0 = nats.go default)
+	if cfg.NATS.PingInterval != 0 && cfg.NATS.PingInterval < time.Second {
+		return fmt.Errorf("ping_interval must be 0 (default) or at least 1s (got: %v)", cfg.NATS.PingInterval)
+	}
+	if cfg.NATS.MaxPingsOut < 0 || cfg.NATS.MaxPingsOut > 100 {
+		return fmt.Errorf("max_pings_out must be between 0 and 100 (got: %d)", cfg.NATS.MaxPingsOut)
+	}
+	if cfg.NATS.ConnectTimeout != 0 && cfg.NATS.ConnectTimeout < 100*time.Millisecond {
+		return fmt.Errorf("connect_timeout must be 0 (default) or at least 100ms (got: %v)", cfg.NATS.ConnectTimeout)
+	}
+
 	// Validate scripts directory if specified
 	if cfg.Commands.ScriptsDirectory != "" {
 		// Verify directory exists
@@ -306,51 +1393,429 @@ func validate(cfg *Config) error {
 		}
 	}
 
+	// Validate serial command ports
+	seenPorts := make(map[string]bool)
+	for i, port := range cfg.Commands.SerialPorts {
+		if port.Device == "" {
+			return fmt.Errorf("commands.serial_ports[%d].device is required", i)
+		}
+		if seenPorts[port.Device] {
+			return fmt.Errorf("duplicate commands.serial_ports device: %s", port.Device)
+		}
+		seenPorts[port.Device] = true
+		if err := validateSerial(port); err != nil {
+			return fmt.Errorf("commands.serial_ports[%d].%w", i, err)
+		}
+	}
+
 	// Validate service check has services if enabled
 	if cfg.Tasks.ServiceCheck.Enabled && len(cfg.Tasks.ServiceCheck.Services) == 0 {
 		return fmt.Errorf("at least one service must be specified when service_check is enabled")
 	}
 
+	if _, err := LoadTimezone(cfg.Tasks.Timezone); err != nil {
+		return fmt.Errorf("tasks.timezone: %w", err)
+	}
+	if cfg.Tasks.Inventory.Enabled && cfg.Tasks.Inventory.Schedule != "" {
+		if err := validateSchedule(cfg.Tasks.Inventory.Schedule); err != nil {
+			return fmt.Errorf("inventory schedule: %w", err)
+		}
+	}
+
 	// Validate task intervals are sensible
 	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.Heartbeat.Interval < 10*time.Second {
 		return fmt.Errorf("heartbeat interval must be at least 10 seconds (got: %v)", cfg.Tasks.Heartbeat.Interval)
 	}
+	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.Heartbeat.FastInterval != 0 {
+		if cfg.Tasks.Heartbeat.FastInterval < time.Second || cfg.Tasks.Heartbeat.FastInterval > cfg.Tasks.Heartbeat.Interval {
+			return fmt.Errorf("heartbeat fast_interval must be 0 or between 1s and the heartbeat interval (got: %v)", cfg.Tasks.Heartbeat.FastInterval)
+		}
+	}
 
 	if cfg.Tasks.SystemMetrics.Enabled && cfg.Tasks.SystemMetrics.Interval < 30*time.Second {
 		return fmt.Errorf("system_metrics interval must be at least 30 seconds (got: %v)", cfg.Tasks.SystemMetrics.Interval)
 	}
 
-	// Validate metrics source
-	if cfg.Tasks.SystemMetrics.Enabled {
-		source := strings.ToLower(cfg.Tasks.SystemMetrics.Source)
-		if source == "" {
-			source = "builtin" // Default
+	// Validate per-task timeouts. A timeout longer than the interval would let
+	// a hung run overlap the next tick, which is what the timeout prevents.
+	for _, t := range []struct {
+		name     string
+		enabled  bool
+		interval time.Duration
+		timeout  time.Duration
+	}{
+		{"heartbeat", cfg.Tasks.Heartbeat.Enabled, cfg.Tasks.Heartbeat.Interval, cfg.Tasks.Heartbeat.Timeout},
+		{"system_metrics", cfg.Tasks.SystemMetrics.Enabled, cfg.Tasks.SystemMetrics.Interval, cfg.Tasks.SystemMetrics.Timeout},
+		{"service_check", cfg.Tasks.ServiceCheck.Enabled, cfg.Tasks.ServiceCheck.Interval, cfg.Tasks.ServiceCheck.Timeout},
+		{"inventory", cfg.Tasks.Inventory.Enabled, cfg.Tasks.Inventory.Interval, cfg.Tasks.Inventory.Timeout},
+	} {
+		if !t.enabled {
+			continue
 		}
-		if source != "builtin" && source != "exporter" {
-			return fmt.Errorf("invalid system_metrics.source: %s (must be 'builtin' or 'exporter')", cfg.Tasks.SystemMetrics.Source)
+		if t.timeout < 0 {
+			return fmt.Errorf("%s timeout must not be negative (got: %v)", t.name, t.timeout)
 		}
-		// If exporter mode, URL is required
-		if source == "exporter" && cfg.Tasks.SystemMetrics.ExporterURL == "" {
-			return fmt.Errorf("exporter_url is required when system_metrics.source is 'exporter'")
+		if t.timeout > t.interval {
+			return fmt.Errorf("%s timeout (%v) must not exceed its interval (%v)", t.name, t.timeout, t.interval)
 		}
 	}
 
-	// Validate heartbeat is more frequent than metrics (best practice)
-	// Heartbeat should be MORE frequent, meaning a SMALLER interval duration
-	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.SystemMetrics.Enabled {
-		if cfg.Tasks.Heartbeat.Interval > cfg.Tasks.SystemMetrics.Interval {
-			return fmt.Errorf("heartbeat interval (%v) should be less than or equal to metrics interval (%v) - heartbeat should be more frequent",
-				cfg.Tasks.Heartbeat.Interval, cfg.Tasks.SystemMetrics.Interval)
+	// Validate retries; they run within the task timeout
+	for _, t := range []struct {
+		name    string
+		enabled bool
+		retry   RetryConfig
+		window  time.Duration
+	}{
+		{"system_metrics", cfg.Tasks.SystemMetrics.Enabled, cfg.Tasks.SystemMetrics.Retry, taskWindow(cfg.Tasks.SystemMetrics.Interval, cfg.Tasks.SystemMetrics.Timeout)},
+		{"inventory", cfg.Tasks.Inventory.Enabled, cfg.Tasks.Inventory.Retry, taskWindow(cfg.Tasks.Inventory.Interval, cfg.Tasks.Inventory.Timeout)},
+	} {
+		if !t.enabled {
+			continue
+		}
+		if err := validateRetry(t.retry, t.window); err != nil {
+			return fmt.Errorf("%s.retry.%w", t.name, err)
 		}
 	}
 
-	// Validate command timeout
-	if cfg.Commands.Timeout < 5*time.Second {
+	// Validate metrics source
+	if cfg.Tasks.SystemMetrics.Enabled {
+		source := strings.ToLower(cfg.Tasks.SystemMetrics.Source)
+		if source == "" {
+			source = "builtin" // Default
+		}
+		if source != "builtin" && source != "exporter" && source != "hybrid" && source != "pdh" {
+			return fmt.Errorf("invalid system_metrics.source: %s (must be 'builtin', 'exporter', 'hybrid' or 'pdh')", cfg.Tasks.SystemMetrics.Source)
+		}
+		// If exporter or hybrid mode, URL is required
+		if (source == "exporter" || source == "hybrid") && cfg.Tasks.SystemMetrics.ExporterURL == "" {
+			return fmt.Errorf("exporter_url is required when system_metrics.source is '%s'", source)
+		}
+		if exporterURL := cfg.Tasks.SystemMetrics.ExporterURL; exporterURL != "" {
+			if err := validateExporterURL(exporterURL); err != nil {
+				return fmt.Errorf("system_metrics.%w", err)
+			}
+		}
+		if cfg.Tasks.SystemMetrics.TopProcesses < 0 || cfg.Tasks.SystemMetrics.TopProcesses > 50 {
+			return fmt.Errorf("system_metrics.top_processes must be between 0 and 50 (got: %d)", cfg.Tasks.SystemMetrics.TopProcesses)
+		}
+		if sample := cfg.Tasks.SystemMetrics.CPUSampleInterval; sample != 0 {
+			if sample < time.Second || sample >= cfg.Tasks.SystemMetrics.Interval {
+				return fmt.Errorf("system_metrics.cpu_sample_interval must be at least 1s and less than the interval (got: %v)", sample)
+			}
+		}
+		if source == "hybrid" {
+			if len(cfg.Tasks.SystemMetrics.ExtraFamilies) == 0 {
+				return fmt.Errorf("extra_families is required when system_metrics.source is 'hybrid'")
+			}
+			validFamily := regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+			for _, family := range cfg.Tasks.SystemMetrics.ExtraFamilies {
+				if !validFamily.MatchString(family) {
+					return fmt.Errorf("invalid system_metrics.extra_families entry %q (must be a Prometheus metric name)", family)
+				}
+			}
+		}
+		if len(cfg.Tasks.SystemMetrics.Cgroups) > 0 {
+			if err := validateCgroups(cfg.Tasks.SystemMetrics.Cgroups); err != nil {
+				return fmt.Errorf("system_metrics.%w", err)
+			}
+		}
+		if source == "pdh" {
+			if err := validateCounters(cfg.Tasks.SystemMetrics.Counters); err != nil {
+				return fmt.Errorf("system_metrics.%w", err)
+			}
+		}
+		for _, patterns := range [][]string{cfg.Tasks.SystemMetrics.IncludeDisks, cfg.Tasks.SystemMetrics.ExcludeDisks} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("invalid system_metrics disk pattern %q: %w", pattern, err)
+				}
+			}
+		}
+		if err := validateExporterRequest(&cfg.Tasks.SystemMetrics.ExporterRequest); err != nil {
+			return fmt.Errorf("system_metrics.exporter_request.%w", err)
+		}
+		if err := validateExporterTLS(&cfg.Tasks.SystemMetrics); err != nil {
+			return fmt.Errorf("system_metrics.exporter_tls.%w", err)
+		}
+		if cfg.Tasks.SystemMetrics.Fallback.Enabled {
+			if err := validateExporterFallback(&cfg.Tasks.SystemMetrics); err != nil {
+				return fmt.Errorf("system_metrics.fallback.%w", err)
+			}
+		}
+		if cfg.Tasks.SystemMetrics.DiskForecast.Enabled {
+			if err := validateDiskForecast(&cfg.Tasks.SystemMetrics.DiskForecast, cfg.Tasks.SystemMetrics.Interval); err != nil {
+				return fmt.Errorf("system_metrics.disk_forecast.%w", err)
+			}
+		}
+		if cfg.Tasks.SystemMetrics.RemoteWrite.Enabled {
+			if err := validateRemoteWrite(&cfg.Tasks.SystemMetrics); err != nil {
+				return fmt.Errorf("system_metrics.remote_write.%w", err)
+			}
+		}
+	}
+
+	// Validate heartbeat is more frequent than metrics (best practice)
+	// Heartbeat should be MORE frequent, meaning a SMALLER interval duration
+	if cfg.Tasks.Heartbeat.Enabled && cfg.Tasks.SystemMetrics.Enabled {
+		if cfg.Tasks.Heartbeat.Interval > cfg.Tasks.SystemMetrics.Interval {
+			return fmt.Errorf("heartbeat interval (%v) should be less than or equal to metrics interval (%v) - heartbeat should be more frequent",
+				cfg.Tasks.Heartbeat.Interval, cfg.Tasks.SystemMetrics.Interval)
+		}
+	}
+
+	// Validate scheduling spread. Jitter is applied symmetrically around each
+	// interval, so it must stay below half of the shortest enabled interval or
+	// a task could be rescheduled with a zero or negative delay.
+	if cfg.Tasks.Splay < 0 {
+		return fmt.Errorf("tasks.splay must not be negative (got: %v)", cfg.Tasks.Splay)
+	}
+	if cfg.Tasks.Splay > time.Hour {
+		return fmt.Errorf("tasks.splay must not exceed 1 hour (got: %v)", cfg.Tasks.Splay)
+	}
+	if cfg.Tasks.Jitter < 0 {
+		return fmt.Errorf("tasks.jitter must not be negative (got: %v)", cfg.Tasks.Jitter)
+	}
+	if cfg.Tasks.Jitter > 0 {
+		if shortest := shortestTaskInterval(&cfg.Tasks); shortest > 0 && cfg.Tasks.Jitter >= shortest/2 {
+			return fmt.Errorf("tasks.jitter (%v) must be less than half of the shortest enabled task interval (%v)",
+				cfg.Tasks.Jitter, shortest)
+		}
+	}
+
+	// Validate command timeout
+	if cfg.Commands.Timeout < 5*time.Second {
 		return fmt.Errorf("command timeout must be at least 5 seconds (got: %v)", cfg.Commands.Timeout)
 	}
 	if cfg.Commands.Timeout > 5*time.Minute {
 		return fmt.Errorf("command timeout must not exceed 5 minutes (got: %v)", cfg.Commands.Timeout)
 	}
+	// Capped so an exec reply (both streams, JSON-escaped) stays well within
+	// the chunked reply limit
+	if n := cfg.Commands.MaxOutputBytes; n < 0 || (n > 0 && n < 1024) || n > 8*1024*1024 {
+		return fmt.Errorf("commands.max_output_bytes must be between 1024 and 8388608 (got: %d)", n)
+	}
+
+	// Validate durable command queue
+	if cfg.Commands.Queue.Enabled {
+		validStream := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+		if !validStream.MatchString(cfg.Commands.Queue.Stream) {
+			return fmt.Errorf("commands.queue.stream must contain only alphanumeric characters, dashes, and underscores (got: %q)", cfg.Commands.Queue.Stream)
+		}
+		if cfg.Commands.Queue.TTL < 0 {
+			return fmt.Errorf("commands.queue.ttl cannot be negative (got: %v)", cfg.Commands.Queue.TTL)
+		}
+	}
+
+	if cfg.Commands.Authorization.Enabled {
+		if err := validateCommandAuth(&cfg.Commands.Authorization); err != nil {
+			return fmt.Errorf("commands.authorization.%w", err)
+		}
+	}
+
+	if cfg.Commands.Registry.Enabled {
+		if err := validateRegistry(&cfg.Commands.Registry); err != nil {
+			return fmt.Errorf("commands.registry.%w", err)
+		}
+	}
+
+	if cfg.Commands.IIS.Enabled {
+		if err := validateIIS(&cfg.Commands.IIS); err != nil {
+			return fmt.Errorf("commands.iis.%w", err)
+		}
+	}
+
+	if cfg.Commands.NetTest.Enabled {
+		if err := validateNetTest(&cfg.Commands.NetTest, cfg.Commands.Timeout); err != nil {
+			return fmt.Errorf("commands.nettest.%w", err)
+		}
+	}
+
+	if cfg.Commands.Traceroute.Enabled {
+		if err := validateTraceroute(&cfg.Commands.Traceroute, cfg.Commands.Timeout); err != nil {
+			return fmt.Errorf("commands.traceroute.%w", err)
+		}
+	}
+
+	if cfg.Commands.Diag.Enabled {
+		if err := validateDiag(&cfg.Commands.Diag); err != nil {
+			return fmt.Errorf("commands.diag.%w", err)
+		}
+	}
+
+	if cfg.Commands.Broadcast.Enabled {
+		if err := validateBroadcast(cfg); err != nil {
+			return fmt.Errorf("commands.broadcast.%w", err)
+		}
+	}
+
+	if len(cfg.Commands.ReloadPidfiles) > 0 {
+		if err := validateReloadPidfiles(&cfg.Commands); err != nil {
+			return fmt.Errorf("commands.%w", err)
+		}
+	}
+
+	if len(cfg.Commands.ServiceDependencies.Services) > 0 {
+		if err := validateServiceDependencies(&cfg.Commands); err != nil {
+			return fmt.Errorf("commands.service_dependencies.%w", err)
+		}
+	}
+
+	if cfg.Commands.RateLimits.Enabled {
+		if err := validateRateLimits(&cfg.Commands.RateLimits); err != nil {
+			return fmt.Errorf("commands.rate_limits.%w", err)
+		}
+	}
+
+	if len(cfg.Commands.AllowedScheduledTasks) > 0 {
+		if err := validateScheduledTasks(cfg.Commands.AllowedScheduledTasks); err != nil {
+			return fmt.Errorf("commands.%w", err)
+		}
+	}
+
+	if cfg.Commands.Firewall.Enabled {
+		if err := validateFirewall(&cfg.Commands.Firewall); err != nil {
+			return fmt.Errorf("commands.firewall.%w", err)
+		}
+	}
+
+	// Plugins used by gateway children need no interval or command of their own
+	childPlugins := make(map[string]bool)
+	for _, child := range cfg.Gateway.Children {
+		childPlugins[child.Plugin] = true
+	}
+
+	// Validate plugins
+	validPluginName := regexp.MustCompile(`^[a-z0-9_-]+$`)
+	pluginNames := make(map[string]bool)
+	for _, plugin := range cfg.Plugins {
+		if !validPluginName.MatchString(plugin.Name) {
+			return fmt.Errorf("plugin name must contain only lowercase alphanumeric characters, dashes, and underscores (got: %q)", plugin.Name)
+		}
+		if pluginNames[plugin.Name] {
+			return fmt.Errorf("duplicate plugin name: %s", plugin.Name)
+		}
+		pluginNames[plugin.Name] = true
+
+		if !filepath.IsAbs(plugin.Path) {
+			return fmt.Errorf("plugin %s: path must be absolute (got: %q)", plugin.Name, plugin.Path)
+		}
+		if _, err := os.Stat(plugin.Path); err != nil {
+			return fmt.Errorf("plugin %s: executable not found: %s (%w)", plugin.Name, plugin.Path, err)
+		}
+		if plugin.Interval == 0 && plugin.Schedule == "" && !plugin.Command && !childPlugins[plugin.Name] {
+			return fmt.Errorf("plugin %s: set interval or schedule, command, or both, or use it for a gateway child", plugin.Name)
+		}
+		if plugin.Interval != 0 && plugin.Interval < 10*time.Second {
+			return fmt.Errorf("plugin %s: interval must be 0 (not scheduled) or at least 10s (got: %v)", plugin.Name, plugin.Interval)
+		}
+		if plugin.Schedule != "" {
+			if plugin.Interval != 0 {
+				return fmt.Errorf("plugin %s: interval and schedule are mutually exclusive", plugin.Name)
+			}
+			if err := validateSchedule(plugin.Schedule); err != nil {
+				return fmt.Errorf("plugin %s: schedule: %w", plugin.Name, err)
+			}
+		}
+		if plugin.Timeout < 0 || plugin.Timeout > 5*time.Minute {
+			return fmt.Errorf("plugin %s: timeout must be between 0 and 5m (got: %v)", plugin.Name, plugin.Timeout)
+		}
+	}
+
+	// Validate gateway children. Child codes become subject tokens like the
+	// agent's own code, so they must be unique and distinct from it.
+	childCodes := map[string]bool{cfg.Code: true}
+	for _, child := range cfg.Gateway.Children {
+		if !validToken.MatchString(child.Code) {
+			return fmt.Errorf("gateway child code must contain only alphanumeric characters, dashes, and underscores (got: %q)", child.Code)
+		}
+		if childCodes[child.Code] {
+			return fmt.Errorf("gateway child code %s is a duplicate or the agent's own code", child.Code)
+		}
+		childCodes[child.Code] = true
+
+		if child.Location != "" && !validToken.MatchString(child.Location) {
+			return fmt.Errorf("gateway child %s: location must contain only alphanumeric characters, dashes, and underscores (got: %s)", child.Code, child.Location)
+		}
+		if !pluginNames[child.Plugin] {
+			return fmt.Errorf("gateway child %s: plugin %q is not defined in plugins", child.Code, child.Plugin)
+		}
+		if child.Interval != 0 && child.Interval < 10*time.Second {
+			return fmt.Errorf("gateway child %s: interval must be 0 (commands only) or at least 10s (got: %v)", child.Code, child.Interval)
+		}
+	}
+
+	// Validate Modbus devices
+	deviceNames := make(map[string]bool)
+	for _, device := range cfg.Modbus.Devices {
+		if !validPluginName.MatchString(device.Name) {
+			return fmt.Errorf("modbus device name must contain only lowercase alphanumeric characters, dashes, and underscores (got: %q)", device.Name)
+		}
+		if deviceNames[device.Name] {
+			return fmt.Errorf("duplicate modbus device name: %s", device.Name)
+		}
+		deviceNames[device.Name] = true
+
+		if err := validateModbusDevice(&device); err != nil {
+			return fmt.Errorf("modbus device %s: %w", device.Name, err)
+		}
+	}
+
+	// Validate MQTT bridge
+	if cfg.MQTT.Enabled {
+		if err := validateMQTT(&cfg.MQTT); err != nil {
+			return fmt.Errorf("invalid mqtt config: %w", err)
+		}
+	}
+
+	// Validate BACnet
+	if cfg.BACnet.Enabled {
+		if err := validateBACnet(&cfg.BACnet); err != nil {
+			return fmt.Errorf("invalid bacnet config: %w", err)
+		}
+	}
+
+	// Validate GPIO
+	if cfg.GPIO.Enabled {
+		if err := validateGPIO(&cfg.GPIO); err != nil {
+			return fmt.Errorf("invalid gpio config: %w", err)
+		}
+	}
+
+	// Validate compliance baseline
+	if cfg.Compliance.Enabled {
+		if err := validateCompliance(&cfg.Compliance); err != nil {
+			return fmt.Errorf("invalid compliance config: %w", err)
+		}
+	}
+
+	// Validate ZFS monitoring
+	if cfg.ZFS.Enabled {
+		if err := validateZFS(&cfg.ZFS); err != nil {
+			return fmt.Errorf("invalid zfs config: %w", err)
+		}
+	}
+
+	// Validate RAID monitoring
+	if cfg.RAID.Enabled {
+		if err := validateRAID(&cfg.RAID); err != nil {
+			return fmt.Errorf("invalid raid config: %w", err)
+		}
+	}
+
+	// Validate UPS monitoring
+	if cfg.UPS.Enabled {
+		if err := validateUPS(&cfg.UPS); err != nil {
+			return fmt.Errorf("invalid ups config: %w", err)
+		}
+	}
+
+	// Validate site leader election
+	if cfg.Election.Enabled {
+		if err := validateElection(&cfg.Election, cfg.Tags); err != nil {
+			return fmt.Errorf("invalid election config: %w", err)
+		}
+	}
 
 	// Validate log level
 	validLevels := map[string]bool{
@@ -370,32 +1835,1647 @@ func validate(cfg *Config) error {
 	if cfg.Logging.MaxBackups < 0 || cfg.Logging.MaxBackups > 100 {
 		return fmt.Errorf("log max_backups must be between 0 and 100 (got: %d)", cfg.Logging.MaxBackups)
 	}
+	if cfg.Logging.MaxAgeDays < 0 || cfg.Logging.MaxAgeDays > 3650 {
+		return fmt.Errorf("log max_age_days must be between 0 and 3650 (got: %d)", cfg.Logging.MaxAgeDays)
+	}
+
+	// Validate log shipping
+	if ship := cfg.Logging.Ship; ship.Enabled {
+		if !validLevels[ship.Level] {
+			return fmt.Errorf("invalid logging.ship.level: %s (must be debug, info, warn, or error)", ship.Level)
+		}
+		if ship.BatchSize < 1 || ship.BatchSize > 1000 {
+			return fmt.Errorf("logging.ship.batch_size must be between 1 and 1000 (got: %d)", ship.BatchSize)
+		}
+		if ship.FlushInterval < time.Second {
+			return fmt.Errorf("logging.ship.flush_interval must be at least 1s (got: %v)", ship.FlushInterval)
+		}
+		if ship.RateLimit < 1 || ship.RateLimit > 10000 {
+			return fmt.Errorf("logging.ship.rate_limit must be between 1 and 10000 entries per minute (got: %d)", ship.RateLimit)
+		}
+	}
+
+	// Validate OS log sinks
+	if sl := cfg.Logging.Syslog; sl.Enabled {
+		if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+			return fmt.Errorf("logging.syslog is only supported on Linux and FreeBSD (use logging.eventlog on Windows)")
+		}
+		if !validLevels[sl.Level] {
+			return fmt.Errorf("invalid logging.syslog.level: %s (must be debug, info, warn, or error)", sl.Level)
+		}
+		switch sl.Network {
+		case "":
+			if sl.Address != "" {
+				return fmt.Errorf("logging.syslog.network (udp or tcp) is required with an address")
+			}
+		case "udp", "tcp":
+			if sl.Address == "" {
+				return fmt.Errorf("logging.syslog.address is required for network %s", sl.Network)
+			}
+		default:
+			return fmt.Errorf("invalid logging.syslog.network: %s (must be udp, tcp, or empty for the local socket)", sl.Network)
+		}
+	}
+	if el := cfg.Logging.EventLog; el.Enabled {
+		if runtime.GOOS != "windows" {
+			return fmt.Errorf("logging.eventlog is only supported on Windows (use logging.syslog on Linux/FreeBSD)")
+		}
+		if !validLevels[el.Level] {
+			return fmt.Errorf("invalid logging.eventlog.level: %s (must be debug, info, warn, or error)", el.Level)
+		}
+		if el.Source == "" {
+			return fmt.Errorf("logging.eventlog.source is required")
+		}
+	}
+
+	// Validate debug endpoint. pprof exposes heap contents and command lines,
+	// so it must never be reachable from the network.
+	if cfg.Debug.Enabled {
+		if err := validateLoopbackAddr(cfg.Debug.Listen); err != nil {
+			return fmt.Errorf("debug.listen: %w", err)
+		}
+	}
+
+	if err := validateRuntime(&cfg.Runtime); err != nil {
+		return fmt.Errorf("runtime.%w", err)
+	}
+
+	// Validate local admin channel
+	if cfg.Control.Enabled {
+		if err := validateControlSocket(cfg.Control.Socket); err != nil {
+			return fmt.Errorf("control.socket: %w", err)
+		}
+	}
 
 	return nil
 }
 
-// validateSubjectPrefix validates a NATS subject prefix
-// Allows hierarchical prefixes like "region.dev.agents" where each token
-// contains only alphanumeric characters, dashes, and underscores
-func validateSubjectPrefix(prefix string) error {
-	// Check for leading or trailing dots
-	if len(prefix) > 0 && (prefix[0] == '.' || prefix[len(prefix)-1] == '.') {
-		return fmt.Errorf("cannot start or end with a dot (got: %s)", prefix)
+// validateControlSocket checks the control channel path for this platform
+func validateControlSocket(socket string) error {
+	if runtime.GOOS == "windows" {
+		if !strings.HasPrefix(strings.ToLower(socket), `\\.\pipe\`) || len(socket) == len(`\\.\pipe\`) {
+			return fmt.Errorf("must be a named pipe path like \\\\.\\pipe\\agent (got: %q)", socket)
+		}
+		return nil
+	}
+	if !filepath.IsAbs(socket) {
+		return fmt.Errorf("must be an absolute path (got: %q)", socket)
 	}
+	// sun_path is 104 bytes on FreeBSD/macOS, 108 on Linux
+	if len(socket) > 103 {
+		return fmt.Errorf("must be at most 103 characters (got: %d)", len(socket))
+	}
+	return nil
+}
 
-	// Split into tokens by dots
-	tokens := regexp.MustCompile(`\.`).Split(prefix, -1)
+// validateSerial checks a serial line's settings (zero values are defaults)
+func validateSerial(cfg SerialConfig) error {
+	switch cfg.BaudRate {
+	case 0, 1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200:
+	default:
+		return fmt.Errorf("baud_rate must be one of 1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200 (got: %d)", cfg.BaudRate)
+	}
+	if cfg.DataBits != 0 && cfg.DataBits != 7 && cfg.DataBits != 8 {
+		return fmt.Errorf("data_bits must be 7 or 8 (got: %d)", cfg.DataBits)
+	}
+	switch cfg.Parity {
+	case "", "none", "even", "odd":
+	default:
+		return fmt.Errorf("parity must be none, even, or odd (got: %s)", cfg.Parity)
+	}
+	if cfg.StopBits != 0 && cfg.StopBits != 1 && cfg.StopBits != 2 {
+		return fmt.Errorf("stop_bits must be 1 or 2 (got: %d)", cfg.StopBits)
+	}
+	return nil
+}
 
-	// Validate each token
+// validateModbusDevice checks a Modbus device's connection and register map
+func validateModbusDevice(device *ModbusDeviceConfig) error {
+	switch device.Transport {
+	case "tcp":
+		if _, _, err := net.SplitHostPort(device.Address); err != nil {
+			return fmt.Errorf("address must be host:port for tcp (got: %q)", device.Address)
+		}
+		if device.UnitID < 0 || device.UnitID > 255 {
+			return fmt.Errorf("unit_id must be between 0 and 255 (got: %d)", device.UnitID)
+		}
+	case "rtu":
+		if device.Serial.Device == "" {
+			return fmt.Errorf("serial.device is required for rtu")
+		}
+		if device.UnitID < 1 || device.UnitID > 247 {
+			return fmt.Errorf("unit_id must be between 1 and 247 for rtu (got: %d)", device.UnitID)
+		}
+		if err := validateSerial(device.Serial); err != nil {
+			return fmt.Errorf("serial.%w", err)
+		}
+	default:
+		return fmt.Errorf("transport must be tcp or rtu (got: %q)", device.Transport)
+	}
+
+	if device.Interval < 10*time.Second {
+		return fmt.Errorf("interval must be at least 10s (got: %v)", device.Interval)
+	}
+	if device.Timeout < 0 || device.Timeout > time.Minute {
+		return fmt.Errorf("timeout must be between 0 and 1m (got: %v)", device.Timeout)
+	}
+
+	if len(device.Registers) == 0 {
+		return fmt.Errorf("at least one register is required")
+	}
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	names := make(map[string]bool)
+	for _, reg := range device.Registers {
+		if !validName.MatchString(reg.Name) {
+			return fmt.Errorf("register name must contain only alphanumeric characters, dashes, and underscores (got: %q)", reg.Name)
+		}
+		if names[reg.Name] {
+			return fmt.Errorf("duplicate register name: %s", reg.Name)
+		}
+		names[reg.Name] = true
+
+		if reg.Address < 0 || reg.Address > 65535 {
+			return fmt.Errorf("register %s: address must be between 0 and 65535 (got: %d)", reg.Name, reg.Address)
+		}
+		switch reg.Type {
+		case "holding", "input":
+			switch reg.Format {
+			case "", "uint16", "int16":
+			case "uint32", "int32", "float32":
+				if reg.Address > 65534 {
+					return fmt.Errorf("register %s: 32-bit value at address %d exceeds the register space", reg.Name, reg.Address)
+				}
+			default:
+				return fmt.Errorf("register %s: format must be uint16, int16, uint32, int32, or float32 (got: %s)", reg.Name, reg.Format)
+			}
+		case "coil", "discrete":
+			if reg.Format != "" && reg.Format != "bool" {
+				return fmt.Errorf("register %s: %s registers are always bool (got format: %s)", reg.Name, reg.Type, reg.Format)
+			}
+		default:
+			return fmt.Errorf("register %s: type must be holding, input, coil, or discrete (got: %q)", reg.Name, reg.Type)
+		}
+		switch reg.WordOrder {
+		case "", "big", "little":
+		default:
+			return fmt.Errorf("register %s: word_order must be big or little (got: %s)", reg.Name, reg.WordOrder)
+		}
+	}
+	return nil
+}
+
+// validateMQTT checks the MQTT bridge's broker settings and mapping rules
+func validateMQTT(m *MQTTConfig) error {
+	u, err := url.Parse(m.Broker)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("broker must be a URL like tcp://host:1883 (got: %q)", m.Broker)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		if m.CAFile != "" {
+			return fmt.Errorf("ca_file requires a tls:// broker")
+		}
+	case "tls", "ssl", "mqtts":
+	default:
+		return fmt.Errorf("broker scheme must be tcp or tls (got: %s)", u.Scheme)
+	}
+	if u.Port() == "" {
+		return fmt.Errorf("broker must include a port (got: %q)", m.Broker)
+	}
+	if m.CAFile != "" {
+		if _, err := os.Stat(m.CAFile); err != nil {
+			return fmt.Errorf("ca_file not found: %s (%w)", m.CAFile, err)
+		}
+	}
+	if m.PasswordEnv != "" && m.Username == "" {
+		return fmt.Errorf("username is required when password_env is set")
+	}
+	// The keep alive is sent as a 16-bit number of seconds
+	if m.KeepAlive < 5*time.Second || m.KeepAlive > 65535*time.Second {
+		return fmt.Errorf("keep_alive must be between 5s and 18h (got: %v)", m.KeepAlive)
+	}
+
+	if len(m.Rules) == 0 {
+		return fmt.Errorf("at least one rule is required")
+	}
 	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
-	for i, token := range tokens {
-		if token == "" {
-			return fmt.Errorf("empty token at position %d (consecutive dots not allowed)", i)
+	placeholder := regexp.MustCompile(`^\{([1-9][0-9]*)\}$`)
+	for _, rule := range m.Rules {
+		wildcards, err := validateTopicFilter(rule.Topic)
+		if err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Topic, err)
 		}
-		if !validToken.MatchString(token) {
-			return fmt.Errorf("token '%s' contains invalid characters (only alphanumeric, dash, and underscore allowed)", token)
+		if rule.Subject == "" {
+			return fmt.Errorf("rule %q: subject is required", rule.Topic)
+		}
+		for _, token := range strings.Split(rule.Subject, ".") {
+			if match := placeholder.FindStringSubmatch(token); match != nil {
+				if n, _ := strconv.Atoi(match[1]); n > wildcards {
+					return fmt.Errorf("rule %q: subject uses %s but the topic has %d wildcards", rule.Topic, token, wildcards)
+				}
+				continue
+			}
+			if !validToken.MatchString(token) {
+				return fmt.Errorf("rule %q: subject token %q must be alphanumeric, dash, underscore, or a {n} placeholder", rule.Topic, token)
+			}
+		}
+		if rule.QoS != 0 && rule.QoS != 1 {
+			return fmt.Errorf("rule %q: qos must be 0 or 1 (got: %d)", rule.Topic, rule.QoS)
+		}
+	}
+	return nil
+}
+
+// validateTopicFilter checks an MQTT topic filter and returns its number of
+// wildcards. + must fill a whole level; # must be the whole last level.
+func validateTopicFilter(filter string) (int, error) {
+	if filter == "" {
+		return 0, fmt.Errorf("topic is required")
+	}
+	levels := strings.Split(filter, "/")
+	wildcards := 0
+	for i, level := range levels {
+		switch {
+		case level == "+":
+			wildcards++
+		case level == "#":
+			if i != len(levels)-1 {
+				return 0, fmt.Errorf("# must be the last level of the topic")
+			}
+			wildcards++
+		case strings.ContainsAny(level, "+#"):
+			return 0, fmt.Errorf("wildcards must occupy a whole topic level")
 		}
 	}
+	return wildcards, nil
+}
+
+// validateBACnet checks the BACnet network settings, devices and points
+func validateBACnet(b *BACnetConfig) error {
+	if _, _, err := net.SplitHostPort(b.Listen); err != nil {
+		return fmt.Errorf("listen must be host:port or :port (got: %q)", b.Listen)
+	}
+	if _, _, err := net.SplitHostPort(b.Broadcast); err != nil {
+		return fmt.Errorf("broadcast must be host:port (got: %q)", b.Broadcast)
+	}
+	if b.Timeout < 100*time.Millisecond || b.Timeout > 30*time.Second {
+		return fmt.Errorf("timeout must be between 100ms and 30s (got: %v)", b.Timeout)
+	}
+	if b.DiscoveryInterval != 0 && b.DiscoveryInterval < time.Minute {
+		return fmt.Errorf("discovery_interval must be 0 (disabled) or at least 1m (got: %v)", b.DiscoveryInterval)
+	}
+	if b.DiscoveryTimeout < time.Second || b.DiscoveryTimeout > time.Minute {
+		return fmt.Errorf("discovery_timeout must be between 1s and 1m (got: %v)", b.DiscoveryTimeout)
+	}
+	if b.DiscoveryInterval == 0 && len(b.Devices) == 0 {
+		return fmt.Errorf("enable discovery_interval or configure at least one device")
+	}
+
+	validPluginName := regexp.MustCompile(`^[a-z0-9_-]+$`)
+	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	objectPattern := regexp.MustCompile(`^([a-z0-9-]+):([0-9]+)$`)
+	numeric := regexp.MustCompile(`^[0-9]+$`)
+	names := make(map[string]bool)
+	for _, device := range b.Devices {
+		// "devices" is the subject and task name of the device list
+		if !validPluginName.MatchString(device.Name) || device.Name == "devices" {
+			return fmt.Errorf("device name must contain only lowercase alphanumeric characters, dashes, and underscores, and not be \"devices\" (got: %q)", device.Name)
+		}
+		if names[device.Name] {
+			return fmt.Errorf("duplicate device name: %s", device.Name)
+		}
+		names[device.Name] = true
 
+		if device.Instance < 0 || device.Instance > 4194302 {
+			return fmt.Errorf("device %s: instance must be between 0 and 4194302 (got: %d)", device.Name, device.Instance)
+		}
+		if device.Address != "" {
+			if _, _, err := net.SplitHostPort(device.Address); err != nil {
+				return fmt.Errorf("device %s: address must be ip:port (got: %q)", device.Name, device.Address)
+			}
+		}
+		if device.Interval < 10*time.Second {
+			return fmt.Errorf("device %s: interval must be at least 10s (got: %v)", device.Name, device.Interval)
+		}
+		if len(device.Points) == 0 {
+			return fmt.Errorf("device %s: at least one point is required", device.Name)
+		}
+
+		points := make(map[string]bool)
+		for _, point := range device.Points {
+			if !validToken.MatchString(point.Name) {
+				return fmt.Errorf("device %s: point name must contain only alphanumeric characters, dashes, and underscores (got: %q)", device.Name, point.Name)
+			}
+			if points[point.Name] {
+				return fmt.Errorf("device %s: duplicate point name: %s", device.Name, point.Name)
+			}
+			points[point.Name] = true
+
+			match := objectPattern.FindStringSubmatch(point.Object)
+			if match == nil {
+				return fmt.Errorf("device %s: point %s: object must be type:instance, e.g. analog-input:1 (got: %q)", device.Name, point.Name, point.Object)
+			}
+			switch match[1] {
+			case "analog-input", "analog-output", "analog-value",
+				"binary-input", "binary-output", "binary-value",
+				"multi-state-input", "multi-state-output", "multi-state-value",
+				"device", "loop", "accumulator":
+			default:
+				if n, err := strconv.Atoi(match[1]); err != nil || n > 1023 {
+					return fmt.Errorf("device %s: point %s: unknown object type %s (use a standard name or the type number)", device.Name, point.Name, match[1])
+				}
+			}
+			if n, err := strconv.Atoi(match[2]); err != nil || n > 4194302 {
+				return fmt.Errorf("device %s: point %s: object instance must be at most 4194302", device.Name, point.Name)
+			}
+
+			switch point.Property {
+			case "", "present-value", "object-name", "description", "status-flags",
+				"units", "out-of-service", "reliability", "event-state":
+			default:
+				if !numeric.MatchString(point.Property) {
+					return fmt.Errorf("device %s: point %s: unknown property %s (use a standard name or the property number)", device.Name, point.Name, point.Property)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateVaultAuth checks the vault bootstrap settings
+func validateVaultAuth(auth *AuthConfig) error {
+	vault := auth.Vault
+	if vault.Address == "" {
+		return fmt.Errorf("vault.address is required for vault auth type")
+	}
+	if vault.SecretPath == "" {
+		return fmt.Errorf("vault.secret_path is required for vault auth type")
+	}
+
+	switch vault.SecretType {
+	case "", "creds":
+		if auth.CredsFile == "" {
+			return fmt.Errorf("creds_file is required for vault auth type (path where .creds will be written)")
+		}
+	case "nkey":
+		if auth.NkeyFile == "" {
+			return fmt.Errorf("nkey_file is required for vault auth type with secret_type nkey (path where the seed will be written)")
+		}
+	default:
+		return fmt.Errorf("invalid vault.secret_type: %s (must be creds or nkey)", vault.SecretType)
+	}
+
+	switch vault.AuthMethod {
+	case "approle":
+		if vault.RoleID == "" {
+			return fmt.Errorf("vault.role_id is required for approle auth")
+		}
+		if vault.SecretIDEnv == "" {
+			return fmt.Errorf("vault.secret_id_env is required for approle auth")
+		}
+	case "kubernetes":
+		if vault.Role == "" {
+			return fmt.Errorf("vault.role is required for kubernetes auth")
+		}
+	default:
+		return fmt.Errorf("invalid vault.auth_method: %s (must be approle or kubernetes)", vault.AuthMethod)
+	}
+
+	return nil
+}
+
+// shortestTaskInterval returns the smallest interval among enabled tasks,
+// or 0 if no task is enabled
+func shortestTaskInterval(tasks *TasksConfig) time.Duration {
+	var shortest time.Duration
+	for _, t := range []struct {
+		enabled  bool
+		interval time.Duration
+	}{
+		{tasks.Heartbeat.Enabled, tasks.Heartbeat.Interval},
+		{tasks.SystemMetrics.Enabled, tasks.SystemMetrics.Interval},
+		{tasks.ServiceCheck.Enabled, tasks.ServiceCheck.Interval},
+		{tasks.Inventory.Enabled, tasks.Inventory.Interval},
+	} {
+		if t.enabled && (shortest == 0 || t.interval < shortest) {
+			shortest = t.interval
+		}
+	}
+	return shortest
+}
+
+// validateLoopbackAddr checks that a host:port listen address binds to a
+// loopback interface only
+func validateLoopbackAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	if port == "" {
+		return fmt.Errorf("invalid address %q: port is required", addr)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("must be a loopback address such as 127.0.0.1:6060 (got: %s)", addr)
+	}
+	return nil
+}
+
+// validateSubjectPrefix validates a NATS subject prefix
+// Allows hierarchical prefixes like "region.dev.agents" where each token
+// contains only alphanumeric characters, dashes, and underscores
+func validateSubjectPrefix(prefix string) error {
+	// Check for leading or trailing dots
+	if len(prefix) > 0 && (prefix[0] == '.' || prefix[len(prefix)-1] == '.') {
+		return fmt.Errorf("cannot start or end with a dot (got: %s)", prefix)
+	}
+
+	// Split into tokens by dots
+	tokens := regexp.MustCompile(`\.`).Split(prefix, -1)
+
+	// Validate each token
+	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	for i, token := range tokens {
+		if token == "" {
+			return fmt.Errorf("empty token at position %d (consecutive dots not allowed)", i)
+		}
+		if !validToken.MatchString(token) {
+			return fmt.Errorf("token '%s' contains invalid characters (only alphanumeric, dash, and underscore allowed)", token)
+		}
+	}
+
+	return nil
+}
+
+// Fingerprint returns a short hash of the effective configuration. Identity
+// fields (code, location, tags) are excluded, so agents deployed from the
+// same config template report the same fingerprint and drift stands out.
+func Fingerprint(cfg *Config) string {
+	c := *cfg
+	c.Code = ""
+	c.Location = ""
+	c.Tags = nil
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// redactedValue replaces secrets in Redacted
+const redactedValue = "[redacted]"
+
+// Redacted returns a copy of cfg that is safe to hand to support: the inline
+// NATS token and password, bootstrap HTTP headers and body, exporter and
+// remote_write headers, and user info in URLs are replaced. Secrets kept in
+// files or environment variables are only referenced by the config, so
+// nothing else needs hiding.
+func Redacted(cfg *Config) *Config {
+	c := *cfg
+	auth := &c.NATS.Auth
+	if auth.Token != "" {
+		auth.Token = redactedValue
+	}
+	if auth.Password != "" {
+		auth.Password = redactedValue
+	}
+	if len(auth.HTTP.Headers) > 0 {
+		headers := make(map[string]string, len(auth.HTTP.Headers))
+		for name := range auth.HTTP.Headers {
+			headers[name] = redactedValue
+		}
+		auth.HTTP.Headers = headers
+	}
+	if auth.HTTP.Body != "" {
+		auth.HTTP.Body = redactedValue
+	}
+
+	c.NATS.URLs = make([]string, len(cfg.NATS.URLs))
+	for i, u := range cfg.NATS.URLs {
+		c.NATS.URLs[i] = redactURL(u)
+	}
+	if er := &c.Tasks.SystemMetrics.ExporterRequest; len(er.Headers) > 0 {
+		headers := make(map[string]string, len(er.Headers))
+		for name := range er.Headers {
+			headers[name] = redactedValue
+		}
+		er.Headers = headers
+	}
+	if rw := &c.Tasks.SystemMetrics.RemoteWrite; len(rw.Headers) > 0 {
+		headers := make(map[string]string, len(rw.Headers))
+		for name := range rw.Headers {
+			headers[name] = redactedValue
+		}
+		rw.Headers = headers
+	}
+	c.Tasks.SystemMetrics.ExporterURL = redactURL(c.Tasks.SystemMetrics.ExporterURL)
+	c.Tasks.SystemMetrics.RemoteWrite.URL = redactURL(c.Tasks.SystemMetrics.RemoteWrite.URL)
+	auth.HTTP.URL = redactURL(auth.HTTP.URL)
+	auth.PocketBase.URL = redactURL(auth.PocketBase.URL)
+	auth.Vault.Address = redactURL(auth.Vault.Address)
+	c.MQTT.Broker = redactURL(c.MQTT.Broker)
+	return &c
+}
+
+// redactURL hides a URL's user info. NATS URLs may carry a token as the
+// user name, so all of it is hidden, not just the password.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("xxxxx")
+	return u.String()
+}
+
+// taskWindow is how long a task run may take: its timeout, or its interval
+// when the timeout is unset
+func taskWindow(interval, timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return interval
+}
+
+// validateDiskForecast checks the forecast window, horizon and sample count.
+// The window must hold min_samples scrapes, or no drive is ever predicted.
+func validateDiskForecast(c *DiskForecastConfig, interval time.Duration) error {
+	if c.Window < time.Hour || c.Window > 30*24*time.Hour {
+		return fmt.Errorf("window must be between 1h and 720h (got: %v)", c.Window)
+	}
+	if c.Horizon < time.Hour || c.Horizon > 90*24*time.Hour {
+		return fmt.Errorf("horizon must be between 1h and 2160h (got: %v)", c.Horizon)
+	}
+	if c.MinSamples < 3 || c.MinSamples > 288 {
+		return fmt.Errorf("min_samples must be between 3 and 288 (got: %d)", c.MinSamples)
+	}
+	if time.Duration(c.MinSamples)*interval > c.Window {
+		return fmt.Errorf("window must hold min_samples scrapes (got: %d x %v > %v)", c.MinSamples, interval, c.Window)
+	}
+	return nil
+}
+
+// validateExporterFallback checks the fallback applies to the source and
+// its thresholds
+func validateExporterFallback(m *SystemMetricsConfig) error {
+	if m.Source != "exporter" {
+		return fmt.Errorf("enabled requires system_metrics.source 'exporter' (got: %q)", m.Source)
+	}
+	if m.Fallback.Failures < 1 || m.Fallback.Failures > 20 {
+		return fmt.Errorf("failures must be between 1 and 20 (got: %d)", m.Fallback.Failures)
+	}
+	if m.Fallback.RetryInterval < m.Interval || m.Fallback.RetryInterval > 24*time.Hour {
+		return fmt.Errorf("retry_interval must be between the interval and 24h (got: %v, interval %v)", m.Fallback.RetryInterval, m.Interval)
+	}
+	return nil
+}
+
+// remoteWriteReservedLabels are set on every series by the agent
+var remoteWriteReservedLabels = []string{"__name__", "code", "location"}
+
+// validateExporterRequest checks the scrape credentials and that header
+// names are valid HTTP tokens
+func validateExporterRequest(c *ExporterRequestConfig) error {
+	if c.PasswordEnv != "" && c.Username == "" {
+		return fmt.Errorf("username is required when password_env is set")
+	}
+	if c.BearerTokenEnv != "" && c.Username != "" {
+		return fmt.Errorf("bearer_token_env and username are mutually exclusive")
+	}
+	if strings.ContainsAny(c.UserAgent, "\r\n") {
+		return fmt.Errorf("user_agent must be a single line")
+	}
+	validHeader := regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	for name := range c.Headers {
+		if !validHeader.MatchString(name) {
+			return fmt.Errorf("headers: %q is not a valid header name", name)
+		}
+		if strings.EqualFold(name, "Authorization") && (c.Username != "" || c.BearerTokenEnv != "") {
+			return fmt.Errorf("headers: Authorization conflicts with username/bearer_token_env")
+		}
+		if strings.EqualFold(name, "User-Agent") && c.UserAgent != "" {
+			return fmt.Errorf("headers: User-Agent conflicts with user_agent")
+		}
+	}
+	return nil
+}
+
+// validateExporterURL checks that the exporter is reached over http(s) or
+// a unix socket (unix:///path/to/socket)
+func validateExporterURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid exporter_url %q: %w", raw, err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("exporter_url has no host (got: %q)", raw)
+		}
+	case "unix":
+		if u.Host != "" || u.Path == "" {
+			return fmt.Errorf("exporter_url must name the socket as unix:///path/to/socket (got: %q)", raw)
+		}
+	default:
+		return fmt.Errorf("exporter_url must be an http://, https:// or unix:// URL (got: %q)", raw)
+	}
+	return nil
+}
+
+// validateExporterTLS checks that TLS settings come with an https://
+// exporter and that their files exist
+func validateExporterTLS(m *SystemMetricsConfig) error {
+	c := m.ExporterTLS
+	if c == (ExporterTLSConfig{}) {
+		return nil
+	}
+	if !strings.HasPrefix(strings.ToLower(m.ExporterURL), "https://") {
+		return fmt.Errorf("requires an https:// exporter_url (got: %q)", m.ExporterURL)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("cert_file and key_file must be specified together")
+	}
+	for _, f := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			return fmt.Errorf("file not found: %s (%w)", f, err)
+		}
+	}
+	return nil
+}
+
+// validateRemoteWrite checks the endpoint, its credentials and the added
+// labels
+func validateRemoteWrite(m *SystemMetricsConfig) error {
+	c := &m.RemoteWrite
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("url must be an http:// or https:// URL (got: %q)", c.URL)
+	}
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = m.Interval
+	}
+	if c.Timeout < time.Second || c.Timeout > timeout {
+		return fmt.Errorf("timeout must be at least 1s and at most the system_metrics timeout (got: %v, timeout %v)", c.Timeout, timeout)
+	}
+	if c.PasswordEnv != "" && c.Username == "" {
+		return fmt.Errorf("username is required when password_env is set")
+	}
+	if c.BearerTokenEnv != "" && c.Username != "" {
+		return fmt.Errorf("bearer_token_env and username are mutually exclusive")
+	}
+	for name := range c.Headers {
+		if strings.EqualFold(name, "Authorization") && (c.Username != "" || c.BearerTokenEnv != "") {
+			return fmt.Errorf("headers: Authorization conflicts with username/bearer_token_env")
+		}
+	}
+	if c.CAFile != "" {
+		if u.Scheme != "https" {
+			return fmt.Errorf("ca_file requires an https:// url")
+		}
+		if _, err := os.Stat(c.CAFile); err != nil {
+			return fmt.Errorf("ca_file not found: %s (%w)", c.CAFile, err)
+		}
+	}
+	validName := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	for name, value := range c.Labels {
+		if !validName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("labels: %q is not a valid Prometheus label name", name)
+		}
+		if slices.Contains(remoteWriteReservedLabels, name) {
+			return fmt.Errorf("labels: %s is set by the agent", name)
+		}
+		if value == "" || !utf8.ValidString(value) {
+			return fmt.Errorf("labels: %s: value must be non-empty UTF-8", name)
+		}
+	}
+	if c.ExtraFamilies && m.Source != "hybrid" {
+		return fmt.Errorf("extra_families requires system_metrics.source 'hybrid'")
+	}
+	return nil
+}
+
+// LoadTimezone returns the location cron schedules run in (tasks.timezone):
+// UTC when empty, the device's zone for "Local", or an IANA zone name
+func LoadTimezone(name string) (*time.Location, error) {
+	switch {
+	case name == "" || strings.EqualFold(name, "UTC"):
+		return time.UTC, nil
+	case strings.EqualFold(name, "Local"):
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q (use UTC, Local or an IANA name like Europe/Berlin)", name)
+	}
+	return loc, nil
+}
+
+// validateSchedule checks a standard 5-field cron expression. Zones are
+// set with tasks.timezone, not per expression.
+func validateSchedule(schedule string) error {
+	if strings.HasPrefix(schedule, "TZ=") || strings.HasPrefix(schedule, "CRON_TZ=") {
+		return fmt.Errorf("set the zone with tasks.timezone, not in the expression (got: %q)", schedule)
+	}
+	if _, err := cron.ParseStandard(schedule); err != nil {
+		return fmt.Errorf("invalid cron expression %q: %w", schedule, err)
+	}
+	return nil
+}
+
+// validateRetry checks a task's retry settings against its run window
+func validateRetry(r RetryConfig, window time.Duration) error {
+	if r.Attempts < 0 || r.Attempts > 5 {
+		return fmt.Errorf("attempts must be between 0 and 5 (got: %d)", r.Attempts)
+	}
+	if r.Attempts == 0 {
+		return nil
+	}
+	if r.Backoff < 100*time.Millisecond || r.Backoff >= window {
+		return fmt.Errorf("backoff must be at least 100ms and less than the task timeout (got: %v, timeout %v)", r.Backoff, window)
+	}
+	return nil
+}
+
+// maxTags bounds the tags sent with every message
+const maxTags = 32
+
+// validateTags checks that tags can be carried as NATS message headers
+// (Agent-Tag-<key>). Viper lowercases keys, so they are matched lowercase.
+func validateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("at most %d tags are allowed (got: %d)", maxTags, len(tags))
+	}
+	validKey := regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	for key, value := range tags {
+		if !validKey.MatchString(key) {
+			return fmt.Errorf("key must be 1-64 lowercase alphanumeric, dash, or underscore characters (got: %q)", key)
+		}
+		if value == "" || len(value) > 256 {
+			return fmt.Errorf("%s: value must be 1-256 characters", key)
+		}
+		if !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("%s: value must be UTF-8 without control characters", key)
+		}
+	}
+	return nil
+}
+
+// validateGPIO checks the driver and the pin whitelist
+func validateGPIO(g *GPIOConfig) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("gpio is only supported on Linux")
+	}
+	switch g.Driver {
+	case "gpiod":
+		if g.Chip == "" {
+			return fmt.Errorf("chip is required for the gpiod driver")
+		}
+	case "sysfs":
+	default:
+		return fmt.Errorf("driver must be gpiod or sysfs (got: %q)", g.Driver)
+	}
+	if g.PollInterval != 0 && g.PollInterval < time.Second {
+		return fmt.Errorf("poll_interval must be 0 (disabled) or at least 1s (got: %v)", g.PollInterval)
+	}
+	if len(g.Pins) == 0 {
+		return fmt.Errorf("at least one pin is required")
+	}
+
+	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	names := make(map[string]bool)
+	lines := make(map[string]bool)
+	for i := range g.Pins {
+		pin := &g.Pins[i]
+		if !validToken.MatchString(pin.Name) {
+			return fmt.Errorf("pins[%d].name must be alphanumeric, dash, or underscore (got: %q)", i, pin.Name)
+		}
+		if names[pin.Name] {
+			return fmt.Errorf("duplicate pin name: %s", pin.Name)
+		}
+		names[pin.Name] = true
+
+		if pin.Line < 0 || pin.Line > 65535 {
+			return fmt.Errorf("pin %s: line must be between 0 and 65535 (got: %d)", pin.Name, pin.Line)
+		}
+		chip := ""
+		if g.Driver == "gpiod" {
+			chip = g.Chip
+			if pin.Chip != "" {
+				chip = pin.Chip
+			}
+		} else if pin.Chip != "" {
+			return fmt.Errorf("pin %s: chip is only supported by the gpiod driver", pin.Name)
+		}
+		key := fmt.Sprintf("%s/%d", chip, pin.Line)
+		if lines[key] {
+			return fmt.Errorf("pin %s: line %d is already used by another pin", pin.Name, pin.Line)
+		}
+		lines[key] = true
+
+		switch pin.Direction {
+		case "input":
+			if pin.Initial != 0 {
+				return fmt.Errorf("pin %s: initial only applies to outputs", pin.Name)
+			}
+			switch pin.Bias {
+			case "":
+			case "pull-up", "pull-down", "disabled":
+				if g.Driver != "gpiod" {
+					return fmt.Errorf("pin %s: bias is only supported by the gpiod driver", pin.Name)
+				}
+			default:
+				return fmt.Errorf("pin %s: bias must be pull-up, pull-down, or disabled (got: %q)", pin.Name, pin.Bias)
+			}
+		case "output":
+			if pin.Bias != "" {
+				return fmt.Errorf("pin %s: bias only applies to inputs", pin.Name)
+			}
+			if pin.Initial != 0 && pin.Initial != 1 {
+				return fmt.Errorf("pin %s: initial must be 0 or 1 (got: %d)", pin.Name, pin.Initial)
+			}
+		default:
+			return fmt.Errorf("pin %s: direction must be input or output (got: %q)", pin.Name, pin.Direction)
+		}
+	}
+	return nil
+}
+
+// validateCompliance checks the schedule, the KV location and the rules
+func validateCompliance(c *ComplianceConfig) error {
+	if c.Interval < time.Minute {
+		return fmt.Errorf("interval must be at least 1m (got: %v)", c.Interval)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative (got: %v)", c.Timeout)
+	}
+	if c.KVBucket == "" {
+		if len(c.Rules) == 0 {
+			return fmt.Errorf("rules or kv_bucket is required")
+		}
+		return ValidateComplianceRules(c.Rules)
+	}
+	if !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(c.KVBucket) {
+		return fmt.Errorf("kv_bucket must be alphanumeric, dash, or underscore (got: %q)", c.KVBucket)
+	}
+	if !regexp.MustCompile(`^[-/_=.a-zA-Z0-9]+$`).MatchString(c.KVKey) || strings.HasPrefix(c.KVKey, ".") || strings.HasSuffix(c.KVKey, ".") {
+		return fmt.Errorf("kv_key is not a valid KV key (got: %q)", c.KVKey)
+	}
+	if len(c.Rules) > 0 {
+		return fmt.Errorf("rules and kv_bucket are mutually exclusive")
+	}
+	return nil
+}
+
+// validateZFS checks the schedule and the platform
+func validateZFS(c *ZFSConfig) error {
+	if c.Interval < 30*time.Second {
+		return fmt.Errorf("interval must be at least 30s (got: %v)", c.Interval)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative (got: %v)", c.Timeout)
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "freebsd" {
+		return fmt.Errorf("zfs monitoring is only supported on Linux and FreeBSD")
+	}
+	return nil
+}
+
+// validateRAID checks the schedule and the controllers. Software RAID is
+// Linux only; the vendor CLIs run on any platform.
+func validateRAID(c *RAIDConfig) error {
+	if c.Interval < 30*time.Second {
+		return fmt.Errorf("interval must be at least 30s (got: %v)", c.Interval)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative (got: %v)", c.Timeout)
+	}
+	if !c.MDRaid && len(c.Controllers) == 0 {
+		return fmt.Errorf("mdraid or controllers is required")
+	}
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	names := make(map[string]bool)
+	for i, ctrl := range c.Controllers {
+		if !validName.MatchString(ctrl.Name) || ctrl.Name == "mdraid" {
+			return fmt.Errorf("controllers[%d].name must be alphanumeric, dash, or underscore and not mdraid (got: %q)", i, ctrl.Name)
+		}
+		if names[ctrl.Name] {
+			return fmt.Errorf("controllers[%d].name is a duplicate (got: %q)", i, ctrl.Name)
+		}
+		names[ctrl.Name] = true
+		if ctrl.Type != "megacli" && ctrl.Type != "ssacli" {
+			return fmt.Errorf("controllers[%d].type must be megacli or ssacli (got: %q)", i, ctrl.Type)
+		}
+		if !filepath.IsAbs(ctrl.Command) {
+			return fmt.Errorf("controllers[%d].command must be an absolute path (got: %q)", i, ctrl.Command)
+		}
+	}
+	if c.MDRaid && runtime.GOOS != "linux" {
+		return fmt.Errorf("mdraid is only supported on Linux")
+	}
+	return nil
+}
+
+// validateUPS checks the poll interval and the sources. The battery is
+// Windows only; upsc runs on any platform.
+func validateUPS(c *UPSConfig) error {
+	if c.PollInterval < time.Second || c.PollInterval > 5*time.Minute {
+		return fmt.Errorf("poll_interval must be between 1s and 5m (got: %v)", c.PollInterval)
+	}
+	if len(c.NUT) == 0 && !c.Battery {
+		return fmt.Errorf("nut or battery is required")
+	}
+	validTarget := regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*(@[a-zA-Z0-9_.-]+(:[0-9]+)?)?$`)
+	for i, target := range c.NUT {
+		if !validTarget.MatchString(target) {
+			return fmt.Errorf("nut[%d] must be ups[@host[:port]] (got: %q)", i, target)
+		}
+		if slices.Contains(c.NUT[:i], target) {
+			return fmt.Errorf("nut[%d] is a duplicate (got: %q)", i, target)
+		}
+	}
+	if c.Battery && runtime.GOOS != "windows" {
+		return fmt.Errorf("battery is only supported on Windows")
+	}
+	return nil
+}
+
+// validateElection checks the bucket, the site tag and the task list. The
+// tag's value becomes part of the lease key, so it must be a plain token.
+// The heartbeat reports each agent's own liveness and can't be elected.
+func validateElection(c *ElectionConfig, tags map[string]string) error {
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	if !validName.MatchString(c.Bucket) {
+		return fmt.Errorf("bucket must be alphanumeric, dash, or underscore (got: %q)", c.Bucket)
+	}
+	site, ok := tags[c.Tag]
+	if !ok {
+		return fmt.Errorf("tag %q is not set in tags", c.Tag)
+	}
+	if !validName.MatchString(site) {
+		return fmt.Errorf("tags.%s must be alphanumeric, dash, or underscore to name a site (got: %q)", c.Tag, site)
+	}
+	if len(c.Tasks) == 0 {
+		return fmt.Errorf("tasks: at least one task is required")
+	}
+	validTask := regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+	for i, task := range c.Tasks {
+		if !validTask.MatchString(task) {
+			return fmt.Errorf("tasks[%d] is not a valid task name (got: %q)", i, task)
+		}
+		if task == "heartbeat" {
+			return fmt.Errorf("tasks[%d]: heartbeat runs on every agent", i)
+		}
+		if slices.Contains(c.Tasks[:i], task) {
+			return fmt.Errorf("tasks[%d] is a duplicate (got: %q)", i, task)
+		}
+	}
+	return nil
+}
+
+// complianceOps are the operators each rule type supports
+var complianceOps = map[string][]string{
+	"file":            {"exists", "absent", "mode_max", "owner"},
+	"sysctl":          {"eq", "ne", "min", "max"},
+	"registry":        {"exists", "absent", "eq", "ne", "min", "max"},
+	"service":         {"eq", "ne"},
+	"password_policy": {"eq", "ne", "min", "max"},
+}
+
+// compliancePolicySettings are the password_policy targets
+var compliancePolicySettings = []string{"min_length", "max_age_days", "min_age_days", "history", "lockout_threshold"}
+
+// ValidateComplianceRules checks a compliance baseline, from the config or
+// from KV
+func ValidateComplianceRules(rules []ComplianceRule) error {
+	validID := regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+	validSysctl := regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+	ids := make(map[string]bool)
+	for i, rule := range rules {
+		if !validID.MatchString(rule.ID) {
+			return fmt.Errorf("rules[%d].id must be 1-64 alphanumeric, dot, dash, or underscore characters (got: %q)", i, rule.ID)
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate rule id: %s", rule.ID)
+		}
+		ids[rule.ID] = true
+
+		switch rule.Severity {
+		case "", "low", "medium", "high", "critical":
+		default:
+			return fmt.Errorf("rule %s: severity must be low, medium, high, or critical (got: %q)", rule.ID, rule.Severity)
+		}
+
+		ops, ok := complianceOps[rule.Type]
+		if !ok {
+			return fmt.Errorf("rule %s: type must be file, sysctl, registry, service, or password_policy (got: %q)", rule.ID, rule.Type)
+		}
+		if !slices.Contains(ops, rule.Op) {
+			return fmt.Errorf("rule %s: op for %s must be one of %s (got: %q)", rule.ID, rule.Type, strings.Join(ops, ", "), rule.Op)
+		}
+
+		if rule.Target == "" {
+			return fmt.Errorf("rule %s: target is required", rule.ID)
+		}
+		switch rule.Type {
+		case "file":
+			if !filepath.IsAbs(rule.Target) {
+				return fmt.Errorf("rule %s: target must be an absolute path (got: %q)", rule.ID, rule.Target)
+			}
+		case "sysctl":
+			if !validSysctl.MatchString(rule.Target) {
+				return fmt.Errorf("rule %s: target is not a sysctl key (got: %q)", rule.ID, rule.Target)
+			}
+		case "registry":
+			if !validRegistryPath(rule.Target) {
+				return fmt.Errorf("rule %s: target must be a key under HKLM or HKU (got: %q)", rule.ID, rule.Target)
+			}
+		case "password_policy":
+			if !slices.Contains(compliancePolicySettings, rule.Target) {
+				return fmt.Errorf("rule %s: target must be one of %s (got: %q)", rule.ID, strings.Join(compliancePolicySettings, ", "), rule.Target)
+			}
+		}
+		if rule.Name != "" && rule.Type != "registry" {
+			return fmt.Errorf("rule %s: name only applies to registry rules", rule.ID)
+		}
+
+		switch rule.Op {
+		case "exists", "absent":
+			if rule.Value != "" {
+				return fmt.Errorf("rule %s: %s takes no value", rule.ID, rule.Op)
+			}
+		case "min", "max":
+			if _, err := strconv.ParseFloat(rule.Value, 64); err != nil {
+				return fmt.Errorf("rule %s: %s needs a numeric value (got: %q)", rule.ID, rule.Op, rule.Value)
+			}
+		case "mode_max":
+			if mode, err := strconv.ParseUint(rule.Value, 8, 32); err != nil || mode > 0o7777 {
+				return fmt.Errorf("rule %s: mode_max needs an octal mode such as 0640 (got: %q)", rule.ID, rule.Value)
+			}
+		default:
+			if rule.Value == "" {
+				return fmt.Errorf("rule %s: %s needs a value", rule.ID, rule.Op)
+			}
+		}
+	}
+	return nil
+}
+
+// validateRuntime checks the GC settings, the disk guard and the memory
+// watchdog
+func validateStartup(s *StartupConfig) error {
+	if s.WaitTimeout == 0 {
+		return nil
+	}
+	if s.WaitTimeout < 0 || s.WaitTimeout > time.Hour {
+		return fmt.Errorf("wait_timeout must be between 0 and 1h (got: %v)", s.WaitTimeout)
+	}
+	if s.MaxBackoff < time.Second || s.MaxBackoff > 5*time.Minute {
+		return fmt.Errorf("max_backoff must be between 1s and 5m (got: %v)", s.MaxBackoff)
+	}
+	return nil
+}
+
+func validateRuntime(r *RuntimeConfig) error {
+	if r.MemoryLimitMB < 0 || (r.MemoryLimitMB > 0 && r.MemoryLimitMB < 16) {
+		return fmt.Errorf("memory_limit_mb must be 0 or at least 16 (got: %d)", r.MemoryLimitMB)
+	}
+	if r.GCPercent < -1 {
+		return fmt.Errorf("gc_percent must be -1 (off), 0 (unset) or positive (got: %d)", r.GCPercent)
+	}
+	if r.GCPercent == -1 && r.MemoryLimitMB == 0 {
+		return fmt.Errorf("gc_percent -1 requires memory_limit_mb, or the heap grows without bound")
+	}
+	if r.MaxProcs < 0 {
+		return fmt.Errorf("max_procs must not be negative (got: %d)", r.MaxProcs)
+	}
+	if r.MaxConcurrentJobs < 0 {
+		return fmt.Errorf("max_concurrent_jobs must not be negative (got: %d)", r.MaxConcurrentJobs)
+	}
+
+	if d := r.DiskGuard; d.MinFreeMB != 0 {
+		if d.MinFreeMB < 0 {
+			return fmt.Errorf("disk_guard.min_free_mb must not be negative (got: %d)", d.MinFreeMB)
+		}
+		if d.Interval < 10*time.Second {
+			return fmt.Errorf("disk_guard.interval must be at least 10s (got: %v)", d.Interval)
+		}
+	}
+
+	w := r.Watchdog
+	if w.RSSLimitMB == 0 {
+		return nil
+	}
+	if w.RSSLimitMB < 32 {
+		return fmt.Errorf("watchdog.rss_limit_mb must be 0 or at least 32 (got: %d)", w.RSSLimitMB)
+	}
+	if r.MemoryLimitMB > 0 && w.RSSLimitMB <= r.MemoryLimitMB {
+		return fmt.Errorf("watchdog.rss_limit_mb (%d) must be above memory_limit_mb (%d)", w.RSSLimitMB, r.MemoryLimitMB)
+	}
+	if w.Interval < time.Second {
+		return fmt.Errorf("watchdog.interval must be at least 1s (got: %v)", w.Interval)
+	}
+	return nil
+}
+
+// validateRegistry checks the key whitelist
+func validateRegistry(r *RegistryConfig) error {
+	if len(r.Keys) == 0 {
+		return fmt.Errorf("keys: at least one key is required")
+	}
+	for i, key := range r.Keys {
+		if !validRegistryPath(key.Path) {
+			return fmt.Errorf("keys[%d].path must be a key under HKLM or HKU (got: %q)", i, key.Path)
+		}
+		if key.Access != "read" && key.Access != "write" {
+			return fmt.Errorf("keys[%d].access must be read or write (got: %q)", i, key.Access)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("enabled: the registry is only supported on Windows")
+	}
+	return nil
+}
+
+// validateCgroups checks the cgroup patterns: relative paths under
+// /sys/fs/cgroup that stay inside it
+func validateCgroups(patterns []string) error {
+	if len(patterns) > 20 {
+		return fmt.Errorf("cgroups must not have more than 20 entries (got: %d)", len(patterns))
+	}
+	for i, pattern := range patterns {
+		if pattern == "" || strings.HasPrefix(pattern, "/") || slices.Contains(strings.Split(pattern, "/"), "..") {
+			return fmt.Errorf("cgroups[%d] must be a path relative to /sys/fs/cgroup (got: %q)", i, pattern)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("cgroups[%d] is not a valid pattern (got: %q): %w", i, pattern, err)
+		}
+	}
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("cgroups: cgroup metrics are only supported on Linux")
+	}
+	return nil
+}
+
+// validateCounters checks the pdh source's performance counter paths:
+// \Object\Counter or \Object(Instance)\Counter on the local machine
+func validateCounters(paths []string) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("counters is required when source is 'pdh'")
+	}
+	if len(paths) > 100 {
+		return fmt.Errorf("counters must not have more than 100 entries (got: %d)", len(paths))
+	}
+	validPath := regexp.MustCompile(`^\\[^\\(]+(\(.+\))?\\[^\\]+$`)
+	for i, path := range paths {
+		if !validPath.MatchString(path) {
+			return fmt.Errorf("counters[%d] must be a local counter path like \\Object(Instance)\\Counter (got: %q)", i, path)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("source: 'pdh' is only supported on Windows")
+	}
+	return nil
+}
+
+// validateIIS checks the IIS app pool and site whitelists
+func validateIIS(iis *IISConfig) error {
+	if len(iis.AppPools) == 0 && len(iis.Sites) == 0 {
+		return fmt.Errorf("app_pools: at least one app pool or site is required")
+	}
+	validName := regexp.MustCompile(`^[^"\x00-\x1f]+$`)
+	for _, list := range []struct {
+		field string
+		names []string
+	}{{"app_pools", iis.AppPools}, {"sites", iis.Sites}} {
+		seen := make(map[string]bool)
+		for i, name := range list.names {
+			if !validName.MatchString(name) || strings.TrimSpace(name) != name {
+				return fmt.Errorf("%s[%d] is not a valid name (got: %q)", list.field, i, name)
+			}
+			if seen[strings.ToLower(name)] {
+				return fmt.Errorf("%s[%d] is a duplicate (got: %q)", list.field, i, name)
+			}
+			seen[strings.ToLower(name)] = true
+		}
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("enabled: IIS is only supported on Windows")
+	}
+	return nil
+}
+
+// validateNetTest checks the test duration against the command timeout and
+// the targets
+func validateNetTest(c *NetTestConfig, commandTimeout time.Duration) error {
+	if c.MaxDuration < time.Second || c.MaxDuration > time.Minute {
+		return fmt.Errorf("max_duration must be between 1s and 1m (got: %v)", c.MaxDuration)
+	}
+	if c.MaxDuration+5*time.Second > commandTimeout {
+		return fmt.Errorf("max_duration must be at least 5s less than commands.timeout (got: %v, timeout %v)", c.MaxDuration, commandTimeout)
+	}
+	if len(c.Targets) == 0 {
+		return fmt.Errorf("targets: at least one target is required")
+	}
+	validName := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	validHost := regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.:-]*$`)
+	seen := make(map[string]bool)
+	for i, target := range c.Targets {
+		if !validName.MatchString(target.Name) {
+			return fmt.Errorf("targets[%d].name must be alphanumeric, dash, or underscore (got: %q)", i, target.Name)
+		}
+		if seen[target.Name] {
+			return fmt.Errorf("targets[%d].name is a duplicate (got: %q)", i, target.Name)
+		}
+		seen[target.Name] = true
+		switch target.Type {
+		case "iperf3":
+			host, port, err := net.SplitHostPort(target.Address)
+			if err != nil {
+				host, port = target.Address, "5201"
+			}
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 || !validHost.MatchString(host) {
+				return fmt.Errorf("targets[%d].address must be host[:port] (got: %q)", i, target.Address)
+			}
+		case "https":
+			u, err := url.Parse(target.Address)
+			if err != nil || u.Scheme != "https" || u.Host == "" {
+				return fmt.Errorf("targets[%d].address must be an https:// URL (got: %q)", i, target.Address)
+			}
+		default:
+			return fmt.Errorf("targets[%d].type must be iperf3 or https (got: %q)", i, target.Type)
+		}
+	}
+	return nil
+}
+
+// validateTraceroute checks the hop and probe caps and the target hosts
+func validateTraceroute(c *TracerouteConfig, commandTimeout time.Duration) error {
+	if c.MaxHops < 1 || c.MaxHops > 64 {
+		return fmt.Errorf("max_hops must be between 1 and 64 (got: %d)", c.MaxHops)
+	}
+	if c.ProbeTimeout < time.Second || c.ProbeTimeout > 10*time.Second {
+		return fmt.Errorf("probe_timeout must be between 1s and 10s (got: %v)", c.ProbeTimeout)
+	}
+	if c.ProbeTimeout >= commandTimeout {
+		return fmt.Errorf("probe_timeout must be less than commands.timeout (got: %v, timeout %v)", c.ProbeTimeout, commandTimeout)
+	}
+	validHost := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.:-]*$`)
+	for i, target := range c.Targets {
+		if !validHost.MatchString(target) || strings.EqualFold(target, "nats") {
+			return fmt.Errorf("targets[%d] must be a hostname or IP address (got: %q)", i, target)
+		}
+	}
+	return nil
+}
+
+// validateDiag checks the diagnostics bundle bucket and sizes
+func validateDiag(c *DiagConfig) error {
+	if !regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString(c.Bucket) {
+		return fmt.Errorf("bucket must be alphanumeric, dash, or underscore (got: %q)", c.Bucket)
+	}
+	if c.LogLines < 1 || c.LogLines > 10000 {
+		return fmt.Errorf("log_lines must be between 1 and 10000 (got: %d)", c.LogLines)
+	}
+	if c.TelemetryPayloads < 0 || c.TelemetryPayloads > 200 {
+		return fmt.Errorf("telemetry_payloads must be between 0 and 200 (got: %d)", c.TelemetryPayloads)
+	}
+	return nil
+}
+
+// broadcastCommands are the commands that may be served fleet-wide: read-only
+// ones, whose replies are useful side by side
+var broadcastCommands = map[string]bool{"ping": true, "health": true, "logs": true, "traceroute": true}
+
+// validateBroadcast checks the fleet-wide commands and tags. "broadcast"
+// takes the place of the code in fleet-wide subjects, so no agent or
+// gateway child may use it as its code.
+func validateBroadcast(cfg *Config) error {
+	c := &cfg.Commands.Broadcast
+	if len(c.Commands) == 0 {
+		return fmt.Errorf("commands must not be empty")
+	}
+	seen := make(map[string]bool)
+	for i, command := range c.Commands {
+		if !broadcastCommands[command] {
+			return fmt.Errorf("commands[%d] must be one of ping, health, logs, traceroute (got: %q)", i, command)
+		}
+		if seen[command] {
+			return fmt.Errorf("commands[%d] is a duplicate (got: %q)", i, command)
+		}
+		seen[command] = true
+	}
+
+	validToken := regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	for i, tag := range c.Tags {
+		if !validToken.MatchString(tag) {
+			return fmt.Errorf("tags[%d] is not a valid tag key (got: %q)", i, tag)
+		}
+		if value, ok := cfg.Tags[tag]; ok && !validToken.MatchString(value) {
+			return fmt.Errorf("tags[%d]: the value of tag %s must contain only alphanumeric characters, dashes, and underscores to be used in subjects (got: %q)", i, tag, value)
+		}
+	}
+
+	if c.MaxDelay < 0 || c.MaxDelay > 30*time.Second {
+		return fmt.Errorf("max_delay must be between 0 and 30s (got: %v)", c.MaxDelay)
+	}
+	// Broadcast replies aren't chunked, so they must fit the default 1MB
+	// max_payload with room for the envelope
+	if c.MaxReplyBytes < 1024 || c.MaxReplyBytes > 512*1024 {
+		return fmt.Errorf("max_reply_bytes must be between 1024 and 524288 (got: %d)", c.MaxReplyBytes)
+	}
+
+	codes := []string{cfg.Code}
+	for _, child := range cfg.Gateway.Children {
+		codes = append(codes, child.Code)
+	}
+	for _, code := range codes {
+		if code == "broadcast" {
+			return fmt.Errorf("enabled: the code %q is reserved for fleet-wide subjects", code)
+		}
+	}
+	return nil
+}
+
+// validateScheduledTasks checks the Scheduled Task whitelist: full task
+// paths such as \Vendor\Sync, unique ignoring case
+func validateScheduledTasks(paths []string) error {
+	validSegment := regexp.MustCompile(`^[^\\/:*?"'<>|\x00-\x1f]+$`)
+	seen := make(map[string]bool)
+	for i, path := range paths {
+		segments := strings.Split(path, `\`)
+		if len(segments) < 2 || segments[0] != "" {
+			return fmt.Errorf("allowed_scheduled_tasks[%d] must be a full task path starting with \\ (got: %q)", i, path)
+		}
+		for _, segment := range segments[1:] {
+			if !validSegment.MatchString(segment) {
+				return fmt.Errorf("allowed_scheduled_tasks[%d] is not a valid task path (got: %q)", i, path)
+			}
+		}
+		if seen[strings.ToLower(path)] {
+			return fmt.Errorf("allowed_scheduled_tasks[%d] is a duplicate (got: %q)", i, path)
+		}
+		seen[strings.ToLower(path)] = true
+	}
+	if runtime.GOOS != "windows" {
+		return fmt.Errorf("allowed_scheduled_tasks: Scheduled Tasks are only supported on Windows")
+	}
+	return nil
+}
+
+// validRegistryPath reports whether path names a key (not a hive root)
+// under HKLM or HKU
+func validRegistryPath(path string) bool {
+	root, subkey, _ := strings.Cut(path, `\`)
+	switch strings.ToUpper(root) {
+	case "HKLM", "HKEY_LOCAL_MACHINE", "HKU", "HKEY_USERS":
+	default:
+		return false
+	}
+	subkey = strings.Trim(subkey, `\`)
+	return subkey != "" && !strings.Contains(subkey, `\\`)
+}
+
+// firewallBackends are the cmd.firewall backends by platform, and the
+// profiles each can switch
+var firewallBackends = map[string]struct {
+	goos     string
+	profiles []string
+}{
+	"netsh":    {"windows", []string{"domain", "private", "public", "all"}},
+	"nftables": {"linux", nil},
+	"ufw":      {"linux", []string{"all"}},
+}
+
+// validateFirewall checks the backend, the profile whitelist and the
+// pre-approved rules
+func validateFirewall(f *FirewallConfig) error {
+	backend, ok := firewallBackends[f.Backend]
+	if !ok {
+		return fmt.Errorf("backend must be netsh, nftables, or ufw (got: %q)", f.Backend)
+	}
+	if backend.goos != runtime.GOOS {
+		return fmt.Errorf("backend %s is only supported on %s", f.Backend, backend.goos)
+	}
+	for _, profile := range f.Profiles {
+		if !slices.Contains(backend.profiles, profile) {
+			if len(backend.profiles) == 0 {
+				return fmt.Errorf("profiles are not supported by the %s backend", f.Backend)
+			}
+			return fmt.Errorf("profiles: %s supports %s (got: %q)", f.Backend, strings.Join(backend.profiles, ", "), profile)
+		}
+	}
+	if f.Backend == "nftables" && !regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,31}$`).MatchString(f.Table) {
+		return fmt.Errorf("table must be a letter followed by up to 31 alphanumeric or underscore characters (got: %q)", f.Table)
+	}
+	if len(f.Profiles) == 0 && len(f.Rules) == 0 {
+		return fmt.Errorf("profiles or rules is required")
+	}
+
+	validName := regexp.MustCompile(`^[a-z0-9_-]{1,48}$`)
+	validPorts := regexp.MustCompile(`^([0-9]{1,5})(-([0-9]{1,5}))?$`)
+	names := make(map[string]bool)
+	for i, rule := range f.Rules {
+		if !validName.MatchString(rule.Name) {
+			return fmt.Errorf("rules[%d].name must be 1-48 lowercase alphanumeric, dash, or underscore characters (got: %q)", i, rule.Name)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule name: %s", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Direction != "in" && rule.Direction != "out" {
+			return fmt.Errorf("rule %s: direction must be in or out (got: %q)", rule.Name, rule.Direction)
+		}
+		if rule.Action != "allow" && rule.Action != "block" {
+			return fmt.Errorf("rule %s: action must be allow or block (got: %q)", rule.Name, rule.Action)
+		}
+		switch rule.Protocol {
+		case "tcp", "udp":
+		case "any":
+			if rule.Ports != "" {
+				return fmt.Errorf("rule %s: ports need protocol tcp or udp", rule.Name)
+			}
+		default:
+			return fmt.Errorf("rule %s: protocol must be tcp, udp, or any (got: %q)", rule.Name, rule.Protocol)
+		}
+		if rule.Ports != "" {
+			m := validPorts.FindStringSubmatch(rule.Ports)
+			if m == nil {
+				return fmt.Errorf("rule %s: ports must be a port or a range such as 8000-8100 (got: %q)", rule.Name, rule.Ports)
+			}
+			low, _ := strconv.Atoi(m[1])
+			high := low
+			if m[3] != "" {
+				high, _ = strconv.Atoi(m[3])
+			}
+			if low < 1 || high > 65535 || high < low {
+				return fmt.Errorf("rule %s: ports must be between 1 and 65535, low to high (got: %q)", rule.Name, rule.Ports)
+			}
+		}
+		if rule.Remote != "" {
+			if _, _, err := net.ParseCIDR(rule.Remote); err != nil && net.ParseIP(rule.Remote) == nil {
+				return fmt.Errorf("rule %s: remote must be an IP address or CIDR (got: %q)", rule.Name, rule.Remote)
+			}
+		}
+	}
+	return nil
+}
+
+// validateReloadPidfiles checks that reload pidfiles name allowed services
+// once each, with absolute paths, on a platform with SIGHUP
+func validateReloadPidfiles(c *CommandsConfig) error {
+	seen := make(map[string]bool)
+	for i, reload := range c.ReloadPidfiles {
+		if !slices.Contains(c.AllowedServices, reload.Service) {
+			return fmt.Errorf("reload_pidfiles[%d]: service %q is not in commands.allowed_services", i, reload.Service)
+		}
+		if seen[reload.Service] {
+			return fmt.Errorf("reload_pidfiles[%d]: duplicate service %q", i, reload.Service)
+		}
+		seen[reload.Service] = true
+		if !filepath.IsAbs(reload.Pidfile) {
+			return fmt.Errorf("reload_pidfiles[%d].pidfile must be an absolute path (got: %q)", i, reload.Pidfile)
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("reload_pidfiles: reload by SIGHUP is not supported on Windows")
+	}
+	return nil
+}
+
+// validateServiceDependencies checks that verify_timeout is within 1s-5m,
+// that every service and dependency is in allowed_services, and that the
+// dependencies have no duplicates, self-references or cycles
+func validateServiceDependencies(c *CommandsConfig) error {
+	d := &c.ServiceDependencies
+	if d.VerifyTimeout < time.Second || d.VerifyTimeout > 5*time.Minute {
+		return fmt.Errorf("verify_timeout must be between 1s and 5m (got: %v)", d.VerifyTimeout)
+	}
+
+	dependsOn := make(map[string][]string)
+	for i, dep := range d.Services {
+		if !slices.Contains(c.AllowedServices, dep.Service) {
+			return fmt.Errorf("services[%d]: service %q is not in commands.allowed_services", i, dep.Service)
+		}
+		if _, ok := dependsOn[dep.Service]; ok {
+			return fmt.Errorf("services[%d]: duplicate service %q", i, dep.Service)
+		}
+		if len(dep.DependsOn) == 0 {
+			return fmt.Errorf("services[%d].depends_on must not be empty", i)
+		}
+		for _, parent := range dep.DependsOn {
+			if !slices.Contains(c.AllowedServices, parent) {
+				return fmt.Errorf("services[%d].depends_on: service %q is not in commands.allowed_services", i, parent)
+			}
+			if parent == dep.Service {
+				return fmt.Errorf("services[%d]: %s depends on itself", i, dep.Service)
+			}
+		}
+		dependsOn[dep.Service] = dep.DependsOn
+	}
+
+	// Depth-first search for a cycle, which would have no restart order
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(service string) error
+	visit = func(service string) error {
+		switch state[service] {
+		case visiting:
+			return fmt.Errorf("services: dependency cycle through %s", service)
+		case done:
+			return nil
+		}
+		state[service] = visiting
+		for _, parent := range dependsOn[service] {
+			if err := visit(parent); err != nil {
+				return err
+			}
+		}
+		state[service] = done
+		return nil
+	}
+	for _, dep := range d.Services {
+		if err := visit(dep.Service); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRateLimits checks that limits name valid command patterns once
+// each, with per_minute between 0 (unlimited) and 6000
+func validateRateLimits(r *RateLimitsConfig) error {
+	if len(r.Limits) == 0 {
+		return fmt.Errorf("limits: at least one limit is required")
+	}
+	validCommand := regexp.MustCompile(`^(\*|[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*(\.\*)?)$`)
+	seen := make(map[string]bool)
+	for i, limit := range r.Limits {
+		if !validCommand.MatchString(limit.Command) {
+			return fmt.Errorf("limits[%d]: invalid command %q (a command name, a prefix ending in .*, or *)", i, limit.Command)
+		}
+		if seen[limit.Command] {
+			return fmt.Errorf("limits[%d]: duplicate command %q", i, limit.Command)
+		}
+		seen[limit.Command] = true
+		if limit.PerMinute < 0 || limit.PerMinute > 6000 {
+			return fmt.Errorf("limits[%d].per_minute must be between 0 and 6000 (got: %d)", i, limit.PerMinute)
+		}
+	}
+	return nil
+}
+
+// validateCommandAuth checks the identity source and the role permissions
+func validateCommandAuth(a *CommandAuthConfig) error {
+	switch a.Identity {
+	case "signed":
+		if len(a.TrustedKeys) == 0 {
+			return fmt.Errorf("trusted_keys is required with identity signed")
+		}
+		for _, key := range a.TrustedKeys {
+			if !nkeys.IsValidPublicKey(key) {
+				return fmt.Errorf("trusted_keys: invalid nkey public key %q", key)
+			}
+		}
+		if a.MaxSkew <= 0 {
+			return fmt.Errorf("max_skew must be positive (got: %v)", a.MaxSkew)
+		}
+	case "request_info":
+	default:
+		return fmt.Errorf("identity must be signed or request_info (got: %q)", a.Identity)
+	}
+
+	if len(a.Roles) == 0 {
+		return fmt.Errorf("roles: at least one role is required")
+	}
+	validRole := regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+	validCommand := regexp.MustCompile(`^(\*|[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*(\.\*)?)$`)
+	for role, commands := range a.Roles {
+		if !validRole.MatchString(role) {
+			return fmt.Errorf("roles: invalid role name %q (lowercase letters, digits, - and _)", role)
+		}
+		for _, command := range commands {
+			if !validCommand.MatchString(command) {
+				return fmt.Errorf("roles.%s: invalid command %q (a command name, a prefix ending in .*, or *)", role, command)
+			}
+		}
+	}
+	if a.DefaultRole != "" {
+		if _, ok := a.Roles[a.DefaultRole]; !ok {
+			return fmt.Errorf("default_role %q is not defined in roles", a.DefaultRole)
+		}
+	}
 	return nil
 }
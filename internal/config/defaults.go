@@ -9,7 +9,10 @@ type PlatformDefaults struct {
 	LogFile          string
 	ScriptsDirectory string
 	ConfigPath       string
+	DataDir          string // Agent state kept across restarts
 	ExporterURL      string
+	ControlSocket    string // Local admin channel for agentctl (named pipe on Windows)
+	FirewallBackend  string // cmd.firewall backend ("" = none)
 }
 
 // GetPlatformDefaults returns platform-specific defaults based on runtime.GOOS
@@ -20,21 +23,29 @@ func GetPlatformDefaults() PlatformDefaults {
 			LogFile:          `C:\ProgramData\Agent\agent.log`,
 			ScriptsDirectory: `C:\ProgramData\Agent\Scripts`,
 			ConfigPath:       `C:\ProgramData\Agent\config.yaml`,
+			DataDir:          `C:\ProgramData\Agent\data`,
 			ExporterURL:      "http://localhost:9182/metrics", // windows_exporter
+			ControlSocket:    `\\.\pipe\agent`,
+			FirewallBackend:  "netsh",
 		}
 	case "linux":
 		return PlatformDefaults{
 			LogFile:          "/var/log/agent/agent.log",
 			ScriptsDirectory: "/opt/agent/scripts",
 			ConfigPath:       "/etc/agent/config.yaml",
+			DataDir:          "/var/lib/agent",
 			ExporterURL:      "http://localhost:9100/metrics", // node_exporter
+			ControlSocket:    "/run/agent/agent.sock",
+			FirewallBackend:  "nftables",
 		}
 	case "freebsd":
 		return PlatformDefaults{
 			LogFile:          "/var/log/agent/agent.log",
 			ScriptsDirectory: "/usr/local/etc/agent/scripts",
 			ConfigPath:       "/usr/local/etc/agent/config.yaml",
+			DataDir:          "/var/db/agent",
 			ExporterURL:      "http://localhost:9100/metrics", // node_exporter
+			ControlSocket:    "/var/run/agent/agent.sock",
 		}
 	default:
 		// Fallback to Linux-like defaults for unknown platforms
@@ -42,7 +53,9 @@ func GetPlatformDefaults() PlatformDefaults {
 			LogFile:          "/var/log/agent/agent.log",
 			ScriptsDirectory: "/opt/agent/scripts",
 			ConfigPath:       "/etc/agent/config.yaml",
+			DataDir:          "/var/lib/agent",
 			ExporterURL:      "http://localhost:9100/metrics",
+			ControlSocket:    "/run/agent/agent.sock",
 		}
 	}
 }
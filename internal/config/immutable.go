@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// Where an immutable agent keeps what it writes (immutable.state)
+const (
+	ImmutableStateDataDir = "data_dir"
+	ImmutableStateMemory  = "memory"
+)
+
+// applyImmutable moves the default paths the agent writes off the root
+// filesystem: under data_dir, or nowhere for the memory state. Like
+// applyProfile it only replaces defaults, so configured paths are kept
+// (and checked for writability at startup).
+func applyImmutable(v *viper.Viper) {
+	if !v.GetBool("immutable.enabled") {
+		return
+	}
+	if v.GetString("immutable.state") == ImmutableStateMemory {
+		v.SetDefault("logging.file", "")
+		return
+	}
+	dataDir := v.GetString("data_dir")
+	v.SetDefault("logging.file", filepath.Join(dataDir, "log", "agent.log"))
+	v.SetDefault("nats.auth.secret_key_file", filepath.Join(dataDir, "secrets.key"))
+}
+
+// StateInMemory reports whether the agent keeps no state files
+// (immutable.state: memory)
+func StateInMemory(cfg *Config) bool {
+	return cfg.Immutable.Enabled && cfg.Immutable.State == ImmutableStateMemory
+}
+
+func validateImmutable(cfg *Config) error {
+	i := cfg.Immutable
+	switch i.State {
+	case "", ImmutableStateDataDir:
+		return nil
+	case ImmutableStateMemory:
+	default:
+		return fmt.Errorf("state must be %q or %q (got: %s)", ImmutableStateDataDir, ImmutableStateMemory, i.State)
+	}
+	if !i.Enabled {
+		return nil
+	}
+
+	// These providers write the credentials they fetch to creds_file
+	switch cfg.NATS.Auth.Type {
+	case "pocketbase", "http", "vault":
+		return fmt.Errorf("state %q can't be used with %s auth, which writes a credentials file; use state %q", ImmutableStateMemory, cfg.NATS.Auth.Type, ImmutableStateDataDir)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Profiles are sets of defaults for a class of device, selected with the
+// top-level profile key. A profile only changes defaults: anything set in
+// the config file still wins.
+const (
+	ProfileStandard    = "standard"
+	ProfileLowResource = "low-resource"
+)
+
+// profileDefaults holds the defaults each profile overrides. standard is
+// the base defaults from setDefaults.
+var profileDefaults = map[string]map[string]any{
+	ProfileStandard: {},
+
+	// Small ARM gateways (256MB RAM): collect less, less often, buffer less
+	// and keep the heap and scheduler concurrency down
+	ProfileLowResource: {
+		"tasks.system_metrics.interval":    "15m",
+		"tasks.system_metrics.disk_io":     false,
+		"tasks.service_check.interval":     "5m",
+		"tasks.inventory.interval":         "168h",
+		"nats.reconnect_buf_size_mb":       1,
+		"nats.publish_limits.queue_size":   20,
+		"commands.diag.telemetry_payloads": 5,
+		"logging.max_size_mb":              10,
+		"logging.max_backups":              1,
+		"logging.ship.batch_size":          20,
+		"runtime.memory_limit_mb":          64,
+		"runtime.gc_percent":               50,
+		"runtime.max_procs":                2,
+		"runtime.max_concurrent_jobs":      2,
+	},
+}
+
+// applyProfile replaces the base defaults with those of the configured
+// profile. It runs after the config file is read, so explicit values are
+// kept.
+func applyProfile(v *viper.Viper) error {
+	profile := v.GetString("profile")
+	if profile == "" {
+		return nil
+	}
+	defaults, ok := profileDefaults[profile]
+	if !ok {
+		return fmt.Errorf("unknown profile: %s (must be one of: %s)", profile, strings.Join(profileNames(), ", "))
+	}
+	for key, value := range defaults {
+		v.SetDefault(key, value)
+	}
+	return nil
+}
+
+// profileNames returns the known profiles, sorted
+func profileNames() []string {
+	names := make([]string, 0, len(profileDefaults))
+	for name := range profileDefaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
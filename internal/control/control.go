@@ -0,0 +1,267 @@
+// Package control serves the local admin channel used by agentctl: a unix
+// socket on Linux/FreeBSD and a named pipe on Windows. It lets on-site
+// technicians without NATS access check status, run a task, reload the
+// config and change the log level. Access is controlled by the socket's
+// file permissions (or the pipe's ACL); there is no other authentication.
+//
+// The protocol is one JSON Request line from the client, answered by one
+// JSON Response line, after which the connection is closed.
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// maxRequestBytes bounds a request line
+const maxRequestBytes = 64 * 1024
+
+// shutdownTimeout bounds how long in-flight requests may delay shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Commands understood by the server
+const (
+	CommandStatus   = "status"
+	CommandTaskRun  = "task.run"
+	CommandReload   = "config.reload"
+	CommandLogLevel = "log.level"
+)
+
+// Request is sent by agentctl
+type Request struct {
+	Command string `json:"command"`
+	Task    string `json:"task,omitempty"`  // task.run
+	Level   string `json:"level,omitempty"` // log.level (empty = report the current level)
+}
+
+// Response answers a Request
+type Response struct {
+	Status  string          `json:"status"` // "success" or "error"
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"` // status: the cmd.health response
+	Error   string          `json:"error,omitempty"`
+	TS      string          `json:"ts"`
+}
+
+// Actions are the agent operations exposed on the channel
+type Actions struct {
+	Status   func() ([]byte, error)
+	RunTask  func(task string) error
+	Reload   func() error
+	LogLevel func(level string) (string, error) // Sets level if non-empty; returns the level now in effect
+}
+
+// Server is the local admin channel
+type Server struct {
+	socket  string
+	actions Actions
+	logger  *zap.Logger
+
+	ln       listener
+	inflight sync.WaitGroup
+}
+
+// listener accepts admin connections (unix socket or named pipe)
+type listener interface {
+	Accept() (io.ReadWriteCloser, error)
+	Close() error
+}
+
+// NewServer creates the admin channel on socket
+func NewServer(socket string, actions Actions, logger *zap.Logger) *Server {
+	return &Server{
+		socket:  socket,
+		actions: actions,
+		logger:  logger,
+	}
+}
+
+// Start creates the socket and serves in the background. Creation happens
+// synchronously so a path conflict is reported to the caller.
+func (s *Server) Start() error {
+	ln, err := listen(s.socket)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.socket, err)
+	}
+	s.ln = ln
+
+	s.logger.Info("Control channel listening", zap.String("socket", s.socket))
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					s.logger.Error("Control channel stopped", zap.Error(err))
+				}
+				return
+			}
+			s.inflight.Add(1)
+			go func() {
+				defer s.inflight.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown closes the socket, waiting briefly for in-flight requests (a
+// config.reload reply is written just before the agent shuts down)
+func (s *Server) Shutdown() error {
+	if s.ln == nil {
+		return nil
+	}
+	err := s.ln.Close()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		s.logger.Warn("Control channel requests still in flight at shutdown")
+	}
+	return err
+}
+
+// serve answers one request
+func (s *Server) serve(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	// Unix sockets support deadlines; named pipes opened for synchronous
+	// I/O do not, and are only reachable by administrators anyway
+	if dc, ok := conn.(interface{ SetDeadline(time.Time) error }); ok {
+		dc.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	var resp *Response
+	line, err := bufio.NewReader(io.LimitReader(conn, maxRequestBytes)).ReadBytes('\n')
+	var req Request
+	if err != nil && !errors.Is(err, io.EOF) {
+		resp = errorResponse(fmt.Errorf("failed to read request: %w", err))
+	} else if err := json.Unmarshal(line, &req); err != nil {
+		resp = errorResponse(fmt.Errorf("invalid request: %w", err))
+	} else {
+		resp = s.handle(&req)
+	}
+
+	if resp.Status == "error" {
+		s.logger.Warn("Control request failed", zap.String("command", req.Command), zap.String("error", resp.Error))
+	} else {
+		s.logger.Info("Control request completed", zap.String("command", req.Command))
+	}
+
+	resp.TS = utils.NowRFC3339()
+	data, err := json.Marshal(resp)
+	if err != nil {
+		s.logger.Error("Failed to marshal control response", zap.Error(err))
+		return
+	}
+	conn.Write(append(data, '\n'))
+}
+
+// handle dispatches a request to its action
+func (s *Server) handle(req *Request) *Response {
+	switch req.Command {
+	case CommandStatus:
+		data, err := s.actions.Status()
+		if err != nil {
+			return errorResponse(err)
+		}
+		return &Response{Status: "success", Data: data}
+
+	case CommandTaskRun:
+		if req.Task == "" {
+			return errorResponse(fmt.Errorf("task is required"))
+		}
+		if err := s.actions.RunTask(req.Task); err != nil {
+			return errorResponse(err)
+		}
+		return &Response{Status: "success", Message: fmt.Sprintf("task %s started", req.Task)}
+
+	case CommandReload:
+		if err := s.actions.Reload(); err != nil {
+			return errorResponse(err)
+		}
+		return &Response{Status: "success", Message: "config is valid; agent is restarting with it"}
+
+	case CommandLogLevel:
+		level, err := s.actions.LogLevel(req.Level)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if req.Level == "" {
+			return &Response{Status: "success", Message: fmt.Sprintf("log level is %s", level)}
+		}
+		return &Response{Status: "success", Message: fmt.Sprintf("log level set to %s until the next restart or reload", level)}
+
+	default:
+		return errorResponse(fmt.Errorf("unknown command: %q", req.Command))
+	}
+}
+
+func errorResponse(err error) *Response {
+	return &Response{Status: "error", Error: err.Error()}
+}
+
+// Do sends req to the agent listening on socket and returns its response.
+// Used by agentctl.
+func Do(socket string, req *Request, timeout time.Duration) (*Response, error) {
+	conn, err := dial(socket, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s (is the agent running with control.enabled?): %w", socket, err)
+	}
+
+	type result struct {
+		resp *Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := exchange(conn, req)
+		done <- result{resp, err}
+	}()
+
+	select {
+	case r := <-done:
+		conn.Close()
+		return r.resp, r.err
+	case <-time.After(timeout):
+		conn.Close()
+		return nil, fmt.Errorf("no response from agent within %v", timeout)
+	}
+}
+
+// exchange writes one request and reads one response
+func exchange(conn io.ReadWriter, req *Request) (*Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,123 @@
+//go:build !windows
+
+package control
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// testServer starts a server on a socket in a temp directory
+func testServer(t *testing.T, actions Actions) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	s := NewServer(socket, actions, zap.NewNop())
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() { s.Shutdown() })
+	return socket
+}
+
+// TestControlRoundTrip tests each command over a real unix socket
+func TestControlRoundTrip(t *testing.T) {
+	var ranTask, level string
+	socket := testServer(t, Actions{
+		Status: func() ([]byte, error) { return []byte(`{"status":"healthy"}`), nil },
+		RunTask: func(task string) error {
+			if task == "bogus" {
+				return errors.New("unknown or disabled task: bogus")
+			}
+			ranTask = task
+			return nil
+		},
+		Reload: func() error { return errors.New("invalid config: code is required") },
+		LogLevel: func(l string) (string, error) {
+			if l != "" {
+				level = l
+			}
+			return "debug", nil
+		},
+	})
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr string
+		want    string
+	}{
+		{name: "status", req: Request{Command: CommandStatus}, want: `{"status":"healthy"}`},
+		{name: "task run", req: Request{Command: CommandTaskRun, Task: "inventory"}, want: "task inventory started"},
+		{name: "task run without task", req: Request{Command: CommandTaskRun}, wantErr: "task is required"},
+		{name: "task run unknown", req: Request{Command: CommandTaskRun, Task: "bogus"}, wantErr: "unknown or disabled task"},
+		{name: "reload invalid config", req: Request{Command: CommandReload}, wantErr: "code is required"},
+		{name: "log level get", req: Request{Command: CommandLogLevel}, want: "log level is debug"},
+		{name: "log level set", req: Request{Command: CommandLogLevel, Level: "debug"}, want: "log level set to debug"},
+		{name: "unknown", req: Request{Command: "reboot"}, wantErr: "unknown command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := Do(socket, &tt.req, 5*time.Second)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if tt.wantErr != "" {
+				if resp.Status != "error" || !strings.Contains(resp.Error, tt.wantErr) {
+					t.Errorf("response = %+v, want error containing %q", resp, tt.wantErr)
+				}
+				return
+			}
+			if resp.Status != "success" {
+				t.Fatalf("response = %+v, want success", resp)
+			}
+			got := resp.Message
+			if len(resp.Data) > 0 {
+				got = string(resp.Data)
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("response = %q, want prefix %q", got, tt.want)
+			}
+		})
+	}
+
+	if ranTask != "inventory" {
+		t.Errorf("RunTask got %q, want inventory", ranTask)
+	}
+	if level != "debug" {
+		t.Errorf("LogLevel got %q, want debug", level)
+	}
+}
+
+// TestListenSocket tests socket permissions and stale socket handling
+func TestListenSocket(t *testing.T) {
+	socket := testServer(t, Actions{})
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	// A second server on a live socket must fail
+	if _, err := listen(socket); err == nil {
+		t.Error("listen() on a live socket should fail")
+	}
+
+	// A regular file is never removed
+	file := filepath.Join(t.TempDir(), "not-a-socket")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(file); err == nil {
+		t.Error("listen() over a regular file should fail")
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+
+package control
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// unixListener adapts a unix socket listener
+type unixListener struct {
+	net.Listener
+}
+
+func (l unixListener) Accept() (io.ReadWriteCloser, error) {
+	return l.Listener.Accept()
+}
+
+// listen creates the unix socket, readable and writable by its owner only.
+// A stale socket left by a crashed agent is removed; a live one is an error.
+func listen(socket string) (listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if info, err := os.Lstat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", socket)
+		}
+		if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another agent is already listening")
+		}
+		if err := os.Remove(socket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0600); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return unixListener{ln}, nil
+}
+
+// dial connects to the agent's unix socket
+func dial(socket string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	return net.DialTimeout("unix", socket, timeout)
+}
@@ -0,0 +1,190 @@
+//go:build windows
+
+package control
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// pipeSDDL grants full access to SYSTEM and Administrators only
+const pipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// pipeBufferSize is the in/out buffer size of each pipe instance
+const pipeBufferSize = 64 * 1024
+
+// pipeListener accepts connections on a named pipe. Each Accept waits on a
+// fresh pipe instance using synchronous I/O.
+type pipeListener struct {
+	name string
+	sa   *windows.SecurityAttributes
+
+	mu      sync.Mutex
+	next    windows.Handle // Instance the next Accept waits on
+	closed  bool
+	closing chan struct{}
+}
+
+// listen creates the named pipe. FILE_FLAG_FIRST_PIPE_INSTANCE makes this
+// fail if another process already owns the name.
+func listen(socket string) (listener, error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build pipe security descriptor: %w", err)
+	}
+	l := &pipeListener{
+		name: socket,
+		sa: &windows.SecurityAttributes{
+			Length:             uint32(unsafe.Sizeof(windows.SecurityAttributes{})),
+			SecurityDescriptor: sd,
+		},
+		closing: make(chan struct{}),
+	}
+
+	h, err := l.createInstance(true)
+	if err != nil {
+		return nil, err
+	}
+	l.next = h
+	return l, nil
+}
+
+// createInstance creates one server instance of the pipe
+func (l *pipeListener) createInstance(first bool) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(l.name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(
+		name,
+		flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES,
+		pipeBufferSize,
+		pipeBufferSize,
+		0,
+		l.sa,
+	)
+}
+
+// Accept blocks until a client connects to the pending instance, then
+// creates the instance for the next Accept
+func (l *pipeListener) Accept() (io.ReadWriteCloser, error) {
+	l.mu.Lock()
+	h := l.next
+	l.mu.Unlock()
+	if h == windows.InvalidHandle {
+		return nil, net.ErrClosed
+	}
+
+	err := windows.ConnectNamedPipe(h, nil)
+	if err != nil && !errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		l.mu.Lock()
+		closed := l.closed
+		l.mu.Unlock()
+		if closed {
+			return nil, net.ErrClosed
+		}
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to accept pipe connection: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		// Close connected to us to wake this Accept
+		windows.DisconnectNamedPipe(h)
+		windows.CloseHandle(h)
+		l.next = windows.InvalidHandle
+		close(l.closing)
+		return nil, net.ErrClosed
+	}
+
+	next, err := l.createInstance(false)
+	if err != nil {
+		l.next = windows.InvalidHandle
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to create pipe instance: %w", err)
+	}
+	l.next = next
+
+	return &pipeConn{File: os.NewFile(uintptr(h), l.name), h: h}, nil
+}
+
+// Close stops the listener. ConnectNamedPipe cannot be cancelled on a
+// synchronous handle, so Close connects to the pipe itself to wake Accept.
+func (l *pipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	conn, err := dial(l.name, time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to wake pipe listener: %w", err)
+	}
+	defer conn.Close()
+
+	select {
+	case <-l.closing:
+	case <-time.After(time.Second):
+	}
+	return nil
+}
+
+// pipeConn is a server-side pipe instance. Close flushes and disconnects the
+// client before closing the handle, so a reply is not lost.
+type pipeConn struct {
+	*os.File
+	h windows.Handle
+}
+
+func (c *pipeConn) Close() error {
+	windows.FlushFileBuffers(c.h)
+	windows.DisconnectNamedPipe(c.h)
+	return c.File.Close()
+}
+
+// dial connects to the agent's named pipe, retrying while every instance is
+// busy
+func dial(socket string, timeout time.Duration) (io.ReadWriteCloser, error) {
+	name, err := windows.UTF16PtrFromString(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		h, err := windows.CreateFile(
+			name,
+			windows.GENERIC_READ|windows.GENERIC_WRITE,
+			0,
+			nil,
+			windows.OPEN_EXISTING,
+			windows.SECURITY_SQOS_PRESENT|windows.SECURITY_IDENTIFICATION,
+			0,
+		)
+		if err == nil {
+			return os.NewFile(uintptr(h), socket), nil
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,77 @@
+// Package debug serves the optional runtime debug endpoint: pprof profiles
+// and expvar counters for diagnosing memory growth and goroutine leaks on
+// deployed devices without rebuilding the agent.
+package debug
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// shutdownTimeout bounds how long in-flight profile requests may delay shutdown
+const shutdownTimeout = 5 * time.Second
+
+// Server is the debug HTTP endpoint
+type Server struct {
+	srv    *http.Server
+	logger *zap.Logger
+}
+
+// NewServer creates the debug endpoint. Handlers are registered on a private
+// mux so nothing is exposed through http.DefaultServeMux.
+func NewServer(cfg *config.DebugConfig, logger *zap.Logger) *Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &Server{
+		srv: &http.Server{
+			Addr:              cfg.Listen,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		logger: logger,
+	}
+}
+
+// Start binds the listen address and serves in the background. Binding
+// happens synchronously so a port conflict is reported to the caller.
+func (s *Server) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.srv.Addr, err)
+	}
+
+	s.logger.Info("Debug endpoint listening",
+		zap.String("addr", ln.Addr().String()),
+		zap.String("pprof", "/debug/pprof/"),
+		zap.String("expvar", "/debug/vars"))
+
+	go func() {
+		if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Debug endpoint stopped", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the endpoint, waiting briefly for in-flight requests
+func (s *Server) Shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
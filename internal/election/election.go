@@ -0,0 +1,188 @@
+// Package election elects one agent per site to run singleton tasks, such
+// as polling a shared device, so a site's agents don't all poll it. Agents
+// sharing a site compete for a lease: a key in a NATS KV bucket holding the
+// leader's code. The leader renews it; the bucket's TTL expires it when the
+// leader stops, and the next agent to try takes over.
+package election
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// Store is the lease's KV bucket (a nats.KeyValue)
+type Store interface {
+	Get(key string) (nats.KeyValueEntry, error)
+	Create(key string, value []byte) (uint64, error)
+	Update(key string, value []byte, last uint64) (uint64, error)
+	Delete(key string, opts ...nats.DeleteOpt) error
+}
+
+// BindFunc binds the bucket and returns its TTL, which is the lease
+type BindFunc func() (Store, time.Duration, error)
+
+// Status is the election state, for cmd.health
+type Status struct {
+	Site   string `json:"site"`             // Lease key
+	Leader bool   `json:"leader"`           // This agent holds the lease
+	Holder string `json:"holder,omitempty"` // Code of the agent holding the lease, if known
+}
+
+// Elector campaigns for one site's lease
+type Elector struct {
+	key    string
+	id     string
+	bind   BindFunc
+	logger *zap.Logger
+	now    func() time.Time
+
+	// OnChange is called when this agent gains (true) or loses (false)
+	// the lease. Set before Run; it must not call the Elector.
+	OnChange func(leader bool)
+
+	mu       sync.Mutex
+	store    Store
+	lease    time.Duration
+	revision uint64    // Revision of our lease entry, 0 when not leader
+	renewed  time.Time // Last successful acquire or renew
+	holder   string    // Last known leader
+}
+
+// New creates an elector for the site lease key, campaigning as id (the
+// agent code)
+func New(key, id string, bind BindFunc, logger *zap.Logger) *Elector {
+	return &Elector{key: key, id: id, bind: bind, logger: logger, now: time.Now}
+}
+
+// retryInterval is how often binding the bucket is retried
+const retryInterval = 30 * time.Second
+
+// Run campaigns until ctx is done: the leader renews the lease three times
+// per TTL, and followers try to take it as often
+func (e *Elector) Run(ctx context.Context) {
+	for {
+		interval := e.tick()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Leader reports whether this agent holds an unexpired lease
+func (e *Elector) Leader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leaderLocked()
+}
+
+func (e *Elector) leaderLocked() bool {
+	return e.revision != 0 && e.now().Sub(e.renewed) < e.lease
+}
+
+// Status returns the election state
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Status{Site: e.key, Leader: e.leaderLocked(), Holder: e.holder}
+}
+
+// Release gives up the lease, so another agent takes over at its next try
+// rather than after the TTL
+func (e *Elector) Release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.revision == 0 {
+		return
+	}
+	if err := e.store.Delete(e.key, nats.LastRevision(e.revision)); err != nil {
+		e.logger.Warn("Failed to release site lease", zap.String("site", e.key), zap.Error(err))
+	}
+	e.setLeader(0, "")
+}
+
+// tick binds the bucket if needed, then acquires or renews the lease.
+// It returns the time until the next tick.
+func (e *Elector) tick() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.store == nil {
+		store, ttl, err := e.bind()
+		if err != nil {
+			e.logger.Warn("Site election can't bind its KV bucket", zap.String("site", e.key), zap.Error(err))
+			return retryInterval
+		}
+		e.store, e.lease = store, ttl
+	}
+	interval := e.lease / 3
+
+	if e.revision != 0 {
+		e.renew()
+		return interval
+	}
+
+	revision, err := e.store.Create(e.key, []byte(e.id))
+	if err == nil {
+		e.setLeader(revision, e.id)
+		return interval
+	}
+	if !errors.Is(err, nats.ErrKeyExists) {
+		e.logger.Debug("Failed to acquire site lease", zap.String("site", e.key), zap.Error(err))
+		return interval
+	}
+
+	entry, err := e.store.Get(e.key)
+	if err != nil {
+		return interval
+	}
+	holder := string(entry.Value())
+	if holder == e.id {
+		// Our own lease from before a restart: take it back
+		if revision, err := e.store.Update(e.key, []byte(e.id), entry.Revision()); err == nil {
+			e.setLeader(revision, e.id)
+			return interval
+		}
+	}
+	e.holder = holder
+	return interval
+}
+
+// renew extends our lease. A renewal that conflicts means another agent
+// took over after the lease expired; other failures (NATS unreachable) are
+// retried until the lease runs out, after which we can no longer be sure
+// nobody else has it.
+func (e *Elector) renew() {
+	revision, err := e.store.Update(e.key, []byte(e.id), e.revision)
+	if err == nil {
+		e.revision, e.renewed = revision, e.now()
+		return
+	}
+	if errors.Is(err, nats.ErrKeyExists) || e.now().Sub(e.renewed) >= e.lease {
+		e.logger.Warn("Lost site lease", zap.String("site", e.key), zap.Error(err))
+		e.setLeader(0, "")
+		return
+	}
+	e.logger.Debug("Failed to renew site lease", zap.String("site", e.key), zap.Error(err))
+}
+
+// setLeader records a lease change and reports it
+func (e *Elector) setLeader(revision uint64, holder string) {
+	wasLeader := e.revision != 0
+	e.revision, e.holder = revision, holder
+	if revision != 0 {
+		e.renewed = e.now()
+	}
+	if leader := revision != 0; leader != wasLeader {
+		e.logger.Info("Site leadership changed", zap.String("site", e.key), zap.Bool("leader", leader))
+		if e.OnChange != nil {
+			e.OnChange(leader)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package election
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+)
+
+// memStore is an in-memory Store with KV revision semantics
+type memStore struct {
+	mu       sync.Mutex
+	value    []byte
+	revision uint64
+	seq      uint64
+	down     bool // NATS unreachable
+}
+
+type memEntry struct {
+	value    []byte
+	revision uint64
+}
+
+func (e memEntry) Bucket() string             { return "agent_election" }
+func (e memEntry) Key() string                { return "site.hq" }
+func (e memEntry) Value() []byte              { return e.value }
+func (e memEntry) Revision() uint64           { return e.revision }
+func (e memEntry) Created() time.Time         { return time.Time{} }
+func (e memEntry) Delta() uint64              { return 0 }
+func (e memEntry) Operation() nats.KeyValueOp { return nats.KeyValuePut }
+
+func (s *memStore) Get(key string) (nats.KeyValueEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return nil, nats.ErrTimeout
+	}
+	if s.revision == 0 {
+		return nil, nats.ErrKeyNotFound
+	}
+	return memEntry{value: s.value, revision: s.revision}, nil
+}
+
+func (s *memStore) Create(key string, value []byte) (uint64, error) {
+	return s.Update(key, value, 0)
+}
+
+func (s *memStore) Update(key string, value []byte, last uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return 0, nats.ErrTimeout
+	}
+	if last != s.revision {
+		return 0, fmt.Errorf("%w: wrong last sequence", nats.ErrKeyExists)
+	}
+	s.seq++
+	s.value, s.revision = value, s.seq
+	return s.revision, nil
+}
+
+func (s *memStore) Delete(key string, opts ...nats.DeleteOpt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value, s.revision = nil, 0
+	return nil
+}
+
+// expire removes the key, as the bucket TTL does
+func (s *memStore) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.value, s.revision = nil, 0
+}
+
+func newElector(id string, store *memStore, clock *time.Time) (*Elector, *[]bool) {
+	e := New("site.hq", id, func() (Store, time.Duration, error) { return store, 30 * time.Second, nil }, zap.NewNop())
+	e.now = func() time.Time { return *clock }
+	var changes []bool
+	e.OnChange = func(leader bool) { changes = append(changes, leader) }
+	return e, &changes
+}
+
+func TestElection(t *testing.T) {
+	store := &memStore{}
+	clock := time.Now()
+	a, aChanges := newElector("agent-a", store, &clock)
+	b, _ := newElector("agent-b", store, &clock)
+
+	if interval := a.tick(); interval != 10*time.Second {
+		t.Errorf("tick() interval = %v, want a third of the TTL", interval)
+	}
+	b.tick()
+	if !a.Leader() || b.Leader() {
+		t.Fatalf("leaders = %v, %v; want only agent-a", a.Leader(), b.Leader())
+	}
+	if status := b.Status(); status.Holder != "agent-a" || status.Site != "site.hq" {
+		t.Errorf("follower Status() = %+v", status)
+	}
+
+	// Renewals keep the lease
+	clock = clock.Add(10 * time.Second)
+	a.tick()
+	b.tick()
+	if !a.Leader() || b.Leader() {
+		t.Fatalf("after renewal leaders = %v, %v", a.Leader(), b.Leader())
+	}
+
+	// The leader goes quiet: the TTL expires the key and agent-b takes over
+	clock = clock.Add(40 * time.Second)
+	store.expire()
+	b.tick()
+	if a.Leader() || !b.Leader() {
+		t.Fatalf("after expiry leaders = %v, %v; want only agent-b", a.Leader(), b.Leader())
+	}
+
+	// agent-a comes back and finds its renewal rejected
+	a.tick()
+	if a.Leader() || len(*aChanges) != 2 || (*aChanges)[1] {
+		t.Errorf("agent-a changes = %v, want [true false]", *aChanges)
+	}
+
+	// Releasing hands over at the next try
+	b.Release()
+	a.tick()
+	if !a.Leader() || b.Leader() {
+		t.Errorf("after release leaders = %v, %v; want only agent-a", a.Leader(), b.Leader())
+	}
+}
+
+func TestElectionReclaimsOwnLease(t *testing.T) {
+	store := &memStore{}
+	clock := time.Now()
+	a, _ := newElector("agent-a", store, &clock)
+	a.tick()
+
+	// A restarted agent-a finds its own lease and takes it back
+	restarted, _ := newElector("agent-a", store, &clock)
+	restarted.tick()
+	if !restarted.Leader() {
+		t.Error("restarted agent did not reclaim its lease")
+	}
+}
+
+func TestElectionUnreachable(t *testing.T) {
+	store := &memStore{}
+	clock := time.Now()
+	a, changes := newElector("agent-a", store, &clock)
+	a.tick()
+
+	// A failed renewal is retried while the lease lasts
+	store.down = true
+	clock = clock.Add(10 * time.Second)
+	a.tick()
+	if !a.Leader() {
+		t.Error("leadership lost on the first failed renewal")
+	}
+
+	// Once the lease has run out someone else may hold it
+	clock = clock.Add(25 * time.Second)
+	if a.Leader() {
+		t.Error("Leader() true after the lease expired")
+	}
+	a.tick()
+	if len(*changes) != 2 {
+		t.Errorf("changes = %v, want [true false]", *changes)
+	}
+}
+
+func TestElectionBindFailure(t *testing.T) {
+	e := New("site.hq", "agent-a", func() (Store, time.Duration, error) {
+		return nil, 0, errors.New("bucket not found")
+	}, zap.NewNop())
+	if interval := e.tick(); interval != retryInterval || e.Leader() {
+		t.Errorf("tick() = %v, leader %v; want a retry and no leadership", interval, e.Leader())
+	}
+}
@@ -0,0 +1,139 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// GPIO character device uAPI v2 (linux/gpio.h), Linux 5.10+
+const (
+	lineFlagActiveLow    = 1 << 1
+	lineFlagInput        = 1 << 2
+	lineFlagOutput       = 1 << 3
+	lineFlagBiasPullUp   = 1 << 8
+	lineFlagBiasPullDown = 1 << 9
+	lineFlagBiasDisabled = 1 << 10
+
+	lineAttrOutputValues = 2
+
+	// _IOWR(0xB4, nr, size) in the asm-generic encoding used by arm, arm64,
+	// x86 and riscv
+	ioctlGetLine   = 0xC0000000 | unsafe.Sizeof(lineRequest{})<<16 | 0xB4<<8 | 0x07
+	ioctlGetValues = 0xC0000000 | unsafe.Sizeof(lineValues{})<<16 | 0xB4<<8 | 0x0E
+	ioctlSetValues = 0xC0000000 | unsafe.Sizeof(lineValues{})<<16 | 0xB4<<8 | 0x0F
+)
+
+// consumer labels the agent's lines in gpioinfo
+const consumer = "stone-age-agent"
+
+// struct gpio_v2_line_values
+type lineValues struct {
+	bits uint64
+	mask uint64
+}
+
+// struct gpio_v2_line_config_attribute
+type lineConfigAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64 // flags, values or debounce_period_us
+	mask    uint64
+}
+
+// struct gpio_v2_line_config
+type lineConfig struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [10]lineConfigAttribute
+}
+
+// struct gpio_v2_line_request (592 bytes)
+type lineRequest struct {
+	offsets         [64]uint32
+	consumer        [32]byte
+	config          lineConfig
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+// chardevLine is a line requested from a /dev/gpiochipN character device
+type chardevLine struct {
+	fd int
+}
+
+// openChardev requests a pin's line from chip (a name such as gpiochip0,
+// or a path)
+func openChardev(chip string, pin *config.GPIOPinConfig) (line, error) {
+	path := chip
+	if !filepath.IsAbs(path) {
+		path = filepath.Join("/dev", chip)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var req lineRequest
+	req.offsets[0] = uint32(pin.Line)
+	req.numLines = 1
+	copy(req.consumer[:], consumer)
+	if pin.ActiveLow {
+		req.config.flags |= lineFlagActiveLow
+	}
+	if pin.Direction == "output" {
+		req.config.flags |= lineFlagOutput
+		req.config.numAttrs = 1
+		req.config.attrs[0] = lineConfigAttribute{id: lineAttrOutputValues, value: uint64(pin.Initial), mask: 1}
+	} else {
+		req.config.flags |= lineFlagInput
+		switch pin.Bias {
+		case "pull-up":
+			req.config.flags |= lineFlagBiasPullUp
+		case "pull-down":
+			req.config.flags |= lineFlagBiasPullDown
+		case "disabled":
+			req.config.flags |= lineFlagBiasDisabled
+		}
+	}
+
+	if err := ioctl(f.Fd(), ioctlGetLine, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to request line %d on %s: %w", pin.Line, chip, err)
+	}
+	return &chardevLine{fd: int(req.fd)}, nil
+}
+
+func (l *chardevLine) get() (int, error) {
+	values := lineValues{mask: 1}
+	if err := ioctl(uintptr(l.fd), ioctlGetValues, unsafe.Pointer(&values)); err != nil {
+		return 0, fmt.Errorf("failed to read line: %w", err)
+	}
+	return int(values.bits & 1), nil
+}
+
+func (l *chardevLine) set(value int) error {
+	values := lineValues{bits: uint64(value), mask: 1}
+	if err := ioctl(uintptr(l.fd), ioctlSetValues, unsafe.Pointer(&values)); err != nil {
+		return fmt.Errorf("failed to set line: %w", err)
+	}
+	return nil
+}
+
+func (l *chardevLine) Close() error {
+	return unix.Close(l.fd)
+}
+
+func ioctl(fd, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
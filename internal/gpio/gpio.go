@@ -0,0 +1,201 @@
+// Package gpio reads and drives the whitelisted pins in the gpio config
+// section through the Linux GPIO character device (gpiod) or the legacy
+// sysfs interface.
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// line is a claimed GPIO line. Values are logical (active_low applied).
+type line interface {
+	get() (int, error)
+	set(value int) error
+	Close() error
+}
+
+// Controller owns the configured pins. Each line is claimed the first time
+// it is used (or by Claim) and held until Close, so outputs keep their
+// state between commands.
+type Controller struct {
+	cfg  config.GPIOConfig
+	pins map[string]*config.GPIOPinConfig
+
+	mu      sync.Mutex
+	lines   map[string]line
+	pulsing map[string]bool
+}
+
+// New creates a controller for cfg's pins; no line is claimed yet
+func New(cfg config.GPIOConfig) *Controller {
+	c := &Controller{
+		cfg:     cfg,
+		pins:    make(map[string]*config.GPIOPinConfig, len(cfg.Pins)),
+		lines:   make(map[string]line),
+		pulsing: make(map[string]bool),
+	}
+	for i := range cfg.Pins {
+		c.pins[cfg.Pins[i].Name] = &cfg.Pins[i]
+	}
+	return c
+}
+
+// Claim claims every line, driving outputs to their initial value. A line
+// that can't be claimed is retried on its next use.
+func (c *Controller) Claim() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, pin := range c.cfg.Pins {
+		if _, err := c.line(pin.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// line returns the claimed line of a pin, claiming it if needed. Call with
+// mu held.
+func (c *Controller) line(name string) (line, error) {
+	if l, ok := c.lines[name]; ok {
+		return l, nil
+	}
+	pin, ok := c.pins[name]
+	if !ok {
+		return nil, fmt.Errorf("pin not in allowed list: %s", name)
+	}
+
+	var l line
+	var err error
+	if c.cfg.Driver == "sysfs" {
+		l, err = openSysfs(pin)
+	} else {
+		chip := c.cfg.Chip
+		if pin.Chip != "" {
+			chip = pin.Chip
+		}
+		l, err = openChardev(chip, pin)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pin %s: %w", name, err)
+	}
+	c.lines[name] = l
+	return l, nil
+}
+
+// Read returns a pin's value; outputs report the value they drive
+func (c *Controller) Read(name string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, err := c.line(name)
+	if err != nil {
+		return 0, err
+	}
+	return l.get()
+}
+
+// ReadAll reads every pin. Pins that can't be read are listed in errors
+// instead of values.
+func (c *Controller) ReadAll() (map[string]int, map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	values := make(map[string]int, len(c.cfg.Pins))
+	var errs map[string]string
+	for _, pin := range c.cfg.Pins {
+		l, err := c.line(pin.Name)
+		var v int
+		if err == nil {
+			v, err = l.get()
+		}
+		if err != nil {
+			if errs == nil {
+				errs = make(map[string]string)
+			}
+			errs[pin.Name] = err.Error()
+			continue
+		}
+		values[pin.Name] = v
+	}
+	return values, errs
+}
+
+// Set drives an output pin to value (0 or 1)
+func (c *Controller) Set(name string, value int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	l, err := c.output(name, value)
+	if err != nil {
+		return err
+	}
+	return l.set(value)
+}
+
+// output checks that name is an idle output pin and value is 0 or 1, and
+// returns its line. Call with mu held.
+func (c *Controller) output(name string, value int) (line, error) {
+	if pin, ok := c.pins[name]; ok && pin.Direction != "output" {
+		return nil, fmt.Errorf("pin %s is an input", name)
+	}
+	if value != 0 && value != 1 {
+		return nil, fmt.Errorf("value must be 0 or 1 (got: %d)", value)
+	}
+	if c.pulsing[name] {
+		return nil, fmt.Errorf("pin %s is being pulsed", name)
+	}
+	return c.line(name)
+}
+
+// Pulse drives an output pin to value for duration, then restores the
+// value it had before. Other pins stay usable during the pulse; the pin
+// itself rejects Set and Pulse until it ends. Cancelling ctx ends the
+// pulse early.
+func (c *Controller) Pulse(ctx context.Context, name string, value int, duration time.Duration) error {
+	c.mu.Lock()
+	l, err := c.output(name, value)
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	previous, err := l.get()
+	if err == nil {
+		err = l.set(value)
+	}
+	if err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	c.pulsing[name] = true
+	c.mu.Unlock()
+
+	timer := time.NewTimer(duration)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pulsing, name)
+	if err := l.set(previous); err != nil {
+		return fmt.Errorf("failed to end pulse: %w", err)
+	}
+	return nil
+}
+
+// Close releases every claimed line. Outputs usually keep their last value,
+// but that is up to the kernel driver.
+func (c *Controller) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name, l := range c.lines {
+		l.Close()
+		delete(c.lines, name)
+	}
+}
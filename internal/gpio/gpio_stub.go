@@ -0,0 +1,17 @@
+//go:build !linux
+
+package gpio
+
+import (
+	"fmt"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func openChardev(chip string, pin *config.GPIOPinConfig) (line, error) {
+	return nil, fmt.Errorf("gpio is not supported on this platform")
+}
+
+func openSysfs(pin *config.GPIOPinConfig) (line, error) {
+	return nil, fmt.Errorf("gpio is not supported on this platform")
+}
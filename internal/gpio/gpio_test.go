@@ -0,0 +1,101 @@
+package gpio
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// fakeLine records the value driven on it
+type fakeLine struct {
+	value int
+	sets  []int
+}
+
+func (l *fakeLine) get() (int, error) { return l.value, nil }
+
+func (l *fakeLine) set(value int) error {
+	l.value = value
+	l.sets = append(l.sets, value)
+	return nil
+}
+
+func (l *fakeLine) Close() error { return nil }
+
+// testController returns a controller whose pins are already claimed by
+// fake lines
+func testController() (*Controller, *fakeLine, *fakeLine) {
+	c := New(config.GPIOConfig{Pins: []config.GPIOPinConfig{
+		{Name: "door", Line: 17, Direction: "input"},
+		{Name: "relay", Line: 27, Direction: "output"},
+	}})
+	door, relay := &fakeLine{value: 1}, &fakeLine{}
+	c.lines["door"] = door
+	c.lines["relay"] = relay
+	return c, door, relay
+}
+
+func TestControllerReadSet(t *testing.T) {
+	c, _, relay := testController()
+
+	if v, err := c.Read("door"); err != nil || v != 1 {
+		t.Errorf("Read(door) = %d, %v, want 1", v, err)
+	}
+	if err := c.Set("relay", 1); err != nil || relay.value != 1 {
+		t.Errorf("Set(relay, 1) error = %v, value %d", err, relay.value)
+	}
+	values, errs := c.ReadAll()
+	if values["door"] != 1 || values["relay"] != 1 || errs != nil {
+		t.Errorf("ReadAll() = %v, %v", values, errs)
+	}
+
+	tests := []struct {
+		name    string
+		pin     string
+		value   int
+		wantErr string
+	}{
+		{"unknown pin", "pump", 1, "not in allowed list"},
+		{"input", "door", 1, "is an input"},
+		{"bad value", "relay", 2, "must be 0 or 1"},
+	}
+	for _, tt := range tests {
+		if err := c.Set(tt.pin, tt.value); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Set() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestControllerPulse(t *testing.T) {
+	c, _, relay := testController()
+
+	done := make(chan error)
+	go func() { done <- c.Pulse(context.Background(), "relay", 1, 50*time.Millisecond) }()
+
+	// The pin is busy while the pulse runs
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Set("relay", 0); err == nil || !strings.Contains(err.Error(), "being pulsed") {
+		t.Errorf("Set() during pulse error = %v, want being pulsed", err)
+	}
+	if v, _ := c.Read("relay"); v != 1 {
+		t.Errorf("relay during pulse = %d, want 1", v)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Pulse() error = %v", err)
+	}
+	if relay.value != 0 || len(relay.sets) != 2 {
+		t.Errorf("relay after pulse = %d (sets %v), want restored to 0", relay.value, relay.sets)
+	}
+
+	// Cancelling ends the pulse early
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := c.Pulse(ctx, "relay", 1, time.Minute); err != nil || time.Since(start) > time.Second {
+		t.Errorf("Pulse() with cancelled ctx = %v after %v", err, time.Since(start))
+	}
+}
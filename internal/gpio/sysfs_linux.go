@@ -0,0 +1,86 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// sysfsRoot is the legacy sysfs GPIO interface (a variable for tests)
+var sysfsRoot = "/sys/class/gpio"
+
+// sysfsLine is a line exported through sysfs
+type sysfsLine struct {
+	value string // Path of the value file
+}
+
+// openSysfs exports a pin's line (if it isn't already) and configures its
+// polarity and direction. Exported lines are left exported on Close.
+func openSysfs(pin *config.GPIOPinConfig) (line, error) {
+	dir := filepath.Join(sysfsRoot, "gpio"+strconv.Itoa(pin.Line))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.WriteFile(filepath.Join(sysfsRoot, "export"), []byte(strconv.Itoa(pin.Line)), 0); err != nil {
+			return nil, fmt.Errorf("failed to export gpio %d: %w", pin.Line, err)
+		}
+	}
+
+	// udev may still be fixing the permissions of a newly exported line
+	activeLow := "0"
+	if pin.ActiveLow {
+		activeLow = "1"
+	}
+	var err error
+	for i := 0; i < 10; i++ {
+		if err = os.WriteFile(filepath.Join(dir, "active_low"), []byte(activeLow), 0); err == nil || !os.IsPermission(err) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure gpio %d: %w", pin.Line, err)
+	}
+
+	// "low"/"high" set an output and its raw level in one step
+	direction := "in"
+	if pin.Direction == "output" {
+		direction = "low"
+		if (pin.Initial == 1) != pin.ActiveLow {
+			direction = "high"
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "direction"), []byte(direction), 0); err != nil {
+		return nil, fmt.Errorf("failed to configure gpio %d: %w", pin.Line, err)
+	}
+	return &sysfsLine{value: filepath.Join(dir, "value")}, nil
+}
+
+func (l *sysfsLine) get() (int, error) {
+	data, err := os.ReadFile(l.value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read line: %w", err)
+	}
+	switch strings.TrimSpace(string(data)) {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("unexpected line value %q", data)
+	}
+}
+
+func (l *sysfsLine) set(value int) error {
+	if err := os.WriteFile(l.value, []byte(strconv.Itoa(value)), 0); err != nil {
+		return fmt.Errorf("failed to set line: %w", err)
+	}
+	return nil
+}
+
+func (l *sysfsLine) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package gpio
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"unsafe"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func TestSysfs(t *testing.T) {
+	root := t.TempDir()
+	sysfsRoot = root
+	t.Cleanup(func() { sysfsRoot = "/sys/class/gpio" })
+
+	// The export file of the fake tree creates nothing, so pre-create the
+	// line directory as the kernel would
+	dir := filepath.Join(root, "gpio27")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := openSysfs(&config.GPIOPinConfig{Name: "relay", Line: 27, Direction: "output", ActiveLow: true, Initial: 1})
+	if err != nil {
+		t.Fatalf("openSysfs() error = %v", err)
+	}
+	for file, want := range map[string]string{"active_low": "1", "direction": "low"} {
+		if got, _ := os.ReadFile(filepath.Join(dir, file)); string(got) != want {
+			t.Errorf("%s = %q, want %q", file, got, want)
+		}
+	}
+
+	if err := l.set(1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := l.get(); err != nil || v != 1 {
+		t.Errorf("get() = %d, %v, want 1", v, err)
+	}
+
+	// An unexported line is exported first
+	if _, err := openSysfs(&config.GPIOPinConfig{Name: "door", Line: 17, Direction: "input"}); err == nil {
+		t.Error("openSysfs() should fail when the kernel doesn't create the line")
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "export")); string(got) != "17" {
+		t.Errorf("export = %q, want 17", got)
+	}
+}
+
+func TestChardevLayout(t *testing.T) {
+	// Must match the kernel's struct sizes, which are encoded in the ioctls
+	if size := unsafe.Sizeof(lineRequest{}); size != 592 {
+		t.Errorf("sizeof(gpio_v2_line_request) = %d, want 592", size)
+	}
+	if size := unsafe.Sizeof(lineConfig{}); size != 272 {
+		t.Errorf("sizeof(gpio_v2_line_config) = %d, want 272", size)
+	}
+	if ioctlGetLine != 0xC250B407 {
+		t.Errorf("GPIO_V2_GET_LINE_IOCTL = %#x, want 0xc250b407", ioctlGetLine)
+	}
+}
@@ -0,0 +1,245 @@
+// Package logship forwards the agent's own WARN+ log entries to NATS as
+// batched, rate-limited events, so agent errors are visible centrally
+// without fetching log files from each device.
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxStackBytes bounds the stack trace carried by a shipped entry
+const maxStackBytes = 4096
+
+// bufferBatches is how many batches may queue before entries are dropped,
+// e.g. while NATS is not yet connected or is reconnecting
+const bufferBatches = 10
+
+// Publisher sends a batch to NATS. It must not log through the shipped
+// logger, or every failed publish would queue another entry.
+type Publisher interface {
+	PublishUnlogged(subject string, data []byte) error
+}
+
+// Entry is a single shipped log entry
+type Entry struct {
+	TS      string                 `json:"ts"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"msg"`
+	Caller  string                 `json:"caller,omitempty"`
+	Stack   string                 `json:"stacktrace,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Batch is the message published to {prefix}.{code}.agentlog
+type Batch struct {
+	Code     string  `json:"code"`
+	Location string  `json:"location,omitempty"`
+	TS       string  `json:"ts"`
+	Dropped  int     `json:"dropped"` // Entries dropped by the rate limit or a full buffer since the last batch
+	Entries  []Entry `json:"entries"`
+}
+
+// Shipper buffers log entries and publishes them in batches
+type Shipper struct {
+	cfg      config.LogShipConfig
+	level    zapcore.Level
+	code     string
+	location string
+
+	mu          sync.Mutex
+	entries     []Entry
+	dropped     int
+	windowStart time.Time // Start of the current rate limit minute
+	windowCount int       // Entries accepted in the current minute
+
+	flush chan struct{} // Signals a full batch
+	done  chan struct{} // Closed when Run returns
+	now   func() time.Time
+}
+
+// New creates a shipper. Entries are buffered from the start so errors
+// logged before NATS connects are shipped once Run is called.
+func New(cfg config.LogShipConfig, code, location string) (*Shipper, error) {
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, err
+	}
+
+	return &Shipper{
+		cfg:      cfg,
+		level:    level,
+		code:     code,
+		location: location,
+		flush:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		now:      time.Now,
+	}, nil
+}
+
+// Core returns a zap core that feeds this shipper. Tee it with the
+// file/console core.
+func (s *Shipper) Core() zapcore.Core {
+	return &core{LevelEnabler: s.level, shipper: s}
+}
+
+// add queues an entry, applying the per-minute rate limit and buffer cap
+func (s *Shipper) add(e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.windowStart) >= time.Minute {
+		s.windowStart = now
+		s.windowCount = 0
+	}
+	if s.windowCount >= s.cfg.RateLimit || len(s.entries) >= s.cfg.BatchSize*bufferBatches {
+		s.dropped++
+		return
+	}
+	s.windowCount++
+	s.entries = append(s.entries, e)
+
+	if len(s.entries) >= s.cfg.BatchSize {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run publishes batches to subject every flush interval, or sooner when a
+// batch fills, until ctx is cancelled. Remaining entries are flushed on exit.
+func (s *Shipper) Run(ctx context.Context, pub Publisher, subject string) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.publish(pub, subject)
+			return
+		case <-ticker.C:
+			s.publish(pub, subject)
+		case <-s.flush:
+			s.publish(pub, subject)
+		}
+	}
+}
+
+// Wait blocks until Run has flushed and returned, or the timeout expires
+func (s *Shipper) Wait(timeout time.Duration) {
+	select {
+	case <-s.done:
+	case <-time.After(timeout):
+	}
+}
+
+// publish sends every queued entry in batches of at most BatchSize. Entries
+// are dropped (and counted) if NATS rejects the publish.
+func (s *Shipper) publish(pub Publisher, subject string) {
+	for {
+		batch := s.take()
+		if batch == nil {
+			return
+		}
+
+		data, err := json.Marshal(batch)
+		if err == nil {
+			err = pub.PublishUnlogged(subject, data)
+		}
+		if err != nil {
+			s.mu.Lock()
+			s.dropped += len(batch.Entries)
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// take removes up to BatchSize entries from the buffer. Returns nil if
+// there is nothing to report.
+func (s *Shipper) take() *Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.entries) == 0 && s.dropped == 0 {
+		return nil
+	}
+
+	n := min(len(s.entries), s.cfg.BatchSize)
+	batch := &Batch{
+		Code:     s.code,
+		Location: s.location,
+		TS:       utils.NowRFC3339(),
+		Dropped:  s.dropped,
+		Entries:  append([]Entry(nil), s.entries[:n]...),
+	}
+	s.entries = s.entries[n:]
+	s.dropped = 0
+
+	return batch
+}
+
+// core is the zapcore.Core handed to the logger
+type core struct {
+	zapcore.LevelEnabler
+	shipper *Shipper
+	fields  []zapcore.Field // Context added with logger.With
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(append([]zapcore.Field(nil), c.fields...), fields...)
+	return &clone
+}
+
+func (c *core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	e := Entry{
+		TS:      ent.Time.UTC().Format(time.RFC3339),
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		Stack:   ent.Stack,
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+	if len(e.Stack) > maxStackBytes {
+		e.Stack = e.Stack[:maxStackBytes]
+	}
+	if len(enc.Fields) > 0 {
+		e.Fields = enc.Fields
+	}
+
+	c.shipper.add(e)
+	return nil
+}
+
+func (c *core) Sync() error {
+	return nil
+}
@@ -0,0 +1,154 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// fakePublisher records published batches
+type fakePublisher struct {
+	mu      sync.Mutex
+	subject string
+	batches []Batch
+	err     error
+}
+
+func (p *fakePublisher) PublishUnlogged(subject string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	var b Batch
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	p.subject = subject
+	p.batches = append(p.batches, b)
+	return nil
+}
+
+func testConfig() config.LogShipConfig {
+	return config.LogShipConfig{
+		Enabled:       true,
+		Level:         "warn",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		RateLimit:     100,
+	}
+}
+
+func newTestShipper(t *testing.T, cfg config.LogShipConfig) (*Shipper, *zap.Logger) {
+	t.Helper()
+	s, err := New(cfg, "device-1", "hq")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return s, zap.New(s.Core())
+}
+
+// TestCoreLevelAndFields tests level filtering and field capture
+func TestCoreLevelAndFields(t *testing.T) {
+	s, logger := newTestShipper(t, testConfig())
+
+	logger.Info("not shipped")
+	logger.With(zap.String("task", "metrics")).Warn("scrape failed", zap.Int("attempt", 3))
+
+	batch := s.take()
+	if batch == nil || len(batch.Entries) != 1 {
+		t.Fatalf("take() = %+v, want 1 entry", batch)
+	}
+	e := batch.Entries[0]
+	if e.Level != "warn" || e.Message != "scrape failed" {
+		t.Errorf("entry = %+v, want warn 'scrape failed'", e)
+	}
+	if e.Fields["task"] != "metrics" || e.Fields["attempt"] != int64(3) {
+		t.Errorf("fields = %v, want task=metrics attempt=3", e.Fields)
+	}
+	if batch.Code != "device-1" || batch.Location != "hq" {
+		t.Errorf("batch identity = %q/%q, want device-1/hq", batch.Code, batch.Location)
+	}
+}
+
+// TestRateLimit tests that entries over the per-minute limit are counted as dropped
+func TestRateLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.RateLimit = 3
+	cfg.BatchSize = 100
+	s, logger := newTestShipper(t, cfg)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		logger.Error("boom")
+	}
+
+	batch := s.take()
+	if len(batch.Entries) != 3 || batch.Dropped != 2 {
+		t.Fatalf("take() = %d entries, %d dropped; want 3, 2", len(batch.Entries), batch.Dropped)
+	}
+
+	// Next minute: limit resets
+	now = now.Add(time.Minute)
+	logger.Error("boom")
+	batch = s.take()
+	if len(batch.Entries) != 1 || batch.Dropped != 0 {
+		t.Fatalf("take() = %d entries, %d dropped; want 1, 0", len(batch.Entries), batch.Dropped)
+	}
+}
+
+// TestRunPublishesBatches tests batching and the final flush on shutdown
+func TestRunPublishesBatches(t *testing.T) {
+	s, logger := newTestShipper(t, testConfig())
+	pub := &fakePublisher{}
+
+	// Logged before Run (NATS not yet connected): buffered
+	logger.Warn("one")
+	logger.Warn("two")
+	logger.Warn("three")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx, pub, "agents.device-1.agentlog")
+	cancel()
+	s.Wait(time.Second)
+
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+	if pub.subject != "agents.device-1.agentlog" {
+		t.Errorf("subject = %q", pub.subject)
+	}
+	var total int
+	for _, b := range pub.batches {
+		if len(b.Entries) > 2 {
+			t.Errorf("batch has %d entries, want at most batch_size 2", len(b.Entries))
+		}
+		total += len(b.Entries)
+	}
+	if total != 3 {
+		t.Errorf("published %d entries, want 3", total)
+	}
+}
+
+// TestPublishFailureCountsDropped tests that failed publishes are reported later
+func TestPublishFailureCountsDropped(t *testing.T) {
+	s, logger := newTestShipper(t, testConfig())
+	pub := &fakePublisher{err: errors.New("not connected")}
+
+	logger.Warn("lost")
+	s.publish(pub, "agents.device-1.agentlog")
+
+	pub.err = nil
+	s.publish(pub, "agents.device-1.agentlog")
+
+	if len(pub.batches) != 1 || pub.batches[0].Dropped != 1 || len(pub.batches[0].Entries) != 0 {
+		t.Errorf("batches = %+v, want one batch reporting 1 dropped", pub.batches)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package logsink
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewEventLogCore is not supported on this platform
+func NewEventLogCore(cfg config.EventLogConfig) (zapcore.Core, error) {
+	return nil, fmt.Errorf("event log output is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,53 @@
+//go:build windows
+
+package logsink
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// Event IDs written for each entry type
+const (
+	eventIDInfo    = 1
+	eventIDWarning = 2
+	eventIDError   = 3
+)
+
+// maxEventMessage stays under the Event Log's 31,839 character limit
+const maxEventMessage = 31000
+
+// NewEventLogCore returns a core writing entries at or above cfg.Level to the
+// Windows Application log under cfg.Source. The service installer registers
+// the source under the service name ("agent").
+func NewEventLogCore(cfg config.EventLogConfig) (zapcore.Core, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("eventlog: %w", err)
+	}
+
+	log, err := eventlog.Open(cfg.Source)
+	if err != nil {
+		return nil, fmt.Errorf("eventlog: failed to open source %q: %w", cfg.Source, err)
+	}
+
+	write := func(level zapcore.Level, t time.Time, msg string) error {
+		if len(msg) > maxEventMessage {
+			msg = msg[:maxEventMessage]
+		}
+		switch {
+		case level >= zapcore.ErrorLevel:
+			return log.Error(eventIDError, msg)
+		case level == zapcore.WarnLevel:
+			return log.Warning(eventIDWarning, msg)
+		default:
+			return log.Info(eventIDInfo, msg)
+		}
+	}
+
+	return newSinkCore(level, write), nil
+}
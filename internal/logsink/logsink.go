@@ -0,0 +1,83 @@
+// Package logsink provides zap cores that write to the operating system's
+// log facility: local syslog (RFC 5424) on Linux/FreeBSD and the Event Log
+// on Windows, so agent entries land in the site's existing log collection.
+package logsink
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// writeFunc delivers one encoded entry to the sink. level and t are passed
+// separately because syslog and the Event Log carry them out of band.
+type writeFunc func(level zapcore.Level, t time.Time, msg string) error
+
+// sinkCore encodes the message and fields only (no time or level, which the
+// sink records natively) and hands the result to write
+type sinkCore struct {
+	zapcore.LevelEnabler
+	enc   zapcore.Encoder
+	write writeFunc
+}
+
+func newSinkCore(level zapcore.LevelEnabler, write writeFunc) *sinkCore {
+	encoderConfig := zapcore.EncoderConfig{
+		MessageKey:       "msg",
+		NameKey:          "logger",
+		CallerKey:        "caller",
+		EncodeCaller:     zapcore.ShortCallerEncoder,
+		EncodeDuration:   zapcore.StringDurationEncoder,
+		ConsoleSeparator: " ",
+	}
+	return &sinkCore{
+		LevelEnabler: level,
+		enc:          zapcore.NewConsoleEncoder(encoderConfig),
+		write:        write,
+	}
+}
+
+func (c *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &sinkCore{LevelEnabler: c.LevelEnabler, enc: c.enc.Clone(), write: c.write}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *sinkCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	defer buf.Free()
+
+	// Drop the encoder's trailing newline; both sinks frame entries themselves
+	msg := buf.String()
+	if n := len(msg); n > 0 && msg[n-1] == '\n' {
+		msg = msg[:n-1]
+	}
+
+	return c.write(ent.Level, ent.Time, msg)
+}
+
+func (c *sinkCore) Sync() error {
+	return nil
+}
+
+// parseLevel parses a configured sink level
+func parseLevel(level string) (zapcore.Level, error) {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return l, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	return l, nil
+}
@@ -0,0 +1,89 @@
+package logsink
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// TestFormatRFC5424 tests syslog message rendering
+func TestFormatRFC5424(t *testing.T) {
+	ts := time.Date(2025, 11, 17, 12, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name     string
+		facility int
+		level    zapcore.Level
+		hostname string
+		want     string
+	}{
+		{
+			name:     "daemon error",
+			facility: 3,
+			level:    zapcore.ErrorLevel,
+			hostname: "web-01",
+			want:     "<27>1 2025-11-17T12:00:00.123456Z web-01 agent 42 - - boom",
+		},
+		{
+			name:     "local0 info",
+			facility: 16,
+			level:    zapcore.InfoLevel,
+			hostname: "web-01",
+			want:     "<134>1 2025-11-17T12:00:00.123456Z web-01 agent 42 - - boom",
+		},
+		{
+			name:     "missing hostname",
+			facility: 3,
+			level:    zapcore.WarnLevel,
+			hostname: "",
+			want:     "<28>1 2025-11-17T12:00:00.123456Z - agent 42 - - boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatRFC5424(tt.facility, tt.level, ts, tt.hostname, "agent", 42, "boom")
+			if got != tt.want {
+				t.Errorf("formatRFC5424() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSinkCore tests level filtering and message/field encoding
+func TestSinkCore(t *testing.T) {
+	type written struct {
+		level zapcore.Level
+		msg   string
+	}
+	var got []written
+
+	core := newSinkCore(zapcore.WarnLevel, func(level zapcore.Level, ts time.Time, msg string) error {
+		got = append(got, written{level, msg})
+		return nil
+	})
+	logger := zap.New(core).With(zap.String("task", "metrics"))
+
+	logger.Info("dropped")
+	logger.Error("scrape failed", zap.Int("attempt", 2))
+
+	if len(got) != 1 {
+		t.Fatalf("wrote %d entries, want 1", len(got))
+	}
+	if got[0].level != zapcore.ErrorLevel {
+		t.Errorf("level = %v, want error", got[0].level)
+	}
+	msg := got[0].msg
+	if !strings.HasPrefix(msg, "scrape failed") {
+		t.Errorf("msg = %q, want it to start with the log message", msg)
+	}
+	if !strings.Contains(msg, `"task": "metrics"`) || !strings.Contains(msg, `"attempt": 2`) {
+		t.Errorf("msg = %q, want context and entry fields", msg)
+	}
+	if strings.HasSuffix(msg, "\n") {
+		t.Errorf("msg = %q, want no trailing newline", msg)
+	}
+}
@@ -0,0 +1,53 @@
+package logsink
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// facilities maps syslog facility names to their RFC 5424 codes
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// rfc5424Time is the RFC 5424 TIMESTAMP format (at most 6 fractional digits)
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// severity maps a zap level to an RFC 5424 severity
+func severity(level zapcore.Level) int {
+	switch {
+	case level >= zapcore.DPanicLevel:
+		return 2 // critical
+	case level == zapcore.ErrorLevel:
+		return 3 // error
+	case level == zapcore.WarnLevel:
+		return 4 // warning
+	case level == zapcore.InfoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// formatRFC5424 renders a syslog message without structured data:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID - - MSG
+func formatRFC5424(facility int, level zapcore.Level, t time.Time, hostname, appName string, pid int, msg string) string {
+	if hostname == "" {
+		hostname = "-"
+	}
+	if appName == "" {
+		appName = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		facility*8+severity(level),
+		t.Format(rfc5424Time),
+		hostname,
+		appName,
+		pid,
+		msg)
+}
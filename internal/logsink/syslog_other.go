@@ -0,0 +1,16 @@
+//go:build !linux && !freebsd
+
+package logsink
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewSyslogCore is not supported on this platform
+func NewSyslogCore(cfg config.SyslogConfig) (zapcore.Core, error) {
+	return nil, fmt.Errorf("syslog output is not supported on %s", runtime.GOOS)
+}
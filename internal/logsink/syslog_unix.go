@@ -0,0 +1,109 @@
+//go:build linux || freebsd
+
+package logsink
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap/zapcore"
+)
+
+// localSyslogSockets are tried in order when no address is configured
+var localSyslogSockets = []string{"/dev/log", "/var/run/log", "/var/run/syslog"}
+
+// dialTimeout bounds connecting to a remote syslog server
+const dialTimeout = 5 * time.Second
+
+// syslogWriter sends RFC 5424 messages over a unix datagram socket, UDP, or
+// TCP (octet-counting framing, RFC 6587), reconnecting once on write failure
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	pid      int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogCore returns a core writing entries at or above cfg.Level to
+// syslog. An empty network/address uses the local syslog socket.
+func NewSyslogCore(cfg config.SyslogConfig) (zapcore.Core, error) {
+	level, err := parseLevel(cfg.Level)
+	if err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+	facility, ok := facilities[cfg.Facility]
+	if !ok {
+		return nil, fmt.Errorf("syslog: unknown facility %q", cfg.Facility)
+	}
+
+	hostname, _ := os.Hostname()
+	w := &syslogWriter{
+		network:  cfg.Network,
+		address:  cfg.Address,
+		facility: facility,
+		tag:      cfg.Tag,
+		hostname: hostname,
+		pid:      os.Getpid(),
+	}
+	if err := w.connect(); err != nil {
+		return nil, fmt.Errorf("syslog: %w", err)
+	}
+
+	return newSinkCore(level, w.write), nil
+}
+
+// connect dials the configured or local syslog endpoint
+func (w *syslogWriter) connect() error {
+	if w.address != "" {
+		conn, err := net.DialTimeout(w.network, w.address, dialTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s %s: %w", w.network, w.address, err)
+		}
+		w.conn = conn
+		return nil
+	}
+
+	for _, path := range localSyslogSockets {
+		if conn, err := net.Dial("unixgram", path); err == nil {
+			w.conn = conn
+			w.network = "unixgram"
+			return nil
+		}
+	}
+	return fmt.Errorf("no local syslog socket found (tried %v)", localSyslogSockets)
+}
+
+// write formats and sends one entry
+func (w *syslogWriter) write(level zapcore.Level, t time.Time, msg string) error {
+	line := formatRFC5424(w.facility, level, t, w.hostname, w.tag, w.pid, msg)
+	if w.network == "tcp" {
+		line = fmt.Sprintf("%d %s", len(line), line)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(line)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	// The syslog daemon restarted or the TCP connection dropped; retry once
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write([]byte(line))
+	return err
+}
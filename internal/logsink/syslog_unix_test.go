@@ -0,0 +1,64 @@
+//go:build linux || freebsd
+
+package logsink
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// TestSyslogCoreUDP tests delivery to a remote syslog server over UDP
+func TestSyslogCoreUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	core, err := NewSyslogCore(config.SyslogConfig{
+		Level:    "info",
+		Facility: "local3",
+		Tag:      "agent",
+		Network:  "udp",
+		Address:  pc.LocalAddr().String(),
+	})
+	if err != nil {
+		t.Fatalf("NewSyslogCore() error = %v", err)
+	}
+
+	zap.New(core).Warn("disk almost full")
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second)) //nolint:errcheck
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no syslog message received: %v", err)
+	}
+
+	msg := string(buf[:n])
+	// local3 (19) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<156>1 ") {
+		t.Errorf("message = %q, want PRI <156> and version 1", msg)
+	}
+	if !strings.Contains(msg, " agent ") || !strings.HasSuffix(msg, "disk almost full") {
+		t.Errorf("message = %q, want tag and message", msg)
+	}
+}
+
+// TestSyslogCoreUnknownFacility tests facility validation
+func TestSyslogCoreUnknownFacility(t *testing.T) {
+	_, err := NewSyslogCore(config.SyslogConfig{
+		Level:    "info",
+		Facility: "local9",
+		Network:  "udp",
+		Address:  "127.0.0.1:514",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown facility") {
+		t.Errorf("NewSyslogCore() error = %v, want unknown facility", err)
+	}
+}
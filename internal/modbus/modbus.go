@@ -0,0 +1,158 @@
+// Package modbus polls Modbus TCP and RTU (serial) devices using the
+// register maps in the modbus config section. Only the read functions are
+// implemented: coils (0x01), discrete inputs (0x02), holding registers (0x03)
+// and input registers (0x04).
+package modbus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/serial"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// defaultTimeout bounds each request unless the device sets timeout
+const defaultTimeout = 5 * time.Second
+
+// Function codes
+const (
+	funcReadCoils            = 0x01
+	funcReadDiscreteInputs   = 0x02
+	funcReadHoldingRegisters = 0x03
+	funcReadInputRegisters   = 0x04
+)
+
+// Reading is published on {prefix}.{code}.telemetry.modbus.<device> after
+// each poll. Code/Location/MessageMeta are stamped by the scheduler.
+type Reading struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	tasks.MessageMeta
+
+	Device string             `json:"device"`
+	Values map[string]float64 `json:"values"`           // By register name; coils and discrete inputs are 0 or 1
+	Errors map[string]string  `json:"errors,omitempty"` // Registers whose read failed, by name
+	TS     string             `json:"ts"`
+}
+
+// transport sends a request PDU (function code + data) to a unit and
+// returns the response PDU
+type transport interface {
+	request(unit byte, pdu []byte) ([]byte, error)
+	Close() error
+}
+
+// Poll reads every register of device. Registers are read in as few
+// requests as possible; a failed request is reported per register in
+// Errors. An error is returned only if the device could not be reached or
+// no register could be read.
+func Poll(ctx context.Context, device *config.ModbusDeviceConfig) (*Reading, error) {
+	timeout := device.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	var t transport
+	var err error
+	switch device.Transport {
+	case "rtu":
+		// Every RTU device on the bus shares the port
+		defer serial.Lock(device.Serial.Device)()
+		t, err = openRTU(device.Serial, timeout)
+	default:
+		t, err = dialTCP(ctx, device.Address, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	reading := &Reading{
+		Device: device.Name,
+		Values: make(map[string]float64),
+		TS:     utils.NowRFC3339(),
+	}
+
+	var lastErr error
+	for _, b := range plan(device.Registers) {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("poll cancelled: %w", err)
+		}
+
+		data, err := readBlock(t, byte(device.UnitID), b)
+		if err != nil {
+			lastErr = err
+			if reading.Errors == nil {
+				reading.Errors = make(map[string]string)
+			}
+			for _, reg := range b.registers {
+				reading.Errors[reg.Name] = err.Error()
+			}
+			continue
+		}
+		for _, reg := range b.registers {
+			value := decode(reg, b, data)
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				// A float32 register holding NaN/Inf can't be encoded as JSON
+				if reading.Errors == nil {
+					reading.Errors = make(map[string]string)
+				}
+				reading.Errors[reg.Name] = "value is not a finite number"
+				continue
+			}
+			reading.Values[reg.Name] = value
+		}
+	}
+
+	if len(reading.Values) == 0 {
+		return nil, fmt.Errorf("no registers could be read: %w", lastErr)
+	}
+	return reading, nil
+}
+
+// readBlock reads one block and returns its data bytes
+func readBlock(t transport, unit byte, b block) ([]byte, error) {
+	pdu := []byte{b.function, byte(b.start >> 8), byte(b.start), byte(b.count >> 8), byte(b.count)}
+	resp, err := t.request(unit, pdu)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp) >= 2 && resp[0] == b.function|0x80 {
+		return nil, exceptionError(resp[1])
+	}
+	if len(resp) < 2 || resp[0] != b.function {
+		return nil, fmt.Errorf("unexpected response to function 0x%02x", b.function)
+	}
+
+	want := int(b.count) * 2
+	if b.function == funcReadCoils || b.function == funcReadDiscreteInputs {
+		want = (int(b.count) + 7) / 8
+	}
+	if int(resp[1]) != want || len(resp) != 2+want {
+		return nil, fmt.Errorf("response has %d data bytes, want %d", len(resp)-2, want)
+	}
+	return resp[2:], nil
+}
+
+// exceptionError describes a Modbus exception response
+func exceptionError(code byte) error {
+	names := map[byte]string{
+		0x01: "illegal function",
+		0x02: "illegal data address",
+		0x03: "illegal data value",
+		0x04: "server device failure",
+		0x06: "server device busy",
+		0x0A: "gateway path unavailable",
+		0x0B: "gateway target device failed to respond",
+	}
+	if name, ok := names[code]; ok {
+		return fmt.Errorf("modbus exception %d (%s)", code, name)
+	}
+	return fmt.Errorf("modbus exception %d", code)
+}
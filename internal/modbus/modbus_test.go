@@ -0,0 +1,299 @@
+package modbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func TestCRC(t *testing.T) {
+	// Read 10 holding registers from unit 1, a common reference frame
+	frame := appendCRC([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A})
+	if want := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A, 0xC5, 0xCD}; !bytes.Equal(frame, want) {
+		t.Errorf("appendCRC() = % x, want % x", frame, want)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	registers := []config.ModbusRegisterConfig{
+		{Name: "c", Type: "holding", Address: 20},
+		{Name: "a", Type: "holding", Address: 0, Format: "float32"},
+		{Name: "b", Type: "holding", Address: 4},
+		{Name: "far", Type: "holding", Address: 200},
+		{Name: "in", Type: "input", Address: 4},
+		{Name: "run", Type: "coil", Address: 7},
+	}
+
+	blocks := plan(registers)
+
+	type summary struct {
+		function   byte
+		start      uint16
+		count      uint16
+		nregisters int
+	}
+	want := []summary{
+		{funcReadCoils, 7, 1, 1},
+		{funcReadHoldingRegisters, 0, 5, 2}, // a (0-1) and b (4) merge across a 2-register gap
+		{funcReadHoldingRegisters, 20, 1, 1},
+		{funcReadHoldingRegisters, 200, 1, 1},
+		{funcReadInputRegisters, 4, 1, 1},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("plan() returned %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i, b := range blocks {
+		got := summary{b.function, b.start, b.count, len(b.registers)}
+		if got != want[i] {
+			t.Errorf("block %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestPlanLimit(t *testing.T) {
+	// 130 adjacent registers exceed one request and must be split
+	var registers []config.ModbusRegisterConfig
+	for i := 0; i < 130; i++ {
+		registers = append(registers, config.ModbusRegisterConfig{Name: fmt.Sprintf("r%d", i), Type: "holding", Address: i})
+	}
+
+	blocks := plan(registers)
+	if len(blocks) != 2 {
+		t.Fatalf("plan() returned %d blocks, want 2", len(blocks))
+	}
+	if blocks[0].count != maxRegistersPerRead || blocks[1].start != maxRegistersPerRead {
+		t.Errorf("blocks = [%d+%d, %d+%d], want split at %d",
+			blocks[0].start, blocks[0].count, blocks[1].start, blocks[1].count, maxRegistersPerRead)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	f := math.Float32bits(21.5)
+	data := []byte{
+		0xFF, 0xFE, // 0: -2 as int16, 65534 as uint16
+		byte(f >> 24), byte(f >> 16), byte(f >> 8), byte(f), // 1-2: float32, big word order
+		byte(f >> 8), byte(f), byte(f >> 24), byte(f >> 16), // 3-4: float32, little word order
+		0x00, 0x01, 0x00, 0x02, // 5-6: uint32 65538
+	}
+	b := block{function: funcReadHoldingRegisters, start: 100}
+
+	tests := []struct {
+		reg  config.ModbusRegisterConfig
+		want float64
+	}{
+		{config.ModbusRegisterConfig{Address: 100}, 65534},
+		{config.ModbusRegisterConfig{Address: 100, Format: "int16"}, -2},
+		{config.ModbusRegisterConfig{Address: 100, Format: "int16", Scale: 0.5, Offset: 10}, 9},
+		{config.ModbusRegisterConfig{Address: 101, Format: "float32"}, 21.5},
+		{config.ModbusRegisterConfig{Address: 103, Format: "float32", WordOrder: "little"}, 21.5},
+		{config.ModbusRegisterConfig{Address: 105, Format: "uint32"}, 65538},
+		{config.ModbusRegisterConfig{Address: 105, Format: "int32", WordOrder: "little"}, 2<<16 | 1},
+	}
+	for _, tt := range tests {
+		if got := decode(tt.reg, b, data); got != tt.want {
+			t.Errorf("decode(%+v) = %v, want %v", tt.reg, got, tt.want)
+		}
+	}
+
+	bits := block{function: funcReadCoils, start: 0}
+	if got := decode(config.ModbusRegisterConfig{Address: 9}, bits, []byte{0x00, 0x02}); got != 1 {
+		t.Errorf("decode(coil 9) = %v, want 1", got)
+	}
+	if got := decode(config.ModbusRegisterConfig{Address: 8}, bits, []byte{0x00, 0x02}); got != 0 {
+		t.Errorf("decode(coil 8) = %v, want 0", got)
+	}
+}
+
+// fakeServer answers Modbus TCP reads: holding registers from regs and
+// coils from coils. Reads of input registers get an illegal function
+// exception.
+func fakeServer(t *testing.T, regs map[uint16]uint16, coils map[uint16]bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					header := make([]byte, mbapHeaderSize)
+					if _, err := io.ReadFull(conn, header); err != nil {
+						return
+					}
+					pdu := make([]byte, binary.BigEndian.Uint16(header[4:])-1)
+					if _, err := io.ReadFull(conn, pdu); err != nil {
+						return
+					}
+					start := binary.BigEndian.Uint16(pdu[1:])
+					count := binary.BigEndian.Uint16(pdu[3:])
+
+					var resp []byte
+					switch pdu[0] {
+					case funcReadHoldingRegisters:
+						resp = []byte{pdu[0], byte(count * 2)}
+						for i := uint16(0); i < count; i++ {
+							resp = binary.BigEndian.AppendUint16(resp, regs[start+i])
+						}
+					case funcReadCoils:
+						data := make([]byte, (count+7)/8)
+						for i := uint16(0); i < count; i++ {
+							if coils[start+i] {
+								data[i/8] |= 1 << (i % 8)
+							}
+						}
+						resp = append([]byte{pdu[0], byte(len(data))}, data...)
+					default:
+						resp = []byte{pdu[0] | 0x80, 0x01}
+					}
+
+					binary.BigEndian.PutUint16(header[4:], uint16(len(resp)+1))
+					if _, err := conn.Write(append(header, resp...)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPollTCP(t *testing.T) {
+	address := fakeServer(t,
+		map[uint16]uint16{10: 2315, 11: 0xFFFF},
+		map[uint16]bool{3: true},
+	)
+
+	device := &config.ModbusDeviceConfig{
+		Name:      "meter",
+		Transport: "tcp",
+		Address:   address,
+		UnitID:    1,
+		Timeout:   time.Second,
+		Registers: []config.ModbusRegisterConfig{
+			{Name: "voltage", Type: "holding", Address: 10, Scale: 0.1},
+			{Name: "delta", Type: "holding", Address: 11, Format: "int16"},
+			{Name: "running", Type: "coil", Address: 3},
+			{Name: "flow", Type: "input", Address: 0},
+		},
+	}
+
+	reading, err := Poll(context.Background(), device)
+	if err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+
+	if got := reading.Values["voltage"]; math.Abs(got-231.5) > 1e-9 {
+		t.Errorf("voltage = %v, want 231.5", got)
+	}
+	if got := reading.Values["delta"]; got != -1 {
+		t.Errorf("delta = %v, want -1", got)
+	}
+	if got := reading.Values["running"]; got != 1 {
+		t.Errorf("running = %v, want 1", got)
+	}
+	if _, ok := reading.Values["flow"]; ok {
+		t.Error("flow should not have a value")
+	}
+	if !strings.Contains(reading.Errors["flow"], "illegal function") {
+		t.Errorf("flow error = %q, want illegal function", reading.Errors["flow"])
+	}
+}
+
+func TestPollUnreachable(t *testing.T) {
+	// Grab a free port and close it so nothing is listening
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	device := &config.ModbusDeviceConfig{
+		Name:      "meter",
+		Transport: "tcp",
+		Address:   address,
+		Timeout:   time.Second,
+		Registers: []config.ModbusRegisterConfig{{Name: "voltage", Type: "holding"}},
+	}
+	if _, err := Poll(context.Background(), device); err == nil {
+		t.Error("Poll() should fail when the device is unreachable")
+	}
+}
+
+// fakePort is a serial port that has a canned response waiting
+type fakePort struct {
+	written bytes.Buffer
+	resp    *bytes.Reader
+}
+
+func (p *fakePort) Write(b []byte) (int, error) { return p.written.Write(b) }
+func (p *fakePort) Read(b []byte) (int, error)  { return p.resp.Read(b) }
+func (p *fakePort) Close() error                { return nil }
+
+func TestRTURequest(t *testing.T) {
+	port := &fakePort{resp: bytes.NewReader(appendCRC([]byte{0x11, 0x03, 0x02, 0x00, 0x2A}))}
+	rtu := &rtuTransport{port: port}
+
+	resp, err := rtu.request(0x11, []byte{0x03, 0x00, 0x6B, 0x00, 0x01})
+	if err != nil {
+		t.Fatalf("request() error = %v", err)
+	}
+	if want := []byte{0x03, 0x02, 0x00, 0x2A}; !bytes.Equal(resp, want) {
+		t.Errorf("request() = % x, want % x", resp, want)
+	}
+	if want := appendCRC([]byte{0x11, 0x03, 0x00, 0x6B, 0x00, 0x01}); !bytes.Equal(port.written.Bytes(), want) {
+		t.Errorf("wrote % x, want % x", port.written.Bytes(), want)
+	}
+}
+
+func TestRTURequestErrors(t *testing.T) {
+	corrupt := appendCRC([]byte{0x11, 0x03, 0x02, 0x00, 0x2A})
+	corrupt[4] ^= 0xFF
+
+	tests := []struct {
+		name string
+		resp []byte
+		want string
+	}{
+		{"timeout", nil, "timeout"},
+		{"short", []byte{0x11, 0x03, 0x02, 0x00}, "timeout"},
+		{"bad crc", corrupt, "CRC"},
+		{"wrong unit", appendCRC([]byte{0x12, 0x03, 0x02, 0x00, 0x2A}), "unit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtu := &rtuTransport{port: &fakePort{resp: bytes.NewReader(tt.resp)}}
+			_, err := rtu.request(0x11, []byte{0x03, 0x00, 0x6B, 0x00, 0x01})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("request() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRTUException(t *testing.T) {
+	port := &fakePort{resp: bytes.NewReader(appendCRC([]byte{0x11, 0x83, 0x02}))}
+	rtu := &rtuTransport{port: port}
+
+	_, err := readBlock(rtu, 0x11, block{function: funcReadHoldingRegisters, start: 0x6B, count: 1})
+	if err == nil || !strings.Contains(err.Error(), "illegal data address") {
+		t.Errorf("readBlock() error = %v, want illegal data address", err)
+	}
+}
@@ -0,0 +1,142 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// Protocol limits per read request
+const (
+	maxRegistersPerRead = 125
+	maxBitsPerRead      = 2000
+)
+
+// maxGap is the largest run of unmapped registers (or bits) read through to
+// merge two mapped values into one request. Reading a few unused registers
+// is much cheaper than another round trip, especially on a serial bus.
+const maxGap = 8
+
+// block is one read request covering one or more mapped values
+type block struct {
+	function  byte
+	start     uint16
+	count     uint16
+	registers []config.ModbusRegisterConfig
+}
+
+// plan groups registers into as few read requests as possible
+func plan(registers []config.ModbusRegisterConfig) []block {
+	byFunction := make(map[byte][]config.ModbusRegisterConfig)
+	for _, reg := range registers {
+		fn := function(reg.Type)
+		byFunction[fn] = append(byFunction[fn], reg)
+	}
+
+	var blocks []block
+	for _, fn := range []byte{funcReadCoils, funcReadDiscreteInputs, funcReadHoldingRegisters, funcReadInputRegisters} {
+		regs := byFunction[fn]
+		if len(regs) == 0 {
+			continue
+		}
+		sort.SliceStable(regs, func(i, j int) bool { return regs[i].Address < regs[j].Address })
+
+		limit := maxRegistersPerRead
+		if fn == funcReadCoils || fn == funcReadDiscreteInputs {
+			limit = maxBitsPerRead
+		}
+
+		var current *block
+		for _, reg := range regs {
+			start, end := reg.Address, reg.Address+width(reg)
+			if current != nil {
+				currentEnd := int(current.start) + int(current.count)
+				if start <= currentEnd+maxGap && end-int(current.start) <= limit {
+					if end > currentEnd {
+						current.count = uint16(end - int(current.start))
+					}
+					current.registers = append(current.registers, reg)
+					continue
+				}
+				blocks = append(blocks, *current)
+			}
+			current = &block{
+				function:  fn,
+				start:     uint16(start),
+				count:     uint16(end - start),
+				registers: []config.ModbusRegisterConfig{reg},
+			}
+		}
+		blocks = append(blocks, *current)
+	}
+	return blocks
+}
+
+// function returns the read function code for a register type
+func function(registerType string) byte {
+	switch registerType {
+	case "coil":
+		return funcReadCoils
+	case "discrete":
+		return funcReadDiscreteInputs
+	case "input":
+		return funcReadInputRegisters
+	default:
+		return funcReadHoldingRegisters
+	}
+}
+
+// width returns the number of registers (or bits) a value occupies
+func width(reg config.ModbusRegisterConfig) int {
+	switch reg.Format {
+	case "uint32", "int32", "float32":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// decode extracts reg from the data of the block that read it and applies
+// scale and offset
+func decode(reg config.ModbusRegisterConfig, b block, data []byte) float64 {
+	index := reg.Address - int(b.start)
+
+	var raw float64
+	switch b.function {
+	case funcReadCoils, funcReadDiscreteInputs:
+		raw = float64(data[index/8] >> (index % 8) & 1)
+	default:
+		words := data[index*2:]
+		switch reg.Format {
+		case "int16":
+			raw = float64(int16(binary.BigEndian.Uint16(words)))
+		case "uint32":
+			raw = float64(uint32Value(words, reg.WordOrder))
+		case "int32":
+			raw = float64(int32(uint32Value(words, reg.WordOrder)))
+		case "float32":
+			raw = float64(math.Float32frombits(uint32Value(words, reg.WordOrder)))
+		default:
+			raw = float64(binary.BigEndian.Uint16(words))
+		}
+	}
+
+	scale := reg.Scale
+	if scale == 0 {
+		scale = 1
+	}
+	return raw*scale + reg.Offset
+}
+
+// uint32Value combines two registers. Each register is big-endian; word
+// order "little" puts the low word first, as many PLCs do.
+func uint32Value(words []byte, wordOrder string) uint32 {
+	first := uint32(binary.BigEndian.Uint16(words))
+	second := uint32(binary.BigEndian.Uint16(words[2:]))
+	if wordOrder == "little" {
+		return second<<16 | first
+	}
+	return first<<16 | second
+}
@@ -0,0 +1,107 @@
+package modbus
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/serial"
+)
+
+// rtuTransport speaks Modbus RTU over a serial port
+type rtuTransport struct {
+	port io.ReadWriteCloser
+	gap  time.Duration // Silent interval required between frames
+}
+
+// openRTU opens and configures the device's serial port
+func openRTU(cfg config.SerialConfig, timeout time.Duration) (*rtuTransport, error) {
+	port, err := serial.Open(cfg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &rtuTransport{port: port, gap: frameGap(serial.Defaults(cfg).BaudRate)}, nil
+}
+
+// frameGap is the 3.5 character silence that delimits RTU frames, fixed at
+// 1.75ms above 19200 baud as the specification recommends
+func frameGap(baud int) time.Duration {
+	if baud > 19200 {
+		return 1750 * time.Microsecond
+	}
+	// 11 bits per character (start, 8 data, parity/stop, stop)
+	return time.Duration(float64(time.Second) * 3.5 * 11 / float64(baud))
+}
+
+func (t *rtuTransport) request(unit byte, pdu []byte) ([]byte, error) {
+	frame := make([]byte, 0, len(pdu)+3)
+	frame = append(frame, unit)
+	frame = append(frame, pdu...)
+	frame = appendCRC(frame)
+
+	time.Sleep(t.gap)
+	if _, err := t.port.Write(frame); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	// Unit, function, then either an exception code or a byte count
+	resp := make([]byte, 3, 256)
+	if err := t.read(resp); err != nil {
+		return nil, err
+	}
+	rest := 2 // CRC
+	if resp[1]&0x80 == 0 {
+		rest += int(resp[2])
+	}
+	resp = resp[:3+rest]
+	if err := t.read(resp[3:]); err != nil {
+		return nil, err
+	}
+
+	if crc(resp[:len(resp)-2]) != uint16(resp[len(resp)-2])|uint16(resp[len(resp)-1])<<8 {
+		return nil, fmt.Errorf("response CRC mismatch")
+	}
+	if resp[0] != unit {
+		return nil, fmt.Errorf("response from unit %d, want %d", resp[0], unit)
+	}
+	return resp[1 : len(resp)-2], nil
+}
+
+// read fills buf, treating a read that returns no data as a timeout
+func (t *rtuTransport) read(buf []byte) error {
+	if _, err := io.ReadFull(t.port, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("timeout waiting for response")
+		}
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil
+}
+
+func (t *rtuTransport) Close() error {
+	return t.port.Close()
+}
+
+// crc returns the Modbus CRC-16 of data
+func crc(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xA001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// appendCRC appends the CRC of frame, low byte first
+func appendCRC(frame []byte) []byte {
+	c := crc(frame)
+	return append(frame, byte(c), byte(c>>8))
+}
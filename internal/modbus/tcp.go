@@ -0,0 +1,73 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// mbapHeaderSize is the Modbus TCP header: transaction ID, protocol ID,
+// length and unit ID
+const mbapHeaderSize = 7
+
+// tcpTransport speaks Modbus TCP over one connection
+type tcpTransport struct {
+	conn    net.Conn
+	timeout time.Duration
+	txID    uint16
+}
+
+// dialTCP connects to a Modbus TCP device (or TCP/RTU gateway)
+func dialTCP(ctx context.Context, address string, timeout time.Duration) (*tcpTransport, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+	return &tcpTransport{conn: conn, timeout: timeout}, nil
+}
+
+func (t *tcpTransport) request(unit byte, pdu []byte) ([]byte, error) {
+	t.txID++
+	frame := make([]byte, mbapHeaderSize+len(pdu))
+	binary.BigEndian.PutUint16(frame[0:], t.txID)
+	binary.BigEndian.PutUint16(frame[2:], 0) // Protocol ID: Modbus
+	binary.BigEndian.PutUint16(frame[4:], uint16(len(pdu)+1))
+	frame[6] = unit
+	copy(frame[mbapHeaderSize:], pdu)
+
+	if err := t.conn.SetDeadline(time.Now().Add(t.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := t.conn.Write(frame); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	header := make([]byte, mbapHeaderSize)
+	if _, err := io.ReadFull(t.conn, header); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	length := int(binary.BigEndian.Uint16(header[4:]))
+	if length < 2 || length > 254 {
+		return nil, fmt.Errorf("invalid response length %d", length)
+	}
+	resp := make([]byte, length-1)
+	if _, err := io.ReadFull(t.conn, resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if txID := binary.BigEndian.Uint16(header[0:]); txID != t.txID {
+		return nil, fmt.Errorf("response transaction ID %d does not match request %d", txID, t.txID)
+	}
+	if header[6] != unit {
+		return nil, fmt.Errorf("response from unit %d, want %d", header[6], unit)
+	}
+	return resp, nil
+}
+
+func (t *tcpTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,367 @@
+// Package mqtt bridges a site-local MQTT broker into telemetry. It
+// subscribes to the topic filters of the mqtt rules and republishes each
+// message on {prefix}.{code}.telemetry.mqtt.<subject> through JetStream,
+// so existing sensor networks flow into the same pipeline. It implements
+// the subset of MQTT 3.1.1 a subscriber needs (QoS 0 and 1).
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Reconnect backoff bounds
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+// dialTimeout bounds connecting and the CONNECT/CONNACK exchange
+const dialTimeout = 10 * time.Second
+
+// Publisher sends a message to JetStream
+type Publisher interface {
+	PublishTelemetry(subject, msgID string, data []byte) error
+}
+
+// Message is published for each bridged MQTT message. The payload is
+// carried in data if it is JSON, otherwise in text (UTF-8) or base64.
+type Message struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	tasks.MessageMeta
+
+	Topic    string          `json:"topic"`
+	Retained bool            `json:"retained,omitempty"` // Sent by the broker on subscribe, not a new reading
+	Data     json.RawMessage `json:"data,omitempty"`
+	Text     string          `json:"text,omitempty"`
+	Base64   []byte          `json:"base64,omitempty"`
+	TS       string          `json:"ts"`
+}
+
+// Bridge maintains the broker connection and republishes messages
+type Bridge struct {
+	cfg      config.MQTTConfig
+	code     string
+	location string
+	prefix   string
+	logger   *zap.Logger
+
+	mu        sync.Mutex
+	sequences map[string]uint64 // Per subject suffix, see tasks.MessageMeta
+
+	done chan struct{} // Closed when Run returns
+}
+
+// New creates a bridge. Call Run to connect.
+func New(cfg config.MQTTConfig, code, location, prefix string, logger *zap.Logger) *Bridge {
+	if cfg.ClientID == "" {
+		cfg.ClientID = "agent-" + code
+	}
+	return &Bridge{
+		cfg:       cfg,
+		code:      code,
+		location:  location,
+		prefix:    prefix,
+		logger:    logger.With(zap.String("component", "mqtt")),
+		sequences: make(map[string]uint64),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run connects to the broker and bridges messages until ctx is cancelled,
+// reconnecting with backoff whenever the connection is lost
+func (b *Bridge) Run(ctx context.Context, pub Publisher) {
+	defer close(b.done)
+
+	backoff := minBackoff
+	for {
+		connected, err := b.session(ctx, pub)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = minBackoff
+		}
+		b.logger.Warn("MQTT connection lost, reconnecting",
+			zap.String("broker", b.cfg.Broker),
+			zap.Duration("retry_in", backoff),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// Wait blocks until Run has disconnected and returned, or the timeout
+// expires
+func (b *Bridge) Wait(timeout time.Duration) {
+	select {
+	case <-b.done:
+	case <-time.After(timeout):
+	}
+}
+
+// session runs one connection until it fails or ctx is cancelled. connected
+// reports whether the broker accepted the connection.
+func (b *Bridge) session(ctx context.Context, pub Publisher) (connected bool, err error) {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := &lockedWriter{conn: conn}
+
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := b.connect(r, w); err != nil {
+		return false, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	subs := b.subscriptions()
+	if err := writePacket(w, packetSubscribe<<4|0x02, subscribePacket(1, subs)); err != nil {
+		return true, fmt.Errorf("failed to subscribe: %w", err)
+	}
+	b.logger.Info("Connected to MQTT broker",
+		zap.String("broker", b.cfg.Broker),
+		zap.Int("subscriptions", len(subs)))
+
+	// Keep alive pings, and a DISCONNECT on shutdown that also unblocks the
+	// read loop
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(b.cfg.KeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				writePacket(w, packetDisconnect<<4, nil)
+				conn.Close()
+				return
+			case <-ticker.C:
+				if err := writePacket(w, packetPingreq<<4, nil); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	// The broker must answer a ping within the keep alive period, so 1.5x
+	// without any packet means the connection is dead
+	for {
+		conn.SetReadDeadline(time.Now().Add(b.cfg.KeepAlive * 3 / 2))
+		header, body, err := readPacket(r)
+		if errors.Is(err, errPacketTooLarge) {
+			b.logger.Warn("Dropped MQTT message larger than the maximum size",
+				zap.Int("max_bytes", maxPacketSize))
+			continue
+		}
+		if err != nil {
+			return true, err
+		}
+
+		switch header >> 4 {
+		case packetPublish:
+			p, err := parsePublish(header, body)
+			if err != nil {
+				return true, err
+			}
+			b.forward(pub, p)
+			if p.qos == 1 {
+				ack := []byte{byte(p.packetID >> 8), byte(p.packetID)}
+				if err := writePacket(w, packetPuback<<4, ack); err != nil {
+					return true, err
+				}
+			}
+		case packetSuback:
+			b.checkSuback(subs, body)
+		case packetPingresp:
+		default:
+			b.logger.Debug("Ignoring MQTT packet", zap.Uint8("type", header>>4))
+		}
+	}
+}
+
+// dial connects to the broker, with TLS for tls://, ssl:// and mqtts://
+func (b *Bridge) dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(b.cfg.Broker)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch u.Scheme {
+	case "tls", "ssl", "mqtts":
+		tlsConfig := &tls.Config{
+			ServerName: u.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		}
+		if b.cfg.CAFile != "" {
+			pem, err := os.ReadFile(b.cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca_file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in ca_file %s", b.cfg.CAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		return tlsDialer.DialContext(ctx, "tcp", u.Host)
+	default:
+		return dialer.DialContext(ctx, "tcp", u.Host)
+	}
+}
+
+// connect sends CONNECT and waits for the broker to accept it
+func (b *Bridge) connect(r *bufio.Reader, w *lockedWriter) error {
+	password := ""
+	if b.cfg.PasswordEnv != "" {
+		password = os.Getenv(b.cfg.PasswordEnv)
+	}
+	body := connectPacket(b.cfg.ClientID, b.cfg.Username, password, uint16(b.cfg.KeepAlive/time.Second))
+	if err := writePacket(w, packetConnect<<4, body); err != nil {
+		return fmt.Errorf("failed to send connect: %w", err)
+	}
+
+	header, resp, err := readPacket(r)
+	if err != nil {
+		return fmt.Errorf("failed to read connack: %w", err)
+	}
+	if header>>4 != packetConnack || len(resp) != 2 {
+		return fmt.Errorf("unexpected response to connect (packet type %d)", header>>4)
+	}
+	if resp[1] != 0 {
+		return connackError(resp[1])
+	}
+	return nil
+}
+
+// subscriptions returns each distinct topic filter at the highest QoS any
+// rule requests for it
+func (b *Bridge) subscriptions() []subscription {
+	var subs []subscription
+	index := make(map[string]int)
+	for _, rule := range b.cfg.Rules {
+		if i, ok := index[rule.Topic]; ok {
+			subs[i].qos = max(subs[i].qos, byte(rule.QoS))
+			continue
+		}
+		index[rule.Topic] = len(subs)
+		subs = append(subs, subscription{filter: rule.Topic, qos: byte(rule.QoS)})
+	}
+	return subs
+}
+
+// checkSuback logs filters the broker refused (return code 0x80), usually
+// because of its ACLs
+func (b *Bridge) checkSuback(subs []subscription, body []byte) {
+	if len(body) < 2 {
+		return
+	}
+	for i, code := range body[2:] {
+		if code == 0x80 && i < len(subs) {
+			b.logger.Error("MQTT broker refused subscription", zap.String("topic", subs[i].filter))
+		}
+	}
+}
+
+// forward republishes a message under the subject of the first rule whose
+// filter matches its topic
+func (b *Bridge) forward(pub Publisher, p *publishPacket) {
+	for _, rule := range b.cfg.Rules {
+		captures, ok := match(rule.Topic, p.topic)
+		if !ok {
+			continue
+		}
+
+		suffix := "telemetry.mqtt." + expand(rule.Subject, captures)
+		subject := fmt.Sprintf("%s.%s.%s", b.prefix, b.code, suffix)
+
+		message := &Message{
+			Code:        b.code,
+			Location:    b.location,
+			MessageMeta: b.nextMeta(suffix),
+			Topic:       p.topic,
+			Retained:    p.retain,
+			TS:          utils.NowRFC3339(),
+		}
+		switch {
+		case json.Valid(p.payload):
+			message.Data = p.payload
+		case utf8.Valid(p.payload):
+			message.Text = string(p.payload)
+		default:
+			message.Base64 = p.payload
+		}
+
+		data, err := json.Marshal(message)
+		if err != nil {
+			b.logger.Error("Failed to marshal MQTT message", zap.String("topic", p.topic), zap.Error(err))
+			return
+		}
+		if err := pub.PublishTelemetry(subject, message.MsgID(b.code, suffix, message.TS), data); err != nil {
+			b.logger.Error("Failed to queue MQTT message publish", zap.String("topic", p.topic), zap.Error(err))
+			return
+		}
+		b.logger.Debug("Bridged MQTT message",
+			zap.String("topic", p.topic),
+			zap.String("subject", subject),
+			zap.Int("bytes", len(p.payload)))
+		return
+	}
+
+	b.logger.Debug("No rule matches MQTT topic", zap.String("topic", p.topic))
+}
+
+// nextMeta returns the metadata for the next message on a subject suffix
+func (b *Bridge) nextMeta(suffix string) tasks.MessageMeta {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sequences[suffix]++
+	return tasks.MessageMeta{
+		SchemaVersion: tasks.SchemaVersion,
+		Sequence:      b.sequences[suffix],
+	}
+}
+
+// lockedWriter serializes writes from the read loop (PUBACK) and the keep
+// alive goroutine (PINGREQ, DISCONNECT)
+type lockedWriter struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	return w.conn.Write(p)
+}
@@ -0,0 +1,252 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          [][]string
+		ok            bool
+	}{
+		{"sensors/temp", "sensors/temp", nil, true},
+		{"sensors/temp", "sensors/humidity", nil, false},
+		{"sensors/+/temp", "sensors/room1/temp", [][]string{{"room1"}}, true},
+		{"sensors/+/temp", "sensors/room1/humidity", nil, false},
+		{"sensors/+", "sensors/room1/temp", nil, false},
+		{"sensors/#", "sensors/room1/temp", [][]string{{"room1", "temp"}}, true},
+		{"sensors/#", "sensors", [][]string{{}}, true},
+		{"+/+/#", "a/b/c/d", [][]string{{"a"}, {"b"}, {"c", "d"}}, true},
+		{"#", "$SYS/broker/uptime", nil, false},
+		{"$SYS/#", "$SYS/broker/uptime", [][]string{{"broker", "uptime"}}, true},
+	}
+	for _, tt := range tests {
+		got, ok := match(tt.filter, tt.topic)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("match(%q, %q) = %v, %v, want %v, %v", tt.filter, tt.topic, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		subject  string
+		captures [][]string
+		want     string
+	}{
+		{"zigbee", nil, "zigbee"},
+		{"zigbee.{1}", [][]string{{"living room"}}, "zigbee.living_room"},
+		{"{2}.{1}", [][]string{{"a"}, {"b"}}, "b.a"},
+		{"tele.{1}", [][]string{{"x", "y.z"}}, "tele.x.y_z"},
+		{"tele.{1}", [][]string{{""}}, "tele._"},
+	}
+	for _, tt := range tests {
+		if got := expand(tt.subject, tt.captures); got != tt.want {
+			t.Errorf("expand(%q, %v) = %q, want %q", tt.subject, tt.captures, got, tt.want)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 70000} {
+		body := bytes.Repeat([]byte{0xAB}, size)
+		var buf bytes.Buffer
+		if err := writePacket(&buf, packetPublish<<4|0x02, body); err != nil {
+			t.Fatal(err)
+		}
+		header, got, err := readPacket(bufio.NewReader(&buf))
+		if err != nil {
+			t.Fatalf("readPacket(%d bytes) error = %v", size, err)
+		}
+		if header != packetPublish<<4|0x02 || !bytes.Equal(got, body) {
+			t.Errorf("readPacket(%d bytes) returned header %#x and %d bytes", size, header, len(got))
+		}
+	}
+}
+
+func TestParsePublish(t *testing.T) {
+	body := appendString(nil, "sensors/temp")
+	body = binary.BigEndian.AppendUint16(body, 7)
+	body = append(body, `{"c":21.5}`...)
+
+	p, err := parsePublish(packetPublish<<4|0x02|0x01, body)
+	if err != nil {
+		t.Fatalf("parsePublish() error = %v", err)
+	}
+	if p.topic != "sensors/temp" || p.qos != 1 || !p.retain || p.packetID != 7 || string(p.payload) != `{"c":21.5}` {
+		t.Errorf("parsePublish() = %+v", p)
+	}
+
+	if _, err := parsePublish(packetPublish<<4, []byte{0x00, 0x09, 'a'}); err == nil {
+		t.Error("parsePublish() should reject a truncated topic")
+	}
+}
+
+// fakePublisher records telemetry publishes
+type fakePublisher struct {
+	mu       sync.Mutex
+	subjects []string
+	messages []Message
+}
+
+func (p *fakePublisher) PublishTelemetry(subject, msgID string, data []byte) error {
+	var m Message
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subjects = append(p.subjects, subject)
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+func (p *fakePublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.messages)
+}
+
+// fakeBroker accepts one client, checks its CONNECT and SUBSCRIBE, sends
+// the given publishes, and returns the packet ID of each PUBACK received
+func fakeBroker(t *testing.T, publishes [][]byte) (string, <-chan uint16) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	acks := make(chan uint16, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+
+		header, body, err := readPacket(r)
+		if err != nil || header>>4 != packetConnect {
+			t.Errorf("expected CONNECT, got type %d (%v)", header>>4, err)
+			return
+		}
+		if !bytes.Contains(body, []byte("agent-test-device")) {
+			t.Errorf("CONNECT should carry the default client ID: %q", body)
+		}
+		writePacket(conn, packetConnack<<4, []byte{0, 0})
+
+		header, body, err = readPacket(r)
+		if err != nil || header != packetSubscribe<<4|0x02 {
+			t.Errorf("expected SUBSCRIBE, got header %#x (%v)", header, err)
+			return
+		}
+		writePacket(conn, packetSuback<<4, []byte{body[0], body[1], 1, 0})
+
+		for _, p := range publishes {
+			conn.Write(p)
+		}
+
+		for {
+			header, body, err := readPacket(r)
+			if err != nil {
+				return
+			}
+			if header>>4 == packetPuback {
+				acks <- binary.BigEndian.Uint16(body)
+			}
+		}
+	}()
+	return ln.Addr().String(), acks
+}
+
+// publish builds a PUBLISH packet
+func publish(topic string, qos byte, packetID uint16, payload string) []byte {
+	body := appendString(nil, topic)
+	if qos > 0 {
+		body = binary.BigEndian.AppendUint16(body, packetID)
+	}
+	body = append(body, payload...)
+	var buf bytes.Buffer
+	writePacket(&buf, packetPublish<<4|qos<<1, body)
+	return buf.Bytes()
+}
+
+func TestBridge(t *testing.T) {
+	address, acks := fakeBroker(t, [][]byte{
+		publish("zigbee2mqtt/living room", 1, 42, `{"temperature":21.5}`),
+		publish("zigbee2mqtt/kitchen", 0, 0, "on"),
+		publish("other/topic", 0, 0, "ignored"),
+		publish("meters/main/power", 0, 0, "1500"),
+	})
+
+	cfg := config.MQTTConfig{
+		Broker:    "tcp://" + address,
+		KeepAlive: time.Minute,
+		Rules: []config.MQTTRuleConfig{
+			{Topic: "zigbee2mqtt/+", Subject: "zigbee.{1}", QoS: 1},
+			{Topic: "meters/#", Subject: "meters"},
+		},
+	}
+	bridge := New(cfg, "test-device", "hq", "agents", zap.NewNop())
+	pub := &fakePublisher{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go bridge.Run(ctx, pub)
+	defer func() {
+		cancel()
+		bridge.Wait(5 * time.Second)
+	}()
+
+	select {
+	case id := <-acks:
+		if id != 42 {
+			t.Errorf("PUBACK packet ID = %d, want 42", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no PUBACK for the QoS 1 message")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pub.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pub.mu.Lock()
+	defer pub.mu.Unlock()
+	wantSubjects := []string{
+		"agents.test-device.telemetry.mqtt.zigbee.living_room",
+		"agents.test-device.telemetry.mqtt.zigbee.kitchen",
+		"agents.test-device.telemetry.mqtt.meters",
+	}
+	if !reflect.DeepEqual(pub.subjects, wantSubjects) {
+		t.Fatalf("subjects = %v, want %v", pub.subjects, wantSubjects)
+	}
+
+	first := pub.messages[0]
+	if first.Code != "test-device" || first.Location != "hq" || first.Topic != "zigbee2mqtt/living room" || first.Sequence != 1 {
+		t.Errorf("first message = %+v", first)
+	}
+	if string(first.Data) != `{"temperature":21.5}` {
+		t.Errorf("first message data = %s", first.Data)
+	}
+	if pub.messages[1].Text != "on" || pub.messages[1].Data != nil {
+		t.Errorf("non-JSON payload should be carried as text: %+v", pub.messages[1])
+	}
+	if string(pub.messages[2].Data) != "1500" {
+		t.Errorf("numeric payload should be carried as data: %s", pub.messages[2].Data)
+	}
+}
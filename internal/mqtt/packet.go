@@ -0,0 +1,190 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MQTT 3.1.1 control packet types (high nibble of the fixed header)
+const (
+	packetConnect    = 1
+	packetConnack    = 2
+	packetPublish    = 3
+	packetPuback     = 4
+	packetSubscribe  = 8
+	packetSuback     = 9
+	packetPingreq    = 12
+	packetPingresp   = 13
+	packetDisconnect = 14
+)
+
+// maxPacketSize bounds an incoming packet. Larger publishes are discarded;
+// they would not fit in a default NATS message anyway.
+const maxPacketSize = 1024 * 1024
+
+// errPacketTooLarge is returned by readPacket after discarding a packet
+// larger than maxPacketSize
+var errPacketTooLarge = errors.New("packet exceeds maximum size")
+
+// writePacket writes a packet with the given first header byte (type and
+// flags) and body
+func writePacket(w io.Writer, header byte, body []byte) error {
+	packet := make([]byte, 0, 5+len(body))
+	packet = append(packet, header)
+	packet = appendLength(packet, len(body))
+	packet = append(packet, body...)
+	_, err := w.Write(packet)
+	return err
+}
+
+// readPacket reads one packet and returns its first header byte and body
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Remaining length: up to four 7-bit groups, least significant first
+	length := 0
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	if length > maxPacketSize {
+		if _, err := r.Discard(length); err != nil {
+			return 0, nil, err
+		}
+		return header, nil, errPacketTooLarge
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// appendLength appends n as an MQTT remaining length
+func appendLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+// appendString appends a length-prefixed UTF-8 string
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// connectPacket builds the CONNECT body. A clean session is always used:
+// the bridge resubscribes on every connect.
+func connectPacket(clientID, username, password string, keepAliveSeconds uint16) []byte {
+	flags := byte(0x02) // Clean session
+	if username != "" {
+		flags |= 0x80
+	}
+	if password != "" {
+		flags |= 0x40
+	}
+
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // Protocol level 4 = MQTT 3.1.1
+	body = binary.BigEndian.AppendUint16(body, keepAliveSeconds)
+	body = appendString(body, clientID)
+	if username != "" {
+		body = appendString(body, username)
+	}
+	if password != "" {
+		body = appendString(body, password)
+	}
+	return body
+}
+
+// connackError describes a refused CONNACK return code
+func connackError(code byte) error {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[code]; ok {
+		return fmt.Errorf("connection refused: %s", reason)
+	}
+	return fmt.Errorf("connection refused: code %d", code)
+}
+
+// subscription is one topic filter and its requested QoS
+type subscription struct {
+	filter string
+	qos    byte
+}
+
+// subscribePacket builds the SUBSCRIBE body
+func subscribePacket(packetID uint16, subs []subscription) []byte {
+	body := binary.BigEndian.AppendUint16(nil, packetID)
+	for _, sub := range subs {
+		body = appendString(body, sub.filter)
+		body = append(body, sub.qos)
+	}
+	return body
+}
+
+// publishPacket is a decoded incoming PUBLISH
+type publishPacket struct {
+	topic    string
+	qos      byte
+	retain   bool
+	packetID uint16
+	payload  []byte
+}
+
+// parsePublish decodes a PUBLISH from its header byte and body
+func parsePublish(header byte, body []byte) (*publishPacket, error) {
+	p := &publishPacket{
+		qos:    header >> 1 & 0x03,
+		retain: header&0x01 != 0,
+	}
+	if len(body) < 2 {
+		return nil, fmt.Errorf("malformed publish")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return nil, fmt.Errorf("malformed publish topic")
+	}
+	p.topic = string(body[2 : 2+n])
+	rest := body[2+n:]
+
+	if p.qos > 0 {
+		if len(rest) < 2 {
+			return nil, fmt.Errorf("malformed publish packet identifier")
+		}
+		p.packetID = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	p.payload = rest
+	return p, nil
+}
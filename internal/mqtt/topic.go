@@ -0,0 +1,82 @@
+package mqtt
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// invalidToken matches characters not allowed in a NATS subject token
+var invalidToken = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// placeholder matches a {n} subject token
+var placeholder = regexp.MustCompile(`^\{([1-9][0-9]*)\}$`)
+
+// match reports whether topic matches filter and returns the levels matched
+// by each wildcard. A # capture holds every remaining level. As the spec
+// requires, wildcards at the first level don't match $-prefixed topics
+// such as $SYS.
+func match(filter, topic string) ([][]string, bool) {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return nil, false
+	}
+
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	var captures [][]string
+	for i, level := range filterLevels {
+		if level == "#" {
+			// "a/#" also matches "a" itself, with nothing captured
+			return append(captures, topicLevels[min(i, len(topicLevels)):]), true
+		}
+		if i >= len(topicLevels) {
+			return nil, false
+		}
+		switch level {
+		case "+":
+			captures = append(captures, topicLevels[i:i+1])
+		case topicLevels[i]:
+		default:
+			return nil, false
+		}
+	}
+	if len(filterLevels) != len(topicLevels) {
+		return nil, false
+	}
+	return captures, true
+}
+
+// expand builds a subject suffix from a rule subject, replacing each {n}
+// with the levels captured by the nth wildcard. Captured levels are made
+// safe as NATS tokens; a multi-level capture becomes several tokens.
+func expand(subject string, captures [][]string) string {
+	tokens := strings.Split(subject, ".")
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		m := placeholder.FindStringSubmatch(token)
+		if m == nil {
+			out = append(out, token)
+			continue
+		}
+		n, _ := strconv.Atoi(m[1])
+		if n > len(captures) {
+			continue
+		}
+		for _, level := range captures[n-1] {
+			out = append(out, sanitize(level))
+		}
+	}
+	if len(out) == 0 {
+		return "_"
+	}
+	return strings.Join(out, ".")
+}
+
+// sanitize replaces characters that are not valid in a subject token
+func sanitize(level string) string {
+	if level == "" {
+		return "_"
+	}
+	return invalidToken.ReplaceAllString(level, "_")
+}
@@ -0,0 +1,200 @@
+package nats
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"go.uber.org/zap"
+)
+
+// Requester headers for commands.authorization.identity "signed". A control
+// plane sets them on each command and signs SignedPayload with an nkey
+// listed in commands.authorization.trusted_keys.
+const (
+	RequesterHeader = "Agent-Requester"
+	RoleHeader      = "Agent-Role"
+	SignedAtHeader  = "Agent-Signed-At" // Unix seconds
+	SignatureHeader = "Agent-Signature" // Unpadded base64url nkey signature
+)
+
+// requestInfoHeader is the requesting client's info, added by the server to
+// messages delivered through a service import with share: true
+const requestInfoHeader = "Nats-Request-Info"
+
+// requestInfoRolePrefix marks the user JWT tag carrying the role (e.g. a
+// tag "role:operator" set by an auth callout)
+const requestInfoRolePrefix = "role:"
+
+// SignedPayload returns what is signed for a command: the subject,
+// requester, role, signing time and the hex SHA-256 of the body, one per
+// line
+func SignedPayload(subject, requester, role, signedAt string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return []byte(strings.Join([]string{subject, requester, role, signedAt, hex.EncodeToString(sum[:])}, "\n"))
+}
+
+// requester is who sent a command and the role they act in
+type requester struct {
+	name string
+	role string
+}
+
+// identify returns the requester of msg, or nil if msg carries no
+// identity. A signature older than max_skew is rejected; a queued command
+// may also have waited in the stream, so its signature may be up to
+// commands.queue.ttl older. The age is taken from the signing time, not
+// from when the stream stored the message, so a captured command
+// republished to the queue is rejected once the signature is too old.
+func (h *CommandHandlers) identify(msg *nats.Msg, queued bool) (*requester, error) {
+	auth := &h.config.Commands.Authorization
+	if auth.Identity == "request_info" {
+		raw := msg.Header.Get(requestInfoHeader)
+		if raw == "" {
+			return nil, nil
+		}
+		var info struct {
+			User    string   `json:"user"`
+			NameTag string   `json:"name_tag"`
+			Tags    []string `json:"tags"`
+		}
+		if err := json.Unmarshal([]byte(raw), &info); err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", requestInfoHeader, err)
+		}
+		who := &requester{name: info.User}
+		if info.NameTag != "" {
+			who.name = info.NameTag
+		}
+		for _, tag := range info.Tags {
+			if role, ok := strings.CutPrefix(tag, requestInfoRolePrefix); ok {
+				who.role = role
+				break
+			}
+		}
+		return who, nil
+	}
+
+	signature := msg.Header.Get(SignatureHeader)
+	if signature == "" {
+		return nil, nil
+	}
+	name := msg.Header.Get(RequesterHeader)
+	role := msg.Header.Get(RoleHeader)
+	signedAt := msg.Header.Get(SignedAtHeader)
+	if name == "" || role == "" || signedAt == "" {
+		return nil, fmt.Errorf("signed command is missing %s, %s or %s", RequesterHeader, RoleHeader, SignedAtHeader)
+	}
+	unix, err := strconv.ParseInt(signedAt, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", SignedAtHeader, signedAt)
+	}
+	maxAge := auth.MaxSkew
+	if queued {
+		maxAge += h.config.Commands.Queue.TTL
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > maxAge || age < -auth.MaxSkew {
+		return nil, fmt.Errorf("signature time is %v off (max %v)", age.Round(time.Second), maxAge)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s encoding", SignatureHeader)
+	}
+
+	payload := SignedPayload(msg.Subject, name, role, signedAt, msg.Data)
+	for _, key := range auth.TrustedKeys {
+		kp, err := nkeys.FromPublicKey(key)
+		if err != nil {
+			continue
+		}
+		if kp.Verify(payload, sig) == nil {
+			return &requester{name: name, role: role}, nil
+		}
+	}
+	return nil, errors.New("signature not made by a trusted key")
+}
+
+// authorize checks that the requester's role allows command, writing the
+// decision to the audit log, and returns the requester's name ("" without
+// identity). A denied command gets an error reply and false is returned.
+// Always true when authorization is disabled.
+func (h *CommandHandlers) authorize(command string, msg *nats.Msg) (string, bool) {
+	auth := &h.config.Commands.Authorization
+	if !auth.Enabled {
+		return "", true
+	}
+
+	queued := h.queued(msg)
+	who, err := h.identify(msg, queued)
+	name, role := "", auth.DefaultRole
+	if who != nil {
+		name = who.name
+		if who.role != "" {
+			role = who.role
+		}
+	}
+
+	patterns, known := auth.Roles[role]
+	var reason string
+	switch {
+	case err != nil:
+		reason = err.Error()
+	case role == "":
+		reason = "no requester identity"
+	case !known:
+		reason = fmt.Sprintf("unknown role %s", role)
+	case !roleAllows(patterns, command):
+		reason = fmt.Sprintf("role %s may not run %s", role, command)
+	}
+
+	fields := []zap.Field{
+		zap.String("command", command),
+		zap.String("subject", msg.Subject),
+		zap.String("requester", name),
+		zap.String("role", role),
+		zap.Bool("queued", queued),
+	}
+	if reason == "" {
+		h.audit.Info("Command allowed", fields...)
+		return name, true
+	}
+	h.audit.Warn("Command denied", append(fields, zap.String("reason", reason))...)
+	h.taskExecutor.RecordCommandError(errors.New(reason))
+	h.respondError(msg, "Permission denied: "+reason)
+	return name, false
+}
+
+// requesterOf returns the name of the requester of msg for audit records,
+// or "" if authorization is disabled or msg carries no valid identity
+func (h *CommandHandlers) requesterOf(msg *nats.Msg) string {
+	if !h.config.Commands.Authorization.Enabled {
+		return ""
+	}
+	queued := h.queued(msg)
+	who, err := h.identify(msg, queued)
+	if err != nil || who == nil {
+		return ""
+	}
+	return who.name
+}
+
+// roleAllows reports whether command matches one of a role's command
+// patterns: an exact name, a prefix ending in ".*", or "*"
+func roleAllows(patterns []string, command string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == command {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+	return false
+}
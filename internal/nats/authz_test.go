@@ -0,0 +1,78 @@
+package nats
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func TestIdentifySignatureAge(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := kp.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.Commands.Authorization = config.CommandAuthConfig{
+		Enabled:     true,
+		Identity:    "signed",
+		MaxSkew:     5 * time.Minute,
+		TrustedKeys: []string{key},
+	}
+	cfg.Commands.Queue.TTL = time.Hour
+	h := &CommandHandlers{config: cfg}
+
+	signed := func(age time.Duration) *nats.Msg {
+		msg := &nats.Msg{Subject: "agents.dev-1.cmd.ping", Data: []byte("{}"), Header: nats.Header{}}
+		signedAt := strconv.FormatInt(time.Now().Add(-age).Unix(), 10)
+		sig, err := kp.Sign(SignedPayload(msg.Subject, "ops", "operator", signedAt, msg.Data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg.Header.Set(RequesterHeader, "ops")
+		msg.Header.Set(RoleHeader, "operator")
+		msg.Header.Set(SignedAtHeader, signedAt)
+		msg.Header.Set(SignatureHeader, base64.RawURLEncoding.EncodeToString(sig))
+		return msg
+	}
+
+	tests := []struct {
+		name    string
+		age     time.Duration
+		queued  bool
+		wantErr string
+	}{
+		{name: "fresh", age: time.Minute},
+		{name: "past max_skew", age: 10 * time.Minute, wantErr: "signature time"},
+		{name: "future", age: -10 * time.Minute, wantErr: "signature time"},
+		{name: "queued within ttl", age: time.Hour, queued: true},
+		{name: "queued within ttl and max_skew", age: time.Hour + 4*time.Minute, queued: true},
+		{name: "queued past ttl and max_skew", age: 2 * time.Hour, queued: true, wantErr: "signature time"},
+		{name: "queued future", age: -10 * time.Minute, queued: true, wantErr: "signature time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			who, err := h.identify(signed(tt.age), tt.queued)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("identify() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || who == nil || who.name != "ops" || who.role != "operator" {
+				t.Errorf("identify() = %+v, %v", who, err)
+			}
+		})
+	}
+}
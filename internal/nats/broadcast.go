@@ -0,0 +1,165 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// broadcastToken takes the place of the code in fleet-wide subjects
+const broadcastToken = "broadcast"
+
+// BroadcastReply is an agent's reply on a fleet-wide subject. Many agents
+// answer one request, so each reply says which agent sent it.
+type BroadcastReply struct {
+	Code      string            `json:"code"`
+	Location  string            `json:"location"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Command   string            `json:"command"`
+	Response  json.RawMessage   `json:"response,omitempty"`  // The reply a cmd.<command> request would have received
+	Truncated bool              `json:"truncated,omitempty"` // Response exceeded max_reply_bytes and was left out
+	Size      int               `json:"size,omitempty"`      // Size of a left out response, in bytes
+	TS        string            `json:"ts"`
+}
+
+// subscribeBroadcast subscribes to the fleet-wide subjects of every
+// commands.broadcast.commands entry
+func (h *CommandHandlers) subscribeBroadcast(client *Client) error {
+	c := &h.config.Commands.Broadcast
+	if !c.Enabled {
+		return nil
+	}
+
+	handlers := make(map[string]nats.MsgHandler)
+	for _, cmd := range h.commands() {
+		handlers[cmd.name] = cmd.handler
+	}
+	delay := broadcastDelay(h.code, c.MaxDelay)
+	for _, name := range c.Commands {
+		handler, ok := handlers[name]
+		if !ok {
+			return fmt.Errorf("broadcast command %s not found", name)
+		}
+		wrapped := h.broadcastHandler(name, h.handleWithRecovery(name, handler), delay)
+		for _, subject := range h.broadcastSubjects(name) {
+			if _, err := client.Subscribe(subject, wrapped); err != nil {
+				return err
+			}
+		}
+	}
+
+	h.logger.Info("Fleet-wide commands enabled",
+		zap.Strings("commands", c.Commands),
+		zap.Duration("reply_delay", delay))
+	return nil
+}
+
+// broadcastSubjects returns the fleet-wide subjects of command: one for
+// every agent, and one per broadcast tag this agent has for the agents
+// sharing its value
+func (h *CommandHandlers) broadcastSubjects(command string) []string {
+	subjects := []string{fmt.Sprintf("%s.%s.cmd.%s", h.subjectPrefix, broadcastToken, command)}
+	for _, tag := range h.config.Commands.Broadcast.Tags {
+		if value, ok := h.config.Tags[tag]; ok {
+			subjects = append(subjects, fmt.Sprintf("%s.%s.%s.%s.cmd.%s", h.subjectPrefix, broadcastToken, tag, value, command))
+		}
+	}
+	return subjects
+}
+
+// broadcastHandler runs a fleet-wide command like its cmd.<command>
+// counterpart (authorization included), then sends the reply after delay.
+// The handler returns straight away, so the delay doesn't hold up the
+// subscription.
+func (h *CommandHandlers) broadcastHandler(name string, handler nats.MsgHandler, delay time.Duration) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		if msg.Reply == "" {
+			return
+		}
+
+		// A copy without Reply, so the reply can only come back through the capture
+		local := &nats.Msg{Subject: msg.Subject, Header: msg.Header, Data: msg.Data}
+		var response []byte
+		h.captures.Store(local, &capture{reply: func(data []byte) { response = data }, limitKey: inboxKey(msg.Reply)})
+		handler(local)
+		h.captures.Delete(local)
+
+		data, err := json.Marshal(h.broadcastReply(name, response))
+		if err != nil {
+			h.logger.Error("Failed to marshal broadcast reply", zap.String("command", name), zap.Error(err))
+			return
+		}
+		h.sendBroadcastReply(name, msg.Reply, data, delay)
+	}
+}
+
+// sendBroadcastReply publishes a broadcast reply on the command connection
+// after delay, unless StopBroadcasts is called first
+func (h *CommandHandlers) sendBroadcastReply(name, subject string, data []byte, delay time.Duration) {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+	if h.broadcastStopped {
+		return
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		h.broadcastMu.Lock()
+		delete(h.broadcastTimers, timer)
+		h.broadcastMu.Unlock()
+
+		if err := h.natsClient.publishReply(h.natsClient.newMsg(subject, data)); err != nil {
+			h.logger.Warn("Failed to send broadcast reply", zap.String("command", name), zap.Error(err))
+		}
+	})
+	h.broadcastTimers[timer] = struct{}{}
+}
+
+// StopBroadcasts drops the broadcast replies still waiting out their delay,
+// and any later ones, so none is sent on a draining connection
+func (h *CommandHandlers) StopBroadcasts() {
+	h.broadcastMu.Lock()
+	defer h.broadcastMu.Unlock()
+	h.broadcastStopped = true
+	for timer := range h.broadcastTimers {
+		timer.Stop()
+	}
+	clear(h.broadcastTimers)
+}
+
+// broadcastReply wraps a command reply, leaving it out if it is larger than
+// commands.broadcast.max_reply_bytes so one agent can't blow the
+// requester's payload budget
+func (h *CommandHandlers) broadcastReply(name string, response []byte) *BroadcastReply {
+	reply := &BroadcastReply{
+		Code:     h.code,
+		Location: h.config.Location,
+		Tags:     h.config.Tags,
+		Command:  name,
+		Response: response,
+		TS:       utils.NowRFC3339(),
+	}
+	if limit := h.config.Commands.Broadcast.MaxReplyBytes; len(response) > limit {
+		reply.Response = nil
+		reply.Truncated = true
+		reply.Size = len(response)
+	}
+	return reply
+}
+
+// broadcastDelay is an agent's fixed reply delay in [0, maxDelay), derived
+// from its code so replies from a fleet are spread evenly and a repeated
+// request sees the same order
+func broadcastDelay(code string, maxDelay time.Duration) time.Duration {
+	if maxDelay <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(code))
+	return time.Duration(hash.Sum64() % uint64(maxDelay))
+}
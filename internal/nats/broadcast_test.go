@@ -0,0 +1,26 @@
+package nats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopBroadcasts(t *testing.T) {
+	h := &CommandHandlers{broadcastTimers: make(map[*time.Timer]struct{})}
+
+	h.sendBroadcastReply("ping", "_INBOX.reply", []byte("{}"), time.Hour)
+	if len(h.broadcastTimers) != 1 {
+		t.Fatalf("pending replies = %d, want 1", len(h.broadcastTimers))
+	}
+
+	h.StopBroadcasts()
+	if len(h.broadcastTimers) != 0 {
+		t.Errorf("pending replies after StopBroadcasts = %d, want 0", len(h.broadcastTimers))
+	}
+
+	// Replies to broadcasts arriving while the connection drains are dropped
+	h.sendBroadcastReply("ping", "_INBOX.reply", []byte("{}"), 0)
+	if len(h.broadcastTimers) != 0 {
+		t.Errorf("pending replies after a late broadcast = %d, want 0", len(h.broadcastTimers))
+	}
+}
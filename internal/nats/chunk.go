@@ -0,0 +1,132 @@
+package nats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ChunkHeader numbers the messages of a chunked reply as "<seq>/<chunks>":
+// 0 is the manifest and 1..chunks carry the reply
+const ChunkHeader = "Agent-Chunk"
+
+// chunkHeadroom is left free in each chunk for its headers. It covers the
+// tag headers (at most 32 tags of 64+256 bytes) and the chunk header.
+// Servers with a max_payload under 4x this leave a quarter of it instead.
+const chunkHeadroom = 16 * 1024
+
+// maxChunkedReply caps a chunked reply, so a runaway command can't flood
+// the requester
+const maxChunkedReply = 32 * 1024 * 1024
+
+// errReplyTooLarge is returned by chunkMsgs for a reply over maxChunkedReply
+var errReplyTooLarge = errors.New("reply too large")
+
+// ChunkManifest is the first message of a command reply too large for the
+// server's max_payload. The reply follows on the same subject as chunks
+// whose data, joined in ChunkHeader order, is the reply a smaller command
+// would have got in one message. A requester expecting one reply sees the
+// manifest, so a large reply never fails silently.
+type ChunkManifest struct {
+	Status   string `json:"status"` // Always "chunked"
+	Code     string `json:"code"`
+	Chunks   int    `json:"chunks"`
+	Size     int    `json:"size"`               // Reply size in bytes
+	SHA256   string `json:"sha256"`             // Hex digest of the joined reply
+	Encoding string `json:"encoding,omitempty"` // Compression of the joined reply, as in the chunks' Agent-Encoding header
+	TS       string `json:"ts"`
+}
+
+// maxChunk is the largest reply data one message on the command
+// connection can carry. 0 if the server hasn't said.
+func (c *Client) maxChunk() int {
+	return chunkSize(c.commandConn().MaxPayload())
+}
+
+// chunkSize is the reply data one message can carry under maxPayload: it
+// less chunkHeadroom, or less a quarter of it when it is small
+func chunkSize(maxPayload int64) int {
+	headroom := min(int(maxPayload)/4, chunkHeadroom)
+	return max(int(maxPayload)-headroom, 0)
+}
+
+// chunkMsgs splits a reply into its manifest and chunks of at most size
+// bytes, addressed to subject. A reply over maxChunkedReply is an error.
+func (c *Client) chunkMsgs(subject, code string, data []byte, size int, encoding string) ([]*nats.Msg, error) {
+	if len(data) > maxChunkedReply {
+		return nil, fmt.Errorf("%w: %d bytes (max %d)", errReplyTooLarge, len(data), maxChunkedReply)
+	}
+
+	chunks := (len(data) + size - 1) / size
+	digest := sha256.Sum256(data)
+	manifest, err := json.Marshal(ChunkManifest{
+		Status:   "chunked",
+		Code:     code,
+		Chunks:   chunks,
+		Size:     len(data),
+		SHA256:   hex.EncodeToString(digest[:]),
+		Encoding: encoding,
+		TS:       utils.NowRFC3339(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chunk manifest: %w", err)
+	}
+
+	msgs := make([]*nats.Msg, 0, chunks+1)
+	msgs = append(msgs, c.newChunkMsg(subject, manifest, 0, chunks, ""))
+	for seq := 1; seq <= chunks; seq++ {
+		chunk := data[(seq-1)*size : min(seq*size, len(data))]
+		msgs = append(msgs, c.newChunkMsg(subject, chunk, seq, chunks, encoding))
+	}
+	return msgs, nil
+}
+
+// newChunkMsg builds one message of a chunked reply
+func (c *Client) newChunkMsg(subject string, data []byte, seq, chunks int, encoding string) *nats.Msg {
+	msg := c.newEncodedMsg(subject, data, encoding)
+	if msg.Header == nil {
+		msg.Header = make(nats.Header, 1)
+	}
+	msg.Header.Set(ChunkHeader, fmt.Sprintf("%d/%d", seq, chunks))
+	return msg
+}
+
+// respondChunked sends a reply larger than one message as a manifest and
+// sequenced chunks of at most size bytes. A compressed reply is split after
+// compression: the manifest describes the compressed bytes.
+func (h *CommandHandlers) respondChunked(msg *nats.Msg, data []byte, size int, encoding string) {
+	msgs, err := h.natsClient.chunkMsgs(msg.Reply, h.code, data, size, encoding)
+	if errors.Is(err, errReplyTooLarge) {
+		h.logger.Warn("Command reply too large to send",
+			zap.String("subject", msg.Subject),
+			zap.Int("bytes", len(data)),
+			zap.Int("max", maxChunkedReply))
+		h.respondError(msg, fmt.Sprintf("Reply too large: %d bytes (max %d)", len(data), maxChunkedReply))
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to split command reply", zap.Error(err))
+		return
+	}
+
+	for seq, chunk := range msgs {
+		if err := h.natsClient.publishReply(chunk); err != nil {
+			h.logger.Warn("Failed to publish reply chunk",
+				zap.String("subject", msg.Subject),
+				zap.Int("chunk", seq),
+				zap.Int("chunks", len(msgs)-1),
+				zap.Error(err))
+			return
+		}
+	}
+	h.logger.Debug("Sent chunked reply",
+		zap.String("subject", msg.Subject),
+		zap.Int("bytes", len(data)),
+		zap.Int("chunks", len(msgs)-1))
+}
@@ -0,0 +1,128 @@
+package nats
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestChunkSize(t *testing.T) {
+	tests := []struct {
+		maxPayload int64
+		want       int
+	}{
+		{maxPayload: 0, want: 0},
+		{maxPayload: 1024 * 1024, want: 1024*1024 - chunkHeadroom},
+		{maxPayload: 4 * chunkHeadroom, want: 3 * chunkHeadroom},
+		{maxPayload: 16 * 1024, want: 12 * 1024},
+		{maxPayload: 4 * 1024, want: 3 * 1024},
+	}
+
+	for _, tt := range tests {
+		if got := chunkSize(tt.maxPayload); got != tt.want {
+			t.Errorf("chunkSize(%d) = %d, want %d", tt.maxPayload, got, tt.want)
+		}
+	}
+}
+
+func TestChunkMsgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		size       int
+		data       int
+		encoding   string
+		wantChunks int
+	}{
+		{name: "one over", size: 10, data: 11, wantChunks: 2},
+		{name: "exact multiple", size: 10, data: 30, wantChunks: 3},
+		{name: "one under multiple", size: 10, data: 29, wantChunks: 3},
+		{name: "compressed", size: 10, data: 25, encoding: "zstd", wantChunks: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{tags: nats.Header{"Agent-Tag-Site": {"plant-1"}}}
+			data := make([]byte, tt.data)
+			for i := range data {
+				data[i] = byte(i)
+			}
+
+			msgs, err := c.chunkMsgs("_INBOX.reply", "dev-1", data, tt.size, tt.encoding)
+			if err != nil {
+				t.Fatalf("chunkMsgs() error = %v", err)
+			}
+			if len(msgs) != tt.wantChunks+1 {
+				t.Fatalf("chunkMsgs() = %d messages, want %d", len(msgs), tt.wantChunks+1)
+			}
+
+			var manifest ChunkManifest
+			if err := json.Unmarshal(msgs[0].Data, &manifest); err != nil {
+				t.Fatalf("manifest: %v", err)
+			}
+			digest := sha256.Sum256(data)
+			want := ChunkManifest{
+				Status:   "chunked",
+				Code:     "dev-1",
+				Chunks:   tt.wantChunks,
+				Size:     tt.data,
+				SHA256:   hex.EncodeToString(digest[:]),
+				Encoding: tt.encoding,
+				TS:       manifest.TS,
+			}
+			if manifest != want {
+				t.Errorf("manifest = %+v, want %+v", manifest, want)
+			}
+			if got := msgs[0].Header.Get(EncodingHeader); got != "" {
+				t.Errorf("manifest %s = %q, want none", EncodingHeader, got)
+			}
+
+			var joined []byte
+			for seq, msg := range msgs {
+				if msg.Subject != "_INBOX.reply" {
+					t.Errorf("message %d subject = %q", seq, msg.Subject)
+				}
+				if got, want := msg.Header.Get(ChunkHeader), fmt.Sprintf("%d/%d", seq, tt.wantChunks); got != want {
+					t.Errorf("message %d %s = %q, want %q", seq, ChunkHeader, got, want)
+				}
+				if got := msg.Header.Get("Agent-Tag-Site"); got != "plant-1" {
+					t.Errorf("message %d tag header = %q, want plant-1", seq, got)
+				}
+				if seq == 0 {
+					continue
+				}
+				if len(msg.Data) > tt.size {
+					t.Errorf("chunk %d is %d bytes, want at most %d", seq, len(msg.Data), tt.size)
+				}
+				if got := msg.Header.Get(EncodingHeader); got != tt.encoding {
+					t.Errorf("chunk %d %s = %q, want %q", seq, EncodingHeader, got, tt.encoding)
+				}
+				joined = append(joined, msg.Data...)
+			}
+			if !bytes.Equal(joined, data) {
+				t.Error("joined chunks differ from the reply")
+			}
+		})
+	}
+}
+
+func TestChunkMsgsTooLarge(t *testing.T) {
+	c := &Client{}
+	_, err := c.chunkMsgs("_INBOX.reply", "dev-1", make([]byte, maxChunkedReply+1), 1024*1024, "")
+	if !errors.Is(err, errReplyTooLarge) {
+		t.Errorf("chunkMsgs() error = %v, want %v", err, errReplyTooLarge)
+	}
+
+	msgs, err := c.chunkMsgs("_INBOX.reply", "dev-1", make([]byte, maxChunkedReply), 1024*1024, "")
+	if err != nil {
+		t.Fatalf("chunkMsgs() at the limit error = %v", err)
+	}
+	if len(msgs) != 33 {
+		t.Errorf("chunkMsgs() at the limit = %d messages, want 33", len(msgs))
+	}
+}
@@ -4,51 +4,65 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
 	"go.uber.org/zap"
 )
 
 // Client manages the NATS connection and provides methods for publishing and subscribing
 type Client struct {
-	conn   *nats.Conn
-	js     nats.JetStreamContext
-	logger *zap.Logger
-	config *config.NATSConfig
+	conn    *nats.Conn
+	cmdConn *nats.Conn // Command request/reply connection, nil unless nats.command_connection
+	js      nats.JetStreamContext
+	logger  *zap.Logger
+	config  *config.NATSConfig
+	tls     *tlsReloader // Nil unless TLS hot-reload is active
+
+	tags     nats.Header   // Device tags sent with every publish, nil if none
+	degraded chan struct{} // Signalled on reconnect and publish failure, see Degraded
+
+	recent      *recentTelemetry // Last telemetry payloads, nil unless commands.diag keeps some
+	limiter     *publishLimiter  // Telemetry rate limit, nil unless nats.publish_limits is set
+	stopLimiter chan struct{}
+	stopOnce    sync.Once
 }
 
 // NewClient creates a new NATS client with the specified configuration
 func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 	opts := []nats.Option{
-		nats.Name("win-agent"),
 		nats.MaxReconnects(cfg.MaxReconnects),
 		nats.ReconnectWait(cfg.ReconnectWait),
-		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
-			if err != nil {
-				logger.Warn("NATS disconnected", zap.Error(err))
-			} else {
-				logger.Info("NATS disconnected")
-			}
-		}),
-		nats.ReconnectHandler(func(nc *nats.Conn) {
-			logger.Info("NATS reconnected", zap.String("url", nc.ConnectedUrl()))
-		}),
-		nats.ClosedHandler(func(nc *nats.Conn) {
-			logger.Info("NATS connection closed")
-		}),
-		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
-			logger.Error("NATS error",
-				zap.Error(err),
-				zap.String("subject", sub.Subject))
-		}),
+	}
+
+	// Outbound buffering; 0 keeps the nats.go default
+	if cfg.ReconnectBufSizeMB > 0 {
+		opts = append(opts, nats.ReconnectBufSize(cfg.ReconnectBufSizeMB*1024*1024))
+	}
+	if cfg.FlusherTimeout > 0 {
+		opts = append(opts, nats.FlusherTimeout(cfg.FlusherTimeout))
+	}
+
+	// Keepalive and dial tuning; 0 keeps the nats.go default
+	if cfg.PingInterval > 0 {
+		opts = append(opts, nats.PingInterval(cfg.PingInterval))
+	}
+	if cfg.MaxPingsOut > 0 {
+		opts = append(opts, nats.MaxPingsOutstanding(cfg.MaxPingsOut))
+	}
+	if cfg.ConnectTimeout > 0 {
+		opts = append(opts, nats.Timeout(cfg.ConnectTimeout))
 	}
 
 	// Configure TLS if enabled
+	var reloader *tlsReloader
 	if cfg.TLS.Enabled {
 		tlsConfig, err := createTLSConfig(&cfg.TLS, logger)
 		if err != nil {
@@ -56,22 +70,62 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 		}
 
 		opts = append(opts, nats.Secure(tlsConfig))
+		if cfg.TLS.HandshakeFirst {
+			opts = append(opts, nats.TLSHandshakeFirst())
+		}
 		logger.Info("TLS enabled for NATS connection",
 			zap.Bool("client_cert", cfg.TLS.CertFile != ""),
 			zap.Bool("ca_cert", cfg.TLS.CAFile != ""),
-			zap.Bool("skip_verify", cfg.TLS.InsecureSkipVerify))
+			zap.Bool("skip_verify", cfg.TLS.InsecureSkipVerify),
+			zap.Bool("handshake_first", cfg.TLS.HandshakeFirst))
 
 		// Warn if insecure skip verify is enabled
 		if cfg.TLS.InsecureSkipVerify {
 			logger.Warn("TLS certificate verification is DISABLED - this is insecure and should only be used in development")
 		}
+
+		// Serve cert/CA through callbacks so rotated files are picked up on reconnect
+		if cfg.TLS.ReloadInterval > 0 {
+			reloader, err = newTLSReloader(&cfg.TLS, logger)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load TLS files: %w", err)
+			}
+			if reloader != nil {
+				opts = append(opts, nats.ClientTLSConfig(reloader.certCallback(), reloader.rootCAsCallback()))
+			}
+		}
 	}
 
 	// Add authentication based on config type
 	switch cfg.Auth.Type {
 	case "creds":
-		logger.Info("Using credentials file authentication", zap.String("file", cfg.Auth.CredsFile))
-		opts = append(opts, nats.UserCredentials(cfg.Auth.CredsFile))
+		logger.Info("Using credentials file authentication",
+			zap.String("file", cfg.Auth.CredsFile),
+			zap.String("secret_store", cfg.Auth.SecretStore))
+		if secretOpts := secretOptions(&cfg.Auth); secretOpts.Protected() {
+			credsOpt, err := protectedCredsOption(cfg.Auth.CredsFile, secretOpts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load credentials: %w", err)
+			}
+			opts = append(opts, credsOpt)
+		} else {
+			opts = append(opts, nats.UserCredentials(cfg.Auth.CredsFile))
+		}
+	case "nkey":
+		logger.Info("Using nkey authentication",
+			zap.String("file", cfg.Auth.NkeyFile),
+			zap.String("secret_store", cfg.Auth.SecretStore))
+		var nkeyOpt nats.Option
+		var err error
+		if secretOpts := secretOptions(&cfg.Auth); secretOpts.Protected() {
+			nkeyOpt, err = protectedNkeyOption(cfg.Auth.NkeyFile, secretOpts)
+		} else {
+			nkeyOpt, err = nats.NkeyOptionFromSeed(cfg.Auth.NkeyFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load nkey seed: %w", err)
+		}
+		opts = append(opts, nkeyOpt)
 	case "token":
 		logger.Info("Using token authentication")
 		opts = append(opts, nats.Token(cfg.Auth.Token))
@@ -87,7 +141,9 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 	// Pass all URLs for automatic failover
 	serverURLs := strings.Join(cfg.URLs, ",")
 	logger.Info("Connecting to NATS", zap.Strings("urls", cfg.URLs))
-	conn, err := nats.Connect(serverURLs, opts...)
+	degraded := make(chan struct{}, 1)
+	onReconnect := func() { signal(degraded) }
+	conn, err := nats.Connect(serverURLs, append(opts, connectionOptions("win-agent", logger, onReconnect)...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
@@ -99,7 +155,11 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 
 	// Create JetStream context for telemetry publishing
 	logger.Info("Creating JetStream context...")
-	js, err := conn.JetStream()
+	jsOpts := jetStreamOptions(cfg)
+	if cfg.PendingLimits.Publishes > 0 {
+		jsOpts = append(jsOpts, nats.PublishAsyncMaxPending(cfg.PendingLimits.Publishes))
+	}
+	js, err := conn.JetStream(jsOpts...)
 	if err != nil {
 		conn.Close()
 		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
@@ -117,12 +177,83 @@ func NewClient(cfg *config.NATSConfig, logger *zap.Logger) (*Client, error) {
 
 	logger.Info("JetStream validated successfully")
 
-	return &Client{
-		conn:   conn,
-		js:     js,
-		logger: logger,
-		config: cfg,
-	}, nil
+	// Commands get their own connection so a publish backlog on the
+	// telemetry connection can't delay ping/health replies
+	var cmdConn *nats.Conn
+	if cfg.CommandConnection {
+		cmdLogger := logger.With(zap.String("connection", "commands"))
+		cmdConn, err = nats.Connect(serverURLs, append(opts, connectionOptions("win-agent-cmd", cmdLogger, nil)...)...)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to connect command connection to NATS: %w", err)
+		}
+		cmdLogger.Info("Connected to NATS", zap.String("url", cmdConn.ConnectedUrl()))
+	}
+
+	c := &Client{
+		conn:        conn,
+		cmdConn:     cmdConn,
+		js:          js,
+		logger:      logger,
+		config:      cfg,
+		tls:         reloader,
+		degraded:    degraded,
+		limiter:     newPublishLimiter(cfg.PublishLimits),
+		stopLimiter: make(chan struct{}),
+	}
+	if c.limiter != nil {
+		go c.releaseLimited()
+	}
+
+	return c, nil
+}
+
+// jetStreamOptions returns the options shared by every JetStream context
+func jetStreamOptions(cfg *config.NATSConfig) []nats.JSOpt {
+	if cfg.JetStreamDomain == "" {
+		return nil
+	}
+	return []nats.JSOpt{nats.Domain(cfg.JetStreamDomain)}
+}
+
+// connectionOptions returns the name and event handlers for one connection.
+// onReconnect (optional) runs after each reconnect.
+func connectionOptions(name string, logger *zap.Logger, onReconnect func()) []nats.Option {
+	return []nats.Option{
+		nats.Name(name),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("NATS disconnected", zap.Error(err))
+			} else {
+				logger.Info("NATS disconnected")
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("NATS reconnected", zap.String("url", nc.ConnectedUrl()))
+			if onReconnect != nil {
+				onReconnect()
+			}
+		}),
+		nats.ClosedHandler(func(nc *nats.Conn) {
+			logger.Info("NATS connection closed")
+		}),
+		nats.ErrorHandler(func(nc *nats.Conn, sub *nats.Subscription, err error) {
+			logger.Error("NATS error",
+				zap.Error(err),
+				zap.String("subject", sub.Subject))
+		}),
+	}
+}
+
+// WatchTLS polls the TLS cert/key/CA files and reconnects with the new
+// material when they change. No-op unless tls.reload_interval is set and a
+// client certificate or CA file is configured. Stops when ctx is cancelled.
+func (c *Client) WatchTLS(ctx context.Context) {
+	if c.tls == nil {
+		return
+	}
+	c.logger.Info("TLS hot-reload enabled", zap.Duration("interval", c.config.TLS.ReloadInterval))
+	go c.tls.watch(ctx, c.config.TLS.ReloadInterval, c.Reconnect)
 }
 
 // createTLSConfig creates a TLS configuration based on the provided settings
@@ -180,26 +311,124 @@ func createTLSConfig(cfg *config.TLSConfig, logger *zap.Logger) (*tls.Config, er
 // agent should not deliver a backlog of stale liveness beacons. This matches
 // the heartbeat semantics of the other stone-age.io applications.
 func (c *Client) Publish(subject string, data []byte) error {
-	if err := c.conn.Publish(subject, data); err != nil {
+	return c.publishMsg(c.newMsg(subject, data))
+}
+
+// publishMsg is Publish for a message built by the caller
+func (c *Client) publishMsg(msg *nats.Msg) error {
+	return c.publishOn(c.conn, msg)
+}
+
+// publishReply publishes a command reply on the connection commands
+// arrive on
+func (c *Client) publishReply(msg *nats.Msg) error {
+	return c.publishOn(c.commandConn(), msg)
+}
+
+func (c *Client) publishOn(conn *nats.Conn, msg *nats.Msg) error {
+	if err := conn.PublishMsg(msg); err != nil {
+		if conn == c.conn {
+			signal(c.degraded)
+		}
 		c.logger.Warn("Failed to publish message",
-			zap.String("subject", subject),
+			zap.String("subject", msg.Subject),
 			zap.Error(err))
-		return fmt.Errorf("failed to publish to %s: %w", subject, err)
+		return fmt.Errorf("failed to publish to %s: %w", msg.Subject, err)
 	}
 
 	c.logger.Debug("Published message",
-		zap.String("subject", subject),
-		zap.Int("bytes", len(data)))
+		zap.String("subject", msg.Subject),
+		zap.Int("bytes", len(msg.Data)))
 	return nil
 }
 
+// PublishUnlogged is Publish without logging, for the agent log shipper:
+// logging a failed publish would queue another shipped entry
+func (c *Client) PublishUnlogged(subject string, data []byte) error {
+	return c.conn.PublishMsg(c.newMsg(subject, data))
+}
+
+// TagHeaderPrefix prefixes each device tag key to form its message header
+// (e.g. "Agent-Tag-site")
+const TagHeaderPrefix = "Agent-Tag-"
+
+// SetTags sends the device tags (config tags) as headers on every message
+// the agent publishes, so consumers can filter without decoding payloads.
+// Must be called before the first publish.
+func (c *Client) SetTags(tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	c.tags = make(nats.Header, len(tags))
+	for key, value := range tags {
+		c.tags[TagHeaderPrefix+key] = []string{value}
+	}
+}
+
+// newMsg builds a message carrying the tag headers. Each message gets its
+// own header map, since JetStream publish options add to it.
+func (c *Client) newMsg(subject string, data []byte) *nats.Msg {
+	msg := &nats.Msg{Subject: subject, Data: data}
+	if c.tags != nil {
+		msg.Header = make(nats.Header, len(c.tags)+1)
+		for key, values := range c.tags {
+			msg.Header[key] = values
+		}
+	}
+	return msg
+}
+
+// newEncodedMsg is newMsg for data compressed with encoding, named in the
+// EncodingHeader ("" = uncompressed)
+func (c *Client) newEncodedMsg(subject string, data []byte, encoding string) *nats.Msg {
+	msg := c.newMsg(subject, data)
+	if encoding != "" {
+		if msg.Header == nil {
+			msg.Header = make(nats.Header, 1)
+		}
+		msg.Header.Set(EncodingHeader, encoding)
+	}
+	return msg
+}
+
 // PublishTelemetry publishes a message to JetStream asynchronously (fire-and-forget)
 // This is used for metrics, service status, and inventory
-// Uses PublishAsync for better performance and built-in retry handling
-func (c *Client) PublishTelemetry(subject string, data []byte) error {
+// Uses PublishAsync for better performance and built-in retry handling.
+// msgID is sent as Nats-Msg-Id for server-side dedup (empty = none).
+func (c *Client) PublishTelemetry(subject, msgID string, data []byte) error {
+	return c.publishTelemetry(subject, msgID, data, false)
+}
+
+// PublishTelemetryCompressed is PublishTelemetry for large payloads (see
+// nats.compression): data of at least min_bytes is sent zstd-compressed
+// with an Agent-Encoding header
+func (c *Client) PublishTelemetryCompressed(subject, msgID string, data []byte) error {
+	return c.publishTelemetry(subject, msgID, data, c.config.Compression.Enabled)
+}
+
+func (c *Client) publishTelemetry(subject, msgID string, data []byte, compress bool) error {
+	// Diagnostics bundles keep the payload as it was before compression
+	if c.recent != nil {
+		c.recent.add(subject, data)
+	}
+	p := queuedPublish{subject: subject, msgID: msgID, data: data}
+	if compress && len(data) >= c.config.Compression.MinBytes {
+		p.data, p.encoding = tasks.CompressZstd(data), tasks.EncodingZstd
+	}
+	if c.limiter != nil && !c.limiter.admit(time.Now(), p) {
+		c.logger.Debug("Telemetry publish rate limited", zap.String("subject", subject))
+		return nil
+	}
+	return c.publishAsync(p)
+}
+
+// publishAsync queues a JetStream publish and logs its outcome
+func (c *Client) publishAsync(p queuedPublish) error {
+	subject, data := p.subject, p.data
+
 	// PublishAsync returns a PubAckFuture immediately (non-blocking)
 	// The actual publish happens in the background with automatic retries
-	pubAckFuture, err := c.js.PublishAsync(subject, data)
+	pubAckFuture, err := c.js.PublishMsgAsync(c.newEncodedMsg(subject, data, p.encoding), msgIDOpts(p.msgID)...)
 	if err != nil {
 		// This only fails if we can't queue the message (very rare)
 		c.logger.Error("Failed to queue telemetry publish",
@@ -221,6 +450,7 @@ func (c *Client) PublishTelemetry(subject string, data []byte) error {
 		case err := <-pubAckFuture.Err():
 			// Publication failed after retries
 			// Log but don't crash - telemetry is fire-and-forget
+			signal(c.degraded)
 			c.logger.Warn("Failed to publish telemetry after retries",
 				zap.String("subject", subject),
 				zap.Error(err))
@@ -230,10 +460,56 @@ func (c *Client) PublishTelemetry(subject string, data []byte) error {
 	return nil
 }
 
+// releaseLimited publishes rate-limited telemetry as subject windows reset,
+// until the client drains or closes
+func (c *Client) releaseLimited() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopLimiter:
+			return
+		case now := <-ticker.C:
+			for _, p := range c.limiter.release(now) {
+				c.publishAsync(p)
+			}
+		}
+	}
+}
+
+// stopLimited stops releasing rate-limited telemetry. Publishes still
+// queued are discarded.
+func (c *Client) stopLimited() {
+	if c.limiter == nil {
+		return
+	}
+	c.stopOnce.Do(func() {
+		close(c.stopLimiter)
+		if queued, _ := c.limiter.stats(); queued > 0 {
+			c.logger.Warn("Discarding rate-limited telemetry on shutdown", zap.Int("queued", queued))
+		}
+	})
+}
+
+// PublishLimits returns the telemetry publishes waiting on the rate limit
+// and the number dropped because the queue was full (both 0 when
+// nats.publish_limits is disabled)
+func (c *Client) PublishLimits() (queued int, dropped uint64) {
+	if c.limiter == nil {
+		return 0, 0
+	}
+	return c.limiter.stats()
+}
+
 // PublishTelemetrySync is a synchronous version for cases where you need to know
-// if the publish succeeded (e.g., during shutdown or critical operations)
-func (c *Client) PublishTelemetrySync(subject string, data []byte, timeout time.Duration) error {
-	pubAckFuture, err := c.js.PublishAsync(subject, data)
+// if the publish succeeded (e.g., during shutdown or critical operations).
+// It bypasses nats.publish_limits.
+func (c *Client) PublishTelemetrySync(subject, msgID string, data []byte, timeout time.Duration) error {
+	if c.recent != nil {
+		c.recent.add(subject, data)
+	}
+	pubAckFuture, err := c.js.PublishMsgAsync(c.newMsg(subject, data), msgIDOpts(msgID)...)
 	if err != nil {
 		return fmt.Errorf("failed to queue publish to %s: %w", subject, err)
 	}
@@ -247,20 +523,80 @@ func (c *Client) PublishTelemetrySync(subject string, data []byte, timeout time.
 		return nil
 
 	case err := <-pubAckFuture.Err():
+		signal(c.degraded)
 		c.logger.Error("Failed to publish telemetry (sync)",
 			zap.String("subject", subject),
 			zap.Error(err))
 		return fmt.Errorf("failed to publish to %s: %w", subject, err)
 
 	case <-time.After(timeout):
+		signal(c.degraded)
 		return fmt.Errorf("publish timeout after %v", timeout)
 	}
 }
 
+// KVGet returns the value and revision of a KV entry
+func (c *Client) KVGet(bucket, key string) ([]byte, uint64, error) {
+	kv, err := c.js.KeyValue(bucket)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to bind KV bucket %s: %w", bucket, err)
+	}
+	entry, err := kv.Get(key)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get %s from KV bucket %s: %w", key, bucket, err)
+	}
+	return entry.Value(), entry.Revision(), nil
+}
+
+// KeyValue binds an existing KV bucket
+func (c *Client) KeyValue(bucket string) (nats.KeyValue, error) {
+	kv, err := c.js.KeyValue(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind KV bucket %s: %w", bucket, err)
+	}
+	return kv, nil
+}
+
+// PutObject stores data in an existing Object Store bucket
+func (c *Client) PutObject(bucket, name string, data []byte) (*nats.ObjectInfo, error) {
+	store, err := c.js.ObjectStore(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind object store %s: %w", bucket, err)
+	}
+	info, err := store.PutBytes(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put %s in object store %s: %w", name, bucket, err)
+	}
+	return info, nil
+}
+
+// Degraded is signalled when connectivity looks degraded: after a reconnect
+// of the telemetry connection and when a publish fails. Signals that arrive
+// while one is pending are merged.
+func (c *Client) Degraded() <-chan struct{} {
+	return c.degraded
+}
+
+// signal sends to a buffered notification channel without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// msgIDOpts returns the publish option setting Nats-Msg-Id, if any
+func msgIDOpts(msgID string) []nats.PubOpt {
+	if msgID == "" {
+		return nil
+	}
+	return []nats.PubOpt{nats.MsgId(msgID)}
+}
+
 // Subscribe creates a subscription to the specified subject
 // This is used for command handlers with Core NATS request/reply
 func (c *Client) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
-	sub, err := c.conn.Subscribe(subject, handler)
+	sub, err := c.commandConn().Subscribe(subject, handler)
 	if err != nil {
 		c.logger.Error("Failed to subscribe",
 			zap.String("subject", subject),
@@ -268,18 +604,50 @@ func (c *Client) Subscribe(subject string, handler nats.MsgHandler) (*nats.Subsc
 		return nil, fmt.Errorf("failed to subscribe to %s: %w", subject, err)
 	}
 
+	if limits := c.config.PendingLimits; limits.Messages > 0 || limits.BytesMB > 0 {
+		msgLimit, bytesLimit := nats.DefaultSubPendingMsgsLimit, nats.DefaultSubPendingBytesLimit
+		if limits.Messages > 0 {
+			msgLimit = limits.Messages
+		}
+		if limits.BytesMB > 0 {
+			bytesLimit = limits.BytesMB * 1024 * 1024
+		}
+		if err := sub.SetPendingLimits(msgLimit, bytesLimit); err != nil {
+			sub.Unsubscribe()
+			return nil, fmt.Errorf("failed to set pending limits on %s: %w", subject, err)
+		}
+	}
+
 	c.logger.Info("Subscribed to subject", zap.String("subject", subject))
 	return sub, nil
 }
 
 // Drain gracefully closes the connection by draining all subscriptions
-// and waiting for in-flight messages to complete
+// and waiting for in-flight messages to complete. Async JetStream publishes
+// are awaited first, so the final telemetry batch is acked rather than lost
+// when the connection closes.
 // MODIFIED: Now accepts context for cancellation
 func (c *Client) Drain(ctx context.Context) error {
-	c.logger.Info("Draining NATS connection")
+	// Drain commands first so in-flight replies still go out. The telemetry
+	// connection is drained even if that fails, so it is never left open.
+	var cmdErr error
+	if c.cmdConn != nil {
+		cmdErr = c.drainConn(ctx, c.cmdConn)
+	}
+
+	c.stopLimited()
+	if !c.conn.IsClosed() {
+		c.waitPublishes(ctx)
+	}
+	return errors.Join(cmdErr, c.drainConn(ctx, c.conn))
+}
+
+// drainConn drains one connection, force-closing it if ctx is done first
+func (c *Client) drainConn(ctx context.Context, conn *nats.Conn) error {
+	c.logger.Info("Draining NATS connection", zap.String("name", conn.Opts.Name))
 
 	// Check if connection is already closed
-	if c.conn.IsClosed() {
+	if conn.IsClosed() {
 		c.logger.Info("Connection already closed")
 		return nil
 	}
@@ -289,7 +657,7 @@ func (c *Client) Drain(ctx context.Context) error {
 
 	// Start drain in goroutine
 	go func() {
-		drainDone <- c.conn.Drain()
+		drainDone <- conn.Drain()
 	}()
 
 	// Wait for drain to complete, timeout, or context cancellation
@@ -304,17 +672,68 @@ func (c *Client) Drain(ctx context.Context) error {
 
 	case <-ctx.Done():
 		c.logger.Warn("NATS drain cancelled by context, forcing close")
-		c.conn.Close()
+		conn.Close()
 		return fmt.Errorf("drain cancelled: %w", ctx.Err())
 	}
 }
 
+// waitPublishes blocks until all async JetStream publishes are acked or ctx
+// is done. Unacked publishes are logged, not retried.
+func (c *Client) waitPublishes(ctx context.Context) {
+	pending := c.js.PublishAsyncPending()
+	if pending == 0 {
+		return
+	}
+
+	c.logger.Info("Waiting for async publishes to complete", zap.Int("pending", pending))
+	select {
+	case <-c.js.PublishAsyncComplete():
+		c.logger.Info("Async publishes completed")
+	case <-ctx.Done():
+		c.logger.Warn("Async publishes not acked before shutdown",
+			zap.Int("pending", c.js.PublishAsyncPending()))
+	}
+}
+
 // Close immediately closes the NATS connection
 func (c *Client) Close() {
 	c.logger.Info("Closing NATS connection")
+	c.stopLimited()
+	if c.cmdConn != nil {
+		c.cmdConn.Close()
+	}
 	c.conn.Close()
 }
 
+// Reconnect drops the current server connection and reconnects, re-reading
+// the credentials file. Subscriptions are restored by the NATS client.
+func (c *Client) Reconnect() error {
+	c.logger.Info("Forcing NATS reconnect")
+	if c.cmdConn != nil {
+		if err := c.cmdConn.ForceReconnect(); err != nil {
+			return err
+		}
+	}
+	return c.conn.ForceReconnect()
+}
+
+// commandConn returns the connection command subscriptions use
+func (c *Client) commandConn() *nats.Conn {
+	if c.cmdConn != nil {
+		return c.cmdConn
+	}
+	return c.conn
+}
+
+// CommandStatus returns the state of the separate command connection, or
+// "" when commands share the telemetry connection
+func (c *Client) CommandStatus() string {
+	if c.cmdConn == nil {
+		return ""
+	}
+	return c.cmdConn.Status().String()
+}
+
 // IsConnected returns true if the NATS connection is currently active
 func (c *Client) IsConnected() bool {
 	return c.conn.IsConnected()
@@ -324,3 +743,39 @@ func (c *Client) IsConnected() bool {
 func (c *Client) Stats() nats.Statistics {
 	return c.conn.Stats()
 }
+
+// Status returns the connection state (CONNECTED, RECONNECTING, ...)
+func (c *Client) Status() string {
+	return c.conn.Status().String()
+}
+
+// ConnectionStats returns connection counters, the server URL and the round
+// trip time to the server. The RTT is measured with a PING bounded by a
+// short timeout, so a stalled connection can't hold up the caller.
+func (c *Client) ConnectionStats() *tasks.ConnectionStats {
+	stats := c.conn.Stats()
+	result := &tasks.ConnectionStats{
+		Reconnects: stats.Reconnects,
+		InMsgs:     stats.InMsgs,
+		OutMsgs:    stats.OutMsgs,
+		InBytes:    stats.InBytes,
+		OutBytes:   stats.OutBytes,
+	}
+	if !c.conn.IsConnected() {
+		return result
+	}
+
+	result.ServerURL = c.conn.ConnectedUrlRedacted()
+	start := time.Now()
+	if err := c.conn.FlushTimeout(2 * time.Second); err == nil {
+		result.RTTMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	return result
+}
+
+// Pending returns the bytes buffered for sending (non-zero while
+// disconnected) and the number of async JetStream publishes awaiting an ack
+func (c *Client) Pending() (bytes int, publishes int) {
+	bytes, _ = c.conn.Buffered()
+	return bytes, c.js.PublishAsyncPending()
+}
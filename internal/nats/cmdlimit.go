@@ -0,0 +1,193 @@
+package nats
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// rateLimitedCode is the HTTP-style code of a rate limited command reply
+const rateLimitedCode = 429
+
+// maxCommandWindows bounds the tracked requester windows; expired ones are
+// dropped once it is reached
+const maxCommandWindows = 4096
+
+// rateLimitedResponse is the reply to a command over its rate limit
+type rateLimitedResponse struct {
+	Status            string `json:"status"` // Always "error"
+	Code              int    `json:"code"`   // 429
+	Error             string `json:"error"`
+	Limit             string `json:"limit"`      // The matching commands.rate_limits entry
+	PerMinute         int    `json:"per_minute"` // Its limit per requester
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+	TS                string `json:"ts"`
+}
+
+// commandWindowKey is one requester's count for one limit
+type commandWindowKey struct {
+	limit     string
+	requester string
+}
+
+// commandWindow counts a requester's commands in the current minute
+type commandWindow struct {
+	start    time.Time
+	count    int
+	rejected int
+}
+
+// commandLimiter enforces commands.rate_limits: each requester may run the
+// commands matching a limit at most per_minute times a minute
+type commandLimiter struct {
+	mu      sync.Mutex
+	limits  []config.CommandRateLimit
+	windows map[commandWindowKey]*commandWindow
+}
+
+// newCommandLimiter returns nil when rate limits are disabled
+func newCommandLimiter(cfg config.RateLimitsConfig) *commandLimiter {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &commandLimiter{
+		limits:  cfg.Limits,
+		windows: make(map[commandWindowKey]*commandWindow),
+	}
+}
+
+// limitFor returns the limit of command: the exact name, else the longest
+// matching prefix, else *
+func (l *commandLimiter) limitFor(command string) (config.CommandRateLimit, bool) {
+	var best config.CommandRateLimit
+	found := false
+	for _, limit := range l.limits {
+		if limit.Command == command {
+			return limit, true
+		}
+		prefix, ok := strings.CutSuffix(limit.Command, "*")
+		if !ok || !strings.HasPrefix(command, prefix) {
+			continue
+		}
+		if !found || len(limit.Command) > len(best.Command) {
+			best, found = limit, true
+		}
+	}
+	return best, found
+}
+
+// admit counts a command run by requester. If it is over its limit, the
+// limit, the wait until the requester's minute resets and the number of
+// rejections in that minute so far are returned; rejected is 0 otherwise.
+func (l *commandLimiter) admit(now time.Time, command, requester string) (limit config.CommandRateLimit, retryAfter time.Duration, rejected int) {
+	limit, ok := l.limitFor(command)
+	if !ok || limit.PerMinute == 0 {
+		return limit, 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := commandWindowKey{limit: limit.Command, requester: requester}
+	w, ok := l.windows[key]
+	if !ok {
+		if len(l.windows) >= maxCommandWindows {
+			l.prune(now)
+		}
+		w = &commandWindow{start: now}
+		l.windows[key] = w
+	}
+	if now.Sub(w.start) >= time.Minute {
+		*w = commandWindow{start: now}
+	}
+	if w.count < limit.PerMinute {
+		w.count++
+		return limit, 0, 0
+	}
+	w.rejected++
+	return limit, w.start.Add(time.Minute).Sub(now), w.rejected
+}
+
+// prune drops the windows whose minute has passed. Must be called with
+// l.mu held.
+func (l *commandLimiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= time.Minute {
+			delete(l.windows, key)
+		}
+	}
+}
+
+// rateLimit applies commands.rate_limits to command. requester is the name
+// authorize resolved ("" without identity). An over-limit command gets a
+// 429 error reply and false is returned. The first rejection of a requester
+// in a minute is logged, so a runaway client doesn't flood the log.
+func (h *CommandHandlers) rateLimit(command string, msg *nats.Msg, requester string) bool {
+	if h.limiter == nil {
+		return true
+	}
+	requester = h.rateLimitKey(msg, requester)
+	limit, retryAfter, rejected := h.limiter.admit(time.Now(), command, requester)
+	if rejected == 0 {
+		return true
+	}
+
+	if rejected == 1 {
+		h.logger.Warn("Command rate limited",
+			zap.String("command", command),
+			zap.String("requester", requester),
+			zap.String("limit", limit.Command),
+			zap.Int("per_minute", limit.PerMinute))
+	}
+	reason := fmt.Sprintf("Rate limited: at most %d %s commands per minute", limit.PerMinute, limit.Command)
+	h.taskExecutor.RecordCommandError(errors.New(reason))
+
+	response := rateLimitedResponse{
+		Status:            "error",
+		Code:              rateLimitedCode,
+		Error:             reason,
+		Limit:             limit.Command,
+		PerMinute:         limit.PerMinute,
+		RetryAfterSeconds: int((retryAfter + time.Second - 1) / time.Second),
+		TS:                utils.NowRFC3339(),
+	}
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal rate limited response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return false
+	}
+	h.respond(msg, responseBytes)
+	return false
+}
+
+// rateLimitKey returns who a command is counted against: the authorized
+// requester, else the reply inbox without its per-request token (one per
+// client connection). Queued commands count against their stream consumer
+// and broadcast commands against the inbox of the broadcast request, as
+// their local copies have no reply subject.
+func (h *CommandHandlers) rateLimitKey(msg *nats.Msg, requester string) string {
+	if requester != "" {
+		return requester
+	}
+	if c, ok := h.captures.Load(msg); ok {
+		return c.(*capture).limitKey
+	}
+	return inboxKey(msg.Reply)
+}
+
+// inboxKey returns a reply subject without its per-request token
+func inboxKey(reply string) string {
+	if i := strings.LastIndexByte(reply, '.'); i > 0 {
+		return reply[:i]
+	}
+	return reply
+}
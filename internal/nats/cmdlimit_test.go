@@ -0,0 +1,35 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	h := &CommandHandlers{}
+	queued := &nats.Msg{Subject: "agents.dev-1.cmdq.exec"}
+	h.captures.Store(queued, &capture{queued: true, limitKey: "cmdq:AGENT_COMMANDS/dev-1"})
+	broadcast := &nats.Msg{Subject: "agents.broadcast.cmd.ping"}
+	h.captures.Store(broadcast, &capture{limitKey: inboxKey("_INBOX.abc.7")})
+
+	tests := []struct {
+		name      string
+		msg       *nats.Msg
+		requester string
+		want      string
+	}{
+		{name: "requester", msg: &nats.Msg{Reply: "_INBOX.abc.1"}, requester: "ops", want: "ops"},
+		{name: "inbox", msg: &nats.Msg{Reply: "_INBOX.abc.1"}, want: "_INBOX.abc"},
+		{name: "queued", msg: queued, want: "cmdq:AGENT_COMMANDS/dev-1"},
+		{name: "queued requester", msg: queued, requester: "ops", want: "ops"},
+		{name: "broadcast", msg: broadcast, want: "_INBOX.abc"},
+		{name: "no reply", msg: &nats.Msg{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := h.rateLimitKey(tt.msg, tt.requester); got != tt.want {
+			t.Errorf("%s: rateLimitKey() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Number of executed command IDs remembered for redelivery dedup
+const commandQueueSeen = 1024
+
+// CommandResult is published to {prefix}.{code}.telemetry.command_result for
+// every command taken from the durable queue
+type CommandResult struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	tasks.MessageMeta
+
+	ID       string          `json:"id"`      // Nats-Msg-Id header, or the stream sequence
+	Command  string          `json:"command"` // Subject suffix after cmdq., e.g. "service"
+	Status   string          `json:"status"`  // executed, expired, unknown_command
+	IssuedAt string          `json:"issued_at"`
+	Response json.RawMessage `json:"response,omitempty"` // The reply a Core NATS request would have received
+	TS       string          `json:"ts"`
+}
+
+// CommandQueue executes commands from a per-device durable JetStream
+// consumer on {prefix}.{code}.cmdq.>, so commands issued while the device is
+// offline run when it reconnects. Delivery is at-least-once: a command whose
+// ack is lost (e.g. the agent crashes mid-command) is redelivered after a
+// restart. Redeliveries within one run are skipped by message ID.
+type CommandQueue struct {
+	logger   *zap.Logger
+	config   *config.Config
+	client   *Client
+	handlers map[string]nats.MsgHandler
+	wrap     *CommandHandlers
+	sub      *nats.Subscription
+	prefix   string // "{prefix}.{code}.cmdq."
+	sequence atomic.Uint64
+
+	seen     map[string]struct{}
+	seenList []string // Insertion order, oldest first
+
+	done chan struct{}
+}
+
+// NewCommandQueue binds to (creating if needed) the device's durable
+// consumer on commands.queue.stream. Fails if the stream does not exist.
+func NewCommandQueue(logger *zap.Logger, cfg *config.Config, client *Client, handlers *CommandHandlers) (*CommandQueue, error) {
+	q := &CommandQueue{
+		logger:   logger,
+		config:   cfg,
+		client:   client,
+		handlers: make(map[string]nats.MsgHandler),
+		wrap:     handlers,
+		prefix:   fmt.Sprintf("%s.%s.cmdq.", cfg.SubjectPrefix, cfg.Code),
+		seen:     make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, cmd := range handlers.commands() {
+		q.handlers[cmd.name] = handlers.handleWithRecovery(cmd.name, cmd.handler)
+	}
+
+	sub, err := client.pullConsumer(
+		cfg.Commands.Queue.Stream,
+		"agent-"+cfg.Code,
+		q.prefix+">",
+		// A command may run for the full command timeout before it is acked
+		cfg.Commands.Timeout+30*time.Second,
+	)
+	if err != nil {
+		return nil, err
+	}
+	q.sub = sub
+
+	return q, nil
+}
+
+// Run fetches and executes queued commands one at a time until ctx is
+// cancelled
+func (q *CommandQueue) Run(ctx context.Context) {
+	q.logger.Info("Command queue started",
+		zap.String("stream", q.config.Commands.Queue.Stream),
+		zap.String("subject", q.prefix+">"))
+
+	go func() {
+		defer close(q.done)
+		for ctx.Err() == nil {
+			// Bounded wait so cancellation is noticed promptly
+			fetchCtx, fetchCancel := context.WithTimeout(ctx, 30*time.Second)
+			msgs, err := q.sub.Fetch(1, nats.Context(fetchCtx))
+			fetchCancel()
+			if err != nil {
+				if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, nats.ErrTimeout) || ctx.Err() != nil {
+					continue
+				}
+				if errors.Is(err, nats.ErrConnectionClosed) || errors.Is(err, nats.ErrBadSubscription) {
+					return
+				}
+				q.logger.Warn("Command queue fetch failed", zap.Error(err))
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+				continue
+			}
+			for _, msg := range msgs {
+				q.execute(msg)
+			}
+		}
+	}()
+}
+
+// Wait blocks until Run's loop exits (after its context is cancelled and the
+// in-flight command finishes) or timeout elapses
+func (q *CommandQueue) Wait(timeout time.Duration) {
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+		q.logger.Warn("Command queue did not stop in time")
+	}
+}
+
+// execute runs one queued command, publishes its result and acks it
+func (q *CommandQueue) execute(msg *nats.Msg) {
+	meta, err := msg.Metadata()
+	if err != nil {
+		q.logger.Warn("Dropping queued command without JetStream metadata", zap.Error(err))
+		msg.Term()
+		return
+	}
+
+	id := msg.Header.Get(nats.MsgIdHdr)
+	if id == "" {
+		id = strconv.FormatUint(meta.Sequence.Stream, 10)
+	}
+	if _, dup := q.seen[id]; dup {
+		q.logger.Debug("Skipping redelivered command", zap.String("id", id))
+		msg.Ack()
+		return
+	}
+
+	result := &CommandResult{
+		ID:       id,
+		Command:  strings.TrimPrefix(msg.Subject, q.prefix),
+		IssuedAt: meta.Timestamp.UTC().Format(time.RFC3339),
+	}
+
+	handler, ok := q.handlers[result.Command]
+	switch {
+	case !ok:
+		result.Status = "unknown_command"
+	case q.config.Commands.Queue.TTL > 0 && time.Since(meta.Timestamp) > q.config.Commands.Queue.TTL:
+		result.Status = "expired"
+	default:
+		result.Status = "executed"
+		result.Response = q.run(handler, msg, "cmdq:"+meta.Stream+"/"+meta.Consumer)
+	}
+
+	q.logger.Info("Queued command processed",
+		zap.String("id", id),
+		zap.String("command", result.Command),
+		zap.String("status", result.Status),
+		zap.Duration("age", time.Since(meta.Timestamp)))
+
+	q.publishResult(result)
+	q.remember(id)
+	if err := msg.Ack(); err != nil {
+		q.logger.Warn("Failed to ack queued command", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// run invokes a command handler on a copy of msg and returns its reply.
+// limitKey is who the command is rate limited as without a requester.
+func (q *CommandQueue) run(handler nats.MsgHandler, msg *nats.Msg, limitKey string) json.RawMessage {
+	// A copy without Reply, so nothing can reach the JetStream ack subject
+	local := &nats.Msg{Subject: msg.Subject, Header: msg.Header, Data: msg.Data}
+
+	var reply json.RawMessage
+	q.wrap.captures.Store(local, &capture{reply: func(data []byte) { reply = data }, queued: true, limitKey: limitKey})
+	defer q.wrap.captures.Delete(local)
+
+	handler(local)
+	return reply
+}
+
+// publishResult publishes a result and waits for the stream ack, so the
+// result is stored before the command is acked
+func (q *CommandQueue) publishResult(result *CommandResult) {
+	result.Code = q.config.Code
+	result.Location = q.config.Location
+	result.MessageMeta = tasks.MessageMeta{SchemaVersion: tasks.SchemaVersion, Sequence: q.sequence.Add(1)}
+	result.TS = utils.NowRFC3339()
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		q.logger.Error("Failed to marshal command result", zap.Error(err))
+		return
+	}
+
+	subject := fmt.Sprintf("%s.%s.telemetry.command_result", q.config.SubjectPrefix, q.config.Code)
+	msgID := result.MsgID(q.config.Code, "telemetry.command_result", result.TS)
+	if err := q.client.PublishTelemetrySync(subject, msgID, data, 10*time.Second); err != nil {
+		q.logger.Warn("Failed to publish command result", zap.String("id", result.ID), zap.Error(err))
+	}
+}
+
+// remember records an executed command ID, evicting the oldest beyond
+// commandQueueSeen
+func (q *CommandQueue) remember(id string) {
+	q.seen[id] = struct{}{}
+	q.seenList = append(q.seenList, id)
+	if len(q.seenList) > commandQueueSeen {
+		delete(q.seen, q.seenList[0])
+		q.seenList = q.seenList[1:]
+	}
+}
+
+// pullConsumer binds a pull subscription to a durable consumer on stream,
+// creating the consumer if it does not exist. Binding (rather than letting
+// the library create it) keeps the consumer when the subscription drains.
+func (c *Client) pullConsumer(stream, durable, subject string, ackWait time.Duration) (*nats.Subscription, error) {
+	js, err := c.commandConn().JetStream(jetStreamOptions(c.config)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	if _, err := js.ConsumerInfo(stream, durable); errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(stream, &nats.ConsumerConfig{
+			Durable:       durable,
+			FilterSubject: subject,
+			AckPolicy:     nats.AckExplicitPolicy,
+			AckWait:       ackWait,
+			MaxAckPending: 1, // Commands run in the order they were issued
+			DeliverPolicy: nats.DeliverAllPolicy,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create command consumer %s on stream %s: %w", durable, stream, err)
+		}
+		c.logger.Info("Created command consumer", zap.String("stream", stream), zap.String("durable", durable))
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up command consumer %s on stream %s: %w", durable, stream, err)
+	}
+
+	sub, err := js.PullSubscribe(subject, durable, nats.Bind(stream, durable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind command consumer %s: %w", durable, err)
+	}
+	return sub, nil
+}
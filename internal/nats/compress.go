@@ -0,0 +1,46 @@
+package nats
+
+import (
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/tasks"
+)
+
+// Compression headers (nats.compression). A requester sends
+// AcceptEncodingHeader: zstd to have large replies compressed; every
+// compressed message, reply or telemetry, carries EncodingHeader: zstd.
+const (
+	EncodingHeader       = "Agent-Encoding"
+	AcceptEncodingHeader = "Agent-Accept-Encoding"
+)
+
+// acceptsZstd reports whether compression is enabled and the requester of
+// msg accepts zstd. The header takes a comma-separated list, as HTTP's
+// Accept-Encoding does.
+func (h *CommandHandlers) acceptsZstd(msg *nats.Msg) bool {
+	if !h.config.NATS.Compression.Enabled {
+		return false
+	}
+	for _, value := range msg.Header.Values(AcceptEncodingHeader) {
+		for _, encoding := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(encoding), tasks.EncodingZstd) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// respondCompressed is respond for replies that can be large: a reply of
+// at least compression.min_bytes is sent zstd-compressed to a requester
+// that accepts it. Replies of queued and broadcast commands are embedded in
+// JSON results and are never compressed.
+func (h *CommandHandlers) respondCompressed(msg *nats.Msg, data []byte) {
+	if _, captured := h.captures.Load(msg); captured || msg.Reply == "" ||
+		len(data) < h.config.NATS.Compression.MinBytes || !h.acceptsZstd(msg) {
+		h.respond(msg, data)
+		return
+	}
+	h.reply(msg, tasks.CompressZstd(data), tasks.EncodingZstd)
+}
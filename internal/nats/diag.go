@@ -0,0 +1,105 @@
+package nats
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// diagBundleResponse references the uploaded bundle. Missing lists the
+// parts that couldn't be collected; the bundle's errors.txt has why.
+type diagBundleResponse struct {
+	Status  string   `json:"status"`
+	Bucket  string   `json:"bucket,omitempty"`
+	Object  string   `json:"object,omitempty"`
+	Size    uint64   `json:"size,omitempty"`
+	Digest  string   `json:"digest,omitempty"` // Object Store digest, SHA-256=<base64>
+	Files   []string `json:"files,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	TS      string   `json:"ts"`
+}
+
+// handleDiagBundle gathers recent logs, the redacted config, health and
+// task stats, and the last telemetry payloads into a .tar.gz (a .tar.zst
+// for requesters that accept zstd) and uploads it to the commands.diag
+// Object Store bucket
+func (h *CommandHandlers) handleDiagBundle(msg *nats.Msg) {
+	h.logger.Info("Collecting diagnostics bundle")
+
+	encoding := ""
+	if h.acceptsZstd(msg) {
+		encoding = tasks.EncodingZstd
+	}
+	response := diagBundleResponse{Status: "success", TS: utils.NowRFC3339()}
+	info, bundle, err := h.diagBundle(encoding)
+	if bundle != nil {
+		response.Files = bundle.Files()
+		response.Missing = bundle.Errors()
+	}
+	if err != nil {
+		h.logger.Error("Failed to collect diagnostics bundle", zap.Error(err))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		response.Bucket = info.Bucket
+		response.Object = info.Name
+		response.Size = info.Size
+		response.Digest = info.Digest
+		h.logger.Info("Uploaded diagnostics bundle",
+			zap.String("bucket", info.Bucket),
+			zap.String("object", info.Name),
+			zap.Uint64("size", info.Size))
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal diagnostics bundle response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// diagBundle collects and uploads the bundle, compressed with encoding
+// (see DiagBundle.Archive)
+func (h *CommandHandlers) diagBundle(encoding string) (*nats.ObjectInfo, *tasks.DiagBundle, error) {
+	c := &h.config.Commands.Diag
+	if !c.Enabled {
+		return nil, nil, fmt.Errorf("diagnostics bundles are disabled (commands.diag.enabled)")
+	}
+
+	bundle := tasks.NewDiagBundle()
+	bundle.AddJSON("version.json", h.build)
+	bundle.AddJSON("health.json", h.health())
+	bundle.AddJSON("config.json", config.Redacted(h.config))
+	if h.config.Logging.File != "" {
+		bundle.AddLogTail("agent.log", h.config.Logging.File, c.LogLines)
+	}
+	if c.TelemetryPayloads > 0 {
+		bundle.AddJSON("telemetry.json", h.natsClient.RecentTelemetry())
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	data, err := bundle.Archive(fmt.Sprintf("%s-%s", h.code, stamp), encoding)
+	if err != nil {
+		return nil, bundle, err
+	}
+	ext := ".tar.gz"
+	if encoding == tasks.EncodingZstd {
+		ext = ".tar.zst"
+	}
+	info, err := h.natsClient.PutObject(c.Bucket, fmt.Sprintf("%s/%s%s", h.code, stamp, ext), data)
+	if err != nil {
+		return nil, bundle, err
+	}
+	return info, bundle, nil
+}
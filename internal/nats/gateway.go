@@ -0,0 +1,65 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// subscribeChildren subscribes to {prefix}.{child}.cmd.> for every gateway
+// child. Every command is passed to the child's plugin, which decides what
+// it supports; the agent's own commands (exec, service, ...) are never
+// served on a child's subjects.
+func (h *CommandHandlers) subscribeChildren(client *Client) error {
+	for _, child := range h.config.Gateway.Children {
+		plugin, ok := h.childPlugin(child)
+		if !ok {
+			return fmt.Errorf("gateway child %s: plugin %s not found", child.Code, child.Plugin)
+		}
+		if _, err := client.Subscribe(
+			fmt.Sprintf("%s.%s.cmd.>", h.subjectPrefix, child.Code),
+			h.handleWithRecovery("gateway."+child.Code, h.childHandler(child, plugin)),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childHandler returns the handler for a child's commands
+func (h *CommandHandlers) childHandler(child config.ChildConfig, plugin config.PluginConfig) nats.MsgHandler {
+	prefix := fmt.Sprintf("%s.%s.cmd.", h.subjectPrefix, child.Code)
+	location := child.Location
+	if location == "" {
+		location = h.config.Location
+	}
+
+	return func(msg *nats.Msg) {
+		command := strings.TrimPrefix(msg.Subject, prefix)
+		h.logger.Debug("Received gateway child command",
+			zap.String("child", child.Code),
+			zap.String("command", command))
+
+		h.runPluginCommand(msg, plugin, &tasks.PluginRequest{
+			Mode:     "command",
+			Code:     child.Code,
+			Location: location,
+			Gateway:  h.code,
+			Command:  command,
+		})
+	}
+}
+
+// childPlugin returns the plugin serving a child
+func (h *CommandHandlers) childPlugin(child config.ChildConfig) (config.PluginConfig, bool) {
+	for _, plugin := range h.config.Plugins {
+		if plugin.Name == child.Plugin {
+			return plugin, true
+		}
+	}
+	return config.PluginConfig{}, false
+}
@@ -1,14 +1,19 @@
 package nats
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"runtime"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/election"
 	"github.com/stone-age-io/agent/internal/tasks"
 	"github.com/stone-age-io/agent/internal/utils"
 	"go.uber.org/zap"
@@ -20,25 +25,86 @@ type CommandHandlers struct {
 	config        *config.Config
 	code          string
 	subjectPrefix string
-	version       string
+	build         tasks.BuildInfo
 	taskExecutor  *tasks.Executor
 	natsClient    *Client
+	audit         *zap.Logger     // Command authorization decisions
+	limiter       *commandLimiter // commands.rate_limits, nil unless enabled
+
+	// rotateCredentials re-fetches bootstrapped credentials and reconnects.
+	// Nil when the agent was not bootstrapped (static creds/token/etc).
+	rotateCredentials func() (bool, error)
+
+	// schedulerHealth reports scheduler state for cmd.health. Set after the
+	// scheduler is created; nil until then.
+	schedulerHealth func() *SchedulerHealth
+
+	// publishEvent publishes a telemetry event. Set after the scheduler is
+	// created; nil until then.
+	publishEvent func(*tasks.Event)
+
+	// configureTask overrides a task's interval for a TTL (0 restores the
+	// configured schedule). Set after the scheduler is created; nil until then.
+	configureTask func(task string, interval, ttl time.Duration, requester string) (*TaskOverride, error)
+
+	// captures maps queued and broadcast command messages to the capture
+	// receiving their reply
+	captures sync.Map
+
+	// Broadcast replies waiting out their delay, stopped on shutdown
+	broadcastMu      sync.Mutex
+	broadcastTimers  map[*time.Timer]struct{}
+	broadcastStopped bool
+}
+
+// capture receives the reply of a command run outside Core NATS
+// request/reply
+type capture struct {
+	reply    func([]byte)
+	queued   bool   // From the durable command queue, so signatures may be old
+	limitKey string // Who the command is rate limited as without a requester (see rateLimitKey)
 }
 
 // NewCommandHandlers creates a new command handler manager
-func NewCommandHandlers(logger *zap.Logger, cfg *config.Config, executor *tasks.Executor, natsClient *Client, version string) *CommandHandlers {
+func NewCommandHandlers(logger *zap.Logger, cfg *config.Config, executor *tasks.Executor, natsClient *Client, build tasks.BuildInfo) *CommandHandlers {
 	return &CommandHandlers{
 		logger:        logger,
 		config:        cfg,
 		code:          cfg.Code,
 		subjectPrefix: cfg.SubjectPrefix,
-		version:       version,
+		build:         build,
 		taskExecutor:  executor,
 		natsClient:    natsClient,
+		audit:         logger.Named("audit"),
+		limiter:       newCommandLimiter(cfg.Commands.RateLimits),
+
+		broadcastTimers: make(map[*time.Timer]struct{}),
 	}
 }
 
-// handleWithRecovery wraps a command handler with panic recovery
+// SetCredentialRotator enables cmd.credentials.rotate. rotate returns true
+// if new credentials were written and NATS reconnected.
+func (h *CommandHandlers) SetCredentialRotator(rotate func() (bool, error)) {
+	h.rotateCredentials = rotate
+}
+
+// SetSchedulerHealth adds scheduler state to the cmd.health response
+func (h *CommandHandlers) SetSchedulerHealth(health func() *SchedulerHealth) {
+	h.schedulerHealth = health
+}
+
+// SetEventPublisher lets handlers publish telemetry events
+func (h *CommandHandlers) SetEventPublisher(publish func(*tasks.Event)) {
+	h.publishEvent = publish
+}
+
+// SetTaskConfigurer enables cmd.task.configure
+func (h *CommandHandlers) SetTaskConfigurer(configure func(task string, interval, ttl time.Duration, requester string) (*TaskOverride, error)) {
+	h.configureTask = configure
+}
+
+// handleWithRecovery wraps a command handler with panic recovery, command
+// authorization and rate limits
 // This prevents a panic in one command handler from crashing the entire agent
 func (h *CommandHandlers) handleWithRecovery(name string, handler nats.MsgHandler) nats.MsgHandler {
 	return func(msg *nats.Msg) {
@@ -60,61 +126,111 @@ func (h *CommandHandlers) handleWithRecovery(name string, handler nats.MsgHandle
 				responseBytes, err := json.Marshal(response)
 				if err != nil {
 					h.logger.Error("Failed to marshal panic response", zap.Error(err))
-					msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+					h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 					return
 				}
-				msg.Respond(responseBytes)
+				h.respond(msg, responseBytes)
 			}
 		}()
 
-		// Execute the actual handler
+		// Check the requester's role and rate limit, then execute the actual handler
+		requester, allowed := h.authorize(name, msg)
+		if !allowed || !h.rateLimit(name, msg, requester) {
+			return
+		}
 		handler(msg)
 	}
 }
 
+// command is a command subject suffix (after "cmd.") and its handler
+type command struct {
+	name    string
+	handler nats.MsgHandler
+}
+
+// commands lists every command the agent serves, over Core NATS request/reply
+// and (when enabled) the durable command queue
+func (h *CommandHandlers) commands() []command {
+	commands := []command{
+		{"ping", h.handlePing},
+		{"version", h.handleVersion},
+		{"config.get", h.handleConfigGet},
+		{"service", h.handleServiceControl},
+		{"logs", h.handleLogFetch},
+		{"exec", h.handleCustomExec},
+		{"scripts.list", h.handleScriptsList},
+		{"serial", h.handleSerial},
+		{"gpio", h.handleGPIO},
+		{"firewall", h.handleFirewall},
+		{"registry", h.handleRegistry},
+		{"scheduled_task", h.handleScheduledTask},
+		{"iis", h.handleIIS},
+		{"nettest", h.handleNetTest},
+		{"traceroute", h.handleTraceroute},
+		{"health", h.handleHealth},
+		{"selftest", h.handleSelfTest},
+		{"diag.bundle", h.handleDiagBundle},
+		{"task.pause", h.handleTaskPause},
+		{"task.resume", h.handleTaskResume},
+		{"task.configure", h.handleTaskConfigure},
+		{"credentials.rotate", h.handleCredentialsRotate},
+		{"metrics.reset", h.handleMetricsReset},
+	}
+	for _, plugin := range h.config.Plugins {
+		if plugin.Command {
+			commands = append(commands, command{"plugin." + plugin.Name, h.pluginHandler(plugin)})
+		}
+	}
+	return commands
+}
+
 // SubscribeAll subscribes to all command subjects for this device
 func (h *CommandHandlers) SubscribeAll(client *Client) error {
-	// Subscribe to ping command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.ping", h.subjectPrefix, h.code),
-		h.handleWithRecovery("ping", h.handlePing),
-	); err != nil {
-		return err
+	for _, cmd := range h.commands() {
+		// Each handler is wrapped with panic recovery
+		if _, err := client.Subscribe(
+			fmt.Sprintf("%s.%s.cmd.%s", h.subjectPrefix, h.code, cmd.name),
+			h.handleWithRecovery(cmd.name, cmd.handler),
+		); err != nil {
+			return err
+		}
 	}
 
-	// Subscribe to service control command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.service", h.subjectPrefix, h.code),
-		h.handleWithRecovery("service", h.handleServiceControl),
-	); err != nil {
+	if err := h.subscribeBroadcast(client); err != nil {
 		return err
 	}
+	return h.subscribeChildren(client)
+}
 
-	// Subscribe to log fetch command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.logs", h.subjectPrefix, h.code),
-		h.handleWithRecovery("logs", h.handleLogFetch),
-	); err != nil {
-		return err
-	}
+// queued reports whether msg came from the durable command queue
+func (h *CommandHandlers) queued(msg *nats.Msg) bool {
+	c, ok := h.captures.Load(msg)
+	return ok && c.(*capture).queued
+}
 
-	// Subscribe to custom exec command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.exec", h.subjectPrefix, h.code),
-		h.handleWithRecovery("exec", h.handleCustomExec),
-	); err != nil {
-		return err
+// respond sends a command reply: to the requester for Core NATS requests
+// (with the tag headers, and chunked if larger than the server's
+// max_payload), or to the capture of a queued or broadcast command
+func (h *CommandHandlers) respond(msg *nats.Msg, data []byte) {
+	if c, ok := h.captures.Load(msg); ok {
+		c.(*capture).reply(data)
+		return
 	}
-
-	// Subscribe to health check command with recovery
-	if _, err := client.Subscribe(
-		fmt.Sprintf("%s.%s.cmd.health", h.subjectPrefix, h.code),
-		h.handleWithRecovery("health", h.handleHealth),
-	); err != nil {
-		return err
+	if msg.Reply == "" {
+		return
 	}
+	h.reply(msg, data, "")
+}
 
-	return nil
+// reply publishes a reply to the requester, chunked if larger than the
+// server's max_payload. encoding names the compression of data for the
+// EncodingHeader ("" = none).
+func (h *CommandHandlers) reply(msg *nats.Msg, data []byte, encoding string) {
+	if size := h.natsClient.maxChunk(); size > 0 && len(data) > size {
+		h.respondChunked(msg, data, size, encoding)
+		return
+	}
+	h.natsClient.publishReply(h.natsClient.newEncodedMsg(msg.Reply, data, encoding))
 }
 
 // Response structures
@@ -124,23 +240,40 @@ type pingResponse struct {
 	TS     string `json:"ts"`
 }
 
+type versionResponse struct {
+	Status string `json:"status"`
+	tasks.BuildInfo
+	TS string `json:"ts"`
+}
+
+// configGetResponse is the running config with secrets redacted
+type configGetResponse struct {
+	Status      string         `json:"status"`
+	Fingerprint string         `json:"fingerprint"` // As in heartbeats and cmd.health
+	Config      *config.Config `json:"config"`
+	TS          string         `json:"ts"`
+}
+
 type serviceControlRequest struct {
-	Action      string `json:"action"`
-	ServiceName string `json:"service_name"`
+	Action       string `json:"action"`
+	ServiceName  string `json:"service_name"`
+	NoDependents bool   `json:"no_dependents,omitempty"` // Restart only this service, not its commands.service_dependencies dependents
 }
 
 type serviceControlResponse struct {
-	Status      string `json:"status"`
-	ServiceName string `json:"service_name,omitempty"`
-	Action      string `json:"action,omitempty"`
-	Result      string `json:"result,omitempty"`
-	Error       string `json:"error,omitempty"`
-	TS          string `json:"ts"`
+	Status      string              `json:"status"`
+	ServiceName string              `json:"service_name,omitempty"`
+	Action      string              `json:"action,omitempty"`
+	Result      string              `json:"result,omitempty"`
+	Steps       []tasks.ServiceStep `json:"steps,omitempty"` // Restart with dependents: each service in order
+	Error       string              `json:"error,omitempty"`
+	TS          string              `json:"ts"`
 }
 
 type logFetchRequest struct {
 	LogPath string `json:"log_path"`
 	Lines   int    `json:"lines"`
+	Cursor  string `json:"cursor,omitempty"` // next_cursor of the previous page
 }
 
 type logFetchResponse struct {
@@ -148,6 +281,9 @@ type logFetchResponse struct {
 	LogPath    string   `json:"log_path,omitempty"`
 	Lines      []string `json:"lines,omitempty"`
 	TotalLines int      `json:"total_lines,omitempty"`
+	NextCursor string   `json:"next_cursor,omitempty"` // Fetches the older lines; omitted at the start of the file
+	Truncated  bool     `json:"truncated,omitempty"`   // The page was cut in the middle at commands.max_output_bytes
+	Size       int64    `json:"size,omitempty"`        // Original page size in bytes, set when truncated
 	Error      string   `json:"error,omitempty"`
 	TS         string   `json:"ts"`
 }
@@ -157,23 +293,164 @@ type customExecRequest struct {
 }
 
 type customExecResponse struct {
-	Status   string          `json:"status"`
-	Command  string          `json:"command,omitempty"`
-	Output   json.RawMessage `json:"output,omitempty"`
-	ExitCode int             `json:"exit_code,omitempty"`
-	Error    string          `json:"error,omitempty"`
-	TS       string          `json:"ts"`
+	Status          string          `json:"status"`
+	Command         string          `json:"command,omitempty"`
+	Stdout          json.RawMessage `json:"stdout,omitempty"` // Included as parsed JSON when it is JSON
+	Stderr          string          `json:"stderr,omitempty"`
+	ExitCode        int             `json:"exit_code,omitempty"`
+	DurationSeconds float64         `json:"duration_seconds,omitempty"`
+	Truncated       bool            `json:"truncated,omitempty"`   // Stdout or stderr was cut in the middle at commands.max_output_bytes
+	StdoutSize      int64           `json:"stdout_size,omitempty"` // Original sizes, set when truncated
+	StderrSize      int64           `json:"stderr_size,omitempty"`
+	Error           string          `json:"error,omitempty"`
+	TS              string          `json:"ts"`
+}
+
+type scriptsListResponse struct {
+	Status   string             `json:"status"`
+	Manifest bool               `json:"manifest"` // The scripts directory has a manifest.yaml
+	Scripts  []tasks.ScriptInfo `json:"scripts,omitempty"`
+	Error    string             `json:"error,omitempty"`
+	TS       string             `json:"ts"`
+}
+
+type serialResponse struct {
+	Status string `json:"status"`
+	Port   string `json:"port,omitempty"`
+	*tasks.SerialResult
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts"`
+}
+
+type gpioResponse struct {
+	Status string         `json:"status"`
+	Action string         `json:"action,omitempty"`
+	Pin    string         `json:"pin,omitempty"`
+	Values map[string]int `json:"values,omitempty"` // Pin values after the action
+	Error  string         `json:"error,omitempty"`
+	TS     string         `json:"ts"`
+}
+
+type firewallResponse struct {
+	Status  string `json:"status"`
+	Action  string `json:"action,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	*tasks.FirewallStatus
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts"`
+}
+
+type registryResponse struct {
+	Status string `json:"status"`
+	Action string `json:"action,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Name   string `json:"name"`
+	*tasks.RegistryResult
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts"`
+}
+
+type scheduledTaskResponse struct {
+	Status  string                      `json:"status"`
+	Action  string                      `json:"action,omitempty"`
+	Task    string                      `json:"task,omitempty"`
+	Changed bool                        `json:"changed"`
+	Tasks   []tasks.ScheduledTaskStatus `json:"tasks,omitempty"`
+	Error   string                      `json:"error,omitempty"`
+	TS      string                      `json:"ts"`
+}
+
+type iisResponse struct {
+	Status  string            `json:"status"`
+	Action  string            `json:"action,omitempty"`
+	Type    string            `json:"type,omitempty"`
+	Name    string            `json:"name,omitempty"`
+	Changed bool              `json:"changed"`
+	Objects []tasks.IISStatus `json:"objects,omitempty"` // Every whitelisted app pool and site
+	Error   string            `json:"error,omitempty"`
+	TS      string            `json:"ts"`
+}
+
+type netTestResponse struct {
+	Status string `json:"status"`
+	Target string `json:"target,omitempty"`
+	*tasks.NetTestResult
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts"`
+}
+
+type tracerouteResponse struct {
+	Status string `json:"status"`
+	Target string `json:"target,omitempty"`
+	*tasks.TracerouteResult
+	Error string `json:"error,omitempty"`
+	TS    string `json:"ts"`
+}
+
+type taskControlRequest struct {
+	Task string `json:"task"`
+	TTL  string `json:"ttl,omitempty"` // Go duration (e.g. "30m"); pause only, empty = until resumed
+}
+
+type taskControlResponse struct {
+	Status      string `json:"status"`
+	Task        string `json:"task,omitempty"`
+	Action      string `json:"action,omitempty"`
+	Paused      bool   `json:"paused"`
+	PausedUntil string `json:"paused_until,omitempty"`
+	Error       string `json:"error,omitempty"`
+	TS          string `json:"ts"`
+}
+
+type taskConfigureRequest struct {
+	Task     string `json:"task"`
+	Interval string `json:"interval,omitempty"` // Go duration (e.g. "30s"); empty restores the configured schedule
+	TTL      string `json:"ttl,omitempty"`      // Go duration, required with interval (max 24h)
+}
+
+type taskConfigureResponse struct {
+	Status   string        `json:"status"`
+	Task     string        `json:"task,omitempty"`
+	Override *TaskOverride `json:"override,omitempty"` // Omitted once the configured schedule is restored
+	Error    string        `json:"error,omitempty"`
+	TS       string        `json:"ts"`
+}
+
+type credentialsRotateResponse struct {
+	Status  string `json:"status"`
+	Rotated bool   `json:"rotated"` // False when the provider returned the same credentials
+	Error   string `json:"error,omitempty"`
+	TS      string `json:"ts"`
+}
+
+type pluginResponse struct {
+	Status string          `json:"status"`
+	Plugin string          `json:"plugin,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	TS     string          `json:"ts"`
+}
+
+type metricsResetResponse struct {
+	Status           string `json:"status"`
+	Collector        string `json:"collector,omitempty"`
+	BaselineAt       string `json:"baseline_at,omitempty"`        // Next scrape, which records the new baseline
+	RatesAvailableAt string `json:"rates_available_at,omitempty"` // First scrape with valid CPU/disk I/O rates
+	Error            string `json:"error,omitempty"`
+	TS               string `json:"ts"`
 }
 
 // Enhanced health response structures
 type healthResponse struct {
-	Status string                   `json:"status"` // "healthy", "degraded", "unhealthy"
-	TS     string                   `json:"ts"`
-	Agent  *tasks.AgentMetrics      `json:"agent"`
-	NATS   *NATSHealth              `json:"nats"`
-	Tasks  *tasks.TaskHealthMetrics `json:"tasks"`
-	Config *ConfigInfo              `json:"config"`
-	OS     *tasks.OSInfo            `json:"os"` // Operating system information
+	Status    string                   `json:"status"` // "healthy", "degraded", "unhealthy"
+	TS        string                   `json:"ts"`
+	Agent     *tasks.AgentMetrics      `json:"agent"`
+	NATS      *NATSHealth              `json:"nats"`
+	Tasks     *tasks.TaskHealthMetrics `json:"tasks"`
+	Scheduler *SchedulerHealth         `json:"scheduler,omitempty"`
+	Config    *ConfigInfo              `json:"config"`
+	OS        *tasks.OSInfo            `json:"os"` // Operating system information
 }
 
 type NATSHealth struct {
@@ -185,14 +462,51 @@ type NATSHealth struct {
 	OutMsgs    uint64 `json:"out_msgs"`
 	InBytes    uint64 `json:"in_bytes"`
 	OutBytes   uint64 `json:"out_bytes"`
+
+	Status           string `json:"status"`            // CONNECTED, RECONNECTING, ...
+	PendingBytes     int    `json:"pending_bytes"`     // Buffered outbound bytes (grows while disconnected)
+	PendingPublishes int    `json:"pending_publishes"` // Async JetStream publishes awaiting an ack
+
+	CommandStatus string `json:"command_status,omitempty"` // Separate command connection state (nats.command_connection)
+
+	// Telemetry held back or dropped by nats.publish_limits
+	PublishQueued  int    `json:"publish_queued,omitempty"`
+	PublishDropped uint64 `json:"publish_dropped,omitempty"`
+}
+
+// SchedulerHealth reports scheduler state
+type SchedulerHealth struct {
+	Running  bool             `json:"running"`
+	Jobs     []JobHealth      `json:"jobs"`
+	Election *election.Status `json:"election,omitempty"` // Site leader election, if enabled
+	DiskLow  bool             `json:"disk_low,omitempty"` // Disk guard tripped: agent disk writes are stopped
+}
+
+// JobHealth reports a single scheduled job
+type JobHealth struct {
+	Name     string        `json:"name"`
+	InFlight bool          `json:"in_flight"` // Previous run still executing
+	LastRun  string        `json:"last_run,omitempty"`
+	NextRun  string        `json:"next_run,omitempty"`
+	Override *TaskOverride `json:"override,omitempty"` // Interval set with cmd.task.configure
+}
+
+// TaskOverride is a temporary task interval set with cmd.task.configure
+type TaskOverride struct {
+	Interval   string `json:"interval"`
+	Configured string `json:"configured"` // Interval or cron schedule restored when the override ends
+	Until      string `json:"until"`
+	Requester  string `json:"requester,omitempty"`
 }
 
 type ConfigInfo struct {
-	Code          string   `json:"code"`
-	Location      string   `json:"location"`
-	SubjectPrefix string   `json:"subject_prefix"`
-	Version       string   `json:"version"`
-	EnabledTasks  []string `json:"enabled_tasks"`
+	Code          string            `json:"code"`
+	Location      string            `json:"location"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	SubjectPrefix string            `json:"subject_prefix"`
+	Version       string            `json:"version"`
+	EnabledTasks  []string          `json:"enabled_tasks"`
+	Fingerprint   string            `json:"fingerprint"` // Identical across agents running the same config
 }
 
 type errorResponse struct {
@@ -213,14 +527,55 @@ func (h *CommandHandlers) handlePing(msg *nats.Msg) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		h.logger.Error("Failed to marshal ping response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
+	h.respond(msg, responseBytes)
 
 	h.logger.Debug("Sent pong response")
 }
 
+// handleVersion responds with the agent's build info
+func (h *CommandHandlers) handleVersion(msg *nats.Msg) {
+	h.logger.Debug("Received version command")
+
+	response := versionResponse{
+		Status:    "success",
+		BuildInfo: h.build,
+		TS:        utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal version response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// handleConfigGet responds with the effective config the agent is running,
+// after defaults and validation, with secrets redacted as in diagnostics
+// bundles
+func (h *CommandHandlers) handleConfigGet(msg *nats.Msg) {
+	h.logger.Debug("Received config get command")
+
+	response := configGetResponse{
+		Status:      "success",
+		Fingerprint: config.Fingerprint(h.config),
+		Config:      config.Redacted(h.config),
+		TS:          utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal config get response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
 // handleServiceControl processes service start/stop/restart commands
 func (h *CommandHandlers) handleServiceControl(msg *nats.Msg) {
 	h.logger.Debug("Received service control command")
@@ -238,8 +593,18 @@ func (h *CommandHandlers) handleServiceControl(msg *nats.Msg) {
 		zap.String("action", req.Action),
 		zap.String("service", req.ServiceName))
 
-	// Execute service control
-	result, err := h.taskExecutor.ControlService(req.ServiceName, req.Action, h.config.Commands.AllowedServices)
+	// Execute service control; a restart takes the service's dependents along
+	var result string
+	var steps []tasks.ServiceStep
+	var err error
+	deps := h.config.Commands.ServiceDependencies
+	dependents := tasks.ServiceDependents(req.ServiceName, deps.Services)
+	if req.Action == "restart" && !req.NoDependents && len(dependents) > 0 {
+		steps, err = h.taskExecutor.RestartServiceStack(req.ServiceName, deps, h.config.Commands.AllowedServices)
+		result = fmt.Sprintf("Service %s and %d dependents restarted successfully", req.ServiceName, len(dependents))
+	} else {
+		result, err = h.taskExecutor.ControlService(req.ServiceName, req.Action, h.config.Commands.AllowedServices)
+	}
 	if err != nil {
 		h.logger.Error("Service control failed",
 			zap.Error(err),
@@ -250,16 +615,17 @@ func (h *CommandHandlers) handleServiceControl(msg *nats.Msg) {
 
 		response := serviceControlResponse{
 			Status: "error",
+			Steps:  steps,
 			Error:  err.Error(),
 			TS:     utils.NowRFC3339(),
 		}
 		responseBytes, err := json.Marshal(response)
 		if err != nil {
 			h.logger.Error("Failed to marshal service control error response", zap.Error(err))
-			msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+			h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 			return
 		}
-		msg.Respond(responseBytes)
+		h.respond(msg, responseBytes)
 		return
 	}
 
@@ -271,16 +637,17 @@ func (h *CommandHandlers) handleServiceControl(msg *nats.Msg) {
 		ServiceName: req.ServiceName,
 		Action:      req.Action,
 		Result:      result,
+		Steps:       steps,
 		TS:          utils.NowRFC3339(),
 	}
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		h.logger.Error("Failed to marshal service control response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
+	h.respond(msg, responseBytes)
 
 	h.logger.Info("Service control succeeded",
 		zap.String("service", req.ServiceName),
@@ -302,10 +669,11 @@ func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
 
 	h.logger.Info("Fetching log file",
 		zap.String("path", req.LogPath),
-		zap.Int("lines", req.Lines))
+		zap.Int("lines", req.Lines),
+		zap.String("cursor", req.Cursor))
 
-	// Fetch log lines
-	lines, err := h.taskExecutor.FetchLogLines(req.LogPath, req.Lines, h.config.Commands.AllowedLogPaths)
+	// Fetch a page of log lines
+	page, err := h.taskExecutor.FetchLogPage(req.LogPath, req.Lines, req.Cursor, h.config.Commands.AllowedLogPaths, h.config.Commands.MaxOutputBytes)
 	if err != nil {
 		h.logger.Error("Log fetch failed",
 			zap.Error(err),
@@ -321,10 +689,10 @@ func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
 		responseBytes, err := json.Marshal(response)
 		if err != nil {
 			h.logger.Error("Failed to marshal log fetch error response", zap.Error(err))
-			msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+			h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 			return
 		}
-		msg.Respond(responseBytes)
+		h.respond(msg, responseBytes)
 		return
 	}
 
@@ -334,22 +702,25 @@ func (h *CommandHandlers) handleLogFetch(msg *nats.Msg) {
 	response := logFetchResponse{
 		Status:     "success",
 		LogPath:    req.LogPath,
-		Lines:      lines,
-		TotalLines: len(lines),
+		Lines:      page.Lines,
+		TotalLines: len(page.Lines),
+		NextCursor: page.NextCursor,
+		Truncated:  page.Truncated,
+		Size:       page.Size,
 		TS:         utils.NowRFC3339(),
 	}
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		h.logger.Error("Failed to marshal log fetch response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
+	h.respondCompressed(msg, responseBytes)
 
 	h.logger.Info("Log fetch succeeded",
 		zap.String("path", req.LogPath),
-		zap.Int("lines", len(lines)))
+		zap.Int("lines", len(page.Lines)))
 }
 
 // handleCustomExec executes whitelisted PowerShell commands or scripts
@@ -368,197 +739,1080 @@ func (h *CommandHandlers) handleCustomExec(msg *nats.Msg) {
 	h.logger.Info("Executing custom command", zap.String("command", req.Command))
 
 	// Execute command with configured timeout and scripts directory
-	output, exitCode, err := h.taskExecutor.ExecuteCommand(
+	result, err := h.taskExecutor.ExecuteCommand(
 		req.Command,
 		h.config.Commands.AllowedCommands,
 		h.config.Commands.ScriptsDirectory,
 		h.config.Commands.Timeout,
+		h.config.Commands.MaxOutputBytes,
 	)
+	response := customExecResponse{
+		Status:  "success",
+		Command: req.Command,
+		TS:      utils.NowRFC3339(),
+	}
+	if result != nil {
+		// A command that ran (even one that failed) returns its output
+		response.Stdout = h.execOutput(result.Stdout)
+		response.Stderr = result.Stderr
+		response.ExitCode = result.ExitCode
+		response.DurationSeconds = result.Duration.Seconds()
+		if result.Truncated {
+			response.Truncated = true
+			response.StdoutSize = result.StdoutSize
+			response.StderrSize = result.StderrSize
+		}
+	}
 	if err != nil {
 		h.logger.Error("Command execution failed",
 			zap.Error(err),
 			zap.String("command", req.Command))
 
 		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
 
-		response := customExecResponse{
-			Status: "error",
-			Error:  err.Error(),
-			TS:     utils.NowRFC3339(),
-		}
-		responseBytes, err := json.Marshal(response)
-		if err != nil {
-			h.logger.Error("Failed to marshal exec error response", zap.Error(err))
-			msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
-			return
-		}
-		msg.Respond(responseBytes)
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal exec response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
+	h.respond(msg, responseBytes)
 
-	h.taskExecutor.RecordCommandSuccess()
-
-	// Prepare output for response
-	// IMPROVED: Always try to parse as JSON first, regardless of first character
-	// This prevents false positives like "[ERROR] message" being treated as JSON
-	var outputData json.RawMessage
-	trimmedOutput := strings.TrimSpace(output)
+	if response.Status == "success" {
+		h.logger.Info("Command execution succeeded",
+			zap.String("command", req.Command),
+			zap.Int("exit_code", result.ExitCode))
+	}
+}
 
-	// Try to parse as JSON
+// execOutput prepares a command's stdout for the response: JSON output is
+// included as-is (a parsed object in the response), anything else as a
+// string. Parsing rather than checking the first character prevents false
+// positives like "[ERROR] message" being treated as JSON.
+func (h *CommandHandlers) execOutput(stdout string) json.RawMessage {
+	trimmed := strings.TrimSpace(stdout)
 	var testJSON interface{}
-	if len(trimmedOutput) > 0 && json.Unmarshal([]byte(trimmedOutput), &testJSON) == nil {
-		// Valid JSON - include as-is (will be parsed object in response)
-		outputData = json.RawMessage(trimmedOutput)
+	if len(trimmed) > 0 && json.Unmarshal([]byte(trimmed), &testJSON) == nil {
 		h.logger.Debug("Command output is valid JSON, including as parsed object")
-	} else {
-		// Not valid JSON (or empty) - encode as string
-		jsonStr, err := json.Marshal(output)
-		if err != nil {
-			h.logger.Error("Failed to marshal command output", zap.Error(err))
-			jsonStr = []byte(`"output marshal error"`)
-		}
-		outputData = json.RawMessage(jsonStr)
-		h.logger.Debug("Command output is plain text, encoding as JSON string")
+		return json.RawMessage(trimmed)
+	}
+	if stdout == "" {
+		return nil
 	}
 
-	// Success response
-	response := customExecResponse{
+	jsonStr, err := json.Marshal(stdout)
+	if err != nil {
+		h.logger.Error("Failed to marshal command output", zap.Error(err))
+		jsonStr = []byte(`"output marshal error"`)
+	}
+	h.logger.Debug("Command output is plain text, encoding as JSON string")
+	return json.RawMessage(jsonStr)
+}
+
+// handleScriptsList lists the scripts cmd.exec may run, with their manifest
+// entries and whether each file still matches its checksum
+func (h *CommandHandlers) handleScriptsList(msg *nats.Msg) {
+	h.logger.Debug("Received scripts list command")
+
+	scripts, manifest, err := h.taskExecutor.ListScripts(h.config.Commands.ScriptsDirectory)
+	response := scriptsListResponse{
 		Status:   "success",
-		Command:  req.Command,
-		Output:   outputData,
-		ExitCode: exitCode,
+		Manifest: manifest,
+		Scripts:  scripts,
 		TS:       utils.NowRFC3339(),
 	}
+	if err != nil {
+		h.logger.Error("Failed to list scripts", zap.Error(err))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Error("Failed to marshal exec response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.logger.Error("Failed to marshal scripts list response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
-
-	h.logger.Info("Command execution succeeded",
-		zap.String("command", req.Command),
-		zap.Int("exit_code", exitCode))
+	h.respond(msg, responseBytes)
 }
 
-// handleHealth returns enhanced agent health information
-func (h *CommandHandlers) handleHealth(msg *nats.Msg) {
-	h.logger.Debug("Received health check command")
-
-	// Get agent metrics
-	agentMetrics := h.taskExecutor.GetAgentMetrics()
-
-	// Get task metrics
-	taskMetrics := h.taskExecutor.GetTaskMetrics()
-
-	// Get NATS connection health
-	natsHealth := h.getNATSHealth()
-
-	// Get config info
-	configInfo := h.getConfigInfo()
+// handleSerial writes to a whitelisted serial port and returns the response
+func (h *CommandHandlers) handleSerial(msg *nats.Msg) {
+	h.logger.Debug("Received serial command")
 
-	// Get OS information
-	osInfo := h.getOSInfo()
+	var req tasks.SerialRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse serial request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
 
-	// Determine overall health status
-	status := h.determineHealthStatus(natsHealth, taskMetrics)
+	h.logger.Info("Serial exchange", zap.String("port", req.Port))
 
-	response := healthResponse{
-		Status: status,
-		TS:     utils.NowRFC3339(),
-		Agent:  agentMetrics,
-		NATS:   natsHealth,
-		Tasks:  taskMetrics,
-		Config: configInfo,
-		OS:     osInfo,
+	result, err := h.taskExecutor.SerialExchange(&req, h.config.Commands.SerialPorts, h.config.Commands.Timeout)
+	response := serialResponse{
+		Status:       "success",
+		Port:         req.Port,
+		SerialResult: result,
+		TS:           utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("Serial exchange failed",
+			zap.Error(err),
+			zap.String("port", req.Port))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
 	}
 
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Error("Failed to marshal health response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.logger.Error("Failed to marshal serial response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
+	h.respond(msg, responseBytes)
 
-	h.logger.Debug("Sent health response",
-		zap.String("status", status),
-		zap.Float64("memory_mb", agentMetrics.MemoryUsageMB),
-		zap.Int("goroutines", agentMetrics.Goroutines),
-		zap.String("platform", osInfo.Platform))
+	if result != nil {
+		h.logger.Info("Serial exchange succeeded",
+			zap.String("port", req.Port),
+			zap.Int("bytes", result.Bytes),
+			zap.Bool("timed_out", result.TimedOut))
+	}
 }
 
-// getNATSHealth collects NATS connection health information
-func (h *CommandHandlers) getNATSHealth() *NATSHealth {
-	stats := h.natsClient.Stats()
+// handleGPIO reads, sets or pulses a whitelisted GPIO pin
+func (h *CommandHandlers) handleGPIO(msg *nats.Msg) {
+	h.logger.Debug("Received gpio command")
 
-	health := &NATSHealth{
-		Connected:  h.natsClient.IsConnected(),
-		Reconnects: uint64(stats.Reconnects),
-		InMsgs:     stats.InMsgs,
-		OutMsgs:    stats.OutMsgs,
-		InBytes:    stats.InBytes,
-		OutBytes:   stats.OutBytes,
+	var req tasks.GPIORequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse gpio request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
 	}
 
-	// Add server info if connected
-	if health.Connected {
-		health.ServerURL = h.natsClient.conn.ConnectedUrl()
-		health.ServerID = h.natsClient.conn.ConnectedServerId()
+	h.logger.Info("GPIO command",
+		zap.String("action", req.Action),
+		zap.String("pin", req.Pin))
+
+	values, err := h.taskExecutor.GPIOCommand(&req, h.config.Commands.Timeout)
+	response := gpioResponse{
+		Status: "success",
+		Action: req.Action,
+		Pin:    req.Pin,
+		Values: values,
+		TS:     utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("GPIO command failed",
+			zap.Error(err),
+			zap.String("action", req.Action),
+			zap.String("pin", req.Pin))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
 	}
 
-	return health
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal gpio response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
 }
 
-// getConfigInfo returns configuration summary
-func (h *CommandHandlers) getConfigInfo() *ConfigInfo {
-	enabledTasks := []string{}
+// handleFirewall reads or changes whitelisted firewall profiles and rules.
+// Every change request is written to the audit log, and changes are
+// published as firewall_change events.
+func (h *CommandHandlers) handleFirewall(msg *nats.Msg) {
+	h.logger.Debug("Received firewall command")
 
-	if h.config.Tasks.Heartbeat.Enabled {
-		enabledTasks = append(enabledTasks, "heartbeat")
-	}
-	if h.config.Tasks.SystemMetrics.Enabled {
-		enabledTasks = append(enabledTasks, "system_metrics")
+	var req tasks.FirewallRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse firewall request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
 	}
-	if h.config.Tasks.ServiceCheck.Enabled {
-		enabledTasks = append(enabledTasks, "service_check")
+
+	h.logger.Info("Firewall command",
+		zap.String("action", req.Action),
+		zap.String("profile", req.Profile),
+		zap.String("rule", req.Rule))
+
+	status, err := h.taskExecutor.FirewallCommand(&req, &h.config.Commands.Firewall)
+	response := firewallResponse{
+		Status:         "success",
+		Action:         req.Action,
+		Profile:        req.Profile,
+		Rule:           req.Rule,
+		FirewallStatus: status,
+		TS:             utils.NowRFC3339(),
 	}
-	if h.config.Tasks.Inventory.Enabled {
-		enabledTasks = append(enabledTasks, "inventory")
+	if err != nil {
+		h.logger.Error("Firewall command failed",
+			zap.Error(err),
+			zap.String("action", req.Action))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
 	}
 
-	return &ConfigInfo{
-		Code:          h.code,
-		Location:      h.config.Location,
-		SubjectPrefix: h.subjectPrefix,
-		Version:       h.version,
-		EnabledTasks:  enabledTasks,
+	if req.Action != "status" {
+		h.auditFirewall(msg, &req, status, err)
 	}
-}
 
-// getOSInfo returns operating system information
-// This provides immediate platform detection without requiring JetStream queries
-func (h *CommandHandlers) getOSInfo() *tasks.OSInfo {
-	osInfo, err := tasks.GetOSInfo()
+	responseBytes, err := json.Marshal(response)
 	if err != nil {
-		h.logger.Warn("Failed to get OS info for health check", zap.Error(err))
-		// Return basic info with at least the platform
-		return &tasks.OSInfo{
-			Name:     "Unknown",
-			Version:  "Unknown",
-			Build:    "Unknown",
-			Platform: runtime.GOOS,
-		}
+		h.logger.Error("Failed to marshal firewall response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
 	}
-	return osInfo
+	h.respond(msg, responseBytes)
 }
 
-// determineHealthStatus calculates overall health status
-func (h *CommandHandlers) determineHealthStatus(natsHealth *NATSHealth, taskMetrics *tasks.TaskHealthMetrics) string {
-	// UNHEALTHY: NATS disconnected
-	if !natsHealth.Connected {
+// auditFirewall records a firewall change request in the audit log and, if
+// the firewall changed, publishes a firewall_change event
+func (h *CommandHandlers) auditFirewall(msg *nats.Msg, req *tasks.FirewallRequest, status *tasks.FirewallStatus, err error) {
+	requester := h.requesterOf(msg)
+	fields := []zap.Field{
+		zap.String("command", "firewall"),
+		zap.String("action", req.Action),
+		zap.String("profile", req.Profile),
+		zap.String("rule", req.Rule),
+		zap.String("requester", requester),
+	}
+	if err != nil {
+		h.audit.Warn("Firewall change failed", append(fields, zap.Error(err))...)
+		return
+	}
+	h.audit.Info("Firewall change", append(fields, zap.Bool("changed", status.Changed))...)
+
+	if !status.Changed || h.publishEvent == nil {
+		return
+	}
+	target := req.Rule
+	details := map[string]string{"action": req.Action, "rule": req.Rule}
+	if req.Profile != "" {
+		target = req.Profile + " profile"
+		details = map[string]string{"action": req.Action, "profile": req.Profile}
+	}
+	if requester != "" {
+		details["requester"] = requester
+	}
+	h.publishEvent(tasks.CreateEvent(tasks.EventFirewallChange, tasks.EventSeverityWarning,
+		fmt.Sprintf("Firewall %s: %s", req.Action, target), details))
+}
+
+// handleRegistry reads, sets or deletes values under whitelisted registry
+// keys. Every set and delete is written to the audit log, and changes are
+// published as registry_change events.
+func (h *CommandHandlers) handleRegistry(msg *nats.Msg) {
+	h.logger.Debug("Received registry command")
+
+	var req tasks.RegistryRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse registry request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	h.logger.Info("Registry command",
+		zap.String("action", req.Action),
+		zap.String("key", req.Key),
+		zap.String("name", req.Name))
+
+	result, err := h.taskExecutor.RegistryCommand(&req, &h.config.Commands.Registry)
+	response := registryResponse{
+		Status:         "success",
+		Action:         req.Action,
+		Key:            req.Key,
+		Name:           req.Name,
+		RegistryResult: result,
+		TS:             utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("Registry command failed",
+			zap.Error(err),
+			zap.String("action", req.Action),
+			zap.String("key", req.Key))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	if req.Action == "set" || req.Action == "delete" {
+		h.auditRegistry(msg, &req, result, err)
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal registry response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// auditRegistry records a registry change request in the audit log and, if
+// a value changed, publishes a registry_change event. Value data is kept
+// out of the event, which is broadcast as telemetry.
+func (h *CommandHandlers) auditRegistry(msg *nats.Msg, req *tasks.RegistryRequest, result *tasks.RegistryResult, err error) {
+	requester := h.requesterOf(msg)
+	fields := []zap.Field{
+		zap.String("command", "registry"),
+		zap.String("action", req.Action),
+		zap.String("key", req.Key),
+		zap.String("name", req.Name),
+		zap.String("type", req.Type),
+		zap.String("requester", requester),
+	}
+	if err != nil {
+		h.audit.Warn("Registry change failed", append(fields, zap.Error(err))...)
+		return
+	}
+	fields = append(fields, zap.Bool("changed", result.Changed))
+	if result.Previous != nil {
+		fields = append(fields, zap.Any("previous", result.Previous))
+	}
+	if result.Value != nil {
+		fields = append(fields, zap.Any("value", result.Value))
+	}
+	h.audit.Info("Registry change", fields...)
+
+	if !result.Changed || h.publishEvent == nil {
+		return
+	}
+	details := map[string]string{"action": req.Action, "key": req.Key, "name": req.Name}
+	if req.Type != "" {
+		details["type"] = req.Type
+	}
+	if requester != "" {
+		details["requester"] = requester
+	}
+	h.publishEvent(tasks.CreateEvent(tasks.EventRegistryChange, tasks.EventSeverityWarning,
+		fmt.Sprintf(`Registry %s: %s\%s`, req.Action, req.Key, req.Name), details))
+}
+
+// handleScheduledTask lists, enables, disables or runs whitelisted Windows
+// Scheduled Tasks
+func (h *CommandHandlers) handleScheduledTask(msg *nats.Msg) {
+	h.logger.Debug("Received scheduled task command")
+
+	var req tasks.ScheduledTaskRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse scheduled task request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	h.logger.Info("Scheduled task command",
+		zap.String("action", req.Action),
+		zap.String("task", req.Task))
+
+	statuses, changed, err := h.taskExecutor.ScheduledTaskCommand(&req, h.config.Commands.AllowedScheduledTasks)
+	response := scheduledTaskResponse{
+		Status:  "success",
+		Action:  req.Action,
+		Task:    req.Task,
+		Changed: changed,
+		Tasks:   statuses,
+		TS:      utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("Scheduled task command failed",
+			zap.Error(err),
+			zap.String("action", req.Action),
+			zap.String("task", req.Task))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal scheduled task response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// handleIIS queries, starts, stops or recycles whitelisted IIS app pools
+// and sites
+func (h *CommandHandlers) handleIIS(msg *nats.Msg) {
+	h.logger.Debug("Received IIS command")
+
+	var req tasks.IISRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse IIS request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	h.logger.Info("IIS command",
+		zap.String("action", req.Action),
+		zap.String("type", req.Type),
+		zap.String("name", req.Name))
+
+	statuses, changed, err := h.taskExecutor.IISCommand(&req, &h.config.Commands.IIS)
+	response := iisResponse{
+		Status:  "success",
+		Action:  req.Action,
+		Type:    req.Type,
+		Name:    req.Name,
+		Changed: changed,
+		Objects: statuses,
+		TS:      utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("IIS command failed",
+			zap.Error(err),
+			zap.String("action", req.Action),
+			zap.String("name", req.Name))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal IIS response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// handleNetTest runs a throughput test against a whitelisted iperf3 or
+// HTTPS target and publishes the result as a nettest event
+func (h *CommandHandlers) handleNetTest(msg *nats.Msg) {
+	h.logger.Debug("Received nettest command")
+
+	var req tasks.NetTestRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse nettest request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	h.logger.Info("Network test",
+		zap.String("target", req.Target),
+		zap.String("direction", req.Direction),
+		zap.String("duration", req.Duration))
+
+	result, err := h.taskExecutor.NetTest(&req, &h.config.Commands.NetTest, h.config.Commands.Timeout)
+	response := netTestResponse{
+		Status:        "success",
+		Target:        req.Target,
+		NetTestResult: result,
+		TS:            utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("Network test failed",
+			zap.Error(err),
+			zap.String("target", req.Target))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal nettest response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	if result == nil {
+		return
+	}
+	h.logger.Info("Network test succeeded",
+		zap.String("target", result.Target),
+		zap.String("direction", result.Direction),
+		zap.Float64("throughput_mbps", result.ThroughputMbps))
+	if h.publishEvent == nil {
+		return
+	}
+	details := map[string]string{
+		"target":           result.Target,
+		"type":             result.Type,
+		"direction":        result.Direction,
+		"requester":        h.requesterOf(msg),
+		"duration_seconds": strconv.FormatFloat(result.DurationSeconds, 'f', -1, 64),
+		"bytes":            strconv.FormatInt(result.Bytes, 10),
+		"throughput_mbps":  strconv.FormatFloat(result.ThroughputMbps, 'f', -1, 64),
+	}
+	for name, value := range map[string]*float64{
+		"connect_ms":    result.ConnectMs,
+		"tls_ms":        result.TLSMs,
+		"first_byte_ms": result.FirstByteMs,
+		"rtt_ms":        result.RTTMs,
+	} {
+		if value != nil {
+			details[name] = strconv.FormatFloat(*value, 'f', -1, 64)
+		}
+	}
+	if result.Retransmits != nil {
+		details["retransmits"] = strconv.FormatInt(*result.Retransmits, 10)
+	}
+	h.publishEvent(tasks.CreateEvent(tasks.EventNetTest, tasks.EventSeverityInfo,
+		fmt.Sprintf("Network test to %s (%s): %.2f Mbps", result.Target, result.Direction, result.ThroughputMbps), details))
+}
+
+// handleTraceroute traces the path to the NATS server or a whitelisted host
+func (h *CommandHandlers) handleTraceroute(msg *nats.Msg) {
+	h.logger.Debug("Received traceroute command")
+
+	var req tasks.TracerouteRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse traceroute request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	h.logger.Info("Traceroute",
+		zap.String("target", req.Target),
+		zap.String("mode", req.Mode))
+
+	var natsURL string
+	if h.natsClient.IsConnected() {
+		natsURL = h.natsClient.conn.ConnectedUrl()
+	}
+	result, err := h.taskExecutor.Traceroute(&req, &h.config.Commands.Traceroute, natsURL, h.config.Commands.Timeout)
+	response := tracerouteResponse{
+		Status:           "success",
+		Target:           req.Target,
+		TracerouteResult: result,
+		TS:               utils.NowRFC3339(),
+	}
+	if err != nil {
+		h.logger.Error("Traceroute failed",
+			zap.Error(err),
+			zap.String("target", req.Target))
+		h.taskExecutor.RecordCommandError(err)
+		response.Status = "error"
+		response.Error = err.Error()
+	} else {
+		h.logger.Info("Traceroute complete",
+			zap.String("target", req.Target),
+			zap.Int("hops", len(result.Hops)),
+			zap.Bool("reached", result.Reached),
+			zap.Bool("timed_out", result.TimedOut))
+		h.taskExecutor.RecordCommandSuccess()
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal traceroute response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// handleTaskPause pauses a scheduled task, optionally for a TTL
+func (h *CommandHandlers) handleTaskPause(msg *nats.Msg) {
+	h.logger.Debug("Received task pause command")
+
+	// Parse request
+	var req taskControlRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse task pause request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			h.logger.Error("Invalid task pause ttl", zap.Error(err), zap.String("ttl", req.TTL))
+			h.respondError(msg, fmt.Sprintf("Invalid ttl: %s", req.TTL))
+			h.taskExecutor.RecordCommandError(err)
+			return
+		}
+		ttl = parsed
+	}
+
+	until, err := h.taskExecutor.PauseTask(req.Task, ttl)
+	if err != nil {
+		h.logger.Error("Task pause failed", zap.Error(err), zap.String("task", req.Task))
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := taskControlResponse{
+		Status: "success",
+		Task:   req.Task,
+		Action: "pause",
+		Paused: true,
+		TS:     utils.NowRFC3339(),
+	}
+	if !until.IsZero() {
+		response.PausedUntil = until.UTC().Format(time.RFC3339)
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal task pause response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Task paused",
+		zap.String("task", req.Task),
+		zap.Duration("ttl", ttl))
+}
+
+// handleTaskResume resumes a paused scheduled task
+func (h *CommandHandlers) handleTaskResume(msg *nats.Msg) {
+	h.logger.Debug("Received task resume command")
+
+	// Parse request
+	var req taskControlRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse task resume request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	wasPaused, err := h.taskExecutor.ResumeTask(req.Task)
+	if err != nil {
+		h.logger.Error("Task resume failed", zap.Error(err), zap.String("task", req.Task))
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := taskControlResponse{
+		Status: "success",
+		Task:   req.Task,
+		Action: "resume",
+		Paused: false,
+		TS:     utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal task resume response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Task resumed",
+		zap.String("task", req.Task),
+		zap.Bool("was_paused", wasPaused))
+}
+
+// handleTaskConfigure temporarily changes a task's interval, e.g. metrics
+// every 30s during an incident; the configured schedule comes back after
+// the TTL. The scheduler audits every change and raises task_interval
+// events.
+func (h *CommandHandlers) handleTaskConfigure(msg *nats.Msg) {
+	h.logger.Debug("Received task configure command")
+
+	if h.configureTask == nil {
+		h.respondError(msg, "Task configuration not available")
+		return
+	}
+
+	// Parse request
+	var req taskConfigureRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		h.logger.Error("Failed to parse task configure request", zap.Error(err))
+		h.respondError(msg, "Invalid request format")
+		h.taskExecutor.RecordCommandError(err)
+		return
+	}
+
+	var interval, ttl time.Duration
+	for _, field := range []struct {
+		name  string
+		value string
+		dest  *time.Duration
+	}{
+		{"interval", req.Interval, &interval},
+		{"ttl", req.TTL, &ttl},
+	} {
+		if field.value == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(field.value)
+		if err != nil {
+			h.logger.Error("Invalid task configure "+field.name, zap.Error(err), zap.String(field.name, field.value))
+			h.respondError(msg, fmt.Sprintf("Invalid %s: %s", field.name, field.value))
+			h.taskExecutor.RecordCommandError(err)
+			return
+		}
+		*field.dest = parsed
+	}
+
+	override, err := h.configureTask(req.Task, interval, ttl, h.requesterOf(msg))
+	if err != nil {
+		h.logger.Error("Task configure failed", zap.Error(err), zap.String("task", req.Task))
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := taskConfigureResponse{
+		Status:   "success",
+		Task:     req.Task,
+		Override: override,
+		TS:       utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal task configure response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Task configured",
+		zap.String("task", req.Task),
+		zap.Duration("interval", interval),
+		zap.Duration("ttl", ttl))
+}
+
+// handleCredentialsRotate re-fetches credentials from the bootstrap provider
+// and reconnects NATS if they changed. The reply is buffered by the NATS
+// client across the reconnect, so the caller still gets an answer.
+func (h *CommandHandlers) handleCredentialsRotate(msg *nats.Msg) {
+	h.logger.Debug("Received credentials rotate command")
+
+	if h.rotateCredentials == nil {
+		h.respondError(msg, fmt.Sprintf("Credential rotation not available for auth type %s", h.config.NATS.Auth.Type))
+		return
+	}
+
+	rotated, err := h.rotateCredentials()
+	if err != nil {
+		h.logger.Error("Credential rotation failed", zap.Error(err))
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := credentialsRotateResponse{
+		Status:  "success",
+		Rotated: rotated,
+		TS:      utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal credentials rotate response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Credentials rotate command completed", zap.Bool("rotated", rotated))
+}
+
+// handleMetricsReset discards the metrics rate baseline so garbage deltas
+// (clock jumps, VM live-migration) are not reported, and tells the caller
+// when valid rates will be published again
+func (h *CommandHandlers) handleMetricsReset(msg *nats.Msg) {
+	h.logger.Debug("Received metrics reset command")
+
+	if !h.config.Tasks.SystemMetrics.Enabled {
+		err := fmt.Errorf("system metrics are disabled")
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	collector := h.taskExecutor.ResetMetricsBaseline()
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := metricsResetResponse{
+		Status:    "success",
+		Collector: collector,
+		TS:        utils.NowRFC3339(),
+	}
+	if next := h.nextMetricsRun(); !next.IsZero() {
+		response.BaselineAt = next.UTC().Format(time.RFC3339)
+		response.RatesAvailableAt = next.Add(h.config.Tasks.SystemMetrics.Interval).UTC().Format(time.RFC3339)
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal metrics reset response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Metrics rate baseline reset",
+		zap.String("collector", collector),
+		zap.String("rates_available_at", response.RatesAvailableAt))
+}
+
+// pluginHandler returns the cmd.plugin.<name> handler. The request body, if
+// any, must be JSON and is passed to the plugin as params.
+func (h *CommandHandlers) pluginHandler(plugin config.PluginConfig) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		h.logger.Debug("Received plugin command", zap.String("plugin", plugin.Name))
+
+		h.runPluginCommand(msg, plugin, &tasks.PluginRequest{
+			Mode:     "command",
+			Code:     h.code,
+			Location: h.config.Location,
+		})
+	}
+}
+
+// runPluginCommand runs plugin with the message body as params and replies
+// with its output
+func (h *CommandHandlers) runPluginCommand(msg *nats.Msg, plugin config.PluginConfig, req *tasks.PluginRequest) {
+	if len(strings.TrimSpace(string(msg.Data))) > 0 {
+		if !json.Valid(msg.Data) {
+			err := fmt.Errorf("request body must be JSON")
+			h.logger.Error("Invalid plugin command request", zap.String("plugin", plugin.Name))
+			h.respondError(msg, "Invalid request format")
+			h.taskExecutor.RecordCommandError(err)
+			return
+		}
+		req.Params = msg.Data
+	}
+
+	timeout := plugin.Timeout
+	if timeout == 0 {
+		timeout = h.config.Commands.Timeout
+	}
+
+	output, err := h.taskExecutor.RunPlugin(context.Background(), plugin.Path, plugin.Args, req, timeout)
+	if err != nil {
+		h.logger.Error("Plugin command failed", zap.String("plugin", plugin.Name), zap.String("code", req.Code), zap.Error(err))
+		h.taskExecutor.RecordCommandError(err)
+		h.respondError(msg, err.Error())
+		return
+	}
+
+	h.taskExecutor.RecordCommandSuccess()
+
+	response := pluginResponse{
+		Status: "success",
+		Plugin: plugin.Name,
+		Output: output,
+		TS:     utils.NowRFC3339(),
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal plugin response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Info("Plugin command completed", zap.String("plugin", plugin.Name), zap.String("code", req.Code))
+}
+
+// nextMetricsRun returns the next scheduled system metrics scrape, or the
+// zero time if the scheduler does not know it
+func (h *CommandHandlers) nextMetricsRun() time.Time {
+	if h.schedulerHealth == nil {
+		return time.Time{}
+	}
+	health := h.schedulerHealth()
+	if health == nil {
+		return time.Time{}
+	}
+	for _, job := range health.Jobs {
+		if job.Name != tasks.TaskSystemMetrics || job.NextRun == "" {
+			continue
+		}
+		next, err := time.Parse(time.RFC3339, job.NextRun)
+		if err != nil {
+			return time.Time{}
+		}
+		return next
+	}
+	return time.Time{}
+}
+
+// handleHealth returns enhanced agent health information
+func (h *CommandHandlers) handleHealth(msg *nats.Msg) {
+	h.logger.Debug("Received health check command")
+
+	response := h.health()
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal health response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+
+	h.logger.Debug("Sent health response",
+		zap.String("status", response.Status),
+		zap.Float64("memory_mb", response.Agent.MemoryUsageMB),
+		zap.Int("goroutines", response.Agent.Goroutines),
+		zap.String("platform", response.OS.Platform))
+}
+
+// HealthJSON returns the cmd.health response, for the local control channel
+func (h *CommandHandlers) HealthJSON() ([]byte, error) {
+	return json.Marshal(h.health())
+}
+
+// health collects the cmd.health response
+func (h *CommandHandlers) health() *healthResponse {
+	// Get agent metrics
+	agentMetrics := h.taskExecutor.GetAgentMetrics()
+
+	// Get task metrics
+	taskMetrics := h.taskExecutor.GetTaskMetrics()
+
+	// Get NATS connection health
+	natsHealth := h.getNATSHealth()
+
+	// Get scheduler state
+	var schedulerHealth *SchedulerHealth
+	if h.schedulerHealth != nil {
+		schedulerHealth = h.schedulerHealth()
+	}
+
+	// Get config info
+	configInfo := h.getConfigInfo(schedulerHealth)
+
+	// Get OS information
+	osInfo := h.getOSInfo()
+
+	// Determine overall health status
+	status := h.determineHealthStatus(natsHealth, taskMetrics, schedulerHealth)
+
+	return &healthResponse{
+		Status:    status,
+		TS:        utils.NowRFC3339(),
+		Agent:     agentMetrics,
+		NATS:      natsHealth,
+		Tasks:     taskMetrics,
+		Scheduler: schedulerHealth,
+		Config:    configInfo,
+		OS:        osInfo,
+	}
+}
+
+// getNATSHealth collects NATS connection health information
+func (h *CommandHandlers) getNATSHealth() *NATSHealth {
+	stats := h.natsClient.Stats()
+
+	health := &NATSHealth{
+		Connected:  h.natsClient.IsConnected(),
+		Reconnects: uint64(stats.Reconnects),
+		InMsgs:     stats.InMsgs,
+		OutMsgs:    stats.OutMsgs,
+		InBytes:    stats.InBytes,
+		OutBytes:   stats.OutBytes,
+		Status:     h.natsClient.Status(),
+	}
+	health.PendingBytes, health.PendingPublishes = h.natsClient.Pending()
+	health.CommandStatus = h.natsClient.CommandStatus()
+	health.PublishQueued, health.PublishDropped = h.natsClient.PublishLimits()
+
+	// Add server info if connected
+	if health.Connected {
+		health.ServerURL = h.natsClient.conn.ConnectedUrl()
+		health.ServerID = h.natsClient.conn.ConnectedServerId()
+	}
+
+	return health
+}
+
+// getConfigInfo returns configuration summary. The enabled tasks are the
+// jobs the scheduler registered (nil scheduler: none yet).
+func (h *CommandHandlers) getConfigInfo(scheduler *SchedulerHealth) *ConfigInfo {
+	enabledTasks := []string{}
+	if scheduler != nil {
+		for _, job := range scheduler.Jobs {
+			enabledTasks = append(enabledTasks, job.Name)
+		}
+	}
+
+	return &ConfigInfo{
+		Code:          h.code,
+		Location:      h.config.Location,
+		Tags:          h.config.Tags,
+		SubjectPrefix: h.subjectPrefix,
+		Version:       h.build.Version,
+		EnabledTasks:  enabledTasks,
+		Fingerprint:   config.Fingerprint(h.config),
+	}
+}
+
+// getOSInfo returns operating system information
+// This provides immediate platform detection without requiring JetStream queries
+func (h *CommandHandlers) getOSInfo() *tasks.OSInfo {
+	osInfo, err := tasks.GetOSInfo()
+	if err != nil {
+		h.logger.Warn("Failed to get OS info for health check", zap.Error(err))
+		// Return basic info with at least the platform
+		return &tasks.OSInfo{
+			Name:     "Unknown",
+			Version:  "Unknown",
+			Build:    "Unknown",
+			Platform: runtime.GOOS,
+		}
+	}
+	return osInfo
+}
+
+// determineHealthStatus calculates overall health status
+func (h *CommandHandlers) determineHealthStatus(natsHealth *NATSHealth, taskMetrics *tasks.TaskHealthMetrics, schedulerHealth *SchedulerHealth) string {
+	// UNHEALTHY: NATS disconnected
+	if !natsHealth.Connected {
 		return "unhealthy"
 	}
 
@@ -576,6 +1830,16 @@ func (h *CommandHandlers) determineHealthStatus(natsHealth *NATSHealth, taskMetr
 		}
 	}
 
+	// DEGRADED: Scheduler stopped (no telemetry will be published)
+	if schedulerHealth != nil && !schedulerHealth.Running {
+		return "degraded"
+	}
+
+	// DEGRADED: Disk nearly full (the agent's own log and state aren't written)
+	if schedulerHealth != nil && schedulerHealth.DiskLow {
+		return "degraded"
+	}
+
 	// HEALTHY: NATS connected and stable
 	return "healthy"
 }
@@ -590,8 +1854,8 @@ func (h *CommandHandlers) respondError(msg *nats.Msg, errorMsg string) {
 	responseBytes, err := json.Marshal(response)
 	if err != nil {
 		h.logger.Error("Failed to marshal error response", zap.Error(err))
-		msg.Respond([]byte(`{"status":"error","error":"internal marshal failure"}`))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
 		return
 	}
-	msg.Respond(responseBytes)
+	h.respond(msg, responseBytes)
 }
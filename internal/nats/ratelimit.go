@@ -0,0 +1,116 @@
+package nats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// queuedPublish is a telemetry publish held back by the rate limit
+type queuedPublish struct {
+	subject  string
+	msgID    string
+	data     []byte
+	encoding string // EncodingHeader value of compressed data, "" if none
+}
+
+// publishWindow counts publishes on one subject in the current minute
+type publishWindow struct {
+	start  time.Time
+	count  int
+	queued int // Publishes for this subject waiting in the queue
+}
+
+// publishLimiter enforces nats.publish_limits on telemetry: a per-subject
+// limit of max_per_minute publishes, with over-limit publishes held in a
+// bounded queue and released in order as each subject's minute resets. A
+// full queue drops the oldest or newest publish per drop_policy.
+type publishLimiter struct {
+	mu      sync.Mutex
+	cfg     config.PublishLimitsConfig
+	windows map[string]*publishWindow
+	queue   []queuedPublish
+	dropped uint64
+}
+
+// newPublishLimiter returns nil when publish limits are disabled
+func newPublishLimiter(cfg config.PublishLimitsConfig) *publishLimiter {
+	if cfg.MaxPerMinute <= 0 {
+		return nil
+	}
+	return &publishLimiter{
+		cfg:     cfg,
+		windows: make(map[string]*publishWindow),
+	}
+}
+
+// admit reports whether p may be published now. Otherwise p is queued (or
+// dropped if the queue is full) and false is returned.
+func (l *publishLimiter) admit(now time.Time, p queuedPublish) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w := l.window(now, p.subject)
+	// Earlier publishes for the subject go first, so order is kept
+	if w.queued == 0 && w.count < l.cfg.MaxPerMinute {
+		w.count++
+		return true
+	}
+
+	if len(l.queue) >= l.cfg.QueueSize {
+		l.dropped++
+		if l.cfg.DropPolicy == "newest" {
+			return false
+		}
+		l.windows[l.queue[0].subject].queued--
+		l.queue = l.queue[1:]
+	}
+	l.queue = append(l.queue, p)
+	w.queued++
+	return false
+}
+
+// release removes and returns the queued publishes whose subject has room
+// in its current minute, oldest first
+func (l *publishLimiter) release(now time.Time) []queuedPublish {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var ready []queuedPublish
+	kept := l.queue[:0]
+	for _, p := range l.queue {
+		w := l.window(now, p.subject)
+		if w.count < l.cfg.MaxPerMinute {
+			w.count++
+			w.queued--
+			ready = append(ready, p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	l.queue = kept
+	return ready
+}
+
+// stats returns the queued publish count and the publishes dropped so far
+func (l *publishLimiter) stats() (queued int, dropped uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue), l.dropped
+}
+
+// window returns the subject's window, starting a new minute if the
+// previous one has passed. Must be called with l.mu held.
+func (l *publishLimiter) window(now time.Time, subject string) *publishWindow {
+	w, ok := l.windows[subject]
+	if !ok {
+		w = &publishWindow{start: now}
+		l.windows[subject] = w
+	}
+	if now.Sub(w.start) >= time.Minute {
+		w.start = now
+		w.count = 0
+	}
+	return w
+}
@@ -0,0 +1,70 @@
+package nats
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// RecentPublish is a telemetry payload kept for diagnostics bundles
+type RecentPublish struct {
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+	TS      string          `json:"ts"` // When it was published
+}
+
+// recentTelemetry keeps the last telemetry payloads in a ring
+type recentTelemetry struct {
+	mu    sync.Mutex
+	items []RecentPublish
+	next  int
+	full  bool
+}
+
+// add records a payload, replacing the oldest once the ring is full.
+// Payloads that aren't JSON are kept as a JSON string.
+func (r *recentTelemetry) add(subject string, data []byte) {
+	raw := append(json.RawMessage(nil), data...)
+	if !json.Valid(data) {
+		raw, _ = json.Marshal(string(data))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items[r.next] = RecentPublish{Subject: subject, Data: raw, TS: utils.NowRFC3339()}
+	r.next = (r.next + 1) % len(r.items)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the kept payloads, oldest first
+func (r *recentTelemetry) list() []RecentPublish {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]RecentPublish(nil), r.items[:r.next]...)
+	}
+	return append(append([]RecentPublish(nil), r.items[r.next:]...), r.items[:r.next]...)
+}
+
+// KeepRecentTelemetry keeps the last n telemetry payloads published, for
+// diagnostics bundles (commands.diag.telemetry_payloads). Must be called
+// before publishing starts; n <= 0 keeps none.
+func (c *Client) KeepRecentTelemetry(n int) {
+	if n <= 0 {
+		c.recent = nil
+		return
+	}
+	c.recent = &recentTelemetry{items: make([]RecentPublish, n)}
+}
+
+// RecentTelemetry returns the telemetry payloads kept by
+// KeepRecentTelemetry, oldest first
+func (c *Client) RecentTelemetry() []RecentPublish {
+	if c.recent == nil {
+		return nil
+	}
+	return c.recent.list()
+}
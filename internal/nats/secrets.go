@@ -0,0 +1,80 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/secrets"
+)
+
+// secretOptions returns the secret store settings from the auth config
+func secretOptions(auth *config.AuthConfig) secrets.Options {
+	return secrets.Options{Store: auth.SecretStore, KeyFile: auth.SecretKeyFile}
+}
+
+// protectedCredsOption authenticates with a .creds file kept in a protected
+// secret store. Like nats.UserCredentials, the file is re-read on every
+// connect, so rotated credentials are picked up on reconnect.
+func protectedCredsOption(path string, opts secrets.Options) (nats.Option, error) {
+	// Fail fast on an unreadable file instead of on the first connect
+	if _, err := secrets.Read(path, opts); err != nil {
+		return nil, err
+	}
+
+	userJWT := func() (string, error) {
+		data, err := secrets.Read(path, opts)
+		if err != nil {
+			return "", err
+		}
+		return nkeys.ParseDecoratedJWT(data)
+	}
+	sign := func(nonce []byte) ([]byte, error) {
+		data, err := secrets.Read(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		kp, err := nkeys.ParseDecoratedUserNKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to extract key pair from %s: %w", path, err)
+		}
+		defer kp.Wipe()
+		return kp.Sign(nonce)
+	}
+
+	return nats.UserJWT(userJWT, sign), nil
+}
+
+// protectedNkeyOption authenticates with an nkey seed kept in a protected store
+func protectedNkeyOption(path string, opts secrets.Options) (nats.Option, error) {
+	loadKey := func() (nkeys.KeyPair, error) {
+		data, err := secrets.Read(path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return nkeys.FromSeed([]byte(strings.TrimSpace(string(data))))
+	}
+
+	kp, err := loadKey()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := kp.PublicKey()
+	kp.Wipe()
+	if err != nil {
+		return nil, err
+	}
+
+	sign := func(nonce []byte) ([]byte, error) {
+		kp, err := loadKey()
+		if err != nil {
+			return nil, err
+		}
+		defer kp.Wipe()
+		return kp.Sign(nonce)
+	}
+
+	return nats.Nkey(pub, sign), nil
+}
@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// selftestResponse is the cmd.selftest report. Passed is false if any
+// check failed; skipped checks don't count.
+type selftestResponse struct {
+	Status string                `json:"status"`
+	Passed bool                  `json:"passed"`
+	Checks []tasks.SelfTestCheck `json:"checks"`
+	TS     string                `json:"ts"`
+}
+
+// selftestMessage is published on {prefix}.{code}.telemetry.selftest to
+// check that JetStream accepts the agent's telemetry
+type selftestMessage struct {
+	Code string `json:"code"`
+	TS   string `json:"ts"`
+}
+
+// handleSelfTest exercises each subsystem in turn and reports pass/fail per
+// check, as a one-shot triage for first-line support
+func (h *CommandHandlers) handleSelfTest(msg *nats.Msg) {
+	h.logger.Info("Running self-test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.config.Commands.Timeout)
+	defer cancel()
+
+	checks := []tasks.SelfTestCheck{
+		tasks.RunCheck("collector", func() (string, error) { return h.taskExecutor.CheckCollector(ctx) }),
+		tasks.RunCheck("exporter", func() (string, error) { return h.taskExecutor.CheckExporter(ctx) }),
+		tasks.RunCheck("scripts_directory", func() (string, error) {
+			return h.taskExecutor.CheckScriptsDirectory(h.config.Commands.ScriptsDirectory)
+		}),
+		tasks.RunCheck("service_manager", h.taskExecutor.CheckServiceManager),
+		tasks.RunCheck("jetstream_publish", h.checkJetStreamPublish),
+		tasks.RunCheck("log_directory", func() (string, error) {
+			if h.config.Logging.File == "" {
+				return "", tasks.SkipCheck("no log file configured")
+			}
+			return tasks.CheckWritable(filepath.Dir(h.config.Logging.File))
+		}),
+		tasks.RunCheck("data_directory", func() (string, error) {
+			if config.StateInMemory(h.config) {
+				return "", tasks.SkipCheck("state kept in memory (immutable.state: memory)")
+			}
+			return tasks.CheckWritable(h.config.DataDir)
+		}),
+	}
+
+	response := selftestResponse{
+		Status: "success",
+		Passed: true,
+		Checks: checks,
+		TS:     utils.NowRFC3339(),
+	}
+	var failed []string
+	for _, check := range checks {
+		if check.Status == tasks.SelfTestFail {
+			response.Passed = false
+			failed = append(failed, check.Name)
+		}
+	}
+	h.logger.Info("Self-test complete", zap.Bool("passed", response.Passed), zap.Strings("failed", failed))
+	h.taskExecutor.RecordCommandSuccess()
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		h.logger.Error("Failed to marshal self-test response", zap.Error(err))
+		h.respond(msg, []byte(`{"status":"error","error":"internal marshal failure"}`))
+		return
+	}
+	h.respond(msg, responseBytes)
+}
+
+// checkJetStreamPublish publishes a selftest message and waits for the
+// stream's ack
+func (h *CommandHandlers) checkJetStreamPublish() (string, error) {
+	subject := fmt.Sprintf("%s.%s.telemetry.selftest", h.subjectPrefix, h.code)
+	data, err := json.Marshal(selftestMessage{Code: h.code, TS: utils.NowRFC3339()})
+	if err != nil {
+		return "", err
+	}
+	if err := h.natsClient.PublishTelemetrySync(subject, "", data, h.config.Commands.Timeout); err != nil {
+		return "", err
+	}
+	return subject, nil
+}
@@ -0,0 +1,184 @@
+package nats
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// tlsReloader keeps the client certificate and CA pool loaded from disk and
+// hands them to the NATS client through its TLS callbacks, which run on every
+// (re)connect. When renewal tooling (certbot, Venafi) rewrites the files, the
+// watcher reloads them and forces a reconnect so the new material is used.
+type tlsReloader struct {
+	cfg    *config.TLSConfig
+	logger *zap.Logger
+
+	mu    sync.RWMutex
+	cert  *tls.Certificate
+	pool  *x509.CertPool
+	stamp map[string]fileStamp // Last loaded modtime/size per file
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newTLSReloader loads the configured files once. Returns nil if there is
+// nothing to reload (no client certificate and no CA file).
+func newTLSReloader(cfg *config.TLSConfig, logger *zap.Logger) (*tlsReloader, error) {
+	if cfg.CertFile == "" && cfg.CAFile == "" {
+		return nil, nil
+	}
+
+	r := &tlsReloader{cfg: cfg, logger: logger}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files returns the configured TLS files
+func (r *tlsReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// stamps reads the current modtime/size of every configured file
+func (r *tlsReloader) stamps() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		stamps[f] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// load reads the certificate and CA pool from disk. On error the previously
+// loaded material is kept, so a half-written renewal never breaks reconnects.
+func (r *tlsReloader) load() error {
+	stamps, err := r.stamps()
+	if err != nil {
+		return fmt.Errorf("failed to stat TLS files: %w", err)
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" && r.cfg.KeyFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		caCert, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("failed to parse CA certificate")
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.stamp = stamps
+	r.mu.Unlock()
+
+	return nil
+}
+
+// changed reports whether any file differs from the last successful load
+func (r *tlsReloader) changed() bool {
+	stamps, err := r.stamps()
+	if err != nil {
+		// Mid-rotation (file briefly missing); try again next tick
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for f, s := range stamps {
+		if prev, ok := r.stamp[f]; !ok || !prev.modTime.Equal(s.modTime) || prev.size != s.size {
+			return true
+		}
+	}
+	return false
+}
+
+// certCallback returns the current client certificate (nil if not configured)
+func (r *tlsReloader) certCallback() func() (tls.Certificate, error) {
+	if r.cfg.CertFile == "" || r.cfg.KeyFile == "" {
+		return nil
+	}
+	return func() (tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return *r.cert, nil
+	}
+}
+
+// rootCAsCallback returns the current CA pool (nil if not configured)
+func (r *tlsReloader) rootCAsCallback() func() (*x509.CertPool, error) {
+	if r.cfg.CAFile == "" {
+		return nil
+	}
+	return func() (*x509.CertPool, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.pool, nil
+	}
+}
+
+// watch polls the TLS files every interval until ctx is cancelled and calls
+// reconnect after a successful reload
+func (r *tlsReloader) watch(ctx context.Context, interval time.Duration, reconnect func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				// Renewal tools often write cert and key separately; a
+				// mismatched pair is retried on the next tick
+				r.logger.Warn("TLS files changed but could not be loaded, keeping current certificates",
+					zap.Error(err))
+				continue
+			}
+
+			r.logger.Info("TLS certificates reloaded, reconnecting NATS",
+				zap.Strings("files", r.files()))
+			if err := reconnect(); err != nil {
+				r.logger.Error("Failed to reconnect after TLS reload", zap.Error(err))
+			}
+		}
+	}
+}
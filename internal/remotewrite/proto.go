@@ -0,0 +1,55 @@
+package remotewrite
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers of the remote_write 1.0 messages (prometheus/prompb):
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+const (
+	fieldTimeSeries = 1
+
+	fieldLabels  = 1
+	fieldSamples = 2
+
+	fieldLabelName  = 1
+	fieldLabelValue = 2
+
+	fieldSampleValue     = 1
+	fieldSampleTimestamp = 2
+)
+
+// encodeWriteRequest encodes series as a WriteRequest
+func encodeWriteRequest(series []Series) []byte {
+	var b, ts, msg []byte
+	for _, s := range series {
+		ts = ts[:0]
+		for _, label := range s.Labels {
+			msg = msg[:0]
+			msg = protowire.AppendTag(msg, fieldLabelName, protowire.BytesType)
+			msg = protowire.AppendString(msg, label.Name)
+			msg = protowire.AppendTag(msg, fieldLabelValue, protowire.BytesType)
+			msg = protowire.AppendString(msg, label.Value)
+			ts = protowire.AppendTag(ts, fieldLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, msg)
+		}
+
+		msg = msg[:0]
+		msg = protowire.AppendTag(msg, fieldSampleValue, protowire.Fixed64Type)
+		msg = protowire.AppendFixed64(msg, math.Float64bits(s.Value))
+		msg = protowire.AppendTag(msg, fieldSampleTimestamp, protowire.VarintType)
+		msg = protowire.AppendVarint(msg, uint64(s.Timestamp))
+		ts = protowire.AppendTag(ts, fieldSamples, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, msg)
+
+		b = protowire.AppendTag(b, fieldTimeSeries, protowire.BytesType)
+		b = protowire.AppendBytes(b, ts)
+	}
+	return b
+}
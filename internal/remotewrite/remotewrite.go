@@ -0,0 +1,203 @@
+// Package remotewrite pushes system metrics to a Prometheus remote_write
+// endpoint (Prometheus, Mimir, Thanos, VictoriaMetrics), so metric-heavy
+// deployments can store them in a TSDB without a NATS consumer in between.
+// It speaks remote_write 1.0: a snappy-compressed protobuf WriteRequest.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+)
+
+// maxErrorBody bounds how much of a rejected push's response is reported
+const maxErrorBody = 512
+
+// Label is a series label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Series is one time series with a single sample
+type Series struct {
+	Labels    []Label // Sorted by name, __name__ included
+	Value     float64
+	Timestamp int64 // Unix milliseconds
+}
+
+// Client pushes scrapes to the remote_write endpoint
+type Client struct {
+	cfg        config.RemoteWriteConfig
+	labels     []Label // Added to every series: code, location and the configured labels
+	httpClient *http.Client
+}
+
+// New creates a client for cfg. Series are labelled with code, location
+// (if set) and cfg.Labels.
+func New(cfg config.RemoteWriteConfig, code, location string) (*Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", cfg.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	labels := []Label{{Name: "code", Value: code}}
+	if location != "" {
+		labels = append(labels, Label{Name: "location", Value: location})
+	}
+	for name, value := range cfg.Labels {
+		labels = append(labels, Label{Name: name, Value: value})
+	}
+
+	return &Client{
+		cfg:        cfg,
+		labels:     labels,
+		httpClient: &http.Client{Timeout: cfg.Timeout, Transport: transport},
+	}, nil
+}
+
+// Series converts a scrape to time series, stamped with the scrape's ts.
+// Exporter families are included with extra_families.
+func (c *Client) Series(metrics *tasks.SystemMetrics) []Series {
+	ts := time.Now()
+	if parsed, err := time.Parse(time.RFC3339, metrics.TS); err == nil {
+		ts = parsed
+	}
+	b := seriesBuilder{common: c.labels, timestamp: ts.UnixMilli()}
+
+	b.add("agent_cpu_usage_percent", metrics.CPUUsagePercent)
+	b.add("agent_memory_free_gb", metrics.MemoryFreeGB)
+	for _, disk := range metrics.Disks {
+		drive := Label{Name: "drive", Value: disk.Drive}
+		b.add("agent_disk_free_percent", disk.FreePercent, drive)
+		b.add("agent_disk_free_gb", disk.FreeGB, drive)
+		b.add("agent_disk_total_gb", disk.TotalGB, drive)
+		b.add("agent_disk_read_bytes_per_sec", disk.ReadBytesPerSec, drive)
+		b.add("agent_disk_write_bytes_per_sec", disk.WriteBytesPerSec, drive)
+		if disk.FullInHours > 0 {
+			b.add("agent_disk_full_in_hours", disk.FullInHours, drive)
+		}
+		if disk.Inodes != nil {
+			b.add("agent_disk_inodes_free_percent", disk.Inodes.FreePercent, drive)
+			b.add("agent_disk_inodes_total", float64(disk.Inodes.Total), drive)
+		}
+	}
+	if metrics.OpenFDs > 0 {
+		b.add("agent_open_fds", float64(metrics.OpenFDs))
+	}
+	if metrics.MaxFDs > 0 {
+		b.add("agent_max_fds", float64(metrics.MaxFDs))
+	}
+	if metrics.Handles > 0 {
+		b.add("agent_handles", float64(metrics.Handles))
+	}
+	if stats := metrics.CPUStats; stats != nil {
+		b.add("agent_cpu_usage_avg_percent", stats.AvgPercent)
+		b.add("agent_cpu_usage_max_percent", stats.MaxPercent)
+		b.add("agent_cpu_usage_p95_percent", stats.P95Percent)
+	}
+
+	if c.cfg.ExtraFamilies {
+		families := make([]string, 0, len(metrics.Extra))
+		for family := range metrics.Extra {
+			families = append(families, family)
+		}
+		sort.Strings(families)
+		for _, family := range families {
+			for _, sample := range metrics.Extra[family] {
+				labels := make([]Label, 0, len(sample.Labels))
+				for name, value := range sample.Labels {
+					labels = append(labels, Label{Name: name, Value: value})
+				}
+				b.add(family, sample.Value, labels...)
+			}
+		}
+	}
+	return b.series
+}
+
+// seriesBuilder collects series sharing the agent's labels and a timestamp
+type seriesBuilder struct {
+	common    []Label
+	timestamp int64
+	series    []Series
+}
+
+// add appends a series. Labels that clash with the agent's are kept as
+// exported_<name>, as Prometheus does for scraped targets.
+func (b *seriesBuilder) add(name string, value float64, labels ...Label) {
+	all := make([]Label, 0, len(b.common)+len(labels)+1)
+	all = append(all, Label{Name: "__name__", Value: name})
+	all = append(all, b.common...)
+	for _, label := range labels {
+		for _, common := range b.common {
+			if label.Name == common.Name {
+				label.Name = "exported_" + label.Name
+				break
+			}
+		}
+		all = append(all, label)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Name < all[j].Name })
+	b.series = append(b.series, Series{Labels: all, Value: value, Timestamp: b.timestamp})
+}
+
+// Push sends series to the endpoint
+func (c *Client) Push(ctx context.Context, series []Series) error {
+	body := snappy.Encode(nil, encodeWriteRequest(series))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create remote_write request: %w", err)
+	}
+	for name, value := range c.cfg.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "stone-age-agent")
+	switch {
+	case c.cfg.BearerTokenEnv != "":
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(c.cfg.BearerTokenEnv))
+	case c.cfg.Username != "":
+		password := ""
+		if c.cfg.PasswordEnv != "" {
+			password = os.Getenv(c.cfg.PasswordEnv)
+		}
+		req.SetBasicAuth(c.cfg.Username, password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("remote_write request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("remote_write rejected with %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
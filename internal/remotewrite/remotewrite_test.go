@@ -0,0 +1,180 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest is the inverse of encodeWriteRequest, for checking
+// what the endpoint receives
+func decodeWriteRequest(t *testing.T, b []byte) []Series {
+	t.Helper()
+	var series []Series
+	for len(b) > 0 {
+		ts := consumeMessage(t, &b, fieldTimeSeries)
+		var s Series
+		for len(ts) > 0 {
+			num, typ, n := protowire.ConsumeTag(ts)
+			if n < 0 || typ != protowire.BytesType {
+				t.Fatalf("invalid TimeSeries field")
+			}
+			msg, m := protowire.ConsumeBytes(ts[n:])
+			if m < 0 {
+				t.Fatalf("invalid TimeSeries field %d", num)
+			}
+			ts = ts[n+m:]
+			switch num {
+			case fieldLabels:
+				name := consumeMessage(t, &msg, fieldLabelName)
+				value := consumeMessage(t, &msg, fieldLabelValue)
+				s.Labels = append(s.Labels, Label{Name: string(name), Value: string(value)})
+			case fieldSamples:
+				_, _, n := protowire.ConsumeTag(msg)
+				bits, m := protowire.ConsumeFixed64(msg[n:])
+				msg = msg[n+m:]
+				_, _, n = protowire.ConsumeTag(msg)
+				timestamp, _ := protowire.ConsumeVarint(msg[n:])
+				s.Value = math.Float64frombits(bits)
+				s.Timestamp = int64(timestamp)
+			}
+		}
+		series = append(series, s)
+	}
+	return series
+}
+
+func consumeMessage(t *testing.T, b *[]byte, field protowire.Number) []byte {
+	t.Helper()
+	num, typ, n := protowire.ConsumeTag(*b)
+	if n < 0 || num != field || typ != protowire.BytesType {
+		t.Fatalf("want field %d, got %d (type %d)", field, num, typ)
+	}
+	msg, m := protowire.ConsumeBytes((*b)[n:])
+	if m < 0 {
+		t.Fatalf("invalid field %d", field)
+	}
+	*b = (*b)[n+m:]
+	return msg
+}
+
+// TestPush tests the request an endpoint receives: headers, auth and the
+// decoded series
+func TestPush(t *testing.T) {
+	t.Setenv("RW_TENANT", "team-a")
+	t.Setenv("RW_PASSWORD", "hunter2")
+
+	var got []Series
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("body is not snappy: %v", err)
+		}
+		got = decodeWriteRequest(t, data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client, err := New(config.RemoteWriteConfig{
+		URL:         server.URL,
+		Timeout:     5 * time.Second,
+		Username:    "agent",
+		PasswordEnv: "RW_PASSWORD",
+		Headers:     map[string]string{"X-Scope-OrgID": "${RW_TENANT}"},
+		Labels:      map[string]string{"env": "prod"},
+	}, "device-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := &tasks.SystemMetrics{
+		CPUUsagePercent: 12.5,
+		MemoryFreeGB:    3.25,
+		Disks:           []tasks.DiskMetrics{{Drive: "/", FreePercent: 40, FreeGB: 20, TotalGB: 50}},
+		TS:              "2024-01-01T00:00:00Z",
+	}
+	series := client.Series(metrics)
+	if err := client.Push(context.Background(), series); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, series) {
+		t.Errorf("endpoint received %+v, want %+v", got, series)
+	}
+	if header.Get("Content-Encoding") != "snappy" || header.Get("X-Prometheus-Remote-Write-Version") != "0.1.0" {
+		t.Errorf("missing remote_write headers: %v", header)
+	}
+	if header.Get("X-Scope-OrgID") != "team-a" {
+		t.Errorf("X-Scope-OrgID = %q, want the expanded env var", header.Get("X-Scope-OrgID"))
+	}
+	if user, password, ok := (&http.Request{Header: header}).BasicAuth(); !ok || user != "agent" || password != "hunter2" {
+		t.Errorf("basic auth = %q, %q, %v", user, password, ok)
+	}
+
+	want := []Label{{"__name__", "agent_cpu_usage_percent"}, {"code", "device-1"}, {"env", "prod"}}
+	if !reflect.DeepEqual(series[0].Labels, want) || series[0].Value != 12.5 || series[0].Timestamp != 1704067200000 {
+		t.Errorf("first series = %+v, want %v = 12.5 at 1704067200000", series[0], want)
+	}
+}
+
+// TestPushRejected tests that the endpoint's error makes it into the error
+func TestPushRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	client, err := New(config.RemoteWriteConfig{URL: server.URL, Timeout: 5 * time.Second}, "device-1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Push(context.Background(), client.Series(&tasks.SystemMetrics{}))
+	if err == nil || !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "out of order sample") {
+		t.Errorf("Push() error = %v, want the status and body", err)
+	}
+}
+
+// TestSeriesExtraFamilies tests that exporter families are included on
+// request and their labels can't override the agent's
+func TestSeriesExtraFamilies(t *testing.T) {
+	metrics := &tasks.SystemMetrics{
+		Extra: map[string][]tasks.ExtraSample{
+			"node_hwmon_temp_celsius": {{Labels: map[string]string{"chip": "cpu", "code": "other"}, Value: 51}},
+		},
+	}
+
+	client, _ := New(config.RemoteWriteConfig{}, "device-1", "hq")
+	for _, s := range client.Series(metrics) {
+		if s.Labels[0].Value == "node_hwmon_temp_celsius" {
+			t.Errorf("extra family pushed without extra_families: %+v", s)
+		}
+	}
+
+	client, _ = New(config.RemoteWriteConfig{ExtraFamilies: true}, "device-1", "hq")
+	series := client.Series(metrics)
+	last := series[len(series)-1]
+	want := []Label{
+		{"__name__", "node_hwmon_temp_celsius"},
+		{"chip", "cpu"},
+		{"code", "device-1"},
+		{"exported_code", "other"},
+		{"location", "hq"},
+	}
+	if !reflect.DeepEqual(last.Labels, want) || last.Value != 51 {
+		t.Errorf("extra series = %+v, want %v = 51", last, want)
+	}
+}
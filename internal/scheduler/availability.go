@@ -0,0 +1,50 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// availabilityFile keeps the service up/down history in the data dir
+const availabilityFile = "service_availability.json"
+
+// initAvailability restores the service up/down history, so availability
+// survives restarts
+func (s *Scheduler) initAvailability() {
+	c := s.config.Tasks.ServiceCheck
+	if !c.Enabled || !c.Availability {
+		return
+	}
+
+	s.availability = tasks.NewAvailabilityTracker(c.Interval)
+	if err := s.availability.Load(s.availabilityPath()); err != nil {
+		s.logger.Warn("Failed to restore service availability, starting a new history", zap.Error(err))
+	}
+}
+
+func (s *Scheduler) availabilityPath() string {
+	return filepath.Join(s.config.DataDir, availabilityFile)
+}
+
+// trackAvailability records the check in the up/down history and sets
+// each service's rolling availability
+func (s *Scheduler) trackAvailability(statuses []tasks.ServiceStatus) {
+	if s.availability == nil {
+		return
+	}
+
+	now := time.Now()
+	s.availability.Record(now, statuses)
+	for i := range statuses {
+		statuses[i].Availability = s.availability.Availability(statuses[i].Name, now)
+	}
+
+	if s.saveState() {
+		if err := s.availability.Save(s.availabilityPath()); err != nil {
+			s.logger.Warn("Failed to save service availability", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/bacnet"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// bacnetDiscoveryTask is the task name (and subject token) of the BACnet
+// device list
+const bacnetDiscoveryTask = tasks.BACnetTaskPrefix + "devices"
+
+// initBACnet creates the BACnet client and registers the in-flight flags
+// and sequences of discovery and every device poll
+func (s *Scheduler) initBACnet() {
+	if !s.config.BACnet.Enabled {
+		return
+	}
+	s.bacnet = bacnet.NewClient(s.config.BACnet, s.logger)
+	if s.config.BACnet.DiscoveryInterval > 0 {
+		s.running[bacnetDiscoveryTask] = &atomic.Bool{}
+		s.sequences["telemetry."+bacnetDiscoveryTask] = &atomic.Uint64{}
+	}
+	for _, device := range s.config.BACnet.Devices {
+		s.running[tasks.BACnetTaskPrefix+device.Name] = &atomic.Bool{}
+		s.sequences["telemetry."+tasks.BACnetTaskPrefix+device.Name] = &atomic.Uint64{}
+	}
+}
+
+// scheduleBACnet schedules discovery and the poll of every BACnet device
+// WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+func (s *Scheduler) scheduleBACnet() error {
+	if s.bacnet == nil {
+		return nil
+	}
+	code := s.config.Code
+
+	if interval := s.config.BACnet.DiscoveryInterval; interval > 0 {
+		timeout := s.config.BACnet.DiscoveryTimeout + s.config.BACnet.Timeout
+		s.executor.RegisterPluginTask(bacnetDiscoveryTask)
+		definition, options := s.jobSchedule(bacnetDiscoveryTask, interval)
+		_, err := s.scheduler.NewJob(
+			definition,
+			gocron.NewTask(s.guardTask(bacnetDiscoveryTask, timeout, func(ctx context.Context) {
+				s.publishBACnetDevices(ctx, code)
+			})),
+			options...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule bacnet discovery: %w", err)
+		}
+		s.logger.Info("Scheduled bacnet discovery",
+			zap.Duration("interval", interval),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+	}
+
+	for i := range s.config.BACnet.Devices {
+		device := &s.config.BACnet.Devices[i]
+		task := tasks.BACnetTaskPrefix + device.Name
+
+		s.executor.RegisterPluginTask(task)
+		definition, options := s.jobSchedule(task, device.Interval)
+		_, err := s.scheduler.NewJob(
+			definition,
+			gocron.NewTask(s.guardTask(task, device.Interval, func(ctx context.Context) {
+				s.publishBACnet(ctx, code, device)
+			})),
+			options...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule bacnet device %s: %w", device.Name, err)
+		}
+		s.logger.Info("Scheduled bacnet poll",
+			zap.String("device", device.Name),
+			zap.Int("instance", device.Instance),
+			zap.Int("points", len(device.Points)),
+			zap.Duration("interval", device.Interval),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+	}
+	return nil
+}
+
+// publishBACnetDevices discovers BACnet devices and publishes the list.
+// ctx carries the task timeout.
+func (s *Scheduler) publishBACnetDevices(ctx context.Context, code string) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(bacnetDiscoveryTask) {
+		return
+	}
+
+	suffix := "telemetry." + bacnetDiscoveryTask
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	devices, err := s.bacnet.Discover(ctx)
+	if err != nil {
+		s.logger.Error("BACnet discovery failed", zap.Error(err))
+
+		// Publish error message so control plane knows the discovery failed
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal bacnet error message", zap.Error(marshalErr))
+			return
+		}
+
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue bacnet error publish", zap.Error(err))
+		}
+		return
+	}
+
+	list := &bacnet.DeviceList{
+		Code:        code,
+		Location:    s.config.Location,
+		MessageMeta: s.nextMeta(suffix),
+		Devices:     devices,
+		TS:          utils.NowRFC3339(),
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		s.logger.Error("Failed to marshal bacnet device list", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, list.MsgID(code, suffix, list.TS), data); err != nil {
+		s.logger.Error("Failed to queue bacnet device list publish", zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued bacnet device list publish",
+		zap.String("subject", subject),
+		zap.Int("devices", len(devices)))
+}
+
+// publishBACnet polls a BACnet device and publishes its point values. ctx
+// carries the task timeout.
+func (s *Scheduler) publishBACnet(ctx context.Context, code string, device *config.BACnetDeviceConfig) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.BACnetTaskPrefix + device.Name) {
+		return
+	}
+
+	suffix := "telemetry." + tasks.BACnetTaskPrefix + device.Name
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	reading, err := s.bacnet.Poll(ctx, device)
+	if err != nil {
+		s.logger.Error("BACnet poll failed", zap.String("device", device.Name), zap.Error(err))
+
+		// Publish error message so control plane knows the poll failed
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal bacnet error message", zap.Error(marshalErr))
+			return
+		}
+
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue bacnet error publish", zap.Error(err))
+		}
+		return
+	}
+
+	if len(reading.Errors) > 0 {
+		s.logger.Warn("Some bacnet points could not be read",
+			zap.String("device", device.Name),
+			zap.Int("failed", len(reading.Errors)))
+	}
+
+	reading.Code = code
+	reading.Location = s.config.Location
+	reading.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(reading)
+	if err != nil {
+		s.logger.Error("Failed to marshal bacnet reading", zap.String("device", device.Name), zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, reading.MsgID(code, suffix, reading.TS), data); err != nil {
+		s.logger.Error("Failed to queue bacnet publish", zap.String("device", device.Name), zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued bacnet publish",
+		zap.String("device", device.Name),
+		zap.String("subject", subject),
+		zap.Int("values", len(reading.Values)))
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleCompliance schedules the compliance baseline check WITH PANIC
+// RECOVERY, OVERRUN GUARD AND CONTEXT CHECK. Like inventory, it also runs
+// once shortly after startup.
+func (s *Scheduler) scheduleCompliance() error {
+	if !s.config.Compliance.Enabled {
+		return nil
+	}
+	code := s.config.Code
+	interval := s.config.Compliance.Interval
+	timeout := taskTimeout(s.config.Compliance.Timeout, interval)
+
+	startupCheck := s.guardTask(tasks.TaskCompliance, timeout, func(ctx context.Context) {
+		s.publishCompliance(ctx, code)
+	})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(randomDelay(s.config.Tasks.Splay)):
+		}
+		startupCheck()
+	}()
+
+	s.executor.RegisterPluginTask(tasks.TaskCompliance)
+	definition, options := s.jobSchedule(tasks.TaskCompliance, interval)
+	_, err := s.scheduler.NewJob(
+		definition,
+		gocron.NewTask(s.guardTask(tasks.TaskCompliance, timeout, func(ctx context.Context) {
+			s.publishCompliance(ctx, code)
+		})),
+		options...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule compliance check: %w", err)
+	}
+	s.logger.Info("Scheduled compliance check",
+		zap.String("baseline", s.complianceBaseline()),
+		zap.Duration("interval", interval),
+		zap.Duration("timeout", timeout),
+		zap.Duration("jitter", s.config.Tasks.Jitter))
+	return nil
+}
+
+// complianceBaseline names where the baseline comes from
+func (s *Scheduler) complianceBaseline() string {
+	if c := s.config.Compliance; c.KVBucket != "" {
+		return fmt.Sprintf("kv:%s/%s", c.KVBucket, c.KVKey)
+	}
+	return "config"
+}
+
+// publishCompliance loads the baseline, evaluates it and publishes the
+// results. A KV baseline that can't be fetched or parsed is published as a
+// telemetry error rather than falling back to a stale or empty baseline.
+func (s *Scheduler) publishCompliance(ctx context.Context, code string) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskCompliance) {
+		return
+	}
+
+	suffix := "telemetry." + tasks.TaskCompliance
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	rules, revision, err := s.loadComplianceRules()
+	if err != nil {
+		s.logger.Error("Failed to load compliance baseline", zap.String("baseline", s.complianceBaseline()), zap.Error(err))
+
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal compliance error message", zap.Error(marshalErr))
+			return
+		}
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue compliance error publish", zap.Error(err))
+		}
+		return
+	}
+
+	msg := s.executor.CheckCompliance(ctx, rules)
+	msg.Code = code
+	msg.Location = s.config.Location
+	msg.MessageMeta = s.nextMeta(suffix)
+	msg.Baseline = s.complianceBaseline()
+	msg.Revision = revision
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal compliance message", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, msg.MsgID(code, suffix, msg.TS), data); err != nil {
+		s.logger.Error("Failed to queue compliance publish", zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued compliance publish",
+		zap.String("subject", subject),
+		zap.Int("passed", msg.Summary.Passed),
+		zap.Int("failed", msg.Summary.Failed),
+		zap.Int("errors", msg.Summary.Errors),
+		zap.Int("skipped", msg.Summary.Skipped))
+}
+
+// loadComplianceRules returns the configured rules, or fetches the baseline
+// and its revision from KV
+func (s *Scheduler) loadComplianceRules() ([]config.ComplianceRule, uint64, error) {
+	c := s.config.Compliance
+	if c.KVBucket == "" {
+		return c.Rules, 0, nil
+	}
+	data, revision, err := s.nats.KVGet(c.KVBucket, c.KVKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	rules, err := tasks.ParseComplianceBaseline(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rules, revision, nil
+}
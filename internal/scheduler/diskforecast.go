@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// diskForecastFile keeps the free space samples in the data dir
+const diskForecastFile = "disk_forecast.json"
+
+// initDiskForecast restores the free space history, so a restart doesn't
+// wait out a whole window before predicting again
+func (s *Scheduler) initDiskForecast() {
+	c := s.config.Tasks.SystemMetrics.DiskForecast
+	if !s.config.Tasks.SystemMetrics.Enabled || !c.Enabled {
+		return
+	}
+
+	s.diskForecast = tasks.NewDiskForecast(c.Window, c.MinSamples)
+	s.fillAlerts = make(map[string]bool)
+	if err := s.diskForecast.Load(s.diskForecastPath()); err != nil {
+		s.logger.Warn("Failed to restore disk forecast, starting a new trend", zap.Error(err))
+	}
+}
+
+func (s *Scheduler) diskForecastPath() string {
+	return filepath.Join(s.config.DataDir, diskForecastFile)
+}
+
+// forecastDisks adds the scrape to the free space history, sets each
+// drive's full_in_hours and raises a disk_full_predicted event when a
+// drive is projected to fill within the horizon. The alert clears once the
+// projection is past 1.5x the horizon, so it doesn't flap around it.
+func (s *Scheduler) forecastDisks(metrics *tasks.SystemMetrics) {
+	if s.diskForecast == nil {
+		return
+	}
+
+	if s.diskForecast.Add(time.Now(), metrics.Disks) && s.saveState() {
+		if err := s.diskForecast.Save(s.diskForecastPath()); err != nil {
+			s.logger.Warn("Failed to save disk forecast", zap.Error(err))
+		}
+	}
+
+	horizon := s.config.Tasks.SystemMetrics.DiskForecast.Horizon
+	for i := range metrics.Disks {
+		disk := &metrics.Disks[i]
+		prediction := s.diskForecast.Predict(disk.Drive)
+		if prediction.Available {
+			disk.FullInHours = utils.Round(prediction.FullIn.Hours())
+		}
+
+		switch {
+		case prediction.Available && prediction.FullIn <= horizon && !s.fillAlerts[disk.Drive]:
+			s.fillAlerts[disk.Drive] = true
+			s.publishFillPrediction(disk.Drive, prediction, true)
+		case s.fillAlerts[disk.Drive] && (!prediction.Available || prediction.FullIn > horizon/2*3):
+			delete(s.fillAlerts, disk.Drive)
+			s.publishFillPrediction(disk.Drive, prediction, false)
+		}
+	}
+}
+
+// publishFillPrediction publishes a disk_full_predicted event when a drive
+// is projected to fill within the horizon (predicted) and when it no
+// longer is
+func (s *Scheduler) publishFillPrediction(drive string, prediction tasks.DiskPrediction, predicted bool) {
+	horizon := s.config.Tasks.SystemMetrics.DiskForecast.Horizon
+	details := map[string]string{
+		"drive":         drive,
+		"predicted":     strconv.FormatBool(predicted),
+		"free_gb":       strconv.FormatFloat(utils.Round(prediction.FreeGB), 'f', -1, 64),
+		"horizon_hours": strconv.FormatFloat(horizon.Hours(), 'f', -1, 64),
+		"samples":       strconv.Itoa(prediction.Samples),
+	}
+
+	severity := tasks.EventSeverityInfo
+	message := fmt.Sprintf("Drive %s is no longer projected to fill within %v", drive, horizon)
+	if predicted {
+		severity = tasks.EventSeverityWarning
+		message = fmt.Sprintf("Drive %s is projected to fill in %.1f hours (%.2f GB free, shrinking %.2f GB/day)",
+			drive, prediction.FullIn.Hours(), prediction.FreeGB, prediction.GBPerDay)
+		details["full_in_hours"] = strconv.FormatFloat(utils.Round(prediction.FullIn.Hours()), 'f', -1, 64)
+		details["gb_per_day"] = strconv.FormatFloat(utils.Round(prediction.GBPerDay), 'f', -1, 64)
+		s.logger.Warn("Drive projected to fill within the forecast horizon",
+			zap.String("drive", drive),
+			zap.Float64("full_in_hours", prediction.FullIn.Hours()),
+			zap.Float64("gb_per_day", prediction.GBPerDay))
+	} else {
+		s.logger.Info("Drive no longer projected to fill within the forecast horizon", zap.String("drive", drive))
+	}
+
+	s.publishEvent(tasks.CreateEvent(tasks.EventDiskFullPredicted, severity, message, details))
+}
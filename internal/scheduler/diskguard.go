@@ -0,0 +1,139 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// taskDiskGuard is the job name of the disk guard. Like the memory
+// watchdog it is not pausable: it guards the agent itself.
+const taskDiskGuard = "disk_guard"
+
+// SetDiskLowHandler sets the function called when free space crosses
+// runtime.disk_guard.min_free_mb (low) and when it recovers (!low)
+func (s *Scheduler) SetDiskLowHandler(fn func(low bool)) {
+	s.onDiskLow = fn
+}
+
+// scheduleDiskGuard schedules the disk guard WITH PANIC RECOVERY, OVERRUN
+// GUARD AND CONTEXT CHECK. It runs at startup too, so an agent started on a
+// full disk stops writing straight away.
+func (s *Scheduler) scheduleDiskGuard() error {
+	d := s.config.Runtime.DiskGuard
+	if d.MinFreeMB == 0 || len(s.diskGuardPaths()) == 0 {
+		return nil // Disabled, or nothing written to disk
+	}
+
+	s.running[taskDiskGuard] = &atomic.Bool{}
+	_, err := s.scheduler.NewJob(
+		gocron.DurationJob(d.Interval),
+		gocron.NewTask(s.guardTask(taskDiskGuard, d.Interval, func(context.Context) {
+			s.checkDisk()
+		})),
+		gocron.WithName(taskDiskGuard),
+		gocron.WithStartAt(gocron.WithStartImmediately()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule disk guard: %w", err)
+	}
+	s.logger.Info("Scheduled disk guard",
+		zap.Int("min_free_mb", d.MinFreeMB),
+		zap.Duration("interval", d.Interval),
+		zap.Strings("paths", s.diskGuardPaths()))
+	return nil
+}
+
+// diskGuardPaths returns the directories the agent writes to: the log
+// file's and the data dir, unless state is kept in memory
+func (s *Scheduler) diskGuardPaths() []string {
+	var paths []string
+	if !config.StateInMemory(s.config) {
+		paths = append(paths, s.config.DataDir)
+	}
+	if s.config.Logging.File != "" {
+		if dir := filepath.Dir(s.config.Logging.File); dir != s.config.DataDir {
+			paths = append(paths, dir)
+		}
+	}
+	return paths
+}
+
+// lowestFree returns the path with the least free space and its free bytes
+func (s *Scheduler) lowestFree() (string, uint64, error) {
+	var lowest string
+	var lowestFree uint64
+	for _, path := range s.diskGuardPaths() {
+		free, err := tasks.DiskFree(path)
+		if err != nil {
+			return "", 0, err
+		}
+		if lowest == "" || free < lowestFree {
+			lowest, lowestFree = path, free
+		}
+	}
+	return lowest, lowestFree, nil
+}
+
+// checkDisk compares free space with the minimum. Crossing it trims the
+// agent's rotated log backups, stops its disk writes and publishes a
+// disk_low event; writes resume above 1.5x the minimum, so the guard
+// doesn't flap around it.
+func (s *Scheduler) checkDisk() {
+	path, free, err := s.lowestFree()
+	if err != nil {
+		s.logger.Warn("Disk guard could not read free space", zap.Error(err))
+		return
+	}
+	d := s.config.Runtime.DiskGuard
+	minFree := uint64(d.MinFreeMB) * 1024 * 1024
+	freeMB := int(free / 1024 / 1024)
+
+	if free >= minFree {
+		if free >= minFree/2*3 && s.diskLow.CompareAndSwap(true, false) {
+			s.logger.Info("Free disk space recovered, resuming agent disk writes",
+				zap.String("path", path),
+				zap.Int("free_mb", freeMB))
+			if s.onDiskLow != nil {
+				s.onDiskLow(false)
+			}
+		}
+		return
+	}
+	if !s.diskLow.CompareAndSwap(false, true) {
+		return
+	}
+
+	trimmed, err := tasks.TrimLogBackups(s.config.Logging.File)
+	if err != nil {
+		s.logger.Warn("Disk guard could not trim all log backups", zap.Error(err))
+	}
+	trimmedMB := int(trimmed / 1024 / 1024)
+
+	s.logger.Error("Free disk space below the disk guard minimum, stopping agent disk writes",
+		zap.String("path", path),
+		zap.Int("free_mb", freeMB),
+		zap.Int("min_free_mb", d.MinFreeMB),
+		zap.Int("trimmed_mb", trimmedMB))
+	if s.onDiskLow != nil {
+		s.onDiskLow(true)
+	}
+	s.publishEvent(tasks.CreateEvent(
+		tasks.EventDiskLow,
+		tasks.EventSeverityError,
+		fmt.Sprintf("Free space on %s is %d MB, below the %d MB minimum", path, freeMB, d.MinFreeMB),
+		map[string]string{
+			"path":        path,
+			"free_mb":     strconv.Itoa(freeMB),
+			"min_free_mb": strconv.Itoa(d.MinFreeMB),
+			"trimmed_mb":  strconv.Itoa(trimmedMB),
+		},
+	))
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/election"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// initElection sets up the site leader election. Elected tasks must be
+// scheduled by this agent, so a typo doesn't silently run a task everywhere.
+func (s *Scheduler) initElection() error {
+	c := s.config.Election
+	if !c.Enabled {
+		return nil
+	}
+
+	s.elected = make(map[string]bool, len(c.Tasks))
+	for _, task := range c.Tasks {
+		if _, ok := s.running[task]; !ok {
+			return fmt.Errorf("election.tasks: unknown or disabled task: %s", task)
+		}
+		s.elected[task] = true
+	}
+
+	site := s.electionSite()
+	s.election = election.New(site, s.config.Code, s.bindElection, s.logger)
+	s.election.OnChange = s.publishLeaderChange
+	s.logger.Info("Site leader election enabled",
+		zap.String("site", site),
+		zap.String("bucket", c.Bucket),
+		zap.Strings("tasks", c.Tasks))
+	return nil
+}
+
+// electionSite is the lease key: the site tag and its value, e.g. site.hq
+func (s *Scheduler) electionSite() string {
+	tag := s.config.Election.Tag
+	return tag + "." + s.config.Tags[tag]
+}
+
+// bindElection binds the election bucket. Its TTL is the lease: without
+// one, a leader that died would hold the lease forever.
+func (s *Scheduler) bindElection() (election.Store, time.Duration, error) {
+	bucket := s.config.Election.Bucket
+	kv, err := s.nats.KeyValue(bucket)
+	if err != nil {
+		return nil, 0, err
+	}
+	status, err := kv.Status()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read KV bucket %s status: %w", bucket, err)
+	}
+	if status.TTL() <= 0 {
+		return nil, 0, fmt.Errorf("KV bucket %s has no TTL, so a failed leader's lease would never expire", bucket)
+	}
+	return kv, status.TTL(), nil
+}
+
+// notLeader reports whether task is elected and another agent (or none)
+// holds the site lease
+func (s *Scheduler) notLeader(task string) bool {
+	return s.elected[task] && !s.election.Leader()
+}
+
+// publishLeaderChange publishes a leader_change event when this agent
+// gains or loses the site lease
+func (s *Scheduler) publishLeaderChange(leader bool) {
+	site := s.electionSite()
+	message := fmt.Sprintf("Became site leader for %s", site)
+	if !leader {
+		message = fmt.Sprintf("No longer site leader for %s", site)
+	}
+	s.publishEvent(tasks.CreateEvent(tasks.EventLeaderChange, tasks.EventSeverityInfo, message, map[string]string{
+		"site":   site,
+		"leader": strconv.FormatBool(leader),
+		"tasks":  strings.Join(s.config.Election.Tasks, ","),
+	}))
+}
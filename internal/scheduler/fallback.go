@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/stone-age-io/agent/internal/tasks"
+)
+
+// checkCollectorFallback publishes a collector_fallback event when system
+// metrics switch from the exporter to the builtin collector or back
+func (s *Scheduler) checkCollectorFallback() {
+	reason := s.executor.MetricsFallback()
+	if (reason != "") == s.fallingBack {
+		return
+	}
+	s.fallingBack = reason != ""
+
+	c := s.config.Tasks.SystemMetrics
+	details := map[string]string{
+		"exporter_url": c.ExporterURL,
+		"fallback":     strconv.FormatBool(s.fallingBack),
+	}
+	severity := tasks.EventSeverityInfo
+	message := fmt.Sprintf("Exporter %s is reachable again, system metrics come from it", c.ExporterURL)
+	if s.fallingBack {
+		severity = tasks.EventSeverityWarning
+		message = fmt.Sprintf("Exporter %s failed %d scrapes in a row, system metrics come from the builtin collector", c.ExporterURL, c.Fallback.Failures)
+		details["error"] = reason
+		details["retry_interval"] = c.Fallback.RetryInterval.String()
+	}
+	s.publishEvent(tasks.CreateEvent(tasks.EventCollectorFallback, severity, message, details))
+}
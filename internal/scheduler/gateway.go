@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// childState is the outcome of a gateway child's last poll, reported in its
+// heartbeat
+type childState struct {
+	mu        sync.Mutex
+	polled    bool
+	reachable bool
+	lastError string
+}
+
+// childSequence returns the sequences key for a child's subject suffix.
+// Children have their own subjects, so their sequences are kept apart from
+// the agent's.
+func childSequence(code, suffix string) string {
+	return code + "." + suffix
+}
+
+// initGateway registers the in-flight flags, sequences and poll state of
+// every gateway child
+func (s *Scheduler) initGateway() {
+	s.children = make(map[string]*childState)
+	for _, child := range s.config.Gateway.Children {
+		s.children[child.Code] = &childState{}
+		s.sequences[childSequence(child.Code, "heartbeat")] = &atomic.Uint64{}
+		s.sequences[childSequence(child.Code, "telemetry.plugin."+child.Plugin)] = &atomic.Uint64{}
+		if child.Interval > 0 {
+			s.running[tasks.GatewayTaskPrefix+child.Code] = &atomic.Bool{}
+		}
+	}
+}
+
+// scheduleGateway schedules the poll of every gateway child with an interval
+// WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+func (s *Scheduler) scheduleGateway() error {
+	for _, child := range s.config.Gateway.Children {
+		if child.Interval == 0 {
+			continue
+		}
+		child := child
+		plugin, ok := s.childPlugin(child)
+		if !ok {
+			return fmt.Errorf("gateway child %s: plugin %s not found", child.Code, child.Plugin)
+		}
+		task := tasks.GatewayTaskPrefix + child.Code
+		timeout := plugin.Timeout
+		if timeout == 0 {
+			timeout = s.config.Commands.Timeout
+		}
+
+		s.executor.RegisterPluginTask(task)
+		definition, options := s.jobSchedule(task, child.Interval)
+		_, err := s.scheduler.NewJob(
+			definition,
+			gocron.NewTask(s.guardTask(task, timeout, func(ctx context.Context) {
+				s.pollChild(ctx, child, plugin, timeout)
+			})),
+			options...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule gateway child %s: %w", child.Code, err)
+		}
+		s.logger.Info("Scheduled gateway child poll",
+			zap.String("child", child.Code),
+			zap.String("plugin", plugin.Name),
+			zap.Duration("interval", child.Interval),
+			zap.Duration("timeout", timeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+	}
+	return nil
+}
+
+// childPlugin returns the plugin serving a child
+func (s *Scheduler) childPlugin(child config.ChildConfig) (config.PluginConfig, bool) {
+	for _, plugin := range s.config.Plugins {
+		if plugin.Name == child.Plugin {
+			return plugin, true
+		}
+	}
+	return config.PluginConfig{}, false
+}
+
+// childLocation returns the child's location, defaulting to the agent's
+func (s *Scheduler) childLocation(child config.ChildConfig) string {
+	if child.Location != "" {
+		return child.Location
+	}
+	return s.config.Location
+}
+
+// pollChild runs a child's plugin and publishes its output on the child's
+// own telemetry subject. ctx carries the task timeout.
+func (s *Scheduler) pollChild(ctx context.Context, child config.ChildConfig, plugin config.PluginConfig, timeout time.Duration) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.GatewayTaskPrefix + child.Code) {
+		return
+	}
+
+	location := s.childLocation(child)
+	suffix := "telemetry.plugin." + plugin.Name
+	sequence := childSequence(child.Code, suffix)
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, child.Code, suffix)
+
+	output, err := s.executor.RunPlugin(ctx, plugin.Path, plugin.Args, &tasks.PluginRequest{
+		Mode:     "task",
+		Code:     child.Code,
+		Location: location,
+		Gateway:  s.config.Code,
+	}, timeout)
+
+	state := s.children[child.Code]
+	state.mu.Lock()
+	state.polled = true
+	state.reachable = err == nil
+	state.lastError = ""
+	if err != nil {
+		state.lastError = err.Error()
+	}
+	state.mu.Unlock()
+
+	if err != nil {
+		s.logger.Warn("Gateway child poll failed", zap.String("child", child.Code), zap.Error(err))
+
+		// Publish error message so control plane knows the poll failed
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = child.Code
+		errorMsg.Location = location
+		errorMsg.MessageMeta = s.nextMeta(sequence)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal gateway child error message", zap.Error(marshalErr))
+			return
+		}
+
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(child.Code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue gateway child error publish", zap.Error(err))
+		}
+		return
+	}
+
+	message := tasks.CreatePluginMessage(plugin.Name, output)
+	message.Code = child.Code
+	message.Location = location
+	message.Gateway = s.config.Code
+	message.MessageMeta = s.nextMeta(sequence)
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.logger.Error("Failed to marshal gateway child output", zap.String("child", child.Code), zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, message.MsgID(child.Code, suffix, message.TS), data); err != nil {
+		s.logger.Error("Failed to queue gateway child publish", zap.String("child", child.Code), zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued gateway child publish",
+		zap.String("child", child.Code),
+		zap.String("subject", subject),
+		zap.Int("bytes", len(data)))
+}
+
+// publishChildHeartbeats publishes a heartbeat for every gateway child on
+// its own subject, alongside the agent's. Like the agent's heartbeat these
+// are Core NATS: the gateway vouches for the child on every tick.
+func (s *Scheduler) publishChildHeartbeats() {
+	for _, child := range s.config.Gateway.Children {
+		heartbeat := s.executor.CreateHeartbeat(child.Code, s.childLocation(child))
+		heartbeat.MessageMeta = s.nextMeta(childSequence(child.Code, "heartbeat"))
+		heartbeat.Gateway = s.config.Code
+
+		state := s.children[child.Code]
+		state.mu.Lock()
+		if state.polled {
+			reachable := state.reachable
+			heartbeat.Reachable = &reachable
+			heartbeat.LastError = state.lastError
+		}
+		state.mu.Unlock()
+
+		data, err := json.Marshal(heartbeat)
+		if err != nil {
+			s.logger.Error("Failed to marshal gateway child heartbeat", zap.Error(err))
+			continue
+		}
+
+		subject := fmt.Sprintf("%s.%s.heartbeat", s.subjectPrefix, child.Code)
+		if err := s.nats.Publish(subject, data); err != nil {
+			// Fire-and-forget: log and let the next tick retry
+			s.logger.Error("Failed to publish gateway child heartbeat", zap.String("child", child.Code), zap.Error(err))
+		}
+	}
+}
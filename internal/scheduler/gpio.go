@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleGPIO schedules the gpio state poll WITH PANIC RECOVERY, OVERRUN
+// GUARD AND CONTEXT CHECK
+func (s *Scheduler) scheduleGPIO() error {
+	interval := s.config.GPIO.PollInterval
+	if !s.config.GPIO.Enabled || interval == 0 {
+		return nil
+	}
+	code := s.config.Code
+
+	s.executor.RegisterPluginTask(tasks.TaskGPIO)
+	definition, options := s.jobSchedule(tasks.TaskGPIO, interval)
+	_, err := s.scheduler.NewJob(
+		definition,
+		gocron.NewTask(s.guardTask(tasks.TaskGPIO, interval, func(context.Context) {
+			s.publishGPIO(code)
+		})),
+		options...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule gpio poll: %w", err)
+	}
+	s.logger.Info("Scheduled gpio poll",
+		zap.Int("pins", len(s.config.GPIO.Pins)),
+		zap.Duration("interval", interval),
+		zap.Duration("jitter", s.config.Tasks.Jitter))
+	return nil
+}
+
+// publishGPIO reads every pin and publishes their states
+func (s *Scheduler) publishGPIO(code string) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskGPIO) {
+		return
+	}
+
+	suffix := "telemetry." + tasks.TaskGPIO
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	msg, err := s.executor.ReadGPIO()
+	if err != nil {
+		s.logger.Error("GPIO poll failed", zap.Error(err))
+
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal gpio error message", zap.Error(marshalErr))
+			return
+		}
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue gpio error publish", zap.Error(err))
+		}
+		return
+	}
+
+	if len(msg.Errors) > 0 {
+		s.logger.Warn("Some gpio pins could not be read", zap.Int("failed", len(msg.Errors)))
+	}
+
+	msg.Code = code
+	msg.Location = s.config.Location
+	msg.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal gpio message", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, msg.MsgID(code, suffix, msg.TS), data); err != nil {
+		s.logger.Error("Failed to queue gpio publish", zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued gpio publish",
+		zap.String("subject", subject),
+		zap.Int("pins", len(msg.Values)))
+}
@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/tasks"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// PublishOnline publishes the "online" lifecycle message with the boot
+// reason (one of the tasks.BootReason* constants)
+func (s *Scheduler) PublishOnline(bootReason string) {
+	msg := tasks.CreateLifecycle(tasks.LifecycleOnline, s.build.Version)
+	msg.BootReason = bootReason
+
+	subject, data, err := s.lifecycleMessage(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal lifecycle message", zap.Error(err))
+		return
+	}
+	if err := s.nats.PublishTelemetry(subject, msg.MsgID(msg.Code, "telemetry.lifecycle", msg.TS), data); err != nil {
+		s.logger.Error("Failed to queue online lifecycle publish", zap.Error(err))
+	}
+}
+
+// PublishStopping publishes the "stopping" lifecycle message and waits up to
+// timeout for JetStream to ack it. Best effort: a failure is only logged, so
+// a broken link can't hold up shutdown.
+func (s *Scheduler) PublishStopping(reason string, timeout time.Duration) {
+	msg := tasks.CreateLifecycle(tasks.LifecycleStopping, s.build.Version)
+	msg.Reason = reason
+	msg.UptimeSeconds = s.executor.GetAgentMetrics().UptimeSeconds
+
+	subject, data, err := s.lifecycleMessage(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal lifecycle message", zap.Error(err))
+		return
+	}
+	if err := s.nats.PublishTelemetrySync(subject, msg.MsgID(msg.Code, "telemetry.lifecycle", msg.TS), data, timeout); err != nil {
+		s.logger.Warn("Failed to publish stopping lifecycle message", zap.Error(err))
+		return
+	}
+	s.logger.Info("Published stopping lifecycle message", zap.String("reason", reason))
+}
+
+// PublishCrash publishes the previous run's crash report and waits up to
+// timeout for JetStream to ack it. Returns false if it was not stored, so
+// the report can be kept for the next start.
+func (s *Scheduler) PublishCrash(report *tasks.CrashReport, timeout time.Duration) bool {
+	code := s.config.Code
+	subject := fmt.Sprintf("%s.%s.telemetry.crash", s.subjectPrefix, code)
+
+	report.Code = code
+	report.Location = s.config.Location
+	report.MessageMeta = s.nextMeta("telemetry.crash")
+	report.TS = utils.NowRFC3339()
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		s.logger.Error("Failed to marshal crash report", zap.Error(err))
+		return false
+	}
+	if err := s.nats.PublishTelemetrySync(subject, report.MsgID(code, "telemetry.crash", report.TS), data, timeout); err != nil {
+		s.logger.Warn("Failed to publish crash report", zap.Error(err))
+		return false
+	}
+	s.logger.Info("Published crash report from previous run", zap.String("crashed_at", report.CrashedAt))
+	return true
+}
+
+// lifecycleMessage stamps identity on a lifecycle message and marshals it
+func (s *Scheduler) lifecycleMessage(msg *tasks.LifecycleMessage) (string, []byte, error) {
+	msg.Code = s.config.Code
+	msg.Location = s.config.Location
+	msg.MessageMeta = s.nextMeta("telemetry.lifecycle")
+
+	data, err := json.Marshal(msg)
+	return fmt.Sprintf("%s.%s.telemetry.lifecycle", s.subjectPrefix, msg.Code), data, err
+}
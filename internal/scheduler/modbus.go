@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/modbus"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleModbus schedules the poll of every Modbus device WITH PANIC
+// RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+func (s *Scheduler) scheduleModbus() error {
+	code := s.config.Code
+
+	for i := range s.config.Modbus.Devices {
+		device := &s.config.Modbus.Devices[i]
+		task := tasks.ModbusTaskPrefix + device.Name
+
+		// A poll may wait on other devices sharing its serial line, so it
+		// gets the whole interval rather than a per-request timeout
+		timeout := device.Interval
+
+		s.executor.RegisterPluginTask(task)
+		definition, options := s.jobSchedule(task, device.Interval)
+		_, err := s.scheduler.NewJob(
+			definition,
+			gocron.NewTask(s.guardTask(task, timeout, func(ctx context.Context) {
+				s.publishModbus(ctx, code, device)
+			})),
+			options...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule modbus device %s: %w", device.Name, err)
+		}
+		s.logger.Info("Scheduled modbus poll",
+			zap.String("device", device.Name),
+			zap.String("transport", device.Transport),
+			zap.Int("registers", len(device.Registers)),
+			zap.Duration("interval", device.Interval),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+	}
+	return nil
+}
+
+// publishModbus polls a Modbus device and publishes its readings. ctx carries
+// the task timeout.
+func (s *Scheduler) publishModbus(ctx context.Context, code string, device *config.ModbusDeviceConfig) {
+	select {
+	case <-s.ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.ModbusTaskPrefix + device.Name) {
+		return
+	}
+
+	suffix := "telemetry.modbus." + device.Name
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	reading, err := modbus.Poll(ctx, device)
+	if err != nil {
+		s.logger.Error("Modbus poll failed", zap.String("device", device.Name), zap.Error(err))
+
+		// Publish error message so control plane knows the device is unreachable
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal modbus error message", zap.Error(marshalErr))
+			return
+		}
+
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue modbus error publish", zap.Error(err))
+		}
+		return
+	}
+
+	if len(reading.Errors) > 0 {
+		s.logger.Warn("Some modbus registers could not be read",
+			zap.String("device", device.Name),
+			zap.Int("failed", len(reading.Errors)))
+	}
+
+	reading.Code = code
+	reading.Location = s.config.Location
+	reading.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(reading)
+	if err != nil {
+		s.logger.Error("Failed to marshal modbus reading", zap.String("device", device.Name), zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, reading.MsgID(code, suffix, reading.TS), data); err != nil {
+		s.logger.Error("Failed to queue modbus publish", zap.String("device", device.Name), zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued modbus publish",
+		zap.String("device", device.Name),
+		zap.String("subject", subject),
+		zap.Int("values", len(reading.Values)))
+}
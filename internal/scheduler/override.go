@@ -0,0 +1,191 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	natsclient "github.com/stone-age-io/agent/internal/nats"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// maxOverrideTTL bounds how long cmd.task.configure can change a task's
+// interval, so a forgotten incident override doesn't outlive the day
+const maxOverrideTTL = 24 * time.Hour
+
+// minOverrideInterval is the shortest interval cmd.task.configure may set,
+// matching the configured minimums where there are any
+var minOverrideInterval = map[string]time.Duration{
+	tasks.TaskHeartbeat:     10 * time.Second,
+	tasks.TaskSystemMetrics: 30 * time.Second,
+	tasks.TaskServiceCheck:  10 * time.Second,
+	tasks.TaskInventory:     time.Minute,
+}
+
+// configurableJob is a task cmd.task.configure can reschedule: what it was
+// scheduled with, to restore it, and the override in effect
+type configurableJob struct {
+	definition gocron.JobDefinition // As configured
+	task       gocron.Task
+	run        func(ctx context.Context) // Unguarded, rewrapped for an overriding interval
+	configured string                    // Configured interval or cron schedule, for reports
+	timeout    time.Duration             // Configured timeout, 0 for the interval
+
+	override *natsclient.TaskOverride // Nil while on the configured schedule
+	timer    *time.Timer              // Restores the configured schedule at override.Until
+}
+
+// newConfigurableJob schedules run, guarded with the timeout it gets at
+// interval, as a task whose interval cmd.task.configure can override
+func (s *Scheduler) newConfigurableJob(name string, definition gocron.JobDefinition, run func(ctx context.Context), options []gocron.JobOption, configured string, interval, timeout time.Duration) error {
+	task := gocron.NewTask(s.guardTask(name, taskTimeout(timeout, interval), run))
+	if _, err := s.scheduler.NewJob(definition, task, options...); err != nil {
+		return err
+	}
+	s.overrideMu.Lock()
+	s.configurable[name] = &configurableJob{definition: definition, task: task, run: run, configured: configured, timeout: timeout}
+	s.overrideMu.Unlock()
+	return nil
+}
+
+// ConfigureTask runs task every interval instead of its configured schedule
+// until ttl passes, then restores the configured schedule. An interval of 0
+// restores it now. Changes are written to the audit log and published as
+// task_interval events.
+func (s *Scheduler) ConfigureTask(task string, interval, ttl time.Duration, requester string) (*natsclient.TaskOverride, error) {
+	s.overrideMu.Lock()
+	defer s.overrideMu.Unlock()
+
+	job, ok := s.configurable[task]
+	if !ok {
+		names := make([]string, 0, len(s.configurable))
+		for name := range s.configurable {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown or disabled task: %s (configurable: %s)", task, strings.Join(names, ", "))
+	}
+
+	if interval == 0 {
+		if job.override == nil {
+			return nil, nil
+		}
+		if err := s.restoreTask(task, job, "reset", requester); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if minimum := minOverrideInterval[task]; interval < minimum || interval > maxOverrideTTL {
+		return nil, fmt.Errorf("interval for %s must be between %v and %v (got: %v)", task, minimum, maxOverrideTTL, interval)
+	}
+	// Without a configured timeout the interval bounds each run, as it does
+	// on the configured schedule
+	timeout := taskTimeout(job.timeout, interval)
+	if interval < timeout {
+		return nil, fmt.Errorf("interval for %s must not be shorter than its timeout (%v)", task, timeout)
+	}
+	if jitter := s.config.Tasks.Jitter; jitter >= interval/2 {
+		return nil, fmt.Errorf("interval for %s must be more than twice tasks.jitter (%v)", task, jitter)
+	}
+	if ttl <= 0 || ttl > maxOverrideTTL {
+		return nil, fmt.Errorf("ttl must be between 1s and %v (got: %v)", maxOverrideTTL, ttl)
+	}
+
+	definition, options := s.jobSchedule(task, interval)
+	if err := s.updateJob(task, definition, gocron.NewTask(s.guardTask(task, timeout, job.run)), options); err != nil {
+		return nil, err
+	}
+	if job.timer != nil {
+		job.timer.Stop()
+	}
+	override := &natsclient.TaskOverride{
+		Interval:   interval.String(),
+		Configured: job.configured,
+		Until:      time.Now().Add(ttl).UTC().Format(time.RFC3339),
+		Requester:  requester,
+	}
+	job.override = override
+	job.timer = time.AfterFunc(ttl, func() {
+		s.overrideMu.Lock()
+		defer s.overrideMu.Unlock()
+		if job.override != override {
+			return // Replaced or reset since
+		}
+		if err := s.restoreTask(task, job, "expired", ""); err != nil {
+			s.logger.Error("Failed to restore task schedule", zap.String("task", task), zap.Error(err))
+		}
+	})
+
+	s.audit.Info("Task interval override",
+		zap.String("command", "task.configure"),
+		zap.String("task", task),
+		zap.String("interval", override.Interval),
+		zap.String("configured", job.configured),
+		zap.String("until", override.Until),
+		zap.String("requester", requester))
+	details := map[string]string{"task": task, "interval": override.Interval, "configured": job.configured, "until": override.Until}
+	if requester != "" {
+		details["requester"] = requester
+	}
+	s.publishEvent(tasks.CreateEvent(tasks.EventTaskInterval, tasks.EventSeverityInfo,
+		fmt.Sprintf("Task %s runs every %s until %s", task, override.Interval, override.Until), details))
+	return override, nil
+}
+
+// restoreTask puts a task back on its configured schedule. reason is
+// "reset" (cmd.task.configure without an interval) or "expired". Callers
+// hold overrideMu.
+func (s *Scheduler) restoreTask(task string, job *configurableJob, reason, requester string) error {
+	if err := s.updateJob(task, job.definition, job.task, []gocron.JobOption{gocron.WithName(task)}); err != nil {
+		return err
+	}
+	if job.timer != nil {
+		job.timer.Stop()
+	}
+	job.override, job.timer = nil, nil
+
+	s.audit.Info("Task interval restored",
+		zap.String("command", "task.configure"),
+		zap.String("task", task),
+		zap.String("configured", job.configured),
+		zap.String("reason", reason),
+		zap.String("requester", requester))
+	details := map[string]string{"task": task, "configured": job.configured, "reason": reason}
+	if requester != "" {
+		details["requester"] = requester
+	}
+	s.publishEvent(tasks.CreateEvent(tasks.EventTaskInterval, tasks.EventSeverityInfo,
+		fmt.Sprintf("Task %s back on its configured schedule (%s)", task, job.configured), details))
+	return nil
+}
+
+// updateJob replaces the schedule of the job named task, keeping its ID.
+// options must name the job after task.
+func (s *Scheduler) updateJob(task string, definition gocron.JobDefinition, fn gocron.Task, options []gocron.JobOption) error {
+	for _, job := range s.scheduler.Jobs() {
+		if job.Name() != task {
+			continue
+		}
+		if _, err := s.scheduler.Update(job.ID(), definition, fn, options...); err != nil {
+			return fmt.Errorf("failed to reschedule task %s: %w", task, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("task %s is not scheduled", task)
+}
+
+// taskOverride returns the interval override of task, or nil
+func (s *Scheduler) taskOverride(task string) *natsclient.TaskOverride {
+	s.overrideMu.Lock()
+	defer s.overrideMu.Unlock()
+	if job, ok := s.configurable[task]; ok && job.override != nil {
+		override := *job.override
+		return &override
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// newOverrideScheduler starts a scheduler with the service check task every
+// interval, reporting the time left on each run's context to deadlines
+func newOverrideScheduler(t *testing.T, interval, timeout, jitter time.Duration) (*Scheduler, chan time.Duration) {
+	t.Helper()
+	gs, err := gocron.NewScheduler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = gs.Shutdown() })
+
+	cfg := &config.Config{}
+	cfg.Tasks.Jitter = jitter
+	s := &Scheduler{
+		scheduler:    gs,
+		logger:       zap.NewNop(),
+		audit:        zap.NewNop(),
+		config:       cfg,
+		ctx:          context.Background(),
+		configurable: make(map[string]*configurableJob),
+		running:      map[string]*atomic.Bool{tasks.TaskServiceCheck: {}},
+	}
+
+	deadlines := make(chan time.Duration, 1)
+	run := func(ctx context.Context) {
+		deadline, _ := ctx.Deadline()
+		deadlines <- time.Until(deadline)
+	}
+	definition, options := s.jobSchedule(tasks.TaskServiceCheck, interval)
+	if err := s.newConfigurableJob(tasks.TaskServiceCheck, definition, run, options, interval.String(), interval, timeout); err != nil {
+		t.Fatal(err)
+	}
+	gs.Start()
+	return s, deadlines
+}
+
+// runTimeout runs the service check now and returns its run's timeout
+func runTimeout(t *testing.T, s *Scheduler, deadlines chan time.Duration) time.Duration {
+	t.Helper()
+	for _, job := range s.scheduler.Jobs() {
+		if job.Name() != tasks.TaskServiceCheck {
+			continue
+		}
+		if err := job.RunNow(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case left := <-deadlines:
+			return left.Round(time.Minute / 2)
+		case <-time.After(5 * time.Second):
+			t.Fatal("service check did not run")
+		}
+	}
+	t.Fatal("service check is not scheduled")
+	return 0
+}
+
+func TestConfigureTask(t *testing.T) {
+	s, deadlines := newOverrideScheduler(t, time.Hour, 0, 5*time.Second)
+
+	override, err := s.ConfigureTask(tasks.TaskServiceCheck, 30*time.Second, time.Hour, "ops")
+	if err != nil {
+		t.Fatalf("ConfigureTask() error = %v", err)
+	}
+	if override.Interval != "30s" || override.Configured != "1h0m0s" || override.Requester != "ops" {
+		t.Errorf("ConfigureTask() = %+v", override)
+	}
+	if got := s.taskOverride(tasks.TaskServiceCheck); got == nil || *got != *override {
+		t.Errorf("taskOverride() = %+v, want %+v", got, override)
+	}
+	// Without a configured timeout, the overriding interval bounds each run
+	if got := runTimeout(t, s, deadlines); got != 30*time.Second {
+		t.Errorf("run timeout = %v, want 30s", got)
+	}
+
+	if override, err := s.ConfigureTask(tasks.TaskServiceCheck, 0, 0, "ops"); err != nil || override != nil {
+		t.Fatalf("ConfigureTask(reset) = %+v, %v", override, err)
+	}
+	if got := s.taskOverride(tasks.TaskServiceCheck); got != nil {
+		t.Errorf("taskOverride() after reset = %+v, want nil", got)
+	}
+	if got := runTimeout(t, s, deadlines); got != time.Hour {
+		t.Errorf("run timeout after reset = %v, want 1h", got)
+	}
+}
+
+func TestConfigureTaskExpiry(t *testing.T) {
+	s, deadlines := newOverrideScheduler(t, time.Hour, 0, 0)
+
+	if _, err := s.ConfigureTask(tasks.TaskServiceCheck, time.Minute, 50*time.Millisecond, ""); err != nil {
+		t.Fatalf("ConfigureTask() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.taskOverride(tasks.TaskServiceCheck) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("override did not expire")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := runTimeout(t, s, deadlines); got != time.Hour {
+		t.Errorf("run timeout after expiry = %v, want 1h", got)
+	}
+}
+
+func TestConfigureTaskRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		task     string
+		interval time.Duration
+		ttl      time.Duration
+		timeout  time.Duration
+		jitter   time.Duration
+		wantErr  string
+	}{
+		{name: "unknown task", task: "nope", interval: time.Minute, ttl: time.Hour, wantErr: "unknown or disabled task"},
+		{name: "below minimum", interval: 5 * time.Second, ttl: time.Hour, wantErr: "must be between"},
+		{name: "above maximum", interval: 25 * time.Hour, ttl: time.Hour, wantErr: "must be between"},
+		{name: "shorter than timeout", interval: time.Minute, ttl: time.Hour, timeout: 2 * time.Minute, wantErr: "shorter than its timeout"},
+		{name: "within jitter", interval: 20 * time.Second, ttl: time.Hour, jitter: 10 * time.Second, wantErr: "tasks.jitter"},
+		{name: "no ttl", interval: time.Minute, wantErr: "ttl must be between"},
+		{name: "ttl too long", interval: time.Minute, ttl: 25 * time.Hour, wantErr: "ttl must be between"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newOverrideScheduler(t, time.Hour, tt.timeout, tt.jitter)
+			task := tt.task
+			if task == "" {
+				task = tasks.TaskServiceCheck
+			}
+			_, err := s.ConfigureTask(task, tt.interval, tt.ttl, "")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ConfigureTask() error = %v, want %q", err, tt.wantErr)
+			}
+			if got := s.taskOverride(tasks.TaskServiceCheck); got != nil {
+				t.Errorf("taskOverride() = %+v, want nil", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleRAID schedules the RAID health check WITH PANIC RECOVERY, OVERRUN
+// GUARD AND CONTEXT CHECK. It also runs once shortly after startup, so an
+// array that degraded while the agent was down is reported promptly.
+func (s *Scheduler) scheduleRAID() error {
+	if !s.config.RAID.Enabled {
+		return nil
+	}
+	code := s.config.Code
+	interval := s.config.RAID.Interval
+	timeout := taskTimeout(s.config.RAID.Timeout, interval)
+
+	startupCheck := s.guardTask(tasks.TaskRAID, timeout, func(ctx context.Context) {
+		s.publishRAID(ctx, code)
+	})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(randomDelay(s.config.Tasks.Splay)):
+		}
+		startupCheck()
+	}()
+
+	s.executor.RegisterPluginTask(tasks.TaskRAID)
+	definition, options := s.jobSchedule(tasks.TaskRAID, interval)
+	_, err := s.scheduler.NewJob(
+		definition,
+		gocron.NewTask(s.guardTask(tasks.TaskRAID, timeout, func(ctx context.Context) {
+			s.publishRAID(ctx, code)
+		})),
+		options...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule raid check: %w", err)
+	}
+	s.logger.Info("Scheduled raid check",
+		zap.Bool("mdraid", s.config.RAID.MDRaid),
+		zap.Int("controllers", len(s.config.RAID.Controllers)),
+		zap.Duration("interval", interval),
+		zap.Duration("timeout", timeout),
+		zap.Duration("jitter", s.config.Tasks.Jitter))
+	return nil
+}
+
+// publishRAID reads every RAID source, publishes the arrays and raises
+// events for arrays whose state changed
+func (s *Scheduler) publishRAID(ctx context.Context, code string) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskRAID) {
+		return
+	}
+
+	suffix := "telemetry." + tasks.TaskRAID
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	msg := s.executor.CheckRAID(ctx, &s.config.RAID)
+	for source, err := range msg.Errors {
+		s.logger.Warn("Failed to read raid source", zap.String("source", source), zap.String("error", err))
+	}
+	msg.Code = code
+	msg.Location = s.config.Location
+	msg.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal raid message", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, msg.MsgID(code, suffix, msg.TS), data); err != nil {
+		s.logger.Error("Failed to queue raid publish", zap.Error(err))
+	} else {
+		s.logger.Debug("Queued raid publish",
+			zap.String("subject", subject),
+			zap.Int("arrays", len(msg.Arrays)),
+			zap.Int("errors", len(msg.Errors)))
+	}
+
+	s.checkRAIDStates(msg)
+}
+
+// checkRAIDStates publishes a raid_health event for each array whose state
+// changed since the last check, and for arrays no longer reported by a
+// source that was read. On the first check only arrays that are not ok are
+// reported.
+func (s *Scheduler) checkRAIDStates(msg *tasks.RAIDMessage) {
+	seen := make(map[string]bool, len(msg.Arrays))
+	for _, array := range msg.Arrays {
+		key := array.Source + "/" + array.Name
+		seen[key] = true
+		previous, known := s.raidStates[key]
+		s.raidStates[key] = array.State
+		if previous == array.State || (!known && array.State == tasks.RAIDStateOK) {
+			continue
+		}
+
+		severity := tasks.EventSeverityError
+		message := fmt.Sprintf("RAID array %s (%s) is %s: %s", array.Name, array.Source, array.State, array.Status)
+		switch array.State {
+		case tasks.RAIDStateOK:
+			severity = tasks.EventSeverityInfo
+			message = fmt.Sprintf("RAID array %s (%s) is ok again", array.Name, array.Source)
+		case tasks.RAIDStateRebuilding, tasks.RAIDStateUnknown:
+			severity = tasks.EventSeverityWarning
+		}
+		s.logger.Warn("RAID array state changed",
+			zap.String("source", array.Source),
+			zap.String("array", array.Name),
+			zap.String("state", array.State),
+			zap.String("previous", previous))
+		s.publishEvent(tasks.CreateEvent(tasks.EventRAIDHealth, severity, message, map[string]string{
+			"source":   array.Source,
+			"array":    array.Name,
+			"state":    array.State,
+			"status":   array.Status,
+			"previous": previous,
+		}))
+	}
+
+	for key, previous := range s.raidStates {
+		if seen[key] {
+			continue
+		}
+		// Sources never contain a slash; array names may (a0/vd0)
+		source, name, _ := strings.Cut(key, "/")
+		// A source that failed to read says nothing about its arrays
+		if _, failed := msg.Errors[source]; failed {
+			continue
+		}
+		delete(s.raidStates, key)
+		s.logger.Warn("RAID array no longer reported", zap.String("source", source), zap.String("array", name))
+		s.publishEvent(tasks.CreateEvent(tasks.EventRAIDHealth, tasks.EventSeverityError,
+			fmt.Sprintf("RAID array %s (%s) is no longer reported", name, source), map[string]string{
+				"source":   source,
+				"array":    name,
+				"state":    "missing",
+				"previous": previous,
+			}))
+	}
+}
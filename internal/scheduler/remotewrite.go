@@ -0,0 +1,45 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stone-age-io/agent/internal/remotewrite"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// initRemoteWrite sets up the remote_write output for system metrics
+func (s *Scheduler) initRemoteWrite() error {
+	c := s.config.Tasks.SystemMetrics.RemoteWrite
+	if !s.config.Tasks.SystemMetrics.Enabled || !c.Enabled {
+		return nil
+	}
+
+	client, err := remotewrite.New(c, s.config.Code, s.config.Location)
+	if err != nil {
+		return fmt.Errorf("system_metrics.remote_write: %w", err)
+	}
+	s.remoteWrite = client
+	s.logger.Info("Pushing system metrics to remote_write",
+		zap.String("url", c.URL),
+		zap.Bool("skip_nats", c.SkipNATS))
+	return nil
+}
+
+// pushRemoteWrite sends the scrape to the remote_write endpoint. A failed
+// push is logged and counted but not retried: the next scrape follows
+// soon enough, and the TSDB just shows a gap.
+func (s *Scheduler) pushRemoteWrite(ctx context.Context, metrics *tasks.SystemMetrics) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.Tasks.SystemMetrics.RemoteWrite.Timeout)
+	defer cancel()
+
+	series := s.remoteWrite.Series(metrics)
+	err := s.remoteWrite.Push(ctx, series)
+	s.executor.RecordRemoteWrite(err)
+	if err != nil {
+		s.logger.Warn("Failed to push metrics to remote_write", zap.Error(err))
+		return
+	}
+	s.logger.Debug("Pushed metrics to remote_write", zap.Int("series", len(series)))
+}
@@ -3,14 +3,22 @@ package scheduler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/bacnet"
 	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/election"
 	natsclient "github.com/stone-age-io/agent/internal/nats"
+	"github.com/stone-age-io/agent/internal/remotewrite"
 	"github.com/stone-age-io/agent/internal/tasks"
 	"github.com/stone-age-io/agent/internal/utils"
 	"go.uber.org/zap"
@@ -23,9 +31,32 @@ type Scheduler struct {
 	nats          *natsclient.Client
 	executor      *tasks.Executor
 	config        *config.Config
-	version       string
+	build         tasks.BuildInfo
+	fingerprint   string // config.Fingerprint, stamped on heartbeats (reloads restart the agent)
 	subjectPrefix string
-	ctx           context.Context // ADDED: Context for cancellation
+	ctx           context.Context            // ADDED: Context for cancellation
+	running       map[string]*atomic.Bool    // Per-task in-flight flag for overrun protection
+	started       atomic.Bool                // True between Start and Shutdown
+	sequences     map[string]*atomic.Uint64  // Per-subject message sequence (see tasks.MessageMeta)
+	children      map[string]*childState     // Gateway child poll state, by child code
+	bacnet        *bacnet.Client             // Shared BACnet/IP socket, nil if disabled
+	overMemory    atomic.Bool                // Agent RSS is above runtime.watchdog.rss_limit_mb
+	onMemoryLimit func()                     // Called when the watchdog trips with restart enabled
+	diskLow       atomic.Bool                // Free space is below runtime.disk_guard.min_free_mb
+	onDiskLow     func(low bool)             // Called when the disk guard trips or recovers
+	zfsHealth     map[string]string          // Last ZFS pool health, by pool (zfs task only; runs never overlap)
+	raidStates    map[string]string          // Last RAID array state, by source/name (raid task only)
+	upsStates     map[string]string          // Last UPS power status, by name (ups task only)
+	diskForecast  *tasks.DiskForecast        // Free space trend per drive, nil if disabled
+	fillAlerts    map[string]bool            // Drives with a disk_full_predicted alert raised (system_metrics task only)
+	fallingBack   bool                       // System metrics come from the builtin fallback (system_metrics task only)
+	availability  *tasks.AvailabilityTracker // Up/down history per monitored service, nil if disabled
+	remoteWrite   *remotewrite.Client        // Prometheus remote_write output for system metrics, nil if disabled
+	election      *election.Elector          // Site leader election, nil if disabled
+	elected       map[string]bool            // Tasks only the site leader runs
+	audit         *zap.Logger                // Interval overrides (cmd.task.configure)
+	overrideMu    sync.Mutex
+	configurable  map[string]*configurableJob // Tasks cmd.task.configure can reschedule, by name
 }
 
 // New creates a new scheduler with configured tasks
@@ -35,11 +66,21 @@ func New(
 	natsClient *natsclient.Client,
 	executor *tasks.Executor,
 	cfg *config.Config,
-	version string,
+	build tasks.BuildInfo,
 	ctx context.Context,
 ) (*Scheduler, error) {
-	// Create gocron scheduler
-	s, err := gocron.NewScheduler()
+	// Create gocron scheduler; cron schedules run in tasks.timezone
+	loc, err := config.LoadTimezone(cfg.Tasks.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	options := []gocron.SchedulerOption{gocron.WithLocation(loc)}
+	if limit := cfg.Runtime.MaxConcurrentJobs; limit > 0 {
+		// Jobs over the limit queue instead of being skipped, so every
+		// task still runs, just later
+		options = append(options, gocron.WithLimitConcurrentJobs(uint(limit), gocron.LimitModeWait))
+	}
+	s, err := gocron.NewScheduler(options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
 	}
@@ -50,9 +91,71 @@ func New(
 		nats:          natsClient,
 		executor:      executor,
 		config:        cfg,
-		version:       version,
+		build:         build,
+		fingerprint:   config.Fingerprint(cfg),
 		subjectPrefix: cfg.SubjectPrefix,
 		ctx:           ctx, // ADDED: Store context
+		audit:         logger.Named("audit"),
+		configurable:  make(map[string]*configurableJob),
+		running: map[string]*atomic.Bool{
+			tasks.TaskHeartbeat:     {},
+			tasks.TaskSystemMetrics: {},
+			tasks.TaskServiceCheck:  {},
+			tasks.TaskInventory:     {},
+		},
+		sequences: map[string]*atomic.Uint64{
+			"heartbeat":           {},
+			"telemetry.system":    {},
+			"telemetry.service":   {},
+			"telemetry.inventory": {},
+			"telemetry.event":     {},
+			"telemetry.lifecycle": {},
+			"telemetry.crash":     {},
+		},
+	}
+
+	for _, plugin := range cfg.Plugins {
+		if plugin.Interval > 0 || plugin.Schedule != "" {
+			scheduler.running[tasks.PluginTaskPrefix+plugin.Name] = &atomic.Bool{}
+			scheduler.sequences["telemetry.plugin."+plugin.Name] = &atomic.Uint64{}
+		}
+	}
+	scheduler.initGateway()
+	for _, device := range cfg.Modbus.Devices {
+		scheduler.running[tasks.ModbusTaskPrefix+device.Name] = &atomic.Bool{}
+		scheduler.sequences["telemetry.modbus."+device.Name] = &atomic.Uint64{}
+	}
+	scheduler.initBACnet()
+	if cfg.GPIO.Enabled && cfg.GPIO.PollInterval > 0 {
+		scheduler.running[tasks.TaskGPIO] = &atomic.Bool{}
+		scheduler.sequences["telemetry."+tasks.TaskGPIO] = &atomic.Uint64{}
+	}
+	if cfg.Compliance.Enabled {
+		scheduler.running[tasks.TaskCompliance] = &atomic.Bool{}
+		scheduler.sequences["telemetry."+tasks.TaskCompliance] = &atomic.Uint64{}
+	}
+	if cfg.ZFS.Enabled {
+		scheduler.running[tasks.TaskZFS] = &atomic.Bool{}
+		scheduler.sequences["telemetry."+tasks.TaskZFS] = &atomic.Uint64{}
+		scheduler.zfsHealth = make(map[string]string)
+	}
+	if cfg.RAID.Enabled {
+		scheduler.running[tasks.TaskRAID] = &atomic.Bool{}
+		scheduler.sequences["telemetry."+tasks.TaskRAID] = &atomic.Uint64{}
+		scheduler.raidStates = make(map[string]string)
+	}
+	if cfg.UPS.Enabled {
+		scheduler.running[tasks.TaskUPS] = &atomic.Bool{}
+		scheduler.upsStates = make(map[string]string)
+	}
+	scheduler.initDiskForecast()
+	scheduler.initAvailability()
+	if err := scheduler.initRemoteWrite(); err != nil {
+		return nil, err
+	}
+
+	if err := scheduler.initElection(); err != nil {
+		return nil, err
 	}
 
 	// Schedule tasks based on configuration
@@ -63,6 +166,16 @@ func New(
 	return scheduler, nil
 }
 
+// nextMeta returns the metadata for the next message on a subject suffix
+// (e.g. "telemetry.system", or a childSequence key for a gateway child).
+// Error messages share their subject's sequence.
+func (s *Scheduler) nextMeta(suffix string) tasks.MessageMeta {
+	return tasks.MessageMeta{
+		SchemaVersion: tasks.SchemaVersion,
+		Sequence:      s.sequences[suffix].Add(1),
+	}
+}
+
 // wrapTaskWithRecovery wraps a task function with panic recovery AND context checking
 // MODIFIED: Now checks context before execution
 func (s *Scheduler) wrapTaskWithRecovery(taskName string, taskFunc func()) func() {
@@ -96,9 +209,16 @@ func (s *Scheduler) wrapTaskWithRecovery(taskName string, taskFunc func()) func(
 func (s *Scheduler) scheduleTasks() error {
 	code := s.config.Code
 
+	// Tasks whose host capability is missing aren't scheduled at all
+	metricsEnabled := s.config.Tasks.SystemMetrics.Enabled
+	if err := s.executor.Unavailable("tasks.system_metrics"); metricsEnabled && err != nil {
+		s.logger.Warn("Not scheduling metrics task", zap.Error(err))
+		metricsEnabled = false
+	}
+
 	// If metrics are enabled, establish baseline with retries
 	// This is critical for counter-based metrics (CPU, disk I/O)
-	if s.config.Tasks.SystemMetrics.Enabled {
+	if metricsEnabled {
 		s.logger.Info("Establishing metrics baseline")
 
 		const maxRetries = 3
@@ -113,7 +233,7 @@ func (s *Scheduler) scheduleTasks() error {
 			default:
 			}
 
-			_, err := s.executor.ScrapeMetrics(s.config.Tasks.SystemMetrics.ExporterURL)
+			_, err := s.executor.ScrapeMetrics(s.ctx, s.config.Tasks.SystemMetrics.ExporterURL)
 			if err == nil {
 				s.logger.Info("Metrics baseline established successfully")
 				baselineErr = nil
@@ -150,102 +270,495 @@ func (s *Scheduler) scheduleTasks() error {
 		}
 	}
 
-	// Schedule heartbeat task WITH PANIC RECOVERY AND CONTEXT CHECK
+	// Per-task timeouts (0 in config means the interval is the only bound)
+	heartbeatTimeout := taskTimeout(s.config.Tasks.Heartbeat.Timeout, s.config.Tasks.Heartbeat.Interval)
+	metricsTimeout := taskTimeout(s.config.Tasks.SystemMetrics.Timeout, s.config.Tasks.SystemMetrics.Interval)
+	serviceCheckTimeout := taskTimeout(s.config.Tasks.ServiceCheck.Timeout, s.config.Tasks.ServiceCheck.Interval)
+	inventoryTimeout := taskTimeout(s.config.Tasks.Inventory.Timeout, s.config.Tasks.Inventory.Interval)
+
+	// Schedule heartbeat task WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
 	if s.config.Tasks.Heartbeat.Enabled {
-		_, err := s.scheduler.NewJob(
-			gocron.DurationJob(s.config.Tasks.Heartbeat.Interval),
-			gocron.NewTask(s.wrapTaskWithRecovery("heartbeat", func() {
-				s.publishHeartbeat(code)
-			})),
-		)
+		publishHeartbeat := func(ctx context.Context) {
+			s.publishHeartbeat(ctx, code)
+		}
+		definition, options := s.jobSchedule(tasks.TaskHeartbeat, s.config.Tasks.Heartbeat.Interval)
+		err := s.newConfigurableJob(tasks.TaskHeartbeat, definition, publishHeartbeat, options,
+			s.config.Tasks.Heartbeat.Interval.String(), s.config.Tasks.Heartbeat.Interval, s.config.Tasks.Heartbeat.Timeout)
 		if err != nil {
 			return fmt.Errorf("failed to schedule heartbeat: %w", err)
 		}
 		s.logger.Info("Scheduled heartbeat task",
-			zap.Duration("interval", s.config.Tasks.Heartbeat.Interval))
+			zap.Duration("interval", s.config.Tasks.Heartbeat.Interval),
+			zap.Duration("fast_interval", s.config.Tasks.Heartbeat.FastInterval),
+			zap.Duration("timeout", heartbeatTimeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+
+		if fast := s.config.Tasks.Heartbeat.FastInterval; fast > 0 && fast < s.config.Tasks.Heartbeat.Interval {
+			go s.adaptHeartbeat(s.guardTask(tasks.TaskHeartbeat, heartbeatTimeout, publishHeartbeat), fast)
+		}
 	}
 
-	// Schedule system metrics task WITH PANIC RECOVERY AND CONTEXT CHECK
-	if s.config.Tasks.SystemMetrics.Enabled {
-		_, err := s.scheduler.NewJob(
-			gocron.DurationJob(s.config.Tasks.SystemMetrics.Interval),
-			gocron.NewTask(s.wrapTaskWithRecovery("metrics", func() {
-				s.publishMetrics(code)
-			})),
+	// Schedule system metrics task WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+	if metricsEnabled {
+		definition, options := s.jobSchedule(tasks.TaskSystemMetrics, s.config.Tasks.SystemMetrics.Interval)
+		err := s.newConfigurableJob(
+			tasks.TaskSystemMetrics,
+			definition,
+			func(ctx context.Context) {
+				s.publishMetrics(ctx, code)
+			},
+			options,
+			s.config.Tasks.SystemMetrics.Interval.String(),
+			s.config.Tasks.SystemMetrics.Interval,
+			s.config.Tasks.SystemMetrics.Timeout,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to schedule metrics: %w", err)
 		}
 		s.logger.Info("Scheduled metrics task",
-			zap.Duration("interval", s.config.Tasks.SystemMetrics.Interval))
+			zap.Duration("interval", s.config.Tasks.SystemMetrics.Interval),
+			zap.Duration("timeout", metricsTimeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
 	}
 
-	// Schedule service check task WITH PANIC RECOVERY AND CONTEXT CHECK
-	if s.config.Tasks.ServiceCheck.Enabled {
-		_, err := s.scheduler.NewJob(
-			gocron.DurationJob(s.config.Tasks.ServiceCheck.Interval),
-			gocron.NewTask(s.wrapTaskWithRecovery("service_check", func() {
+	// Schedule service check task WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+	serviceCheckEnabled := s.config.Tasks.ServiceCheck.Enabled
+	if err := s.executor.Unavailable("tasks.service_check"); serviceCheckEnabled && err != nil {
+		s.logger.Warn("Not scheduling service check task", zap.Error(err))
+		serviceCheckEnabled = false
+	}
+	if serviceCheckEnabled {
+		definition, options := s.jobSchedule(tasks.TaskServiceCheck, s.config.Tasks.ServiceCheck.Interval)
+		err := s.newConfigurableJob(
+			tasks.TaskServiceCheck,
+			definition,
+			func(ctx context.Context) {
 				s.publishServiceStatus(code)
-			})),
+			},
+			options,
+			s.config.Tasks.ServiceCheck.Interval.String(),
+			s.config.Tasks.ServiceCheck.Interval,
+			s.config.Tasks.ServiceCheck.Timeout,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to schedule service check: %w", err)
 		}
 		s.logger.Info("Scheduled service check task",
-			zap.Duration("interval", s.config.Tasks.ServiceCheck.Interval))
+			zap.Duration("interval", s.config.Tasks.ServiceCheck.Interval),
+			zap.Duration("timeout", serviceCheckTimeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
 	}
 
-	// Schedule inventory task WITH PANIC RECOVERY AND CONTEXT CHECK (but run it once immediately first)
+	// Schedule inventory task WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK (but run it once immediately first)
 	if s.config.Tasks.Inventory.Enabled {
-		// Run immediately on startup (wrapped with panic recovery)
-		startupTask := s.wrapTaskWithRecovery("inventory_startup", func() {
-			s.publishInventory(code)
+		// Run immediately on startup (wrapped with panic recovery), delayed by
+		// the splay so a fleet restarted together doesn't publish in lockstep
+		startupTask := s.guardTask(tasks.TaskInventory, inventoryTimeout, func(ctx context.Context) {
+			s.publishInventory(ctx, code)
 		})
-		go startupTask()
+		go func() {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-time.After(randomDelay(s.config.Tasks.Splay)):
+			}
+			startupTask()
+		}()
 
 		// Then schedule for periodic execution
-		_, err := s.scheduler.NewJob(
-			gocron.DurationJob(s.config.Tasks.Inventory.Interval),
-			gocron.NewTask(s.wrapTaskWithRecovery("inventory", func() {
-				s.publishInventory(code)
-			})),
+		definition, options := s.jobSchedule(tasks.TaskInventory, s.config.Tasks.Inventory.Interval)
+		configured := s.config.Tasks.Inventory.Interval.String()
+		if schedule := s.config.Tasks.Inventory.Schedule; schedule != "" {
+			definition, options = s.cronSchedule(tasks.TaskInventory, schedule)
+			configured = schedule
+		}
+		err := s.newConfigurableJob(
+			tasks.TaskInventory,
+			definition,
+			func(ctx context.Context) {
+				s.publishInventory(ctx, code)
+			},
+			options,
+			configured,
+			s.config.Tasks.Inventory.Interval,
+			s.config.Tasks.Inventory.Timeout,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to schedule inventory: %w", err)
 		}
 		s.logger.Info("Scheduled inventory task",
-			zap.Duration("interval", s.config.Tasks.Inventory.Interval))
+			zap.Duration("interval", s.config.Tasks.Inventory.Interval),
+			zap.String("schedule", s.config.Tasks.Inventory.Schedule),
+			zap.Duration("timeout", inventoryTimeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
 	}
 
-	return nil
+	// Schedule plugin tasks WITH PANIC RECOVERY, OVERRUN GUARD AND CONTEXT CHECK
+	for _, plugin := range s.config.Plugins {
+		if plugin.Interval == 0 && plugin.Schedule == "" {
+			continue
+		}
+		plugin := plugin
+		task := tasks.PluginTaskPrefix + plugin.Name
+		timeout := plugin.Timeout
+		if timeout == 0 {
+			timeout = s.config.Commands.Timeout
+		}
+
+		s.executor.RegisterPluginTask(task)
+		definition, options := s.jobSchedule(task, plugin.Interval)
+		if plugin.Schedule != "" {
+			definition, options = s.cronSchedule(task, plugin.Schedule)
+		}
+		_, err := s.scheduler.NewJob(
+			definition,
+			gocron.NewTask(s.guardTask(task, timeout, func(ctx context.Context) {
+				s.publishPlugin(ctx, code, plugin, timeout)
+			})),
+			options...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to schedule plugin %s: %w", plugin.Name, err)
+		}
+		s.logger.Info("Scheduled plugin task",
+			zap.String("plugin", plugin.Name),
+			zap.Duration("interval", plugin.Interval),
+			zap.String("schedule", plugin.Schedule),
+			zap.Duration("timeout", timeout),
+			zap.Duration("jitter", s.config.Tasks.Jitter))
+	}
+
+	if err := s.scheduleModbus(); err != nil {
+		return err
+	}
+	if err := s.scheduleBACnet(); err != nil {
+		return err
+	}
+
+	if err := s.scheduleGPIO(); err != nil {
+		return err
+	}
+	if err := s.scheduleCompliance(); err != nil {
+		return err
+	}
+	if err := s.scheduleZFS(); err != nil {
+		return err
+	}
+	if err := s.scheduleRAID(); err != nil {
+		return err
+	}
+	if err := s.scheduleUPS(); err != nil {
+		return err
+	}
+	if err := s.scheduleWatchdog(); err != nil {
+		return err
+	}
+	if err := s.scheduleDiskGuard(); err != nil {
+		return err
+	}
+
+	return s.scheduleGateway()
+}
+
+// saveState reports whether state files (service availability, disk
+// forecast) may be written: not while the disk guard has tripped or the
+// data dir is read-only
+func (s *Scheduler) saveState() bool {
+	return !s.diskLow.Load() && s.executor.Unavailable("data_dir") == nil
+}
+
+// guardTask wraps a scheduled task with overrun protection, a timeout, and
+// panic recovery. If the previous run of the same task is still in flight
+// the tick is skipped, so a hung exporter scrape can't stack up goroutines.
+// Each run gets a context that expires after timeout; when it does, an
+// overrun event is published. Work that doesn't observe the context keeps
+// running in the background, but further ticks are skipped until it returns.
+func (s *Scheduler) guardTask(task string, timeout time.Duration, taskFunc func(ctx context.Context)) func() {
+	running := s.running[task]
+	return func() {
+		if s.notLeader(task) {
+			s.logger.Debug("Skipping task, this agent is not the site leader", zap.String("task", task))
+			return
+		}
+		if !running.CompareAndSwap(false, true) {
+			s.logger.Warn("Skipping scheduled task, previous run still in progress",
+				zap.String("task", task))
+			s.publishOverrun(task, "still_running", timeout)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(s.ctx, timeout)
+		defer cancel()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer running.Store(false)
+			s.wrapTaskWithRecovery(task, func() {
+				taskFunc(ctx)
+			})()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				s.logger.Warn("Scheduled task exceeded its timeout",
+					zap.String("task", task),
+					zap.Duration("timeout", timeout))
+				s.publishOverrun(task, "timeout", timeout)
+			}
+		}
+	}
+}
+
+// taskTimeout returns the configured timeout, falling back to the interval
+func taskTimeout(timeout, interval time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return interval
+}
+
+// retryTask runs fn until it succeeds or r.Attempts retries have failed,
+// waiting r.Backoff before the first retry and doubling it after each. A
+// retry that couldn't finish before ctx's deadline isn't started, so
+// retrying never turns a failure into a task overrun.
+func (s *Scheduler) retryTask(ctx context.Context, task string, r config.RetryConfig, fn func() error) error {
+	backoff := r.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt > r.Attempts {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return err
+		}
+
+		s.logger.Warn("Task failed, retrying",
+			zap.String("task", task),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err))
+		s.executor.RecordRetry(task)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// jobSchedule builds the gocron definition and options for a task interval.
+// The job is named after the task so it can be reported by Health.
+// Jitter turns the fixed interval into a random one in [interval-jitter,
+// interval+jitter], and splay pushes the first run out by a random amount,
+// so thousands of agents booted from the same image don't hit JetStream in
+// synchronized bursts. With both disabled this is a plain DurationJob.
+func (s *Scheduler) jobSchedule(task string, interval time.Duration) (gocron.JobDefinition, []gocron.JobOption) {
+	var definition gocron.JobDefinition
+	if jitter := s.config.Tasks.Jitter; jitter > 0 {
+		definition = gocron.DurationRandomJob(interval-jitter, interval+jitter)
+	} else {
+		definition = gocron.DurationJob(interval)
+	}
+
+	options := []gocron.JobOption{gocron.WithName(task)}
+	if s.config.Tasks.Splay > 0 {
+		firstRun := time.Now().Add(interval + randomDelay(s.config.Tasks.Splay))
+		options = append(options, gocron.WithStartAt(gocron.WithStartDateTime(firstRun)))
+	}
+
+	return definition, options
+}
+
+// cronSchedule returns the job definition for a cron expression, run in
+// tasks.timezone. Splay and jitter don't apply: the expression sets the time.
+func (s *Scheduler) cronSchedule(task, schedule string) (gocron.JobDefinition, []gocron.JobOption) {
+	return gocron.CronJob(schedule, false), []gocron.JobOption{gocron.WithName(task)}
+}
+
+// randomDelay returns a uniformly random duration in [0, max).
+// Returns 0 when max is not positive.
+func randomDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return rand.N(max) //nolint:gosec // scheduling spread does not need a CSPRNG
 }
 
 // Start begins executing scheduled tasks
 func (s *Scheduler) Start() {
+	if s.election != nil {
+		go s.election.Run(s.ctx)
+	}
 	s.scheduler.Start()
+	s.started.Store(true)
 	s.logger.Info("Scheduler started")
 }
 
 // Shutdown gracefully stops the scheduler
 func (s *Scheduler) Shutdown() error {
 	s.logger.Info("Shutting down scheduler")
-	return s.scheduler.Shutdown()
+	s.started.Store(false)
+	err := s.scheduler.Shutdown()
+	if s.bacnet != nil {
+		s.bacnet.Close()
+	}
+	if s.election != nil {
+		s.election.Release()
+	}
+	return err
+}
+
+// Health reports whether the scheduler is running and the last/next run of
+// every scheduled job, for the cmd.health response
+func (s *Scheduler) Health() *natsclient.SchedulerHealth {
+	health := &natsclient.SchedulerHealth{
+		Running: s.started.Load(),
+		Jobs:    []natsclient.JobHealth{},
+	}
+
+	for _, job := range s.scheduler.Jobs() {
+		jh := natsclient.JobHealth{Name: job.Name()}
+		if running, ok := s.running[job.Name()]; ok {
+			jh.InFlight = running.Load()
+		}
+		if lastRun, err := job.LastRun(); err == nil && !lastRun.IsZero() {
+			jh.LastRun = lastRun.Format(time.RFC3339)
+		}
+		if nextRun, err := job.NextRun(); err == nil && !nextRun.IsZero() {
+			jh.NextRun = nextRun.Format(time.RFC3339)
+		}
+		jh.Override = s.taskOverride(job.Name())
+		health.Jobs = append(health.Jobs, jh)
+	}
+
+	sort.Slice(health.Jobs, func(i, j int) bool {
+		return health.Jobs[i].Name < health.Jobs[j].Name
+	})
+
+	if s.election != nil {
+		status := s.election.Status()
+		health.Election = &status
+	}
+	health.DiskLow = s.diskLow.Load()
+
+	return health
+}
+
+// RunTask runs a scheduled task now, outside its schedule. The overrun
+// guard still applies, so a run already in flight is not duplicated.
+func (s *Scheduler) RunTask(task string) error {
+	var names []string
+	for _, job := range s.scheduler.Jobs() {
+		if job.Name() != task {
+			names = append(names, job.Name())
+			continue
+		}
+		if s.executor.IsTaskPaused(task) {
+			return fmt.Errorf("task %s is paused", task)
+		}
+		if s.notLeader(task) {
+			return fmt.Errorf("task %s runs on the site leader, which is not this agent", task)
+		}
+		if err := job.RunNow(); err != nil {
+			return fmt.Errorf("failed to run task %s: %w", task, err)
+		}
+		s.logger.Info("Task run requested", zap.String("task", task))
+		return nil
+	}
+
+	sort.Strings(names)
+	return fmt.Errorf("unknown or disabled task: %s (scheduled: %s)", task, strings.Join(names, ", "))
+}
+
+// taskPaused reports whether an operator paused the task via cmd.task.pause
+func (s *Scheduler) taskPaused(task string) bool {
+	if s.executor.IsTaskPaused(task) {
+		s.logger.Debug("Skipping paused task", zap.String("task", task))
+		return true
+	}
+	return false
+}
+
+// publishOverrun publishes a task_overrun warning event
+func (s *Scheduler) publishOverrun(task, reason string, timeout time.Duration) {
+	event := tasks.CreateEvent(
+		tasks.EventTaskOverrun,
+		tasks.EventSeverityWarning,
+		fmt.Sprintf("Scheduled task %s overran its timeout (%s)", task, reason),
+		map[string]string{
+			"task":    task,
+			"reason":  reason,
+			"timeout": timeout.String(),
+		},
+	)
+	s.publishEvent(event)
+}
+
+// PublishEvent publishes an event raised outside the scheduler, such as by
+// a command handler
+func (s *Scheduler) PublishEvent(event *tasks.Event) {
+	s.publishEvent(event)
+}
+
+// publishEvent stamps identity on an event and publishes it to JetStream
+func (s *Scheduler) publishEvent(event *tasks.Event) {
+	if s.nats == nil {
+		return // Not connected (tests)
+	}
+	subject := fmt.Sprintf("%s.%s.telemetry.event", s.subjectPrefix, s.config.Code)
+
+	// Stamp identity so the message is self-describing
+	event.Code = s.config.Code
+	event.Location = s.config.Location
+	event.MessageMeta = s.nextMeta("telemetry.event")
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("Failed to marshal event", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, event.MsgID(event.Code, "telemetry.event", event.TS), data); err != nil {
+		s.logger.Error("Failed to queue event publish",
+			zap.String("type", event.Type),
+			zap.Error(err))
+	}
 }
 
 // publishHeartbeat publishes a heartbeat message over core NATS.
 // Heartbeats are deliberately NOT JetStream: a missed beat is the signal
 // consumers care about, so last-write-wins semantics are correct and a
 // backlog of stale beats after a reconnect would be actively harmful.
-func (s *Scheduler) publishHeartbeat(code string) {
+func (s *Scheduler) publishHeartbeat(ctx context.Context, code string) {
 	select {
 	case <-s.ctx.Done():
 		return
 	default:
 	}
 
+	if s.taskPaused(tasks.TaskHeartbeat) {
+		return
+	}
+
 	subject := fmt.Sprintf("%s.%s.heartbeat", s.subjectPrefix, code)
 
 	heartbeat := s.executor.CreateHeartbeat(code, s.config.Location)
+	heartbeat.MessageMeta = s.nextMeta("heartbeat")
+	heartbeat.Tags = s.config.Tags
+	heartbeat.NATS = s.nats.ConnectionStats()
+	heartbeat.Health = s.executor.HealthSummary(heartbeat.NATS.Reconnects)
+	heartbeat.Version = s.build.Version
+	heartbeat.Commit = s.build.Commit
+	heartbeat.ConfigFingerprint = s.fingerprint
+	heartbeat.Timezone, heartbeat.UTCOffset = tasks.LocalTimezone(time.Now())
+	if s.config.Tasks.Heartbeat.TimeSync {
+		heartbeat.TimeSync = s.executor.TimeSync(ctx)
+	}
 	data, err := json.Marshal(heartbeat)
 	if err != nil {
 		s.logger.Error("Failed to marshal heartbeat", zap.Error(err))
@@ -260,29 +773,81 @@ func (s *Scheduler) publishHeartbeat(code string) {
 
 	// Record successful execution
 	s.executor.RecordHeartbeat()
+	s.executor.RecordHealthSummary(heartbeat.Health)
+
+	s.publishChildHeartbeats()
 }
 
-// publishMetrics scrapes and publishes system metrics
-func (s *Scheduler) publishMetrics(code string) {
+// adaptHeartbeat sends extra heartbeats while connectivity is degraded, so
+// recovery from an outage shows up within seconds instead of a full
+// interval. Each reconnect or publish failure reported by the NATS client
+// schedules a beat after fast; the gap then doubles per beat, and once it
+// reaches the configured interval the regular schedule alone remains.
+func (s *Scheduler) adaptHeartbeat(heartbeat func(), fast time.Duration) {
+	interval := s.config.Tasks.Heartbeat.Interval
+	timer := time.NewTimer(fast)
+	timer.Stop()
+	defer timer.Stop()
+
+	var delay time.Duration // 0 while not sped up
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.nats.Degraded():
+			if delay == 0 {
+				s.logger.Info("Connectivity degraded, speeding up heartbeat",
+					zap.Duration("interval", fast))
+			}
+			delay = fast
+			timer.Reset(delay)
+		case <-timer.C:
+			heartbeat()
+			delay *= 2
+			if delay >= interval {
+				delay = 0
+				s.logger.Info("Heartbeat back to its configured interval",
+					zap.Duration("interval", interval))
+				continue
+			}
+			timer.Reset(delay)
+		}
+	}
+}
+
+// publishMetrics scrapes and publishes system metrics.
+// ctx carries the task timeout so a hung scrape is abandoned.
+func (s *Scheduler) publishMetrics(ctx context.Context, code string) {
 	select {
 	case <-s.ctx.Done():
 		return
 	default:
 	}
 
+	if s.taskPaused(tasks.TaskSystemMetrics) {
+		return
+	}
+
 	subject := fmt.Sprintf("%s.%s.telemetry.system", s.subjectPrefix, code)
 
-	metrics, err := s.executor.ScrapeMetrics(s.config.Tasks.SystemMetrics.ExporterURL)
+	var metrics *tasks.SystemMetrics
+	err := s.retryTask(ctx, tasks.TaskSystemMetrics, s.config.Tasks.SystemMetrics.Retry, func() error {
+		var err error
+		metrics, err = s.executor.ScrapeMetrics(ctx, s.config.Tasks.SystemMetrics.ExporterURL)
+		return err
+	})
+	s.checkCollectorFallback()
 	if err != nil {
 		s.logger.Error("Failed to scrape metrics", zap.Error(err))
 
 		// Record failure
-		s.executor.RecordMetricsFailure()
+		s.executor.RecordMetricsFailure(err)
 
 		// Publish error message so control plane knows scraping failed
 		errorMsg := tasks.CreateTelemetryError(err)
 		errorMsg.Code = code
 		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta("telemetry.system")
 		data, marshalErr := json.Marshal(errorMsg)
 		if marshalErr != nil {
 			s.logger.Error("Failed to marshal metrics error message", zap.Error(marshalErr))
@@ -290,15 +855,26 @@ func (s *Scheduler) publishMetrics(code string) {
 		}
 
 		// Even errors are published async - fire and forget
-		if err := s.nats.PublishTelemetry(subject, data); err != nil {
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, "telemetry.system", errorMsg.TS), data); err != nil {
 			s.logger.Error("Failed to queue metrics error publish", zap.Error(err))
 		}
 		return
 	}
 
+	s.forecastDisks(metrics)
+
 	// Stamp identity so the message is self-describing
 	metrics.Code = code
 	metrics.Location = s.config.Location
+	metrics.MessageMeta = s.nextMeta("telemetry.system")
+
+	if s.remoteWrite != nil {
+		s.pushRemoteWrite(ctx, metrics)
+		if s.config.Tasks.SystemMetrics.RemoteWrite.SkipNATS {
+			s.executor.RecordMetricsSuccess()
+			return
+		}
+	}
 
 	data, err := json.Marshal(metrics)
 	if err != nil {
@@ -307,7 +883,7 @@ func (s *Scheduler) publishMetrics(code string) {
 	}
 
 	// Fire and forget with async retries
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	if err := s.nats.PublishTelemetry(subject, metrics.MsgID(code, "telemetry.system", metrics.TS), data); err != nil {
 		s.logger.Error("Failed to queue metrics publish", zap.Error(err))
 		return
 	}
@@ -338,6 +914,10 @@ func (s *Scheduler) publishServiceStatus(code string) {
 	default:
 	}
 
+	if s.taskPaused(tasks.TaskServiceCheck) {
+		return
+	}
+
 	subject := fmt.Sprintf("%s.%s.telemetry.service", s.subjectPrefix, code)
 
 	statuses, err := s.executor.GetServiceStatuses(s.config.Tasks.ServiceCheck.Services)
@@ -348,24 +928,36 @@ func (s *Scheduler) publishServiceStatus(code string) {
 		errorMsg := tasks.CreateTelemetryError(err)
 		errorMsg.Code = code
 		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta("telemetry.service")
 		data, marshalErr := json.Marshal(errorMsg)
 		if marshalErr != nil {
 			s.logger.Error("Failed to marshal service status error message", zap.Error(marshalErr))
 			return
 		}
 
-		if err := s.nats.PublishTelemetry(subject, data); err != nil {
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, "telemetry.service", errorMsg.TS), data); err != nil {
 			s.logger.Error("Failed to queue service status error publish", zap.Error(err))
 		}
 		return
 	}
 
+	s.trackAvailability(statuses)
+
 	// Create message with all services
 	message := tasks.ServiceStatusMessage{
-		Code:     code,
-		Location: s.config.Location,
-		Services: statuses,
-		TS:       utils.NowRFC3339(),
+		Code:        code,
+		Location:    s.config.Location,
+		MessageMeta: s.nextMeta("telemetry.service"),
+		Services:    statuses,
+		TS:          utils.NowRFC3339(),
+	}
+	if s.config.Commands.IIS.Enabled {
+		// Unreadable app pools and sites are reported as Unknown
+		iis, err := s.executor.GetIISStatuses(&s.config.Commands.IIS)
+		if err != nil {
+			s.logger.Warn("Failed to get IIS statuses", zap.Error(err))
+		}
+		message.IIS = iis
 	}
 
 	data, err := json.Marshal(message)
@@ -374,7 +966,7 @@ func (s *Scheduler) publishServiceStatus(code string) {
 		return
 	}
 
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	if err := s.nats.PublishTelemetry(subject, message.MsgID(code, "telemetry.service", message.TS), data); err != nil {
 		s.logger.Error("Failed to queue service status publish", zap.Error(err))
 		return
 	}
@@ -387,25 +979,105 @@ func (s *Scheduler) publishServiceStatus(code string) {
 		zap.Int("count", len(statuses)))
 }
 
-// publishInventory collects and publishes system inventory
-func (s *Scheduler) publishInventory(code string) {
+// publishPlugin runs a plugin as a scheduled task and publishes its output.
+// ctx carries the task timeout.
+func (s *Scheduler) publishPlugin(ctx context.Context, code string, plugin config.PluginConfig, timeout time.Duration) {
 	select {
 	case <-s.ctx.Done():
 		return
 	default:
 	}
 
+	if s.taskPaused(tasks.PluginTaskPrefix + plugin.Name) {
+		return
+	}
+
+	suffix := "telemetry.plugin." + plugin.Name
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	output, err := s.executor.RunPlugin(ctx, plugin.Path, plugin.Args, &tasks.PluginRequest{
+		Mode:     "task",
+		Code:     code,
+		Location: s.config.Location,
+	}, timeout)
+	if err != nil {
+		s.logger.Error("Plugin run failed", zap.String("plugin", plugin.Name), zap.Error(err))
+
+		// Publish error message so control plane knows the plugin failed
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal plugin error message", zap.Error(marshalErr))
+			return
+		}
+
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue plugin error publish", zap.Error(err))
+		}
+		return
+	}
+
+	message := tasks.CreatePluginMessage(plugin.Name, output)
+	message.Code = code
+	message.Location = s.config.Location
+	message.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		s.logger.Error("Failed to marshal plugin output", zap.String("plugin", plugin.Name), zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, message.MsgID(code, suffix, message.TS), data); err != nil {
+		s.logger.Error("Failed to queue plugin publish", zap.String("plugin", plugin.Name), zap.Error(err))
+		return
+	}
+
+	s.logger.Debug("Queued plugin publish",
+		zap.String("plugin", plugin.Name),
+		zap.String("subject", subject),
+		zap.Int("bytes", len(data)))
+}
+
+// publishInventory collects and publishes system inventory
+func (s *Scheduler) publishInventory(ctx context.Context, code string) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskInventory) {
+		return
+	}
+
 	subject := fmt.Sprintf("%s.%s.telemetry.inventory", s.subjectPrefix, code)
 
-	inventory, err := s.executor.CollectInventory(s.version)
+	var inventory *tasks.Inventory
+	err := s.retryTask(ctx, tasks.TaskInventory, s.config.Tasks.Inventory.Retry, func() error {
+		var err error
+		inventory, err = s.executor.CollectInventory(s.build.Version)
+		return err
+	})
 	if err != nil {
 		s.logger.Error("Failed to collect inventory", zap.Error(err))
+		s.executor.RecordInventoryFailure()
 		return
 	}
+	if s.config.Tasks.Inventory.Neighbors {
+		s.executor.CollectNeighbors(ctx, &inventory.Network)
+	}
 
 	// Stamp identity so the message is self-describing
 	inventory.Code = code
 	inventory.Location = s.config.Location
+	inventory.Tags = s.config.Tags
+	inventory.Timezone, inventory.UTCOffset = tasks.LocalTimezone(time.Now())
+	inventory.Capabilities = s.executor.Capabilities()
+	inventory.MessageMeta = s.nextMeta("telemetry.inventory")
 
 	data, err := json.Marshal(inventory)
 	if err != nil {
@@ -413,7 +1085,11 @@ func (s *Scheduler) publishInventory(code string) {
 		return
 	}
 
-	if err := s.nats.PublishTelemetry(subject, data); err != nil {
+	publish := s.nats.PublishTelemetry
+	if s.config.NATS.Compression.Inventory {
+		publish = s.nats.PublishTelemetryCompressed
+	}
+	if err := publish(subject, inventory.MsgID(code, "telemetry.inventory", inventory.TS), data); err != nil {
 		s.logger.Error("Failed to queue inventory publish", zap.Error(err))
 		return
 	}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleUPS schedules the UPS/battery poll WITH PANIC RECOVERY, OVERRUN
+// GUARD AND CONTEXT CHECK. The poll publishes nothing unless the power
+// status changes, so it runs without tasks.jitter: jitter could exceed the
+// short interval and would only delay a power loss event. It also runs at
+// startup, so a site already on battery is reported at once.
+func (s *Scheduler) scheduleUPS() error {
+	if !s.config.UPS.Enabled {
+		return nil
+	}
+	interval := s.config.UPS.PollInterval
+
+	s.executor.RegisterPluginTask(tasks.TaskUPS)
+	_, err := s.scheduler.NewJob(
+		gocron.DurationJob(interval),
+		gocron.NewTask(s.guardTask(tasks.TaskUPS, interval, s.pollUPS)),
+		gocron.WithName(tasks.TaskUPS),
+		gocron.WithStartAt(gocron.WithStartImmediately()),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule ups poll: %w", err)
+	}
+	s.logger.Info("Scheduled ups poll",
+		zap.Strings("nut", s.config.UPS.NUT),
+		zap.Bool("battery", s.config.UPS.Battery),
+		zap.Duration("interval", interval))
+	return nil
+}
+
+// pollUPS reads every UPS and battery (kept by the executor for system
+// metrics) and raises events for power status changes
+func (s *Scheduler) pollUPS(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskUPS) {
+		return
+	}
+
+	for _, status := range s.executor.PollUPS(ctx, &s.config.UPS) {
+		s.checkPowerStatus(status)
+	}
+}
+
+// checkPowerStatus publishes a power_change event when a UPS or battery
+// changes power status. An unknown status (a failed read) is logged but
+// neither raises an event nor replaces the last known status. On the first
+// read only a UPS that is not online is reported.
+func (s *Scheduler) checkPowerStatus(status tasks.UPSStatus) {
+	if status.Status == tasks.UPSStatusUnknown {
+		s.logger.Warn("Failed to read ups status", zap.String("ups", status.Name), zap.String("error", status.Error))
+		return
+	}
+	previous, known := s.upsStates[status.Name]
+	s.upsStates[status.Name] = status.Status
+	if previous == status.Status || (!known && status.Status == tasks.UPSStatusOnline) {
+		return
+	}
+
+	severity := tasks.EventSeverityError
+	var message string
+	switch status.Status {
+	case tasks.UPSStatusOnline:
+		severity = tasks.EventSeverityInfo
+		message = fmt.Sprintf("Power restored: %s is online", status.Name)
+	case tasks.UPSStatusOnBattery:
+		message = fmt.Sprintf("Power lost: %s is on battery", status.Name)
+	default:
+		message = fmt.Sprintf("Battery low: %s is about to run out", status.Name)
+	}
+
+	details := map[string]string{
+		"ups":      status.Name,
+		"status":   status.Status,
+		"previous": previous,
+	}
+	if status.ChargePercent != nil {
+		details["charge_percent"] = strconv.FormatFloat(*status.ChargePercent, 'f', -1, 64)
+	}
+	if status.RuntimeSeconds != nil {
+		details["runtime_seconds"] = strconv.FormatInt(*status.RuntimeSeconds, 10)
+	}
+
+	s.logger.Warn("UPS power status changed",
+		zap.String("ups", status.Name),
+		zap.String("status", status.Status),
+		zap.String("previous", previous))
+	s.publishEvent(tasks.CreateEvent(tasks.EventPowerChange, severity, message, details))
+}
@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// taskMemoryWatchdog is the job name of the memory watchdog. It is not
+// pausable: it guards the agent itself.
+const taskMemoryWatchdog = "memory_watchdog"
+
+// SetMemoryLimitHandler sets the function called when the agent's RSS
+// crosses runtime.watchdog.rss_limit_mb with restart enabled
+func (s *Scheduler) SetMemoryLimitHandler(fn func()) {
+	s.onMemoryLimit = fn
+}
+
+// scheduleWatchdog schedules the memory watchdog WITH PANIC RECOVERY,
+// OVERRUN GUARD AND CONTEXT CHECK
+func (s *Scheduler) scheduleWatchdog() error {
+	w := s.config.Runtime.Watchdog
+	if w.RSSLimitMB == 0 {
+		return nil
+	}
+
+	s.running[taskMemoryWatchdog] = &atomic.Bool{}
+	_, err := s.scheduler.NewJob(
+		gocron.DurationJob(w.Interval),
+		gocron.NewTask(s.guardTask(taskMemoryWatchdog, w.Interval, func(context.Context) {
+			s.checkMemory()
+		})),
+		gocron.WithName(taskMemoryWatchdog),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule memory watchdog: %w", err)
+	}
+	s.logger.Info("Scheduled memory watchdog",
+		zap.Int("rss_limit_mb", w.RSSLimitMB),
+		zap.Duration("interval", w.Interval),
+		zap.Bool("restart", w.Restart))
+	return nil
+}
+
+// checkMemory compares the agent's RSS with the ceiling. The event is
+// published when the ceiling is crossed, not on every check above it.
+func (s *Scheduler) checkMemory() {
+	rss, err := tasks.AgentRSS()
+	if err != nil {
+		s.logger.Warn("Memory watchdog could not read RSS", zap.Error(err))
+		return
+	}
+	w := s.config.Runtime.Watchdog
+	rssMB := int(rss / 1024 / 1024)
+	if rssMB < w.RSSLimitMB {
+		if s.overMemory.CompareAndSwap(true, false) {
+			s.logger.Info("Agent memory back under the watchdog limit", zap.Int("rss_mb", rssMB))
+		}
+		return
+	}
+	if !s.overMemory.CompareAndSwap(false, true) {
+		return
+	}
+
+	s.logger.Error("Agent memory exceeds the watchdog limit",
+		zap.Int("rss_mb", rssMB),
+		zap.Int("rss_limit_mb", w.RSSLimitMB),
+		zap.Bool("restart", w.Restart))
+	s.publishEvent(tasks.CreateEvent(
+		tasks.EventMemoryLimit,
+		tasks.EventSeverityError,
+		fmt.Sprintf("Agent RSS %d MB exceeds the %d MB limit", rssMB, w.RSSLimitMB),
+		map[string]string{
+			"rss_mb":       strconv.Itoa(rssMB),
+			"rss_limit_mb": strconv.Itoa(w.RSSLimitMB),
+			"restart":      strconv.FormatBool(w.Restart),
+		},
+	))
+
+	if w.Restart && s.onMemoryLimit != nil {
+		s.onMemoryLimit()
+	}
+}
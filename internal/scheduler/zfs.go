@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-co-op/gocron/v2"
+	"github.com/stone-age-io/agent/internal/tasks"
+	"go.uber.org/zap"
+)
+
+// scheduleZFS schedules the ZFS pool health check WITH PANIC RECOVERY,
+// OVERRUN GUARD AND CONTEXT CHECK. It also runs once shortly after startup,
+// so a pool that degraded while the agent was down is reported promptly.
+func (s *Scheduler) scheduleZFS() error {
+	if !s.config.ZFS.Enabled {
+		return nil
+	}
+	code := s.config.Code
+	interval := s.config.ZFS.Interval
+	timeout := taskTimeout(s.config.ZFS.Timeout, interval)
+
+	startupCheck := s.guardTask(tasks.TaskZFS, timeout, func(ctx context.Context) {
+		s.publishZFS(ctx, code)
+	})
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-time.After(randomDelay(s.config.Tasks.Splay)):
+		}
+		startupCheck()
+	}()
+
+	s.executor.RegisterPluginTask(tasks.TaskZFS)
+	definition, options := s.jobSchedule(tasks.TaskZFS, interval)
+	_, err := s.scheduler.NewJob(
+		definition,
+		gocron.NewTask(s.guardTask(tasks.TaskZFS, timeout, func(ctx context.Context) {
+			s.publishZFS(ctx, code)
+		})),
+		options...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule zfs check: %w", err)
+	}
+	s.logger.Info("Scheduled zfs check",
+		zap.Bool("datasets", s.config.ZFS.Datasets),
+		zap.Duration("interval", interval),
+		zap.Duration("timeout", timeout),
+		zap.Duration("jitter", s.config.Tasks.Jitter))
+	return nil
+}
+
+// publishZFS reads pool health, publishes it and raises events for pools
+// whose health changed. A failed read is published as a telemetry error and
+// leaves the last known health alone.
+func (s *Scheduler) publishZFS(ctx context.Context, code string) {
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	if s.taskPaused(tasks.TaskZFS) {
+		return
+	}
+
+	suffix := "telemetry." + tasks.TaskZFS
+	subject := fmt.Sprintf("%s.%s.%s", s.subjectPrefix, code, suffix)
+
+	msg, err := s.executor.CollectZFS(ctx, s.config.ZFS.Datasets)
+	if err != nil {
+		s.logger.Error("Failed to read zfs pools", zap.Error(err))
+
+		errorMsg := tasks.CreateTelemetryError(err)
+		errorMsg.Code = code
+		errorMsg.Location = s.config.Location
+		errorMsg.MessageMeta = s.nextMeta(suffix)
+		data, marshalErr := json.Marshal(errorMsg)
+		if marshalErr != nil {
+			s.logger.Error("Failed to marshal zfs error message", zap.Error(marshalErr))
+			return
+		}
+		if err := s.nats.PublishTelemetry(subject, errorMsg.MsgID(code, suffix, errorMsg.TS), data); err != nil {
+			s.logger.Error("Failed to queue zfs error publish", zap.Error(err))
+		}
+		return
+	}
+
+	msg.Code = code
+	msg.Location = s.config.Location
+	msg.MessageMeta = s.nextMeta(suffix)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("Failed to marshal zfs message", zap.Error(err))
+		return
+	}
+
+	if err := s.nats.PublishTelemetry(subject, msg.MsgID(code, suffix, msg.TS), data); err != nil {
+		s.logger.Error("Failed to queue zfs publish", zap.Error(err))
+	} else {
+		s.logger.Debug("Queued zfs publish",
+			zap.String("subject", subject),
+			zap.Int("pools", len(msg.Pools)))
+	}
+
+	s.checkZFSHealth(msg.Pools)
+}
+
+// checkZFSHealth publishes a zfs_pool_health event for each pool whose
+// health changed since the last check, and for pools no longer imported.
+// On the first check only pools that are not ONLINE are reported.
+func (s *Scheduler) checkZFSHealth(pools []tasks.ZFSPool) {
+	seen := make(map[string]bool, len(pools))
+	for _, pool := range pools {
+		seen[pool.Name] = true
+		previous, known := s.zfsHealth[pool.Name]
+		s.zfsHealth[pool.Name] = pool.Health
+		if previous == pool.Health || (!known && pool.Health == tasks.ZFSHealthOnline) {
+			continue
+		}
+
+		severity := tasks.EventSeverityError
+		message := fmt.Sprintf("ZFS pool %s is %s", pool.Name, pool.Health)
+		switch pool.Health {
+		case tasks.ZFSHealthOnline:
+			severity = tasks.EventSeverityInfo
+			message = fmt.Sprintf("ZFS pool %s is ONLINE again", pool.Name)
+		case "DEGRADED":
+			// Still serving data, but without its full redundancy
+			severity = tasks.EventSeverityWarning
+		}
+		s.logger.Warn("ZFS pool health changed",
+			zap.String("pool", pool.Name),
+			zap.String("health", pool.Health),
+			zap.String("previous", previous))
+		s.publishEvent(tasks.CreateEvent(tasks.EventZFSPoolHealth, severity, message, map[string]string{
+			"pool":     pool.Name,
+			"health":   pool.Health,
+			"previous": previous,
+		}))
+	}
+
+	for name, previous := range s.zfsHealth {
+		if seen[name] {
+			continue
+		}
+		delete(s.zfsHealth, name)
+		s.logger.Warn("ZFS pool no longer imported", zap.String("pool", name))
+		s.publishEvent(tasks.CreateEvent(tasks.EventZFSPoolHealth, tasks.EventSeverityError,
+			fmt.Sprintf("ZFS pool %s is no longer imported", name), map[string]string{
+				"pool":     name,
+				"health":   "MISSING",
+				"previous": previous,
+			}))
+	}
+}
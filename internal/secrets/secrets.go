@@ -0,0 +1,154 @@
+// Package secrets stores credential files (NATS .creds, nkey seeds) either as
+// plaintext or protected at rest: DPAPI on Windows, or AES-256-GCM with a
+// root-only key file on Linux/FreeBSD. Protected files carry a magic header,
+// so reads are transparent and an existing plaintext file keeps working
+// until it is re-protected.
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Storage modes, matching nats.auth.secret_store
+const (
+	StoreFile      = "file"      // Plaintext with 0600 permissions (default)
+	StoreDPAPI     = "dpapi"     // Windows Data Protection API, bound to the service account
+	StoreEncrypted = "encrypted" // AES-256-GCM, key in a root-only key file (Linux/FreeBSD)
+)
+
+// Magic headers identifying protected files
+var (
+	dpapiMagic     = []byte("AGENT-DPAPI-1\n")
+	encryptedMagic = []byte("AGENT-AES256GCM-1\n")
+)
+
+// Options configures protected storage
+type Options struct {
+	Store   string // One of the Store* constants ("" = file)
+	KeyFile string // Key file for StoreEncrypted
+}
+
+// Protected reports whether the options select a protected store
+func (o Options) Protected() bool {
+	return o.Store != "" && o.Store != StoreFile
+}
+
+// Read returns the plaintext content of a credential file, decrypting it if
+// it carries a protected header. Plaintext files are returned as-is.
+func Read(path string, opts Options) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(data, dpapiMagic):
+		plain, err := unprotectDPAPI(data[len(dpapiMagic):])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s with DPAPI: %w", path, err)
+		}
+		return plain, nil
+	case bytes.HasPrefix(data, encryptedMagic):
+		plain, err := decrypt(data[len(encryptedMagic):], opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+		return plain, nil
+	default:
+		return data, nil
+	}
+}
+
+// Write stores content at path using the configured store. The write is
+// atomic (temp file + rename) with 0600 permissions.
+func Write(path string, content []byte, opts Options) error {
+	data := content
+	switch opts.Store {
+	case "", StoreFile:
+	case StoreDPAPI:
+		blob, err := protectDPAPI(content)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt with DPAPI: %w", err)
+		}
+		data = append(append([]byte{}, dpapiMagic...), blob...)
+	case StoreEncrypted:
+		blob, err := encrypt(content, opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt: %w", err)
+		}
+		data = append(append([]byte{}, encryptedMagic...), blob...)
+	default:
+		return fmt.Errorf("unknown secret store: %s", opts.Store)
+	}
+
+	return WriteFileAtomic(path, data)
+}
+
+// IsProtected reports whether the file at path carries a protected header
+func IsProtected(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.HasPrefix(data, dpapiMagic) || bytes.HasPrefix(data, encryptedMagic), nil
+}
+
+// Protect re-writes a plaintext credential file with the configured store.
+// No-op if the store is plaintext or the file is already protected.
+func Protect(path string, opts Options) (bool, error) {
+	if !opts.Protected() {
+		return false, nil
+	}
+	protected, err := IsProtected(path)
+	if err != nil || protected {
+		return false, err
+	}
+
+	plain, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	if err := Write(path, plain, opts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WriteFileAtomic writes data to a temp file in the same directory and
+// renames it into place, creating parent directories if needed, so readers
+// never see a partial file. The file is created with 0600 permissions.
+func WriteFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	// CreateTemp uses 0600 (owner read/write only)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) //nolint:errcheck // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	return nil
+}
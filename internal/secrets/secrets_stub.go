@@ -0,0 +1,22 @@
+//go:build !windows && !linux && !freebsd
+
+package secrets
+
+import "fmt"
+
+// Protected stores are not supported on this platform
+func encrypt(data []byte, keyFile string) ([]byte, error) {
+	return nil, fmt.Errorf("encrypted store not supported on this platform")
+}
+
+func decrypt(blob []byte, keyFile string) ([]byte, error) {
+	return nil, fmt.Errorf("encrypted store not supported on this platform")
+}
+
+func protectDPAPI(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi store is only supported on Windows")
+}
+
+func unprotectDPAPI(blob []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi store is only supported on Windows")
+}
@@ -0,0 +1,104 @@
+//go:build linux || freebsd
+
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+const keySize = 32 // AES-256
+
+// encrypt seals data with AES-256-GCM using the key in keyFile, creating the
+// key file (0400, owned by the agent user — root) on first use
+func encrypt(data []byte, keyFile string) ([]byte, error) {
+	key, err := loadOrCreateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// decrypt opens a blob produced by encrypt
+func decrypt(blob []byte, keyFile string) ([]byte, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(blob) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := blob[:gcm.NonceSize()], blob[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed (wrong key file or corrupted data)")
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key file must contain exactly %d bytes (got %d)", keySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// loadOrCreateKey reads the key file, generating a random key if it does not exist
+func loadOrCreateKey(keyFile string) ([]byte, error) {
+	if keyFile == "" {
+		return nil, fmt.Errorf("secret_key_file is required for the encrypted store")
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key = make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	if err := WriteFileAtomic(keyFile, key); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Chmod(keyFile, 0400); err != nil {
+		return nil, fmt.Errorf("failed to restrict key file: %w", err)
+	}
+	return key, nil
+}
+
+// protectDPAPI is not available outside Windows
+func protectDPAPI(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi store is only supported on Windows")
+}
+
+// unprotectDPAPI is not available outside Windows
+func unprotectDPAPI(blob []byte) ([]byte, error) {
+	return nil, fmt.Errorf("dpapi store is only supported on Windows")
+}
@@ -0,0 +1,111 @@
+//go:build linux || freebsd
+
+package secrets
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func encryptedOptions(t *testing.T) (string, Options) {
+	t.Helper()
+	dir := t.TempDir()
+	return dir, Options{Store: StoreEncrypted, KeyFile: filepath.Join(dir, "secrets.key")}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	dir, opts := encryptedOptions(t)
+	path := filepath.Join(dir, "device.creds")
+	content := []byte("-----BEGIN NATS USER JWT-----\nabc\n------END NATS USER JWT------\n")
+
+	if err := Write(path, content, opts); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("NATS USER JWT")) {
+		t.Error("file on disk contains plaintext credentials")
+	}
+	if protected, _ := IsProtected(path); !protected {
+		t.Error("IsProtected() = false, want true")
+	}
+
+	got, err := Read(path, opts)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Read() = %q, want %q", got, content)
+	}
+
+	info, err := os.Stat(opts.KeyFile)
+	if err != nil {
+		t.Fatalf("key file not created: %v", err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("key file mode = %v, want no group/other access", info.Mode().Perm())
+	}
+}
+
+func TestReadPlaintextPassthrough(t *testing.T) {
+	dir, opts := encryptedOptions(t)
+	path := filepath.Join(dir, "device.creds")
+	content := []byte("plain creds")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Read(path, opts)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Read() = %q, want %q", got, content)
+	}
+}
+
+func TestProtectMigratesPlaintext(t *testing.T) {
+	dir, opts := encryptedOptions(t)
+	path := filepath.Join(dir, "device.creds")
+	content := []byte("plain creds")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := Protect(path, opts)
+	if err != nil || !migrated {
+		t.Fatalf("Protect() = %v, %v; want true, nil", migrated, err)
+	}
+	if protected, _ := IsProtected(path); !protected {
+		t.Error("file not protected after Protect()")
+	}
+
+	// Already protected: no-op
+	migrated, err = Protect(path, opts)
+	if err != nil || migrated {
+		t.Fatalf("second Protect() = %v, %v; want false, nil", migrated, err)
+	}
+
+	got, err := Read(path, opts)
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Read() = %q, %v; want %q", got, err, content)
+	}
+}
+
+func TestReadWrongKeyFails(t *testing.T) {
+	dir, opts := encryptedOptions(t)
+	path := filepath.Join(dir, "device.creds")
+	if err := Write(path, []byte("secret"), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	other := Options{Store: StoreEncrypted, KeyFile: filepath.Join(dir, "other.key")}
+	if _, err := Read(path, other); err == nil {
+		t.Error("Read() with a different key succeeded, want error")
+	}
+}
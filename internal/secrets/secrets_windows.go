@@ -0,0 +1,52 @@
+//go:build windows
+
+package secrets
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// protectDPAPI encrypts data with DPAPI in the calling user's scope. The
+// agent service runs as LocalSystem, so only processes running as SYSTEM on
+// this machine can decrypt — copying the file elsewhere yields nothing.
+func protectDPAPI(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("nothing to encrypt")
+	}
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data))) //nolint:errcheck
+
+	return append([]byte{}, unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// unprotectDPAPI decrypts a DPAPI blob
+func unprotectDPAPI(blob []byte) ([]byte, error) {
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("empty DPAPI blob")
+	}
+	in := windows.DataBlob{Size: uint32(len(blob)), Data: &blob[0]}
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(out.Data))) //nolint:errcheck
+
+	return append([]byte{}, unsafe.Slice(out.Data, out.Size)...), nil
+}
+
+// encrypt is not used on Windows: DPAPI is the protected store there
+func encrypt(data []byte, keyFile string) ([]byte, error) {
+	return nil, fmt.Errorf("encrypted store not supported on Windows (use dpapi)")
+}
+
+// decrypt is not used on Windows: DPAPI is the protected store there
+func decrypt(blob []byte, keyFile string) ([]byte, error) {
+	return nil, fmt.Errorf("encrypted store not supported on Windows (use dpapi)")
+}
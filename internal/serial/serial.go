@@ -0,0 +1,124 @@
+// Package serial opens RS-232/RS-485 ports in raw mode, for the Modbus RTU
+// transport and the cmd.serial passthrough.
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// Open opens and configures a port; unset settings default to 9600 8N1.
+// Reads return io.EOF once timeout passes without data.
+func Open(cfg config.SerialConfig, timeout time.Duration) (io.ReadWriteCloser, error) {
+	cfg = Defaults(cfg)
+	port, err := open(cfg, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", cfg.Device, err)
+	}
+	return port, nil
+}
+
+// Defaults fills unset serial settings with 9600 8N1
+func Defaults(cfg config.SerialConfig) config.SerialConfig {
+	if cfg.BaudRate == 0 {
+		cfg.BaudRate = 9600
+	}
+	if cfg.DataBits == 0 {
+		cfg.DataBits = 8
+	}
+	if cfg.Parity == "" {
+		cfg.Parity = "none"
+	}
+	if cfg.StopBits == 0 {
+		cfg.StopBits = 1
+	}
+	return cfg
+}
+
+// A port may be shared by several Modbus devices on one bus and by serial
+// commands, so their exchanges must not interleave
+var locks sync.Map // device path -> *sync.Mutex
+
+// Lock takes exclusive use of a port until the returned func is called
+func Lock(device string) func() {
+	lock, _ := locks.LoadOrStore(device, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	return lock.(*sync.Mutex).Unlock
+}
+
+// PollInterval is the read timeout to open a port with for Exchange: how
+// often it checks the deadline and idle time while no data arrives
+const PollInterval = 100 * time.Millisecond
+
+// Framing says when a response is complete. With no delimiter, length or
+// idle gap, everything received until the timeout is the response.
+type Framing struct {
+	Delimiter []byte        // Ends with this sequence
+	Length    int           // Has this many bytes
+	Idle      time.Duration // Nothing more arrived for this long
+	MaxBytes  int           // Stop reading at this size (0 = no limit)
+}
+
+// complete reports whether resp is a full response
+func (f Framing) complete(resp []byte) bool {
+	if len(f.Delimiter) > 0 && bytes.HasSuffix(resp, f.Delimiter) {
+		return true
+	}
+	if f.Length > 0 && len(resp) >= f.Length {
+		return true
+	}
+	return f.MaxBytes > 0 && len(resp) >= f.MaxBytes
+}
+
+// Exchange writes data (if any) to port and reads the response until the
+// framing is satisfied or timeout passes. It returns what was received and
+// whether the timeout cut the response short. port must be opened with
+// PollInterval as its read timeout.
+func Exchange(port io.ReadWriter, data []byte, framing Framing, timeout time.Duration) ([]byte, bool, error) {
+	deadline := time.Now().Add(timeout)
+	if len(data) > 0 {
+		if _, err := port.Write(data); err != nil {
+			return nil, false, fmt.Errorf("failed to write: %w", err)
+		}
+	}
+
+	framed := len(framing.Delimiter) > 0 || framing.Length > 0 || framing.Idle > 0
+	var resp []byte
+	buf := make([]byte, 1024)
+	lastData := time.Now()
+	for time.Now().Before(deadline) {
+		n, err := port.Read(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return resp, false, fmt.Errorf("failed to read: %w", err)
+		}
+		if n == 0 {
+			if framing.Idle > 0 && len(resp) > 0 && time.Since(lastData) >= framing.Idle {
+				return resp, false, nil
+			}
+			continue
+		}
+
+		lastData = time.Now()
+		chunk := buf[:n]
+		if framing.Length > 0 && len(resp)+n > framing.Length {
+			chunk = chunk[:framing.Length-len(resp)]
+		}
+		if framing.MaxBytes > 0 && len(resp)+len(chunk) > framing.MaxBytes {
+			chunk = chunk[:framing.MaxBytes-len(resp)]
+		}
+		// Check each byte so nothing past the delimiter is kept
+		for i := range chunk {
+			resp = append(resp, chunk[i])
+			if framing.complete(resp) {
+				return resp, false, nil
+			}
+		}
+	}
+	return resp, framed, nil
+}
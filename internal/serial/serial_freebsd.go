@@ -0,0 +1,38 @@
+//go:build freebsd
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// open opens a serial port (use the /dev/cuaU* callout device) in raw
+// mode. Reads return io.EOF after timeout (VTIME) without data.
+func open(cfg config.SerialConfig, timeout time.Duration) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(cfg.Device, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// FreeBSD takes the baud rate itself as the speed
+	t := unix.Termios{
+		Cflag:  unix.CREAD | unix.CLOCAL,
+		Ispeed: uint32(cfg.BaudRate),
+		Ospeed: uint32(cfg.BaudRate),
+	}
+	t.Cflag |= termiosFlags(cfg, unix.CS7, unix.CS8, unix.PARENB, unix.PARODD, unix.CSTOPB)
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = vtime(timeout)
+
+	if err := unix.IoctlSetTermios(int(f.Fd()), unix.TIOCSETA, &t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure serial port: %w", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,54 @@
+//go:build linux
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// baudRates maps supported baud rates to their termios constants
+var baudRates = map[int]uint32{
+	1200:   unix.B1200,
+	2400:   unix.B2400,
+	4800:   unix.B4800,
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+}
+
+// open opens a serial port in raw mode. Reads return io.EOF after timeout
+// (VTIME) without data.
+func open(cfg config.SerialConfig, timeout time.Duration) (io.ReadWriteCloser, error) {
+	speed, ok := baudRates[cfg.BaudRate]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", cfg.BaudRate)
+	}
+
+	f, err := os.OpenFile(cfg.Device, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	t := unix.Termios{
+		Cflag:  unix.CREAD | unix.CLOCAL | speed,
+		Ispeed: speed,
+		Ospeed: speed,
+	}
+	t.Cflag |= termiosFlags(cfg, unix.CS7, unix.CS8, unix.PARENB, unix.PARODD, unix.CSTOPB)
+	t.Cc[unix.VMIN] = 0
+	t.Cc[unix.VTIME] = vtime(timeout)
+
+	if err := unix.IoctlSetTermios(int(f.Fd()), unix.TCSETS, &t); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to configure serial port: %w", err)
+	}
+	return f, nil
+}
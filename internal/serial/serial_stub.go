@@ -0,0 +1,15 @@
+//go:build !windows && !linux && !freebsd
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func open(cfg config.SerialConfig, timeout time.Duration) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("serial ports are not supported on this platform")
+}
@@ -0,0 +1,72 @@
+package serial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// fakePort replays chunks, one per read, then reads nothing like an idle
+// line after its read timeout
+type fakePort struct {
+	written bytes.Buffer
+	chunks  [][]byte
+}
+
+func (p *fakePort) Write(b []byte) (int, error) { return p.written.Write(b) }
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	if len(p.chunks) == 0 {
+		time.Sleep(5 * time.Millisecond)
+		return 0, io.EOF
+	}
+	n := copy(b, p.chunks[0])
+	p.chunks = p.chunks[1:]
+	return n, nil
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunks       []string
+		framing      Framing
+		want         string
+		wantTimedOut bool
+	}{
+		{"delimiter", []string{"OK 2", "1.5\r\nextra"}, Framing{Delimiter: []byte("\r\n")}, "OK 21.5\r\n", false},
+		{"length", []string{"\x01\x03", "\x02\x00\x64\xB9\xAF"}, Framing{Length: 4}, "\x01\x03\x02\x00", false},
+		{"idle", []string{"a", "b"}, Framing{Idle: 20 * time.Millisecond}, "ab", false},
+		{"max bytes", []string{"abcdef"}, Framing{MaxBytes: 3}, "abc", false},
+		{"delimiter never seen", []string{"partial"}, Framing{Delimiter: []byte("\n")}, "partial", true},
+		{"no framing reads until timeout", []string{"x", "y"}, Framing{}, "xy", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &fakePort{}
+			for _, c := range tt.chunks {
+				port.chunks = append(port.chunks, []byte(c))
+			}
+			got, timedOut, err := Exchange(port, []byte("READ?\r\n"), tt.framing, 100*time.Millisecond)
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if string(got) != tt.want || timedOut != tt.wantTimedOut {
+				t.Errorf("Exchange() = %q, timed out %v, want %q, %v", got, timedOut, tt.want, tt.wantTimedOut)
+			}
+			if port.written.String() != "READ?\r\n" {
+				t.Errorf("written = %q", port.written.String())
+			}
+		})
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	cfg := Defaults(config.SerialConfig{Device: "COM3", Parity: "even"})
+	if cfg.BaudRate != 9600 || cfg.DataBits != 8 || cfg.Parity != "even" || cfg.StopBits != 1 {
+		t.Errorf("Defaults() = %+v", cfg)
+	}
+}
@@ -0,0 +1,40 @@
+//go:build linux || freebsd
+
+package serial
+
+import (
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// termiosFlags returns the character size, parity and stop bit flags for
+// cfg, given the platform's flag values
+func termiosFlags(cfg config.SerialConfig, cs7, cs8, parenb, parodd, cstopb uint32) uint32 {
+	flags := cs8
+	if cfg.DataBits == 7 {
+		flags = cs7
+	}
+	switch cfg.Parity {
+	case "even":
+		flags |= parenb
+	case "odd":
+		flags |= parenb | parodd
+	}
+	if cfg.StopBits == 2 {
+		flags |= cstopb
+	}
+	return flags
+}
+
+// vtime converts a timeout to VTIME deciseconds (1-255)
+func vtime(timeout time.Duration) uint8 {
+	ds := timeout / (100 * time.Millisecond)
+	if ds < 1 {
+		return 1
+	}
+	if ds > 255 {
+		return 255
+	}
+	return uint8(ds)
+}
@@ -0,0 +1,73 @@
+//go:build windows
+
+package serial
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"golang.org/x/sys/windows"
+)
+
+// DCB flags
+const (
+	dcbBinary = 0x0001
+	dcbParity = 0x0002
+)
+
+// open opens a COM port. Reads return io.EOF after timeout without data.
+func open(cfg config.SerialConfig, timeout time.Duration) (io.ReadWriteCloser, error) {
+	// COM10 and above are only reachable through the device namespace
+	path := cfg.Device
+	if !strings.HasPrefix(path, `\\.\`) {
+		path = `\\.\` + path
+	}
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(name, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	dcb := windows.DCB{
+		BaudRate: uint32(cfg.BaudRate),
+		Flags:    dcbBinary,
+		ByteSize: uint8(cfg.DataBits),
+		Parity:   windows.NOPARITY,
+		StopBits: windows.ONESTOPBIT,
+	}
+	dcb.DCBlength = uint32(unsafe.Sizeof(dcb))
+	switch cfg.Parity {
+	case "even":
+		dcb.Parity = windows.EVENPARITY
+		dcb.Flags |= dcbParity
+	case "odd":
+		dcb.Parity = windows.ODDPARITY
+		dcb.Flags |= dcbParity
+	}
+	if cfg.StopBits == 2 {
+		dcb.StopBits = windows.TWOSTOPBITS
+	}
+	if err := windows.SetCommState(h, &dcb); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to configure serial port: %w", err)
+	}
+
+	ms := uint32(timeout / time.Millisecond)
+	if err := windows.SetCommTimeouts(h, &windows.CommTimeouts{
+		ReadTotalTimeoutConstant:  ms,
+		WriteTotalTimeoutConstant: ms,
+	}); err != nil {
+		windows.CloseHandle(h)
+		return nil, fmt.Errorf("failed to set serial port timeouts: %w", err)
+	}
+
+	return os.NewFile(uintptr(h), cfg.Device), nil
+}
@@ -0,0 +1,183 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/secrets"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// availabilityHistory is how much up/down history is kept per service: the
+// longest window reported
+const availabilityHistory = 7 * 24 * time.Hour
+
+// ServiceAvailability is a service's share of observed time spent Running
+// over rolling windows. Time the agent wasn't checking (stopped, or the
+// check failed) is left out rather than counted as down.
+type ServiceAvailability struct {
+	Percent24h float64 `json:"percent_24h"`
+	Percent7d  float64 `json:"percent_7d"`
+	Outages24h int     `json:"outages_24h"` // Running to not running transitions
+	Outages7d  int     `json:"outages_7d"`
+	Since      string  `json:"since"` // Oldest observation in the 7d window
+}
+
+// AvailabilityTracker records each service's up/down history as segments
+// of observed time, from which availability is computed
+type AvailabilityTracker struct {
+	mu       sync.Mutex
+	maxGap   time.Duration // Longer between checks is unobserved time
+	services map[string][]uptimeSegment
+}
+
+// uptimeSegment is a stretch of consecutive checks with the same state
+type uptimeSegment struct {
+	Start int64 `json:"start"` // Unix seconds
+	End   int64 `json:"end"`
+	Up    bool  `json:"up"`
+}
+
+// NewAvailabilityTracker returns an empty tracker for checks every
+// interval. A gap of more than three intervals between checks is treated
+// as unobserved.
+func NewAvailabilityTracker(interval time.Duration) *AvailabilityTracker {
+	return &AvailabilityTracker{
+		maxGap:   3 * interval,
+		services: make(map[string][]uptimeSegment),
+	}
+}
+
+// Record adds a service check at now. A service is up while Running; an
+// Unknown status adds nothing. Services no longer checked are dropped.
+func (a *AvailabilityTracker) Record(now time.Time, statuses []ServiceStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	t := now.Unix()
+	checked := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		checked[status.Name] = true
+		if status.Status == ServiceStatusUnknown {
+			continue
+		}
+		up := status.Status == ServiceStatusRunning
+
+		segments := a.services[status.Name]
+		n := len(segments)
+		switch {
+		case n > 0 && time.Duration(t-segments[n-1].End)*time.Second <= a.maxGap && segments[n-1].Up == up:
+			segments[n-1].End = t
+		case n > 0 && time.Duration(t-segments[n-1].End)*time.Second <= a.maxGap:
+			// The state changed some time since the last check; the new
+			// state is charged from then
+			segments = append(segments, uptimeSegment{Start: segments[n-1].End, End: t, Up: up})
+		default:
+			segments = append(segments, uptimeSegment{Start: t, End: t, Up: up})
+		}
+
+		cutoff := t - int64(availabilityHistory/time.Second)
+		i := 0
+		for i < len(segments) && segments[i].End < cutoff {
+			i++
+		}
+		a.services[status.Name] = segments[i:]
+	}
+
+	for name := range a.services {
+		if !checked[name] {
+			delete(a.services, name)
+		}
+	}
+}
+
+// Availability returns the service's availability at now, or nil before
+// any time has been observed
+func (a *AvailabilityTracker) Availability(name string, now time.Time) *ServiceAvailability {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	segments := a.services[name]
+	t := now.Unix()
+	percent7d, observed7d := uptimePercent(segments, t-int64(availabilityHistory/time.Second), t)
+	if observed7d == 0 {
+		return nil
+	}
+	percent24h, _ := uptimePercent(segments, t-int64(24*time.Hour/time.Second), t)
+
+	return &ServiceAvailability{
+		Percent24h: percent24h,
+		Percent7d:  percent7d,
+		Outages24h: outages(segments, t-int64(24*time.Hour/time.Second)),
+		Outages7d:  outages(segments, t-int64(availabilityHistory/time.Second)),
+		Since:      time.Unix(max(segments[0].Start, t-int64(availabilityHistory/time.Second)), 0).UTC().Format(time.RFC3339),
+	}
+}
+
+// uptimePercent returns the percentage of observed time in [from, to] that
+// was up, and the observed seconds
+func uptimePercent(segments []uptimeSegment, from, to int64) (float64, int64) {
+	var up, observed int64
+	for _, s := range segments {
+		overlap := min(s.End, to) - max(s.Start, from)
+		if overlap <= 0 {
+			continue
+		}
+		observed += overlap
+		if s.Up {
+			up += overlap
+		}
+	}
+	if observed == 0 {
+		return 100, 0
+	}
+	return utils.Round(float64(up) / float64(observed) * 100), observed
+}
+
+// outages counts the down segments that started at or after from directly
+// after an up one
+func outages(segments []uptimeSegment, from int64) int {
+	count := 0
+	for i := 1; i < len(segments); i++ {
+		s, prev := segments[i], segments[i-1]
+		if !s.Up && prev.Up && s.Start == prev.End && s.Start >= from {
+			count++
+		}
+	}
+	return count
+}
+
+// Save writes the history to path
+func (a *AvailabilityTracker) Save(path string) error {
+	a.mu.Lock()
+	data, err := json.Marshal(a.services)
+	a.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return secrets.WriteFileAtomic(path, data)
+}
+
+// Load restores history written by Save. A missing file is not an error.
+func (a *AvailabilityTracker) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read service availability: %w", err)
+	}
+
+	services := make(map[string][]uptimeSegment)
+	if err := json.Unmarshal(data, &services); err != nil {
+		return fmt.Errorf("invalid service availability: %w", err)
+	}
+	a.mu.Lock()
+	a.services = services
+	a.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestAvailabilityTracker tests that downtime is charged from the last up
+// check, gaps in checking are left out, and outages are counted
+func TestAvailabilityTracker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewAvailabilityTracker(time.Minute)
+	check := func(minute int, status string) {
+		tracker.Record(start.Add(time.Duration(minute)*time.Minute), []ServiceStatus{{Name: "web", Status: status}})
+	}
+
+	if got := tracker.Availability("web", start); got != nil {
+		t.Fatalf("Availability() before any checks = %+v, want nil", got)
+	}
+
+	// Up for 30 minutes, down for 10, up again for 20
+	for m := 0; m <= 30; m++ {
+		check(m, ServiceStatusRunning)
+	}
+	for m := 31; m <= 40; m++ {
+		check(m, ServiceStatusStopped)
+	}
+	check(41, ServiceStatusUnknown)
+	for m := 42; m <= 60; m++ {
+		check(m, ServiceStatusRunning)
+	}
+	// An hour unchecked isn't counted either way
+	check(120, ServiceStatusRunning)
+	check(121, ServiceStatusRunning)
+
+	got := tracker.Availability("web", start.Add(121*time.Minute))
+	if got == nil {
+		t.Fatal("Availability() = nil, want a result")
+	}
+	// 61 observed minutes, 10 of them down
+	if want := 83.61; got.Percent24h != want || got.Percent7d != want {
+		t.Errorf("Percent24h, Percent7d = %v, %v, want %v", got.Percent24h, got.Percent7d, want)
+	}
+	if got.Outages24h != 1 || got.Outages7d != 1 {
+		t.Errorf("Outages24h, Outages7d = %d, %d, want 1", got.Outages24h, got.Outages7d)
+	}
+	if want := start.Format(time.RFC3339); got.Since != want {
+		t.Errorf("Since = %q, want %q", got.Since, want)
+	}
+
+	// Past 24h the outage only counts toward 7d
+	later := start.Add(25 * time.Hour)
+	tracker.Record(later, []ServiceStatus{{Name: "web", Status: ServiceStatusRunning}})
+	got = tracker.Availability("web", later)
+	if got.Outages24h != 0 || got.Outages7d != 1 {
+		t.Errorf("after 25h Outages24h, Outages7d = %d, %d, want 0, 1", got.Outages24h, got.Outages7d)
+	}
+
+	path := filepath.Join(t.TempDir(), "availability.json")
+	if err := tracker.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	restored := NewAvailabilityTracker(time.Minute)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if again := restored.Availability("web", later); *again != *got {
+		t.Errorf("restored Availability() = %+v, want %+v", again, got)
+	}
+
+	// Services no longer checked are dropped
+	tracker.Record(later, []ServiceStatus{{Name: "db", Status: ServiceStatusRunning}})
+	if got := tracker.Availability("web", later); got != nil {
+		t.Errorf("Availability() of an unchecked service = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package tasks
+
+// readBattery is Windows only
+func readBattery() (UPSStatus, error) {
+	return UPSStatus{}, errBatteryUnsupported
+}
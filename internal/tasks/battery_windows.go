@@ -0,0 +1,31 @@
+//go:build windows
+
+package tasks
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var getSystemPowerStatus = syscall.NewLazyDLL("kernel32.dll").NewProc("GetSystemPowerStatus")
+
+// systemPowerStatus is SYSTEM_POWER_STATUS
+type systemPowerStatus struct {
+	acLineStatus        byte
+	batteryFlag         byte
+	batteryLifePercent  byte
+	systemStatusFlag    byte
+	batteryLifeTime     uint32
+	batteryFullLifeTime uint32
+}
+
+// readBattery reads the system battery, which includes UPSes attached as
+// USB HID power devices
+func readBattery() (UPSStatus, error) {
+	var s systemPowerStatus
+	if ret, _, err := getSystemPowerStatus.Call(uintptr(unsafe.Pointer(&s))); ret == 0 {
+		return UPSStatus{}, fmt.Errorf("GetSystemPowerStatus failed: %w", err)
+	}
+	return batteryStatus(s.acLineStatus, s.batteryFlag, s.batteryLifePercent, s.batteryLifeTime)
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// sysDevBlock links each block device's major:minor to its sysfs node,
+// whose name is the one /proc/diskstats (and so disk.IOCounters) uses
+const sysDevBlock = "/sys/dev/block"
+
+// blockDevice returns the kernel name of the block device mounted at
+// mountpoint, the key of its I/O counters. Partition.Device is often a
+// name diskstats doesn't use: /dev/mapper/vg-root for LVM and dm-crypt
+// (dm-0), /dev/root, or a /dev/disk/by-uuid link.
+func blockDevice(device, mountpoint string) string {
+	var st unix.Stat_t
+	if err := unix.Stat(mountpoint, &st); err == nil {
+		if name := sysfsBlockName(sysDevBlock, unix.Major(st.Dev), unix.Minor(st.Dev)); name != "" {
+			return name
+		}
+	}
+	// btrfs and other filesystems report an anonymous device number;
+	// follow the device path's symlinks instead (/dev/mapper/* -> /dev/dm-*)
+	return devicePathName(device, filepath.EvalSymlinks)
+}
+
+// sysfsBlockName returns the kernel name of device major:minor from sysfs,
+// or "" when it isn't a block device
+func sysfsBlockName(root string, major, minor uint32) string {
+	target, err := os.Readlink(filepath.Join(root, fmt.Sprintf("%d:%d", major, minor)))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// devicePathName returns the device name of a /dev path after resolving
+// symlinks, e.g. "dm-0" for /dev/mapper/vg-root
+func devicePathName(device string, evalSymlinks func(string) (string, error)) string {
+	if resolved, err := evalSymlinks(device); err == nil && strings.HasPrefix(resolved, "/dev/") {
+		device = resolved
+	}
+	return strings.TrimPrefix(device, "/dev/")
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSysfsBlockName tests resolving major:minor to the diskstats name
+func TestSysfsBlockName(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink("../../devices/virtual/block/dm-0", filepath.Join(root, "253:0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sysfsBlockName(root, 253, 0); got != "dm-0" {
+		t.Errorf("sysfsBlockName(253:0) = %q, want dm-0", got)
+	}
+	if got := sysfsBlockName(root, 0, 42); got != "" {
+		t.Errorf("sysfsBlockName(0:42) = %q, want empty for an anonymous device", got)
+	}
+}
+
+// TestDevicePathName tests the symlink fallback for mapper and by-uuid paths
+func TestDevicePathName(t *testing.T) {
+	links := map[string]string{
+		"/dev/mapper/vg-root":   "/dev/dm-0",
+		"/dev/disk/by-uuid/abc": "/dev/nvme0n1p2",
+	}
+	eval := func(path string) (string, error) {
+		if target, ok := links[path]; ok {
+			return target, nil
+		}
+		return "", errors.New("no such file")
+	}
+
+	tests := map[string]string{
+		"/dev/mapper/vg-root":   "dm-0",
+		"/dev/disk/by-uuid/abc": "nvme0n1p2",
+		"/dev/sda1":             "sda1",
+	}
+	for device, want := range tests {
+		if got := devicePathName(device, eval); got != want {
+			t.Errorf("devicePathName(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
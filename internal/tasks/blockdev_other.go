@@ -0,0 +1,11 @@
+//go:build !linux
+
+package tasks
+
+import "strings"
+
+// blockDevice returns the I/O counter key for a partition's device
+// (e.g. "ada0p2" for /dev/ada0p2)
+func blockDevice(device, mountpoint string) string {
+	return strings.TrimPrefix(device, "/dev/")
+}
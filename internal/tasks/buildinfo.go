@@ -0,0 +1,62 @@
+package tasks
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// unknownBuild stands in for build details that were neither set at build
+// time nor recorded by the Go toolchain
+const unknownBuild = "unknown"
+
+// BuildInfo identifies the agent binary, returned by cmd.version. Version,
+// commit and build date are set via -ldflags; the rest comes from the
+// toolchain.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"` // RFC3339, UTC
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a tree with uncommitted changes
+}
+
+// NewBuildInfo returns the build info for the running binary. A commit not
+// set via -ldflags falls back to the revision go build records when building
+// from a git checkout, and a build date to that revision's commit time.
+func NewBuildInfo(version, commit, buildDate string) BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range build.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.BuildDate == "" {
+					info.BuildDate = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+
+	if info.Commit == "" {
+		info.Commit = unknownBuild
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = unknownBuild
+	}
+	return info
+}
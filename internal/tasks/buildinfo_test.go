@@ -0,0 +1,22 @@
+package tasks
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestNewBuildInfo(t *testing.T) {
+	info := NewBuildInfo("1.2.3", "abc1234", "2026-01-02T03:04:05Z")
+	if info.Version != "1.2.3" || info.Commit != "abc1234" || info.BuildDate != "2026-01-02T03:04:05Z" {
+		t.Errorf("NewBuildInfo() = %+v, want the -ldflags values", info)
+	}
+	if info.GoVersion != runtime.Version() || info.OS != runtime.GOOS || info.Arch != runtime.GOARCH {
+		t.Errorf("NewBuildInfo() = %+v, want the toolchain values", info)
+	}
+
+	// Test binaries carry no VCS details, so unset values are reported as such
+	info = NewBuildInfo("dev", "", "")
+	if info.Commit != unknownBuild || info.BuildDate != unknownBuild {
+		t.Errorf("NewBuildInfo() without ldflags = %+v, want commit and build_date %q", info, unknownBuild)
+	}
+}
@@ -0,0 +1,127 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// Host capabilities probed at startup. Minimal OS images (containers,
+// busybox gateways, Server Core without PowerShell) lack some of them.
+const (
+	CapabilitySystemctl   = "systemctl"         // Linux: service checks and control
+	CapabilityServiceTool = "service"           // FreeBSD: service(8) for service checks and control
+	CapabilityProcfs      = "procfs"            // Linux: /proc, read by the gopsutil collector
+	CapabilityPowerShell  = "powershell"        // Windows: cmd.exec, cmd.scheduled_task, neighbor table
+	CapabilityDataDir     = "writable_data_dir" // State files kept across restarts
+)
+
+// Capability is whether the host has something the agent depends on, and
+// which subsystems are turned off while it doesn't
+type Capability struct {
+	Name      string   `json:"name"`
+	Available bool     `json:"available"`
+	Detail    string   `json:"detail,omitempty"`  // Why it is missing
+	Affects   []string `json:"affects,omitempty"` // Subsystems disabled while missing
+}
+
+// capabilityProbes are the checks behind detectCapabilities, replaced in
+// tests
+type capabilityProbes struct {
+	lookPath func(file string) (string, error)
+	stat     func(name string) (os.FileInfo, error)
+	writable func(dir string) error
+}
+
+// DetectCapabilities probes the host once, so subsystems whose tools or
+// files are missing are disabled up front with one warning each instead of
+// failing on every run. An empty dataDir keeps state in memory only.
+// builtinMetrics is whether system metrics are collected with gopsutil (any
+// source but exporter). Must be called before the scheduler starts and
+// commands are served.
+func (e *Executor) DetectCapabilities(dataDir string, builtinMetrics bool) []Capability {
+	probes := capabilityProbes{
+		lookPath: exec.LookPath,
+		stat:     os.Stat,
+		writable: func(dir string) error {
+			_, err := CheckWritable(dir)
+			return err
+		},
+	}
+	e.capabilities = detectCapabilities(runtime.GOOS, dataDir, builtinMetrics, probes)
+
+	for _, c := range e.capabilities {
+		if !c.Available {
+			e.logger.Warn("Host capability missing, disabling dependent subsystems",
+				zap.String("capability", c.Name),
+				zap.String("detail", c.Detail),
+				zap.Strings("disabled", c.Affects))
+		}
+	}
+	return e.capabilities
+}
+
+// Capabilities returns the capabilities found by DetectCapabilities, for
+// inventory
+func (e *Executor) Capabilities() []Capability {
+	return e.capabilities
+}
+
+// Unavailable returns why subsystem is disabled, or nil if no missing
+// capability affects it
+func (e *Executor) Unavailable(subsystem string) error {
+	for _, c := range e.capabilities {
+		if !c.Available && slices.Contains(c.Affects, subsystem) {
+			return fmt.Errorf("%s is disabled on this host: %s not available (%s)", subsystem, c.Name, c.Detail)
+		}
+	}
+	return nil
+}
+
+func detectCapabilities(goos, dataDir string, builtinMetrics bool, probe capabilityProbes) []Capability {
+	var capabilities []Capability
+	tool := func(name, file string, affects ...string) {
+		c := Capability{Name: name, Available: true, Affects: affects}
+		if _, err := probe.lookPath(file); err != nil {
+			c.Available = false
+			c.Detail = fmt.Sprintf("%s not found in PATH", file)
+		}
+		capabilities = append(capabilities, c)
+	}
+
+	switch goos {
+	case "linux":
+		tool(CapabilitySystemctl, "systemctl", "tasks.service_check", "cmd.service")
+
+		// gopsutil reads CPU, memory and processes from /proc
+		affects := []string{"tasks.system_metrics.top_processes", "tasks.system_metrics.cpu_sample_interval"}
+		if builtinMetrics {
+			affects = append([]string{"tasks.system_metrics"}, affects...)
+		}
+		procfs := Capability{Name: CapabilityProcfs, Available: true, Affects: affects}
+		if _, err := probe.stat("/proc/self/stat"); err != nil {
+			procfs.Available = false
+			procfs.Detail = "/proc is not mounted"
+		}
+		capabilities = append(capabilities, procfs)
+	case "freebsd":
+		tool(CapabilityServiceTool, "service", "tasks.service_check", "cmd.service")
+	case "windows":
+		tool(CapabilityPowerShell, "powershell.exe", "cmd.exec", "cmd.scheduled_task", "tasks.inventory.neighbors")
+	}
+
+	// No dataDir means state is kept in memory (immutable.state: memory)
+	c := Capability{Name: CapabilityDataDir, Available: true, Affects: []string{"data_dir"}}
+	if dataDir == "" {
+		c.Available = false
+		c.Detail = "state kept in memory"
+	} else if err := probe.writable(dataDir); err != nil {
+		c.Available = false
+		c.Detail = err.Error()
+	}
+	return append(capabilities, c)
+}
@@ -0,0 +1,130 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestDetectCapabilities tests the capability matrix per platform and that
+// missing capabilities disable the subsystems they affect
+func TestDetectCapabilities(t *testing.T) {
+	missing := func(names ...string) capabilityProbes {
+		return capabilityProbes{
+			lookPath: func(file string) (string, error) {
+				if slices.Contains(names, file) {
+					return "", errors.New("not found")
+				}
+				return "/usr/bin/" + file, nil
+			},
+			stat: func(name string) (os.FileInfo, error) {
+				if slices.Contains(names, name) {
+					return nil, os.ErrNotExist
+				}
+				return nil, nil
+			},
+			writable: func(dir string) error {
+				if slices.Contains(names, dir) {
+					return errors.New("read-only file system")
+				}
+				return nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		goos           string
+		builtinMetrics bool
+		memory         bool // No data dir (immutable.state: memory)
+		probes         capabilityProbes
+		wantNames      []string
+		disabled       []string
+		enabled        []string
+	}{
+		{
+			name:           "linux, everything present",
+			goos:           "linux",
+			builtinMetrics: true,
+			probes:         missing(),
+			wantNames:      []string{CapabilitySystemctl, CapabilityProcfs, CapabilityDataDir},
+			enabled:        []string{"tasks.service_check", "cmd.service", "tasks.system_metrics", "data_dir"},
+		},
+		{
+			name:           "linux without systemd or /proc",
+			goos:           "linux",
+			builtinMetrics: true,
+			probes:         missing("systemctl", "/proc/self/stat"),
+			wantNames:      []string{CapabilitySystemctl, CapabilityProcfs, CapabilityDataDir},
+			disabled:       []string{"tasks.service_check", "cmd.service", "tasks.system_metrics", "tasks.system_metrics.top_processes"},
+			enabled:        []string{"data_dir", "cmd.exec"},
+		},
+		{
+			name:      "linux without /proc, exporter source",
+			goos:      "linux",
+			probes:    missing("/proc/self/stat"),
+			wantNames: []string{CapabilitySystemctl, CapabilityProcfs, CapabilityDataDir},
+			disabled:  []string{"tasks.system_metrics.cpu_sample_interval"},
+			enabled:   []string{"tasks.system_metrics", "tasks.service_check"},
+		},
+		{
+			name:      "read-only data dir",
+			goos:      "freebsd",
+			probes:    missing("/var/lib/agent"),
+			wantNames: []string{CapabilityServiceTool, CapabilityDataDir},
+			disabled:  []string{"data_dir"},
+			enabled:   []string{"tasks.service_check"},
+		},
+		{
+			name:      "state in memory",
+			goos:      "freebsd",
+			memory:    true,
+			probes:    missing(),
+			wantNames: []string{CapabilityServiceTool, CapabilityDataDir},
+			disabled:  []string{"data_dir"},
+		},
+		{
+			name:      "windows without powershell",
+			goos:      "windows",
+			probes:    missing("powershell.exe"),
+			wantNames: []string{CapabilityPowerShell, CapabilityDataDir},
+			disabled:  []string{"cmd.exec", "cmd.scheduled_task", "tasks.inventory.neighbors"},
+			enabled:   []string{"tasks.service_check", "cmd.service"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{logger: zap.NewNop()}
+			dataDir := "/var/lib/agent"
+			if tt.memory {
+				dataDir = ""
+			}
+			e.capabilities = detectCapabilities(tt.goos, dataDir, tt.builtinMetrics, tt.probes)
+
+			var names []string
+			for _, c := range e.Capabilities() {
+				names = append(names, c.Name)
+				if !c.Available && c.Detail == "" {
+					t.Errorf("missing capability %s has no detail", c.Name)
+				}
+			}
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("capabilities = %v, want %v", names, tt.wantNames)
+			}
+			for _, subsystem := range tt.disabled {
+				if e.Unavailable(subsystem) == nil {
+					t.Errorf("Unavailable(%q) = nil, want disabled", subsystem)
+				}
+			}
+			for _, subsystem := range tt.enabled {
+				if err := e.Unavailable(subsystem); err != nil {
+					t.Errorf("Unavailable(%q) = %v, want nil", subsystem, err)
+				}
+			}
+		})
+	}
+}
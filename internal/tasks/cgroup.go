@@ -0,0 +1,257 @@
+package tasks
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCgroups caps the cgroups reported per metrics payload
+const maxCgroups = 50
+
+// cgroupRoot is where cgroup v2 is mounted
+const cgroupRoot = "/sys/fs/cgroup"
+
+// CgroupMetrics is the resource use of one cgroup v2 group (Linux,
+// tasks.system_metrics.cgroups)
+type CgroupMetrics struct {
+	Path string `json:"path"` // Relative to /sys/fs/cgroup, e.g. system.slice
+
+	// Since the last scrape (0 on the first)
+	CPUUsagePercent     float64 `json:"cpu_usage_percent"`     // Share of total host CPU
+	CPUThrottledSeconds float64 `json:"cpu_throttled_seconds"` // Time held back by cpu.max
+
+	MemoryCurrentMB float64 `json:"memory_current_mb"`
+	MemoryMaxMB     float64 `json:"memory_max_mb,omitempty"` // 0 = unlimited
+
+	// Pressure stall information; nil if the kernel does not report it
+	CPUPressure    *Pressure `json:"cpu_pressure,omitempty"`
+	MemoryPressure *Pressure `json:"memory_pressure,omitempty"`
+}
+
+// Pressure is a PSI (pressure stall information) reading: the percentage of
+// time some (or all, for "full") tasks were stalled on a resource, averaged
+// over 10s, 60s and 300s
+type Pressure struct {
+	SomeAvg10  float64 `json:"some_avg10"`
+	SomeAvg60  float64 `json:"some_avg60"`
+	SomeAvg300 float64 `json:"some_avg300"`
+	FullAvg10  float64 `json:"full_avg10"`
+	FullAvg60  float64 `json:"full_avg60"`
+	FullAvg300 float64 `json:"full_avg300"`
+}
+
+// cgroupCPU is a cgroup's cumulative CPU counters at a point in time
+type cgroupCPU struct {
+	usageUsec     uint64
+	throttledUsec uint64
+	at            time.Time
+}
+
+// cgroupSampler reads the cgroups matching configured patterns and keeps
+// their previous CPU counters for rates
+type cgroupSampler struct {
+	root     string
+	patterns []string
+	numCPU   int
+	now      func() time.Time
+
+	mu   sync.Mutex
+	prev map[string]cgroupCPU
+}
+
+// newCgroupSampler creates a sampler for cgroup path patterns, relative to
+// root (glob patterns allowed)
+func newCgroupSampler(root string, patterns []string) *cgroupSampler {
+	return &cgroupSampler{
+		root:     root,
+		patterns: patterns,
+		numCPU:   runtime.NumCPU(),
+		now:      time.Now,
+		prev:     make(map[string]cgroupCPU),
+	}
+}
+
+// collect reads every matching cgroup, sorted by path
+func (s *cgroupSampler) collect() ([]CgroupMetrics, error) {
+	if _, err := os.Stat(filepath.Join(s.root, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("cgroup v2 is not mounted at %s", s.root)
+	}
+
+	paths, err := s.match()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	seen := make(map[string]bool, len(paths))
+	cgroups := make([]CgroupMetrics, 0, len(paths))
+	for _, rel := range paths {
+		dir := filepath.Join(s.root, rel)
+		m := CgroupMetrics{Path: rel}
+
+		if stat, err := readKeyValues(filepath.Join(dir, "cpu.stat")); err == nil {
+			cur := cgroupCPU{usageUsec: stat["usage_usec"], throttledUsec: stat["throttled_usec"], at: now}
+			if prev, ok := s.prev[rel]; ok && cur.usageUsec >= prev.usageUsec && cur.throttledUsec >= prev.throttledUsec {
+				if elapsed := cur.at.Sub(prev.at).Microseconds(); elapsed > 0 {
+					m.CPUUsagePercent = float64(cur.usageUsec-prev.usageUsec) / float64(elapsed*int64(s.numCPU)) * 100
+				}
+				m.CPUThrottledSeconds = float64(cur.throttledUsec-prev.throttledUsec) / 1e6
+			}
+			s.prev[rel] = cur
+			seen[rel] = true
+		}
+
+		if current, err := readCgroupValue(filepath.Join(dir, "memory.current")); err == nil {
+			m.MemoryCurrentMB = float64(current) / 1024 / 1024
+		}
+		if limit, err := readCgroupValue(filepath.Join(dir, "memory.max")); err == nil {
+			m.MemoryMaxMB = float64(limit) / 1024 / 1024
+		}
+		if p, err := readPressure(filepath.Join(dir, "cpu.pressure")); err == nil {
+			m.CPUPressure = p
+		}
+		if p, err := readPressure(filepath.Join(dir, "memory.pressure")); err == nil {
+			m.MemoryPressure = p
+		}
+
+		cgroups = append(cgroups, m)
+	}
+
+	// Forget cgroups that went away
+	for rel := range s.prev {
+		if !seen[rel] {
+			delete(s.prev, rel)
+		}
+	}
+	return cgroups, nil
+}
+
+// match expands the patterns to cgroup directories relative to root, at
+// most maxCgroups
+func (s *cgroupSampler) match() ([]string, error) {
+	unique := make(map[string]bool)
+	for _, pattern := range s.patterns {
+		matches, err := filepath.Glob(filepath.Join(s.root, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cgroup pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || !info.IsDir() {
+				continue
+			}
+			rel, err := filepath.Rel(s.root, match)
+			if err != nil {
+				continue
+			}
+			unique[filepath.ToSlash(rel)] = true
+		}
+	}
+	paths := make([]string, 0, len(unique))
+	for rel := range unique {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	if len(paths) > maxCgroups {
+		paths = paths[:maxCgroups]
+	}
+	return paths, nil
+}
+
+// readKeyValues reads a flat-keyed cgroup file such as cpu.stat
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+	return values, scanner.Err()
+}
+
+// errCgroupUnlimited is returned for a limit file containing "max"
+var errCgroupUnlimited = errors.New("unlimited")
+
+// readCgroupValue reads a single-value cgroup file such as memory.current
+func readCgroupValue(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, errCgroupUnlimited
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readPressure reads a PSI file:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressure(path string) (*Pressure, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Pressure{}
+	found := false
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var avg10, avg60, avg300 *float64
+		switch fields[0] {
+		case "some":
+			avg10, avg60, avg300 = &p.SomeAvg10, &p.SomeAvg60, &p.SomeAvg300
+		case "full":
+			avg10, avg60, avg300 = &p.FullAvg10, &p.FullAvg60, &p.FullAvg300
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "avg10":
+				*avg10 = n
+			case "avg60":
+				*avg60 = n
+			case "avg300":
+				*avg300 = n
+			}
+		}
+		found = true
+	}
+	if !found {
+		return nil, fs.ErrNotExist
+	}
+	return p, nil
+}
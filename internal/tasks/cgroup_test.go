@@ -0,0 +1,92 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCgroup writes a fake cgroup directory with the given files
+func writeCgroup(t *testing.T, root, rel string, files map[string]string) {
+	t.Helper()
+	dir := filepath.Join(root, rel)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCgroupSampler(t *testing.T) {
+	root := t.TempDir()
+	writeCgroup(t, root, "", map[string]string{"cgroup.controllers": "cpu memory\n"})
+	writeCgroup(t, root, "system.slice", map[string]string{
+		"cpu.stat":        "usage_usec 1000000\nuser_usec 600000\nsystem_usec 400000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 50000\n",
+		"cpu.pressure":    "some avg10=12.50 avg60=4.00 avg300=1.25 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory.pressure": "some avg10=0.50 avg60=0.25 avg300=0.10 total=999\nfull avg10=0.30 avg60=0.20 avg300=0.05 total=555\n",
+		"memory.current":  "104857600\n",
+		"memory.max":      "max\n",
+	})
+	writeCgroup(t, root, "system.slice/nginx.service", map[string]string{
+		"cpu.stat":       "usage_usec 500\n",
+		"memory.current": "1048576\n",
+		"memory.max":     "536870912\n",
+	})
+	writeCgroup(t, root, "user.slice", nil)
+
+	now := time.Unix(1000, 0)
+	s := newCgroupSampler(root, []string{"system.slice", "system.slice/*.service", "missing.slice"})
+	s.numCPU = 2
+	s.now = func() time.Time { return now }
+
+	first, err := s.collect()
+	if err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if len(first) != 2 || first[0].Path != "system.slice" || first[1].Path != "system.slice/nginx.service" {
+		t.Fatalf("collect() paths = %+v, want system.slice and system.slice/nginx.service", first)
+	}
+	sys := first[0]
+	if sys.CPUUsagePercent != 0 || sys.CPUThrottledSeconds != 0 {
+		t.Errorf("first collect rates = %v/%v, want 0", sys.CPUUsagePercent, sys.CPUThrottledSeconds)
+	}
+	if sys.MemoryCurrentMB != 100 || sys.MemoryMaxMB != 0 {
+		t.Errorf("memory = %v/%v MB, want 100/unlimited", sys.MemoryCurrentMB, sys.MemoryMaxMB)
+	}
+	if sys.CPUPressure == nil || sys.CPUPressure.SomeAvg10 != 12.5 || sys.CPUPressure.SomeAvg300 != 1.25 {
+		t.Errorf("cpu_pressure = %+v", sys.CPUPressure)
+	}
+	if sys.MemoryPressure == nil || sys.MemoryPressure.FullAvg10 != 0.3 {
+		t.Errorf("memory_pressure = %+v", sys.MemoryPressure)
+	}
+	if nginx := first[1]; nginx.MemoryMaxMB != 512 || nginx.CPUPressure != nil {
+		t.Errorf("nginx = %+v, want 512 MB limit and no pressure", nginx)
+	}
+
+	// 10s later: 5 CPU-seconds used on 2 CPUs = 25%, 0.25s more throttled
+	now = now.Add(10 * time.Second)
+	writeCgroup(t, root, "system.slice", map[string]string{
+		"cpu.stat": "usage_usec 6000000\nthrottled_usec 300000\n",
+	})
+	second, err := s.collect()
+	if err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+	if got := second[0].CPUUsagePercent; got != 25 {
+		t.Errorf("cpu_usage_percent = %v, want 25", got)
+	}
+	if got := second[0].CPUThrottledSeconds; got != 0.25 {
+		t.Errorf("cpu_throttled_seconds = %v, want 0.25", got)
+	}
+}
+
+func TestCgroupSamplerNotV2(t *testing.T) {
+	s := newCgroupSampler(t.TempDir(), []string{"system.slice"})
+	if _, err := s.collect(); err == nil {
+		t.Error("collect() without cgroup.controllers should fail")
+	}
+}
@@ -20,6 +20,12 @@ type MetricsCollector interface {
 
 	// ResetCache clears rate calculation state (for staleness handling)
 	ResetCache()
+
+	// SetDiskFilter limits which drives are reported (nil = all)
+	SetDiskFilter(filter *DiskFilter)
+
+	// RateCache returns the counter baseline store (for persistence)
+	RateCache() RateCache
 }
 
 // NewMetricsCollector creates the appropriate collector based on configuration
@@ -39,6 +45,15 @@ func NewMetricsCollector(source, exporterURL string, logger *zap.Logger, httpCli
 		}
 		logger.Info("Using exporter metrics collector", zap.String("url", exporterURL))
 		return NewExporterCollector(exporterURL, logger, httpClient), nil
+	case "hybrid":
+		if exporterURL == "" {
+			return nil, fmt.Errorf("exporter_url required for hybrid source")
+		}
+		logger.Info("Using hybrid metrics collector (gopsutil + exporter)", zap.String("url", exporterURL))
+		return NewHybridCollector(exporterURL, logger, httpClient), nil
+	case "pdh":
+		logger.Info("Using PDH metrics collector (gopsutil + performance counters)")
+		return NewPDHCollector(logger), nil
 	default:
 		return nil, fmt.Errorf("unknown metrics source: %s", source)
 	}
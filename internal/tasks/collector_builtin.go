@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"runtime"
-	"strings"
-	"sync"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
@@ -19,19 +17,18 @@ import (
 type BuiltinCollector struct {
 	logger *zap.Logger
 
-	// Cache for rate calculations
-	mu            sync.RWMutex
-	lastTimestamp time.Time
-	lastCPUTimes  cpu.TimesStat
-	hasCPUTimes   bool
-	lastDiskIO    map[string]disk.IOCountersStat
+	// Previous counters for rate calculations
+	cache RateCache
+
+	filter *DiskFilter
+	noIO   bool // Skip per-disk I/O counters (tasks.system_metrics.disk_io: false)
 }
 
 // NewBuiltinCollector creates a new gopsutil-based collector
 func NewBuiltinCollector(logger *zap.Logger) *BuiltinCollector {
 	return &BuiltinCollector{
-		logger:     logger,
-		lastDiskIO: make(map[string]disk.IOCountersStat),
+		logger: logger,
+		cache:  newMemoryRateCache(),
 	}
 }
 
@@ -40,12 +37,21 @@ func (c *BuiltinCollector) Name() string {
 }
 
 func (c *BuiltinCollector) ResetCache() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.lastTimestamp = time.Time{}
-	c.lastCPUTimes = cpu.TimesStat{}
-	c.hasCPUTimes = false
-	c.lastDiskIO = make(map[string]disk.IOCountersStat)
+	c.cache.Reset()
+}
+
+func (c *BuiltinCollector) SetDiskFilter(filter *DiskFilter) {
+	c.filter = filter
+}
+
+// SetDiskIO turns per-disk read/write rates on or off; space metrics are
+// collected either way
+func (c *BuiltinCollector) SetDiskIO(enabled bool) {
+	c.noIO = !enabled
+}
+
+func (c *BuiltinCollector) RateCache() RateCache {
+	return c.cache
 }
 
 func (c *BuiltinCollector) Collect(ctx context.Context) (*SystemMetrics, error) {
@@ -54,13 +60,14 @@ func (c *BuiltinCollector) Collect(ctx context.Context) (*SystemMetrics, error)
 	metrics := &SystemMetrics{
 		TS: utils.NowRFC3339(),
 	}
+	snapshot := CounterSnapshot{
+		Time:  time.Now(),
+		Disks: make(map[string]DiskCounters),
+	}
 
-	// Collect CPU
-	cpuPercent, err := c.collectCPU(ctx)
-	if err != nil {
+	// Collect CPU counters
+	if err := c.collectCPU(ctx, &snapshot); err != nil {
 		c.logger.Warn("Failed to collect CPU metrics", zap.Error(err))
-	} else {
-		metrics.CPUUsagePercent = cpuPercent
 	}
 
 	// Collect Memory
@@ -71,62 +78,49 @@ func (c *BuiltinCollector) Collect(ctx context.Context) (*SystemMetrics, error)
 		metrics.MemoryFreeGB = memFreeGB
 	}
 
-	// Collect Disks (space + I/O)
-	diskMetrics, err := c.collectDisks(ctx)
+	// Collect Disks (space + I/O counters)
+	diskMetrics, devices, err := c.collectDisks(ctx, &snapshot)
 	if err != nil {
 		c.logger.Warn("Failed to collect disk metrics", zap.Error(err))
-	} else {
+	}
+
+	_, hadBaseline := c.cache.Load()
+	rates := calculateRates(c.cache, snapshot)
+	if !hadBaseline {
+		c.logger.Debug("CPU and disk I/O baseline stored (first scrape)")
+	}
+
+	metrics.CPUUsagePercent = rates.CPUPercent
+	for i := range diskMetrics {
+		if r, ok := rates.Disks[devices[i]]; ok {
+			diskMetrics[i].ReadBytesPerSec = r.ReadBytesPerSec
+			diskMetrics[i].WriteBytesPerSec = r.WriteBytesPerSec
+		}
+	}
+	if err == nil {
 		metrics.Disks = diskMetrics
 	}
 
 	return metrics, nil
 }
 
-func (c *BuiltinCollector) collectCPU(ctx context.Context) (float64, error) {
+// collectCPU adds the combined CPU time counters to snapshot
+func (c *BuiltinCollector) collectCPU(ctx context.Context, snapshot *CounterSnapshot) error {
 	// Get CPU times (all CPUs combined)
 	times, err := cpu.TimesWithContext(ctx, false) // false = combined
 	if err != nil {
-		return 0, err
+		return err
 	}
 	if len(times) == 0 {
-		return 0, fmt.Errorf("no CPU times returned")
+		return fmt.Errorf("no CPU times returned")
 	}
 
 	current := times[0]
-	currentTotal := current.User + current.System + current.Idle + current.Nice +
+	snapshot.HasCPU = true
+	snapshot.CPUTotal = current.User + current.System + current.Idle + current.Nice +
 		current.Iowait + current.Irq + current.Softirq + current.Steal
-	currentIdle := current.Idle + current.Iowait
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// First scrape - store baseline
-	if !c.hasCPUTimes {
-		c.lastCPUTimes = current
-		c.hasCPUTimes = true
-		c.lastTimestamp = time.Now()
-		c.logger.Debug("CPU baseline stored (first scrape)")
-		return 0, nil // Will have value on next scrape
-	}
-
-	prev := c.lastCPUTimes
-	prevTotal := prev.User + prev.System + prev.Idle + prev.Nice +
-		prev.Iowait + prev.Irq + prev.Softirq + prev.Steal
-	prevIdle := prev.Idle + prev.Iowait
-
-	totalDelta := currentTotal - prevTotal
-	idleDelta := currentIdle - prevIdle
-
-	// Update cache
-	c.lastCPUTimes = current
-	c.lastTimestamp = time.Now()
-
-	if totalDelta <= 0 {
-		return 0, nil
-	}
-
-	usagePercent := ((totalDelta - idleDelta) / totalDelta) * 100
-	return utils.Round(usagePercent), nil
+	snapshot.CPUIdle = current.Idle + current.Iowait
+	return nil
 }
 
 func (c *BuiltinCollector) collectMemory(ctx context.Context) (float64, error) {
@@ -139,31 +133,30 @@ func (c *BuiltinCollector) collectMemory(ctx context.Context) (float64, error) {
 	return utils.Round(float64(vmem.Available) / 1024 / 1024 / 1024), nil
 }
 
-func (c *BuiltinCollector) collectDisks(ctx context.Context) ([]DiskMetrics, error) {
+// collectDisks returns space metrics per partition, adding each partition's
+// I/O counters to snapshot. devices[i] is the I/O counter key for disks[i].
+func (c *BuiltinCollector) collectDisks(ctx context.Context, snapshot *CounterSnapshot) (disks []DiskMetrics, devices []string, err error) {
 	// Get partitions
 	partitions, err := disk.PartitionsWithContext(ctx, false) // false = physical only
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// Get I/O counters
-	ioCounters, err := disk.IOCountersWithContext(ctx)
-	if err != nil {
-		c.logger.Debug("Could not get disk I/O counters", zap.Error(err))
-		// Continue without I/O - we can still get space metrics
+	// Get I/O counters, unless disabled: reading them walks every block
+	// device, which is the costly part of a scrape on small devices
+	var ioCounters map[string]disk.IOCountersStat
+	if !c.noIO {
+		ioCounters, err = disk.IOCountersWithContext(ctx)
+		if err != nil {
+			c.logger.Debug("Could not get disk I/O counters", zap.Error(err))
+			// Continue without I/O - we can still get space metrics
+		}
 	}
 
-	now := time.Now()
-	var diskMetrics []DiskMetrics
-
-	c.mu.Lock()
-	timeDelta := now.Sub(c.lastTimestamp).Seconds()
-	isFirstScrape := c.lastTimestamp.IsZero()
-	c.mu.Unlock()
-
 	for _, partition := range partitions {
-		// Skip certain filesystem types
-		if c.shouldSkipPartition(partition) {
+		// Skip certain filesystem types and filtered drives
+		drive := c.normalizeDriveName(partition.Mountpoint)
+		if c.shouldSkipPartition(partition) || !c.filter.Allows(drive) {
 			continue
 		}
 
@@ -181,49 +174,49 @@ func (c *BuiltinCollector) collectDisks(ctx context.Context) ([]DiskMetrics, err
 			continue
 		}
 
-		dm := DiskMetrics{
-			Drive:       c.normalizeDriveName(partition.Mountpoint),
+		disks = append(disks, DiskMetrics{
+			Drive:       drive,
 			TotalGB:     utils.Round(float64(usage.Total) / 1024 / 1024 / 1024),
 			FreeGB:      utils.Round(float64(usage.Free) / 1024 / 1024 / 1024),
 			FreePercent: utils.Round(float64(usage.Free) / float64(usage.Total) * 100),
-		}
-
-		// Calculate I/O rates if we have counters and previous measurements
-		if ioCounters != nil && !isFirstScrape && timeDelta > 0 {
-			// Find matching I/O counter (by device name)
-			deviceName := c.getDeviceName(partition)
-			if io, ok := ioCounters[deviceName]; ok {
-				c.mu.Lock()
-				if prev, exists := c.lastDiskIO[deviceName]; exists {
-					readDelta := float64(io.ReadBytes - prev.ReadBytes)
-					writeDelta := float64(io.WriteBytes - prev.WriteBytes)
-					dm.ReadBytesPerSec = utils.Round(readDelta / timeDelta)
-					dm.WriteBytesPerSec = utils.Round(writeDelta / timeDelta)
-				}
-				c.lastDiskIO[deviceName] = io
-				c.mu.Unlock()
-			}
-		} else if ioCounters != nil {
-			// First scrape - store baseline
-			deviceName := c.getDeviceName(partition)
-			if io, ok := ioCounters[deviceName]; ok {
-				c.mu.Lock()
-				c.lastDiskIO[deviceName] = io
-				c.mu.Unlock()
+			Inodes:      newInodeMetrics(usage.InodesTotal, usage.InodesFree), // Zero on Windows
+		})
+
+		// Find matching I/O counter (by device name)
+		deviceName := c.getDeviceName(partition)
+		devices = append(devices, deviceName)
+		if io, ok := ioCounters[deviceName]; ok {
+			snapshot.Disks[deviceName] = DiskCounters{
+				ReadBytes:  float64(io.ReadBytes),
+				WriteBytes: float64(io.WriteBytes),
 			}
 		}
-
-		diskMetrics = append(diskMetrics, dm)
 	}
 
-	// Update timestamp
-	c.mu.Lock()
-	if c.lastTimestamp.IsZero() {
-		c.lastTimestamp = now
+	// Windows volumes without a drive letter, reported by mount path. They
+	// have no per-letter I/O counters, so devices holds the path.
+	mounts, err := folderMounts()
+	if err != nil {
+		c.logger.Debug("Could not list folder-mounted volumes", zap.Error(err))
+	}
+	for _, mount := range mounts {
+		if !c.filter.Allows(mount) {
+			continue
+		}
+		usage, err := disk.UsageWithContext(ctx, mount)
+		if err != nil || usage.Total < 1024*1024*1024 {
+			continue
+		}
+		disks = append(disks, DiskMetrics{
+			Drive:       mount,
+			TotalGB:     utils.Round(float64(usage.Total) / 1024 / 1024 / 1024),
+			FreeGB:      utils.Round(float64(usage.Free) / 1024 / 1024 / 1024),
+			FreePercent: utils.Round(float64(usage.Free) / float64(usage.Total) * 100),
+		})
+		devices = append(devices, mount)
 	}
-	c.mu.Unlock()
 
-	return diskMetrics, nil
+	return disks, devices, nil
 }
 
 // shouldSkipPartition returns true if the partition should be skipped
@@ -265,29 +258,16 @@ func (c *BuiltinCollector) getDeviceName(partition disk.PartitionStat) string {
 		}
 		return partition.Mountpoint
 	}
-	// Linux/FreeBSD: use device name (e.g., "sda1", "nvme0n1p1")
-	// Strip /dev/ prefix
-	device := partition.Device
-	device = strings.TrimPrefix(device, "/dev/")
-	return device
+	// Linux/FreeBSD: use the kernel device name (e.g., "sda1", "nvme0n1p1", "dm-0")
+	return blockDevice(partition.Device, partition.Mountpoint)
 }
 
 func (c *BuiltinCollector) resetCacheIfStale() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.lastTimestamp.IsZero() {
-		return
-	}
-
-	age := time.Since(c.lastTimestamp)
-	if age > maxMetricsCacheAge {
+	age, ok := cacheAge(c.cache, time.Now())
+	if ok && age > maxMetricsCacheAge {
 		c.logger.Warn("Resetting stale metrics cache",
 			zap.Duration("cache_age", age),
 			zap.Duration("max_age", maxMetricsCacheAge))
-		c.lastTimestamp = time.Time{}
-		c.lastCPUTimes = cpu.TimesStat{}
-		c.hasCPUTimes = false
-		c.lastDiskIO = make(map[string]disk.IOCountersStat)
+		c.cache.Reset()
 	}
 }
@@ -2,15 +2,19 @@ package tasks
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"runtime"
-	"sync"
+	"strings"
 	"time"
 
-	dto "github.com/prometheus/client_model/go"
-	"github.com/prometheus/common/expfmt"
+	"github.com/stone-age-io/agent/internal/config"
 	"github.com/stone-age-io/agent/internal/utils"
 	"go.uber.org/zap"
 )
@@ -18,24 +22,23 @@ import (
 // ExporterCollector collects metrics by scraping Prometheus exporters
 type ExporterCollector struct {
 	exporterURL string
+	request     *config.ExporterRequestConfig // Headers and credentials, nil = defaults
 	logger      *zap.Logger
 	httpClient  *http.Client
 
-	// Cache for rate calculations
-	mu              sync.RWMutex
-	lastTimestamp   time.Time
-	lastCPUTotal    float64
-	lastCPUIdle     float64
-	lastDiskMetrics map[string]DiskCounters
+	// Previous counters for rate calculations
+	cache RateCache
+
+	filter *DiskFilter
 }
 
 // NewExporterCollector creates a collector that scrapes Prometheus exporters
 func NewExporterCollector(url string, logger *zap.Logger, httpClient *http.Client) *ExporterCollector {
 	return &ExporterCollector{
-		exporterURL:     url,
-		logger:          logger,
-		httpClient:      httpClient,
-		lastDiskMetrics: make(map[string]DiskCounters),
+		exporterURL: url,
+		logger:      logger,
+		httpClient:  httpClient,
+		cache:       newMemoryRateCache(),
 	}
 }
 
@@ -44,12 +47,20 @@ func (c *ExporterCollector) Name() string {
 }
 
 func (c *ExporterCollector) ResetCache() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.lastTimestamp = time.Time{}
-	c.lastCPUTotal = 0
-	c.lastCPUIdle = 0
-	c.lastDiskMetrics = make(map[string]DiskCounters)
+	c.cache.Reset()
+}
+
+func (c *ExporterCollector) SetDiskFilter(filter *DiskFilter) {
+	c.filter = filter
+}
+
+func (c *ExporterCollector) RateCache() RateCache {
+	return c.cache
+}
+
+// SetRequest sets the headers and credentials sent with each scrape
+func (c *ExporterCollector) SetRequest(request *config.ExporterRequestConfig) {
+	c.request = request
 }
 
 func (c *ExporterCollector) Collect(ctx context.Context) (*SystemMetrics, error) {
@@ -60,39 +71,14 @@ func (c *ExporterCollector) Collect(ctx context.Context) (*SystemMetrics, error)
 		zap.String("platform", runtime.GOOS),
 		zap.String("exporter", GetExporterName()))
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", c.exporterURL, nil)
+	body, err := scrapeExporter(ctx, c.httpClient, c.exporterURL, c.request, c.logger)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set User-Agent for identification
-	req.Header.Set("User-Agent", "stone-age-agent/1.0")
-
-	// Execute request using HTTP client
-	c.logger.Debug("Executing HTTP request", zap.String("url", c.exporterURL))
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, fmt.Errorf("metrics scrape timeout: %w", err)
-		}
-		if ctx.Err() == context.Canceled {
-			return nil, fmt.Errorf("metrics scrape cancelled: %w", err)
-		}
-		return nil, fmt.Errorf("failed to fetch metrics: %w", err)
-	}
-	defer resp.Body.Close()
-
-	c.logger.Debug("Received HTTP response",
-		zap.Int("status_code", resp.StatusCode),
-		zap.Int64("content_length", resp.ContentLength))
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, err
 	}
+	defer body.Close()
 
 	// Read response body with size limit to prevent memory issues
-	limitedReader := io.LimitReader(resp.Body, 10*1024*1024) // 10MB limit
+	limitedReader := io.LimitReader(body, maxScrapeBytes)
 
 	// Parse metrics using expfmt
 	c.logger.Debug("Parsing Prometheus metrics")
@@ -111,301 +97,221 @@ func (c *ExporterCollector) Collect(ctx context.Context) (*SystemMetrics, error)
 	return metrics, nil
 }
 
-// parsePrometheusMetrics parses Prometheus format metrics using expfmt
-func (c *ExporterCollector) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, error) {
-	// Use NewDecoder with FmtText format for proper initialization
-	decoder := expfmt.NewDecoder(reader, expfmt.NewFormat(expfmt.TypeTextPlain))
-
-	metricFamilies := make(map[string]*dto.MetricFamily)
-
-	// Parse all metric families
-	for {
-		mf := &dto.MetricFamily{}
-		err := decoder.Decode(mf)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode metric family: %w", err)
-		}
-		metricFamilies[mf.GetName()] = mf
+// maxScrapeBytes limits how much of an exporter response is read
+const maxScrapeBytes = 10 * 1024 * 1024 // 10MB
+
+// unixSocketURL splits a unix:///path/to/socket exporter URL into the
+// socket and the http URL requested over it: /metrics, or the path query
+// parameter (unix:///run/exporter.sock?path=/stats/prometheus). ok is false
+// for other URLs.
+func unixSocketURL(raw string) (socket, httpURL string, ok bool) {
+	u, err := url.Parse(raw)
+	if err != nil || !strings.EqualFold(u.Scheme, "unix") || u.Path == "" {
+		return "", "", false
+	}
+	socket = u.Path
+	// unix:///C:/ProgramData/exporter.sock on Windows
+	if len(socket) > 2 && socket[2] == ':' {
+		socket = socket[1:]
 	}
+	path := u.Query().Get("path")
+	if path == "" {
+		path = "/metrics"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return socket, "http://localhost" + path, true
+}
 
-	c.logger.Debug("Parsed metric families", zap.Int("count", len(metricFamilies)))
+// dialUnixSocket sends every request of httpClient over the unix socket,
+// whatever host the URL names
+func dialUnixSocket(httpClient *http.Client, socket string) {
+	transport, ok := httpClient.Transport.(*http.Transport)
+	if !ok {
+		return
+	}
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
 
-	// Get platform-specific metric names
-	metricNames := GetMetricNames()
+// scrapeExporter requests url with the headers and credentials of request
+// (nil = none) and returns the response body. The caller closes it. A
+// unix:// url is requested over the socket httpClient dials (see
+// dialUnixSocket).
+func scrapeExporter(ctx context.Context, httpClient *http.Client, url string, request *config.ExporterRequestConfig, logger *zap.Logger) (io.ReadCloser, error) {
+	if _, httpURL, ok := unixSocketURL(url); ok {
+		url = httpURL
+	}
 
-	// Check if first scrape
-	c.mu.RLock()
-	isFirstScrape := c.lastTimestamp.IsZero()
-	c.mu.RUnlock()
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
 
-	metrics := &SystemMetrics{}
+	// Set User-Agent for identification
+	req.Header.Set("User-Agent", "stone-age-agent/1.0")
+	if request != nil {
+		setScrapeHeaders(req, request)
+	}
 
-	// Extract CPU usage using platform-specific metric name
-	cpuFound := false
+	// Execute request using HTTP client
+	logger.Debug("Executing HTTP request", zap.String("url", url))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("metrics scrape timeout: %w", err)
+		}
+		if ctx.Err() == context.Canceled {
+			return nil, fmt.Errorf("metrics scrape cancelled: %w", err)
+		}
+		return nil, fmt.Errorf("failed to fetch metrics: %w", err)
+	}
 
-	if family, ok := metricFamilies[metricNames.CPUTime]; ok {
-		var totalTime, idleTime float64
+	logger.Debug("Received HTTP response",
+		zap.Int("status_code", resp.StatusCode),
+		zap.Int64("content_length", resp.ContentLength))
 
-		// Sum across ALL cores and ALL modes
-		for _, m := range family.Metric {
-			mode := getLabelValue(m.Label, "mode")
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
 
-			if m.Counter != nil {
-				value := m.Counter.GetValue()
-				totalTime += value // Add all time from all modes and cores
+	return resp.Body, nil
+}
 
-				// Use platform-specific idle label
-				if mode == metricNames.CPUIdleLabel {
-					idleTime += value // Add idle time from all cores
-				}
-			}
+// setScrapeHeaders adds the configured headers and credentials to a scrape.
+// Secrets are read from the environment on every scrape, so a rotated
+// token is picked up without a restart.
+func setScrapeHeaders(req *http.Request, request *config.ExporterRequestConfig) {
+	if request.UserAgent != "" {
+		req.Header.Set("User-Agent", request.UserAgent)
+	}
+	for name, value := range request.Headers {
+		value = os.ExpandEnv(value)
+		// net/http sends req.Host, not a Host header
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
 		}
-
-		// Lock the cache for reading and writing
-		c.mu.Lock()
-
-		// Only calculate if we have a previous measurement
-		if !c.lastTimestamp.IsZero() && totalTime > 0 && c.lastCPUTotal > 0 {
-			// How much CPU time passed between measurements
-			totalDelta := totalTime - c.lastCPUTotal
-			idleDelta := idleTime - c.lastCPUIdle
-
-			if totalDelta > 0 {
-				// Usage = time spent NOT idle / total time
-				idlePercent := (idleDelta / totalDelta) * 100
-				metrics.CPUUsagePercent = utils.Round(100 - idlePercent)
-				cpuFound = true
-
-				c.logger.Debug("CPU calculated",
-					zap.Float64("total_delta", totalDelta),
-					zap.Float64("idle_delta", idleDelta),
-					zap.Float64("idle_percent", idlePercent),
-					zap.Float64("usage_percent", metrics.CPUUsagePercent))
-			}
-		} else if c.lastTimestamp.IsZero() {
-			c.logger.Debug("CPU baseline stored (first scrape)",
-				zap.Float64("total_time", totalTime),
-				zap.Float64("idle_time", idleTime))
+		req.Header.Set(name, value)
+	}
+	switch {
+	case request.BearerTokenEnv != "":
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(request.BearerTokenEnv))
+	case request.Username != "":
+		password := ""
+		if request.PasswordEnv != "" {
+			password = os.Getenv(request.PasswordEnv)
 		}
+		req.SetBasicAuth(request.Username, password)
+	}
+}
 
-		// Store current values for next time
-		c.lastCPUTotal = totalTime
-		c.lastCPUIdle = idleTime
-
-		c.mu.Unlock()
+// exporterTLSConfig builds the TLS settings for https exporter scrapes.
+// Private CAs are added to the system roots.
+func exporterTLSConfig(cfg config.ExporterTLSConfig, logger *zap.Logger) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
 	}
 
-	// Extract memory free bytes using platform-specific metric name
-	memoryFound := false
-
-	// Platform-specific memory handling
-	switch runtime.GOOS {
-	case "linux":
-		// Linux: Try MemAvailable first (preferred), then MemFree as fallback
-		if family, ok := metricFamilies["node_memory_MemAvailable_bytes"]; ok {
-			if len(family.Metric) > 0 && family.Metric[0].Gauge != nil {
-				bytes := family.Metric[0].Gauge.GetValue()
-				metrics.MemoryFreeGB = utils.Round(bytes / 1024 / 1024 / 1024)
-				memoryFound = true
-			}
-		} else if family, ok := metricFamilies["node_memory_MemFree_bytes"]; ok {
-			// Fallback to MemFree
-			if len(family.Metric) > 0 && family.Metric[0].Gauge != nil {
-				bytes := family.Metric[0].Gauge.GetValue()
-				metrics.MemoryFreeGB = utils.Round(bytes / 1024 / 1024 / 1024)
-				memoryFound = true
-				c.logger.Debug("Using MemFree fallback (MemAvailable not found)")
-			}
+	if cfg.CAFile != "" {
+		logger.Info("Loading exporter CA bundle", zap.String("file", cfg.CAFile))
+		caCert, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read exporter CA bundle: %w", err)
 		}
-	default:
-		// Windows, FreeBSD use single metric
-		if family, ok := metricFamilies[metricNames.MemoryFree]; ok {
-			if len(family.Metric) > 0 && family.Metric[0].Gauge != nil {
-				bytes := family.Metric[0].Gauge.GetValue()
-				metrics.MemoryFreeGB = utils.Round(bytes / 1024 / 1024 / 1024)
-				memoryFound = true
-			}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
 		}
-	}
-
-	// Extract disk metrics for ALL drives (automatic discovery)
-	// Build a map of drive -> metrics for easier lookup
-	diskData := make(map[string]*DiskMetrics)
-
-	// Collect free space for all drives using platform-specific metric name
-	if family, ok := metricFamilies[metricNames.DiskFreeBytes]; ok {
-		for _, m := range family.Metric {
-			volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-			if volume != "" && m.Gauge != nil {
-				if diskData[volume] == nil {
-					diskData[volume] = &DiskMetrics{Drive: volume}
-				}
-				diskData[volume].FreeGB = utils.Round(m.Gauge.GetValue() / 1024 / 1024 / 1024)
-			}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse exporter CA bundle %s", cfg.CAFile)
 		}
+		tlsConfig.RootCAs = pool
 	}
 
-	// Collect total size for all drives using platform-specific metric name
-	if family, ok := metricFamilies[metricNames.DiskSizeBytes]; ok {
-		for _, m := range family.Metric {
-			volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-			if volume != "" && m.Gauge != nil {
-				if diskData[volume] == nil {
-					diskData[volume] = &DiskMetrics{Drive: volume}
-				}
-				totalBytes := m.Gauge.GetValue()
-				diskData[volume].TotalGB = utils.Round(totalBytes / 1024 / 1024 / 1024)
-
-				// Calculate percentage if we have both free and total
-				if diskData[volume].FreeGB > 0 && totalBytes > 0 {
-					freeBytes := diskData[volume].FreeGB * 1024 * 1024 * 1024
-					diskData[volume].FreePercent = utils.Round((freeBytes / totalBytes) * 100)
-				}
-			}
+	if cfg.CertFile != "" && cfg.KeyFile != "" {
+		logger.Info("Loading exporter client certificate",
+			zap.String("cert", cfg.CertFile),
+			zap.String("key", cfg.KeyFile))
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load exporter client certificate: %w", err)
 		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	// Extract disk I/O rates for ALL drives using platform-specific metric names
-	now := time.Now()
-
-	// Lock for disk I/O cache operations
-	c.mu.Lock()
-
-	if !c.lastTimestamp.IsZero() {
-		timeDelta := now.Sub(c.lastTimestamp).Seconds()
-
-		if timeDelta > 0 {
-			// Read bytes for all drives
-			if family, ok := metricFamilies[metricNames.DiskReadBytes]; ok {
-				for _, m := range family.Metric {
-					volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-					if volume != "" && m.Counter != nil {
-						currentRead := m.Counter.GetValue()
-
-						// Check if we have previous measurement for this drive
-						if prevCounters, exists := c.lastDiskMetrics[volume]; exists && prevCounters.ReadBytes > 0 {
-							delta := currentRead - prevCounters.ReadBytes
-							if diskData[volume] == nil {
-								diskData[volume] = &DiskMetrics{Drive: volume}
-							}
-							diskData[volume].ReadBytesPerSec = utils.Round(delta / timeDelta)
-						}
-
-						// Store current value
-						counters := c.lastDiskMetrics[volume]
-						counters.ReadBytes = currentRead
-						c.lastDiskMetrics[volume] = counters
-					}
-				}
-			}
-
-			// Write bytes for all drives
-			if family, ok := metricFamilies[metricNames.DiskWriteBytes]; ok {
-				for _, m := range family.Metric {
-					volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-					if volume != "" && m.Counter != nil {
-						currentWrite := m.Counter.GetValue()
-
-						// Check if we have previous measurement for this drive
-						if prevCounters, exists := c.lastDiskMetrics[volume]; exists && prevCounters.WriteBytes > 0 {
-							delta := currentWrite - prevCounters.WriteBytes
-							if diskData[volume] == nil {
-								diskData[volume] = &DiskMetrics{Drive: volume}
-							}
-							diskData[volume].WriteBytesPerSec = utils.Round(delta / timeDelta)
-						}
-
-						// Store current value
-						counters := c.lastDiskMetrics[volume]
-						counters.WriteBytes = currentWrite
-						c.lastDiskMetrics[volume] = counters
-					}
-				}
-			}
-		}
-	} else {
-		// First scrape - just store baseline values for all drives
-		if family, ok := metricFamilies[metricNames.DiskReadBytes]; ok {
-			for _, m := range family.Metric {
-				volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-				if volume != "" && m.Counter != nil {
-					counters := c.lastDiskMetrics[volume]
-					counters.ReadBytes = m.Counter.GetValue()
-					c.lastDiskMetrics[volume] = counters
-				}
-			}
-		}
+	if cfg.InsecureSkipVerify {
+		logger.Warn("Exporter TLS certificate verification is DISABLED - this is insecure and should only be used in development")
+	}
+	return tlsConfig, nil
+}
 
-		if family, ok := metricFamilies[metricNames.DiskWriteBytes]; ok {
-			for _, m := range family.Metric {
-				volume := getLabelValue(m.Label, metricNames.VolumeLabel)
-				if volume != "" && m.Counter != nil {
-					counters := c.lastDiskMetrics[volume]
-					counters.WriteBytes = m.Counter.GetValue()
-					c.lastDiskMetrics[volume] = counters
-				}
-			}
-		}
+// parsePrometheusMetrics parses the scrape with parsePrometheus and derives
+// CPU and disk I/O rates from the collector's rate cache
+func (c *ExporterCollector) parsePrometheusMetrics(reader io.Reader) (*SystemMetrics, error) {
+	// Get platform-specific metric names
+	metricNames := GetMetricNames()
 
-		c.logger.Debug("Disk I/O baseline stored for all drives, will calculate on next scrape")
+	sample, err := parsePrometheus(reader, metricNames)
+	if err != nil {
+		return nil, err
 	}
 
-	c.lastTimestamp = now
-	c.mu.Unlock()
+	c.logger.Debug("Parsed metric families",
+		zap.Int("count", len(sample.Families)),
+		zap.Int64("bytes_read", sample.BytesRead),
+		zap.Int("bytes_parsed", sample.BytesParsed))
 
-	// Convert disk map to array for consistent output
-	metrics.Disks = make([]DiskMetrics, 0, len(diskData))
-	for _, disk := range diskData {
-		// Only include drives with actual data
-		if disk.TotalGB > 0 || disk.ReadBytesPerSec > 0 || disk.WriteBytesPerSec > 0 {
-			metrics.Disks = append(metrics.Disks, *disk)
+	// Drop filtered volumes before they reach the rate cache
+	for name := range sample.Volumes {
+		if !c.filter.Allows(name) {
+			delete(sample.Volumes, name)
 		}
 	}
 
+	_, hadBaseline := c.cache.Load()
+	rates := calculateRates(c.cache, sample.counters(time.Now()))
+	if !hadBaseline {
+		c.logger.Debug("CPU and disk I/O baseline stored (first scrape), will calculate on next scrape")
+	}
+
+	metrics := sample.systemMetrics(rates)
+
 	// Log warnings if metrics weren't found
-	if !cpuFound && !isFirstScrape {
+	if !rates.HasCPU && hadBaseline {
 		c.logger.Warn("CPU metric not found or could not be calculated",
 			zap.String("expected_metric", metricNames.CPUTime),
-			zap.Bool("has_metric", metricFamilies[metricNames.CPUTime] != nil),
-			zap.Bool("is_first_scrape", isFirstScrape))
+			zap.Bool("has_metric", sample.Families[metricNames.CPUTime]))
 	}
-	if !memoryFound {
+	if !sample.HasMemory {
 		c.logger.Warn("Memory metric not found",
 			zap.String("expected_metric", metricNames.MemoryFree),
-			zap.Bool("has_metric", metricFamilies[metricNames.MemoryFree] != nil))
+			zap.Bool("has_metric", sample.Families[metricNames.MemoryFree]))
 	}
 	if len(metrics.Disks) == 0 {
 		c.logger.Warn("No disk metrics found",
 			zap.String("expected_free_metric", metricNames.DiskFreeBytes),
 			zap.String("expected_size_metric", metricNames.DiskSizeBytes),
-			zap.Bool("has_free_metric", metricFamilies[metricNames.DiskFreeBytes] != nil),
-			zap.Bool("has_size_metric", metricFamilies[metricNames.DiskSizeBytes] != nil))
+			zap.Bool("has_free_metric", sample.Families[metricNames.DiskFreeBytes]),
+			zap.Bool("has_size_metric", sample.Families[metricNames.DiskSizeBytes]))
 	}
 
 	return metrics, nil
 }
 
 func (c *ExporterCollector) resetCacheIfStale() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if c.lastTimestamp.IsZero() {
-		return
-	}
-
-	age := time.Since(c.lastTimestamp)
-	if age > maxMetricsCacheAge {
+	age, ok := cacheAge(c.cache, time.Now())
+	if ok && age > maxMetricsCacheAge {
 		c.logger.Warn("Resetting stale metrics cache",
 			zap.Duration("cache_age", age),
 			zap.Duration("max_age", maxMetricsCacheAge),
 			zap.String("impact", "Next metrics will have no CPU/disk I/O rates (baseline reset)"))
-
-		c.lastTimestamp = time.Time{}
-		c.lastCPUTotal = 0
-		c.lastCPUIdle = 0
-		c.lastDiskMetrics = make(map[string]DiskCounters)
+		c.cache.Reset()
 	}
 }
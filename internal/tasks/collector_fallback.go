@@ -0,0 +1,142 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// FallbackCollector scrapes an exporter and switches to the builtin
+// collector after consecutive failed scrapes, so a crashed exporter doesn't
+// blind the agent to host metrics. While falling back the exporter is
+// tried again every retry interval, and used again once it answers.
+type FallbackCollector struct {
+	exporter      MetricsCollector
+	builtin       MetricsCollector
+	failures      int
+	retryInterval time.Duration
+	logger        *zap.Logger
+
+	mu          sync.Mutex
+	consecutive int       // Exporter failures in a row
+	reason      string    // Last exporter error while falling back; "" = using the exporter
+	lastTry     time.Time // Last exporter attempt while falling back
+	now         func() time.Time
+}
+
+// NewFallbackCollector wraps exporter, falling back to builtin after
+// failures consecutive failed scrapes
+func NewFallbackCollector(exporter, builtin MetricsCollector, failures int, retryInterval time.Duration, logger *zap.Logger) *FallbackCollector {
+	return &FallbackCollector{
+		exporter:      exporter,
+		builtin:       builtin,
+		failures:      failures,
+		retryInterval: retryInterval,
+		logger:        logger,
+		now:           time.Now,
+	}
+}
+
+func (c *FallbackCollector) Name() string {
+	if c.Fallback() != "" {
+		return fmt.Sprintf("%s, falling back to %s", c.exporter.Name(), c.builtin.Name())
+	}
+	return c.exporter.Name()
+}
+
+func (c *FallbackCollector) ResetCache() {
+	c.exporter.ResetCache()
+	c.builtin.ResetCache()
+}
+
+func (c *FallbackCollector) SetDiskFilter(filter *DiskFilter) {
+	c.exporter.SetDiskFilter(filter)
+	c.builtin.SetDiskFilter(filter)
+}
+
+// RateCache returns the exporter's baseline: the builtin collector's
+// counters only matter while falling back
+func (c *FallbackCollector) RateCache() RateCache {
+	return c.exporter.RateCache()
+}
+
+// Fallback returns the exporter error that caused the fallback, or "" while
+// the exporter is in use
+func (c *FallbackCollector) Fallback() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.reason
+}
+
+func (c *FallbackCollector) Collect(ctx context.Context) (*SystemMetrics, error) {
+	c.mu.Lock()
+	falling := c.reason != ""
+	retry := falling && c.now().Sub(c.lastTry) >= c.retryInterval
+	if retry {
+		c.lastTry = c.now()
+	}
+	c.mu.Unlock()
+
+	if !falling || retry {
+		exporterCtx := ctx
+		if retry {
+			// Leave the builtin collector time if the exporter still hangs
+			if deadline, ok := ctx.Deadline(); ok {
+				var cancel context.CancelFunc
+				exporterCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/2)
+				defer cancel()
+			}
+		}
+
+		metrics, err := c.exporter.Collect(exporterCtx)
+		if err == nil {
+			c.recordSuccess()
+			return metrics, nil
+		}
+		if !c.recordFailure(err) {
+			return nil, err
+		}
+	}
+
+	metrics, err := c.builtin.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	metrics.Fallback = c.Fallback()
+	return metrics, nil
+}
+
+// recordSuccess resets the failure count and ends a fallback
+func (c *FallbackCollector) recordSuccess() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reason != "" {
+		c.logger.Info("Exporter reachable again, leaving builtin fallback", zap.String("exporter", c.exporter.Name()))
+	}
+	c.consecutive = 0
+	c.reason = ""
+}
+
+// recordFailure counts an exporter failure and returns whether to fall
+// back for this scrape
+func (c *FallbackCollector) recordFailure(err error) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consecutive++
+	if c.reason == "" && c.consecutive < c.failures {
+		return false
+	}
+	if c.reason == "" {
+		c.logger.Warn("Exporter unreachable, falling back to builtin collector",
+			zap.String("exporter", c.exporter.Name()),
+			zap.Int("failures", c.consecutive),
+			zap.Duration("retry_interval", c.retryInterval),
+			zap.Error(err))
+		c.lastTry = c.now()
+	}
+	c.reason = err.Error()
+	return true
+}
@@ -0,0 +1,72 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeCollector returns fixed metrics, or err when set
+type fakeCollector struct {
+	name  string
+	cpu   float64
+	err   error
+	calls int
+}
+
+func (f *fakeCollector) Collect(ctx context.Context) (*SystemMetrics, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &SystemMetrics{CPUUsagePercent: f.cpu}, nil
+}
+func (f *fakeCollector) Name() string                     { return f.name }
+func (f *fakeCollector) ResetCache()                      {}
+func (f *fakeCollector) SetDiskFilter(filter *DiskFilter) {}
+func (f *fakeCollector) RateCache() RateCache             { return newMemoryRateCache() }
+
+// TestFallbackCollector tests the switch to the builtin collector after
+// consecutive failures, the periodic exporter retry, and the switch back
+func TestFallbackCollector(t *testing.T) {
+	exporter := &fakeCollector{name: "exporter", cpu: 10}
+	builtin := &fakeCollector{name: "builtin", cpu: 20}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	collector := NewFallbackCollector(exporter, builtin, 2, 10*time.Minute, zap.NewNop())
+	collector.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if m, err := collector.Collect(ctx); err != nil || m.CPUUsagePercent != 10 {
+		t.Fatalf("Collect() = %+v, %v, want the exporter's metrics", m, err)
+	}
+
+	// The first failure is reported, the second falls back
+	exporter.err = errors.New("connection refused")
+	if _, err := collector.Collect(ctx); err == nil {
+		t.Fatal("Collect() after one failure: want the exporter error")
+	}
+	m, err := collector.Collect(ctx)
+	if err != nil || m.CPUUsagePercent != 20 || m.Fallback != "connection refused" {
+		t.Fatalf("Collect() after two failures = %+v, %v, want builtin metrics marked as a fallback", m, err)
+	}
+	if collector.Fallback() == "" || collector.Name() != "exporter, falling back to builtin" {
+		t.Errorf("Fallback(), Name() = %q, %q", collector.Fallback(), collector.Name())
+	}
+
+	// The exporter isn't tried again before the retry interval
+	exporter.err = nil
+	calls := exporter.calls
+	now = now.Add(5 * time.Minute)
+	if m, _ := collector.Collect(ctx); m.CPUUsagePercent != 20 || exporter.calls != calls {
+		t.Errorf("Collect() within the retry interval tried the exporter")
+	}
+
+	now = now.Add(5 * time.Minute)
+	m, err = collector.Collect(ctx)
+	if err != nil || m.CPUUsagePercent != 10 || m.Fallback != "" || collector.Fallback() != "" {
+		t.Errorf("Collect() after the retry interval = %+v, %v, want the exporter back", m, err)
+	}
+}
@@ -0,0 +1,103 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// HybridCollector takes core host metrics (CPU, memory, disks) from the
+// builtin collector and adds selected families from an exporter, so a
+// device with a partially working exporter still reports complete core data
+type HybridCollector struct {
+	builtin     *BuiltinCollector
+	exporterURL string
+	request     *config.ExporterRequestConfig // Headers and credentials, nil = defaults
+	families    []string
+	logger      *zap.Logger
+	httpClient  *http.Client
+}
+
+// NewHybridCollector creates a collector that merges builtin metrics with
+// exporter families (set via SetExtraFamilies)
+func NewHybridCollector(url string, logger *zap.Logger, httpClient *http.Client) *HybridCollector {
+	return &HybridCollector{
+		builtin:     NewBuiltinCollector(logger),
+		exporterURL: url,
+		logger:      logger,
+		httpClient:  httpClient,
+	}
+}
+
+func (c *HybridCollector) Name() string {
+	return fmt.Sprintf("hybrid (gopsutil + %s)", c.exporterURL)
+}
+
+func (c *HybridCollector) ResetCache() {
+	c.builtin.ResetCache()
+}
+
+func (c *HybridCollector) SetDiskFilter(filter *DiskFilter) {
+	c.builtin.SetDiskFilter(filter)
+}
+
+func (c *HybridCollector) RateCache() RateCache {
+	return c.builtin.RateCache()
+}
+
+// SetExtraFamilies selects the exporter families added to each payload
+func (c *HybridCollector) SetExtraFamilies(families []string) {
+	c.families = families
+}
+
+// SetRequest sets the headers and credentials sent with each scrape
+func (c *HybridCollector) SetRequest(request *config.ExporterRequestConfig) {
+	c.request = request
+}
+
+func (c *HybridCollector) Collect(ctx context.Context) (*SystemMetrics, error) {
+	metrics, err := c.builtin.Collect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.families) == 0 {
+		return metrics, nil
+	}
+
+	// An exporter failure only loses the extra families
+	extra, err := c.collectExtra(ctx)
+	if err != nil {
+		c.logger.Warn("Exporter scrape failed, publishing builtin metrics only",
+			zap.String("url", c.exporterURL),
+			zap.Error(err))
+		metrics.ExtraError = err.Error()
+		return metrics, nil
+	}
+
+	for _, family := range c.families {
+		if _, ok := extra[family]; !ok {
+			c.logger.Debug("Exporter family not found", zap.String("family", family))
+		}
+	}
+	metrics.Extra = extra
+
+	return metrics, nil
+}
+
+func (c *HybridCollector) collectExtra(ctx context.Context) (map[string][]ExtraSample, error) {
+	body, err := scrapeExporter(ctx, c.httpClient, c.exporterURL, c.request, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	extra, err := parseFamilies(io.LimitReader(body, maxScrapeBytes), c.families)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return extra, nil
+}
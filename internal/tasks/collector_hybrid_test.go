@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestHybridCollector_Collect tests that exporter families are merged into
+// builtin metrics
+func TestHybridCollector_Collect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `# TYPE node_hwmon_temp_celsius gauge
+node_hwmon_temp_celsius{chip="cpu",sensor="temp1"} 48.5
+node_hwmon_temp_celsius{chip="nvme",sensor="temp1"} 39
+# TYPE node_textfile_scrape_error gauge
+node_textfile_scrape_error 0
+# TYPE go_goroutines gauge
+go_goroutines 12
+`)
+	}))
+	defer server.Close()
+
+	collector := NewHybridCollector(server.URL, zap.NewNop(), server.Client())
+	collector.SetExtraFamilies([]string{"node_hwmon_temp_celsius", "node_textfile_scrape_error", "node_missing_family"})
+
+	metrics, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if metrics.MemoryFreeGB <= 0 {
+		t.Errorf("MemoryFreeGB = %v, want builtin value", metrics.MemoryFreeGB)
+	}
+	if metrics.ExtraError != "" {
+		t.Errorf("ExtraError = %q, want empty", metrics.ExtraError)
+	}
+
+	temps := metrics.Extra["node_hwmon_temp_celsius"]
+	if len(temps) != 2 || temps[0].Labels["chip"] != "cpu" || temps[0].Value != 48.5 {
+		t.Errorf("node_hwmon_temp_celsius = %+v, want 2 labelled samples", temps)
+	}
+	if got := metrics.Extra["node_textfile_scrape_error"]; len(got) != 1 || got[0].Labels != nil {
+		t.Errorf("node_textfile_scrape_error = %+v, want 1 unlabelled sample", got)
+	}
+	for _, family := range []string{"go_goroutines", "node_missing_family"} {
+		if _, ok := metrics.Extra[family]; ok {
+			t.Errorf("Extra contains unselected or missing family %s", family)
+		}
+	}
+}
+
+// TestHybridCollector_ExporterDown tests that core metrics survive an
+// exporter failure
+func TestHybridCollector_ExporterDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "collector failed", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	collector := NewHybridCollector(server.URL, zap.NewNop(), server.Client())
+	collector.SetExtraFamilies([]string{"node_hwmon_temp_celsius"})
+
+	metrics, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v, want builtin metrics", err)
+	}
+	if metrics.MemoryFreeGB <= 0 {
+		t.Errorf("MemoryFreeGB = %v, want builtin value", metrics.MemoryFreeGB)
+	}
+	if !strings.Contains(metrics.ExtraError, "500") {
+		t.Errorf("ExtraError = %q, want status code", metrics.ExtraError)
+	}
+	if metrics.Extra != nil {
+		t.Errorf("Extra = %+v, want nil", metrics.Extra)
+	}
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// fakeCounterReader returns fixed samples and error
+type fakeCounterReader struct {
+	samples map[string][]CounterSample
+	err     error
+	closed  bool
+}
+
+func (f *fakeCounterReader) read() (map[string][]CounterSample, error) { return f.samples, f.err }
+func (f *fakeCounterReader) close()                                    { f.closed = true }
+
+// withCounterReader replaces newCounterReader for a test, recording the
+// paths it is opened with
+func withCounterReader(t *testing.T, reader *fakeCounterReader, openErr error) *[]string {
+	t.Helper()
+	var opened []string
+	saved := newCounterReader
+	newCounterReader = func(paths []string) (counterReader, error) {
+		opened = paths
+		if openErr != nil {
+			return nil, openErr
+		}
+		return reader, nil
+	}
+	t.Cleanup(func() { newCounterReader = saved })
+	return &opened
+}
+
+// TestPDHCollector_Collect tests that counters are merged into builtin
+// metrics, and that a partial failure keeps the counters that were read
+func TestPDHCollector_Collect(t *testing.T) {
+	paths := []string{`\Web Service(_Total)\Current Connections`, `\Process(w3wp*)\Working Set`, `\Missing\Counter`}
+	reader := &fakeCounterReader{
+		samples: map[string][]CounterSample{
+			paths[0]: {{Instance: "_Total", Value: 42}},
+			paths[1]: {{Instance: "w3wp", Value: 1.5e8}, {Instance: "w3wp#1", Value: 9e7}},
+		},
+		err: errors.New(`\Missing\Counter: counter object not found`),
+	}
+	opened := withCounterReader(t, reader, nil)
+
+	collector := NewPDHCollector(zap.NewNop())
+	collector.SetCounters(paths)
+	metrics, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if !slices.Equal(*opened, paths) {
+		t.Errorf("reader opened with %v, want %v", *opened, paths)
+	}
+	if metrics.MemoryFreeGB <= 0 {
+		t.Errorf("MemoryFreeGB = %v, want builtin value", metrics.MemoryFreeGB)
+	}
+	if got := metrics.Counters[paths[1]]; len(got) != 2 || got[1].Instance != "w3wp#1" {
+		t.Errorf("counters[%s] = %+v, want 2 instances", paths[1], got)
+	}
+	if metrics.CounterError == "" {
+		t.Error("CounterError is empty, want the missing counter")
+	}
+
+	// Changing the counters closes the reader and opens a new one
+	collector.SetCounters(paths[:1])
+	if !reader.closed {
+		t.Error("SetCounters() did not close the previous reader")
+	}
+	if _, err := collector.Collect(context.Background()); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(*opened) != 1 {
+		t.Errorf("reader reopened with %v, want 1 path", *opened)
+	}
+}
+
+// TestPDHCollector_OpenError tests that builtin metrics are still published
+// when the counters cannot be opened
+func TestPDHCollector_OpenError(t *testing.T) {
+	withCounterReader(t, nil, errors.New("PdhOpenQuery failed"))
+
+	collector := NewPDHCollector(zap.NewNop())
+	collector.SetCounters([]string{`\Memory\Available Bytes`})
+	metrics, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if metrics.Counters != nil || metrics.CounterError == "" {
+		t.Errorf("Counters = %v, CounterError = %q; want no counters and an error", metrics.Counters, metrics.CounterError)
+	}
+}
@@ -2,10 +2,21 @@ package tasks
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/stone-age-io/agent/internal/config"
 	"go.uber.org/zap"
 )
 
@@ -109,6 +120,198 @@ func TestExporterCollector_Name(t *testing.T) {
 	}
 }
 
+// TestScrapeExporterRequest tests that scrapes carry the configured
+// User-Agent, headers, Host and credentials
+func TestScrapeExporterRequest(t *testing.T) {
+	t.Setenv("TEST_EXPORTER_PASSWORD", "s3cret")
+	t.Setenv("TEST_EXPORTER_TOKEN", "tok")
+	t.Setenv("TEST_EXPORTER_TENANT", "site-1")
+
+	tests := []struct {
+		name    string
+		request *config.ExporterRequestConfig
+		check   func(t *testing.T, r *http.Request)
+	}{
+		{
+			name:    "defaults",
+			request: nil,
+			check: func(t *testing.T, r *http.Request) {
+				if ua := r.UserAgent(); ua != "stone-age-agent/1.0" {
+					t.Errorf("User-Agent = %q", ua)
+				}
+				if auth := r.Header.Get("Authorization"); auth != "" {
+					t.Errorf("Authorization = %q, want none", auth)
+				}
+			},
+		},
+		{
+			name: "headers and basic auth",
+			request: &config.ExporterRequestConfig{
+				UserAgent:   "site-agent",
+				Headers:     map[string]string{"X-Tenant": "${TEST_EXPORTER_TENANT}", "Host": "metrics.internal"},
+				Username:    "scraper",
+				PasswordEnv: "TEST_EXPORTER_PASSWORD",
+			},
+			check: func(t *testing.T, r *http.Request) {
+				if ua := r.UserAgent(); ua != "site-agent" {
+					t.Errorf("User-Agent = %q, want site-agent", ua)
+				}
+				if tenant := r.Header.Get("X-Tenant"); tenant != "site-1" {
+					t.Errorf("X-Tenant = %q, want site-1", tenant)
+				}
+				if r.Host != "metrics.internal" {
+					t.Errorf("Host = %q, want metrics.internal", r.Host)
+				}
+				if user, password, ok := r.BasicAuth(); !ok || user != "scraper" || password != "s3cret" {
+					t.Errorf("basic auth = %q, %q, %v", user, password, ok)
+				}
+			},
+		},
+		{
+			name:    "bearer token",
+			request: &config.ExporterRequestConfig{BearerTokenEnv: "TEST_EXPORTER_TOKEN"},
+			check: func(t *testing.T, r *http.Request) {
+				if auth := r.Header.Get("Authorization"); auth != "Bearer tok" {
+					t.Errorf("Authorization = %q, want Bearer tok", auth)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+			}))
+			defer server.Close()
+
+			body, err := scrapeExporter(context.Background(), server.Client(), server.URL, tt.request, zap.NewNop())
+			if err != nil {
+				t.Fatalf("scrapeExporter() error = %v", err)
+			}
+			body.Close()
+			tt.check(t, got)
+		})
+	}
+}
+
+// TestExporterTLS tests scraping an https exporter that requires a client
+// certificate and is signed by a private CA
+func TestExporterTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Expected handshake failures
+	server.StartTLS()
+	defer server.Close()
+
+	// The test server's own key pair serves as CA and client certificate
+	dir := t.TempDir()
+	write := func(name string, block *pem.Block) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	pair := server.TLS.Certificates[0]
+	key, err := x509.MarshalPKCS8PrivateKey(pair.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := write("ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	keyFile := write("client.key", &pem.Block{Type: "PRIVATE KEY", Bytes: key})
+
+	tests := []struct {
+		name    string
+		tls     config.ExporterTLSConfig
+		wantErr string
+	}{
+		{"no CA", config.ExporterTLSConfig{}, "certificate"},
+		{"no client certificate", config.ExporterTLSConfig{CAFile: caFile}, "certificate required"},
+		{"mTLS", config.ExporterTLSConfig{CAFile: caFile, CertFile: caFile, KeyFile: keyFile}, ""},
+		{"skip verify", config.ExporterTLSConfig{InsecureSkipVerify: true, CertFile: caFile, KeyFile: keyFile}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, err := NewExecutor(zap.NewNop(), time.Second, context.Background(), "exporter", server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := executor.SetExporterTLS(tt.tls); err != nil {
+				t.Fatalf("SetExporterTLS() error = %v", err)
+			}
+
+			_, err = executor.CheckExporter(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("CheckExporter() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("CheckExporter() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestUnixSocketURL tests splitting unix:// exporter URLs into the socket
+// and the requested path
+func TestUnixSocketURL(t *testing.T) {
+	tests := []struct {
+		raw        string
+		wantSocket string
+		wantURL    string
+		wantOK     bool
+	}{
+		{"unix:///run/exporter.sock", "/run/exporter.sock", "http://localhost/metrics", true},
+		{"unix:///run/exporter.sock?path=/stats/prometheus", "/run/exporter.sock", "http://localhost/stats/prometheus", true},
+		{"unix:///run/exporter.sock?path=metrics", "/run/exporter.sock", "http://localhost/metrics", true},
+		{"unix:///C:/ProgramData/exporter.sock", "C:/ProgramData/exporter.sock", "http://localhost/metrics", true},
+		{"UNIX:///run/exporter.sock", "/run/exporter.sock", "http://localhost/metrics", true},
+		{"http://localhost:9100/metrics", "", "", false},
+		{"unix://", "", "", false},
+	}
+
+	for _, tt := range tests {
+		socket, httpURL, ok := unixSocketURL(tt.raw)
+		if socket != tt.wantSocket || httpURL != tt.wantURL || ok != tt.wantOK {
+			t.Errorf("unixSocketURL(%q) = %q, %q, %v, want %q, %q, %v", tt.raw, socket, httpURL, ok, tt.wantSocket, tt.wantURL, tt.wantOK)
+		}
+	}
+}
+
+// TestExporterUnixSocket tests scraping an exporter that only listens on a
+// unix socket
+func TestExporterUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "exporter.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	var gotPath string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	executor, err := NewExecutor(zap.NewNop(), time.Second, context.Background(), "exporter", "unix:///"+strings.TrimPrefix(filepath.ToSlash(socket), "/")+"?path=/probe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.CheckExporter(context.Background()); err != nil {
+		t.Fatalf("CheckExporter() error = %v", err)
+	}
+	if gotPath != "/probe" {
+		t.Errorf("requested %q, want /probe", gotPath)
+	}
+}
+
 // TestCollectorFactory tests the collector factory function
 func TestCollectorFactory(t *testing.T) {
 	logger := zap.NewNop()
@@ -141,6 +344,17 @@ func TestCollectorFactory(t *testing.T) {
 			source:      "exporter",
 			expectError: true,
 		},
+		{
+			name:        "hybrid with URL",
+			source:      "hybrid",
+			exporterURL: "http://localhost:9100/metrics",
+			expectType:  "hybrid",
+		},
+		{
+			name:        "hybrid without URL fails",
+			source:      "hybrid",
+			expectError: true,
+		},
 		{
 			name:        "invalid source fails",
 			source:      "invalid",
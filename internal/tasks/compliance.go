@@ -0,0 +1,285 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TaskCompliance is the task name of the compliance baseline check
+const TaskCompliance = "compliance"
+
+// Compliance rule outcomes
+const (
+	ComplianceStatusPass    = "pass"
+	ComplianceStatusFail    = "fail"
+	ComplianceStatusError   = "error"   // The check could not be evaluated
+	ComplianceStatusSkipped = "skipped" // The check is not supported on this platform
+)
+
+// errComplianceUnsupported is returned by probes this platform lacks
+var errComplianceUnsupported = errors.New("not supported on this platform")
+
+// ComplianceResult is the outcome of one rule
+type ComplianceResult struct {
+	ID       string `json:"id"`
+	Title    string `json:"title,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Status   string `json:"status"`            // One of the ComplianceStatus* constants
+	Actual   string `json:"actual,omitempty"`  // Observed value
+	Expected string `json:"expected"`          // Op and value, e.g. "min 14"
+	Message  string `json:"message,omitempty"` // Why the rule failed, errored or was skipped
+}
+
+// ComplianceSummary counts results by status
+type ComplianceSummary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+}
+
+// ComplianceMessage is published on {prefix}.{code}.telemetry.compliance
+// after each baseline check. Code/Location/MessageMeta are stamped by the
+// scheduler.
+type ComplianceMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Baseline string             `json:"baseline"`           // "config" or "kv:<bucket>/<key>"
+	Revision uint64             `json:"revision,omitempty"` // KV revision of the baseline
+	Summary  ComplianceSummary  `json:"summary"`
+	Results  []ComplianceResult `json:"results"`
+	TS       string             `json:"ts"`
+}
+
+// ParseComplianceBaseline decodes and validates a baseline kept in KV: a
+// JSON array of rules
+func ParseComplianceBaseline(data []byte) ([]config.ComplianceRule, error) {
+	var rules []config.ComplianceRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid baseline JSON: %w", err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("baseline has no rules")
+	}
+	if err := config.ValidateComplianceRules(rules); err != nil {
+		return nil, fmt.Errorf("invalid baseline: %w", err)
+	}
+	return rules, nil
+}
+
+// CheckCompliance evaluates rules in order. Rules not reached before ctx
+// ends are reported as errors.
+func (e *Executor) CheckCompliance(ctx context.Context, rules []config.ComplianceRule) *ComplianceMessage {
+	msg := &ComplianceMessage{Results: make([]ComplianceResult, 0, len(rules))}
+	for _, rule := range rules {
+		var result ComplianceResult
+		if err := ctx.Err(); err != nil {
+			result = newComplianceResult(rule)
+			result.Status = ComplianceStatusError
+			result.Message = "not evaluated: " + err.Error()
+		} else {
+			result = e.checkRule(rule)
+		}
+
+		switch result.Status {
+		case ComplianceStatusPass:
+			msg.Summary.Passed++
+		case ComplianceStatusFail:
+			msg.Summary.Failed++
+		case ComplianceStatusError:
+			msg.Summary.Errors++
+		case ComplianceStatusSkipped:
+			msg.Summary.Skipped++
+		}
+		msg.Results = append(msg.Results, result)
+	}
+	msg.Summary.Total = len(msg.Results)
+	msg.TS = utils.NowRFC3339()
+	return msg
+}
+
+// newComplianceResult returns a result carrying the rule's identity
+func newComplianceResult(rule config.ComplianceRule) ComplianceResult {
+	expected := rule.Op
+	if rule.Value != "" {
+		expected += " " + rule.Value
+	}
+	target := rule.Target
+	if rule.Name != "" {
+		target += `\` + rule.Name
+	}
+	return ComplianceResult{
+		ID:       rule.ID,
+		Title:    rule.Title,
+		Severity: rule.Severity,
+		Type:     rule.Type,
+		Target:   target,
+		Expected: expected,
+	}
+}
+
+// checkRule probes a rule's target and compares it with the expected value
+func (e *Executor) checkRule(rule config.ComplianceRule) ComplianceResult {
+	result := newComplianceResult(rule)
+
+	var actual string
+	var err error
+	switch rule.Type {
+	case "file":
+		return checkFileRule(rule, result)
+	case "sysctl":
+		actual, err = readSysctl(rule.Target)
+	case "registry":
+		actual, err = readRegistry(rule.Target, rule.Name, rule.Op == "exists" || rule.Op == "absent")
+	case "service":
+		actual, err = e.serviceState(rule.Target)
+	case "password_policy":
+		actual, err = readPasswordPolicy(rule.Target)
+	default:
+		err = fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+
+	found := !errors.Is(err, os.ErrNotExist)
+	if err != nil && found {
+		return complianceError(result, err)
+	}
+	result.Actual = actual
+
+	switch rule.Op {
+	case "exists":
+		return complianceVerdict(result, found, "not found")
+	case "absent":
+		return complianceVerdict(result, !found, "present")
+	}
+	if !found {
+		return complianceVerdict(result, false, "not found")
+	}
+	ok, err := compareCompliance(rule.Op, actual, rule.Value)
+	if err != nil {
+		return complianceError(result, err)
+	}
+	return complianceVerdict(result, ok, "")
+}
+
+// checkFileRule checks a file's existence, permissions or owner
+func checkFileRule(rule config.ComplianceRule, result ComplianceResult) ComplianceResult {
+	info, err := os.Stat(rule.Target)
+	found := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return complianceError(result, err)
+	}
+
+	switch rule.Op {
+	case "exists":
+		return complianceVerdict(result, found, "not found")
+	case "absent":
+		return complianceVerdict(result, !found, "present")
+	}
+	if !found {
+		return complianceVerdict(result, false, "not found")
+	}
+
+	switch rule.Op {
+	case "mode_max":
+		mode, err := fileMode(info)
+		if err != nil {
+			return complianceError(result, err)
+		}
+		limit, _ := strconv.ParseUint(rule.Value, 8, 32)
+		result.Actual = fmt.Sprintf("%04o", mode)
+		return complianceVerdict(result, uint64(mode)&^limit == 0, "")
+	case "owner":
+		name, uid, err := fileOwner(info)
+		if err != nil {
+			return complianceError(result, err)
+		}
+		result.Actual = name
+		return complianceVerdict(result, rule.Value == name || rule.Value == uid, "")
+	}
+	return complianceError(result, fmt.Errorf("unknown op %q", rule.Op))
+}
+
+// serviceState returns a service's status, one of the ServiceStatus*
+// constants
+func (e *Executor) serviceState(name string) (string, error) {
+	statuses, err := e.GetServiceStatuses([]string{name})
+	if err != nil {
+		return "", err
+	}
+	if len(statuses) == 0 {
+		return ServiceStatusUnknown, nil
+	}
+	return statuses[0].Status, nil
+}
+
+// compareCompliance applies a comparison op. eq and ne ignore case; min and
+// max compare numbers, with "never" counting as unlimited.
+func compareCompliance(op, actual, want string) (bool, error) {
+	switch op {
+	case "eq":
+		return strings.EqualFold(actual, want), nil
+	case "ne":
+		return !strings.EqualFold(actual, want), nil
+	case "min", "max":
+		got, err := complianceNumber(actual)
+		if err != nil {
+			return false, fmt.Errorf("actual value %q is not a number", actual)
+		}
+		limit, err := complianceNumber(want)
+		if err != nil {
+			return false, fmt.Errorf("expected value %q is not a number", want)
+		}
+		if op == "min" {
+			return got >= limit, nil
+		}
+		return got <= limit, nil
+	}
+	return false, fmt.Errorf("unknown op %q", op)
+}
+
+// complianceNumber parses a numeric setting
+func complianceNumber(s string) (float64, error) {
+	if s == policyNever {
+		return math.Inf(1), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// policyNever is the actual value of a password policy age that is
+// unlimited
+const policyNever = "never"
+
+// complianceVerdict sets pass or fail, with a message for a failure
+func complianceVerdict(result ComplianceResult, ok bool, failure string) ComplianceResult {
+	if ok {
+		result.Status = ComplianceStatusPass
+		return result
+	}
+	result.Status = ComplianceStatusFail
+	result.Message = failure
+	return result
+}
+
+// complianceError reports a probe error; unsupported probes are skipped
+func complianceError(result ComplianceResult, err error) ComplianceResult {
+	result.Status = ComplianceStatusError
+	if errors.Is(err, errComplianceUnsupported) {
+		result.Status = ComplianceStatusSkipped
+	}
+	result.Message = err.Error()
+	return result
+}
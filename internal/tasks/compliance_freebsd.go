@@ -0,0 +1,29 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// readSysctl reads a sysctl value. Multi-field values are joined with
+// single spaces.
+func readSysctl(key string) (string, error) {
+	value, err := sysctlString(key)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("unknown sysctl %s: %w", key, os.ErrNotExist)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(value), " "), nil
+}
+
+// readPasswordPolicy is not supported: FreeBSD sets password policy per
+// login class in login.conf
+func readPasswordPolicy(setting string) (string, error) {
+	return "", errComplianceUnsupported
+}
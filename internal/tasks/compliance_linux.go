@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// procSys is where Linux exposes sysctl values
+const procSys = "/proc/sys"
+
+// readSysctl reads a sysctl value from /proc/sys. Multi-field values (e.g.
+// net.ipv4.tcp_rmem) are joined with single spaces.
+func readSysctl(key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(procSys, strings.ReplaceAll(key, ".", "/")))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(string(data)), " "), nil
+}
+
+// passwordPolicySources maps each password_policy setting to the files and
+// keys that set it, most specific first
+var passwordPolicySources = map[string][]policySource{
+	"min_length":        {{"/etc/security/pwquality.conf", "minlen"}, {"/etc/login.defs", "PASS_MIN_LEN"}},
+	"max_age_days":      {{"/etc/login.defs", "PASS_MAX_DAYS"}},
+	"min_age_days":      {{"/etc/login.defs", "PASS_MIN_DAYS"}},
+	"history":           {{"/etc/security/pwhistory.conf", "remember"}},
+	"lockout_threshold": {{"/etc/security/faillock.conf", "deny"}},
+}
+
+// policySource is a key in a "key value" or "key = value" config file
+type policySource struct {
+	path string
+	key  string
+}
+
+// readPasswordPolicy returns a password policy setting from the shadow
+// suite and PAM module configs. An unset setting is os.ErrNotExist.
+func readPasswordPolicy(setting string) (string, error) {
+	sources, ok := passwordPolicySources[setting]
+	if !ok {
+		return "", errComplianceUnsupported
+	}
+	for _, source := range sources {
+		value, err := readPolicyValue(source.path, source.key)
+		if err == nil {
+			return value, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("%s is not set: %w", setting, os.ErrNotExist)
+}
+
+// readPolicyValue returns the last uncommented value of key in a config
+// file
+func readPolicyValue(path, key string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	value, found := "", false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			if i := strings.IndexAny(line, " \t"); i > 0 {
+				k, v = line[:i], line[i:]
+			}
+		}
+		if strings.TrimSpace(k) != key {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return "", fmt.Errorf("%s in %s is not a number: %q", key, path, v)
+		}
+		value, found = v, true
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	if !found {
+		return "", os.ErrNotExist
+	}
+	return value, nil
+}
@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSysctl(t *testing.T) {
+	if value, err := readSysctl("kernel.ostype"); err != nil || value != "Linux" {
+		t.Errorf("readSysctl(kernel.ostype) = %q, %v", value, err)
+	}
+	if _, err := readSysctl("kernel.no_such_key"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("readSysctl(missing) error = %v, want ErrNotExist", err)
+	}
+}
+
+func TestReadPolicyValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "login.defs")
+	os.WriteFile(path, []byte("# PASS_MAX_DAYS 1\nPASS_MAX_DAYS\t99999\nPASS_MIN_LEN 5\nPASS_MIN_LEN 8\n"), 0600)
+	pwquality := filepath.Join(t.TempDir(), "pwquality.conf")
+	os.WriteFile(pwquality, []byte("# minlen = 9\nminlen = 14\nbadvalue = x\n"), 0600)
+
+	tests := []struct {
+		path, key, want string
+		wantErr         bool
+	}{
+		{path, "PASS_MAX_DAYS", "99999", false},
+		{path, "PASS_MIN_LEN", "8", false}, // Last one wins
+		{pwquality, "minlen", "14", false},
+		{pwquality, "badvalue", "", true},
+		{path, "PASS_WARN_AGE", "", true},
+	}
+	for _, tt := range tests {
+		got, err := readPolicyValue(tt.path, tt.key)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("readPolicyValue(%s) = %q, %v; want %q", tt.key, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !windows && !linux && !freebsd
+
+package tasks
+
+import "os"
+
+// fileMode is a stub for unsupported platforms
+func fileMode(info os.FileInfo) (uint32, error) {
+	return 0, errComplianceUnsupported
+}
+
+// fileOwner is a stub for unsupported platforms
+func fileOwner(info os.FileInfo) (string, string, error) {
+	return "", "", errComplianceUnsupported
+}
+
+// readSysctl is a stub for unsupported platforms
+func readSysctl(key string) (string, error) {
+	return "", errComplianceUnsupported
+}
+
+// readRegistry is a stub for unsupported platforms
+func readRegistry(key, name string, keyOnly bool) (string, error) {
+	return "", errComplianceUnsupported
+}
+
+// readPasswordPolicy is a stub for unsupported platforms
+func readPasswordPolicy(setting string) (string, error) {
+	return "", errComplianceUnsupported
+}
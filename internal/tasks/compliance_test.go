@@ -0,0 +1,111 @@
+package tasks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestCheckCompliance(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "secret")
+	if err := os.WriteFile(secret, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chmod(secret, 0640) // Not subject to umask
+	missing := filepath.Join(dir, "missing")
+
+	rules := []config.ComplianceRule{
+		{ID: "exists", Type: "file", Target: secret, Op: "exists"},
+		{ID: "absent", Type: "file", Target: missing, Op: "absent"},
+		{ID: "missing", Type: "file", Target: missing, Op: "exists"},
+		{ID: "mode-ok", Type: "file", Target: secret, Op: "mode_max", Value: "0640"},
+		{ID: "mode-too-open", Type: "file", Target: secret, Op: "mode_max", Value: "0600"},
+		{ID: "mode-missing", Type: "file", Target: missing, Op: "mode_max", Value: "0600"},
+	}
+	msg := executor.CheckCompliance(context.Background(), rules)
+
+	want := map[string]string{
+		"exists":        ComplianceStatusPass,
+		"absent":        ComplianceStatusPass,
+		"missing":       ComplianceStatusFail,
+		"mode-ok":       ComplianceStatusPass,
+		"mode-too-open": ComplianceStatusFail,
+		"mode-missing":  ComplianceStatusFail,
+	}
+	if runtime.GOOS == "windows" {
+		want["mode-ok"] = ComplianceStatusSkipped
+		want["mode-too-open"] = ComplianceStatusSkipped
+	}
+	for _, result := range msg.Results {
+		if result.Status != want[result.ID] {
+			t.Errorf("%s: status = %s (%s), want %s", result.ID, result.Status, result.Message, want[result.ID])
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if got := msg.Results[4]; got.Actual != "0640" || got.Expected != "mode_max 0600" {
+			t.Errorf("mode-too-open: actual %q, expected %q", got.Actual, got.Expected)
+		}
+		if s := msg.Summary; s.Total != 6 || s.Passed != 3 || s.Failed != 3 {
+			t.Errorf("Summary = %+v", s)
+		}
+	}
+
+	// Rules not reached before the deadline are errors
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msg = executor.CheckCompliance(ctx, rules[:2])
+	if msg.Summary.Errors != 2 || msg.Results[0].Status != ComplianceStatusError {
+		t.Errorf("cancelled: Summary = %+v", msg.Summary)
+	}
+}
+
+func TestCompareCompliance(t *testing.T) {
+	tests := []struct {
+		op, actual, want string
+		ok               bool
+		wantErr          bool
+	}{
+		{"eq", "Running", "running", true, false},
+		{"eq", "1", "0", false, false},
+		{"ne", "Stopped", "Running", true, false},
+		{"min", "14", "12", true, false},
+		{"min", "8", "12", false, false},
+		{"max", "90", "90", true, false},
+		{"max", policyNever, "365", false, false},
+		{"min", "abc", "1", false, true},
+	}
+	for _, tt := range tests {
+		ok, err := compareCompliance(tt.op, tt.actual, tt.want)
+		if ok != tt.ok || (err != nil) != tt.wantErr {
+			t.Errorf("compareCompliance(%s, %q, %q) = %v, %v; want %v, err %v", tt.op, tt.actual, tt.want, ok, err, tt.ok, tt.wantErr)
+		}
+	}
+}
+
+func TestParseComplianceBaseline(t *testing.T) {
+	rules, err := ParseComplianceBaseline([]byte(`[{"id":"ip-forward","type":"sysctl","target":"net.ipv4.ip_forward","op":"eq","value":"0"}]`))
+	if err != nil || len(rules) != 1 || rules[0].Target != "net.ipv4.ip_forward" {
+		t.Fatalf("ParseComplianceBaseline() = %+v, %v", rules, err)
+	}
+
+	for name, data := range map[string]string{
+		"not json": `rules: []`,
+		"empty":    `[]`,
+		"invalid":  `[{"id":"x","type":"sysctl","target":"a","op":"exists"}]`,
+	} {
+		if _, err := ParseComplianceBaseline([]byte(data)); err == nil {
+			t.Errorf("%s: ParseComplianceBaseline() succeeded", name)
+		}
+	}
+}
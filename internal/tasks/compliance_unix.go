@@ -0,0 +1,40 @@
+//go:build linux || freebsd
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// fileMode returns a file's permission bits, including setuid, setgid and
+// sticky, in their Unix positions
+func fileMode(info os.FileInfo) (uint32, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no stat data for %s", info.Name())
+	}
+	return uint32(stat.Mode) & 0o7777, nil
+}
+
+// fileOwner returns the name (or uid, if it has no name) and uid of a
+// file's owner
+func fileOwner(info os.FileInfo) (string, string, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", fmt.Errorf("no stat data for %s", info.Name())
+	}
+	uid := strconv.FormatUint(uint64(stat.Uid), 10)
+	if u, err := user.LookupId(uid); err == nil {
+		return u.Username, uid, nil
+	}
+	return uid, uid, nil
+}
+
+// readRegistry is Windows only
+func readRegistry(key, name string, keyOnly bool) (string, error) {
+	return "", errComplianceUnsupported
+}
@@ -0,0 +1,114 @@
+//go:build windows
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// fileMode is not supported: Windows permissions are ACLs, not mode bits
+func fileMode(info os.FileInfo) (uint32, error) {
+	return 0, errComplianceUnsupported
+}
+
+// fileOwner is not supported on Windows
+func fileOwner(info os.FileInfo) (string, string, error) {
+	return "", "", errComplianceUnsupported
+}
+
+// readSysctl is not supported on Windows
+func readSysctl(key string) (string, error) {
+	return "", errComplianceUnsupported
+}
+
+// readRegistry reads a registry value (name, or the default value if name
+// is empty). With keyOnly and no name, only the key's existence is checked.
+// A missing key or value is os.ErrNotExist. MULTI_SZ values are joined
+// with commas.
+func readRegistry(path, name string, keyOnly bool) (string, error) {
+	if keyOnly && name == "" {
+		k, err := openRegistryKey(path, registry.QUERY_VALUE)
+		if err != nil {
+			return "", err
+		}
+		k.Close()
+		return "", nil
+	}
+	value, err := readRegistryValue(path, name)
+	if err != nil {
+		return "", err
+	}
+	if value.Type == "multi_string" {
+		return strings.Join(value.Values, ","), nil
+	}
+	return value.Value, nil
+}
+
+// userModalsInfo0 is USER_MODALS_INFO_0
+type userModalsInfo0 struct {
+	minPasswdLen    uint32
+	maxPasswdAge    uint32 // Seconds
+	minPasswdAge    uint32 // Seconds
+	forceLogoff     uint32
+	passwordHistLen uint32
+}
+
+// userModalsInfo3 is USER_MODALS_INFO_3
+type userModalsInfo3 struct {
+	lockoutDuration          uint32
+	lockoutObservationWindow uint32
+	lockoutThreshold         uint32
+}
+
+// timeqForever is TIMEQ_FOREVER, a password age that never expires
+const timeqForever = 0xFFFFFFFF
+
+// readPasswordPolicy returns a local account policy setting via
+// NetUserModalsGet
+func readPasswordPolicy(setting string) (string, error) {
+	level := uint32(0)
+	if setting == "lockout_threshold" {
+		level = 3
+	}
+
+	netapi32 := syscall.NewLazyDLL("netapi32.dll")
+	netUserModalsGet := netapi32.NewProc("NetUserModalsGet")
+	var buf *byte
+	ret, _, _ := netUserModalsGet.Call(0, uintptr(level), uintptr(unsafe.Pointer(&buf)))
+	if ret != 0 {
+		return "", fmt.Errorf("NetUserModalsGet failed: %w", syscall.Errno(ret))
+	}
+	defer windows.NetApiBufferFree(buf)
+
+	if level == 3 {
+		info := (*userModalsInfo3)(unsafe.Pointer(buf))
+		return strconv.FormatUint(uint64(info.lockoutThreshold), 10), nil
+	}
+
+	info := (*userModalsInfo0)(unsafe.Pointer(buf))
+	days := func(seconds uint32) string {
+		if seconds == timeqForever {
+			return policyNever
+		}
+		return strconv.FormatUint(uint64(seconds/86400), 10)
+	}
+	switch setting {
+	case "min_length":
+		return strconv.FormatUint(uint64(info.minPasswdLen), 10), nil
+	case "max_age_days":
+		return days(info.maxPasswdAge), nil
+	case "min_age_days":
+		return days(info.minPasswdAge), nil
+	case "history":
+		return strconv.FormatUint(uint64(info.passwordHistLen), 10), nil
+	}
+	return "", errComplianceUnsupported
+}
@@ -0,0 +1,41 @@
+package tasks
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// EncodingZstd names zstd compression, in the Agent-Encoding header of
+// compressed messages and for diagnostics bundles
+const EncodingZstd = "zstd"
+
+// zstdOptions keep the encoder small enough for low-resource devices: one
+// goroutine and a 1MB window, which still gets most of the gain on JSON
+// and log text
+var zstdOptions = []zstd.EOption{
+	zstd.WithEncoderConcurrency(1),
+	zstd.WithWindowSize(1 << 20),
+	zstd.WithLowerEncoderMem(true),
+}
+
+// zstdEncoder is shared by CompressZstd and built on first use, so agents
+// that never compress don't hold its buffers
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, err := zstd.NewWriter(nil, zstdOptions...)
+	if err != nil {
+		panic(err) // Only on invalid options
+	}
+	return enc
+})
+
+// CompressZstd returns data as a zstd frame. Safe for concurrent use.
+func CompressZstd(data []byte) []byte {
+	return zstdEncoder().EncodeAll(data, make([]byte, 0, len(data)/2))
+}
+
+// newZstdWriter returns a streaming zstd writer to w, for archives
+func newZstdWriter(w io.Writer) (*zstd.Encoder, error) {
+	return zstd.NewWriter(w, zstdOptions...)
+}
@@ -0,0 +1,35 @@
+package tasks
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestCompressZstd tests that compressed payloads decode to the original
+func TestCompressZstd(t *testing.T) {
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+
+	for _, data := range [][]byte{
+		{},
+		[]byte(`{"status":"success"}`),
+		bytes.Repeat([]byte(`{"name":"sshd","state":"running"},`), 500),
+	} {
+		compressed := CompressZstd(data)
+		got, err := dec.DecodeAll(compressed, nil)
+		if err != nil {
+			t.Fatalf("DecodeAll() error = %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("round trip of %d bytes got %d bytes", len(data), len(got))
+		}
+		if len(data) > 1000 && len(compressed) > len(data)/5 {
+			t.Errorf("compressed %d bytes to %d, want under 20%%", len(data), len(compressed))
+		}
+	}
+}
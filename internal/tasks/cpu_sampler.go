@@ -0,0 +1,128 @@
+package tasks
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stone-age-io/agent/internal/utils"
+	"go.uber.org/zap"
+)
+
+// maxCPUSamples bounds the sample buffer when scrapes stop (paused task,
+// long outage); the oldest samples are dropped first
+const maxCPUSamples = 10000
+
+// CPUStats summarizes CPU usage sampled within one reporting interval
+// (tasks.system_metrics.cpu_sample_interval)
+type CPUStats struct {
+	AvgPercent float64 `json:"avg_percent"`
+	MaxPercent float64 `json:"max_percent"`
+	P95Percent float64 `json:"p95_percent"`
+	Samples    int     `json:"samples"`
+}
+
+// cpuSampler measures host CPU usage every few seconds between scrapes
+type cpuSampler struct {
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	samples []float64
+	last    cpu.TimesStat
+	hasLast bool
+}
+
+func newCPUSampler(logger *zap.Logger) *cpuSampler {
+	return &cpuSampler{logger: logger}
+}
+
+// run samples every interval until ctx is cancelled
+func (s *cpuSampler) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.sample(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sample(ctx)
+		}
+	}
+}
+
+func (s *cpuSampler) sample(ctx context.Context) {
+	times, err := cpu.TimesWithContext(ctx, false) // false = combined
+	if err != nil || len(times) == 0 {
+		s.logger.Debug("CPU sample failed", zap.Error(err))
+		return
+	}
+	current := times[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.hasLast {
+		if percent, ok := cpuPercent(s.last, current); ok {
+			if len(s.samples) >= maxCPUSamples {
+				s.samples = s.samples[1:]
+			}
+			s.samples = append(s.samples, percent)
+		}
+	}
+	s.last = current
+	s.hasLast = true
+}
+
+// flush summarizes and clears the samples taken since the previous flush.
+// Returns nil when there are none.
+func (s *cpuSampler) flush() *CPUStats {
+	s.mu.Lock()
+	samples := s.samples
+	s.samples = nil
+	s.mu.Unlock()
+
+	return summarizeCPU(samples)
+}
+
+// cpuPercent returns busy CPU between two readings, counting idle and iowait
+// as not busy (the same definition the collectors use)
+func cpuPercent(prev, cur cpu.TimesStat) (float64, bool) {
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+	totalDelta := total(cur) - total(prev)
+	idleDelta := (cur.Idle + cur.Iowait) - (prev.Idle + prev.Iowait)
+	if totalDelta <= 0 || idleDelta < 0 || idleDelta > totalDelta {
+		return 0, false
+	}
+	return (totalDelta - idleDelta) / totalDelta * 100, true
+}
+
+// summarizeCPU returns avg, max and nearest-rank p95 of samples
+func summarizeCPU(samples []float64) *CPUStats {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	sorted := make([]float64, len(samples))
+	copy(sorted, samples)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+
+	return &CPUStats{
+		AvgPercent: utils.Round(sum / float64(len(sorted))),
+		MaxPercent: utils.Round(sorted[len(sorted)-1]),
+		P95Percent: utils.Round(sorted[rank]),
+		Samples:    len(sorted),
+	}
+}
@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"go.uber.org/zap"
+)
+
+// TestSummarizeCPU tests avg, max and nearest-rank p95
+func TestSummarizeCPU(t *testing.T) {
+	if got := summarizeCPU(nil); got != nil {
+		t.Errorf("summarizeCPU(nil) = %+v, want nil", got)
+	}
+
+	// 19 quiet samples and one burst: p95 is the 19th value, max the burst
+	samples := make([]float64, 0, 20)
+	for i := 0; i < 19; i++ {
+		samples = append(samples, 10)
+	}
+	samples = append(samples, 90)
+
+	stats := summarizeCPU(samples)
+	if stats.Samples != 20 || stats.AvgPercent != 14 || stats.MaxPercent != 90 || stats.P95Percent != 10 {
+		t.Errorf("summarizeCPU() = %+v, want avg 14 max 90 p95 10 over 20 samples", stats)
+	}
+
+	// With more bursts than the top 5%, p95 reflects them
+	samples = append(samples, 90, 90)
+	if stats := summarizeCPU(samples); stats.P95Percent != 90 {
+		t.Errorf("p95 = %v with 3 of 22 samples at 90, want 90", stats.P95Percent)
+	}
+}
+
+// TestCPUPercent tests busy time between two readings
+func TestCPUPercent(t *testing.T) {
+	prev := cpu.TimesStat{User: 100, System: 50, Idle: 800, Iowait: 50}
+	cur := cpu.TimesStat{User: 130, System: 60, Idle: 850, Iowait: 60}
+
+	percent, ok := cpuPercent(prev, cur)
+	if !ok || percent != 40 {
+		t.Errorf("cpuPercent() = %v, %v, want 40, true", percent, ok)
+	}
+	if _, ok := cpuPercent(cur, prev); ok {
+		t.Error("cpuPercent() accepted counters that went backwards")
+	}
+}
+
+// TestCPUSampler tests sampling in the background and flushing per interval
+func TestCPUSampler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sampler := newCPUSampler(zap.NewNop())
+	go sampler.run(ctx, 20*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	var stats *CPUStats
+	for stats == nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		stats = sampler.flush()
+	}
+	if stats == nil {
+		t.Fatal("no CPU samples collected")
+	}
+	if stats.MaxPercent < stats.AvgPercent || stats.MaxPercent > 100 {
+		t.Errorf("stats = %+v, want avg <= max <= 100", stats)
+	}
+	if again := sampler.flush(); again != nil && again.Samples > 2 {
+		t.Errorf("flush did not clear samples: %+v", again)
+	}
+}
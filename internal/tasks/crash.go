@@ -0,0 +1,152 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/secrets"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// Crash state files, in the data dir
+const (
+	crashOutputFile     = "crash.log"          // Go runtime output of an unrecovered panic or fatal error
+	crashReportFile     = "crash-report.json"  // Report built from it, kept until published
+	runtimeSnapshotFile = "runtime-stats.json" // Latest SaveRuntimeSnapshot
+)
+
+// Crash report limits
+const (
+	maxCrashStack = 256 * 1024
+	crashLogLines = 50
+)
+
+// RuntimeSnapshotInterval is how often the agent saves its runtime stats
+// for crash reports
+const RuntimeSnapshotInterval = 5 * time.Minute
+
+// CrashReport is published on {prefix}.{code}.telemetry.crash at the first
+// startup after the agent died of an unrecovered panic or a Go runtime fatal
+// error. Code/Location are stamped by the publisher.
+type CrashReport struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	CrashedAt string           `json:"crashed_at"`        // When the crash output was last written (RFC3339)
+	Stack     string           `json:"stack"`             // Panic message and goroutine stacks, truncated to 256KB
+	LogTail   []string         `json:"log_tail"`          // Last lines of the agent log file before the crash
+	Runtime   *RuntimeSnapshot `json:"runtime,omitempty"` // Stats saved shortly before the crash, if any
+	TS        string           `json:"ts"`
+}
+
+// RuntimeSnapshot is the agent's runtime stats, saved periodically so a
+// crash report can show the state the agent was in
+type RuntimeSnapshot struct {
+	Version string `json:"version"`
+	PID     int    `json:"pid"`
+	*AgentMetrics
+	TS string `json:"ts"`
+}
+
+// SaveRuntimeSnapshot writes the current runtime stats to dir
+func (e *Executor) SaveRuntimeSnapshot(dir, version string) error {
+	data, err := json.Marshal(RuntimeSnapshot{
+		Version:      version,
+		PID:          os.Getpid(),
+		AgentMetrics: e.GetAgentMetrics(),
+		TS:           utils.NowRFC3339(),
+	})
+	if err != nil {
+		return err
+	}
+	return secrets.WriteFileAtomic(filepath.Join(dir, runtimeSnapshotFile), data)
+}
+
+// CollectCrashReport turns the crash output left in dir by the previous run
+// into a report, together with the tail of its log file and its last
+// runtime snapshot. A report not yet published (see ClearCrashReport) is
+// returned again. Returns nil if the previous run didn't crash. Call before
+// ArmCrashOutput, which truncates the crash output.
+func CollectCrashReport(dir, logFile string) (*CrashReport, error) {
+	output, err := os.ReadFile(filepath.Join(dir, crashOutputFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read crash output: %w", err)
+	}
+	if len(output) == 0 {
+		return loadCrashReport(dir)
+	}
+
+	report := &CrashReport{CrashedAt: utils.NowRFC3339()}
+	if info, err := os.Stat(filepath.Join(dir, crashOutputFile)); err == nil {
+		report.CrashedAt = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	if len(output) > maxCrashStack {
+		output = output[:maxCrashStack]
+	}
+	report.Stack = string(output)
+	if logFile != "" {
+		report.LogTail, _ = tailFile(logFile, crashLogLines)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, runtimeSnapshotFile)); err == nil {
+		var snapshot RuntimeSnapshot
+		if json.Unmarshal(data, &snapshot) == nil {
+			report.Runtime = &snapshot
+		}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	if err := secrets.WriteFileAtomic(filepath.Join(dir, crashReportFile), data); err != nil {
+		return nil, fmt.Errorf("failed to save crash report: %w", err)
+	}
+	return report, nil
+}
+
+// loadCrashReport returns the saved, unpublished crash report, if any
+func loadCrashReport(dir string) (*CrashReport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, crashReportFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crash report: %w", err)
+	}
+	var report CrashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid crash report %s: %w", crashReportFile, err)
+	}
+	return &report, nil
+}
+
+// ClearCrashReport removes the saved crash report once it is published
+func ClearCrashReport(dir string) error {
+	err := os.Remove(filepath.Join(dir, crashReportFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ArmCrashOutput makes the Go runtime write the output of an unrecovered
+// panic or fatal error in any goroutine to a fresh crash output file in dir,
+// for CollectCrashReport on the next start. The file stays open for the
+// life of the process.
+func ArmCrashOutput(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, crashOutputFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create crash output: %w", err)
+	}
+	defer f.Close() // SetCrashOutput keeps its own duplicate
+	return debug.SetCrashOutput(f, debug.CrashOptions{})
+}
@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestCollectCrashReport(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(t.TempDir(), "agent.log")
+
+	// A clean previous run leaves no report
+	if report, err := CollectCrashReport(dir, logFile); err != nil || report != nil {
+		t.Fatalf("CollectCrashReport() without crash = %v, %v, want nil", report, err)
+	}
+
+	var log strings.Builder
+	for i := 1; i <= 60; i++ {
+		fmt.Fprintf(&log, "line %d\n", i)
+	}
+	os.WriteFile(logFile, []byte(log.String()), 0600)
+	os.WriteFile(filepath.Join(dir, crashOutputFile), []byte("panic: boom\n\ngoroutine 1 [running]:\n"), 0600)
+	os.WriteFile(filepath.Join(dir, runtimeSnapshotFile), []byte(`{"version":"1.2.3","pid":42,"goroutines":17,"ts":"2026-01-01T00:00:00Z"}`), 0600)
+
+	report, err := CollectCrashReport(dir, logFile)
+	if err != nil || report == nil {
+		t.Fatalf("CollectCrashReport() = %v, %v", report, err)
+	}
+	if !strings.HasPrefix(report.Stack, "panic: boom") {
+		t.Errorf("Stack = %q", report.Stack)
+	}
+	if len(report.LogTail) != crashLogLines || report.LogTail[crashLogLines-1] != "line 60" {
+		t.Errorf("LogTail = %d lines ending %q, want %d ending \"line 60\"", len(report.LogTail), report.LogTail[len(report.LogTail)-1], crashLogLines)
+	}
+	if report.Runtime == nil || report.Runtime.Version != "1.2.3" || report.Runtime.AgentMetrics == nil || report.Runtime.Goroutines != 17 {
+		t.Errorf("Runtime = %+v", report.Runtime)
+	}
+
+	// Re-arming truncates the crash output; the unpublished report survives
+	t.Cleanup(func() { debug.SetCrashOutput(nil, debug.CrashOptions{}) })
+	if err := ArmCrashOutput(dir); err != nil {
+		t.Fatalf("ArmCrashOutput() error = %v", err)
+	}
+	again, err := CollectCrashReport(dir, logFile)
+	if err != nil || again == nil || again.Stack != report.Stack {
+		t.Fatalf("CollectCrashReport() after re-arm = %v, %v, want saved report", again, err)
+	}
+
+	if err := ClearCrashReport(dir); err != nil {
+		t.Fatalf("ClearCrashReport() error = %v", err)
+	}
+	if report, err := CollectCrashReport(dir, logFile); err != nil || report != nil {
+		t.Errorf("CollectCrashReport() after clear = %v, %v, want nil", report, err)
+	}
+}
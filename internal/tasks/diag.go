@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// diagErrorsFile lists the parts of a diagnostics bundle that couldn't be
+// collected, so one failure doesn't cost support the rest of the bundle
+const diagErrorsFile = "errors.txt"
+
+// DiagBundle assembles a diagnostics bundle for cmd.diag.bundle: a gzipped
+// (or zstd-compressed) tar of the files added to it
+type DiagBundle struct {
+	files  []diagFile
+	errors []string
+}
+
+type diagFile struct {
+	name string
+	data []byte
+}
+
+// NewDiagBundle returns an empty bundle
+func NewDiagBundle() *DiagBundle {
+	return &DiagBundle{}
+}
+
+// AddFile adds a file to the bundle
+func (b *DiagBundle) AddFile(name string, data []byte) {
+	b.files = append(b.files, diagFile{name: name, data: data})
+}
+
+// AddJSON adds v as an indented JSON file
+func (b *DiagBundle) AddJSON(name string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		b.AddError(name, err)
+		return
+	}
+	b.AddFile(name, append(data, '\n'))
+}
+
+// AddLogTail adds the last lines of a log file
+func (b *DiagBundle) AddLogTail(name, logFile string, lines int) {
+	tail, err := tailFile(logFile, lines)
+	if err != nil {
+		b.AddError(name, err)
+		return
+	}
+	b.AddFile(name, []byte(strings.Join(tail, "\n")+"\n"))
+}
+
+// AddError records a part that couldn't be collected
+func (b *DiagBundle) AddError(name string, err error) {
+	b.errors = append(b.errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// Files returns the names of the files in the bundle, in archive order
+func (b *DiagBundle) Files() []string {
+	names := make([]string, 0, len(b.files)+1)
+	for _, f := range b.files {
+		names = append(names, f.name)
+	}
+	if len(b.errors) > 0 {
+		names = append(names, diagErrorsFile)
+	}
+	return names
+}
+
+// Errors returns the parts that couldn't be collected
+func (b *DiagBundle) Errors() []string {
+	return b.errors
+}
+
+// Archive returns the bundle as a .tar.gz, or a .tar.zst when encoding is
+// EncodingZstd, its files under dir/
+func (b *DiagBundle) Archive(dir, encoding string) ([]byte, error) {
+	files := b.files
+	if len(b.errors) > 0 {
+		files = append(files[:len(files):len(files)], diagFile{name: diagErrorsFile, data: []byte(strings.Join(b.errors, "\n") + "\n")})
+	}
+
+	var buf bytes.Buffer
+	var zw io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == EncodingZstd {
+		var err error
+		if zw, err = newZstdWriter(&buf); err != nil {
+			return nil, fmt.Errorf("failed to compress bundle: %w", err)
+		}
+	}
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	for _, f := range files {
+		header := &tar.Header{
+			Name:    dir + "/" + f.name,
+			Mode:    0o644,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write %s to bundle: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, fmt.Errorf("failed to write %s to bundle: %w", f.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close bundle: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress bundle: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestDiagBundle tests that the archive holds every part and lists the
+// parts that failed instead of failing as a whole
+func TestDiagBundle(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "agent.log")
+	if err := os.WriteFile(logFile, []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := NewDiagBundle()
+	bundle.AddJSON("health.json", map[string]string{"status": "healthy"})
+	bundle.AddLogTail("agent.log", logFile, 2)
+	bundle.AddLogTail("missing.log", filepath.Join(t.TempDir(), "missing.log"), 2)
+	bundle.AddError("telemetry.json", errors.New("not kept"))
+
+	wantFiles := []string{"health.json", "agent.log", diagErrorsFile}
+	if files := bundle.Files(); !slices.Equal(files, wantFiles) {
+		t.Errorf("Files() = %v, want %v", files, wantFiles)
+	}
+
+	data, err := bundle.Archive("device-1", "")
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Archive() is not gzip: %v", err)
+	}
+	contents := readTar(t, gz)
+
+	if got := contents["device-1/agent.log"]; got != "two\nthree\n" {
+		t.Errorf("agent.log = %q, want the last 2 lines", got)
+	}
+	if !strings.Contains(contents["device-1/health.json"], `"status": "healthy"`) {
+		t.Errorf("health.json = %q", contents["device-1/health.json"])
+	}
+	errs := contents["device-1/"+diagErrorsFile]
+	if !strings.Contains(errs, "missing.log:") || !strings.Contains(errs, "telemetry.json: not kept") {
+		t.Errorf("%s = %q, want both failed parts", diagErrorsFile, errs)
+	}
+}
+
+// TestDiagBundleZstd tests the zstd-compressed archive
+func TestDiagBundleZstd(t *testing.T) {
+	log := strings.Repeat("level=info msg=\"Published telemetry\"\n", 1000)
+	bundle := NewDiagBundle()
+	bundle.AddFile("agent.log", []byte(log))
+
+	data, err := bundle.Archive("device-1", EncodingZstd)
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	zr, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Archive() is not zstd: %v", err)
+	}
+	defer zr.Close()
+	contents := readTar(t, zr)
+
+	if got := contents["device-1/agent.log"]; got != log {
+		t.Errorf("agent.log is %d bytes, want %d", len(got), len(log))
+	}
+	if len(data) > 1000 {
+		t.Errorf("Archive() is %d bytes, want repetitive text well compressed", len(data))
+	}
+}
+
+// readTar returns the contents of each file in a tar stream by name
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return contents
+		}
+		if err != nil {
+			t.Fatalf("Archive() is not a tar: %v", err)
+		}
+		body, _ := io.ReadAll(tr)
+		contents[header.Name] = string(body)
+	}
+}
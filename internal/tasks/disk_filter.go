@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// DiskFilter selects which drives/mountpoints appear in metrics
+// (tasks.system_metrics.include_disks / exclude_disks). Patterns use glob
+// syntax and also match everything below a matching directory, so "/snap/*"
+// excludes "/snap/core/123". On Windows drives compare case-insensitively
+// and either slash separates folder mounts ("C:/ClusterStorage/*"), though
+// a drive letter doesn't match the volumes mounted in its folders. A nil
+// filter allows every drive.
+type DiskFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewDiskFilter validates the patterns and returns a filter, or nil when
+// both lists are empty
+func NewDiskFilter(include, exclude []string) (*DiskFilter, error) {
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, nil
+	}
+	for _, patterns := range [][]string{include, exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid disk pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &DiskFilter{include: include, exclude: exclude}, nil
+}
+
+// Allows reports whether drive passes the filter. Excludes win over includes;
+// with no includes every drive not excluded is allowed.
+func (f *DiskFilter) Allows(drive string) bool {
+	if f == nil {
+		return true
+	}
+	if matchAnyDisk(f.exclude, drive) {
+		return false
+	}
+	return len(f.include) == 0 || matchAnyDisk(f.include, drive)
+}
+
+// matchAnyDisk reports whether drive, or a parent directory of it, matches
+// any of the patterns
+func matchAnyDisk(patterns []string, drive string) bool {
+	// Stop before the root: "/" and "C:" only match themselves
+	root := 0
+	if runtime.GOOS == "windows" {
+		drive = foldWindowsDisk(drive)
+		root = len("C:")
+	}
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern = foldWindowsDisk(pattern)
+		}
+		for candidate := drive; ; {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+			i := strings.LastIndex(candidate, "/")
+			if i <= root {
+				break
+			}
+			candidate = candidate[:i]
+		}
+	}
+	return false
+}
+
+// foldWindowsDisk upper-cases a Windows drive or pattern and turns its
+// backslashes into slashes, so path.Match doesn't read them as escapes
+func foldWindowsDisk(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(s, `\`, "/"))
+}
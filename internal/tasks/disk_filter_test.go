@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestDiskFilter tests include/exclude matching of drives and mountpoints
+func TestDiskFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		drive   string
+		want    bool
+	}{
+		{name: "no patterns", drive: "/", want: true},
+		{name: "exact exclude", exclude: []string{"/boot"}, drive: "/boot", want: false},
+		{name: "exclude below directory", exclude: []string{"/snap/*"}, drive: "/snap/core/123", want: false},
+		{name: "exclude does not match sibling", exclude: []string{"/snap/*"}, drive: "/snapshots", want: true},
+		{name: "root pattern only matches root", exclude: []string{"/"}, drive: "/home", want: true},
+		{name: "include matches", include: []string{"C:", "D:"}, drive: "D:", want: true},
+		{name: "include misses", include: []string{"C:", "D:"}, drive: "E:", want: false},
+		{name: "exclude wins over include", include: []string{"/data*"}, exclude: []string{"/data/tmp"}, drive: "/data/tmp", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewDiskFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("NewDiskFilter() error = %v", err)
+			}
+			if got := filter.Allows(tt.drive); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.drive, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDiskFilter_WindowsCase tests that drive letters ignore case on Windows
+func TestDiskFilter_WindowsCase(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("drive letter case folding only applies on Windows")
+	}
+	filter, _ := NewDiskFilter([]string{"c:"}, nil)
+	if !filter.Allows("C:") {
+		t.Error("Allows(\"C:\") = false with include \"c:\"")
+	}
+}
+
+// TestNewDiskFilter tests pattern validation and the empty filter
+func TestNewDiskFilter(t *testing.T) {
+	filter, err := NewDiskFilter(nil, nil)
+	if err != nil || filter != nil {
+		t.Errorf("NewDiskFilter(nil, nil) = %v, %v, want nil, nil", filter, err)
+	}
+	if !filter.Allows("/anything") {
+		t.Error("nil filter rejected a drive")
+	}
+
+	if _, err := NewDiskFilter(nil, []string{"/data/[a-"}); err == nil {
+		t.Error("NewDiskFilter() accepted a malformed pattern")
+	}
+}
+
+// TestExporterCollector_DiskFilter tests that filtered volumes are omitted
+func TestExporterCollector_DiskFilter(t *testing.T) {
+	names := GetMetricNames()
+	collector := NewExporterCollector("http://localhost/metrics", zap.NewNop(), nil)
+	filter, _ := NewDiskFilter(nil, []string{"data"})
+	collector.SetDiskFilter(filter)
+
+	metrics, err := collector.parsePrometheusMetrics(strings.NewReader(testExposition(names, 300, 100, 5000)))
+	if err != nil {
+		t.Fatalf("parsePrometheusMetrics() error = %v", err)
+	}
+	if len(metrics.Disks) != 0 {
+		t.Errorf("disks = %+v, want excluded volume omitted", metrics.Disks)
+	}
+}
+
+// TestDiskFilter_WindowsFolderMounts tests patterns for folder-mounted
+// volumes, which a drive letter pattern doesn't cover
+func TestDiskFilter_WindowsFolderMounts(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("folder mounts only apply on Windows")
+	}
+	filter, _ := NewDiskFilter(nil, []string{"C:", "c:/clusterstorage/*"})
+	if filter.Allows(`C:\ClusterStorage\Volume1`) {
+		t.Error(`Allows("C:\ClusterStorage\Volume1") = true with exclude "c:/clusterstorage/*"`)
+	}
+	if !filter.Allows(`C:\Data\Archive`) {
+		t.Error(`Allows("C:\Data\Archive") = false, want true: "C:" only matches the drive itself`)
+	}
+}
@@ -0,0 +1,173 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/secrets"
+)
+
+// maxForecastSamples caps the samples kept per drive: over a long window
+// scrapes are thinned to one per window/maxForecastSamples
+const maxForecastSamples = 288
+
+// forecastResizeRatio is the change in a drive's size taken as a resize,
+// which starts its trend over
+const forecastResizeRatio = 0.01
+
+// DiskForecast keeps a history of free space per drive and projects when
+// each drive fills up, by a least-squares line through the history
+type DiskForecast struct {
+	mu         sync.Mutex
+	window     time.Duration
+	minSamples int
+	drives     map[string][]diskSample
+}
+
+// diskSample is one drive's free space at a point in time
+type diskSample struct {
+	Time    int64   `json:"t"` // Unix seconds
+	FreeGB  float64 `json:"free_gb"`
+	TotalGB float64 `json:"total_gb"`
+}
+
+// DiskPrediction is a drive's projected time to full
+type DiskPrediction struct {
+	FullIn    time.Duration // Until free space reaches zero at the current trend
+	GBPerDay  float64       // Rate free space is shrinking
+	FreeGB    float64       // At the latest sample
+	Samples   int
+	Available bool // False without min_samples samples or a shrinking trend
+}
+
+// NewDiskForecast returns an empty forecast over window, predicting once a
+// drive has minSamples samples
+func NewDiskForecast(window time.Duration, minSamples int) *DiskForecast {
+	return &DiskForecast{
+		window:     window,
+		minSamples: minSamples,
+		drives:     make(map[string][]diskSample),
+	}
+}
+
+// Add records the drives' free space at now. Samples older than the window
+// are dropped, as are drives without any left. It returns false if the
+// sample was skipped because the last one is too recent.
+func (f *DiskForecast) Add(now time.Time, disks []DiskMetrics) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	spacing := f.window / maxForecastSamples
+	added := false
+	for _, disk := range disks {
+		samples := f.drives[disk.Drive]
+		if n := len(samples); n > 0 {
+			last := samples[n-1]
+			if now.Sub(time.Unix(last.Time, 0)) < spacing {
+				continue
+			}
+			if math.Abs(disk.TotalGB-last.TotalGB) > last.TotalGB*forecastResizeRatio {
+				samples = nil
+			}
+		}
+		f.drives[disk.Drive] = append(samples, diskSample{Time: now.Unix(), FreeGB: disk.FreeGB, TotalGB: disk.TotalGB})
+		added = true
+	}
+
+	cutoff := now.Add(-f.window).Unix()
+	for drive, samples := range f.drives {
+		i := 0
+		for i < len(samples) && samples[i].Time < cutoff {
+			i++
+		}
+		if i == len(samples) {
+			delete(f.drives, drive)
+		} else if i > 0 {
+			f.drives[drive] = append([]diskSample(nil), samples[i:]...)
+		}
+	}
+	return added
+}
+
+// Predict projects when drive fills up from its samples
+func (f *DiskForecast) Predict(drive string) DiskPrediction {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	samples := f.drives[drive]
+	prediction := DiskPrediction{Samples: len(samples)}
+	if len(samples) == 0 {
+		return prediction
+	}
+	prediction.FreeGB = samples[len(samples)-1].FreeGB
+	if len(samples) < f.minSamples {
+		return prediction
+	}
+
+	// Least squares of free GB against hours since the first sample
+	t0 := samples[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := float64(s.Time-t0) / 3600
+		sumX += x
+		sumY += s.FreeGB
+		sumXY += x * s.FreeGB
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return prediction
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator // GB per hour
+	if slope >= 0 {
+		return prediction
+	}
+
+	// Project from the fitted value at the latest sample, so one noisy
+	// reading doesn't swing the estimate
+	intercept := (sumY - slope*sumX) / n
+	latest := float64(samples[len(samples)-1].Time-t0) / 3600
+	fitted := max(intercept+slope*latest, 0)
+
+	prediction.FullIn = time.Duration(fitted / -slope * float64(time.Hour))
+	prediction.GBPerDay = -slope * 24
+	prediction.Available = true
+	return prediction
+}
+
+// Save writes the samples to path
+func (f *DiskForecast) Save(path string) error {
+	f.mu.Lock()
+	data, err := json.Marshal(f.drives)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return secrets.WriteFileAtomic(path, data)
+}
+
+// Load restores samples written by Save. A missing file is not an error.
+func (f *DiskForecast) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read disk forecast: %w", err)
+	}
+
+	drives := make(map[string][]diskSample)
+	if err := json.Unmarshal(data, &drives); err != nil {
+		return fmt.Errorf("invalid disk forecast: %w", err)
+	}
+	f.mu.Lock()
+	f.drives = drives
+	f.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,70 @@
+package tasks
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDiskForecast tests the projection of a shrinking drive and that
+// growing, short or resized histories aren't predicted
+func TestDiskForecast(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewDiskForecast(24*time.Hour, 4)
+
+	// /data loses 1 GB an hour from 100 GB, /logs grows
+	for h := 0; h < 10; h++ {
+		now := start.Add(time.Duration(h) * time.Hour)
+		if !f.Add(now, []DiskMetrics{
+			{Drive: "/data", FreeGB: 100 - float64(h), TotalGB: 500},
+			{Drive: "/logs", FreeGB: 10 + float64(h), TotalGB: 50},
+		}) {
+			t.Fatalf("Add() at hour %d skipped the sample", h)
+		}
+	}
+
+	p := f.Predict("/data")
+	if !p.Available || math.Abs(p.FullIn.Hours()-91) > 0.01 || math.Abs(p.GBPerDay-24) > 0.01 || p.Samples != 10 {
+		t.Errorf("Predict(/data) = %+v, want full in 91h at 24 GB/day", p)
+	}
+	if p := f.Predict("/logs"); p.Available {
+		t.Errorf("Predict(/logs) = %+v, want no prediction for a growing drive", p)
+	}
+	if p := f.Predict("/missing"); p.Available || p.Samples != 0 {
+		t.Errorf("Predict(/missing) = %+v, want no prediction", p)
+	}
+
+	// Samples closer than window/maxForecastSamples are thinned
+	if f.Add(start.Add(9*time.Hour+time.Minute), []DiskMetrics{{Drive: "/data", FreeGB: 90, TotalGB: 500}}) {
+		t.Error("Add() kept a sample a minute after the last one")
+	}
+
+	// The history survives a restart
+	path := filepath.Join(t.TempDir(), "disk_forecast.json")
+	if err := f.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	restored := NewDiskForecast(24*time.Hour, 4)
+	if err := restored.Load(path); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := restored.Predict("/data"); got != p {
+		t.Errorf("Predict() after Load() = %+v, want %+v", got, p)
+	}
+	if err := NewDiskForecast(time.Hour, 4).Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("Load() of a missing file error = %v", err)
+	}
+
+	// A resized drive starts over, below min_samples
+	f.Add(start.Add(10*time.Hour), []DiskMetrics{{Drive: "/data", FreeGB: 590, TotalGB: 1000}})
+	if p := f.Predict("/data"); p.Available || p.Samples != 1 {
+		t.Errorf("Predict() after a resize = %+v, want a new trend", p)
+	}
+
+	// Samples age out of the window, and drives with them
+	f.Add(start.Add(40*time.Hour), []DiskMetrics{{Drive: "/data", FreeGB: 580, TotalGB: 1000}})
+	if p := f.Predict("/logs"); p.Samples != 0 {
+		t.Errorf("Predict(/logs) after the window = %+v, want no samples", p)
+	}
+}
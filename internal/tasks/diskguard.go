@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// logBackupTimeFormat is the timestamp lumberjack puts in rotated log file
+// names: agent-2024-01-02T15-04-05.000.log
+const logBackupTimeFormat = "2006-01-02T15-04-05.000"
+
+// DiskFree returns the free bytes on the volume holding path
+func DiskFree(path string) (uint64, error) {
+	usage, err := disk.Usage(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read free space of %s: %w", path, err)
+	}
+	return usage.Free, nil
+}
+
+// TrimLogBackups deletes the rotated backups of logFile, compressed or
+// not, and returns the bytes freed. The live log file is left alone.
+func TrimLogBackups(logFile string) (int64, error) {
+	dir := filepath.Dir(logFile)
+	ext := filepath.Ext(logFile)
+	prefix := strings.TrimSuffix(filepath.Base(logFile), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list log directory: %w", err)
+	}
+
+	var freed int64
+	var errs []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isLogBackup(entry.Name(), prefix, ext) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		freed += info.Size()
+	}
+	if len(errs) > 0 {
+		return freed, fmt.Errorf("failed to remove log backups: %s", strings.Join(errs, "; "))
+	}
+	return freed, nil
+}
+
+// isLogBackup reports whether name is a lumberjack backup: prefix, a
+// backup timestamp, then ext (plus .gz once compressed)
+func isLogBackup(name, prefix, ext string) bool {
+	stamp, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return false
+	}
+	stamp = strings.TrimSuffix(stamp, ".gz")
+	stamp, ok = strings.CutSuffix(stamp, ext)
+	if !ok {
+		return false
+	}
+	_, err := time.Parse(logBackupTimeFormat, stamp)
+	return err == nil
+}
@@ -0,0 +1,40 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrimLogBackups(t *testing.T) {
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "agent.log")
+
+	files := map[string]bool{ // name -> want kept
+		"agent.log":                             true,
+		"agent-2024-01-02T15-04-05.000.log":     false,
+		"agent-2024-01-03T15-04-05.000.log.gz":  false,
+		"agent-notes.log":                       true,
+		"agent-2024-01-02T15-04-05.000.log.bak": true,
+		"other-2024-01-02T15-04-05.000.log":     true,
+	}
+	for name := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	freed, err := TrimLogBackups(logFile)
+	if err != nil {
+		t.Fatalf("TrimLogBackups() error = %v", err)
+	}
+	if freed != 20 {
+		t.Errorf("TrimLogBackups() freed %d bytes, want 20", freed)
+	}
+	for name, keep := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept := err == nil; kept != keep {
+			t.Errorf("%s kept = %v, want %v", name, kept, keep)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tasks
+
+import (
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// Event severities
+const (
+	EventSeverityInfo    = "info"
+	EventSeverityWarning = "warning"
+	EventSeverityError   = "error"
+)
+
+// Event types
+const (
+	// EventTaskOverrun is published when a scheduled task exceeds its timeout
+	// or is skipped because the previous run is still in progress
+	EventTaskOverrun = "task_overrun"
+
+	// EventMemoryLimit is published when the agent's resident memory crosses
+	// runtime.watchdog.rss_limit_mb
+	EventMemoryLimit = "memory_limit"
+
+	// EventDiskLow is published when free space on the agent's log or data
+	// volume drops below runtime.disk_guard.min_free_mb
+	EventDiskLow = "disk_low"
+
+	// EventFirewallChange is published when cmd.firewall changes a profile
+	// or rule
+	EventFirewallChange = "firewall_change"
+
+	// EventRegistryChange is published when cmd.registry sets or deletes a
+	// value
+	EventRegistryChange = "registry_change"
+
+	// EventZFSPoolHealth is published when a ZFS pool's health changes
+	// (e.g. ONLINE to DEGRADED, or back) or a pool is no longer imported
+	EventZFSPoolHealth = "zfs_pool_health"
+
+	// EventRAIDHealth is published when a RAID array's state changes (e.g.
+	// ok to degraded, or back) or an array is no longer reported
+	EventRAIDHealth = "raid_health"
+
+	// EventPowerChange is published when a UPS or battery changes power
+	// status (e.g. online to on_battery on a power loss, or back)
+	EventPowerChange = "power_change"
+
+	// EventNetTest is published with the results of each cmd.nettest run,
+	// so measurements are kept with the rest of the telemetry
+	EventNetTest = "nettest"
+
+	// EventLeaderChange is published when this agent becomes or stops
+	// being the site leader that runs election.tasks
+	EventLeaderChange = "leader_change"
+
+	// EventDiskFullPredicted is published when a drive's free space trend
+	// projects it to fill within tasks.system_metrics.disk_forecast.horizon,
+	// and when it no longer does
+	EventDiskFullPredicted = "disk_full_predicted"
+
+	// EventCollectorFallback is published when the exporter metrics source
+	// falls back to the builtin collector after failed scrapes, and when it
+	// switches back (tasks.system_metrics.fallback)
+	EventCollectorFallback = "collector_fallback"
+
+	// EventTaskInterval is published when cmd.task.configure overrides a
+	// task's interval, and when the configured schedule is restored
+	EventTaskInterval = "task_interval"
+)
+
+// Event is a discrete agent event published on {prefix}.{code}.telemetry.event.
+// Unlike periodic telemetry it reports something that happened, so consumers
+// can alert on it directly. Code/Location are stamped by the publisher.
+type Event struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Type     string            `json:"type"`     // One of the Event* type constants
+	Severity string            `json:"severity"` // One of the EventSeverity* constants
+	Message  string            `json:"message"`
+	Details  map[string]string `json:"details,omitempty"`
+	TS       string            `json:"ts"`
+}
+
+// CreateEvent creates a new event message
+func CreateEvent(eventType, severity, message string, details map[string]string) *Event {
+	return &Event{
+		Type:     eventType,
+		Severity: severity,
+		Message:  message,
+		Details:  details,
+		TS:       utils.NowRFC3339(),
+	}
+}
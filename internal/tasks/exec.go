@@ -5,11 +5,14 @@ package tasks
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
+	"time"
 )
 
 // maxCommandOutputBytes caps captured stdout/stderr so a runaway command
-// cannot exhaust agent memory. Output beyond the cap is discarded.
+// cannot exhaust agent memory. Output beyond the cap is discarded. It is the
+// plugin cap and the cmd.exec cap when none is configured.
 const maxCommandOutputBytes = 10 * 1024 * 1024 // 10MB
 
 // limitedBuffer is an io.Writer that keeps the first maxCommandOutputBytes
@@ -35,20 +38,111 @@ func (b *limitedBuffer) Write(p []byte) (int, error) {
 func (b *limitedBuffer) String() string { return b.buf.String() }
 func (b *limitedBuffer) Len() int       { return b.buf.Len() }
 
-// combineOutput merges stdout and stderr into the single output string
-// returned to the control plane, noting any truncation.
-func combineOutput(stdout, stderr *limitedBuffer) string {
-	output := stdout.String()
-	if stderr.Len() > 0 {
-		if output != "" {
-			output += "\n"
-		}
-		output += "STDERR:\n" + stderr.String()
+// headTailBuffer is an io.Writer that keeps the first and last halves of
+// limit bytes and counts the rest, so a command's output is cut
+// deterministically in the middle: the start (headers, early errors) and
+// the end (the final result) both survive. Writes never fail.
+type headTailBuffer struct {
+	limit int
+	head  []byte
+	tail  []byte // Up to twice the tail half; trimmed when String is called
+	size  int64  // Bytes written
+}
+
+// newHeadTailBuffer creates a buffer keeping limit bytes (maxCommandOutputBytes
+// if limit is 0)
+func newHeadTailBuffer(limit int) *headTailBuffer {
+	if limit <= 0 {
+		limit = maxCommandOutputBytes
+	}
+	return &headTailBuffer{limit: limit}
+}
+
+func (b *headTailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.size += int64(n)
+
+	if room := b.limit/2 - len(b.head); room > 0 {
+		room = min(room, len(p))
+		b.head = append(b.head, p[:room]...)
+		p = p[room:]
+	}
+
+	tailMax := b.limit - b.limit/2
+	if len(p) >= tailMax {
+		b.tail = append(b.tail[:0], p[len(p)-tailMax:]...)
+		return n, nil
+	}
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > 2*tailMax {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-tailMax:]...)
+	}
+	return n, nil
+}
+
+// Truncated reports whether more than limit bytes were written
+func (b *headTailBuffer) Truncated() bool { return b.size > int64(b.limit) }
+
+// String returns the output, with a marker line in place of the middle if
+// it was truncated
+func (b *headTailBuffer) String() string {
+	if !b.Truncated() {
+		return string(b.head) + string(b.tail)
+	}
+	tail := b.tail[len(b.tail)-(b.limit-b.limit/2):]
+	omitted := b.size - int64(len(b.head)) - int64(len(tail))
+	marker := fmt.Sprintf("[... %d bytes truncated ...]", omitted)
+	if !bytes.HasSuffix(b.head, []byte{'\n'}) {
+		marker = "\n" + marker
 	}
-	if stdout.truncated || stderr.truncated {
-		output += "\n[output truncated: exceeded 10MB limit]"
+	if !bytes.HasPrefix(tail, []byte{'\n'}) {
+		marker += "\n"
+	}
+	return string(b.head) + marker + string(tail)
+}
+
+// truncateMiddle cuts s to limit bytes the way headTailBuffer does
+func truncateMiddle(s string, limit int) (string, bool) {
+	b := newHeadTailBuffer(limit)
+	b.Write([]byte(s))
+	return b.String(), b.Truncated()
+}
+
+// ExecResult is the outcome of a whitelisted command. Stdout and stderr are
+// kept apart so callers can parse stdout without stripping diagnostics.
+type ExecResult struct {
+	Stdout     string
+	Stderr     string
+	StdoutSize int64 // Bytes the command wrote, before truncation
+	StderrSize int64
+	ExitCode   int
+	Duration   time.Duration
+	Truncated  bool // Stdout or stderr exceeded the output limit and was cut in the middle
+}
+
+// newExecResult collects the captured output of a finished command
+func newExecResult(stdout, stderr *headTailBuffer, exitCode int, duration time.Duration) *ExecResult {
+	return &ExecResult{
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		StdoutSize: stdout.size,
+		StderrSize: stderr.size,
+		ExitCode:   exitCode,
+		Duration:   duration,
+		Truncated:  stdout.Truncated() || stderr.Truncated(),
+	}
+}
+
+// isWhitelisted reports whether command matches an allowed_commands entry,
+// ignoring differences in whitespace
+func isWhitelisted(command string, allowedCommands []string) bool {
+	normalized := normalizeWhitespace(command)
+	for _, allowed := range allowedCommands {
+		if normalized == normalizeWhitespace(allowed) {
+			return true
+		}
 	}
-	return output
+	return false
 }
 
 // normalizeWhitespace normalizes whitespace in a command for comparison
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestLimitedBuffer tests the command output cap
@@ -37,33 +38,51 @@ func TestLimitedBuffer(t *testing.T) {
 	})
 }
 
-// TestCombineOutput tests stdout/stderr merging and the truncation notice
-func TestCombineOutput(t *testing.T) {
-	t.Run("stdout only", func(t *testing.T) {
-		var stdout, stderr limitedBuffer
-		stdout.Write([]byte("out"))
-		if got := combineOutput(&stdout, &stderr); got != "out" {
-			t.Errorf("combineOutput() = %q, want %q", got, "out")
+// TestHeadTailBuffer tests that output over the limit keeps its start and
+// end around a marker
+func TestHeadTailBuffer(t *testing.T) {
+	t.Run("under limit passes through", func(t *testing.T) {
+		b := newHeadTailBuffer(16)
+		b.Write([]byte("hello "))
+		b.Write([]byte("world"))
+		if b.String() != "hello world" || b.Truncated() {
+			t.Errorf("got %q (truncated=%v), want %q untruncated", b.String(), b.Truncated(), "hello world")
 		}
 	})
 
-	t.Run("stdout and stderr", func(t *testing.T) {
-		var stdout, stderr limitedBuffer
-		stdout.Write([]byte("out"))
-		stderr.Write([]byte("err"))
-		want := "out\nSTDERR:\nerr"
-		if got := combineOutput(&stdout, &stderr); got != want {
-			t.Errorf("combineOutput() = %q, want %q", got, want)
+	t.Run("over limit keeps head and tail", func(t *testing.T) {
+		b := newHeadTailBuffer(8)
+		for _, chunk := range []string{"abc", "defghij", "klmnop", "q", "rstuvwxyz"} {
+			if n, err := b.Write([]byte(chunk)); err != nil || n != len(chunk) {
+				t.Fatalf("Write(%q) = (%d, %v): writes must never fail", chunk, n, err)
+			}
+		}
+		want := "abcd\n[... 18 bytes truncated ...]\nwxyz"
+		if got := b.String(); got != want || !b.Truncated() || b.size != 26 {
+			t.Errorf("got %q (truncated=%v, size=%d), want %q", got, b.Truncated(), b.size, want)
 		}
 	})
 
-	t.Run("truncation notice appended", func(t *testing.T) {
-		var stdout, stderr limitedBuffer
-		stdout.truncated = true
-		stdout.Write([]byte("out"))
-		got := combineOutput(&stdout, &stderr)
-		if !strings.Contains(got, "output truncated") {
-			t.Errorf("combineOutput() = %q, want truncation notice", got)
+	t.Run("single large write", func(t *testing.T) {
+		got, truncated := truncateMiddle(strings.Repeat("x", 100)+"END", 10)
+		if !truncated || !strings.HasPrefix(got, "xxxxx\n[... 93 bytes") || !strings.HasSuffix(got, "xxEND") {
+			t.Errorf("truncateMiddle() = %q, %v", got, truncated)
 		}
 	})
 }
+
+// TestNewExecResult tests that stdout and stderr are kept apart and
+// truncation is flagged with the original sizes
+func TestNewExecResult(t *testing.T) {
+	stdout, stderr := newHeadTailBuffer(0), newHeadTailBuffer(1024)
+	stdout.Write([]byte("out"))
+	stderr.Write(bytes.Repeat([]byte("e"), 2000))
+	got := newExecResult(stdout, stderr, 2, time.Second)
+
+	if got.Stdout != "out" || got.ExitCode != 2 || got.Duration != time.Second {
+		t.Errorf("newExecResult() = %+v", *got)
+	}
+	if !got.Truncated || got.StdoutSize != 3 || got.StderrSize != 2000 || len(got.Stderr) >= 2000 {
+		t.Errorf("newExecResult() truncated = %v, sizes %d/%d, stderr %d bytes; want stderr cut", got.Truncated, got.StdoutSize, got.StderrSize, len(got.Stderr))
+	}
+}
@@ -8,6 +8,16 @@ import (
 )
 
 // ExecuteCommand is a stub for unsupported platforms
-func (e *Executor) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration) (string, int, error) {
-	return "", -1, fmt.Errorf("command execution not supported on this platform")
+func (e *Executor) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration, maxOutput int) (*ExecResult, error) {
+	return nil, fmt.Errorf("command execution not supported on this platform")
+}
+
+// isScript is a stub for unsupported platforms: there are no scripts
+func isScript(command string) bool {
+	return false
+}
+
+// scriptCommand is a stub for unsupported platforms
+func scriptCommand(path string) string {
+	return path
 }
@@ -307,7 +307,7 @@ func TestExecuteCommand(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Note: This will fail at the PowerShell execution stage if allowed
 			// We're just testing whitelist validation here
-			_, _, err := executor.ExecuteCommand(tt.command, tt.allowedCommands, tt.scriptsDir, 0)
+			_, err := executor.ExecuteCommand(tt.command, tt.allowedCommands, tt.scriptsDir, 0, 0)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ExecuteCommand() error = %v, wantErr %v", err, tt.wantErr)
@@ -17,23 +17,47 @@ import (
 // ExecuteCommand executes a PowerShell command or script if it's in the whitelist
 // Commands must match exactly - no parameter substitution is allowed
 // Scripts must exist in the configured scripts_directory
-func (e *Executor) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration) (string, int, error) {
-	// Validate command is allowed (either in whitelist or scripts directory)
-	if !isCommandAllowed(command, allowedCommands, scriptsDir) {
-		return "", -1, fmt.Errorf("command not in allowed list or scripts directory")
+// Stdout and stderr are each cut in the middle to maxOutput bytes (0 = 10MB)
+func (e *Executor) ExecuteCommand(command string, allowedCommands []string, scriptsDir string, timeout time.Duration, maxOutput int) (*ExecResult, error) {
+	if err := e.Unavailable("cmd.exec"); err != nil {
+		return nil, err
 	}
 
-	// Resolve full command path if this is a script
-	fullCommand := command
-	if scriptsDir != "" && isScript(command) {
-		resolvedPath, err := resolveScriptPath(command, scriptsDir)
+	// A manifest in the scripts directory governs the scripts in it
+	// (an exact allowed_commands entry runs as listed there)
+	var fullCommand string
+	var listed bool
+	if !isWhitelisted(command, allowedCommands) {
+		script, err := manifestScript(command, scriptsDir, timeout)
 		if err != nil {
-			e.logger.Error("Failed to resolve script path",
+			e.logger.Warn("Script rejected by manifest",
 				zap.String("command", command),
 				zap.Error(err))
-			return "", -1, fmt.Errorf("failed to resolve script path: %w", err)
+			return nil, err
+		}
+		if script != nil {
+			defer script.remove()
+			fullCommand, timeout, listed = script.command, script.timeout, true
+		}
+	}
+	if !listed {
+		// Validate command is allowed (either in whitelist or scripts directory)
+		if !isCommandAllowed(command, allowedCommands, scriptsDir) {
+			return nil, fmt.Errorf("command not in allowed list or scripts directory")
+		}
+
+		// Resolve full command path if this is a script
+		fullCommand = command
+		if scriptsDir != "" && isScript(command) {
+			resolvedPath, err := resolveScriptPath(command, scriptsDir)
+			if err != nil {
+				e.logger.Error("Failed to resolve script path",
+					zap.String("command", command),
+					zap.Error(err))
+				return nil, fmt.Errorf("failed to resolve script path: %w", err)
+			}
+			fullCommand = resolvedPath
 		}
-		fullCommand = resolvedPath
 	}
 
 	e.logger.Info("Executing whitelisted command",
@@ -42,33 +66,34 @@ func (e *Executor) ExecuteCommand(command string, allowedCommands []string, scri
 		zap.Duration("timeout", timeout))
 
 	// MODIFIED: Execute via PowerShell with context and configured timeout
-	output, exitCode, err := executePowerShell(e.ctx, fullCommand, timeout)
+	result, err := executePowerShell(e.ctx, fullCommand, timeout, maxOutput)
 	if err != nil {
+		exitCode := -1
+		if result != nil {
+			exitCode = result.ExitCode
+		}
 		e.logger.Error("Command execution failed",
 			zap.String("command", command),
 			zap.Error(err),
 			zap.Int("exit_code", exitCode))
-		return output, exitCode, err
+		return result, err
 	}
 
 	e.logger.Info("Command executed successfully",
 		zap.String("command", command),
-		zap.Int("exit_code", exitCode))
+		zap.Int("exit_code", result.ExitCode),
+		zap.Duration("duration", result.Duration))
 
-	return output, exitCode, nil
+	return result, nil
 }
 
 // isCommandAllowed checks if a command is allowed via:
 // 1. Exact match in allowedCommands list
 // 2. Script file in scripts directory
 func isCommandAllowed(command string, allowedCommands []string, scriptsDir string) bool {
-	normalized := normalizeWhitespace(command)
-
 	// Check exact match in allowed commands list
-	for _, allowed := range allowedCommands {
-		if normalized == normalizeWhitespace(allowed) {
-			return true
-		}
+	if isWhitelisted(command, allowedCommands) {
+		return true
 	}
 
 	// Check if it's a script in the scripts directory
@@ -87,6 +112,11 @@ func isScript(command string) bool {
 	return filepath.Ext(filename) == ".ps1"
 }
 
+// scriptCommand is the command line running the script file at path
+func scriptCommand(path string) string {
+	return path
+}
+
 // isScriptAllowed validates that a script exists in the scripts directory
 // and prevents path traversal attacks
 func isScriptAllowed(command string, scriptsDir string) bool {
@@ -140,9 +170,9 @@ func resolveScriptPath(command string, scriptsDir string) (string, error) {
 	return command, nil
 }
 
-// executePowerShell executes a PowerShell command and returns output and exit code
+// executePowerShell executes a PowerShell command and returns its result
 // MODIFIED: Now accepts context for cancellation
-func executePowerShell(ctx context.Context, command string, timeout time.Duration) (string, int, error) {
+func executePowerShell(ctx context.Context, command string, timeout time.Duration, maxOutput int) (*ExecResult, error) {
 	// MODIFIED: Create context with timeout from parent context
 	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -155,20 +185,22 @@ func executePowerShell(ctx context.Context, command string, timeout time.Duratio
 		"-ExecutionPolicy", "Bypass",
 		"-Command", command)
 
-	// Capture stdout and stderr (capped to avoid unbounded memory use)
-	var stdout, stderr limitedBuffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Capture stdout and stderr (each cut to maxOutput bytes in the middle)
+	stdout, stderr := newHeadTailBuffer(maxOutput), newHeadTailBuffer(maxOutput)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
 	// Execute command
+	start := time.Now()
 	err := cmd.Run()
+	duration := time.Since(start)
 
 	// Handle context cancellation
 	if cmdCtx.Err() == context.DeadlineExceeded {
-		return "", -1, fmt.Errorf("command execution timeout (%v)", timeout)
+		return nil, fmt.Errorf("command execution timeout (%v)", timeout)
 	}
 	if cmdCtx.Err() == context.Canceled {
-		return "", -1, fmt.Errorf("command execution cancelled")
+		return nil, fmt.Errorf("command execution cancelled")
 	}
 
 	// Get exit code
@@ -178,17 +210,16 @@ func executePowerShell(ctx context.Context, command string, timeout time.Duratio
 			exitCode = exitErr.ExitCode()
 		} else {
 			// Non-exit error (e.g., command not found)
-			return "", -1, fmt.Errorf("failed to execute command: %w", err)
+			return nil, fmt.Errorf("failed to execute command: %w", err)
 		}
 	}
 
-	// Combine stdout and stderr
-	output := combineOutput(&stdout, &stderr)
+	result := newExecResult(stdout, stderr, exitCode, duration)
 
 	// Return error if exit code is non-zero
 	if exitCode != 0 {
-		return output, exitCode, fmt.Errorf("command exited with code %d", exitCode)
+		return result, fmt.Errorf("command exited with code %d", exitCode)
 	}
 
-	return output, exitCode, nil
+	return result, nil
 }
@@ -4,9 +4,12 @@ import (
 	"context"
 	"net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/gpio"
 	"github.com/stone-age-io/agent/internal/utils"
 	"go.uber.org/zap"
 )
@@ -17,9 +20,23 @@ type Executor struct {
 	commandTimeout   time.Duration
 	httpClient       *http.Client // Cached HTTP client for metrics scraping (created once, reused)
 	stats            *ExecutorStats
-	metricsCollector MetricsCollector // Metrics collector (builtin or exporter)
+	metricsCollector MetricsCollector              // Metrics collector (builtin or exporter)
+	exporterURL      string                        // Scraped by the exporter and hybrid sources, else empty
+	exporterRequest  *config.ExporterRequestConfig // Scrape headers and credentials, nil = defaults
+	scrapeTimeout    time.Duration                 // Bound on a single metrics scrape
+	topProcesses     int                           // Processes listed per metrics payload (0 = disabled)
+	processSampler   *processSampler
+	cpuSampler       *cpuSampler    // Sub-interval CPU sampling, nil if disabled
+	cgroups          *cgroupSampler // Per-cgroup metrics (Linux), nil if disabled
 	taskStats        *TaskStats
-	ctx              context.Context // Context for cancellation and timeouts
+	reloadPidfiles   map[string]string // Service -> pidfile to SIGHUP on reload
+	pauses           *PauseState
+	gpio             *gpio.Controller // Whitelisted GPIO pins, nil if disabled
+	ups              upsCache         // Latest UPS/battery poll, added to system metrics
+	timeSync         timeSyncCache    // Latest clock sync reading, added to heartbeats
+	capabilities     []Capability     // Host capabilities found at startup; missing ones disable subsystems
+	health           healthWindow     // Start of the next heartbeat health summary
+	ctx              context.Context  // Context for cancellation and timeouts
 }
 
 // ExecutorStats tracks executor statistics for self-monitoring
@@ -48,13 +65,27 @@ type TaskStats struct {
 	metricsFailures   int64
 	serviceCheckCount int64
 	inventoryCount    int64
+	inventoryFailures int64
+
+	// Retry attempts after a failed run (tasks.<task>.retry)
+	metricsRetries   int64
+	inventoryRetries int64
+
+	// Last metrics collector failure
+	lastMetricsError     string
+	lastMetricsErrorTime time.Time
+
+	// Pushes to tasks.system_metrics.remote_write
+	remoteWriteCount     int64
+	remoteWriteFailures  int64
+	lastRemoteWriteError string
 }
 
 // DiskCounters stores previous disk counter values for rate calculation
 // Used by collectors for I/O rate calculation
 type DiskCounters struct {
-	ReadBytes  float64
-	WriteBytes float64
+	ReadBytes  float64 `json:"read_bytes"`
+	WriteBytes float64 `json:"write_bytes"`
 }
 
 // AgentMetrics represents agent self-monitoring metrics
@@ -66,6 +97,11 @@ type AgentMetrics struct {
 	CommandsErrored   int64   `json:"commands_errored"`
 	LastError         string  `json:"last_error,omitempty"`
 	LastErrorTime     string  `json:"last_error_time,omitempty"`
+
+	// Agent process open files (Linux/FreeBSD) or handles (Windows); 0 = unavailable
+	OpenFDs uint64 `json:"open_fds,omitempty"`
+	FDLimit uint64 `json:"fd_limit,omitempty"` // RLIMIT_NOFILE soft limit
+	Handles uint64 `json:"handles,omitempty"`
 }
 
 // TaskHealthMetrics represents scheduled task health
@@ -80,11 +116,26 @@ type TaskHealthMetrics struct {
 	MetricsFailures   int64 `json:"metrics_failures"`
 	ServiceCheckCount int64 `json:"service_check_count"`
 	InventoryCount    int64 `json:"inventory_count"`
+	InventoryFailures int64 `json:"inventory_failures"`
+	MetricsRetries    int64 `json:"metrics_retries"`   // Retries after a failed scrape, whether or not one succeeded
+	InventoryRetries  int64 `json:"inventory_retries"` // Retries after a failed collection
+
+	MetricsCollector     string `json:"metrics_collector"` // Active collector, e.g. "builtin (gopsutil)"
+	LastMetricsError     string `json:"last_metrics_error,omitempty"`
+	LastMetricsErrorTime string `json:"last_metrics_error_time,omitempty"`
+
+	// tasks.system_metrics.remote_write only
+	RemoteWriteCount     int64  `json:"remote_write_count,omitempty"`
+	RemoteWriteFailures  int64  `json:"remote_write_failures,omitempty"`
+	LastRemoteWriteError string `json:"last_remote_write_error,omitempty"`
+
+	PausedTasks []PausedTask `json:"paused_tasks,omitempty"`
 }
 
 // NewExecutor creates a new task executor
-// source: "builtin" (default) or "exporter"
-// exporterURL: only used when source="exporter"
+// source: "builtin" (default), "exporter", "hybrid" or "pdh"
+// exporterURL: only used when source="exporter" or "hybrid"; http(s)://
+// or unix:///path/to/socket
 func NewExecutor(logger *zap.Logger, commandTimeout time.Duration, ctx context.Context, source, exporterURL string) (*Executor, error) {
 	httpClient := createHTTPClient()
 
@@ -94,15 +145,205 @@ func NewExecutor(logger *zap.Logger, commandTimeout time.Duration, ctx context.C
 		return nil, err
 	}
 
-	return &Executor{
+	executor := &Executor{
 		logger:           logger,
 		commandTimeout:   commandTimeout,
 		httpClient:       httpClient,
 		stats:            &ExecutorStats{startTime: time.Now()},
 		metricsCollector: collector,
+		scrapeTimeout:    defaultScrapeTimeout,
 		taskStats:        &TaskStats{},
+		pauses:           &PauseState{paused: make(map[string]time.Time), plugins: make(map[string]bool)},
 		ctx:              ctx,
-	}, nil
+	}
+	if source := strings.ToLower(source); source == "exporter" || source == "hybrid" {
+		executor.exporterURL = exporterURL
+		if socket, _, ok := unixSocketURL(exporterURL); ok {
+			dialUnixSocket(httpClient, socket)
+		}
+	}
+	return executor, nil
+}
+
+// SetScrapeTimeout bounds each metrics scrape, including the exporter HTTP
+// request (tasks.system_metrics.timeout). Must be called before the first
+// scrape; non-positive values keep the default.
+func (e *Executor) SetScrapeTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	e.scrapeTimeout = timeout
+	e.httpClient.Timeout = timeout
+	if transport, ok := e.httpClient.Transport.(*http.Transport); ok {
+		transport.ResponseHeaderTimeout = timeout
+	}
+}
+
+// SetExporterTLS applies the CA, client certificate and verification
+// settings to exporter scrapes over https (tasks.system_metrics.exporter_tls).
+// Must be called before the first scrape.
+func (e *Executor) SetExporterTLS(cfg config.ExporterTLSConfig) error {
+	if cfg == (config.ExporterTLSConfig{}) {
+		return nil
+	}
+	tlsConfig, err := exporterTLSConfig(cfg, e.logger)
+	if err != nil {
+		return err
+	}
+	if transport, ok := e.httpClient.Transport.(*http.Transport); ok {
+		transport.TLSClientConfig = tlsConfig
+	}
+	return nil
+}
+
+// SetExporterFallback switches to the builtin collector after failures
+// consecutive failed exporter scrapes, retrying the exporter every
+// retryInterval (tasks.system_metrics.fallback). Only the exporter source
+// falls back. Must be called before SetDiskFilter and the first scrape.
+func (e *Executor) SetExporterFallback(failures int, retryInterval time.Duration) {
+	if exporter, ok := e.metricsCollector.(*ExporterCollector); ok {
+		e.metricsCollector = NewFallbackCollector(exporter, NewBuiltinCollector(e.logger), failures, retryInterval, e.logger)
+	}
+}
+
+// MetricsFallback returns the exporter error while system metrics come
+// from the builtin fallback, or "" otherwise
+func (e *Executor) MetricsFallback() string {
+	if fallback, ok := e.metricsCollector.(*FallbackCollector); ok {
+		return fallback.Fallback()
+	}
+	return ""
+}
+
+// SetDiskFilter limits which drives appear in system metrics
+// (tasks.system_metrics.include_disks / exclude_disks)
+func (e *Executor) SetDiskFilter(filter *DiskFilter) {
+	e.metricsCollector.SetDiskFilter(filter)
+}
+
+// SetDiskIO turns per-disk read/write rates on or off for the collectors
+// that read them through gopsutil (tasks.system_metrics.disk_io). The
+// exporter reports whatever it scrapes.
+func (e *Executor) SetDiskIO(enabled bool) {
+	switch c := e.metricsCollector.(type) {
+	case *BuiltinCollector:
+		c.SetDiskIO(enabled)
+	case *HybridCollector:
+		c.builtin.SetDiskIO(enabled)
+	case *PDHCollector:
+		c.builtin.SetDiskIO(enabled)
+	case *FallbackCollector:
+		if builtin, ok := c.builtin.(*BuiltinCollector); ok {
+			builtin.SetDiskIO(enabled)
+		}
+	}
+}
+
+// SetTopProcesses adds the n heaviest processes by CPU and memory to each
+// metrics payload (tasks.system_metrics.top_processes). 0 disables.
+func (e *Executor) SetTopProcesses(n int) {
+	e.topProcesses = n
+	if n > 0 && e.processSampler == nil {
+		e.processSampler = newProcessSampler()
+	}
+}
+
+// StartCPUSampling samples host CPU every interval in the background and
+// adds avg/max/p95 over each reporting interval to system metrics
+// (tasks.system_metrics.cpu_sample_interval). Sampling stops with the
+// executor context. Must be called at most once; 0 disables.
+func (e *Executor) StartCPUSampling(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	e.cpuSampler = newCPUSampler(e.logger)
+	go e.cpuSampler.run(e.ctx, interval)
+}
+
+// SetExporterRequest sets the headers and credentials sent with exporter
+// scrapes (tasks.system_metrics.exporter_request), for the exporter and
+// hybrid sources
+func (e *Executor) SetExporterRequest(request *config.ExporterRequestConfig) {
+	e.exporterRequest = request
+	switch c := e.metricsCollector.(type) {
+	case *ExporterCollector:
+		c.SetRequest(request)
+	case *HybridCollector:
+		c.SetRequest(request)
+	case *FallbackCollector:
+		if exporter, ok := c.exporter.(*ExporterCollector); ok {
+			exporter.SetRequest(request)
+		}
+	}
+}
+
+// SetExtraFamilies selects the exporter families added to system metrics
+// (tasks.system_metrics.extra_families). Only the hybrid source uses them.
+func (e *Executor) SetExtraFamilies(families []string) {
+	if hybrid, ok := e.metricsCollector.(*HybridCollector); ok {
+		hybrid.SetExtraFamilies(families)
+	}
+}
+
+// SetCgroups adds the cgroups matching patterns (relative to
+// /sys/fs/cgroup, globs allowed) to system metrics
+// (tasks.system_metrics.cgroups). Empty disables.
+func (e *Executor) SetCgroups(patterns []string) {
+	if len(patterns) == 0 {
+		e.cgroups = nil
+		return
+	}
+	e.cgroups = newCgroupSampler(cgroupRoot, patterns)
+}
+
+// SetCounters selects the performance counters added to system metrics
+// (tasks.system_metrics.counters). Only the pdh source uses them.
+func (e *Executor) SetCounters(paths []string) {
+	if pdh, ok := e.metricsCollector.(*PDHCollector); ok {
+		pdh.SetCounters(paths)
+	}
+}
+
+// SetReloadPidfiles makes cmd.service reload signal the listed services
+// through their pidfile (commands.reload_pidfiles)
+func (e *Executor) SetReloadPidfiles(pidfiles []config.ReloadPidfile) {
+	e.reloadPidfiles = make(map[string]string, len(pidfiles))
+	for _, reload := range pidfiles {
+		e.reloadPidfiles[reload.Service] = reload.Pidfile
+	}
+}
+
+// SetGPIO gives cmd.gpio and the gpio task their pins (gpio.enabled). Must
+// be called before commands are served.
+func (e *Executor) SetGPIO(controller *gpio.Controller) {
+	e.gpio = controller
+}
+
+// SaveMetricsBaseline writes the metrics collector's CPU/disk counter
+// baseline to path, so the next start can report rates on its first scrape.
+// Call after the scheduler has stopped.
+func (e *Executor) SaveMetricsBaseline(path string) error {
+	return saveRateBaseline(e.metricsCollector.RateCache(), e.metricsCollector.Name(), path)
+}
+
+// LoadMetricsBaseline restores a baseline written by SaveMetricsBaseline.
+// Baselines from another collector or older than the stale-cache limit are
+// ignored. Returns true if a baseline was restored.
+func (e *Executor) LoadMetricsBaseline(path string) (bool, error) {
+	return loadRateBaseline(e.metricsCollector.RateCache(), e.metricsCollector.Name(), path, maxMetricsCacheAge)
+}
+
+// ResetMetricsBaseline discards the metrics collector's rate baseline and
+// any CPU samples taken so far, e.g. after a clock jump or VM live-migration
+// produced bogus counter deltas. The next scrape records a fresh baseline
+// and reports rates again on the scrape after that. Returns the collector
+// name.
+func (e *Executor) ResetMetricsBaseline() string {
+	e.metricsCollector.ResetCache()
+	if e.cpuSampler != nil {
+		e.cpuSampler.flush()
+	}
+	return e.metricsCollector.Name()
 }
 
 // GetAgentMetrics returns current agent performance metrics
@@ -129,6 +370,10 @@ func (e *Executor) GetAgentMetrics() *AgentMetrics {
 		metrics.LastErrorTime = e.stats.lastErrorTime.Format(time.RFC3339)
 	}
 
+	if err := collectProcessHandles(metrics); err != nil {
+		e.logger.Debug("Could not read agent file descriptor count", zap.Error(err))
+	}
+
 	return metrics
 }
 
@@ -143,6 +388,15 @@ func (e *Executor) GetTaskMetrics() *TaskHealthMetrics {
 		MetricsFailures:   e.taskStats.metricsFailures,
 		ServiceCheckCount: e.taskStats.serviceCheckCount,
 		InventoryCount:    e.taskStats.inventoryCount,
+		InventoryFailures: e.taskStats.inventoryFailures,
+		MetricsRetries:    e.taskStats.metricsRetries,
+		InventoryRetries:  e.taskStats.inventoryRetries,
+		MetricsCollector:  e.metricsCollector.Name(),
+		PausedTasks:       e.GetPausedTasks(),
+
+		RemoteWriteCount:     e.taskStats.remoteWriteCount,
+		RemoteWriteFailures:  e.taskStats.remoteWriteFailures,
+		LastRemoteWriteError: e.taskStats.lastRemoteWriteError,
 	}
 
 	// Only include timestamps if tasks have executed
@@ -158,6 +412,10 @@ func (e *Executor) GetTaskMetrics() *TaskHealthMetrics {
 	if !e.taskStats.lastInventory.IsZero() {
 		metrics.LastInventory = e.taskStats.lastInventory.Format(time.RFC3339)
 	}
+	if !e.taskStats.lastMetricsErrorTime.IsZero() {
+		metrics.LastMetricsError = e.taskStats.lastMetricsError
+		metrics.LastMetricsErrorTime = e.taskStats.lastMetricsErrorTime.Format(time.RFC3339)
+	}
 
 	return metrics
 }
@@ -178,11 +436,25 @@ func (e *Executor) RecordMetricsSuccess() {
 	e.taskStats.metricsCount++
 }
 
-// RecordMetricsFailure records a failed metrics scrape
-func (e *Executor) RecordMetricsFailure() {
+// RecordMetricsFailure records a failed metrics scrape and its error
+func (e *Executor) RecordMetricsFailure(err error) {
 	e.taskStats.mu.Lock()
 	defer e.taskStats.mu.Unlock()
 	e.taskStats.metricsFailures++
+	e.taskStats.lastMetricsError = err.Error()
+	e.taskStats.lastMetricsErrorTime = time.Now()
+}
+
+// RecordRemoteWrite records a push to the remote_write endpoint; err is
+// nil if it was accepted
+func (e *Executor) RecordRemoteWrite(err error) {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	e.taskStats.remoteWriteCount++
+	if err != nil {
+		e.taskStats.remoteWriteFailures++
+		e.taskStats.lastRemoteWriteError = err.Error()
+	}
 }
 
 // RecordServiceCheck records a service check execution
@@ -201,6 +473,26 @@ func (e *Executor) RecordInventory() {
 	e.taskStats.inventoryCount++
 }
 
+// RecordInventoryFailure records an inventory collection that failed
+// after its retries
+func (e *Executor) RecordInventoryFailure() {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	e.taskStats.inventoryFailures++
+}
+
+// RecordRetry records a retry of a failed system_metrics or inventory run
+func (e *Executor) RecordRetry(task string) {
+	e.taskStats.mu.Lock()
+	defer e.taskStats.mu.Unlock()
+	switch task {
+	case TaskSystemMetrics:
+		e.taskStats.metricsRetries++
+	case TaskInventory:
+		e.taskStats.inventoryRetries++
+	}
+}
+
 // RecordCommandSuccess increments success counter
 func (e *Executor) RecordCommandSuccess() {
 	e.stats.mu.Lock()
@@ -219,11 +511,12 @@ func (e *Executor) RecordCommandError(err error) {
 	e.stats.lastErrorTime = time.Now()
 }
 
-// ScrapeMetrics collects system metrics using the configured collector
+// ScrapeMetrics collects system metrics using the configured collector.
+// ctx bounds the scrape (the scheduler passes its per-task timeout context).
 // The exporterURL parameter is kept for backward compatibility but is ignored
 // when using the builtin collector (the collector was configured at creation time)
-func (e *Executor) ScrapeMetrics(exporterURL string) (*SystemMetrics, error) {
-	ctx, cancel := context.WithTimeout(e.ctx, 30*time.Second)
+func (e *Executor) ScrapeMetrics(ctx context.Context, exporterURL string) (*SystemMetrics, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.scrapeTimeout)
 	defer cancel()
 
 	metrics, err := e.metricsCollector.Collect(ctx)
@@ -231,6 +524,35 @@ func (e *Executor) ScrapeMetrics(exporterURL string) (*SystemMetrics, error) {
 		return nil, err
 	}
 
+	// File descriptor usage is read locally whatever the collector source
+	if err := collectSystemHandles(metrics); err != nil {
+		e.logger.Debug("Could not read system file descriptor counts", zap.Error(err))
+	}
+
+	if e.cpuSampler != nil {
+		metrics.CPUStats = e.cpuSampler.flush()
+	}
+
+	if e.topProcesses > 0 {
+		top, err := e.processSampler.top(ctx, e.topProcesses)
+		if err != nil {
+			e.logger.Warn("Failed to collect top processes", zap.Error(err))
+		} else {
+			metrics.TopProcesses = top
+		}
+	}
+
+	if e.cgroups != nil {
+		cgroups, err := e.cgroups.collect()
+		if err != nil {
+			e.logger.Warn("Failed to collect cgroup metrics", zap.Error(err))
+		} else {
+			metrics.Cgroups = cgroups
+		}
+	}
+
+	metrics.UPS = e.lastUPS()
+
 	// Validate metrics
 	if err := validateMetrics(metrics, e.metricsCollector); err != nil {
 		return nil, err
@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"errors"
+	"net/http"
 	"testing"
 	"time"
 
@@ -327,6 +328,36 @@ func TestHTTPClientInitialization(t *testing.T) {
 	}
 }
 
+// TestSetScrapeTimeout tests that the scrape timeout reaches the HTTP client
+func TestSetScrapeTimeout(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	if executor.scrapeTimeout != 30*time.Second {
+		t.Errorf("default scrapeTimeout = %v, want 30s", executor.scrapeTimeout)
+	}
+
+	executor.SetScrapeTimeout(60 * time.Second)
+	if executor.scrapeTimeout != 60*time.Second {
+		t.Errorf("scrapeTimeout = %v, want 60s", executor.scrapeTimeout)
+	}
+	if executor.httpClient.Timeout != 60*time.Second {
+		t.Errorf("httpClient.Timeout = %v, want 60s", executor.httpClient.Timeout)
+	}
+	transport := executor.httpClient.Transport.(*http.Transport)
+	if transport.ResponseHeaderTimeout != 60*time.Second {
+		t.Errorf("ResponseHeaderTimeout = %v, want 60s", transport.ResponseHeaderTimeout)
+	}
+
+	// Non-positive values keep the current timeout
+	executor.SetScrapeTimeout(0)
+	if executor.scrapeTimeout != 60*time.Second {
+		t.Errorf("scrapeTimeout after SetScrapeTimeout(0) = %v, want 60s", executor.scrapeTimeout)
+	}
+}
+
 // TestTaskStatsRecording tests task execution tracking
 func TestTaskStatsRecording(t *testing.T) {
 	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
@@ -347,9 +378,13 @@ func TestTaskStatsRecording(t *testing.T) {
 	executor.RecordHeartbeat()
 	executor.RecordMetricsSuccess()
 	executor.RecordMetricsSuccess()
-	executor.RecordMetricsFailure()
+	executor.RecordMetricsFailure(errors.New("exporter unreachable"))
 	executor.RecordServiceCheck()
 	executor.RecordInventory()
+	executor.RecordRetry(TaskSystemMetrics)
+	executor.RecordRetry(TaskInventory)
+	executor.RecordRetry(TaskInventory)
+	executor.RecordInventoryFailure()
 
 	// Check counters
 	metrics = executor.GetTaskMetrics()
@@ -368,6 +403,19 @@ func TestTaskStatsRecording(t *testing.T) {
 	if metrics.InventoryCount != 1 {
 		t.Errorf("InventoryCount = %d, want 1", metrics.InventoryCount)
 	}
+	if metrics.MetricsRetries != 1 || metrics.InventoryRetries != 2 || metrics.InventoryFailures != 1 {
+		t.Errorf("retries = %d/%d, inventory failures = %d; want 1/2, 1",
+			metrics.MetricsRetries, metrics.InventoryRetries, metrics.InventoryFailures)
+	}
+	if metrics.MetricsCollector != "builtin (gopsutil)" {
+		t.Errorf("MetricsCollector = %q, want %q", metrics.MetricsCollector, "builtin (gopsutil)")
+	}
+	if metrics.LastMetricsError != "exporter unreachable" {
+		t.Errorf("LastMetricsError = %q, want %q", metrics.LastMetricsError, "exporter unreachable")
+	}
+	if metrics.LastMetricsErrorTime == "" {
+		t.Error("LastMetricsErrorTime should be set")
+	}
 
 	// Check timestamps are set
 	if metrics.LastHeartbeat == "" {
@@ -383,3 +431,21 @@ func TestTaskStatsRecording(t *testing.T) {
 		t.Error("LastInventory should be set")
 	}
 }
+
+// TestResetMetricsBaseline tests that a reset discards the stored rate baseline
+func TestResetMetricsBaseline(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 30*time.Second, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	cache := executor.metricsCollector.RateCache()
+	cache.Store(CounterSnapshot{Time: time.Now(), HasCPU: true, CPUTotal: 100, CPUIdle: 50})
+
+	if name := executor.ResetMetricsBaseline(); name != executor.metricsCollector.Name() {
+		t.Errorf("ResetMetricsBaseline() = %q, want %q", name, executor.metricsCollector.Name())
+	}
+	if _, ok := cache.Load(); ok {
+		t.Error("ResetMetricsBaseline() left a baseline in the rate cache")
+	}
+}
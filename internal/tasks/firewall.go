@@ -0,0 +1,456 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// FirewallRequest is a cmd.firewall request
+type FirewallRequest struct {
+	Action  string `json:"action"`            // status, enable, disable, add or remove
+	Profile string `json:"profile,omitempty"` // enable/disable: one of commands.firewall.profiles
+	Rule    string `json:"rule,omitempty"`    // add/remove: a commands.firewall.rules name
+}
+
+// FirewallStatus is the state of every whitelisted profile and rule,
+// reported after each cmd.firewall action
+type FirewallStatus struct {
+	Changed  bool              `json:"changed"`            // The action changed the firewall (false if already in that state)
+	Profiles map[string]bool   `json:"profiles,omitempty"` // Profile -> enabled
+	Rules    map[string]bool   `json:"rules,omitempty"`    // Rule name -> present
+	Errors   map[string]string `json:"errors,omitempty"`   // Profiles and rules whose state could not be read ("profile:<name>", "rule:<name>")
+}
+
+// firewallBackend drives one firewall implementation
+type firewallBackend interface {
+	profileEnabled(ctx context.Context, profile string) (bool, error)
+	setProfile(ctx context.Context, profile string, enabled bool) error
+	rulePresent(ctx context.Context, rule *config.FirewallRuleConfig) (bool, error)
+	addRule(ctx context.Context, rule *config.FirewallRuleConfig) error
+	removeRule(ctx context.Context, rule *config.FirewallRuleConfig) error
+}
+
+// toolRunner runs a system tool and returns its combined output
+type toolRunner func(ctx context.Context, name string, args ...string) (string, error)
+
+// runTool runs a system tool (a firewall tool, appcmd, zpool) in the C locale,
+// so its output can be parsed
+func runTool(ctx context.Context, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if err != nil {
+		return out.String(), fmt.Errorf("%s %s failed: %w: %s", name, strings.Join(args, " "), err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// newFirewallBackend returns the configured backend
+func newFirewallBackend(cfg *config.FirewallConfig, run toolRunner) (firewallBackend, error) {
+	switch cfg.Backend {
+	case "netsh":
+		return &netshFirewall{run: run}, nil
+	case "ufw":
+		return &ufwFirewall{run: run}, nil
+	case "nftables":
+		return &nftFirewall{run: run, table: cfg.Table}, nil
+	}
+	return nil, fmt.Errorf("unknown firewall backend: %s", cfg.Backend)
+}
+
+// FirewallCommand performs a cmd.firewall action. Only whitelisted profiles
+// and pre-approved rules can be changed; changes that are already in effect
+// succeed without touching the firewall.
+func (e *Executor) FirewallCommand(req *FirewallRequest, cfg *config.FirewallConfig) (*FirewallStatus, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("firewall control is not enabled")
+	}
+	backend, err := newFirewallBackend(cfg, runTool)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(e.ctx, serviceCommandTimeout)
+	defer cancel()
+	return firewallCommand(ctx, backend, req, cfg)
+}
+
+// firewallCommand performs a cmd.firewall action with a backend
+func firewallCommand(ctx context.Context, backend firewallBackend, req *FirewallRequest, cfg *config.FirewallConfig) (*FirewallStatus, error) {
+	changed := false
+	switch req.Action {
+	case "status":
+
+	case "enable", "disable":
+		if !slices.Contains(cfg.Profiles, req.Profile) {
+			return nil, fmt.Errorf("firewall profile not in allowed list: %s", req.Profile)
+		}
+		want := req.Action == "enable"
+		enabled, err := backend.profileEnabled(ctx, req.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if enabled != want {
+			if err := backend.setProfile(ctx, req.Profile, want); err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+	case "add", "remove":
+		var rule *config.FirewallRuleConfig
+		for i := range cfg.Rules {
+			if cfg.Rules[i].Name == req.Rule {
+				rule = &cfg.Rules[i]
+				break
+			}
+		}
+		if rule == nil {
+			return nil, fmt.Errorf("firewall rule not in allowed list: %s", req.Rule)
+		}
+		want := req.Action == "add"
+		present, err := backend.rulePresent(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		if present != want {
+			if want {
+				err = backend.addRule(ctx, rule)
+			} else {
+				err = backend.removeRule(ctx, rule)
+			}
+			if err != nil {
+				return nil, err
+			}
+			changed = true
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid action: %s (must be status, enable, disable, add, or remove)", req.Action)
+	}
+
+	status := firewallState(ctx, backend, cfg)
+	status.Changed = changed
+	return status, nil
+}
+
+// firewallState reads the state of every whitelisted profile and rule
+func firewallState(ctx context.Context, backend firewallBackend, cfg *config.FirewallConfig) *FirewallStatus {
+	status := &FirewallStatus{}
+	setError := func(key string, err error) {
+		if status.Errors == nil {
+			status.Errors = make(map[string]string)
+		}
+		status.Errors[key] = err.Error()
+	}
+
+	for _, profile := range cfg.Profiles {
+		enabled, err := backend.profileEnabled(ctx, profile)
+		if err != nil {
+			setError("profile:"+profile, err)
+			continue
+		}
+		if status.Profiles == nil {
+			status.Profiles = make(map[string]bool)
+		}
+		status.Profiles[profile] = enabled
+	}
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		present, err := backend.rulePresent(ctx, rule)
+		if err != nil {
+			setError("rule:"+rule.Name, err)
+			continue
+		}
+		if status.Rules == nil {
+			status.Rules = make(map[string]bool)
+		}
+		status.Rules[rule.Name] = present
+	}
+	return status
+}
+
+// firewallRuleTag identifies the agent's rules: the netsh rule name, or the
+// ufw and nftables rule comment
+func firewallRuleTag(rule *config.FirewallRuleConfig, sep string) string {
+	return "agent" + sep + rule.Name
+}
+
+// netshFirewall is Windows Defender Firewall, driven by netsh advfirewall
+type netshFirewall struct {
+	run toolRunner
+}
+
+// netshProfile is the netsh name of a profile
+func netshProfile(profile string) string {
+	if profile == "all" {
+		return "allprofiles"
+	}
+	return profile + "profile"
+}
+
+func (f *netshFirewall) profileEnabled(ctx context.Context, profile string) (bool, error) {
+	out, err := f.run(ctx, "netsh", "advfirewall", "show", netshProfile(profile), "state")
+	if err != nil {
+		return false, err
+	}
+	// One "State ON|OFF" line per profile; "all" is enabled if every profile is
+	states := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[len(fields)-1] {
+		case "ON":
+			states++
+		case "OFF":
+			return false, nil
+		}
+	}
+	if states == 0 {
+		return false, fmt.Errorf("no profile state in netsh output")
+	}
+	return true, nil
+}
+
+func (f *netshFirewall) setProfile(ctx context.Context, profile string, enabled bool) error {
+	state := "off"
+	if enabled {
+		state = "on"
+	}
+	_, err := f.run(ctx, "netsh", "advfirewall", "set", netshProfile(profile), "state", state)
+	return err
+}
+
+func (f *netshFirewall) rulePresent(ctx context.Context, rule *config.FirewallRuleConfig) (bool, error) {
+	_, err := f.run(ctx, "netsh", "advfirewall", "firewall", "show", "rule", "name="+firewallRuleTag(rule, "-"))
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil // No rules match the specified criteria
+	}
+	return err == nil, err
+}
+
+func (f *netshFirewall) addRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	_, err := f.run(ctx, "netsh", netshRuleArgs(rule)...)
+	return err
+}
+
+func (f *netshFirewall) removeRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	_, err := f.run(ctx, "netsh", "advfirewall", "firewall", "delete", "rule", "name="+firewallRuleTag(rule, "-"))
+	return err
+}
+
+// netshRuleArgs returns the netsh arguments adding a rule
+func netshRuleArgs(rule *config.FirewallRuleConfig) []string {
+	args := []string{"advfirewall", "firewall", "add", "rule",
+		"name=" + firewallRuleTag(rule, "-"),
+		"dir=" + rule.Direction,
+		"action=" + rule.Action,
+		"protocol=" + rule.Protocol,
+	}
+	if rule.Ports != "" {
+		if rule.Direction == "in" {
+			args = append(args, "localport="+rule.Ports)
+		} else {
+			args = append(args, "remoteport="+rule.Ports)
+		}
+	}
+	if rule.Remote != "" {
+		args = append(args, "remoteip="+rule.Remote)
+	}
+	return args
+}
+
+// ufwFirewall is Uncomplicated Firewall; its only profile is "all", the
+// firewall as a whole
+type ufwFirewall struct {
+	run toolRunner
+}
+
+func (f *ufwFirewall) profileEnabled(ctx context.Context, profile string) (bool, error) {
+	out, err := f.run(ctx, "ufw", "status")
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case strings.Contains(out, "Status: active"):
+		return true, nil
+	case strings.Contains(out, "Status: inactive"):
+		return false, nil
+	}
+	return false, fmt.Errorf("no status in ufw output")
+}
+
+func (f *ufwFirewall) setProfile(ctx context.Context, profile string, enabled bool) error {
+	args := []string{"disable"}
+	if enabled {
+		args = []string{"--force", "enable"}
+	}
+	_, err := f.run(ctx, "ufw", args...)
+	return err
+}
+
+func (f *ufwFirewall) rulePresent(ctx context.Context, rule *config.FirewallRuleConfig) (bool, error) {
+	out, err := f.run(ctx, "ufw", "show", "added")
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(out, fmt.Sprintf("comment '%s'", firewallRuleTag(rule, ":"))), nil
+}
+
+func (f *ufwFirewall) addRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	_, err := f.run(ctx, "ufw", ufwRuleArgs(rule)...)
+	return err
+}
+
+func (f *ufwFirewall) removeRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	_, err := f.run(ctx, "ufw", append([]string{"delete"}, ufwRuleArgs(rule)...)...)
+	return err
+}
+
+// ufwRuleArgs returns the ufw rule specification of a rule
+func ufwRuleArgs(rule *config.FirewallRuleConfig) []string {
+	action := "allow"
+	if rule.Action == "block" {
+		action = "deny"
+	}
+	args := []string{action, rule.Direction}
+	if rule.Protocol != "any" {
+		args = append(args, "proto", rule.Protocol)
+	}
+
+	remote := rule.Remote
+	if remote == "" {
+		remote = "any"
+	}
+	if rule.Direction == "in" {
+		args = append(args, "from", remote, "to", "any")
+	} else {
+		args = append(args, "from", "any", "to", remote)
+	}
+	if rule.Ports != "" {
+		args = append(args, "port", strings.ReplaceAll(rule.Ports, "-", ":"))
+	}
+	return append(args, "comment", firewallRuleTag(rule, ":"))
+}
+
+// nftFirewall keeps the agent's rules in its own inet table, with input and
+// output chains that accept by default. It has no profiles.
+type nftFirewall struct {
+	run   toolRunner
+	table string
+}
+
+// nftHandle matches the handle nft -a prints after each rule
+var nftHandle = regexp.MustCompile(`# handle (\d+)\s*$`)
+
+// nftChain is the chain holding a rule
+func nftChain(rule *config.FirewallRuleConfig) string {
+	if rule.Direction == "out" {
+		return "output"
+	}
+	return "input"
+}
+
+func (f *nftFirewall) profileEnabled(ctx context.Context, profile string) (bool, error) {
+	return false, fmt.Errorf("the nftables backend has no profiles")
+}
+
+func (f *nftFirewall) setProfile(ctx context.Context, profile string, enabled bool) error {
+	return fmt.Errorf("the nftables backend has no profiles")
+}
+
+// handles returns the handles of a rule's entries in its chain. A missing
+// table or chain has none.
+func (f *nftFirewall) handles(ctx context.Context, rule *config.FirewallRuleConfig) ([]string, error) {
+	out, err := f.run(ctx, "nft", "-a", "list", "chain", "inet", f.table, nftChain(rule))
+	if err != nil {
+		if strings.Contains(out, "No such file or directory") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	comment := fmt.Sprintf(`comment "%s"`, firewallRuleTag(rule, ":"))
+	var handles []string
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.Contains(line, comment) {
+			continue
+		}
+		if m := nftHandle.FindStringSubmatch(line); m != nil {
+			handles = append(handles, m[1])
+		}
+	}
+	return handles, nil
+}
+
+func (f *nftFirewall) rulePresent(ctx context.Context, rule *config.FirewallRuleConfig) (bool, error) {
+	handles, err := f.handles(ctx, rule)
+	return len(handles) > 0, err
+}
+
+func (f *nftFirewall) addRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	chain := nftChain(rule)
+	if _, err := f.run(ctx, "nft", "add", "table", "inet", f.table); err != nil {
+		return err
+	}
+	spec := fmt.Sprintf("{ type filter hook %s priority 0 ; policy accept ; }", chain)
+	if _, err := f.run(ctx, "nft", "add", "chain", "inet", f.table, chain, spec); err != nil {
+		return err
+	}
+	_, err := f.run(ctx, "nft", append([]string{"add", "rule", "inet", f.table, chain}, nftRuleExpr(rule)...)...)
+	return err
+}
+
+func (f *nftFirewall) removeRule(ctx context.Context, rule *config.FirewallRuleConfig) error {
+	handles, err := f.handles(ctx, rule)
+	if err != nil {
+		return err
+	}
+	for _, handle := range handles {
+		if _, err := f.run(ctx, "nft", "delete", "rule", "inet", f.table, nftChain(rule), "handle", handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nftRuleExpr returns the nft statements of a rule
+func nftRuleExpr(rule *config.FirewallRuleConfig) []string {
+	var expr []string
+	if rule.Remote != "" {
+		family := "ip"
+		if strings.Contains(rule.Remote, ":") {
+			family = "ip6"
+		}
+		addr := "saddr"
+		if rule.Direction == "out" {
+			addr = "daddr"
+		}
+		expr = append(expr, family, addr, rule.Remote)
+	}
+	switch {
+	case rule.Ports != "":
+		expr = append(expr, rule.Protocol, "dport", rule.Ports)
+	case rule.Protocol != "any":
+		expr = append(expr, "meta", "l4proto", rule.Protocol)
+	}
+
+	verdict := "accept"
+	if rule.Action == "block" {
+		verdict = "drop"
+	}
+	return append(expr, verdict, "comment", fmt.Sprintf(`"%s"`, firewallRuleTag(rule, ":")))
+}
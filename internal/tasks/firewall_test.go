@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// fakeFirewall records the commands it is given and answers from output,
+// keyed by the command line
+type fakeFirewall struct {
+	output map[string]string
+	calls  []string
+}
+
+func (f *fakeFirewall) run(ctx context.Context, name string, args ...string) (string, error) {
+	line := name + " " + strings.Join(args, " ")
+	f.calls = append(f.calls, line)
+	if out, ok := f.output[line]; ok {
+		return out, nil
+	}
+	return "", fmt.Errorf("unexpected command: %s", line)
+}
+
+var firewallTestRules = []config.FirewallRuleConfig{
+	{Name: "ssh", Direction: "in", Action: "allow", Protocol: "tcp", Ports: "22", Remote: "10.0.0.0/8"},
+	{Name: "isolate", Direction: "out", Action: "block", Protocol: "any"},
+	{Name: "dns6", Direction: "out", Action: "allow", Protocol: "udp", Ports: "53-54", Remote: "fd00::53"},
+}
+
+func TestFirewallRuleArgs(t *testing.T) {
+	tests := []struct {
+		rule               config.FirewallRuleConfig
+		netsh, ufw, nftExp string
+	}{
+		{
+			firewallTestRules[0],
+			"advfirewall firewall add rule name=agent-ssh dir=in action=allow protocol=tcp localport=22 remoteip=10.0.0.0/8",
+			"allow in proto tcp from 10.0.0.0/8 to any port 22 comment agent:ssh",
+			`ip saddr 10.0.0.0/8 tcp dport 22 accept comment "agent:ssh"`,
+		},
+		{
+			firewallTestRules[1],
+			"advfirewall firewall add rule name=agent-isolate dir=out action=block protocol=any",
+			"deny out from any to any comment agent:isolate",
+			`drop comment "agent:isolate"`,
+		},
+		{
+			firewallTestRules[2],
+			"advfirewall firewall add rule name=agent-dns6 dir=out action=allow protocol=udp remoteport=53-54 remoteip=fd00::53",
+			"allow out proto udp from any to fd00::53 port 53:54 comment agent:dns6",
+			`ip6 daddr fd00::53 udp dport 53-54 accept comment "agent:dns6"`,
+		},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(netshRuleArgs(&tt.rule), " "); got != tt.netsh {
+			t.Errorf("%s: netsh = %q, want %q", tt.rule.Name, got, tt.netsh)
+		}
+		if got := strings.Join(ufwRuleArgs(&tt.rule), " "); got != tt.ufw {
+			t.Errorf("%s: ufw = %q, want %q", tt.rule.Name, got, tt.ufw)
+		}
+		if got := strings.Join(nftRuleExpr(&tt.rule), " "); got != tt.nftExp {
+			t.Errorf("%s: nft = %q, want %q", tt.rule.Name, got, tt.nftExp)
+		}
+	}
+}
+
+func TestFirewallCommandNftables(t *testing.T) {
+	cfg := &config.FirewallConfig{Enabled: true, Backend: "nftables", Table: "agent", Rules: firewallTestRules[:2]}
+	listInput := "nft -a list chain inet agent input"
+	listOutput := "nft -a list chain inet agent output"
+	fake := &fakeFirewall{output: map[string]string{
+		listInput: "table inet agent {\n\tchain input {\n\t\ttype filter hook input priority filter; policy accept;\n" +
+			"\t\tip saddr 10.0.0.0/8 tcp dport 22 accept comment \"agent:ssh\" # handle 4\n\t}\n}\n",
+		listOutput:                 "table inet agent {\n\tchain output {\n\t}\n}\n",
+		"nft add table inet agent": "",
+		"nft add chain inet agent output { type filter hook output priority 0 ; policy accept ; }": "",
+		`nft add rule inet agent output drop comment "agent:isolate"`:                              "",
+		"nft delete rule inet agent input handle 4":                                                "",
+	}}
+	backend, _ := newFirewallBackend(cfg, fake.run)
+	ctx := context.Background()
+
+	// Already present: nothing changes
+	status, err := firewallCommand(ctx, backend, &FirewallRequest{Action: "add", Rule: "ssh"}, cfg)
+	if err != nil || status.Changed || !status.Rules["ssh"] || status.Rules["isolate"] {
+		t.Fatalf("add ssh = %+v, %v", status, err)
+	}
+
+	fake.calls = nil
+	status, err = firewallCommand(ctx, backend, &FirewallRequest{Action: "add", Rule: "isolate"}, cfg)
+	if err != nil || !status.Changed {
+		t.Fatalf("add isolate = %+v, %v", status, err)
+	}
+	if !slices.Contains(fake.calls, `nft add rule inet agent output drop comment "agent:isolate"`) {
+		t.Errorf("add isolate calls = %q", fake.calls)
+	}
+
+	status, err = firewallCommand(ctx, backend, &FirewallRequest{Action: "remove", Rule: "ssh"}, cfg)
+	if err != nil || !status.Changed || !slices.Contains(fake.calls, "nft delete rule inet agent input handle 4") {
+		t.Fatalf("remove ssh = %+v, %v (calls %q)", status, err, fake.calls)
+	}
+
+	// Only whitelisted rules and profiles
+	if _, err := firewallCommand(ctx, backend, &FirewallRequest{Action: "add", Rule: "dns6"}, cfg); err == nil {
+		t.Error("add of a rule not in the config succeeded")
+	}
+	if _, err := firewallCommand(ctx, backend, &FirewallRequest{Action: "disable", Profile: "all"}, cfg); err == nil {
+		t.Error("disable of a profile not in the config succeeded")
+	}
+	if _, err := firewallCommand(ctx, backend, &FirewallRequest{Action: "flush"}, cfg); err == nil {
+		t.Error("unknown action succeeded")
+	}
+}
+
+func TestFirewallCommandProfiles(t *testing.T) {
+	ctx := context.Background()
+
+	netshCfg := &config.FirewallConfig{Enabled: true, Backend: "netsh", Profiles: []string{"public", "all"}}
+	netsh := &fakeFirewall{output: map[string]string{
+		"netsh advfirewall show publicprofile state":   "\r\nPublic Profile Settings:\r\n----------------------------------------------------------------------\r\nState                                 OFF\r\nOk.\r\n",
+		"netsh advfirewall show allprofiles state":     "Domain Profile Settings:\r\nState ON\r\nPrivate Profile Settings:\r\nState OFF\r\nPublic Profile Settings:\r\nState OFF\r\n",
+		"netsh advfirewall set publicprofile state on": "Ok.\r\n",
+	}}
+	backend, _ := newFirewallBackend(netshCfg, netsh.run)
+	status, err := firewallCommand(ctx, backend, &FirewallRequest{Action: "enable", Profile: "public"}, netshCfg)
+	if err != nil || !status.Changed || !slices.Contains(netsh.calls, "netsh advfirewall set publicprofile state on") {
+		t.Fatalf("netsh enable public = %+v, %v (calls %q)", status, err, netsh.calls)
+	}
+	if status.Profiles["all"] {
+		t.Errorf("all profiles enabled with private and public off")
+	}
+
+	ufwCfg := &config.FirewallConfig{Enabled: true, Backend: "ufw", Profiles: []string{"all"}}
+	ufw := &fakeFirewall{output: map[string]string{"ufw status": "Status: active\n\nTo Action From\n"}}
+	backend, _ = newFirewallBackend(ufwCfg, ufw.run)
+	status, err = firewallCommand(ctx, backend, &FirewallRequest{Action: "enable", Profile: "all"}, ufwCfg)
+	if err != nil || status.Changed || !status.Profiles["all"] {
+		t.Fatalf("ufw enable when active = %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TaskGPIO is the task name of the gpio state poll (gpio.poll_interval)
+const TaskGPIO = "gpio"
+
+// GPIORequest is a cmd.gpio request
+type GPIORequest struct {
+	Action   string `json:"action"`             // read, set or pulse
+	Pin      string `json:"pin,omitempty"`      // read: empty = every pin
+	Value    *int   `json:"value,omitempty"`    // set (required) or pulse (default 1): 0 or 1
+	Duration string `json:"duration,omitempty"` // pulse: Go duration, at most commands.timeout
+}
+
+// GPIOMessage is published on {prefix}.{code}.telemetry.gpio after each
+// poll. Code/Location/MessageMeta are stamped by the scheduler.
+type GPIOMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Values map[string]int    `json:"values"`           // By pin name: 0 or 1
+	Errors map[string]string `json:"errors,omitempty"` // Pins that could not be read, by name
+	TS     string            `json:"ts"`
+}
+
+// ReadGPIO reads every configured pin. An error is returned only if GPIO is
+// disabled or no pin could be read.
+func (e *Executor) ReadGPIO() (*GPIOMessage, error) {
+	if e.gpio == nil {
+		return nil, fmt.Errorf("gpio is not enabled")
+	}
+	values, errs := e.gpio.ReadAll()
+	if len(values) == 0 {
+		for name, err := range errs {
+			return nil, fmt.Errorf("no pin could be read (%s: %s)", name, err)
+		}
+	}
+	return &GPIOMessage{Values: values, Errors: errs, TS: utils.NowRFC3339()}, nil
+}
+
+// GPIOCommand performs a cmd.gpio action and returns the resulting pin
+// values. A pulse blocks until it ends (or the agent shuts down);
+// maxPulse bounds its duration.
+func (e *Executor) GPIOCommand(req *GPIORequest, maxPulse time.Duration) (map[string]int, error) {
+	if e.gpio == nil {
+		return nil, fmt.Errorf("gpio is not enabled")
+	}
+
+	switch req.Action {
+	case "read":
+		if req.Pin == "" {
+			msg, err := e.ReadGPIO()
+			if err != nil {
+				return nil, err
+			}
+			if len(msg.Errors) > 0 {
+				return msg.Values, fmt.Errorf("%d pin(s) could not be read", len(msg.Errors))
+			}
+			return msg.Values, nil
+		}
+		v, err := e.gpio.Read(req.Pin)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]int{req.Pin: v}, nil
+
+	case "set":
+		if req.Value == nil {
+			return nil, fmt.Errorf("value is required for set")
+		}
+		if err := e.gpio.Set(req.Pin, *req.Value); err != nil {
+			return nil, err
+		}
+
+	case "pulse":
+		value := 1
+		if req.Value != nil {
+			value = *req.Value
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid duration: %q", req.Duration)
+		}
+		if duration > maxPulse {
+			return nil, fmt.Errorf("duration cannot exceed %v", maxPulse)
+		}
+		if err := e.gpio.Pulse(e.ctx, req.Pin, value, duration); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("action must be read, set, or pulse (got: %q)", req.Action)
+	}
+
+	v, err := e.gpio.Read(req.Pin)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{req.Pin: v}, nil
+}
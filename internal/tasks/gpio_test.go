@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/gpio"
+	"go.uber.org/zap"
+)
+
+// TestGPIOCommandRejects covers the checks made before a pin is touched
+func TestGPIOCommandRejects(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+	if _, err := executor.GPIOCommand(&GPIORequest{Action: "read"}, time.Minute); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("GPIOCommand() without gpio error = %v, want not enabled", err)
+	}
+
+	executor.SetGPIO(gpio.New(config.GPIOConfig{Pins: []config.GPIOPinConfig{{Name: "relay", Line: 27, Direction: "output"}}}))
+	tests := []struct {
+		name    string
+		req     GPIORequest
+		wantErr string
+	}{
+		{"unknown action", GPIORequest{Action: "toggle", Pin: "relay"}, "action must be"},
+		{"set without value", GPIORequest{Action: "set", Pin: "relay"}, "value is required"},
+		{"pulse without duration", GPIORequest{Action: "pulse", Pin: "relay"}, "invalid duration"},
+		{"pulse too long", GPIORequest{Action: "pulse", Pin: "relay", Duration: "2m"}, "cannot exceed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.GPIOCommand(&tt.req, time.Minute)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GPIOCommand() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
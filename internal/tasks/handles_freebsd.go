@@ -0,0 +1,47 @@
+//go:build freebsd
+
+package tasks
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// collectSystemHandles reads system-wide file usage from the kern.openfiles
+// and kern.maxfiles sysctls
+func collectSystemHandles(m *SystemMetrics) error {
+	open, err := unix.SysctlUint32("kern.openfiles")
+	if err != nil {
+		return err
+	}
+	max, err := unix.SysctlUint32("kern.maxfiles")
+	if err != nil {
+		return err
+	}
+
+	m.OpenFDs = uint64(open)
+	m.MaxFDs = uint64(max)
+	return nil
+}
+
+// collectProcessHandles reads the agent's open descriptor count from the
+// kern.proc.nfds sysctl (FreeBSD 13+), which reports the calling process
+func collectProcessHandles(m *AgentMetrics) error {
+	raw, err := unix.SysctlRaw("kern.proc.nfds")
+	if err != nil {
+		return err
+	}
+	if len(raw) != 4 {
+		return fmt.Errorf("unexpected kern.proc.nfds size: %d", len(raw))
+	}
+	m.OpenFDs = uint64(binary.NativeEndian.Uint32(raw))
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err == nil && limit.Cur > 0 {
+		m.FDLimit = uint64(limit.Cur)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// collectSystemHandles reads system-wide file descriptor usage from
+// /proc/sys/fs/file-nr ("allocated unused max")
+func collectSystemHandles(m *SystemMetrics) error {
+	data, err := os.ReadFile("/proc/sys/fs/file-nr")
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) != 3 {
+		return fmt.Errorf("unexpected /proc/sys/fs/file-nr format: %q", strings.TrimSpace(string(data)))
+	}
+	allocated, err1 := strconv.ParseUint(fields[0], 10, 64)
+	unused, err2 := strconv.ParseUint(fields[1], 10, 64)
+	max, err3 := strconv.ParseUint(fields[2], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return fmt.Errorf("unexpected /proc/sys/fs/file-nr format: %q", strings.TrimSpace(string(data)))
+	}
+
+	m.OpenFDs = allocated - unused
+	m.MaxFDs = max
+	return nil
+}
+
+// collectProcessHandles counts the agent's open descriptors in /proc/self/fd
+func collectProcessHandles(m *AgentMetrics) error {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+	// The directory read itself holds one descriptor
+	m.OpenFDs = uint64(len(entries) - 1)
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err == nil {
+		m.FDLimit = limit.Cur
+	}
+	return nil
+}
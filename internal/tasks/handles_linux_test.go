@@ -0,0 +1,45 @@
+//go:build linux
+
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCollectProcessHandles tests that opening a file raises the agent FD count
+func TestCollectProcessHandles(t *testing.T) {
+	var before AgentMetrics
+	if err := collectProcessHandles(&before); err != nil {
+		t.Fatalf("collectProcessHandles() error = %v", err)
+	}
+	if before.OpenFDs == 0 || before.FDLimit == 0 {
+		t.Fatalf("before = %+v, want open FDs and limit", before)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "held-open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var after AgentMetrics
+	if err := collectProcessHandles(&after); err != nil {
+		t.Fatalf("collectProcessHandles() error = %v", err)
+	}
+	if after.OpenFDs != before.OpenFDs+1 {
+		t.Errorf("OpenFDs = %d after opening a file, want %d", after.OpenFDs, before.OpenFDs+1)
+	}
+}
+
+// TestCollectSystemHandles tests reading system-wide FD usage
+func TestCollectSystemHandles(t *testing.T) {
+	var m SystemMetrics
+	if err := collectSystemHandles(&m); err != nil {
+		t.Fatalf("collectSystemHandles() error = %v", err)
+	}
+	if m.OpenFDs == 0 || m.MaxFDs < m.OpenFDs {
+		t.Errorf("open = %d, max = %d, want 0 < open <= max", m.OpenFDs, m.MaxFDs)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !linux && !freebsd
+
+package tasks
+
+import "fmt"
+
+func collectSystemHandles(m *SystemMetrics) error {
+	return fmt.Errorf("file descriptor counts not supported on this platform")
+}
+
+func collectProcessHandles(m *AgentMetrics) error {
+	return fmt.Errorf("file descriptor counts not supported on this platform")
+}
@@ -0,0 +1,64 @@
+//go:build windows
+
+package tasks
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// performanceInformation mirrors PERFORMANCE_INFORMATION (psapi.h)
+type performanceInformation struct {
+	cb                uint32
+	CommitTotal       uintptr
+	CommitLimit       uintptr
+	CommitPeak        uintptr
+	PhysicalTotal     uintptr
+	PhysicalAvailable uintptr
+	SystemCache       uintptr
+	KernelTotal       uintptr
+	KernelPaged       uintptr
+	KernelNonpaged    uintptr
+	PageSize          uintptr
+	HandleCount       uint32
+	ProcessCount      uint32
+	ThreadCount       uint32
+}
+
+// collectSystemHandles reads the system-wide handle count via
+// GetPerformanceInfo. Windows has no fixed handle limit to report.
+func collectSystemHandles(m *SystemMetrics) error {
+	psapi := syscall.NewLazyDLL("psapi.dll")
+	getPerformanceInfo := psapi.NewProc("GetPerformanceInfo")
+
+	var info performanceInformation
+	info.cb = uint32(unsafe.Sizeof(info))
+	ret, _, err := getPerformanceInfo.Call(uintptr(unsafe.Pointer(&info)), uintptr(info.cb))
+	if ret == 0 {
+		return fmt.Errorf("GetPerformanceInfo failed: %w", err)
+	}
+
+	m.Handles = uint64(info.HandleCount)
+	return nil
+}
+
+// collectProcessHandles reads the agent's handle count via
+// GetProcessHandleCount
+func collectProcessHandles(m *AgentMetrics) error {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	getProcessHandleCount := kernel32.NewProc("GetProcessHandleCount")
+
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	var count uint32
+	ret, _, err := getProcessHandleCount.Call(uintptr(process), uintptr(unsafe.Pointer(&count)))
+	if ret == 0 {
+		return fmt.Errorf("GetProcessHandleCount failed: %w", err)
+	}
+
+	m.Handles = uint64(count)
+	return nil
+}
@@ -1,18 +1,148 @@
 package tasks
 
 import (
+	"sync"
+	"time"
+
 	"github.com/stone-age-io/agent/internal/utils"
 )
 
 // Heartbeat is the liveness beacon payload, matching the shape used by the
 // other stone-age.io applications (access-control, kiosk). The code/location
 // are also in the subject; carrying them keeps the message self-describing
-// for any direct subscriber. Agent version is deliberately absent — it is
-// surfaced by the health command instead.
+// for any direct subscriber. The agent's version and commit let dashboards
+// track a release rolling out; cmd.version has the full build info.
 type Heartbeat struct {
 	Code     string `json:"code"`
 	Location string `json:"location"`
-	TS       string `json:"ts"`
+	MessageMeta
+
+	Tags map[string]string `json:"tags,omitempty"` // Device tags (config tags); stamped by the scheduler
+	NATS *ConnectionStats  `json:"nats,omitempty"` // Stamped by the scheduler
+
+	Health *HealthSummary `json:"health,omitempty"` // Stamped by the scheduler; omitted for gateway children
+
+	// Agent build and config fingerprint (see cmd.config.get), stamped by
+	// the scheduler; omitted for gateway children
+	Version           string `json:"version,omitempty"`
+	Commit            string `json:"commit,omitempty"`
+	ConfigFingerprint string `json:"config_fingerprint,omitempty"`
+
+	// Device time zone (IANA name where known) and current UTC offset,
+	// stamped by the scheduler; omitted for gateway children
+	Timezone  string `json:"timezone,omitempty"`
+	UTCOffset string `json:"utc_offset,omitempty"`
+
+	TimeSync *TimeSync `json:"time_sync,omitempty"` // tasks.heartbeat.time_sync; omitted for gateway children
+
+	// Gateway children only (gateway.children): the agent reporting for the
+	// device, and whether its last poll succeeded. Reachable is omitted
+	// before the first poll and for children that are never polled.
+	Gateway   string `json:"gateway,omitempty"`
+	Reachable *bool  `json:"reachable,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	TS string `json:"ts"`
+}
+
+// ConnectionStats summarizes the agent's NATS connection, so the control
+// plane can spot flapping connections and asymmetric routing per site.
+// Counters are cumulative since the agent started.
+type ConnectionStats struct {
+	ServerURL  string  `json:"server_url,omitempty"` // Credentials redacted; empty while disconnected
+	Reconnects uint64  `json:"reconnects"`
+	InMsgs     uint64  `json:"in_msgs"`
+	OutMsgs    uint64  `json:"out_msgs"`
+	InBytes    uint64  `json:"in_bytes"`
+	OutBytes   uint64  `json:"out_bytes"`
+	RTTMs      float64 `json:"rtt_ms,omitempty"` // Round trip to the server; omitted while disconnected
+}
+
+// HealthSummary counts what went wrong since the previous heartbeat, so
+// the control plane can flag degraded agents from heartbeats alone instead
+// of polling cmd.health across the fleet. Zero counts are omitted.
+type HealthSummary struct {
+	Status            string `json:"status"`                       // "healthy", or "degraded" after metrics or inventory failures or reconnects in the window
+	WindowSeconds     int64  `json:"window_seconds"`               // Since the previous heartbeat (since start for the first)
+	Commands          int64  `json:"commands,omitempty"`           // Commands processed, failed ones included
+	CommandErrors     int64  `json:"command_errors,omitempty"`     // Failed commands; they don't degrade the status
+	MetricsFailures   int64  `json:"metrics_failures,omitempty"`   // Failed system metrics scrapes
+	InventoryFailures int64  `json:"inventory_failures,omitempty"` // Failed inventory collections
+	Reconnects        uint64 `json:"reconnects,omitempty"`         // NATS reconnects
+
+	end healthCounters // Counters the window ends at, see RecordHealthSummary
+}
+
+// healthCounters are the cumulative counters a HealthSummary is the
+// difference of
+type healthCounters struct {
+	at                time.Time
+	commands          int64
+	commandErrors     int64
+	metricsFailures   int64
+	inventoryFailures int64
+	reconnects        uint64
+}
+
+// healthWindow holds where the next HealthSummary starts
+type healthWindow struct {
+	mu    sync.Mutex
+	start healthCounters
+}
+
+// HealthSummary returns the counts since the last summary recorded with
+// RecordHealthSummary. reconnects is the NATS client's cumulative count.
+func (e *Executor) HealthSummary(reconnects uint64) *HealthSummary {
+	now := healthCounters{at: time.Now(), reconnects: reconnects}
+	e.stats.mu.RLock()
+	now.commands = e.stats.commandsProcessed
+	now.commandErrors = e.stats.commandsErrored
+	startTime := e.stats.startTime
+	e.stats.mu.RUnlock()
+	e.taskStats.mu.RLock()
+	now.metricsFailures = e.taskStats.metricsFailures
+	now.inventoryFailures = e.taskStats.inventoryFailures
+	e.taskStats.mu.RUnlock()
+
+	e.health.mu.Lock()
+	start := e.health.start
+	e.health.mu.Unlock()
+	if start.at.IsZero() {
+		start.at = startTime
+	}
+	return summarizeHealth(start, now)
+}
+
+// RecordHealthSummary starts the next summary where summary ended, once
+// the heartbeat carrying it is published. Counts in an unpublished summary
+// are reported again with the next one.
+func (e *Executor) RecordHealthSummary(summary *HealthSummary) {
+	if summary == nil {
+		return
+	}
+	e.health.mu.Lock()
+	defer e.health.mu.Unlock()
+	e.health.start = summary.end
+}
+
+func summarizeHealth(start, end healthCounters) *HealthSummary {
+	summary := &HealthSummary{
+		Status:            "healthy",
+		WindowSeconds:     int64(end.at.Sub(start.at).Seconds()),
+		Commands:          end.commands - start.commands,
+		CommandErrors:     end.commandErrors - start.commandErrors,
+		MetricsFailures:   end.metricsFailures - start.metricsFailures,
+		InventoryFailures: end.inventoryFailures - start.inventoryFailures,
+		end:               end,
+	}
+	// The client's count restarts if it is ever recreated
+	if end.reconnects >= start.reconnects {
+		summary.Reconnects = end.reconnects - start.reconnects
+	}
+	if summary.MetricsFailures > 0 || summary.InventoryFailures > 0 || summary.Reconnects > 0 {
+		summary.Status = "degraded"
+	}
+	return summary
 }
 
 // CreateHeartbeat creates a new heartbeat message
@@ -2,6 +2,8 @@ package tasks
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -101,3 +103,78 @@ func TestCreateHeartbeatConsistency(t *testing.T) {
 		t.Errorf("Invalid timestamps: %v, %v", err1, err2)
 	}
 }
+
+// TestHealthSummary tests that summaries count since the last published
+// one and that failures and reconnects degrade the status
+func TestHealthSummary(t *testing.T) {
+	executor, _ := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+
+	first := executor.HealthSummary(0)
+	if first.Status != "healthy" || first.Commands != 0 || first.Reconnects != 0 {
+		t.Errorf("first summary = %+v, want healthy with no counts", first)
+	}
+	executor.RecordHealthSummary(first)
+
+	executor.RecordCommandSuccess()
+	executor.RecordCommandError(errors.New("bad request"))
+	summary := executor.HealthSummary(0)
+	if summary.Status != "healthy" || summary.Commands != 2 || summary.CommandErrors != 1 {
+		t.Errorf("summary = %+v, want healthy with 2 commands, 1 error", summary)
+	}
+
+	// Not recorded, as when the heartbeat fails to publish: counts carry over
+	executor.RecordMetricsFailure(errors.New("scrape failed"))
+	summary = executor.HealthSummary(3)
+	if summary.Status != "degraded" || summary.Commands != 2 || summary.MetricsFailures != 1 || summary.Reconnects != 3 {
+		t.Errorf("summary = %+v, want degraded with 2 commands, 1 metrics failure, 3 reconnects", summary)
+	}
+	executor.RecordHealthSummary(summary)
+
+	summary = executor.HealthSummary(3)
+	if summary.Status != "healthy" || summary.Commands != 0 || summary.MetricsFailures != 0 || summary.Reconnects != 0 {
+		t.Errorf("summary after recording = %+v, want healthy with no counts", summary)
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(data) != `{"status":"healthy","window_seconds":0}` {
+		t.Errorf("JSON = %s, want zero counts omitted", data)
+	}
+}
+
+// TestMessageMetaJSON tests that message metadata is flattened into payloads
+func TestMessageMetaJSON(t *testing.T) {
+	hb := &Heartbeat{
+		Code:        "server-01",
+		MessageMeta: MessageMeta{SchemaVersion: SchemaVersion, Sequence: 42},
+		TS:          "2025-01-01T00:00:00Z",
+	}
+
+	data, err := json.Marshal(hb)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if fields["schema_version"] != float64(SchemaVersion) || fields["sequence"] != float64(42) {
+		t.Errorf("payload = %s, want top-level schema_version and sequence", data)
+	}
+}
+
+// TestMessageMetaMsgID tests Nats-Msg-Id derivation
+func TestMessageMetaMsgID(t *testing.T) {
+	meta := MessageMeta{SchemaVersion: SchemaVersion, Sequence: 7}
+
+	got := meta.MsgID("server-01", "telemetry.system", "2025-01-01T00:00:00Z")
+	if want := "server-01.telemetry.system.2025-01-01T00:00:00Z.7"; got != want {
+		t.Errorf("MsgID() = %q, want %q", got, want)
+	}
+	if next := (MessageMeta{Sequence: 8}).MsgID("server-01", "telemetry.system", "2025-01-01T00:00:00Z"); next == got {
+		t.Error("MsgID() is the same for different sequences")
+	}
+}
@@ -0,0 +1,173 @@
+package tasks
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// IIS object types
+const (
+	IISTypeAppPool = "app_pool"
+	IISTypeSite    = "site"
+)
+
+// IISRequest is a cmd.iis request
+type IISRequest struct {
+	Action string `json:"action"`         // status, start, stop or recycle (app pools only)
+	Type   string `json:"type,omitempty"` // start/stop/recycle: app_pool or site
+	Name   string `json:"name,omitempty"` // start/stop/recycle: a whitelisted app pool or site
+}
+
+// IISStatus is the state of a whitelisted IIS app pool or site, reported by
+// cmd.iis and the service check
+type IISStatus struct {
+	Type   string `json:"type"` // app_pool or site
+	Name   string `json:"name"`
+	Status string `json:"status"` // One of the ServiceStatus* constants
+}
+
+// iisRunner runs appcmd.exe and returns its output
+type iisRunner func(ctx context.Context, args ...string) (string, error)
+
+// appcmdList is the output of "appcmd list apppool|site /xml"
+type appcmdList struct {
+	AppPools []appcmdObject `xml:"APPPOOL"`
+	Sites    []appcmdObject `xml:"SITE"`
+}
+
+type appcmdObject struct {
+	AppPoolName string `xml:"APPPOOL.NAME,attr"`
+	SiteName    string `xml:"SITE.NAME,attr"`
+	State       string `xml:"state,attr"`
+}
+
+// iisCommand performs a cmd.iis action and reports every whitelisted app
+// pool and site afterwards. start and stop report changed=false if the
+// object was already in that state.
+func iisCommand(ctx context.Context, run iisRunner, req *IISRequest, cfg *config.IISConfig) ([]IISStatus, bool, error) {
+	if !cfg.Enabled {
+		return nil, false, fmt.Errorf("IIS control is not enabled")
+	}
+	if req.Action == "status" {
+		statuses, err := iisStatuses(ctx, run, cfg)
+		return statuses, false, err
+	}
+	if req.Action != "start" && req.Action != "stop" && req.Action != "recycle" {
+		return nil, false, fmt.Errorf("invalid action: %s (must be status, start, stop, or recycle)", req.Action)
+	}
+
+	var allowed []string
+	var object string
+	switch req.Type {
+	case IISTypeAppPool:
+		allowed, object = cfg.AppPools, "apppool"
+	case IISTypeSite:
+		if req.Action == "recycle" {
+			return nil, false, fmt.Errorf("only app pools can be recycled")
+		}
+		allowed, object = cfg.Sites, "site"
+	default:
+		return nil, false, fmt.Errorf("invalid type: %s (must be app_pool or site)", req.Type)
+	}
+	i := slices.IndexFunc(allowed, func(name string) bool { return strings.EqualFold(name, req.Name) })
+	if i < 0 {
+		return nil, false, fmt.Errorf("IIS %s not in allowed list: %s", strings.ReplaceAll(req.Type, "_", " "), req.Name)
+	}
+	name := allowed[i]
+
+	if req.Action != "recycle" {
+		states, err := appcmdStates(ctx, run, object)
+		if err != nil {
+			return nil, false, err
+		}
+		state, ok := states[strings.ToLower(name)]
+		if !ok {
+			return nil, false, fmt.Errorf("IIS %s not found: %s", strings.ReplaceAll(req.Type, "_", " "), name)
+		}
+		if (req.Action == "start" && state == ServiceStatusRunning) || (req.Action == "stop" && state == ServiceStatusStopped) {
+			statuses, err := iisStatuses(ctx, run, cfg)
+			return statuses, false, err
+		}
+	}
+
+	if _, err := run(ctx, req.Action, object, "/"+object+".name:"+name); err != nil {
+		return nil, false, err
+	}
+	statuses, err := iisStatuses(ctx, run, cfg)
+	return statuses, true, err
+}
+
+// iisStatuses reports every whitelisted app pool and site. If IIS cannot be
+// queried they are all reported Unknown, along with the error.
+func iisStatuses(ctx context.Context, run iisRunner, cfg *config.IISConfig) ([]IISStatus, error) {
+	statuses := make([]IISStatus, 0, len(cfg.AppPools)+len(cfg.Sites))
+	var firstErr error
+	for _, group := range []struct {
+		typ, object string
+		names       []string
+	}{
+		{IISTypeAppPool, "apppool", cfg.AppPools},
+		{IISTypeSite, "site", cfg.Sites},
+	} {
+		if len(group.names) == 0 {
+			continue
+		}
+		states, err := appcmdStates(ctx, run, group.object)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		for _, name := range group.names {
+			status := ServiceStatusUnknown
+			if err == nil {
+				var ok bool
+				if status, ok = states[strings.ToLower(name)]; !ok {
+					status = ServiceStatusNotInstalled
+				}
+			}
+			statuses = append(statuses, IISStatus{Type: group.typ, Name: name, Status: status})
+		}
+	}
+	return statuses, firstErr
+}
+
+// appcmdStates lists the app pools or sites IIS has, by lower-cased name,
+// with their states mapped to the ServiceStatus* constants
+func appcmdStates(ctx context.Context, run iisRunner, object string) (map[string]string, error) {
+	out, err := run(ctx, "list", object, "/xml")
+	if err != nil {
+		return nil, err
+	}
+	var list appcmdList
+	if err := xml.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("failed to parse appcmd output: %w", err)
+	}
+	states := make(map[string]string)
+	for _, obj := range append(list.AppPools, list.Sites...) {
+		name := obj.AppPoolName
+		if name == "" {
+			name = obj.SiteName
+		}
+		states[strings.ToLower(name)] = iisState(obj.State)
+	}
+	return states, nil
+}
+
+// iisState maps an IIS object state to a ServiceStatus* constant
+func iisState(state string) string {
+	switch state {
+	case "Started":
+		return ServiceStatusRunning
+	case "Stopped":
+		return ServiceStatusStopped
+	case "Starting":
+		return ServiceStatusStarting
+	case "Stopping":
+		return ServiceStatusStopping
+	}
+	return ServiceStatusUnknown
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package tasks
+
+import (
+	"fmt"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// errIISUnsupported is returned by the IIS module off Windows
+var errIISUnsupported = fmt.Errorf("IIS is only supported on Windows")
+
+// IISCommand is Windows only
+func (e *Executor) IISCommand(req *IISRequest, cfg *config.IISConfig) ([]IISStatus, bool, error) {
+	return nil, false, errIISUnsupported
+}
+
+// GetIISStatuses is Windows only
+func (e *Executor) GetIISStatuses(cfg *config.IISConfig) ([]IISStatus, error) {
+	return nil, errIISUnsupported
+}
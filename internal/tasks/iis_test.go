@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// fakeAppcmd answers appcmd list commands from a map of states and applies
+// start/stop/recycle to it
+type fakeAppcmd struct {
+	pools, sites map[string]string
+	changes      []string
+}
+
+func (f *fakeAppcmd) run(ctx context.Context, args ...string) (string, error) {
+	objects, tag := f.pools, "APPPOOL"
+	if args[1] == "site" {
+		objects, tag = f.sites, "SITE"
+	}
+	if args[0] == "list" {
+		var b strings.Builder
+		b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<appcmd>\n")
+		for name, state := range objects {
+			fmt.Fprintf(&b, "    <%s %s.NAME=%q state=%q />\n", tag, tag, name, state)
+		}
+		b.WriteString("</appcmd>\n")
+		return b.String(), nil
+	}
+
+	f.changes = append(f.changes, strings.Join(args, " "))
+	_, name, _ := strings.Cut(args[2], ".name:")
+	switch args[0] {
+	case "start":
+		objects[name] = "Started"
+	case "stop":
+		objects[name] = "Stopped"
+	}
+	return "", nil
+}
+
+func TestIISCommand(t *testing.T) {
+	cfg := &config.IISConfig{
+		Enabled:  true,
+		AppPools: []string{"AppPool1", "Missing"},
+		Sites:    []string{"Default Web Site"},
+	}
+	newFake := func() *fakeAppcmd {
+		return &fakeAppcmd{
+			pools: map[string]string{"AppPool1": "Started", "Other": "Stopped"},
+			sites: map[string]string{"Default Web Site": "Stopped"},
+		}
+	}
+
+	t.Run("status", func(t *testing.T) {
+		statuses, changed, err := iisCommand(context.Background(), newFake().run, &IISRequest{Action: "status"}, cfg)
+		if err != nil || changed {
+			t.Fatalf("status: changed=%v err=%v", changed, err)
+		}
+		want := []IISStatus{
+			{IISTypeAppPool, "AppPool1", ServiceStatusRunning},
+			{IISTypeAppPool, "Missing", ServiceStatusNotInstalled},
+			{IISTypeSite, "Default Web Site", ServiceStatusStopped},
+		}
+		if fmt.Sprint(statuses) != fmt.Sprint(want) {
+			t.Errorf("status = %v, want %v", statuses, want)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		req        IISRequest
+		wantChange string
+		wantErr    bool
+	}{
+		{"start site", IISRequest{Action: "start", Type: "site", Name: "default web site"}, `start site /site.name:Default Web Site`, false},
+		{"start running pool", IISRequest{Action: "start", Type: "app_pool", Name: "AppPool1"}, "", false},
+		{"stop pool", IISRequest{Action: "stop", Type: "app_pool", Name: "AppPool1"}, `stop apppool /apppool.name:AppPool1`, false},
+		{"recycle pool", IISRequest{Action: "recycle", Type: "app_pool", Name: "AppPool1"}, `recycle apppool /apppool.name:AppPool1`, false},
+		{"recycle site", IISRequest{Action: "recycle", Type: "site", Name: "Default Web Site"}, "", true},
+		{"not allowed", IISRequest{Action: "stop", Type: "app_pool", Name: "Other"}, "", true},
+		{"not installed", IISRequest{Action: "start", Type: "app_pool", Name: "Missing"}, "", true},
+		{"bad type", IISRequest{Action: "start", Type: "vdir", Name: "AppPool1"}, "", true},
+		{"bad action", IISRequest{Action: "restart", Type: "app_pool", Name: "AppPool1"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFake()
+			_, changed, err := iisCommand(context.Background(), fake.run, &tt.req, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("iisCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != (tt.wantChange != "") {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChange != "")
+			}
+			if got := strings.Join(fake.changes, "; "); got != tt.wantChange {
+				t.Errorf("appcmd changes = %q, want %q", got, tt.wantChange)
+			}
+		})
+	}
+
+	disabled := *cfg
+	disabled.Enabled = false
+	if _, _, err := iisCommand(context.Background(), newFake().run, &IISRequest{Action: "status"}, &disabled); err == nil {
+		t.Error("iisCommand() with IIS disabled should fail")
+	}
+}
+
+func TestIISStatusesUnavailable(t *testing.T) {
+	cfg := &config.IISConfig{Enabled: true, Sites: []string{"Default Web Site"}}
+	run := func(ctx context.Context, args ...string) (string, error) {
+		return "", fmt.Errorf("appcmd.exe: file does not exist")
+	}
+	statuses, err := iisStatuses(context.Background(), run, cfg)
+	if err == nil {
+		t.Error("iisStatuses() should return the appcmd error")
+	}
+	if len(statuses) != 1 || statuses[0].Status != ServiceStatusUnknown {
+		t.Errorf("iisStatuses() = %v, want Default Web Site Unknown", statuses)
+	}
+}
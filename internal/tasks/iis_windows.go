@@ -0,0 +1,36 @@
+//go:build windows
+
+package tasks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// IISCommand queries, starts, stops or recycles whitelisted IIS app pools
+// and sites
+func (e *Executor) IISCommand(req *IISRequest, cfg *config.IISConfig) ([]IISStatus, bool, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, serviceCommandTimeout)
+	defer cancel()
+	return iisCommand(ctx, runAppcmd, req, cfg)
+}
+
+// GetIISStatuses reports every whitelisted app pool and site for the
+// service check
+func (e *Executor) GetIISStatuses(cfg *config.IISConfig) ([]IISStatus, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, serviceCommandTimeout)
+	defer cancel()
+	return iisStatuses(ctx, runAppcmd, cfg)
+}
+
+// runAppcmd runs IIS's appcmd.exe
+func runAppcmd(ctx context.Context, args ...string) (string, error) {
+	windir := os.Getenv("windir")
+	if windir == "" {
+		windir = `C:\Windows`
+	}
+	return runTool(ctx, filepath.Join(windir, "System32", "inetsrv", "appcmd.exe"), args...)
+}
@@ -4,15 +4,28 @@ package tasks
 // This structure is shared across all platforms. Code/Location are stamped
 // by the scheduler before publishing so the message is self-describing.
 type Inventory struct {
-	Code     string      `json:"code"`
-	Location string      `json:"location"`
-	Agent    AgentInfo   `json:"agent"`
-	OS       OSInfo      `json:"os"`
-	CPU      CPUInfo     `json:"cpu"`
-	Memory   MemoryInfo  `json:"memory"`
-	Disks    []DiskInfo  `json:"disks"`
-	Network  NetworkInfo `json:"network"`
-	TS       string      `json:"ts"`
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Tags map[string]string `json:"tags,omitempty"` // Device tags (config tags); stamped by the scheduler
+
+	// Device time zone (IANA name where known) and current UTC offset, e.g.
+	// Europe/Berlin and +01:00; stamped by the scheduler
+	Timezone  string `json:"timezone,omitempty"`
+	UTCOffset string `json:"utc_offset,omitempty"`
+
+	// Host capabilities and the subsystems disabled for missing ones;
+	// stamped by the scheduler
+	Capabilities []Capability `json:"capabilities,omitempty"`
+
+	Agent   AgentInfo   `json:"agent"`
+	OS      OSInfo      `json:"os"`
+	CPU     CPUInfo     `json:"cpu"`
+	Memory  MemoryInfo  `json:"memory"`
+	Disks   []DiskInfo  `json:"disks"`
+	Network NetworkInfo `json:"network"`
+	TS      string      `json:"ts"`
 }
 
 // AgentInfo contains information about the agent itself
@@ -42,14 +55,36 @@ type MemoryInfo struct {
 
 // DiskInfo contains information about a single disk/volume
 type DiskInfo struct {
-	Drive   string  `json:"drive"`    // Drive letter (Windows: "C:", "D:") or mount point (Unix: "/", "/home")
+	Drive   string  `json:"drive"`    // Drive letter (Windows: "C:", "D:", or a folder mount path) or mount point (Unix: "/", "/home")
 	TotalGB float64 `json:"total_gb"` // Total disk space in GB
 	FreeGB  float64 `json:"free_gb"`  // Free disk space in GB
 }
 
 // NetworkInfo contains network interface information
 type NetworkInfo struct {
-	PrimaryIP string `json:"primary_ip"` // Primary IPv4 address (non-loopback)
+	PrimaryIP string         `json:"primary_ip"`          // Primary IPv4 address (non-loopback)
+	Neighbors []NeighborInfo `json:"neighbors,omitempty"` // ARP/NDP table (tasks.inventory.neighbors)
+	LLDP      []LLDPNeighbor `json:"lldp,omitempty"`      // LLDP neighbors, when lldpd is installed
+}
+
+// NeighborInfo is an ARP (IPv4) or NDP (IPv6) table entry
+type NeighborInfo struct {
+	IP        string `json:"ip"`
+	MAC       string `json:"mac"` // Lowercase, colon-separated
+	Interface string `json:"interface"`
+	State     string `json:"state,omitempty"` // e.g. reachable, stale, permanent
+}
+
+// LLDPNeighbor is a device announcing itself on a local interface over
+// LLDP, normally the switch and port the device is plugged into
+type LLDPNeighbor struct {
+	Interface       string `json:"interface"`                  // Local interface
+	ChassisID       string `json:"chassis_id,omitempty"`       // Usually the switch's MAC address
+	SystemName      string `json:"system_name,omitempty"`      // Switch name
+	MgmtIP          string `json:"mgmt_ip,omitempty"`          // Switch management address
+	PortID          string `json:"port_id,omitempty"`          // Switch port, e.g. Gi1/0/12
+	PortDescription string `json:"port_description,omitempty"` // Often the port's label
+	VLAN            string `json:"vlan,omitempty"`             // Port VLAN ID
 }
 
 // Platform-specific implementations:
@@ -145,32 +145,46 @@ func getMemoryInfo() (MemoryInfo, error) {
 	}, nil
 }
 
-// getDiskInfo retrieves disk information for all fixed drives
+// getDiskInfo retrieves disk information for all fixed drives, then for
+// volumes mounted into folders and cluster shared volumes by mount path
 func getDiskInfo() ([]DiskInfo, error) {
 	kernel32 := syscall.NewLazyDLL("kernel32.dll")
 	getDiskFreeSpaceEx := kernel32.NewProc("GetDiskFreeSpaceExW")
 
 	var disks []DiskInfo
 
-	// Check common drive letters
-	for drive := 'C'; drive <= 'Z'; drive++ {
-		drivePath := fmt.Sprintf("%c:\\", drive)
-
+	usage := func(path string) (total, free uint64, ok bool) {
 		var freeBytesAvailable, totalBytes, totalFreeBytes uint64
 
-		drivePathPtr, _ := syscall.UTF16PtrFromString(drivePath)
+		pathPtr, _ := syscall.UTF16PtrFromString(path)
 		ret, _, _ := getDiskFreeSpaceEx.Call(
-			uintptr(unsafe.Pointer(drivePathPtr)),
+			uintptr(unsafe.Pointer(pathPtr)),
 			uintptr(unsafe.Pointer(&freeBytesAvailable)),
 			uintptr(unsafe.Pointer(&totalBytes)),
 			uintptr(unsafe.Pointer(&totalFreeBytes)),
 		)
+		return totalBytes, freeBytesAvailable, ret != 0 && totalBytes > 0
+	}
 
-		if ret != 0 && totalBytes > 0 {
+	// Check common drive letters
+	for drive := 'C'; drive <= 'Z'; drive++ {
+		if total, free, ok := usage(fmt.Sprintf("%c:\\", drive)); ok {
 			disks = append(disks, DiskInfo{
 				Drive:   fmt.Sprintf("%c:", drive),
-				TotalGB: utils.Round(float64(totalBytes) / 1024 / 1024 / 1024),
-				FreeGB:  utils.Round(float64(freeBytesAvailable) / 1024 / 1024 / 1024),
+				TotalGB: utils.Round(float64(total) / 1024 / 1024 / 1024),
+				FreeGB:  utils.Round(float64(free) / 1024 / 1024 / 1024),
+			})
+		}
+	}
+
+	// Best effort: a failed volume enumeration still reports the letters
+	mounts, _ := folderMounts()
+	for _, mount := range mounts {
+		if total, free, ok := usage(mount + `\`); ok {
+			disks = append(disks, DiskInfo{
+				Drive:   mount,
+				TotalGB: utils.Round(float64(total) / 1024 / 1024 / 1024),
+				FreeGB:  utils.Round(float64(free) / 1024 / 1024 / 1024),
 			})
 		}
 	}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/stone-age-io/agent/internal/secrets"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// Lifecycle states
+const (
+	LifecycleOnline   = "online"
+	LifecycleStopping = "stopping"
+)
+
+// Boot reasons, from the state the previous run left behind
+const (
+	BootReasonStart  = "start"        // First run, or the previous run stopped gracefully
+	BootReasonReload = "reload"       // Restarted to apply a reloaded config
+	BootReasonCrash  = "crash"        // The previous run ended without a graceful shutdown (crash, kill, power loss)
+	BootReasonMemory = "memory_limit" // The memory watchdog restarted the agent
+)
+
+// Stop reasons
+const (
+	StopReasonSignal  = "signal"       // SIGINT/SIGTERM
+	StopReasonService = "service_stop" // Stopped by the service manager
+	StopReasonReload  = "reload"       // Restarting to apply a reloaded config
+	StopReasonMemory  = "memory_limit" // Restarting because the memory watchdog tripped
+)
+
+// LifecycleMessage is published on {prefix}.{code}.telemetry.lifecycle when
+// the agent comes online and when it stops gracefully. The last message on
+// the subject is the agent's current lifecycle state: "online" without a
+// later heartbeat means the link or the host died, "stopping" means the stop
+// was planned.
+type LifecycleMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	State         string `json:"state"` // LifecycleOnline or LifecycleStopping
+	Version       string `json:"version"`
+	BootReason    string `json:"boot_reason,omitempty"`    // Online only, one of the BootReason* constants
+	Reason        string `json:"reason,omitempty"`         // Stopping only, one of the StopReason* constants
+	UptimeSeconds int64  `json:"uptime_seconds,omitempty"` // Stopping only
+	TS            string `json:"ts"`
+}
+
+// CreateLifecycle creates a lifecycle message
+func CreateLifecycle(state, version string) *LifecycleMessage {
+	return &LifecycleMessage{
+		State:   state,
+		Version: version,
+		TS:      utils.NowRFC3339(),
+	}
+}
+
+// lifecycleFile is the run state kept in the data dir between runs
+type lifecycleFile struct {
+	Running    bool   `json:"running"`
+	StopReason string `json:"stop_reason,omitempty"`
+}
+
+// MarkRunning records that the agent is running and returns the boot
+// reason derived from how the previous run ended. A missing or unreadable
+// state file counts as a first start.
+func MarkRunning(path string) (string, error) {
+	reason := BootReasonStart
+	if data, err := os.ReadFile(path); err == nil {
+		var previous lifecycleFile
+		if json.Unmarshal(data, &previous) == nil {
+			switch {
+			case previous.Running:
+				reason = BootReasonCrash
+			case previous.StopReason == StopReasonReload:
+				reason = BootReasonReload
+			case previous.StopReason == StopReasonMemory:
+				reason = BootReasonMemory
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return reason, fmt.Errorf("failed to read lifecycle state: %w", err)
+	}
+
+	data, _ := json.Marshal(lifecycleFile{Running: true})
+	return reason, secrets.WriteFileAtomic(path, data)
+}
+
+// MarkStopped records a graceful stop, so the next run doesn't report a
+// crash
+func MarkStopped(path, reason string) error {
+	data, _ := json.Marshal(lifecycleFile{StopReason: reason})
+	return secrets.WriteFileAtomic(path, data)
+}
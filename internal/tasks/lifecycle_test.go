@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMarkRunning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "lifecycle.json")
+
+	reason, err := MarkRunning(path)
+	if err != nil || reason != BootReasonStart {
+		t.Fatalf("MarkRunning() first run = %q, %v, want %q", reason, err, BootReasonStart)
+	}
+
+	// No MarkStopped: the previous run died
+	if reason, _ := MarkRunning(path); reason != BootReasonCrash {
+		t.Errorf("MarkRunning() after unclean exit = %q, want %q", reason, BootReasonCrash)
+	}
+
+	if err := MarkStopped(path, StopReasonReload); err != nil {
+		t.Fatalf("MarkStopped() error = %v", err)
+	}
+	if reason, _ := MarkRunning(path); reason != BootReasonReload {
+		t.Errorf("MarkRunning() after reload = %q, want %q", reason, BootReasonReload)
+	}
+
+	MarkStopped(path, StopReasonMemory)
+	if reason, _ := MarkRunning(path); reason != BootReasonMemory {
+		t.Errorf("MarkRunning() after watchdog restart = %q, want %q", reason, BootReasonMemory)
+	}
+
+	MarkStopped(path, StopReasonSignal)
+	if reason, _ := MarkRunning(path); reason != BootReasonStart {
+		t.Errorf("MarkRunning() after graceful stop = %q, want %q", reason, BootReasonStart)
+	}
+
+	// A corrupt file counts as a first start
+	os.WriteFile(path, []byte("{"), 0600)
+	if reason, err := MarkRunning(path); err != nil || reason != BootReasonStart {
+		t.Errorf("MarkRunning() with corrupt state = %q, %v, want %q", reason, err, BootReasonStart)
+	}
+}
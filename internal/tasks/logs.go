@@ -2,30 +2,84 @@ package tasks
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
+	"hash/crc32"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 )
 
+// LogPage is one page of a log file. Pages walk backwards from the end of
+// the file, so lines appended while paging don't shift them.
+type LogPage struct {
+	Lines      []string
+	NextCursor string // Fetches the lines before this page; empty at the start of the file
+	Truncated  bool   // The page exceeded the output limit and was cut in the middle
+	Size       int64  // Bytes in the page before truncation (set when truncated)
+}
+
 // FetchLogLines reads the last N lines from a log file
 // Only files matching allowed patterns can be read
 func (e *Executor) FetchLogLines(logPath string, lines int, allowedPatterns []string) ([]string, error) {
+	if err := checkLogFetch(logPath, lines, allowedPatterns); err != nil {
+		return nil, err
+	}
+
+	// Read the file
+	return tailFile(logPath, lines)
+}
+
+// FetchLogPage reads up to N lines from a log file, ending where the
+// previous page (cursor) began or, without a cursor, at the end of the file.
+// A page over maxBytes (0 = 10MB) is cut in the middle.
+// Only files matching allowed patterns can be read
+func (e *Executor) FetchLogPage(logPath string, lines int, cursor string, allowedPatterns []string, maxBytes int) (*LogPage, error) {
+	if err := checkLogFetch(logPath, lines, allowedPatterns); err != nil {
+		return nil, err
+	}
+	page, err := pageFile(logPath, lines, cursor)
+	if err != nil {
+		return nil, err
+	}
+	page.truncate(maxBytes)
+	return page, nil
+}
+
+// truncate cuts the page's lines, joined by newlines, to maxBytes the way
+// command output is cut: the first and last lines are kept and a marker
+// line replaces the middle. The cursor still pages from the page's start.
+func (p *LogPage) truncate(maxBytes int) {
+	if maxBytes <= 0 {
+		maxBytes = maxCommandOutputBytes
+	}
+	text := strings.Join(p.Lines, "\n")
+	if len(text) <= maxBytes {
+		return
+	}
+	cut, _ := truncateMiddle(text, maxBytes)
+	p.Lines = strings.Split(cut, "\n")
+	p.Truncated = true
+	p.Size = int64(len(text))
+}
+
+// checkLogFetch validates a log fetch request
+func checkLogFetch(logPath string, lines int, allowedPatterns []string) error {
 	// Validate path is allowed
 	if !isPathAllowed(logPath, allowedPatterns) {
-		return nil, fmt.Errorf("log path not in allowed list: %s", logPath)
+		return fmt.Errorf("log path not in allowed list: %s", logPath)
 	}
 
 	// Validate lines parameter
 	if lines <= 0 {
-		return nil, fmt.Errorf("lines must be greater than 0")
+		return fmt.Errorf("lines must be greater than 0")
 	}
 	if lines > 10000 {
-		return nil, fmt.Errorf("lines cannot exceed 10000")
+		return fmt.Errorf("lines cannot exceed 10000")
 	}
-
-	// Read the file
-	return tailFile(logPath, lines)
+	return nil
 }
 
 // isPathAllowed checks if a requested path matches any of the allowed patterns
@@ -203,3 +257,142 @@ func reverseString(s string) string {
 	}
 	return string(runes)
 }
+
+// pageFile reads the page of n lines ending before cursor
+func pageFile(filePath string, n int, cursor string) (*LogPage, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	end := stat.Size()
+	if cursor != "" {
+		if end, err = parseLogCursor(file, stat.Size(), cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	lines, start, err := readLinesBefore(file, end, n)
+	if err != nil {
+		return nil, err
+	}
+	page := &LogPage{Lines: lines}
+	if start > 0 {
+		if page.NextCursor, err = logCursor(file, start); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// readLinesBefore reads the last n lines before offset end, returning them
+// with the offset the first of them starts at. Like tailFile it skips
+// empty lines.
+func readLinesBefore(file *os.File, end int64, n int) ([]string, int64, error) {
+	const bufferSize = 64 * 1024
+	var data []byte // The file from pos to end
+	newlines := 0
+	pos := end
+
+	for {
+		if pos == 0 || newlines > n {
+			// Enough lines unless some were empty; read on if so
+			if lines, start, ok := lastLines(data, pos, n); ok || pos == 0 {
+				return lines, start, nil
+			}
+		}
+
+		readSize := min(int64(bufferSize), pos)
+		pos -= readSize
+		chunk := make([]byte, readSize, readSize+int64(len(data)))
+		if _, err := file.ReadAt(chunk, pos); err != nil {
+			return nil, 0, fmt.Errorf("error reading file: %w", err)
+		}
+		newlines += bytes.Count(chunk, []byte{'\n'})
+		data = append(chunk, data...)
+	}
+}
+
+// lastLines returns the last n non-empty lines of data, the file from
+// offset base, and the offset the first of them starts at. ok is false if
+// data holds fewer than n complete lines and doesn't start the file.
+func lastLines(data []byte, base int64, n int) (lines []string, start int64, ok bool) {
+	lines = []string{}
+	start = base + int64(len(data))
+	lineEnd := len(data)
+	for i := len(data) - 1; i >= -1 && len(lines) < n; i-- {
+		if i >= 0 && data[i] != '\n' {
+			continue
+		}
+		if i < 0 && base > 0 {
+			// Partial line: its start is before data
+			break
+		}
+		if line := bytes.TrimSuffix(data[i+1:lineEnd], []byte{'\r'}); len(line) > 0 {
+			lines = append(lines, string(line))
+			start = base + int64(i+1)
+		}
+		lineEnd = i
+	}
+	slices.Reverse(lines)
+
+	if len(lines) < n {
+		if base > 0 {
+			return nil, 0, false
+		}
+		// Only empty lines (or nothing) left before the page
+		start = 0
+	}
+	return lines, start, true
+}
+
+// logCursorPrefix is how many leading bytes of the file a cursor checksums
+const logCursorPrefix = 256
+
+// logCursor encodes a page boundary as its offset and a checksum of the
+// file's first bytes, so a cursor into a rotated file is rejected rather
+// than paging from a meaningless offset
+func logCursor(file *os.File, offset int64) (string, error) {
+	sum, err := logPrefixChecksum(file, offset)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%08x", offset, sum), nil
+}
+
+// parseLogCursor returns the offset of a cursor, checking it still belongs
+// to the file
+func parseLogCursor(file *os.File, size int64, cursor string) (int64, error) {
+	offsetStr, sumStr, _ := strings.Cut(cursor, "-")
+	offset, offsetErr := strconv.ParseInt(offsetStr, 10, 64)
+	want, sumErr := strconv.ParseUint(sumStr, 16, 32)
+	if offsetErr != nil || sumErr != nil || offset <= 0 {
+		return 0, fmt.Errorf("invalid cursor: %q", cursor)
+	}
+	if offset > size {
+		return 0, fmt.Errorf("cursor is past the end of the file (was it rotated?)")
+	}
+	sum, err := logPrefixChecksum(file, offset)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(sum) != want {
+		return 0, fmt.Errorf("cursor does not match the file (was it rotated?)")
+	}
+	return offset, nil
+}
+
+// logPrefixChecksum checksums the file's first bytes, up to offset
+func logPrefixChecksum(file *os.File, offset int64) (uint32, error) {
+	buf := make([]byte, min(offset, logCursorPrefix))
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return 0, fmt.Errorf("error reading file: %w", err)
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,40 @@ func TestReverseString(t *testing.T) {
 		})
 	}
 }
+
+// TestLastLines tests finding page boundaries in a window of the file
+func TestLastLines(t *testing.T) {
+	data := []byte("tail of an earlier line\r\nfirst\n\nsecond 世界\r\nthird")
+
+	lines, start, ok := lastLines(data, 100, 2)
+	if !ok || !reflect.DeepEqual(lines, []string{"second 世界", "third"}) || start != 100+32 {
+		t.Errorf("lastLines(2) = %q, %d, %v", lines, start, ok)
+	}
+
+	// The first line in the window may be partial, so it isn't returned
+	if _, _, ok := lastLines(data, 100, 4); ok {
+		t.Error("lastLines(4) ok with a partial first line")
+	}
+
+	// At the start of the file it is complete
+	lines, start, ok = lastLines(data, 0, 10)
+	if !ok || len(lines) != 4 || lines[0] != "tail of an earlier line" || start != 0 {
+		t.Errorf("lastLines(start of file) = %q, %d, %v", lines, start, ok)
+	}
+}
+
+// TestLogPageTruncate tests that an oversized page keeps its first and last
+// lines around a marker line
+func TestLogPageTruncate(t *testing.T) {
+	page := &LogPage{Lines: []string{"first", "second", "third", "fourth", "last"}}
+	page.truncate(1024)
+	if page.Truncated {
+		t.Fatalf("page under the limit truncated: %+v", page)
+	}
+
+	page.truncate(12)
+	want := []string{"first", "[... 18 bytes truncated ...]", "h", "last"}
+	if !reflect.DeepEqual(page.Lines, want) || !page.Truncated || page.Size != 30 {
+		t.Errorf("truncate() = %q (truncated=%v, size=%d), want %q", page.Lines, page.Truncated, page.Size, want)
+	}
+}
@@ -223,3 +223,62 @@ func TestFetchLogLines(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchLogPage(t *testing.T) {
+	logsDir := t.TempDir()
+	appLog := filepath.Join(logsDir, "app.log")
+	allowed := []string{filepath.Join(logsDir, "*.log")}
+
+	var content strings.Builder
+	for i := 1; i <= 25; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	if err := os.WriteFile(appLog, []byte(content.String()), 0o644); err != nil {
+		t.Fatalf("Failed to create test log file: %v", err)
+	}
+
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	// Walk the file backwards in pages of 10
+	var pages [][]string
+	cursor := ""
+	for {
+		page, err := executor.FetchLogPage(appLog, 10, cursor, allowed, 0)
+		if err != nil {
+			t.Fatalf("FetchLogPage(cursor %q) error = %v", cursor, err)
+		}
+		pages = append(pages, page.Lines)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+
+		// Lines appended while paging don't shift the pages
+		if len(pages) == 1 {
+			f, err := os.OpenFile(appLog, os.O_APPEND|os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Fprintln(f, "line 26")
+			f.Close()
+		}
+	}
+	if len(pages) != 3 || pages[0][0] != "line 16" || pages[1][0] != "line 6" || pages[1][9] != "line 15" ||
+		len(pages[2]) != 5 || pages[2][0] != "line 1" {
+		t.Errorf("pages = %v, want lines 16-25, 6-15 and 1-5", pages)
+	}
+
+	// A cursor into a rotated file is rejected
+	if err := os.WriteFile(appLog, []byte("rotated 1\nrotated 2\nrotated 3\nrotated 4\nrotated 5\nrotated 6\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.FetchLogPage(appLog, 10, "20-00000000", allowed, 0); err == nil || !strings.Contains(err.Error(), "rotated") {
+		t.Errorf("FetchLogPage(stale cursor) error = %v, want a rotation error", err)
+	}
+	if _, err := executor.FetchLogPage(appLog, 10, "garbage", allowed, 0); err == nil || !strings.Contains(err.Error(), "invalid cursor") {
+		t.Errorf("FetchLogPage(garbage cursor) error = %v", err)
+	}
+}
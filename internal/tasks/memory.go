@@ -0,0 +1,21 @@
+package tasks
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// AgentRSS returns the agent process's resident set size in bytes
+func AgentRSS() (uint64, error) {
+	p, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open agent process: %w", err)
+	}
+	mem, err := p.MemoryInfo()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read agent memory: %w", err)
+	}
+	return mem.RSS, nil
+}
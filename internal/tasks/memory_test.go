@@ -0,0 +1,13 @@
+package tasks
+
+import "testing"
+
+func TestAgentRSS(t *testing.T) {
+	rss, err := AgentRSS()
+	if err != nil {
+		t.Fatalf("AgentRSS() error = %v", err)
+	}
+	if rss == 0 {
+		t.Error("AgentRSS() = 0, want the test binary's resident memory")
+	}
+}
@@ -6,34 +6,114 @@ import (
 	"net/http"
 	"time"
 
-	dto "github.com/prometheus/client_model/go"
-
 	"github.com/stone-age-io/agent/internal/utils"
 )
 
 // Maximum age for metrics cache before reset
 const maxMetricsCacheAge = 10 * time.Minute
 
+// SchemaVersion is the version of the published payload formats. Bump it
+// when a field is renamed, removed or changes meaning; added fields do not
+// need a bump.
+const SchemaVersion = 1
+
+// MessageMeta is stamped by the scheduler on every published payload.
+// Sequence increases by one per message on each subject, so a consumer can
+// detect gaps and reordering. It restarts at 1 when the agent restarts.
+type MessageMeta struct {
+	SchemaVersion int    `json:"schema_version"`
+	Sequence      uint64 `json:"sequence"`
+}
+
+// MsgID returns the Nats-Msg-Id for a JetStream publish, so the stream drops
+// a payload re-sent by a retry within its duplicate window. The timestamp
+// keeps IDs unique across agent restarts, which reset the sequence.
+func (m MessageMeta) MsgID(code, suffix, ts string) string {
+	return fmt.Sprintf("%s.%s.%s.%d", code, suffix, ts, m.Sequence)
+}
+
 // SystemMetrics represents system metrics collected from various sources.
 // Code/Location are stamped by the scheduler before publishing so the
 // message is self-describing for any direct subscriber.
 type SystemMetrics struct {
-	Code            string        `json:"code"`
-	Location        string        `json:"location"`
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
 	CPUUsagePercent float64       `json:"cpu_usage_percent"`
 	MemoryFreeGB    float64       `json:"memory_free_gb"`
 	Disks           []DiskMetrics `json:"disks"` // All drives detected on system
-	TS              string        `json:"ts"`
+
+	// System-wide open files (Linux/FreeBSD) or handles (Windows); 0 = unavailable
+	OpenFDs uint64 `json:"open_fds,omitempty"`
+	MaxFDs  uint64 `json:"max_fds,omitempty"`
+	Handles uint64 `json:"handles,omitempty"`
+
+	// CPU sampled within the interval, when tasks.system_metrics.cpu_sample_interval > 0
+	CPUStats *CPUStats `json:"cpu_stats,omitempty"`
+
+	// Heaviest processes, when tasks.system_metrics.top_processes > 0
+	TopProcesses *TopProcesses `json:"top_processes,omitempty"`
+
+	// Per-cgroup CPU, memory and pressure, when tasks.system_metrics.cgroups is set (Linux)
+	Cgroups []CgroupMetrics `json:"cgroups,omitempty"`
+
+	// UPS and battery power status from the latest ups poll, when ups is enabled
+	UPS []UPSStatus `json:"ups,omitempty"`
+
+	// Hybrid source only: selected exporter families, keyed by family name
+	Extra      map[string][]ExtraSample `json:"extra,omitempty"`
+	ExtraError string                   `json:"extra_error,omitempty"` // Exporter scrape failure; core metrics are still valid
+
+	// Exporter source with fallback only: the exporter error while these
+	// metrics come from the builtin collector instead
+	Fallback string `json:"fallback,omitempty"`
+
+	// PDH source only: performance counters, keyed by counter path
+	Counters     map[string][]CounterSample `json:"counters,omitempty"`
+	CounterError string                     `json:"counter_error,omitempty"` // Counters that could not be read; the rest are still valid
+
+	TS string `json:"ts"`
+}
+
+// ExtraSample is one series of an exporter family (hybrid source)
+type ExtraSample struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
 }
 
 // DiskMetrics represents metrics for a single disk drive
 type DiskMetrics struct {
-	Drive            string  `json:"drive"`               // Drive letter (C:, D:) or mount point (/, /home)
-	FreePercent      float64 `json:"free_percent"`        // Percentage of free space
-	FreeGB           float64 `json:"free_gb"`             // Free space in GB
-	TotalGB          float64 `json:"total_gb"`            // Total space in GB
-	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`  // Read rate (requires previous measurement)
-	WriteBytesPerSec float64 `json:"write_bytes_per_sec"` // Write rate (requires previous measurement)
+	Drive            string        `json:"drive"`                   // Drive letter (C:, D:), Windows folder mount path, or mount point (/, /home)
+	FreePercent      float64       `json:"free_percent"`            // Percentage of free space
+	FreeGB           float64       `json:"free_gb"`                 // Free space in GB
+	TotalGB          float64       `json:"total_gb"`                // Total space in GB
+	ReadBytesPerSec  float64       `json:"read_bytes_per_sec"`      // Read rate (requires previous measurement)
+	WriteBytesPerSec float64       `json:"write_bytes_per_sec"`     // Write rate (requires previous measurement)
+	FullInHours      float64       `json:"full_in_hours,omitempty"` // Projected time to full at the current trend (disk_forecast; omitted while not shrinking)
+	Inodes           *InodeMetrics `json:"inodes,omitempty"`        // Linux/FreeBSD; omitted where the filesystem has no inode limit
+}
+
+// InodeMetrics holds a filesystem's inode usage. A volume can run out of
+// inodes with plenty of free bytes, e.g. from millions of small files.
+type InodeMetrics struct {
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	FreePercent float64 `json:"free_percent"`
+}
+
+// newInodeMetrics returns inode usage from total and free counts, or nil
+// when the filesystem reports none (btrfs, which allocates them dynamically)
+func newInodeMetrics(total, free uint64) *InodeMetrics {
+	if total == 0 {
+		return nil
+	}
+	free = min(free, total)
+	return &InodeMetrics{
+		Total:       total,
+		Free:        free,
+		FreePercent: utils.Round(float64(free) / float64(total) * 100),
+	}
 }
 
 // TelemetryError is the error message published on a telemetry subject when
@@ -42,9 +122,11 @@ type DiskMetrics struct {
 type TelemetryError struct {
 	Code     string `json:"code"`
 	Location string `json:"location"`
-	Status   string `json:"status"`
-	Error    string `json:"error"`
-	TS       string `json:"ts"`
+	MessageMeta
+
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	TS     string `json:"ts"`
 }
 
 // CreateTelemetryError creates an error message for telemetry failures
@@ -56,12 +138,16 @@ func CreateTelemetryError(err error) *TelemetryError {
 	}
 }
 
+// defaultScrapeTimeout bounds a metrics scrape unless tasks.system_metrics.timeout
+// overrides it via SetScrapeTimeout
+const defaultScrapeTimeout = 30 * time.Second
+
 // createHTTPClient creates an HTTP client with appropriate timeouts for metrics scraping
 // This client is created ONCE and reused for all scrapes for efficiency
 func createHTTPClient() *http.Client {
 	return &http.Client{
 		// Overall request timeout (connection + headers + body read)
-		Timeout: 30 * time.Second,
+		Timeout: defaultScrapeTimeout,
 		Transport: &http.Transport{
 			// Time to establish TCP connection
 			DialContext: (&net.Dialer{
@@ -71,8 +157,9 @@ func createHTTPClient() *http.Client {
 			}).DialContext,
 			// Time to complete TLS handshake (if HTTPS)
 			TLSHandshakeTimeout: 5 * time.Second,
-			// Time to receive response headers
-			ResponseHeaderTimeout: 10 * time.Second,
+			// Time to receive response headers. Exporters only send headers
+			// once collection finishes, so this tracks the scrape timeout
+			ResponseHeaderTimeout: defaultScrapeTimeout,
 			// ENABLE connection reuse for localhost scraping efficiency
 			DisableKeepAlives:   false,
 			MaxIdleConns:        10,
@@ -113,6 +200,9 @@ func validateMetrics(m *SystemMetrics, collector MetricsCollector) error {
 		if disk.TotalGB < 0 {
 			return fmt.Errorf("invalid disk total space for %s: %.2f GB (cannot be negative)", disk.Drive, disk.TotalGB)
 		}
+		if disk.Inodes != nil && (disk.Inodes.FreePercent < 0 || disk.Inodes.FreePercent > 100) {
+			return fmt.Errorf("invalid inode free percent for %s: %.2f%% (must be 0-100)", disk.Drive, disk.Inodes.FreePercent)
+		}
 
 		// Validate I/O rates (only if we have values - not on first scrape)
 		if !isFirstScrape {
@@ -127,14 +217,3 @@ func validateMetrics(m *SystemMetrics, collector MetricsCollector) error {
 
 	return nil
 }
-
-// getLabelValue extracts a label value from a metric's label pairs
-// Used by the exporter collector for Prometheus metrics parsing
-func getLabelValue(labels []*dto.LabelPair, name string) string {
-	for _, label := range labels {
-		if label.GetName() == name {
-			return label.GetValue()
-		}
-	}
-	return ""
-}
@@ -13,6 +13,8 @@ type MetricNames struct {
 	DiskSizeBytes  string // Gauge: disk total size
 	DiskReadBytes  string // Counter: disk read bytes
 	DiskWriteBytes string // Counter: disk write bytes
+	DiskFiles      string // Gauge: total inodes ("" where the exporter has none)
+	DiskFilesFree  string // Gauge: free inodes
 	VolumeLabel    string // Label name for disk identifier
 }
 
@@ -39,6 +41,8 @@ func GetMetricNames() MetricNames {
 			DiskSizeBytes:  "node_filesystem_size_bytes",
 			DiskReadBytes:  "node_disk_read_bytes_total",
 			DiskWriteBytes: "node_disk_written_bytes_total",
+			DiskFiles:      "node_filesystem_files",
+			DiskFilesFree:  "node_filesystem_files_free",
 			VolumeLabel:    "mountpoint", // "/", "/home", etc.
 		}
 	default:
@@ -51,6 +55,8 @@ func GetMetricNames() MetricNames {
 			DiskSizeBytes:  "node_filesystem_size_bytes",
 			DiskReadBytes:  "node_disk_read_bytes_total",
 			DiskWriteBytes: "node_disk_written_bytes_total",
+			DiskFiles:      "node_filesystem_files",
+			DiskFilesFree:  "node_filesystem_files_free",
 			VolumeLabel:    "mountpoint",
 		}
 	}
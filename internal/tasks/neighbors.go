@@ -0,0 +1,278 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxNeighbors caps the neighbor table in inventory, which is bounded by the
+// NATS payload size on a large flat network
+const maxNeighbors = 512
+
+// netNeighborScript lists the Windows neighbor cache (ARP and NDP)
+const netNeighborScript = `$ErrorActionPreference = 'Stop'
+$result = Get-NetNeighbor | ForEach-Object {
+  [pscustomobject]@{ ip = $_.IPAddress; mac = $_.LinkLayerAddress; interface = $_.InterfaceAlias; state = [string]$_.State }
+}
+ConvertTo-Json -InputObject @($result) -Compress`
+
+// CollectNeighbors adds the ARP/NDP table and, when lldpd is installed, the
+// LLDP neighbors to info. Failures are logged and leave the field empty.
+func (e *Executor) CollectNeighbors(ctx context.Context, info *NetworkInfo) {
+	if e.Unavailable("tasks.inventory.neighbors") != nil {
+		return // Warned about at startup
+	}
+
+	neighbors, err := readNeighbors(ctx, runTool, runtime.GOOS)
+	if err != nil {
+		e.logger.Warn("Failed to collect neighbor table", zap.Error(err))
+	} else {
+		if len(neighbors) > maxNeighbors {
+			e.logger.Warn("Neighbor table truncated in inventory",
+				zap.Int("entries", len(neighbors)),
+				zap.Int("max", maxNeighbors))
+			neighbors = neighbors[:maxNeighbors]
+		}
+		info.Neighbors = neighbors
+	}
+
+	lldp, err := readLLDP(ctx, runTool)
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		// lldpd is optional
+	case err != nil:
+		e.logger.Warn("Failed to collect LLDP neighbors", zap.Error(err))
+	default:
+		info.LLDP = lldp
+	}
+}
+
+// readNeighbors reads the neighbor table: ip neigh on Linux, arp and ndp on
+// FreeBSD, Get-NetNeighbor on Windows
+func readNeighbors(ctx context.Context, run toolRunner, goos string) ([]NeighborInfo, error) {
+	switch goos {
+	case "linux":
+		out, err := run(ctx, "ip", "-j", "neigh", "show")
+		if err != nil {
+			return nil, err
+		}
+		return parseIPNeigh(out)
+	case "freebsd":
+		out, err := run(ctx, "arp", "-an")
+		if err != nil {
+			return nil, err
+		}
+		neighbors := parseARP(out)
+		// IPv6 may be compiled out; the ARP table is still worth reporting
+		if out, err := run(ctx, "ndp", "-an"); err == nil {
+			neighbors = append(neighbors, parseNDP(out)...)
+		}
+		return neighbors, nil
+	case "windows":
+		out, err := run(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-Command", netNeighborScript)
+		if err != nil {
+			return nil, err
+		}
+		return parseNetNeighbor(out)
+	}
+	return nil, fmt.Errorf("neighbor table not supported on platform: %s", goos)
+}
+
+// neighborEntry normalizes an entry, dropping those without a usable
+// hardware address: incomplete, failed, broadcast and multicast entries
+func neighborEntry(ip, mac, iface, state string) (NeighborInfo, bool) {
+	ip, _, _ = strings.Cut(ip, "%") // fe80::1%em0
+	hw, err := net.ParseMAC(mac)
+	if err != nil || net.ParseIP(ip) == nil || bytes.Equal(hw, make(net.HardwareAddr, len(hw))) || hw[0]&1 == 1 {
+		return NeighborInfo{}, false
+	}
+	return NeighborInfo{IP: ip, MAC: hw.String(), Interface: iface, State: strings.ToLower(state)}, true
+}
+
+// parseIPNeigh parses "ip -j neigh show" output
+func parseIPNeigh(out string) ([]NeighborInfo, error) {
+	var entries []struct {
+		Dst    string   `json:"dst"`
+		Dev    string   `json:"dev"`
+		LLAddr string   `json:"lladdr"`
+		State  []string `json:"state"`
+	}
+	if err := json.Unmarshal([]byte(out), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse ip neigh output: %w", err)
+	}
+	neighbors := []NeighborInfo{}
+	for _, entry := range entries {
+		var state string
+		if len(entry.State) > 0 {
+			state = entry.State[0]
+		}
+		if neighbor, ok := neighborEntry(entry.Dst, entry.LLAddr, entry.Dev, state); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors, nil
+}
+
+// parseARP parses FreeBSD "arp -an" output:
+//
+//	? (192.168.1.1) at 00:11:22:33:44:55 on em0 expires in 1187 seconds [ethernet]
+//	? (192.168.1.10) at 00:aa:bb:cc:dd:ee on em0 permanent [ethernet]
+func parseARP(out string) []NeighborInfo {
+	neighbors := []NeighborInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[2] != "at" || fields[4] != "on" {
+			continue
+		}
+		var state string
+		if len(fields) > 6 && fields[6] == "permanent" {
+			state = "permanent"
+		}
+		if neighbor, ok := neighborEntry(strings.Trim(fields[1], "()"), fields[3], fields[5], state); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors
+}
+
+// ndpStates maps the ndp -a state column
+var ndpStates = map[string]string{"R": "reachable", "S": "stale", "D": "delay", "P": "probe"}
+
+// parseNDP parses FreeBSD "ndp -an" output:
+//
+//	Neighbor                   Linklayer Address  Netif Expire    S Flags
+//	fe80::1%em0                00:11:22:33:44:55    em0 23h59m58s S R
+//	2001:db8::10               00:11:22:33:44:66    em0 permanent R
+func parseNDP(out string) []NeighborInfo {
+	neighbors := []NeighborInfo{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] == "Neighbor" {
+			continue
+		}
+		var state string
+		if fields[3] == "permanent" {
+			state = "permanent"
+		} else if len(fields) > 4 {
+			state = ndpStates[fields[4]]
+		}
+		if neighbor, ok := neighborEntry(fields[0], fields[1], fields[2], state); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors
+}
+
+// parseNetNeighbor decodes netNeighborScript output
+func parseNetNeighbor(out string) ([]NeighborInfo, error) {
+	var entries []struct {
+		IP        string `json:"ip"`
+		MAC       string `json:"mac"`
+		Interface string `json:"interface"`
+		State     string `json:"state"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse neighbor table: %w", err)
+	}
+	neighbors := []NeighborInfo{}
+	for _, entry := range entries {
+		if neighbor, ok := neighborEntry(entry.IP, entry.MAC, entry.Interface, entry.State); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors, nil
+}
+
+// readLLDP asks lldpd for its neighbors
+func readLLDP(ctx context.Context, run toolRunner) ([]LLDPNeighbor, error) {
+	out, err := run(ctx, "lldpctl", "-f", "json0")
+	if err != nil {
+		return nil, err
+	}
+	return parseLLDPCtl(out)
+}
+
+// lldpValues is a json0 value list: [{"value": "..."}]
+type lldpValues []struct {
+	Value string `json:"value"`
+}
+
+func (v lldpValues) first() string {
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0].Value
+}
+
+// lldpFlag is a json0 flag, "yes"/"no" (or a bool in some versions)
+type lldpFlag bool
+
+func (f *lldpFlag) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	*f = lldpFlag(s == "yes" || s == "true")
+	return nil
+}
+
+// parseLLDPCtl parses "lldpctl -f json0" output, in which every element is
+// a list so the shape doesn't depend on the number of neighbors
+func parseLLDPCtl(out string) ([]LLDPNeighbor, error) {
+	var parsed struct {
+		LLDP []struct {
+			Interface []struct {
+				Name    string `json:"name"`
+				Chassis []struct {
+					ID     lldpValues `json:"id"`
+					Name   lldpValues `json:"name"`
+					MgmtIP lldpValues `json:"mgmt-ip"`
+				} `json:"chassis"`
+				Port []struct {
+					ID    lldpValues `json:"id"`
+					Descr lldpValues `json:"descr"`
+				} `json:"port"`
+				VLAN []struct {
+					ID   string   `json:"vlan-id"`
+					PVID lldpFlag `json:"pvid"`
+				} `json:"vlan"`
+			} `json:"interface"`
+		} `json:"lldp"`
+	}
+	if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse lldpctl output: %w", err)
+	}
+
+	neighbors := []LLDPNeighbor{}
+	for _, lldp := range parsed.LLDP {
+		for _, iface := range lldp.Interface {
+			neighbor := LLDPNeighbor{Interface: iface.Name}
+			if len(iface.Chassis) > 0 {
+				chassis := iface.Chassis[0]
+				neighbor.ChassisID = chassis.ID.first()
+				neighbor.SystemName = chassis.Name.first()
+				neighbor.MgmtIP = chassis.MgmtIP.first()
+			}
+			if len(iface.Port) > 0 {
+				neighbor.PortID = iface.Port[0].ID.first()
+				neighbor.PortDescription = iface.Port[0].Descr.first()
+			}
+			for i, vlan := range iface.VLAN {
+				if i == 0 || vlan.PVID {
+					neighbor.VLAN = vlan.ID
+				}
+				if vlan.PVID {
+					break
+				}
+			}
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+	return neighbors, nil
+}
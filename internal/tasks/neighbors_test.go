@@ -0,0 +1,121 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseIPNeigh(t *testing.T) {
+	out := `[{"dst":"192.168.1.1","dev":"eth0","lladdr":"00:11:22:AA:BB:CC","router":null,"state":["REACHABLE"]},` +
+		`{"dst":"192.168.1.7","dev":"eth0","state":["FAILED"]},` +
+		`{"dst":"fe80::1","dev":"eth0","lladdr":"00:11:22:aa:bb:cc","router":null,"state":["STALE"]},` +
+		`{"dst":"224.0.0.251","dev":"eth0","lladdr":"01:00:5e:00:00:fb","state":["NOARP"]}]`
+	got, err := parseIPNeigh(out)
+	if err != nil {
+		t.Fatalf("parseIPNeigh() error = %v", err)
+	}
+	want := []NeighborInfo{
+		{IP: "192.168.1.1", MAC: "00:11:22:aa:bb:cc", Interface: "eth0", State: "reachable"},
+		{IP: "fe80::1", MAC: "00:11:22:aa:bb:cc", Interface: "eth0", State: "stale"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIPNeigh() = %+v, want %+v", got, want)
+	}
+
+	if got, err := parseIPNeigh("[]"); err != nil || len(got) != 0 {
+		t.Errorf("parseIPNeigh(empty) = %+v, %v", got, err)
+	}
+}
+
+func TestParseARPAndNDP(t *testing.T) {
+	arp := `? (192.168.1.1) at 00:11:22:33:44:55 on em0 expires in 1187 seconds [ethernet]
+? (192.168.1.10) at 00:aa:bb:cc:dd:ee on em0 permanent [ethernet]
+? (192.168.1.20) at (incomplete) on em0 expired [ethernet]
+`
+	want := []NeighborInfo{
+		{IP: "192.168.1.1", MAC: "00:11:22:33:44:55", Interface: "em0"},
+		{IP: "192.168.1.10", MAC: "00:aa:bb:cc:dd:ee", Interface: "em0", State: "permanent"},
+	}
+	if got := parseARP(arp); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseARP() = %+v, want %+v", got, want)
+	}
+
+	ndp := `Neighbor                             Linklayer Address  Netif Expire    S Flags
+fe80::1%em0                          00:11:22:33:44:55    em0 23h59m58s S R
+2001:db8::10                         00:11:22:33:44:66    em0 permanent R
+2001:db8::20                         (incomplete)         em0 expired   I
+`
+	want = []NeighborInfo{
+		{IP: "fe80::1", MAC: "00:11:22:33:44:55", Interface: "em0", State: "stale"},
+		{IP: "2001:db8::10", MAC: "00:11:22:33:44:66", Interface: "em0", State: "permanent"},
+	}
+	if got := parseNDP(ndp); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNDP() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseNetNeighbor(t *testing.T) {
+	out := `[{"ip":"10.0.0.1","mac":"00-11-22-33-44-55","interface":"Ethernet","state":"Reachable"},` +
+		`{"ip":"10.0.0.255","mac":"FF-FF-FF-FF-FF-FF","interface":"Ethernet","state":"Permanent"},` +
+		`{"ip":"10.0.0.9","mac":"00-00-00-00-00-00","interface":"Ethernet","state":"Unreachable"}]`
+	got, err := parseNetNeighbor(out)
+	if err != nil {
+		t.Fatalf("parseNetNeighbor() error = %v", err)
+	}
+	want := []NeighborInfo{{IP: "10.0.0.1", MAC: "00:11:22:33:44:55", Interface: "Ethernet", State: "reachable"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseNetNeighbor() = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadNeighbors(t *testing.T) {
+	var commands []string
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		commands = append(commands, name)
+		if name == "ndp" {
+			return "", fmt.Errorf("ndp failed: exit status 1")
+		}
+		return "? (192.168.1.1) at 00:11:22:33:44:55 on em0 expires in 1187 seconds [ethernet]\n", nil
+	}
+	got, err := readNeighbors(context.Background(), run, "freebsd")
+	if err != nil || len(got) != 1 {
+		t.Errorf("readNeighbors(freebsd) = %+v, %v; want the ARP entry without NDP", got, err)
+	}
+	if !reflect.DeepEqual(commands, []string{"arp", "ndp"}) {
+		t.Errorf("readNeighbors(freebsd) ran %v", commands)
+	}
+
+	if _, err := readNeighbors(context.Background(), run, "darwin"); err == nil {
+		t.Error("readNeighbors(darwin) succeeded")
+	}
+}
+
+func TestParseLLDPCtl(t *testing.T) {
+	out := `{"lldp": [{"interface": [
+	{"name": "eth0", "via": "LLDP", "rid": "1", "age": "0 day, 02:11:38",
+	 "chassis": [{"id": [{"type": "mac", "value": "00:1b:54:aa:bb:cc"}], "name": [{"value": "sw-store-12"}],
+	              "descr": [{"value": "Cisco IOS Software"}], "mgmt-ip": [{"value": "10.20.0.2"}]}],
+	 "port": [{"id": [{"type": "ifname", "value": "Gi1/0/12"}], "descr": [{"value": "kiosk-3"}], "ttl": [{"value": "120"}]}],
+	 "vlan": [{"vlan-id": "20", "pvid": "no", "value": "voice"}, {"vlan-id": "10", "pvid": "yes", "value": "pos"}]},
+	{"name": "eth1", "via": "LLDP", "rid": "2",
+	 "chassis": [{"id": [{"type": "mac", "value": "00:1b:54:dd:ee:ff"}]}],
+	 "port": [{"id": [{"type": "mac", "value": "00:1b:54:dd:ee:01"}]}]}
+]}]}`
+	got, err := parseLLDPCtl(out)
+	if err != nil {
+		t.Fatalf("parseLLDPCtl() error = %v", err)
+	}
+	want := []LLDPNeighbor{
+		{Interface: "eth0", ChassisID: "00:1b:54:aa:bb:cc", SystemName: "sw-store-12", MgmtIP: "10.20.0.2", PortID: "Gi1/0/12", PortDescription: "kiosk-3", VLAN: "10"},
+		{Interface: "eth1", ChassisID: "00:1b:54:dd:ee:ff", PortID: "00:1b:54:dd:ee:01"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLLDPCtl() = %+v, want %+v", got, want)
+	}
+
+	if got, err := parseLLDPCtl(`{"lldp": [{}]}`); err != nil || len(got) != 0 {
+		t.Errorf("parseLLDPCtl(no neighbors) = %+v, %v", got, err)
+	}
+}
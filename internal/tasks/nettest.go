@@ -0,0 +1,262 @@
+package tasks
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// NetTestRequest is a cmd.nettest request
+type NetTestRequest struct {
+	Target    string `json:"target"`              // A commands.nettest.targets name
+	Direction string `json:"direction,omitempty"` // download (default) or upload (iperf3 only)
+	Duration  string `json:"duration,omitempty"`  // e.g. "5s"; default and cap commands.nettest.max_duration
+}
+
+// NetTestResult is the outcome of a throughput/latency test
+type NetTestResult struct {
+	Target          string  `json:"target"`
+	Type            string  `json:"type"` // iperf3 or https
+	Direction       string  `json:"direction"`
+	DurationSeconds float64 `json:"duration_seconds"` // Time spent transferring
+	Bytes           int64   `json:"bytes"`
+	ThroughputMbps  float64 `json:"throughput_mbps"`
+
+	// https: connection setup and time to first byte
+	ConnectMs   *float64 `json:"connect_ms,omitempty"`
+	TLSMs       *float64 `json:"tls_ms,omitempty"`
+	FirstByteMs *float64 `json:"first_byte_ms,omitempty"`
+
+	// iperf3 upload: mean TCP round trip time and retransmits seen by the
+	// agent as sender
+	RTTMs       *float64 `json:"rtt_ms,omitempty"`
+	Retransmits *int64   `json:"retransmits,omitempty"`
+
+	TS string `json:"ts"`
+}
+
+// netTestRunning keeps tests from running concurrently: two tests would
+// share the link and each measure half of it
+var netTestRunning atomic.Bool
+
+// NetTest runs a throughput test against a whitelisted target
+func (e *Executor) NetTest(req *NetTestRequest, cfg *config.NetTestConfig, timeout time.Duration) (*NetTestResult, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, timeout)
+	defer cancel()
+	return netTest(ctx, runTool, http.DefaultTransport.(*http.Transport), req, cfg)
+}
+
+func netTest(ctx context.Context, run toolRunner, transport *http.Transport, req *NetTestRequest, cfg *config.NetTestConfig) (*NetTestResult, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("network tests are not enabled")
+	}
+	var target *config.NetTestTargetConfig
+	for i := range cfg.Targets {
+		if cfg.Targets[i].Name == req.Target {
+			target = &cfg.Targets[i]
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("nettest target not in allowed list: %s", req.Target)
+	}
+
+	direction := req.Direction
+	if direction == "" {
+		direction = "download"
+	}
+	if direction != "download" && direction != "upload" {
+		return nil, fmt.Errorf("invalid direction: %s (must be download or upload)", direction)
+	}
+	if direction == "upload" && target.Type != "iperf3" {
+		return nil, fmt.Errorf("upload tests need an iperf3 target")
+	}
+
+	duration := cfg.MaxDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid duration: %q (must be at least 1s)", req.Duration)
+		}
+		if d > cfg.MaxDuration {
+			return nil, fmt.Errorf("duration %v exceeds commands.nettest.max_duration (%v)", d, cfg.MaxDuration)
+		}
+		duration = d
+	}
+
+	if !netTestRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("a network test is already running")
+	}
+	defer netTestRunning.Store(false)
+
+	var result *NetTestResult
+	var err error
+	switch target.Type {
+	case "iperf3":
+		result, err = iperf3Test(ctx, run, target.Address, direction, duration)
+	case "https":
+		result, err = httpsTest(ctx, transport, target.Address, duration)
+	default:
+		err = fmt.Errorf("unknown nettest type: %s", target.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Target = target.Name
+	result.Type = target.Type
+	result.Direction = direction
+	result.TS = utils.NowRFC3339()
+	return result, nil
+}
+
+// iperf3Test runs the iperf3 client. -R makes the server send, so a
+// download measures the site's inbound path.
+func iperf3Test(ctx context.Context, run toolRunner, address, direction string, duration time.Duration) (*NetTestResult, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host, port = address, "5201"
+	}
+	seconds := int(duration.Round(time.Second) / time.Second)
+	args := []string{"-c", host, "-p", port, "-t", strconv.Itoa(seconds), "-J"}
+	if direction == "download" {
+		args = append(args, "-R")
+	}
+
+	// iperf3 reports its own errors in the JSON, with a non-zero exit
+	out, err := run(ctx, "iperf3", args...)
+	if err != nil && errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("iperf3 not found (is it installed?)")
+	}
+	result, parseErr := parseIperf3(out, direction)
+	if parseErr != nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, parseErr
+	}
+	return result, nil
+}
+
+// iperf3Output is the part of "iperf3 -J" output used here
+type iperf3Output struct {
+	Error string `json:"error"`
+	End   struct {
+		Streams []struct {
+			Sender struct {
+				MeanRTT *float64 `json:"mean_rtt"` // Microseconds; Linux senders only
+			} `json:"sender"`
+		} `json:"streams"`
+		SumSent struct {
+			Retransmits *int64 `json:"retransmits"`
+		} `json:"sum_sent"`
+		SumReceived struct {
+			Seconds       float64 `json:"seconds"`
+			Bytes         int64   `json:"bytes"`
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+	} `json:"end"`
+}
+
+// parseIperf3 reads the receiver's totals, which is what actually arrived
+func parseIperf3(out, direction string) (*NetTestResult, error) {
+	var parsed iperf3Output
+	if err := json.Unmarshal([]byte(out), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse iperf3 output: %w", err)
+	}
+	if parsed.Error != "" {
+		return nil, fmt.Errorf("iperf3: %s", parsed.Error)
+	}
+	sum := parsed.End.SumReceived
+	if sum.Seconds == 0 {
+		return nil, fmt.Errorf("iperf3 reported no transfer")
+	}
+	result := &NetTestResult{
+		DurationSeconds: sum.Seconds,
+		Bytes:           sum.Bytes,
+		ThroughputMbps:  utils.Round(sum.BitsPerSecond / 1e6),
+	}
+
+	// Sender statistics are the agent's own only when it sends
+	if direction == "upload" {
+		result.Retransmits = parsed.End.SumSent.Retransmits
+		if len(parsed.End.Streams) > 0 && parsed.End.Streams[0].Sender.MeanRTT != nil {
+			rtt := utils.Round(*parsed.End.Streams[0].Sender.MeanRTT / 1000)
+			result.RTTMs = &rtt
+		}
+	}
+	return result, nil
+}
+
+// httpsTest downloads from url for up to duration, on a fresh connection so
+// setup times are measured
+func httpsTest(ctx context.Context, base *http.Transport, url string, duration time.Duration) (*NetTestResult, error) {
+	transport := base.Clone()
+	transport.DisableKeepAlives = true
+	transport.DisableCompression = true // Measure the bytes on the wire
+	defer transport.CloseIdleConnections()
+
+	var connectStart, connectDone, tlsStart, tlsDone, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		ConnectStart:         func(string, string) { connectStart = time.Now() },
+		ConnectDone:          func(string, string, error) { connectDone = time.Now() },
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+
+	start := time.Now()
+	transferCtx, cancel := context.WithDeadline(ctx, start.Add(duration))
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(transferCtx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("nettest request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("nettest request failed: HTTP %d", resp.StatusCode)
+	}
+
+	// The download ends at EOF or when the duration is up
+	n, err := io.Copy(io.Discard, resp.Body)
+	end := time.Now()
+	if err != nil && !errors.Is(transferCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("nettest download failed: %w", err)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	elapsed := end.Sub(firstByte).Seconds()
+	result := &NetTestResult{DurationSeconds: utils.Round(elapsed), Bytes: n}
+	if elapsed > 0 {
+		result.ThroughputMbps = utils.Round(float64(n) * 8 / elapsed / 1e6)
+	}
+	ms := func(from, to time.Time) *float64 {
+		if from.IsZero() || to.IsZero() {
+			return nil
+		}
+		v := utils.Round(float64(to.Sub(from).Microseconds()) / 1000)
+		return &v
+	}
+	result.ConnectMs = ms(connectStart, connectDone)
+	result.TLSMs = ms(tlsStart, tlsDone)
+	result.FirstByteMs = ms(start, firstByte)
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+const iperf3UploadOutput = `{
+	"start": {"connected": [{"remote_host": "10.0.0.5", "remote_port": 5201}]},
+	"end": {
+		"streams": [{"sender": {"bytes": 125000000, "retransmits": 12, "mean_rtt": 18250}}],
+		"sum_sent": {"seconds": 10.0, "bytes": 125000000, "bits_per_second": 100000000, "retransmits": 12},
+		"sum_received": {"seconds": 10.04, "bytes": 124000000, "bits_per_second": 98804780.9}
+	}
+}`
+
+func TestParseIperf3(t *testing.T) {
+	result, err := parseIperf3(iperf3UploadOutput, "upload")
+	if err != nil {
+		t.Fatalf("parseIperf3() error = %v", err)
+	}
+	if result.ThroughputMbps != 98.8 || result.Bytes != 124000000 || result.DurationSeconds != 10.04 {
+		t.Errorf("parseIperf3() = %+v", result)
+	}
+	if result.Retransmits == nil || *result.Retransmits != 12 || result.RTTMs == nil || *result.RTTMs != 18.25 {
+		t.Errorf("parseIperf3() sender stats = %v, %v", result.Retransmits, result.RTTMs)
+	}
+
+	// Downloads have the server as sender, so its statistics are left out
+	result, err = parseIperf3(iperf3UploadOutput, "download")
+	if err != nil || result.Retransmits != nil || result.RTTMs != nil {
+		t.Errorf("parseIperf3(download) = %+v, %v", result, err)
+	}
+
+	_, err = parseIperf3(`{"start": {}, "end": {}, "error": "unable to connect to server: Connection refused"}`, "download")
+	if err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("parseIperf3() error = %v, want the iperf3 error", err)
+	}
+}
+
+func TestNetTest(t *testing.T) {
+	payload := bytes.Repeat([]byte("x"), 1<<20)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(payload)
+	}))
+	defer server.Close()
+	transport := server.Client().Transport.(*http.Transport)
+
+	var iperfArgs []string
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		iperfArgs = args
+		return iperf3UploadOutput, nil
+	}
+	cfg := &config.NetTestConfig{Enabled: true, MaxDuration: 5 * time.Second, Targets: []config.NetTestTargetConfig{
+		{Name: "hq", Type: "iperf3", Address: "10.0.0.5"},
+		{Name: "cdn", Type: "https", Address: server.URL + "/1MB.bin"},
+		{Name: "gone", Type: "https", Address: server.URL + "/missing"},
+	}}
+	test := func(req NetTestRequest) (*NetTestResult, error) {
+		return netTest(context.Background(), run, transport, &req, cfg)
+	}
+
+	result, err := test(NetTestRequest{Target: "cdn"})
+	if err != nil {
+		t.Fatalf("https test error = %v", err)
+	}
+	if result.Bytes != int64(len(payload)) || result.Direction != "download" || result.FirstByteMs == nil || result.TLSMs == nil || result.TS == "" {
+		t.Errorf("https test = %+v", result)
+	}
+
+	result, err = test(NetTestRequest{Target: "hq", Direction: "download", Duration: "3s"})
+	if err != nil {
+		t.Fatalf("iperf3 test error = %v", err)
+	}
+	if got := strings.Join(iperfArgs, " "); got != "-c 10.0.0.5 -p 5201 -t 3 -J -R" {
+		t.Errorf("iperf3 args = %s", got)
+	}
+	if result.Target != "hq" || result.Type != "iperf3" {
+		t.Errorf("iperf3 test = %+v", result)
+	}
+
+	for _, tt := range []struct {
+		req  NetTestRequest
+		want string
+	}{
+		{NetTestRequest{Target: "example.com"}, "not in allowed list"},
+		{NetTestRequest{Target: "cdn", Direction: "upload"}, "iperf3 target"},
+		{NetTestRequest{Target: "hq", Direction: "sideways"}, "invalid direction"},
+		{NetTestRequest{Target: "hq", Duration: "1m"}, "exceeds"},
+		{NetTestRequest{Target: "hq", Duration: "fast"}, "invalid duration"},
+		{NetTestRequest{Target: "gone"}, "HTTP 404"},
+	} {
+		if _, err := test(tt.req); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("netTest(%+v) error = %v, want %q", tt.req, err, tt.want)
+		}
+	}
+
+	netTestRunning.Store(true)
+	defer netTestRunning.Store(false)
+	if _, err := test(NetTestRequest{Target: "hq"}); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("concurrent netTest() error = %v", err)
+	}
+}
+
+func TestIperf3NotFound(t *testing.T) {
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		return "", fmt.Errorf("iperf3 failed: %w", &exec.Error{Name: name, Err: exec.ErrNotFound})
+	}
+	_, err := iperf3Test(context.Background(), run, "10.0.0.5:5201", "upload", time.Second)
+	if err == nil || !strings.Contains(err.Error(), "iperf3 not found") {
+		t.Errorf("iperf3Test() error = %v, want iperf3 not found", err)
+	}
+}
@@ -0,0 +1,151 @@
+package tasks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Scheduled task names, matching the config keys under tasks:
+// These are the names operators use in cmd.task.pause / cmd.task.resume.
+const (
+	TaskHeartbeat     = "heartbeat"
+	TaskSystemMetrics = "system_metrics"
+	TaskServiceCheck  = "service_check"
+	TaskInventory     = "inventory"
+)
+
+// maxPauseTTL bounds how long a task can be paused with a TTL. Longer
+// silences should be done in config so they survive restarts visibly.
+const maxPauseTTL = 7 * 24 * time.Hour
+
+// scheduledTaskNames is the set of task names that can be paused
+var scheduledTaskNames = map[string]bool{
+	TaskHeartbeat:     true,
+	TaskSystemMetrics: true,
+	TaskServiceCheck:  true,
+	TaskInventory:     true,
+}
+
+// PauseState tracks scheduled tasks that operators have paused at runtime.
+// State is in-memory only: a restart resumes everything, which is the safe
+// default for a maintenance silence that was forgotten.
+type PauseState struct {
+	mu      sync.RWMutex
+	paused  map[string]time.Time // task -> expiry (zero = until resumed)
+	plugins map[string]bool      // Plugin task names, pausable like the built-in tasks
+}
+
+// PausedTask describes a currently paused task in the health response
+type PausedTask struct {
+	Task  string `json:"task"`
+	Until string `json:"until,omitempty"` // Empty when paused until explicitly resumed
+}
+
+// PauseTask pauses a scheduled task. A ttl of 0 pauses until resumed;
+// otherwise the pause expires on its own after ttl. Pausing an already
+// paused task replaces its expiry. Returns the expiry (zero if indefinite).
+func (e *Executor) PauseTask(task string, ttl time.Duration) (time.Time, error) {
+	if !e.pausable(task) {
+		return time.Time{}, fmt.Errorf("unknown task: %s (must be heartbeat, system_metrics, service_check, inventory, or a plugin, gateway, modbus, bacnet or gpio task)", task)
+	}
+	if ttl < 0 {
+		return time.Time{}, fmt.Errorf("ttl must not be negative (got: %v)", ttl)
+	}
+	if ttl > maxPauseTTL {
+		return time.Time{}, fmt.Errorf("ttl must not exceed %v (got: %v)", maxPauseTTL, ttl)
+	}
+
+	var until time.Time
+	if ttl > 0 {
+		until = time.Now().Add(ttl)
+	}
+
+	e.pauses.mu.Lock()
+	defer e.pauses.mu.Unlock()
+	e.pauses.paused[task] = until
+
+	return until, nil
+}
+
+// ResumeTask resumes a paused task. Returns false if it was not paused.
+func (e *Executor) ResumeTask(task string) (bool, error) {
+	if !e.pausable(task) {
+		return false, fmt.Errorf("unknown task: %s (must be heartbeat, system_metrics, service_check, inventory, or a plugin, gateway, modbus, bacnet or gpio task)", task)
+	}
+
+	e.pauses.mu.Lock()
+	defer e.pauses.mu.Unlock()
+
+	until, ok := e.pauses.paused[task]
+	delete(e.pauses.paused, task)
+
+	// An expired pause was effectively not paused anymore
+	return ok && (until.IsZero() || time.Now().Before(until)), nil
+}
+
+// RegisterPluginTask makes a scheduled plugin task (PluginTaskPrefix + name,
+// GatewayTaskPrefix + child code, ModbusTaskPrefix or BACnetTaskPrefix +
+// device name, TaskGPIO, TaskCompliance, TaskZFS, TaskRAID, TaskUPS)
+// pausable. Call before the scheduler starts.
+func (e *Executor) RegisterPluginTask(task string) {
+	e.pauses.mu.Lock()
+	defer e.pauses.mu.Unlock()
+	e.pauses.plugins[task] = true
+}
+
+// pausable reports whether task names a built-in or registered plugin task
+func (e *Executor) pausable(task string) bool {
+	if scheduledTaskNames[task] {
+		return true
+	}
+	e.pauses.mu.RLock()
+	defer e.pauses.mu.RUnlock()
+	return e.pauses.plugins[task]
+}
+
+// IsTaskPaused reports whether a scheduled task is currently paused.
+// Expired pauses are cleared lazily here.
+func (e *Executor) IsTaskPaused(task string) bool {
+	e.pauses.mu.RLock()
+	until, ok := e.pauses.paused[task]
+	e.pauses.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	if until.IsZero() || time.Now().Before(until) {
+		return true
+	}
+
+	e.pauses.mu.Lock()
+	// Re-check under the write lock: the task may have been re-paused
+	if current, ok := e.pauses.paused[task]; ok && current.Equal(until) {
+		delete(e.pauses.paused, task)
+	}
+	e.pauses.mu.Unlock()
+	return false
+}
+
+// GetPausedTasks returns all currently paused tasks sorted by name
+func (e *Executor) GetPausedTasks() []PausedTask {
+	e.pauses.mu.RLock()
+	defer e.pauses.mu.RUnlock()
+
+	now := time.Now()
+	var paused []PausedTask
+	for task, until := range e.pauses.paused {
+		if !until.IsZero() && !now.Before(until) {
+			continue // Expired, not yet cleared
+		}
+		pt := PausedTask{Task: task}
+		if !until.IsZero() {
+			pt.Until = until.UTC().Format(time.RFC3339)
+		}
+		paused = append(paused, pt)
+	}
+
+	sort.Slice(paused, func(i, j int) bool { return paused[i].Task < paused[j].Task })
+	return paused
+}
@@ -0,0 +1,144 @@
+package tasks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestPauseResumeTask tests pausing and resuming a scheduled task
+func TestPauseResumeTask(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	if executor.IsTaskPaused(TaskSystemMetrics) {
+		t.Fatal("task should not be paused initially")
+	}
+
+	until, err := executor.PauseTask(TaskSystemMetrics, 0)
+	if err != nil {
+		t.Fatalf("PauseTask() error = %v", err)
+	}
+	if !until.IsZero() {
+		t.Errorf("PauseTask() until = %v, want zero for indefinite pause", until)
+	}
+	if !executor.IsTaskPaused(TaskSystemMetrics) {
+		t.Error("task should be paused")
+	}
+	if executor.IsTaskPaused(TaskHeartbeat) {
+		t.Error("other tasks should not be paused")
+	}
+
+	wasPaused, err := executor.ResumeTask(TaskSystemMetrics)
+	if err != nil {
+		t.Fatalf("ResumeTask() error = %v", err)
+	}
+	if !wasPaused {
+		t.Error("ResumeTask() wasPaused = false, want true")
+	}
+	if executor.IsTaskPaused(TaskSystemMetrics) {
+		t.Error("task should be resumed")
+	}
+
+	wasPaused, err = executor.ResumeTask(TaskSystemMetrics)
+	if err != nil {
+		t.Fatalf("ResumeTask() error = %v", err)
+	}
+	if wasPaused {
+		t.Error("ResumeTask() on a running task should report wasPaused = false")
+	}
+}
+
+// TestPauseTaskTTL tests that a pause with a TTL expires on its own
+func TestPauseTaskTTL(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	until, err := executor.PauseTask(TaskServiceCheck, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("PauseTask() error = %v", err)
+	}
+	if until.IsZero() {
+		t.Fatal("PauseTask() until should be set for a TTL pause")
+	}
+	if !executor.IsTaskPaused(TaskServiceCheck) {
+		t.Error("task should be paused before TTL expires")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if executor.IsTaskPaused(TaskServiceCheck) {
+		t.Error("task should be resumed after TTL expires")
+	}
+	if paused := executor.GetPausedTasks(); len(paused) != 0 {
+		t.Errorf("GetPausedTasks() = %v, want none after expiry", paused)
+	}
+}
+
+// TestPauseTaskValidation tests rejection of unknown tasks and bad TTLs
+func TestPauseTaskValidation(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		task    string
+		ttl     time.Duration
+		errText string
+	}{
+		{name: "unknown task", task: "metrics", errText: "unknown task"},
+		{name: "empty task", task: "", errText: "unknown task"},
+		{name: "negative ttl", task: TaskInventory, ttl: -time.Minute, errText: "must not be negative"},
+		{name: "ttl too long", task: TaskInventory, ttl: 8 * 24 * time.Hour, errText: "must not exceed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.PauseTask(tt.task, tt.ttl)
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("PauseTask() error = %v, want error containing %q", err, tt.errText)
+			}
+		})
+	}
+
+	if _, err := executor.ResumeTask("bogus"); err == nil {
+		t.Error("ResumeTask() should reject unknown task")
+	}
+}
+
+// TestPausedTasksInTaskMetrics tests that pause state is reported in health
+func TestPausedTasksInTaskMetrics(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+
+	if _, err := executor.PauseTask(TaskSystemMetrics, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executor.PauseTask(TaskHeartbeat, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	paused := executor.GetTaskMetrics().PausedTasks
+	if len(paused) != 2 {
+		t.Fatalf("PausedTasks = %v, want 2 entries", paused)
+	}
+
+	// Sorted by task name
+	if paused[0].Task != TaskHeartbeat || paused[0].Until != "" {
+		t.Errorf("PausedTasks[0] = %+v, want heartbeat with no expiry", paused[0])
+	}
+	if paused[1].Task != TaskSystemMetrics || paused[1].Until == "" {
+		t.Errorf("PausedTasks[1] = %+v, want system_metrics with expiry", paused[1])
+	}
+}
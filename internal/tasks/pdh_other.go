@@ -0,0 +1,10 @@
+//go:build !windows
+
+package tasks
+
+import "fmt"
+
+// newPDHReader is Windows only
+func newPDHReader(paths []string) (counterReader, error) {
+	return nil, fmt.Errorf("performance counters are only supported on Windows")
+}
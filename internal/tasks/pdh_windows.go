@@ -0,0 +1,157 @@
+//go:build windows
+
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	pdh                         = syscall.NewLazyDLL("pdh.dll")
+	pdhOpenQuery                = pdh.NewProc("PdhOpenQueryW")
+	pdhAddEnglishCounter        = pdh.NewProc("PdhAddEnglishCounterW")
+	pdhCollectQueryData         = pdh.NewProc("PdhCollectQueryData")
+	pdhGetFormattedCounterArray = pdh.NewProc("PdhGetFormattedCounterArrayW")
+	pdhCloseQuery               = pdh.NewProc("PdhCloseQuery")
+)
+
+// PDH status codes and formats
+const (
+	pdhFmtDouble          = 0x00000200
+	pdhFmtNoCap100        = 0x00008000
+	pdhMoreData           = 0x800007D2
+	pdhNoData             = 0x800007D5
+	pdhCStatusValidData   = 0x00000000
+	pdhCStatusNewData     = 0x00000001
+	pdhCStatusInvalidData = 0xC0000BBA
+	pdhInvalidData        = 0xC0000BC6
+)
+
+// pdhCounterValueItem is PDH_FMT_COUNTERVALUE_ITEM_W with a double value
+// (64-bit layout)
+type pdhCounterValueItem struct {
+	name    *uint16
+	cStatus uint32
+	value   float64
+}
+
+// pdhReader reads counters through one PDH query, kept open so rate
+// counters have a previous sample to compute from
+type pdhReader struct {
+	query    uintptr
+	counters map[string]uintptr // Path -> counter handle
+	errs     []string           // Paths that could not be added
+}
+
+// newPDHReader opens a query with the English counter paths, so counters
+// are named the same on every display language. Paths that do not exist
+// are reported by each read; the rest are still read.
+func newPDHReader(paths []string) (counterReader, error) {
+	r := &pdhReader{counters: make(map[string]uintptr)}
+	if ret, _, _ := pdhOpenQuery.Call(0, 0, uintptr(unsafe.Pointer(&r.query))); ret != 0 {
+		return nil, fmt.Errorf("PdhOpenQuery failed: %w", syscall.Errno(ret))
+	}
+	for _, path := range paths {
+		p, err := windows.UTF16PtrFromString(path)
+		if err != nil {
+			r.errs = append(r.errs, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		var counter uintptr
+		if ret, _, _ := pdhAddEnglishCounter.Call(r.query, uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&counter))); ret != 0 {
+			r.errs = append(r.errs, fmt.Sprintf("%s: %s", path, pdhError(ret)))
+			continue
+		}
+		r.counters[path] = counter
+	}
+	if len(r.counters) == 0 {
+		r.close()
+		return nil, errors.New(strings.Join(r.errs, "; "))
+	}
+	return r, nil
+}
+
+func (r *pdhReader) read() (map[string][]CounterSample, error) {
+	if ret, _, _ := pdhCollectQueryData.Call(r.query); ret != 0 && ret != pdhNoData {
+		return nil, fmt.Errorf("PdhCollectQueryData failed: %s", pdhError(ret))
+	}
+
+	errs := r.errs
+	samples := make(map[string][]CounterSample, len(r.counters))
+	for path, counter := range r.counters {
+		values, err := pdhCounterArray(counter)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if values != nil {
+			samples[path] = values
+		}
+	}
+	if len(errs) > 0 {
+		return samples, errors.New(strings.Join(errs, "; "))
+	}
+	return samples, nil
+}
+
+// pdhCounterArray returns every instance of a counter. It is nil when a
+// rate counter has no value yet or a wildcard matches no instances.
+func pdhCounterArray(counter uintptr) ([]CounterSample, error) {
+	var size, count uint32
+	ret, _, _ := pdhGetFormattedCounterArray.Call(counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), 0)
+	switch ret {
+	case pdhMoreData:
+	case 0, pdhNoData, pdhInvalidData, pdhCStatusInvalidData:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: %s", pdhError(ret))
+	}
+
+	buf := make([]byte, size)
+	ret, _, _ = pdhGetFormattedCounterArray.Call(counter, pdhFmtDouble|pdhFmtNoCap100,
+		uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&count)), uintptr(unsafe.Pointer(&buf[0])))
+	switch ret {
+	case 0:
+	case pdhNoData, pdhInvalidData, pdhCStatusInvalidData:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("PdhGetFormattedCounterArray failed: %s", pdhError(ret))
+	}
+
+	items := unsafe.Slice((*pdhCounterValueItem)(unsafe.Pointer(&buf[0])), count)
+	var samples []CounterSample
+	for _, item := range items {
+		if item.cStatus != pdhCStatusValidData && item.cStatus != pdhCStatusNewData {
+			continue
+		}
+		samples = append(samples, CounterSample{
+			Instance: windows.UTF16PtrToString(item.name),
+			Value:    item.value,
+		})
+	}
+	return samples, nil
+}
+
+func (r *pdhReader) close() {
+	pdhCloseQuery.Call(r.query)
+}
+
+// pdhError formats a PDH status code
+func pdhError(status uintptr) string {
+	switch status {
+	case 0xC0000BB8:
+		return "counter object not found"
+	case 0xC0000BB9:
+		return "counter not found"
+	case 0xC0000BC0:
+		return "invalid counter path"
+	}
+	return fmt.Sprintf("PDH error 0x%08X", status)
+}
@@ -0,0 +1,129 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// PluginTaskPrefix prefixes plugin names to form their scheduled task name
+// (e.g. "plugin.modbus"), as used by cmd.task.pause and in events
+const PluginTaskPrefix = "plugin."
+
+// GatewayTaskPrefix prefixes gateway child codes to form the task name of
+// their poll (e.g. "gateway.plc-01")
+const GatewayTaskPrefix = "gateway."
+
+// ModbusTaskPrefix prefixes Modbus device names to form the task name of
+// their poll (e.g. "modbus.meter-1")
+const ModbusTaskPrefix = "modbus."
+
+// BACnetTaskPrefix prefixes BACnet device names to form the task name of
+// their poll (e.g. "bacnet.ahu-1"). Discovery runs as BACnetTaskPrefix +
+// "devices".
+const BACnetTaskPrefix = "bacnet."
+
+// maxPluginStderr bounds the stderr quoted in a plugin error
+const maxPluginStderr = 1024
+
+// PluginRequest is written as JSON to a plugin's stdin
+type PluginRequest struct {
+	Mode     string          `json:"mode"` // "task" (scheduled run) or "command" (cmd.plugin.<name>)
+	Code     string          `json:"code"`
+	Location string          `json:"location"`
+	Params   json.RawMessage `json:"params,omitempty"` // Command request body; absent for tasks
+
+	// Gateway children only: Code/Location are the child's, Gateway is the
+	// agent's code, and Command is the subject suffix after cmd.
+	Gateway string `json:"gateway,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// PluginMessage is published on {prefix}.{code}.telemetry.plugin.<name> after
+// each scheduled plugin run. Code/Location/MessageMeta are stamped by the
+// scheduler.
+type PluginMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Plugin  string          `json:"plugin"`
+	Gateway string          `json:"gateway,omitempty"` // Set when published for a gateway child
+	Data    json.RawMessage `json:"data"`              // The plugin's stdout, verbatim
+	TS      string          `json:"ts"`
+}
+
+// CreatePluginMessage wraps a plugin's output for publishing
+func CreatePluginMessage(plugin string, data json.RawMessage) *PluginMessage {
+	return &PluginMessage{
+		Plugin: plugin,
+		Data:   data,
+		TS:     utils.NowRFC3339(),
+	}
+}
+
+// RunPlugin executes a plugin with req on stdin and returns its stdout,
+// which must be a single JSON value. The executable is run directly, not
+// through a shell. A non-zero exit, a timeout or invalid JSON is an error;
+// stderr is quoted in the error and otherwise discarded.
+func (e *Executor) RunPlugin(ctx context.Context, path string, args []string, req *PluginRequest, timeout time.Duration) (json.RawMessage, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal plugin request: %w", err)
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+
+	// Capture stdout and stderr (capped to avoid unbounded memory use)
+	var stdout, stderr limitedBuffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("plugin timeout (%v)", timeout)
+	}
+	if runCtx.Err() != nil {
+		return nil, fmt.Errorf("plugin cancelled")
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run plugin: %w", err)
+		}
+		return nil, fmt.Errorf("plugin exited with code %d: %s", exitErr.ExitCode(), pluginStderr(&stderr))
+	}
+
+	if stdout.truncated {
+		return nil, fmt.Errorf("plugin output exceeded %d bytes", maxCommandOutputBytes)
+	}
+	output := bytes.TrimSpace(stdout.buf.Bytes())
+	if !json.Valid(output) {
+		return nil, fmt.Errorf("plugin output is not valid JSON")
+	}
+
+	return json.RawMessage(output), nil
+}
+
+// pluginStderr returns the start of a plugin's stderr for error messages
+func pluginStderr(stderr *limitedBuffer) string {
+	s := strings.TrimSpace(stderr.String())
+	if s == "" {
+		return "no stderr output"
+	}
+	if len(s) > maxPluginStderr {
+		s = s[:maxPluginStderr] + "..."
+	}
+	return s
+}
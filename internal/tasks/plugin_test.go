@@ -0,0 +1,91 @@
+//go:build !windows
+
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// writePlugin writes an executable shell script plugin to a temp directory
+func writePlugin(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "plugin")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestRunPlugin tests the plugin JSON contract: the request on stdin, JSON
+// on stdout, and failures for bad output, non-zero exit and timeout
+func TestRunPlugin(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &PluginRequest{Mode: "command", Code: "test-device", Params: json.RawMessage(`{"n":1}`)}
+
+	tests := []struct {
+		name    string
+		body    string
+		timeout time.Duration
+		want    string
+		wantErr string
+	}{
+		{name: "echoes request", body: "cat", want: `{"mode":"command","code":"test-device","location":"","params":{"n":1}}`},
+		{name: "trims whitespace", body: `printf '\n  [1, 2]  \n'`, want: `[1, 2]`},
+		{name: "invalid JSON", body: "echo not json", wantErr: "not valid JSON"},
+		{name: "empty output", body: "true", wantErr: "not valid JSON"},
+		{name: "non-zero exit", body: "echo boom >&2; exit 3", wantErr: "exited with code 3: boom"},
+		{name: "timeout", body: "sleep 5", timeout: 200 * time.Millisecond, wantErr: "plugin timeout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeout := tt.timeout
+			if timeout == 0 {
+				timeout = 5 * time.Second
+			}
+			output, err := executor.RunPlugin(context.Background(), writePlugin(t, tt.body), nil, req, timeout)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("RunPlugin() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunPlugin() error = %v", err)
+			}
+			if string(output) != tt.want {
+				t.Errorf("RunPlugin() = %s, want %s", output, tt.want)
+			}
+		})
+	}
+}
+
+// TestPausePluginTask tests that registered plugin tasks can be paused
+func TestPausePluginTask(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := executor.PauseTask("plugin.modbus", 0); err == nil {
+		t.Error("PauseTask() on an unregistered plugin should fail")
+	}
+	executor.RegisterPluginTask("plugin.modbus")
+	if _, err := executor.PauseTask("plugin.modbus", 0); err != nil {
+		t.Fatalf("PauseTask() error = %v", err)
+	}
+	if !executor.IsTaskPaused("plugin.modbus") {
+		t.Error("plugin.modbus should be paused")
+	}
+}
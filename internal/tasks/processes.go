@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TopProcesses lists the heaviest processes in one metrics interval
+// (tasks.system_metrics.top_processes)
+type TopProcesses struct {
+	ByCPU    []ProcessMetrics `json:"by_cpu,omitempty"` // Empty on the first interval (needs a baseline)
+	ByMemory []ProcessMetrics `json:"by_memory"`
+}
+
+// ProcessMetrics describes one process
+type ProcessMetrics struct {
+	PID        int32   `json:"pid"`
+	Name       string  `json:"name"`
+	CPUPercent float64 `json:"cpu_percent"` // Share of total host CPU since the previous interval
+	MemoryMB   float64 `json:"memory_mb"`   // Resident set size
+}
+
+// processKey identifies a process across intervals; the create time guards
+// against PID reuse
+type processKey struct {
+	pid        int32
+	createTime int64
+}
+
+// processSample is one process's counters at a point in time
+type processSample struct {
+	key      processKey
+	name     string
+	cpuTime  float64 // User + system seconds
+	rssBytes uint64
+}
+
+// processSampler ranks processes by CPU time consumed between calls
+type processSampler struct {
+	mu       sync.Mutex
+	lastTime time.Time
+	lastCPU  map[processKey]float64
+}
+
+func newProcessSampler() *processSampler {
+	return &processSampler{}
+}
+
+// top samples all processes and returns the n heaviest by CPU and memory
+func (s *processSampler) top(ctx context.Context, n int) (*TopProcesses, error) {
+	procs, err := process.ProcessesWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	samples := make([]processSample, 0, len(procs))
+	for _, p := range procs {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Processes exit or deny access while we iterate; skip them
+		createTime, err := p.CreateTimeWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		mem, err := p.MemoryInfoWithContext(ctx)
+		if err != nil {
+			continue
+		}
+		sample := processSample{
+			key:      processKey{pid: p.Pid, createTime: createTime},
+			rssBytes: mem.RSS,
+		}
+		if times, err := p.TimesWithContext(ctx); err == nil {
+			sample.cpuTime = times.User + times.System
+		}
+		sample.name, _ = p.NameWithContext(ctx)
+		samples = append(samples, sample)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	top := rankProcesses(samples, s.lastCPU, now.Sub(s.lastTime).Seconds(), runtime.NumCPU(), n)
+
+	s.lastTime = now
+	s.lastCPU = make(map[processKey]float64, len(samples))
+	for _, sample := range samples {
+		s.lastCPU[sample.key] = sample.cpuTime
+	}
+
+	return top, nil
+}
+
+// rankProcesses returns the n largest samples by memory and, when a previous
+// interval exists, by CPU. CPU percent is relative to all cores, matching
+// cpu_usage_percent; processes new since the previous interval have none.
+func rankProcesses(samples []processSample, prevCPU map[processKey]float64, elapsed float64, numCPU, n int) *TopProcesses {
+	hasCPU := prevCPU != nil && elapsed > 0 && numCPU > 0
+
+	all := make([]ProcessMetrics, 0, len(samples))
+	withCPU := make([]ProcessMetrics, 0, len(samples))
+	for _, sample := range samples {
+		pm := ProcessMetrics{
+			PID:      sample.key.pid,
+			Name:     sample.name,
+			MemoryMB: utils.Round(float64(sample.rssBytes) / 1024 / 1024),
+		}
+		if prev, ok := prevCPU[sample.key]; hasCPU && ok && sample.cpuTime >= prev {
+			pm.CPUPercent = utils.Round((sample.cpuTime - prev) / (elapsed * float64(numCPU)) * 100)
+			withCPU = append(withCPU, pm)
+		}
+		all = append(all, pm)
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].MemoryMB > all[j].MemoryMB })
+	sort.SliceStable(withCPU, func(i, j int) bool { return withCPU[i].CPUPercent > withCPU[j].CPUPercent })
+
+	top := &TopProcesses{ByMemory: all[:min(n, len(all))]}
+	if hasCPU {
+		top.ByCPU = withCPU[:min(n, len(withCPU))]
+	}
+	return top
+}
@@ -0,0 +1,79 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+)
+
+// TestRankProcesses tests ordering, CPU percent and the first-interval case
+func TestRankProcesses(t *testing.T) {
+	samples := []processSample{
+		{key: processKey{pid: 1, createTime: 100}, name: "init", cpuTime: 10, rssBytes: 10 << 20},
+		{key: processKey{pid: 2, createTime: 200}, name: "db", cpuTime: 60, rssBytes: 500 << 20},
+		{key: processKey{pid: 3, createTime: 300}, name: "web", cpuTime: 130, rssBytes: 200 << 20},
+		{key: processKey{pid: 4, createTime: 999}, name: "new", cpuTime: 50, rssBytes: 1 << 20}, // PID reused
+	}
+
+	// First interval: memory only
+	first := rankProcesses(samples, nil, 0, 4, 2)
+	if first.ByCPU != nil {
+		t.Errorf("ByCPU = %+v on first interval, want nil", first.ByCPU)
+	}
+	if len(first.ByMemory) != 2 || first.ByMemory[0].Name != "db" || first.ByMemory[1].Name != "web" {
+		t.Errorf("ByMemory = %+v, want db, web", first.ByMemory)
+	}
+	if first.ByMemory[0].MemoryMB != 500 {
+		t.Errorf("db MemoryMB = %v, want 500", first.ByMemory[0].MemoryMB)
+	}
+
+	prev := map[processKey]float64{
+		{pid: 1, createTime: 100}: 10,
+		{pid: 2, createTime: 200}: 56,
+		{pid: 3, createTime: 300}: 122,
+		{pid: 4, createTime: 400}: 0, // Exited; PID 4 now belongs to another process
+	}
+	// 10s on 4 cores = 40 CPU-seconds available
+	top := rankProcesses(samples, prev, 10, 4, 3)
+
+	if len(top.ByCPU) != 3 {
+		t.Fatalf("ByCPU = %+v, want 3 entries", top.ByCPU)
+	}
+	want := []struct {
+		name    string
+		percent float64
+	}{{"web", 20}, {"db", 10}, {"init", 0}}
+	for i, w := range want {
+		if top.ByCPU[i].Name != w.name || top.ByCPU[i].CPUPercent != w.percent {
+			t.Errorf("ByCPU[%d] = %s %.2f%%, want %s %.2f%%", i, top.ByCPU[i].Name, top.ByCPU[i].CPUPercent, w.name, w.percent)
+		}
+	}
+	for _, pm := range top.ByCPU {
+		if pm.Name == "new" {
+			t.Error("process with a reused PID was ranked by CPU")
+		}
+	}
+}
+
+// TestProcessSampler tests sampling the live process table
+func TestProcessSampler(t *testing.T) {
+	sampler := newProcessSampler()
+
+	first, err := sampler.top(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("top() error = %v", err)
+	}
+	if len(first.ByMemory) == 0 || len(first.ByMemory) > 5 {
+		t.Errorf("ByMemory has %d entries, want 1-5", len(first.ByMemory))
+	}
+	if first.ByCPU != nil {
+		t.Error("ByCPU set without a baseline")
+	}
+
+	second, err := sampler.top(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("second top() error = %v", err)
+	}
+	if second.ByCPU == nil {
+		t.Error("ByCPU not set after a baseline")
+	}
+}
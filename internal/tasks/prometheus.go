@@ -0,0 +1,362 @@
+package tasks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// exporterSample holds the values read from one Prometheus exporter scrape,
+// before any rate calculation
+type exporterSample struct {
+	HasCPU   bool
+	CPUTotal float64 // Summed over all cores and modes
+	CPUIdle  float64 // Idle + iowait modes
+
+	HasMemory       bool
+	MemoryFreeBytes float64
+
+	Volumes map[string]*volumeSample
+
+	Families    map[string]bool // Needed families present in the scrape
+	BytesRead   int64           // Size of the full scrape
+	BytesParsed int             // Size after filtering to needed families
+}
+
+// volumeSample holds the space and I/O counters for one volume
+type volumeSample struct {
+	FreeBytes float64
+	SizeBytes float64
+	HasIO     bool
+	IO        DiskCounters
+
+	HasFiles  bool // Inode counts, on exporters that report them
+	Files     float64
+	FilesFree float64
+}
+
+// maxExpositionLine bounds a single line of exporter output
+const maxExpositionLine = 1024 * 1024
+
+// neededFamilies returns the metric families parsePrometheus reads
+func neededFamilies(names MetricNames) map[string]bool {
+	needed := map[string]bool{
+		names.CPUTime:        true,
+		names.MemoryFree:     true,
+		names.DiskFreeBytes:  true,
+		names.DiskSizeBytes:  true,
+		names.DiskReadBytes:  true,
+		names.DiskWriteBytes: true,
+	}
+	if runtime.GOOS == "linux" {
+		needed["node_memory_MemAvailable_bytes"] = true
+		needed["node_memory_MemFree_bytes"] = true
+	}
+	if names.DiskFiles != "" {
+		needed[names.DiskFiles] = true
+		needed[names.DiskFilesFree] = true
+	}
+	return needed
+}
+
+// filterFamilies streams Prometheus text exposition line by line and keeps
+// only the HELP/TYPE/sample lines of the needed families. Exporters with
+// many collectors enabled return multi-MB scrapes of which we use a handful
+// of families; discarding the rest while reading keeps the agent's memory
+// flat instead of materializing every family.
+func filterFamilies(reader io.Reader, needed map[string]bool) (*bytes.Buffer, int64, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxExpositionLine)
+
+	var kept bytes.Buffer
+	var read int64
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		read += int64(len(line)) + 1
+
+		if needed[familyName(line, needed)] {
+			kept.Write(line)
+			kept.WriteByte('\n')
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, read, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	return &kept, read, nil
+}
+
+// familyName returns the metric family a text exposition line belongs to,
+// or "" for blank lines and other comments. Histogram and summary samples
+// (_bucket, _sum, _count) map to their family name, unless the sample name
+// is itself a needed family, such as a counter named foo_count.
+func familyName(line []byte, needed map[string]bool) string {
+	line = bytes.TrimLeft(line, " \t")
+	if len(line) == 0 {
+		return ""
+	}
+
+	if line[0] == '#' {
+		fields := bytes.Fields(line[1:])
+		if len(fields) < 2 || (string(fields[0]) != "HELP" && string(fields[0]) != "TYPE") {
+			return ""
+		}
+		return string(fields[1])
+	}
+
+	end := bytes.IndexAny(line, "{ \t")
+	if end < 0 {
+		end = len(line)
+	}
+	name := string(line[:end])
+	if needed[name] {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if trimmed, ok := strings.CutSuffix(name, suffix); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// parsePrometheus reads a text exposition and extracts the values named by
+// names. Only the needed families are decoded (see filterFamilies).
+func parsePrometheus(reader io.Reader, names MetricNames) (*exporterSample, error) {
+	filtered, read, err := filterFamilies(reader, neededFamilies(names))
+	if err != nil {
+		return nil, err
+	}
+	parsed := filtered.Len()
+
+	// Use NewDecoder with FmtText format for proper initialization
+	decoder := expfmt.NewDecoder(filtered, expfmt.NewFormat(expfmt.TypeTextPlain))
+
+	families := make(map[string]*dto.MetricFamily)
+	for {
+		mf := &dto.MetricFamily{}
+		err := decoder.Decode(mf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metric family: %w", err)
+		}
+		families[mf.GetName()] = mf
+	}
+
+	sample := &exporterSample{
+		Volumes:     make(map[string]*volumeSample),
+		Families:    make(map[string]bool, len(families)),
+		BytesRead:   read,
+		BytesParsed: parsed,
+	}
+	for name := range families {
+		sample.Families[name] = true
+	}
+
+	// CPU: sum across ALL cores and ALL modes; idle and iowait count as not busy
+	if family, ok := families[names.CPUTime]; ok {
+		for _, m := range family.Metric {
+			if m.Counter == nil {
+				continue
+			}
+			value := m.Counter.GetValue()
+			sample.CPUTotal += value
+			if mode := getLabelValue(m.Label, "mode"); mode == names.CPUIdleLabel || mode == "iowait" {
+				sample.CPUIdle += value
+			}
+			sample.HasCPU = true
+		}
+	}
+
+	// Memory: Linux prefers MemAvailable and falls back to MemFree
+	memoryFamilies := []string{names.MemoryFree}
+	if runtime.GOOS == "linux" {
+		memoryFamilies = []string{"node_memory_MemAvailable_bytes", "node_memory_MemFree_bytes"}
+	}
+	for _, name := range memoryFamilies {
+		if family, ok := families[name]; ok && len(family.Metric) > 0 && family.Metric[0].Gauge != nil {
+			sample.MemoryFreeBytes = family.Metric[0].Gauge.GetValue()
+			sample.HasMemory = true
+			break
+		}
+	}
+
+	// Disks: space and I/O counters for ALL volumes (automatic discovery)
+	volume := func(m *dto.Metric) *volumeSample {
+		name := getLabelValue(m.Label, names.VolumeLabel)
+		if name == "" {
+			return nil
+		}
+		if sample.Volumes[name] == nil {
+			sample.Volumes[name] = &volumeSample{}
+		}
+		return sample.Volumes[name]
+	}
+	for _, field := range []struct {
+		family string
+		gauge  bool
+		set    func(v *volumeSample, value float64)
+	}{
+		{names.DiskFreeBytes, true, func(v *volumeSample, value float64) { v.FreeBytes = value }},
+		{names.DiskSizeBytes, true, func(v *volumeSample, value float64) { v.SizeBytes = value }},
+		{names.DiskReadBytes, false, func(v *volumeSample, value float64) { v.IO.ReadBytes = value; v.HasIO = true }},
+		{names.DiskWriteBytes, false, func(v *volumeSample, value float64) { v.IO.WriteBytes = value; v.HasIO = true }},
+		{names.DiskFiles, true, func(v *volumeSample, value float64) { v.Files = value; v.HasFiles = true }},
+		{names.DiskFilesFree, true, func(v *volumeSample, value float64) { v.FilesFree = value }},
+	} {
+		family, ok := families[field.family]
+		if !ok {
+			continue
+		}
+		for _, m := range family.Metric {
+			var metric interface{ GetValue() float64 }
+			if field.gauge {
+				if m.Gauge == nil {
+					continue
+				}
+				metric = m.Gauge
+			} else {
+				if m.Counter == nil {
+					continue
+				}
+				metric = m.Counter
+			}
+			if v := volume(m); v != nil {
+				field.set(v, metric.GetValue())
+			}
+		}
+	}
+
+	return sample, nil
+}
+
+// counters returns the cumulative counters used for rate calculation
+func (s *exporterSample) counters(now time.Time) CounterSnapshot {
+	snapshot := CounterSnapshot{
+		Time:     now,
+		HasCPU:   s.HasCPU,
+		CPUTotal: s.CPUTotal,
+		CPUIdle:  s.CPUIdle,
+		Disks:    make(map[string]DiskCounters),
+	}
+	for name, v := range s.Volumes {
+		if v.HasIO {
+			snapshot.Disks[name] = v.IO
+		}
+	}
+	return snapshot
+}
+
+// systemMetrics combines the sample's gauges with the calculated rates.
+// Volumes without a size or any I/O are omitted; disks are sorted by drive.
+func (s *exporterSample) systemMetrics(rates Rates) *SystemMetrics {
+	metrics := &SystemMetrics{
+		CPUUsagePercent: rates.CPUPercent,
+		Disks:           []DiskMetrics{},
+	}
+	if s.HasMemory {
+		metrics.MemoryFreeGB = utils.Round(s.MemoryFreeBytes / 1024 / 1024 / 1024)
+	}
+
+	for name, v := range s.Volumes {
+		dm := DiskMetrics{
+			Drive:   name,
+			FreeGB:  utils.Round(v.FreeBytes / 1024 / 1024 / 1024),
+			TotalGB: utils.Round(v.SizeBytes / 1024 / 1024 / 1024),
+		}
+		if v.SizeBytes > 0 {
+			dm.FreePercent = utils.Round(v.FreeBytes / v.SizeBytes * 100)
+		}
+		if v.HasFiles {
+			dm.Inodes = newInodeMetrics(uint64(v.Files), uint64(v.FilesFree))
+		}
+		if r, ok := rates.Disks[name]; ok {
+			dm.ReadBytesPerSec = r.ReadBytesPerSec
+			dm.WriteBytesPerSec = r.WriteBytesPerSec
+		}
+
+		// Only include drives with actual data
+		if dm.TotalGB > 0 || dm.ReadBytesPerSec > 0 || dm.WriteBytesPerSec > 0 {
+			metrics.Disks = append(metrics.Disks, dm)
+		}
+	}
+	sort.Slice(metrics.Disks, func(i, j int) bool {
+		return metrics.Disks[i].Drive < metrics.Disks[j].Drive
+	})
+
+	return metrics
+}
+
+// parseFamilies reads a text exposition and returns the samples of the named
+// families. Counters, gauges and untyped values are supported; histograms
+// and summaries are skipped. Families missing from the scrape are omitted.
+func parseFamilies(reader io.Reader, names []string) (map[string][]ExtraSample, error) {
+	needed := make(map[string]bool, len(names))
+	for _, name := range names {
+		needed[name] = true
+	}
+
+	filtered, _, err := filterFamilies(reader, needed)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := expfmt.NewDecoder(filtered, expfmt.NewFormat(expfmt.TypeTextPlain))
+	families := make(map[string][]ExtraSample)
+	for {
+		mf := &dto.MetricFamily{}
+		err := decoder.Decode(mf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode metric family: %w", err)
+		}
+
+		for _, m := range mf.Metric {
+			var value float64
+			switch {
+			case m.Counter != nil:
+				value = m.Counter.GetValue()
+			case m.Gauge != nil:
+				value = m.Gauge.GetValue()
+			case m.Untyped != nil:
+				value = m.Untyped.GetValue()
+			default:
+				continue
+			}
+
+			sample := ExtraSample{Value: value}
+			if len(m.Label) > 0 {
+				sample.Labels = make(map[string]string, len(m.Label))
+				for _, label := range m.Label {
+					sample.Labels[label.GetName()] = label.GetValue()
+				}
+			}
+			families[mf.GetName()] = append(families[mf.GetName()], sample)
+		}
+	}
+
+	return families, nil
+}
+
+// getLabelValue extracts a label value from a metric's label pairs
+func getLabelValue(labels []*dto.LabelPair, name string) string {
+	for _, label := range labels {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
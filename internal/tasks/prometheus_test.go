@@ -0,0 +1,206 @@
+package tasks
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestFilterFamilies tests that only the needed families survive filtering
+func TestFilterFamilies(t *testing.T) {
+	input := `# HELP node_cpu_seconds_total Seconds the CPUs spent in each mode.
+# TYPE node_cpu_seconds_total counter
+node_cpu_seconds_total{cpu="0",mode="idle"} 100
+node_cpu_seconds_total{cpu="0",mode="user"} 50
+# HELP go_gc_duration_seconds A summary of GC pause durations.
+# TYPE go_gc_duration_seconds summary
+go_gc_duration_seconds{quantile="0.5"} 0.001
+go_gc_duration_seconds_sum 0.5
+go_gc_duration_seconds_count 10
+# HELP http_request_duration_seconds Request latency.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{le="+Inf"} 3
+http_request_duration_seconds_sum 1.5
+http_request_duration_seconds_count 3
+# HELP node_scrape_count Scrapes served.
+# TYPE node_scrape_count counter
+node_scrape_count 7
+
+node_unrelated_metric 42
+`
+	needed := map[string]bool{
+		"node_cpu_seconds_total":        true,
+		"http_request_duration_seconds": true,
+		"node_scrape_count":             true,
+	}
+
+	filtered, read, err := filterFamilies(strings.NewReader(input), needed)
+	if err != nil {
+		t.Fatalf("filterFamilies() error = %v", err)
+	}
+	if read != int64(len(input)) {
+		t.Errorf("bytes read = %d, want %d", read, len(input))
+	}
+
+	out := filtered.String()
+	for _, want := range []string{
+		`node_cpu_seconds_total{cpu="0",mode="idle"} 100`,
+		"# TYPE node_cpu_seconds_total counter",
+		`http_request_duration_seconds_bucket{le="+Inf"} 3`,
+		"http_request_duration_seconds_count 3",
+		"# TYPE node_scrape_count counter",
+		"node_scrape_count 7",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("filtered output missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"go_gc_duration_seconds", "node_unrelated_metric"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("filtered output contains %q", unwanted)
+		}
+	}
+}
+
+// TestParsePrometheus_IgnoresUnneededFamilies tests that parsing succeeds
+// and extracts values when the scrape has many unrelated families
+func TestParsePrometheus_IgnoresUnneededFamilies(t *testing.T) {
+	names := GetMetricNames()
+	memoryMetric := names.MemoryFree
+	if runtime.GOOS == "linux" {
+		memoryMetric = "node_memory_MemAvailable_bytes"
+	}
+
+	var sb strings.Builder
+	// Unrelated families, including one that would fail to parse on its own
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&sb, "# TYPE unrelated_metric_%d gauge\nunrelated_metric_%d{label=\"x\"} %d\n", i, i, i)
+	}
+	sb.WriteString("unrelated_broken_line{ this is not valid\n")
+	fmt.Fprintf(&sb, "# TYPE %s gauge\n%s 4294967296\n", memoryMetric, memoryMetric)
+
+	sample, err := parsePrometheus(strings.NewReader(sb.String()), names)
+	if err != nil {
+		t.Fatalf("parsePrometheus() error = %v", err)
+	}
+	if !sample.HasMemory || sample.MemoryFreeBytes != 4294967296 {
+		t.Errorf("memory = %v (found %v), want 4294967296", sample.MemoryFreeBytes, sample.HasMemory)
+	}
+	if sample.BytesParsed >= int(sample.BytesRead) {
+		t.Errorf("bytes parsed = %d, want less than bytes read %d", sample.BytesParsed, sample.BytesRead)
+	}
+}
+
+// testExposition builds an exporter scrape using the platform's metric names
+func testExposition(names MetricNames, cpuIdle, cpuUser, readBytes float64) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# TYPE %s counter\n", names.CPUTime)
+	fmt.Fprintf(&sb, "%s{core=\"0\",cpu=\"0\",mode=\"%s\"} %v\n", names.CPUTime, names.CPUIdleLabel, cpuIdle)
+	fmt.Fprintf(&sb, "%s{core=\"0\",cpu=\"0\",mode=\"user\"} %v\n", names.CPUTime, cpuUser)
+	fmt.Fprintf(&sb, "# TYPE %s gauge\n%s{%s=\"data\"} 25e9\n", names.DiskFreeBytes, names.DiskFreeBytes, names.VolumeLabel)
+	fmt.Fprintf(&sb, "# TYPE %s gauge\n%s{%s=\"data\"} 100e9\n", names.DiskSizeBytes, names.DiskSizeBytes, names.VolumeLabel)
+	fmt.Fprintf(&sb, "# TYPE %s counter\n%s{%s=\"data\"} %v\n", names.DiskReadBytes, names.DiskReadBytes, names.VolumeLabel, readBytes)
+	fmt.Fprintf(&sb, "# TYPE %s counter\n%s{%s=\"data\"} 0\n", names.DiskWriteBytes, names.DiskWriteBytes, names.VolumeLabel)
+	return sb.String()
+}
+
+// TestParsePrometheus_Values tests CPU, disk space and disk I/O extraction
+func TestParsePrometheus_Values(t *testing.T) {
+	names := GetMetricNames()
+
+	sample, err := parsePrometheus(strings.NewReader(testExposition(names, 300, 100, 5000)), names)
+	if err != nil {
+		t.Fatalf("parsePrometheus() error = %v", err)
+	}
+
+	if !sample.HasCPU || sample.CPUTotal != 400 || sample.CPUIdle != 300 {
+		t.Errorf("CPU = total %v idle %v (found %v), want total 400 idle 300", sample.CPUTotal, sample.CPUIdle, sample.HasCPU)
+	}
+
+	v, ok := sample.Volumes["data"]
+	if !ok {
+		t.Fatalf("volume %q not found in %v", "data", sample.Volumes)
+	}
+	if v.FreeBytes != 25e9 || v.SizeBytes != 100e9 {
+		t.Errorf("volume space = free %v size %v, want free 25e9 size 100e9", v.FreeBytes, v.SizeBytes)
+	}
+	if !v.HasIO || v.IO.ReadBytes != 5000 {
+		t.Errorf("volume read bytes = %v (has I/O %v), want 5000", v.IO.ReadBytes, v.HasIO)
+	}
+
+	metrics := sample.systemMetrics(Rates{})
+	if len(metrics.Disks) != 1 {
+		t.Fatalf("disks = %d, want 1", len(metrics.Disks))
+	}
+	// FreePercent comes from bytes, not the rounded GB values
+	if metrics.Disks[0].FreePercent != 25 {
+		t.Errorf("FreePercent = %v, want 25", metrics.Disks[0].FreePercent)
+	}
+}
+
+// TestParsePrometheus_Inodes tests inode usage from node_filesystem_files*,
+// and that volumes without inode counts report none
+func TestParsePrometheus_Inodes(t *testing.T) {
+	names := GetMetricNames()
+	if names.DiskFiles == "" {
+		t.Skipf("%s reports no inode counts", GetExporterName())
+	}
+
+	exposition := testExposition(names, 300, 100, 5000) +
+		fmt.Sprintf("# TYPE %s gauge\n%s{%s=\"data\"} 1000\n", names.DiskFiles, names.DiskFiles, names.VolumeLabel) +
+		fmt.Sprintf("# TYPE %s gauge\n%s{%s=\"data\"} 50\n", names.DiskFilesFree, names.DiskFilesFree, names.VolumeLabel)
+	sample, err := parsePrometheus(strings.NewReader(exposition), names)
+	if err != nil {
+		t.Fatalf("parsePrometheus() error = %v", err)
+	}
+	metrics := sample.systemMetrics(Rates{})
+	if len(metrics.Disks) != 1 || metrics.Disks[0].Inodes == nil {
+		t.Fatalf("disks = %+v, want inodes on data", metrics.Disks)
+	}
+	if inodes := *metrics.Disks[0].Inodes; inodes != (InodeMetrics{Total: 1000, Free: 50, FreePercent: 5}) {
+		t.Errorf("inodes = %+v, want 50 of 1000 free (5%%)", inodes)
+	}
+
+	sample, err = parsePrometheus(strings.NewReader(testExposition(names, 300, 100, 5000)), names)
+	if err != nil {
+		t.Fatalf("parsePrometheus() error = %v", err)
+	}
+	if inodes := sample.systemMetrics(Rates{}).Disks[0].Inodes; inodes != nil {
+		t.Errorf("inodes = %+v without node_filesystem_files, want nil", inodes)
+	}
+}
+
+// TestExporterCollector_Rates tests rates across two scrapes through the
+// shared parser and rate cache
+func TestExporterCollector_Rates(t *testing.T) {
+	names := GetMetricNames()
+	collector := NewExporterCollector("http://localhost/metrics", zap.NewNop(), nil)
+
+	first, err := collector.parsePrometheusMetrics(strings.NewReader(testExposition(names, 300, 100, 5000)))
+	if err != nil {
+		t.Fatalf("first parse error = %v", err)
+	}
+	if first.CPUUsagePercent != 0 {
+		t.Errorf("first scrape CPU = %v, want 0 (baseline)", first.CPUUsagePercent)
+	}
+
+	// Move the baseline back so the second scrape spans a measurable interval
+	prev, _ := collector.cache.Load()
+	prev.Time = prev.Time.Add(-10 * time.Second)
+	collector.cache.Store(prev)
+
+	second, err := collector.parsePrometheusMetrics(strings.NewReader(testExposition(names, 330, 130, 105000)))
+	if err != nil {
+		t.Fatalf("second parse error = %v", err)
+	}
+	if second.CPUUsagePercent != 50 {
+		t.Errorf("CPU = %v, want 50", second.CPUUsagePercent)
+	}
+	if len(second.Disks) != 1 || second.Disks[0].ReadBytesPerSec < 9000 || second.Disks[0].ReadBytesPerSec > 10000 {
+		t.Errorf("disks = %+v, want ~10000 read bytes/sec", second.Disks)
+	}
+}
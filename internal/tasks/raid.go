@@ -0,0 +1,333 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TaskRAID is the task name of the RAID health check
+const TaskRAID = "raid"
+
+// RAIDSourceMD is the source name of Linux software RAID arrays
+const RAIDSourceMD = "mdraid"
+
+// RAID array states, normalized across sources
+const (
+	RAIDStateOK         = "ok"
+	RAIDStateDegraded   = "degraded"   // Running without full redundancy
+	RAIDStateRebuilding = "rebuilding" // Degraded, with a rebuild under way
+	RAIDStateFailed     = "failed"     // Not serving data
+	RAIDStateUnknown    = "unknown"    // The source reported a state not mapped here
+)
+
+// mdstatPath is where Linux reports software RAID state
+const mdstatPath = "/proc/mdstat"
+
+// raidArgs are the vendor CLI arguments listing arrays, by controller type
+var raidArgs = map[string][]string{
+	"megacli": {"-LDInfo", "-Lall", "-aALL", "-NoLog"},
+	"ssacli":  {"ctrl", "all", "show", "config"},
+}
+
+// RAIDArray is the health of one software array or controller logical drive
+type RAIDArray struct {
+	Source string `json:"source"` // mdraid or a raid.controllers name
+	Name   string `json:"name"`   // md0, a0/vd0 (megacli), slot0/ld1 (ssacli)
+	Level  string `json:"level,omitempty"`
+	State  string `json:"state"`  // One of the RAIDState* constants
+	Status string `json:"status"` // State as the source reports it
+
+	Devices       int      `json:"devices,omitempty"`        // Members the array should have
+	ActiveDevices int      `json:"active_devices,omitempty"` // Members working (mdraid, ssacli)
+	Failed        []string `json:"failed,omitempty"`         // Failed or missing members
+
+	SyncAction  string   `json:"sync_action,omitempty"`  // mdraid: recovery, resync, reshape or check
+	SyncPercent *float64 `json:"sync_percent,omitempty"` // Progress of the sync or rebuild
+}
+
+// RAIDMessage is published on {prefix}.{code}.telemetry.raid after each
+// check. A source that can't be read is reported in Errors; the others are
+// still published. Code/Location/MessageMeta are stamped by the scheduler.
+type RAIDMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Arrays []RAIDArray       `json:"arrays"`
+	Errors map[string]string `json:"errors,omitempty"` // By source
+	TS     string            `json:"ts"`
+}
+
+// CheckRAID reads every configured RAID source
+func (e *Executor) CheckRAID(ctx context.Context, cfg *config.RAIDConfig) *RAIDMessage {
+	return checkRAID(ctx, runTool, os.ReadFile, cfg)
+}
+
+func checkRAID(ctx context.Context, run toolRunner, readFile func(string) ([]byte, error), cfg *config.RAIDConfig) *RAIDMessage {
+	msg := &RAIDMessage{Arrays: []RAIDArray{}}
+	fail := func(source string, err error) {
+		if msg.Errors == nil {
+			msg.Errors = make(map[string]string)
+		}
+		msg.Errors[source] = err.Error()
+	}
+
+	if cfg.MDRaid {
+		if data, err := readFile(mdstatPath); err != nil {
+			fail(RAIDSourceMD, err)
+		} else {
+			msg.Arrays = append(msg.Arrays, parseMdstat(string(data))...)
+		}
+	}
+
+	for _, ctrl := range cfg.Controllers {
+		// MegaCLI exits non-zero even when it succeeds, so the output is
+		// parsed first and the error only matters if nothing was found
+		out, err := run(ctx, ctrl.Command, raidArgs[ctrl.Type]...)
+		var arrays []RAIDArray
+		switch ctrl.Type {
+		case "megacli":
+			arrays = parseMegaCLI(out)
+		case "ssacli":
+			arrays = parseSSACLI(out)
+		}
+		if len(arrays) == 0 {
+			if err == nil {
+				err = fmt.Errorf("no logical drives found in %s output", ctrl.Type)
+			}
+			fail(ctrl.Name, err)
+			continue
+		}
+		for i := range arrays {
+			arrays[i].Source = ctrl.Name
+		}
+		msg.Arrays = append(msg.Arrays, arrays...)
+	}
+
+	msg.TS = utils.NowRFC3339()
+	return msg
+}
+
+var (
+	// md1 : active raid1 sdd1[2](F) sdc1[0]
+	mdArrayLine = regexp.MustCompile(`^(md\S*) : (active|inactive)(?: \([a-z-]+\))?(.*)$`)
+	// 976630464 blocks super 1.2 [2/1] [U_]
+	mdDevicesLine = regexp.MustCompile(`\[(\d+)/(\d+)\] \[[U_]+\]`)
+	// [=>...]  recovery =  8.5% (83091712/976630272) finish=84.1min
+	mdSyncLine = regexp.MustCompile(`(recovery|resync|reshape|check|repair)\s*=\s*([\d.]+)%`)
+)
+
+// parseMdstat parses /proc/mdstat:
+//
+//	md1 : active raid1 sdd1[2](F) sdc1[0]
+//	      976630464 blocks super 1.2 [2/1] [U_]
+//	      [=>...................]  recovery =  8.5% (83091712/976630272) finish=84.1min speed=177064K/sec
+func parseMdstat(data string) []RAIDArray {
+	var arrays []RAIDArray
+	var array *RAIDArray
+	for _, line := range strings.Split(data, "\n") {
+		if m := mdArrayLine.FindStringSubmatch(line); m != nil {
+			arrays = append(arrays, RAIDArray{Source: RAIDSourceMD, Name: m[1], Status: m[2]})
+			array = &arrays[len(arrays)-1]
+			for _, field := range strings.Fields(m[3]) {
+				name, flags, isMember := strings.Cut(field, "[")
+				if !isMember {
+					if array.Level == "" {
+						array.Level = field
+					}
+					continue
+				}
+				if strings.HasSuffix(flags, "(F)") {
+					array.Failed = append(array.Failed, name)
+				}
+			}
+			continue
+		}
+		if array == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			finishMdArray(array)
+			array = nil
+			continue
+		}
+		if m := mdDevicesLine.FindStringSubmatch(line); m != nil {
+			array.Devices, _ = strconv.Atoi(m[1])
+			array.ActiveDevices, _ = strconv.Atoi(m[2])
+		}
+		if m := mdSyncLine.FindStringSubmatch(line); m != nil {
+			array.SyncAction = m[1]
+			if percent, err := strconv.ParseFloat(m[2], 64); err == nil {
+				array.SyncPercent = &percent
+			}
+		}
+	}
+	if array != nil {
+		finishMdArray(array)
+	}
+	return arrays
+}
+
+// finishMdArray sets the state once all of an array's lines are read
+func finishMdArray(array *RAIDArray) {
+	switch {
+	case array.Status == "inactive":
+		array.State = RAIDStateFailed
+	case array.ActiveDevices < array.Devices && array.SyncAction == "recovery":
+		array.State = RAIDStateRebuilding
+	case array.ActiveDevices < array.Devices || len(array.Failed) > 0:
+		array.State = RAIDStateDegraded
+	default:
+		array.State = RAIDStateOK
+	}
+}
+
+// parseMegaCLI parses "MegaCli64 -LDInfo -Lall -aALL":
+//
+//	Adapter 0 -- Virtual Drive Information:
+//	Virtual Drive: 0 (Target Id: 0)
+//	RAID Level          : Primary-1, Secondary-0, RAID Level Qualifier-0
+//	State               : Degraded
+//	Number Of Drives    : 2
+func parseMegaCLI(out string) []RAIDArray {
+	var arrays []RAIDArray
+	adapter := "0"
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if rest, ok := strings.CutPrefix(line, "Adapter "); ok {
+			adapter, _, _ = strings.Cut(rest, " ")
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "Virtual Drive:"); ok {
+			vd, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+			arrays = append(arrays, RAIDArray{Name: "a" + adapter + "/vd" + vd, State: RAIDStateUnknown})
+			continue
+		}
+		if len(arrays) == 0 {
+			continue
+		}
+		array := &arrays[len(arrays)-1]
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "RAID Level":
+			array.Level = megaCLILevel(value)
+		case "State":
+			array.Status = value
+			switch value {
+			case "Optimal":
+				array.State = RAIDStateOK
+			case "Degraded", "Partially Degraded":
+				array.State = RAIDStateDegraded
+			case "Offline", "Failed":
+				array.State = RAIDStateFailed
+			}
+		case "Number Of Drives":
+			array.Devices, _ = strconv.Atoi(value)
+		}
+	}
+	return arrays
+}
+
+// megaCLILevel names a "Primary-1, Secondary-3, ..." RAID level. A
+// secondary level of 3 means striped spans: RAID 10, 50 or 60.
+func megaCLILevel(value string) string {
+	var primary, secondary int
+	if _, err := fmt.Sscanf(value, "Primary-%d, Secondary-%d", &primary, &secondary); err != nil {
+		return value
+	}
+	if secondary == 3 {
+		return fmt.Sprintf("raid%d0", primary)
+	}
+	return fmt.Sprintf("raid%d", primary)
+}
+
+var (
+	// Smart Array P420i in Slot 0 (Embedded)
+	ssaControllerLine = regexp.MustCompile(`in Slot (\S+)`)
+	// logicaldrive 1 (558.9 GB, RAID 1, OK)
+	ssaLogicalLine = regexp.MustCompile(`^logicaldrive (\S+) \(.*?, RAID ([^,]+), (.+)\)$`)
+	// physicaldrive 1I:2:1 (port 1I:box 2:bay 1, SAS HDD, 600 GB, OK)
+	ssaPhysicalLine = regexp.MustCompile(`^physicaldrive (\S+) \(.*, ([^,]+)\)$`)
+	// Recovering, 45% complete
+	ssaPercent = regexp.MustCompile(`(\d+(?:\.\d+)?)% complete`)
+)
+
+// parseSSACLI parses "ssacli ctrl all show config". Physical drives are
+// counted against every logical drive of their array; unassigned drives are
+// not counted.
+//
+//	Smart Array P420i in Slot 0 (Embedded)
+//	   Array A (SAS, Unused Space: 0  MB)
+//	      logicaldrive 1 (558.9 GB, RAID 1, Interim Recovery Mode)
+//	      physicaldrive 1I:2:1 (port 1I:box 2:bay 1, SAS HDD, 600 GB, OK)
+//	      physicaldrive 1I:2:2 (port 1I:box 2:bay 2, SAS HDD, 600 GB, Failed)
+func parseSSACLI(out string) []RAIDArray {
+	var arrays []RAIDArray
+	slot := "0"
+	first := 0 // Index of the current array's first logical drive
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Array "), line == "Unassigned", line == "HBA Drives":
+			first = len(arrays)
+		case strings.HasPrefix(line, "logicaldrive "):
+			m := ssaLogicalLine.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			array := RAIDArray{Name: "slot" + slot + "/ld" + m[1], Level: "raid" + strings.ReplaceAll(m[2], " ", ""), Status: m[3]}
+			array.State = ssaState(m[3])
+			if p := ssaPercent.FindStringSubmatch(m[3]); p != nil {
+				if percent, err := strconv.ParseFloat(p[1], 64); err == nil {
+					array.SyncPercent = &percent
+				}
+			}
+			arrays = append(arrays, array)
+		case strings.HasPrefix(line, "physicaldrive "):
+			m := ssaPhysicalLine.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			for i := first; i < len(arrays); i++ {
+				arrays[i].Devices++
+				if m[2] == "OK" {
+					arrays[i].ActiveDevices++
+				} else if m[2] == "Failed" {
+					arrays[i].Failed = append(arrays[i].Failed, m[1])
+				}
+			}
+		default:
+			if m := ssaControllerLine.FindStringSubmatch(line); m != nil {
+				slot = m[1]
+				first = len(arrays)
+			}
+		}
+	}
+	return arrays
+}
+
+// ssaState maps an ssacli logical drive status to a RAIDState* constant
+func ssaState(status string) string {
+	switch {
+	case status == "OK":
+		return RAIDStateOK
+	case strings.HasPrefix(status, "Recovering") || strings.HasPrefix(status, "Rebuilding"):
+		return RAIDStateRebuilding
+	case status == "Interim Recovery Mode" || status == "Ready for Rebuild":
+		return RAIDStateDegraded
+	case status == "Failed":
+		return RAIDStateFailed
+	}
+	return RAIDStateUnknown
+}
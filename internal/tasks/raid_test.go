@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+const mdstatOutput = `Personalities : [raid1] [raid6] [raid5] [raid4]
+md0 : active raid1 sdb1[1] sda1[0]
+      1953382464 blocks super 1.2 [2/2] [UU]
+      bitmap: 0/15 pages [0KB], 65536KB chunk
+
+md1 : active raid1 sdd1[2](F) sdc1[0]
+      976630464 blocks super 1.2 [2/1] [U_]
+
+md2 : active raid5 sdh1[3] sdg1[1] sdf1[0]
+      1953260544 blocks super 1.2 level 5, 512k chunk, algorithm 2 [3/2] [UU_]
+      [=>...................]  recovery =  8.5% (83091712/976630272) finish=84.1min speed=177064K/sec
+
+md3 : active (auto-read-only) raid1 sdj1[1] sdi1[0]
+      1046528 blocks super 1.2 [2/2] [UU]
+      [==========>..........]  check = 52.0% (544768/1046528) finish=0.1min speed=90794K/sec
+
+md4 : inactive sdx1[0](S)
+      976630464 blocks super 1.2
+
+unused devices: <none>
+`
+
+const megaCLIOutput = `
+
+Adapter 0 -- Virtual Drive Information:
+Virtual Drive: 0 (Target Id: 0)
+Name                :
+RAID Level          : Primary-1, Secondary-0, RAID Level Qualifier-0
+Size                : 931.0 GB
+State               : Optimal
+Number Of Drives    : 2
+Virtual Drive: 1 (Target Id: 1)
+Name                :data
+RAID Level          : Primary-1, Secondary-3, RAID Level Qualifier-0
+State               : Degraded
+Number Of Drives per span:2
+Span Depth          : 2
+
+Exit Code: 0x00
+`
+
+const ssacliOutput = `
+Smart Array P420i in Slot 0 (Embedded)    (sn: 001438031A6B5C0)
+
+   Array A (SAS, Unused Space: 0  MB)
+
+      logicaldrive 1 (558.9 GB, RAID 1, Interim Recovery Mode)
+
+      physicaldrive 1I:2:1 (port 1I:box 2:bay 1, SAS HDD, 600 GB, OK)
+      physicaldrive 1I:2:2 (port 1I:box 2:bay 2, SAS HDD, 600 GB, Failed)
+
+   Array B (SAS, Unused Space: 0  MB)
+
+      logicaldrive 2 (1.1 TB, RAID 1+0, Recovering, 45% complete)
+      logicaldrive 3 (100 GB, RAID 1+0, OK)
+
+      physicaldrive 2I:2:5 (port 2I:box 2:bay 5, SAS HDD, 600 GB, OK)
+      physicaldrive 2I:2:6 (port 2I:box 2:bay 6, SAS HDD, 600 GB, Rebuilding)
+
+   Unassigned
+
+      physicaldrive 2I:2:8 (port 2I:box 2:bay 8, SAS HDD, 600 GB, OK)
+`
+
+// summarize renders arrays as "name level state devices/active failed sync"
+func summarize(arrays []RAIDArray) string {
+	lines := make([]string, len(arrays))
+	for i, a := range arrays {
+		sync := ""
+		if a.SyncPercent != nil {
+			sync = fmt.Sprintf(" %s%.1f%%", a.SyncAction, *a.SyncPercent)
+		}
+		lines[i] = fmt.Sprintf("%s %s %s %d/%d %v%s", a.Name, a.Level, a.State, a.Devices, a.ActiveDevices, a.Failed, sync)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestParseMdstat(t *testing.T) {
+	want := `md0 raid1 ok 2/2 []
+md1 raid1 degraded 2/1 [sdd1]
+md2 raid5 rebuilding 3/2 [] recovery8.5%
+md3 raid1 ok 2/2 [] check52.0%
+md4  failed 0/0 []`
+	if got := summarize(parseMdstat(mdstatOutput)); got != want {
+		t.Errorf("parseMdstat() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseMegaCLI(t *testing.T) {
+	want := `a0/vd0 raid1 ok 2/0 []
+a0/vd1 raid10 degraded 0/0 []`
+	if got := summarize(parseMegaCLI(megaCLIOutput)); got != want {
+		t.Errorf("parseMegaCLI() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseSSACLI(t *testing.T) {
+	want := `slot0/ld1 raid1 degraded 2/1 [1I:2:2]
+slot0/ld2 raid1+0 rebuilding 2/1 [] 45.0%
+slot0/ld3 raid1+0 ok 2/1 []`
+	if got := summarize(parseSSACLI(ssacliOutput)); got != want {
+		t.Errorf("parseSSACLI() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCheckRAID(t *testing.T) {
+	cfg := &config.RAIDConfig{
+		MDRaid: true,
+		Controllers: []config.RAIDControllerConfig{
+			{Name: "perc", Type: "megacli", Command: "/opt/MegaRAID/MegaCli/MegaCli64"},
+			{Name: "p420", Type: "ssacli", Command: "/usr/sbin/ssacli"},
+		},
+	}
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		if name == "/opt/MegaRAID/MegaCli/MegaCli64" {
+			// MegaCLI's exit code does not mean failure
+			return megaCLIOutput, fmt.Errorf("exit status 2")
+		}
+		return "Error: ssacli could not find any controllers\n", fmt.Errorf("exit status 1")
+	}
+	readFile := func(string) ([]byte, error) { return nil, os.ErrPermission }
+
+	msg := checkRAID(context.Background(), run, readFile, cfg)
+	if len(msg.Arrays) != 2 || msg.Arrays[0].Source != "perc" {
+		t.Errorf("Arrays = %+v, want the two megacli drives", msg.Arrays)
+	}
+	if len(msg.Errors) != 2 || msg.Errors["mdraid"] == "" || msg.Errors["p420"] == "" {
+		t.Errorf("Errors = %v, want mdraid and p420", msg.Errors)
+	}
+	if msg.TS == "" {
+		t.Error("TS not set")
+	}
+}
@@ -0,0 +1,174 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/secrets"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// CounterSnapshot is one sample of the cumulative counters that CPU and disk
+// I/O rates are derived from. Both collectors fill one per scrape.
+type CounterSnapshot struct {
+	Time     time.Time               `json:"time"`
+	HasCPU   bool                    `json:"has_cpu"`
+	CPUTotal float64                 `json:"cpu_total"` // CPU time summed over all modes and cores
+	CPUIdle  float64                 `json:"cpu_idle"`  // Idle + iowait CPU time
+	Disks    map[string]DiskCounters `json:"disks"`     // Cumulative bytes per drive
+}
+
+// RateCache stores the previous snapshot between scrapes
+type RateCache interface {
+	Load() (CounterSnapshot, bool)
+	Store(snapshot CounterSnapshot)
+	Reset()
+}
+
+// memoryRateCache is the in-process RateCache used by the collectors
+type memoryRateCache struct {
+	mu       sync.Mutex
+	snapshot CounterSnapshot
+	ok       bool
+}
+
+func newMemoryRateCache() *memoryRateCache {
+	return &memoryRateCache{}
+}
+
+func (c *memoryRateCache) Load() (CounterSnapshot, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot, c.ok
+}
+
+func (c *memoryRateCache) Store(snapshot CounterSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot = snapshot
+	c.ok = true
+}
+
+func (c *memoryRateCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshot = CounterSnapshot{}
+	c.ok = false
+}
+
+// Rates are derived from two consecutive snapshots
+type Rates struct {
+	HasCPU     bool
+	CPUPercent float64
+	Disks      map[string]DiskRates // Only drives present in both snapshots
+}
+
+// DiskRates holds per-drive I/O throughput
+type DiskRates struct {
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+}
+
+// cacheAge returns how old the cached snapshot is at now. ok is false when
+// the cache is empty.
+func cacheAge(cache RateCache, now time.Time) (time.Duration, bool) {
+	prev, ok := cache.Load()
+	if !ok {
+		return 0, false
+	}
+	return now.Sub(prev.Time), true
+}
+
+// calculateRates derives rates from the cached snapshot and current, then
+// caches current. The first call (or the first after Reset) only stores a
+// baseline and returns empty rates. Counters that went backwards (exporter
+// restart, device replaced) are skipped rather than reported as negative.
+func calculateRates(cache RateCache, current CounterSnapshot) Rates {
+	rates := Rates{Disks: make(map[string]DiskRates)}
+
+	prev, ok := cache.Load()
+	cache.Store(current)
+	if !ok {
+		return rates
+	}
+
+	if prev.HasCPU && current.HasCPU {
+		totalDelta := current.CPUTotal - prev.CPUTotal
+		idleDelta := current.CPUIdle - prev.CPUIdle
+		if totalDelta > 0 && idleDelta >= 0 && idleDelta <= totalDelta {
+			rates.CPUPercent = utils.Round((totalDelta - idleDelta) / totalDelta * 100)
+			rates.HasCPU = true
+		}
+	}
+
+	seconds := current.Time.Sub(prev.Time).Seconds()
+	if seconds <= 0 {
+		return rates
+	}
+	for drive, cur := range current.Disks {
+		old, exists := prev.Disks[drive]
+		if !exists {
+			continue
+		}
+		readDelta := cur.ReadBytes - old.ReadBytes
+		writeDelta := cur.WriteBytes - old.WriteBytes
+		if readDelta < 0 || writeDelta < 0 {
+			continue
+		}
+		rates.Disks[drive] = DiskRates{
+			ReadBytesPerSec:  utils.Round(readDelta / seconds),
+			WriteBytesPerSec: utils.Round(writeDelta / seconds),
+		}
+	}
+
+	return rates
+}
+
+// rateBaselineFile is the on-disk form of a collector's rate cache, written
+// on shutdown so a restart can calculate rates on its first scrape
+type rateBaselineFile struct {
+	Collector string          `json:"collector"` // Counters are only comparable within one collector
+	Snapshot  CounterSnapshot `json:"snapshot"`
+}
+
+// saveRateBaseline writes the cached snapshot to path. No-op if the cache
+// is empty.
+func saveRateBaseline(cache RateCache, collector, path string) error {
+	snapshot, ok := cache.Load()
+	if !ok {
+		return nil
+	}
+	data, err := json.Marshal(rateBaselineFile{Collector: collector, Snapshot: snapshot})
+	if err != nil {
+		return err
+	}
+	return secrets.WriteFileAtomic(path, data)
+}
+
+// loadRateBaseline restores a snapshot written by saveRateBaseline. It
+// returns false without error when there is no file, the file is from another
+// collector, or the snapshot is older than maxAge.
+func loadRateBaseline(cache RateCache, collector, path string, maxAge time.Duration) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var file rateBaselineFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("invalid baseline file %s: %w", path, err)
+	}
+	if file.Collector != collector || time.Since(file.Snapshot.Time) > maxAge {
+		return false, nil
+	}
+
+	cache.Store(file.Snapshot)
+	return true, nil
+}
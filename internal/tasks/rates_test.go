@@ -0,0 +1,205 @@
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCalculateRates_Baseline tests that the first snapshot only sets a baseline
+func TestCalculateRates_Baseline(t *testing.T) {
+	cache := newMemoryRateCache()
+
+	rates := calculateRates(cache, CounterSnapshot{
+		Time:     time.Now(),
+		HasCPU:   true,
+		CPUTotal: 100,
+		CPUIdle:  50,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 10}},
+	})
+	if rates.HasCPU || len(rates.Disks) != 0 {
+		t.Errorf("first call rates = %+v, want empty", rates)
+	}
+	if _, ok := cache.Load(); !ok {
+		t.Error("baseline was not stored")
+	}
+}
+
+// TestCalculateRates tests CPU and disk rates between two snapshots
+func TestCalculateRates(t *testing.T) {
+	cache := newMemoryRateCache()
+	start := time.Now()
+
+	calculateRates(cache, CounterSnapshot{
+		Time:     start,
+		HasCPU:   true,
+		CPUTotal: 1000,
+		CPUIdle:  800,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 1000, WriteBytes: 2000}},
+	})
+	rates := calculateRates(cache, CounterSnapshot{
+		Time:     start.Add(10 * time.Second),
+		HasCPU:   true,
+		CPUTotal: 1100,
+		CPUIdle:  875,
+		Disks: map[string]DiskCounters{
+			"sda": {ReadBytes: 11000, WriteBytes: 2500},
+			"sdb": {ReadBytes: 500}, // New drive, no baseline yet
+		},
+	})
+
+	if !rates.HasCPU || rates.CPUPercent != 25 {
+		t.Errorf("CPU = %v (has %v), want 25", rates.CPUPercent, rates.HasCPU)
+	}
+	if got := rates.Disks["sda"]; got.ReadBytesPerSec != 1000 || got.WriteBytesPerSec != 50 {
+		t.Errorf("sda rates = %+v, want read 1000 write 50", got)
+	}
+	if _, ok := rates.Disks["sdb"]; ok {
+		t.Error("sdb has rates without a baseline")
+	}
+}
+
+// TestCalculateRates_CounterReset tests that counters going backwards are skipped
+func TestCalculateRates_CounterReset(t *testing.T) {
+	cache := newMemoryRateCache()
+	start := time.Now()
+
+	calculateRates(cache, CounterSnapshot{
+		Time:     start,
+		HasCPU:   true,
+		CPUTotal: 1000,
+		CPUIdle:  800,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 5000, WriteBytes: 5000}},
+	})
+	rates := calculateRates(cache, CounterSnapshot{
+		Time:     start.Add(10 * time.Second),
+		HasCPU:   true,
+		CPUTotal: 10,
+		CPUIdle:  5,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 100, WriteBytes: 6000}},
+	})
+
+	if rates.HasCPU {
+		t.Errorf("CPU = %v after counter reset, want none", rates.CPUPercent)
+	}
+	if _, ok := rates.Disks["sda"]; ok {
+		t.Error("sda has rates after counter reset")
+	}
+
+	// The reset values become the new baseline
+	rates = calculateRates(cache, CounterSnapshot{
+		Time:     start.Add(20 * time.Second),
+		HasCPU:   true,
+		CPUTotal: 110,
+		CPUIdle:  55,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 1100, WriteBytes: 6000}},
+	})
+	if rates.CPUPercent != 50 {
+		t.Errorf("CPU after re-baseline = %v, want 50", rates.CPUPercent)
+	}
+	if got := rates.Disks["sda"]; got.ReadBytesPerSec != 100 {
+		t.Errorf("sda read after re-baseline = %v, want 100", got.ReadBytesPerSec)
+	}
+}
+
+// TestMemoryRateCache_Reset tests that Reset drops the baseline
+func TestMemoryRateCache_Reset(t *testing.T) {
+	cache := newMemoryRateCache()
+	now := time.Now()
+
+	if _, ok := cacheAge(cache, now); ok {
+		t.Error("empty cache reported an age")
+	}
+
+	cache.Store(CounterSnapshot{Time: now.Add(-time.Minute)})
+	if age, ok := cacheAge(cache, now); !ok || age != time.Minute {
+		t.Errorf("cacheAge() = %v, %v, want 1m, true", age, ok)
+	}
+
+	cache.Reset()
+	if _, ok := cache.Load(); ok {
+		t.Error("cache still loaded after Reset")
+	}
+}
+
+// TestRateBaseline_SaveLoad tests persisting the baseline across a restart
+func TestRateBaseline_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "metrics-baseline.json")
+	now := time.Now()
+
+	saved := newMemoryRateCache()
+	if err := saveRateBaseline(saved, "builtin (gopsutil)", path); err != nil {
+		t.Fatalf("saving an empty cache: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("empty cache wrote a baseline file")
+	}
+
+	saved.Store(CounterSnapshot{
+		Time:     now,
+		HasCPU:   true,
+		CPUTotal: 1000,
+		CPUIdle:  800,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 1000, WriteBytes: 2000}},
+	})
+	if err := saveRateBaseline(saved, "builtin (gopsutil)", path); err != nil {
+		t.Fatalf("saveRateBaseline() error = %v", err)
+	}
+
+	restored := newMemoryRateCache()
+	ok, err := loadRateBaseline(restored, "builtin (gopsutil)", path, 10*time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("loadRateBaseline() = %v, %v, want true, nil", ok, err)
+	}
+
+	// The first calculation after a restart has rates
+	rates := calculateRates(restored, CounterSnapshot{
+		Time:     now.Add(10 * time.Second),
+		HasCPU:   true,
+		CPUTotal: 1100,
+		CPUIdle:  850,
+		Disks:    map[string]DiskCounters{"sda": {ReadBytes: 2000, WriteBytes: 2000}},
+	})
+	if rates.CPUPercent != 50 {
+		t.Errorf("CPU after restore = %v, want 50", rates.CPUPercent)
+	}
+	if got := rates.Disks["sda"]; got.ReadBytesPerSec != 100 {
+		t.Errorf("sda read after restore = %v, want 100", got.ReadBytesPerSec)
+	}
+}
+
+// TestRateBaseline_LoadIgnored tests baselines that must not be restored
+func TestRateBaseline_LoadIgnored(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "metrics-baseline.json")
+
+	// Missing file
+	if ok, err := loadRateBaseline(newMemoryRateCache(), "builtin (gopsutil)", path, time.Minute); ok || err != nil {
+		t.Errorf("missing file = %v, %v, want false, nil", ok, err)
+	}
+
+	cache := newMemoryRateCache()
+	cache.Store(CounterSnapshot{Time: time.Now().Add(-time.Hour), HasCPU: true, CPUTotal: 1})
+	if err := saveRateBaseline(cache, "builtin (gopsutil)", path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stale baseline
+	if ok, _ := loadRateBaseline(newMemoryRateCache(), "builtin (gopsutil)", path, 10*time.Minute); ok {
+		t.Error("stale baseline was restored")
+	}
+
+	// Different collector
+	if ok, _ := loadRateBaseline(newMemoryRateCache(), "exporter (http://localhost:9100/metrics)", path, 2*time.Hour); ok {
+		t.Error("baseline from another collector was restored")
+	}
+
+	// Corrupt file
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadRateBaseline(newMemoryRateCache(), "builtin (gopsutil)", path, time.Hour); err == nil {
+		t.Error("corrupt baseline loaded without error")
+	}
+}
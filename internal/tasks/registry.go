@@ -0,0 +1,186 @@
+package tasks
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// maxRegistryData caps the data cmd.registry writes in one value
+const maxRegistryData = 64 * 1024
+
+// RegistryRequest is a cmd.registry request
+type RegistryRequest struct {
+	Action string   `json:"action"`           // get, set or delete
+	Key    string   `json:"key"`              // e.g. HKLM\SOFTWARE\Vendor\App
+	Name   string   `json:"name,omitempty"`   // Value name (empty = the key's default value)
+	Type   string   `json:"type,omitempty"`   // set: string, expand_string, multi_string, dword, qword or binary
+	Value  string   `json:"value,omitempty"`  // set: the data; dword/qword decimal or 0x hex, binary hex
+	Values []string `json:"values,omitempty"` // set: the strings of a multi_string
+}
+
+// RegistryValue is a registry value. DWORD and QWORD data is decimal and
+// binary data hex; multi_string data is in Values.
+type RegistryValue struct {
+	Type   string   `json:"type"` // string, expand_string, multi_string, dword, qword, binary or unknown
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// RegistryResult is the outcome of a cmd.registry action
+type RegistryResult struct {
+	Value    *RegistryValue `json:"value,omitempty"`    // get and set: the value now
+	Previous *RegistryValue `json:"previous,omitempty"` // set and delete: the value before, if any
+	Changed  bool           `json:"changed"`            // set and delete: the registry was modified
+}
+
+// RegistryCommand performs a cmd.registry action on a whitelisted key
+func (e *Executor) RegistryCommand(req *RegistryRequest, cfg *config.RegistryConfig) (*RegistryResult, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("registry access is not enabled")
+	}
+
+	switch req.Action {
+	case "get":
+		if err := registryAllowed(req.Key, cfg.Keys, false); err != nil {
+			return nil, err
+		}
+		value, err := readRegistryValue(req.Key, req.Name)
+		if err != nil {
+			return nil, err
+		}
+		return &RegistryResult{Value: value}, nil
+
+	case "set":
+		if err := registryAllowed(req.Key, cfg.Keys, true); err != nil {
+			return nil, err
+		}
+		value, err := parseRegistryValue(req)
+		if err != nil {
+			return nil, err
+		}
+		previous, err := readRegistryValue(req.Key, req.Name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err := writeRegistryValue(req.Key, req.Name, value); err != nil {
+			return nil, err
+		}
+		return &RegistryResult{Value: value, Previous: previous, Changed: true}, nil
+
+	case "delete":
+		if err := registryAllowed(req.Key, cfg.Keys, true); err != nil {
+			return nil, err
+		}
+		previous, err := readRegistryValue(req.Key, req.Name)
+		if errors.Is(err, os.ErrNotExist) {
+			return &RegistryResult{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := deleteRegistryValue(req.Key, req.Name); err != nil {
+			return nil, err
+		}
+		return &RegistryResult{Previous: previous, Changed: true}, nil
+	}
+	return nil, fmt.Errorf("invalid action: %s (must be get, set, or delete)", req.Action)
+}
+
+// registryAllowed checks that key is a whitelisted key or one of its
+// subkeys, and that the whitelist entry allows writes if write is set.
+// Hive names may be abbreviated, and matching ignores case.
+func registryAllowed(key string, keys []config.RegistryKeyConfig, write bool) error {
+	path, ok := canonicalRegistryPath(key)
+	if !ok {
+		return fmt.Errorf("invalid registry key: %q", key)
+	}
+	readable := false
+	for _, allowed := range keys {
+		prefix, ok := canonicalRegistryPath(allowed.Path)
+		if !ok || (path != prefix && !strings.HasPrefix(path, prefix+`\`)) {
+			continue
+		}
+		if !write || allowed.Access == "write" {
+			return nil
+		}
+		readable = true
+	}
+	if readable {
+		return fmt.Errorf("registry key is read-only: %s", key)
+	}
+	return fmt.Errorf("registry key not in allowed list: %s", key)
+}
+
+// canonicalRegistryPath upper-cases a key path and abbreviates its hive,
+// returning false if it is not a key under HKLM or HKU
+func canonicalRegistryPath(key string) (string, bool) {
+	root, subkey, _ := strings.Cut(strings.ToUpper(key), `\`)
+	switch root {
+	case "HKLM", "HKEY_LOCAL_MACHINE":
+		root = "HKLM"
+	case "HKU", "HKEY_USERS":
+		root = "HKU"
+	default:
+		return "", false
+	}
+	subkey = strings.Trim(subkey, `\`)
+	if subkey == "" || strings.Contains(subkey, `\\`) {
+		return "", false
+	}
+	return root + `\` + subkey, true
+}
+
+// parseRegistryValue checks a set request's data against its type and
+// normalizes it
+func parseRegistryValue(req *RegistryRequest) (*RegistryValue, error) {
+	if req.Type != "multi_string" && len(req.Values) > 0 {
+		return nil, fmt.Errorf("values is only used with type multi_string")
+	}
+	size := len(req.Value)
+	for _, v := range req.Values {
+		size += len(v) + 1
+	}
+	if size > maxRegistryData {
+		return nil, fmt.Errorf("value data exceeds %d bytes", maxRegistryData)
+	}
+
+	value := &RegistryValue{Type: req.Type, Value: req.Value}
+	switch req.Type {
+	case "string", "expand_string":
+	case "multi_string":
+		if req.Value != "" {
+			return nil, fmt.Errorf("multi_string data goes in values")
+		}
+		for _, v := range req.Values {
+			if v == "" || strings.ContainsRune(v, 0) {
+				return nil, fmt.Errorf("multi_string values must be non-empty, without NUL characters")
+			}
+		}
+		value.Values = req.Values
+	case "dword", "qword":
+		bits := 32
+		if req.Type == "qword" {
+			bits = 64
+		}
+		n, err := strconv.ParseUint(req.Value, 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("%s value must be an unsigned %d-bit number (got: %q)", req.Type, bits, req.Value)
+		}
+		value.Value = strconv.FormatUint(n, 10)
+	case "binary":
+		data, err := hex.DecodeString(req.Value)
+		if err != nil {
+			return nil, fmt.Errorf("binary value must be hex: %w", err)
+		}
+		value.Value = hex.EncodeToString(data)
+	default:
+		return nil, fmt.Errorf("type must be string, expand_string, multi_string, dword, qword, or binary (got: %q)", req.Type)
+	}
+	return value, nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package tasks
+
+import "fmt"
+
+// errRegistryUnsupported is returned by cmd.registry off Windows
+var errRegistryUnsupported = fmt.Errorf("the registry is only supported on Windows")
+
+// readRegistryValue is Windows only
+func readRegistryValue(path, name string) (*RegistryValue, error) {
+	return nil, errRegistryUnsupported
+}
+
+// writeRegistryValue is Windows only
+func writeRegistryValue(path, name string, value *RegistryValue) error {
+	return errRegistryUnsupported
+}
+
+// deleteRegistryValue is Windows only
+func deleteRegistryValue(path, name string) error {
+	return errRegistryUnsupported
+}
@@ -0,0 +1,87 @@
+package tasks
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func TestRegistryAllowed(t *testing.T) {
+	keys := []config.RegistryKeyConfig{
+		{Path: `HKEY_LOCAL_MACHINE\SOFTWARE\Vendor\App`, Access: "write"},
+		{Path: `HKLM\SYSTEM\CurrentControlSet\Services\W32Time`, Access: "read"},
+	}
+
+	tests := []struct {
+		key     string
+		write   bool
+		wantErr bool
+	}{
+		{`HKLM\SOFTWARE\Vendor\App`, true, false},
+		{`hklm\software\vendor\app\Settings`, true, false},
+		{`HKEY_LOCAL_MACHINE\SOFTWARE\Vendor\App\`, true, false},
+		{`HKLM\SYSTEM\CurrentControlSet\Services\W32Time\Parameters`, false, false},
+		{`HKLM\SYSTEM\CurrentControlSet\Services\W32Time`, true, true}, // Read-only
+		{`HKLM\SOFTWARE\Vendor\AppData`, false, true},                  // Not a subkey
+		{`HKLM\SOFTWARE\Vendor`, false, true},                          // Parent of an allowed key
+		{`HKU\SOFTWARE\Vendor\App`, false, true},                       // Other hive
+		{`HKCU\SOFTWARE\Vendor\App`, false, true},                      // Unsupported hive
+		{`HKLM\SOFTWARE\Vendor\App\\..\Other`, false, true},            // Empty segment
+	}
+
+	for _, tt := range tests {
+		err := registryAllowed(tt.key, keys, tt.write)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("registryAllowed(%q, write=%v) error = %v, wantErr %v", tt.key, tt.write, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRegistryValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     RegistryRequest
+		want    string
+		wantErr bool
+	}{
+		{"string", RegistryRequest{Type: "string", Value: "hello"}, "hello", false},
+		{"empty string", RegistryRequest{Type: "string"}, "", false},
+		{"expand string", RegistryRequest{Type: "expand_string", Value: `%ProgramData%\App`}, `%ProgramData%\App`, false},
+		{"dword decimal", RegistryRequest{Type: "dword", Value: "4294967295"}, "4294967295", false},
+		{"dword hex", RegistryRequest{Type: "dword", Value: "0x10"}, "16", false},
+		{"dword overflow", RegistryRequest{Type: "dword", Value: "4294967296"}, "", true},
+		{"dword negative", RegistryRequest{Type: "dword", Value: "-1"}, "", true},
+		{"qword", RegistryRequest{Type: "qword", Value: "0xFFFFFFFFFFFFFFFF"}, "18446744073709551615", false},
+		{"binary", RegistryRequest{Type: "binary", Value: "DEADbeef"}, "deadbeef", false},
+		{"binary odd length", RegistryRequest{Type: "binary", Value: "abc"}, "", true},
+		{"unknown type", RegistryRequest{Type: "link", Value: "x"}, "", true},
+		{"values without multi_string", RegistryRequest{Type: "string", Values: []string{"a"}}, "", true},
+		{"multi_string with value", RegistryRequest{Type: "multi_string", Value: "a"}, "", true},
+		{"multi_string empty entry", RegistryRequest{Type: "multi_string", Values: []string{"a", ""}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRegistryValue(&tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRegistryValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Value != tt.want {
+				t.Errorf("parseRegistryValue() = %q, want %q", got.Value, tt.want)
+			}
+		})
+	}
+
+	got, err := parseRegistryValue(&RegistryRequest{Type: "multi_string", Values: []string{"a", "b"}})
+	if err != nil || !slices.Equal(got.Values, []string{"a", "b"}) {
+		t.Errorf("parseRegistryValue(multi_string) = %+v, %v", got, err)
+	}
+}
+
+func TestRegistryCommandDisabled(t *testing.T) {
+	e := &Executor{}
+	if _, err := e.RegistryCommand(&RegistryRequest{Action: "get", Key: `HKLM\SOFTWARE\Vendor`}, &config.RegistryConfig{}); err == nil {
+		t.Error("RegistryCommand() with registry disabled should fail")
+	}
+}
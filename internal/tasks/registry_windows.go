@@ -0,0 +1,127 @@
+//go:build windows
+
+package tasks
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// splitRegistryPath returns the hive and subkey of a key path under HKLM
+// or HKU
+func splitRegistryPath(path string) (registry.Key, string, error) {
+	rootName, subkey, _ := strings.Cut(path, `\`)
+	switch strings.ToUpper(rootName) {
+	case "HKLM", "HKEY_LOCAL_MACHINE":
+		return registry.LOCAL_MACHINE, strings.Trim(subkey, `\`), nil
+	case "HKU", "HKEY_USERS":
+		return registry.USERS, strings.Trim(subkey, `\`), nil
+	}
+	return 0, "", fmt.Errorf("unsupported registry hive %s", rootName)
+}
+
+// openRegistryKey opens a key in the 64-bit view. A missing key is
+// os.ErrNotExist.
+func openRegistryKey(path string, access uint32) (registry.Key, error) {
+	root, subkey, err := splitRegistryPath(path)
+	if err != nil {
+		return 0, err
+	}
+	return registry.OpenKey(root, subkey, access|registry.WOW64_64KEY)
+}
+
+// readRegistryValue reads a value (name, or the default value if name is
+// empty). A missing key or value is os.ErrNotExist.
+func readRegistryValue(path, name string) (*RegistryValue, error) {
+	k, err := openRegistryKey(path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+
+	size, valueType, err := k.GetValue(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch valueType {
+	case registry.SZ, registry.EXPAND_SZ:
+		v, _, err := k.GetStringValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if valueType == registry.EXPAND_SZ {
+			return &RegistryValue{Type: "expand_string", Value: v}, nil
+		}
+		return &RegistryValue{Type: "string", Value: v}, nil
+	case registry.MULTI_SZ:
+		v, _, err := k.GetStringsValue(name)
+		return &RegistryValue{Type: "multi_string", Values: v}, err
+	case registry.DWORD, registry.QWORD:
+		v, _, err := k.GetIntegerValue(name)
+		if err != nil {
+			return nil, err
+		}
+		if valueType == registry.QWORD {
+			return &RegistryValue{Type: "qword", Value: strconv.FormatUint(v, 10)}, nil
+		}
+		return &RegistryValue{Type: "dword", Value: strconv.FormatUint(v, 10)}, nil
+	case registry.BINARY:
+		v, _, err := k.GetBinaryValue(name)
+		return &RegistryValue{Type: "binary", Value: hex.EncodeToString(v)}, err
+	}
+
+	// Other types (links, resource lists) are returned as raw bytes
+	buf := make([]byte, size)
+	n, _, err := k.GetValue(name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return &RegistryValue{Type: "unknown", Value: hex.EncodeToString(buf[:n])}, nil
+}
+
+// writeRegistryValue writes a value parsed by parseRegistryValue, creating
+// the key if needed
+func writeRegistryValue(path, name string, value *RegistryValue) error {
+	root, subkey, err := splitRegistryPath(path)
+	if err != nil {
+		return err
+	}
+	k, _, err := registry.CreateKey(root, subkey, registry.SET_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	switch value.Type {
+	case "string":
+		return k.SetStringValue(name, value.Value)
+	case "expand_string":
+		return k.SetExpandStringValue(name, value.Value)
+	case "multi_string":
+		return k.SetStringsValue(name, value.Values)
+	case "dword":
+		n, _ := strconv.ParseUint(value.Value, 10, 32)
+		return k.SetDWordValue(name, uint32(n))
+	case "qword":
+		n, _ := strconv.ParseUint(value.Value, 10, 64)
+		return k.SetQWordValue(name, n)
+	case "binary":
+		data, _ := hex.DecodeString(value.Value)
+		return k.SetBinaryValue(name, data)
+	}
+	return fmt.Errorf("unsupported value type %s", value.Type)
+}
+
+// deleteRegistryValue deletes a value
+func deleteRegistryValue(path, name string) error {
+	k, err := openRegistryKey(path, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.DeleteValue(name)
+}
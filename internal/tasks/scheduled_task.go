@@ -0,0 +1,150 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ScheduledTaskRequest is a cmd.scheduled_task request
+type ScheduledTaskRequest struct {
+	Action string `json:"action"`         // list, enable, disable or run
+	Task   string `json:"task,omitempty"` // enable/disable/run: a commands.allowed_scheduled_tasks path
+}
+
+// ScheduledTaskStatus is the state of a whitelisted Windows Scheduled Task
+type ScheduledTaskStatus struct {
+	Task       string `json:"task"`
+	State      string `json:"state,omitempty"`       // Ready, Running, Disabled, Queued or Unknown
+	LastRun    string `json:"last_run,omitempty"`    // RFC3339; empty if never run
+	LastResult *int64 `json:"last_result,omitempty"` // Exit code or HRESULT of the last run
+	NextRun    string `json:"next_run,omitempty"`    // RFC3339; empty if not scheduled
+	Error      string `json:"error,omitempty"`       // The task could not be read (e.g. it does not exist)
+}
+
+// scheduledTaskRunner runs a PowerShell script and returns its output
+type scheduledTaskRunner func(ctx context.Context, script string) (string, error)
+
+// scheduledTaskCommand performs a cmd.scheduled_task action. list reports
+// every whitelisted task; the other actions report the task afterwards, and
+// changed is false if it was already enabled or disabled.
+func scheduledTaskCommand(ctx context.Context, run scheduledTaskRunner, req *ScheduledTaskRequest, allowed []string) ([]ScheduledTaskStatus, bool, error) {
+	if req.Action == "list" {
+		statuses, err := queryScheduledTasks(ctx, run, allowed)
+		return statuses, false, err
+	}
+
+	var cmdlet string
+	switch req.Action {
+	case "enable":
+		cmdlet = "Enable-ScheduledTask"
+	case "disable":
+		cmdlet = "Disable-ScheduledTask"
+	case "run":
+		cmdlet = "Start-ScheduledTask"
+	default:
+		return nil, false, fmt.Errorf("invalid action: %s (must be list, enable, disable, or run)", req.Action)
+	}
+
+	task := ""
+	for _, path := range allowed {
+		if strings.EqualFold(path, req.Task) {
+			task = path
+			break
+		}
+	}
+	if task == "" {
+		return nil, false, fmt.Errorf("scheduled task not in allowed list: %s", req.Task)
+	}
+
+	before, err := queryScheduledTasks(ctx, run, []string{task})
+	if err != nil {
+		return nil, false, err
+	}
+	if before[0].Error != "" {
+		return before, false, fmt.Errorf("scheduled task %s: %s", task, before[0].Error)
+	}
+	disabled := before[0].State == "Disabled"
+	if (req.Action == "enable" && !disabled) || (req.Action == "disable" && disabled) {
+		return before, false, nil
+	}
+	if req.Action == "run" && disabled {
+		return before, false, fmt.Errorf("scheduled task is disabled: %s", task)
+	}
+
+	taskPath, taskName := splitScheduledTask(task)
+	script := fmt.Sprintf("$ErrorActionPreference = 'Stop'; %s -TaskPath %s -TaskName %s | Out-Null",
+		cmdlet, psQuote(taskPath), psQuote(taskName))
+	if _, err := run(ctx, script); err != nil {
+		return nil, false, err
+	}
+
+	after, err := queryScheduledTasks(ctx, run, []string{task})
+	return after, true, err
+}
+
+// queryScheduledTasks reads the state of tasks in one PowerShell run. Tasks
+// that cannot be read are reported with an error rather than failing the
+// query.
+func queryScheduledTasks(ctx context.Context, run scheduledTaskRunner, tasks []string) ([]ScheduledTaskStatus, error) {
+	if len(tasks) == 0 {
+		return []ScheduledTaskStatus{}, nil
+	}
+	quoted := make([]string, len(tasks))
+	for i, task := range tasks {
+		quoted[i] = psQuote(task)
+	}
+	script := `$ErrorActionPreference = 'Stop'
+function Format-Time($t) { if ($t -and $t.Year -gt 2000) { $t.ToUniversalTime().ToString('yyyy-MM-ddTHH:mm:ssZ') } }
+$result = foreach ($task in @(` + strings.Join(quoted, ", ") + `)) {
+  $i = $task.LastIndexOf('\')
+  try {
+    $t = Get-ScheduledTask -TaskPath $task.Substring(0, $i + 1) -TaskName $task.Substring($i + 1)
+    $info = $t | Get-ScheduledTaskInfo
+    [pscustomobject]@{
+      task = $task; state = [string]$t.State; last_run = Format-Time $info.LastRunTime
+      last_result = [int64]$info.LastTaskResult; next_run = Format-Time $info.NextRunTime
+    }
+  } catch {
+    [pscustomobject]@{ task = $task; error = $_.Exception.Message }
+  }
+}
+ConvertTo-Json -InputObject @($result) -Compress`
+
+	out, err := run(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+	return parseScheduledTasks(out, tasks)
+}
+
+// parseScheduledTasks decodes queryScheduledTasks output, which must cover
+// every task asked for
+func parseScheduledTasks(out string, tasks []string) ([]ScheduledTaskStatus, error) {
+	var statuses []ScheduledTaskStatus
+	if err := json.Unmarshal([]byte(strings.TrimSpace(out)), &statuses); err != nil {
+		return nil, fmt.Errorf("failed to parse scheduled task status: %w", err)
+	}
+	if len(statuses) != len(tasks) {
+		return nil, fmt.Errorf("scheduled task status has %d entries, expected %d", len(statuses), len(tasks))
+	}
+	for i := range statuses {
+		if statuses[i].Error == "" && statuses[i].State == "" {
+			statuses[i].State = "Unknown"
+		}
+	}
+	return statuses, nil
+}
+
+// splitScheduledTask splits \Folder\Name into the folder path (with its
+// trailing backslash, as Task Scheduler cmdlets expect) and the task name
+func splitScheduledTask(task string) (string, string) {
+	i := strings.LastIndex(task, `\`)
+	return task[:i+1], task[i+1:]
+}
+
+// psQuote quotes s as a PowerShell single-quoted string
+func psQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
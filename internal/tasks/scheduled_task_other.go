@@ -0,0 +1,10 @@
+//go:build !windows
+
+package tasks
+
+import "fmt"
+
+// ScheduledTaskCommand is Windows only
+func (e *Executor) ScheduledTaskCommand(req *ScheduledTaskRequest, allowed []string) ([]ScheduledTaskStatus, bool, error) {
+	return nil, false, fmt.Errorf("scheduled tasks are only supported on Windows")
+}
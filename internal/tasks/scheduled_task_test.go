@@ -0,0 +1,142 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeTaskScheduler answers scheduled task scripts from a map of task
+// states, applying enable/disable/run cmdlets to it
+type fakeTaskScheduler struct {
+	states map[string]string
+	runs   []string
+}
+
+func (f *fakeTaskScheduler) run(ctx context.Context, script string) (string, error) {
+	for _, cmdlet := range []string{"Enable-ScheduledTask", "Disable-ScheduledTask", "Start-ScheduledTask"} {
+		if !strings.Contains(script, cmdlet) {
+			continue
+		}
+		f.runs = append(f.runs, script)
+		task := strings.ReplaceAll(scriptArg(script, "-TaskPath")+scriptArg(script, "-TaskName"), "''", "'")
+		switch cmdlet {
+		case "Enable-ScheduledTask":
+			f.states[task] = "Ready"
+		case "Disable-ScheduledTask":
+			f.states[task] = "Disabled"
+		case "Start-ScheduledTask":
+			f.states[task] = "Running"
+		}
+		return "", nil
+	}
+
+	var entries []string
+	for _, quoted := range strings.Split(between(script, "@(", "))"), ", ") {
+		task := strings.ReplaceAll(strings.Trim(quoted, "'"), "''", "'")
+		if state, ok := f.states[task]; ok {
+			entries = append(entries, fmt.Sprintf(`{"task":%q,"state":%q,"last_result":0,"next_run":null}`, task, state))
+		} else {
+			entries = append(entries, fmt.Sprintf(`{"task":%q,"error":"No MSFT_ScheduledTask objects found"}`, task))
+		}
+	}
+	return "[" + strings.Join(entries, ",") + "]\r\n", nil
+}
+
+// scriptArg returns the single-quoted value following flag in a script
+func scriptArg(script, flag string) string {
+	rest := script[strings.Index(script, flag+" '")+len(flag)+2:]
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '\'' {
+			if i+1 < len(rest) && rest[i+1] == '\'' {
+				i++
+				continue
+			}
+			return rest[:i]
+		}
+	}
+	return rest
+}
+
+func between(s, start, end string) string {
+	s = s[strings.Index(s, start)+len(start):]
+	return s[:strings.Index(s, end)]
+}
+
+func TestScheduledTaskCommand(t *testing.T) {
+	allowed := []string{`\Vendor\Sync`, `\Vendor\Nightly Report`, `\O'Brien`, `\Missing`}
+	newFake := func() *fakeTaskScheduler {
+		return &fakeTaskScheduler{states: map[string]string{
+			`\Vendor\Sync`:           "Ready",
+			`\Vendor\Nightly Report`: "Disabled",
+			`\O'Brien`:               "Ready",
+		}}
+	}
+
+	t.Run("list", func(t *testing.T) {
+		fake := newFake()
+		statuses, changed, err := scheduledTaskCommand(context.Background(), fake.run, &ScheduledTaskRequest{Action: "list"}, allowed)
+		if err != nil || changed {
+			t.Fatalf("list: changed=%v err=%v", changed, err)
+		}
+		if len(statuses) != 4 {
+			t.Fatalf("list returned %d tasks, want 4", len(statuses))
+		}
+		if statuses[1].State != "Disabled" || statuses[2].Task != `\O'Brien` || statuses[3].Error == "" {
+			t.Errorf("list = %+v", statuses)
+		}
+		if statuses[0].LastResult == nil || *statuses[0].LastResult != 0 {
+			t.Errorf("last_result = %v, want 0", statuses[0].LastResult)
+		}
+	})
+
+	tests := []struct {
+		name        string
+		req         ScheduledTaskRequest
+		wantState   string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"enable disabled", ScheduledTaskRequest{Action: "enable", Task: `\vendor\nightly report`}, "Ready", true, false},
+		{"enable enabled", ScheduledTaskRequest{Action: "enable", Task: `\Vendor\Sync`}, "Ready", false, false},
+		{"disable", ScheduledTaskRequest{Action: "disable", Task: `\Vendor\Sync`}, "Disabled", true, false},
+		{"disable disabled", ScheduledTaskRequest{Action: "disable", Task: `\Vendor\Nightly Report`}, "Disabled", false, false},
+		{"run", ScheduledTaskRequest{Action: "run", Task: `\O'Brien`}, "Running", true, false},
+		{"run disabled", ScheduledTaskRequest{Action: "run", Task: `\Vendor\Nightly Report`}, "", false, true},
+		{"not allowed", ScheduledTaskRequest{Action: "run", Task: `\Microsoft\Windows\Defrag\ScheduledDefrag`}, "", false, true},
+		{"missing task", ScheduledTaskRequest{Action: "enable", Task: `\Missing`}, "", false, true},
+		{"bad action", ScheduledTaskRequest{Action: "delete", Task: `\Vendor\Sync`}, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFake()
+			statuses, changed, err := scheduledTaskCommand(context.Background(), fake.run, &tt.req, allowed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scheduledTaskCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !tt.wantChanged && len(fake.runs) > 0 {
+				t.Errorf("unexpected change scripts: %v", fake.runs)
+			}
+			if tt.wantState != "" && (len(statuses) != 1 || statuses[0].State != tt.wantState) {
+				t.Errorf("statuses = %+v, want state %s", statuses, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestSplitScheduledTask(t *testing.T) {
+	tests := []struct{ task, path, name string }{
+		{`\Sync`, `\`, "Sync"},
+		{`\Vendor\App\Sync`, `\Vendor\App\`, "Sync"},
+	}
+	for _, tt := range tests {
+		if path, name := splitScheduledTask(tt.task); path != tt.path || name != tt.name {
+			t.Errorf("splitScheduledTask(%q) = %q, %q; want %q, %q", tt.task, path, name, tt.path, tt.name)
+		}
+	}
+}
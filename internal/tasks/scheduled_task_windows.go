@@ -0,0 +1,32 @@
+//go:build windows
+
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ScheduledTaskCommand lists, enables, disables or runs whitelisted Windows
+// Scheduled Tasks through the ScheduledTasks PowerShell module
+func (e *Executor) ScheduledTaskCommand(req *ScheduledTaskRequest, allowed []string) ([]ScheduledTaskStatus, bool, error) {
+	if err := e.Unavailable("cmd.scheduled_task"); err != nil {
+		return nil, false, err
+	}
+	return scheduledTaskCommand(e.ctx, runScheduledTaskScript, req, allowed)
+}
+
+// runScheduledTaskScript runs a Task Scheduler script in PowerShell
+func runScheduledTaskScript(ctx context.Context, script string) (string, error) {
+	result, err := executePowerShell(ctx, script, serviceCommandTimeout, 0)
+	if err != nil {
+		if result != nil {
+			if out := strings.TrimSpace(result.Stderr + "\n" + result.Stdout); out != "" {
+				return "", fmt.Errorf("%w: %s", err, out)
+			}
+		}
+		return "", err
+	}
+	return result.Stdout, nil
+}
@@ -0,0 +1,271 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ScriptManifestFile is the optional manifest in the scripts directory.
+// With one present, only the scripts it lists run, and only while their
+// sha256 matches.
+const ScriptManifestFile = "manifest.yaml"
+
+// maxScriptTimeout bounds a script's manifest timeout, as commands.timeout
+// is bounded
+const maxScriptTimeout = 5 * time.Minute
+
+// maxScriptSize bounds the script files read to be checksummed and run
+const maxScriptSize = 1024 * 1024 // 1MB
+
+// ScriptManifest declares the scripts cmd.exec may run
+type ScriptManifest struct {
+	Scripts []ScriptEntry `yaml:"scripts"`
+}
+
+// ScriptEntry is one script in the manifest
+type ScriptEntry struct {
+	Name        string        `yaml:"name"`        // File name in the scripts directory
+	SHA256      string        `yaml:"sha256"`      // Hex digest of the file
+	Description string        `yaml:"description"` // Shown by cmd.scripts.list
+	Parameters  []string      `yaml:"parameters"`  // Arguments the script may be passed, each on its own
+	Timeout     time.Duration `yaml:"timeout"`     // Replaces commands.timeout (0 = commands.timeout)
+}
+
+// ScriptInfo describes a script for cmd.scripts.list
+type ScriptInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Parameters  []string `json:"parameters,omitempty"`
+	Timeout     string   `json:"timeout,omitempty"`
+	SHA256      string   `json:"sha256,omitempty"` // Digest of the file on disk
+	Status      string   `json:"status"`           // ok, modified, missing, or unlisted (not in the manifest, or no manifest)
+}
+
+// scriptParameterPattern keeps parameters free of shell and PowerShell
+// metacharacters, so they are passed on the command line as-is
+var scriptParameterPattern = regexp.MustCompile(`^[A-Za-z0-9._:/=,@+-]+$`)
+
+// LoadScriptManifest reads the manifest in scriptsDir. It returns nil
+// without error if there is none.
+func LoadScriptManifest(scriptsDir string) (*ScriptManifest, error) {
+	data, err := os.ReadFile(filepath.Join(scriptsDir, ScriptManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script manifest: %w", err)
+	}
+
+	var manifest ScriptManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid script manifest: %w", err)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid script manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// validate checks every entry, so a broken manifest fails as a whole
+// rather than script by script
+func (m *ScriptManifest) validate() error {
+	seen := make(map[string]bool, len(m.Scripts))
+	for i, s := range m.Scripts {
+		if s.Name == "" || s.Name != filepath.Base(s.Name) || s.Name == ScriptManifestFile {
+			return fmt.Errorf("scripts[%d]: name must be a file name in the scripts directory (got: %q)", i, s.Name)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("scripts[%d]: duplicate name %s", i, s.Name)
+		}
+		seen[s.Name] = true
+		if digest, err := hex.DecodeString(s.SHA256); err != nil || len(digest) != sha256.Size {
+			return fmt.Errorf("%s: sha256 must be 64 hex characters", s.Name)
+		}
+		for _, p := range s.Parameters {
+			if !scriptParameterPattern.MatchString(p) {
+				return fmt.Errorf("%s: invalid parameter %q (letters, digits and ._:/=,@+- only)", s.Name, p)
+			}
+		}
+		if s.Timeout < 0 || s.Timeout > maxScriptTimeout {
+			return fmt.Errorf("%s: timeout must be between 0 and %v (got: %v)", s.Name, maxScriptTimeout, s.Timeout)
+		}
+	}
+	return nil
+}
+
+// script returns the entry for name, or nil if it isn't listed
+func (m *ScriptManifest) script(name string) *ScriptEntry {
+	for i := range m.Scripts {
+		if m.Scripts[i].Name == name {
+			return &m.Scripts[i]
+		}
+	}
+	return nil
+}
+
+// listedScript is a manifest script ready to run: a private copy of the
+// file as it was checksummed, so the file can't be swapped between the
+// check and the run
+type listedScript struct {
+	command string        // Command line running the copy
+	timeout time.Duration // Manifest timeout, else the command's
+	dir     string        // Private directory holding the copy
+}
+
+// remove deletes the copy once the script has run
+func (s *listedScript) remove() {
+	os.RemoveAll(s.dir)
+}
+
+// manifestScript applies the scripts directory manifest to a command that
+// runs a script, optionally with arguments. As without a manifest, a
+// script is looked up by file name in the scripts directory. It must be
+// listed, each argument must be one of its parameters, and its sha256 must
+// match. It returns nil without error when there is no manifest or the
+// command isn't a script; otherwise the caller removes the returned copy.
+func manifestScript(command, scriptsDir string, timeout time.Duration) (*listedScript, error) {
+	fields := strings.Fields(command)
+	if scriptsDir == "" || len(fields) == 0 || !isScript(fields[0]) {
+		return nil, nil
+	}
+	name := filepath.Base(fields[0])
+
+	manifest, err := LoadScriptManifest(scriptsDir)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+
+	entry := manifest.script(name)
+	if entry == nil {
+		return nil, fmt.Errorf("script not listed in %s: %s", ScriptManifestFile, name)
+	}
+	for _, arg := range fields[1:] {
+		if !slices.Contains(entry.Parameters, arg) {
+			return nil, fmt.Errorf("parameter not allowed for %s: %s", name, arg)
+		}
+	}
+
+	// Check and run the same bytes
+	data, err := readScript(filepath.Join(scriptsDir, name))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), entry.SHA256) {
+		return nil, fmt.Errorf("script checksum mismatch: %s (was it modified?)", name)
+	}
+	dir, err := os.MkdirTemp("", "agent-script-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy script: %w", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to copy script: %w", err)
+	}
+
+	if entry.Timeout > 0 {
+		timeout = entry.Timeout
+	}
+	return &listedScript{
+		command: strings.Join(append([]string{scriptCommand(path)}, fields[1:]...), " "),
+		timeout: timeout,
+		dir:     dir,
+	}, nil
+}
+
+// ListScripts lists the scripts in the manifest and the script files in
+// scriptsDir, with whether each file matches its manifest entry. manifest
+// is false if the directory has no manifest.
+func (e *Executor) ListScripts(scriptsDir string) (scripts []ScriptInfo, manifest bool, err error) {
+	if scriptsDir == "" {
+		return nil, false, fmt.Errorf("no scripts directory configured")
+	}
+	m, err := LoadScriptManifest(scriptsDir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	entries, err := os.ReadDir(scriptsDir)
+	if err != nil {
+		return nil, m != nil, fmt.Errorf("failed to read scripts directory: %w", err)
+	}
+	files := make(map[string]string) // Script file -> sha256
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isScript(entry.Name()) {
+			if sum, err := fileSHA256(filepath.Join(scriptsDir, entry.Name())); err == nil {
+				files[entry.Name()] = sum
+			}
+		}
+	}
+
+	scripts = []ScriptInfo{}
+	if m != nil {
+		for _, s := range m.Scripts {
+			info := ScriptInfo{
+				Name:        s.Name,
+				Description: s.Description,
+				Parameters:  s.Parameters,
+				SHA256:      files[s.Name],
+				Status:      "ok",
+			}
+			if s.Timeout > 0 {
+				info.Timeout = s.Timeout.String()
+			}
+			switch sum, ok := files[s.Name]; {
+			case !ok:
+				info.Status = "missing"
+			case !strings.EqualFold(sum, s.SHA256):
+				info.Status = "modified"
+			}
+			scripts = append(scripts, info)
+			delete(files, s.Name)
+		}
+	}
+
+	// Script files the manifest doesn't list (all of them without one)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		scripts = append(scripts, ScriptInfo{Name: name, SHA256: files[name], Status: "unlisted"})
+	}
+	return scripts, m != nil, nil
+}
+
+// fileSHA256 returns the hex sha256 of a file
+func fileSHA256(path string) (string, error) {
+	data, err := readScript(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readScript reads a script file of at most maxScriptSize bytes
+func readScript(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxScriptSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script: %w", err)
+	}
+	if len(data) > maxScriptSize {
+		return nil, fmt.Errorf("script too large: %s (max %d bytes)", filepath.Base(path), maxScriptSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,167 @@
+//go:build linux || freebsd
+
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func writeScript(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o755); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestScriptManifest tests that a manifest restricts scripts to the listed,
+// unmodified ones and their declared parameters
+func TestScriptManifest(t *testing.T) {
+	dir := t.TempDir()
+	sum := writeScript(t, dir, "check.sh", "#!/bin/bash\necho \"checked $1\"\n")
+	writeScript(t, dir, "other.sh", "#!/bin/bash\necho other\n")
+
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	// Without a manifest every script in the directory may run
+	if script, err := manifestScript("other.sh", dir, time.Second); script != nil || err != nil {
+		t.Fatalf("manifestScript() without manifest = %+v, %v", script, err)
+	}
+	scripts, manifest, err := executor.ListScripts(dir)
+	if err != nil || manifest || len(scripts) != 2 || scripts[0].Status != "unlisted" || scripts[0].SHA256 != sum {
+		t.Fatalf("ListScripts() without manifest = %+v, %v, %v", scripts, manifest, err)
+	}
+
+	writeScript(t, dir, ScriptManifestFile, `scripts:
+  - name: check.sh
+    sha256: "`+sum+`"
+    description: "Runs the check"
+    parameters: ["--full"]
+    timeout: "2m"
+  - name: gone.sh
+    sha256: "`+strings.Repeat("0", 64)+`"
+`)
+
+	result, err := executor.ExecuteCommand("check.sh --full", nil, dir, 5*time.Second, 0)
+	if err != nil || strings.TrimSpace(result.Stdout) != "checked --full" {
+		t.Fatalf("ExecuteCommand(listed) = %+v, %v", result, err)
+	}
+	script, err := manifestScript("check.sh --full", dir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("manifestScript(listed) error = %v", err)
+	}
+	if script.timeout != 2*time.Minute {
+		t.Errorf("manifest timeout = %v, want 2m", script.timeout)
+	}
+
+	// The checked copy runs, whatever happens to the file after the check,
+	// and needs no exec permission (/tmp may be noexec)
+	if info, err := os.Stat(filepath.Join(script.dir, "check.sh")); err != nil || info.Mode().Perm()&0o111 != 0 {
+		t.Errorf("copy = %v, %v; want no exec permission", info, err)
+	}
+	writeScript(t, dir, "check.sh", "#!/bin/bash\necho swapped\n")
+	result, err = executeBash(context.Background(), script.command, 5*time.Second, 0)
+	if err != nil || strings.TrimSpace(result.Stdout) != "checked --full" {
+		t.Errorf("running the checked copy = %+v, %v", result, err)
+	}
+	script.remove()
+	if _, err := os.Stat(script.dir); !os.IsNotExist(err) {
+		t.Errorf("copy not removed: %v", err)
+	}
+	writeScript(t, dir, "check.sh", "#!/bin/bash\necho \"checked $1\"\n")
+
+	for _, tt := range []struct {
+		command string
+		errText string
+	}{
+		{"other.sh", "not listed"},
+		{filepath.Join("/tmp", "other.sh"), "not listed"},
+		{"check.sh --rm", "parameter not allowed"},
+		{"gone.sh", "failed to open script"},
+	} {
+		if _, err := executor.ExecuteCommand(tt.command, nil, dir, 5*time.Second, 0); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("ExecuteCommand(%q) error = %v, want %q", tt.command, err, tt.errText)
+		}
+	}
+
+	// An exact allowed_commands entry isn't subject to the manifest
+	if _, err := executor.ExecuteCommand("other.sh", []string{"other.sh"}, dir, 5*time.Second, 0); err != nil {
+		t.Errorf("ExecuteCommand(whitelisted) error = %v", err)
+	}
+
+	// A tampered script no longer runs
+	writeScript(t, dir, "check.sh", "#!/bin/bash\necho tampered\n")
+	if _, err := executor.ExecuteCommand("check.sh", nil, dir, 5*time.Second, 0); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("ExecuteCommand(tampered) error = %v, want a checksum mismatch", err)
+	}
+
+	scripts, manifest, err = executor.ListScripts(dir)
+	if err != nil || !manifest {
+		t.Fatalf("ListScripts() = %v, %v", manifest, err)
+	}
+	statuses := make(map[string]string)
+	for _, s := range scripts {
+		statuses[s.Name] = s.Status
+	}
+	want := map[string]string{"check.sh": "modified", "gone.sh": "missing", "other.sh": "unlisted"}
+	if len(statuses) != len(want) {
+		t.Errorf("ListScripts() = %+v", scripts)
+	}
+	for name, status := range want {
+		if statuses[name] != status {
+			t.Errorf("ListScripts() %s status = %q, want %q", name, statuses[name], status)
+		}
+	}
+}
+
+// TestScriptManifestInvalid tests that a broken manifest blocks scripts
+// rather than being ignored
+func TestScriptManifestInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		manifest string
+		errText  string
+	}{
+		{"bad yaml", "scripts: [", "invalid script manifest"},
+		{"bad sha256", "scripts:\n  - name: a.sh\n    sha256: abc\n", "sha256"},
+		{"path as name", "scripts:\n  - name: ../a.sh\n    sha256: " + strings.Repeat("a", 64) + "\n", "file name"},
+		{"shell in parameter", "scripts:\n  - name: a.sh\n    sha256: " + strings.Repeat("a", 64) + "\n    parameters: [\"; reboot\"]\n", "invalid parameter"},
+		{"long timeout", "scripts:\n  - name: a.sh\n    sha256: " + strings.Repeat("a", 64) + "\n    timeout: 1h\n", "timeout"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeScript(t, dir, ScriptManifestFile, tt.manifest)
+			if _, err := manifestScript("a.sh", dir, time.Second); err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("manifestScript() error = %v, want %q", err, tt.errText)
+			}
+		})
+	}
+}
+
+// TestReadScriptTooLarge tests that scripts over maxScriptSize are refused
+// rather than read into memory
+func TestReadScriptTooLarge(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "big.sh", strings.Repeat("#", maxScriptSize+1))
+	if _, err := readScript(filepath.Join(dir, "big.sh")); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("readScript() error = %v, want too large", err)
+	}
+
+	writeScript(t, dir, "max.sh", strings.Repeat("#", maxScriptSize))
+	if data, err := readScript(filepath.Join(dir, "max.sh")); err != nil || len(data) != maxScriptSize {
+		t.Errorf("readScript() at the limit = %d bytes, %v", len(data), err)
+	}
+}
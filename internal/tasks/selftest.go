@@ -0,0 +1,136 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Self-test check outcomes
+const (
+	SelfTestPass = "pass"
+	SelfTestFail = "fail"
+	SelfTestSkip = "skip" // Not applicable to this agent's config or platform
+)
+
+// SelfTestCheck is the outcome of one cmd.selftest check
+type SelfTestCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"` // SelfTestPass, SelfTestFail or SelfTestSkip
+	Detail     string `json:"detail,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// SkipCheck is returned by a self-test check that doesn't apply, with the
+// reason
+type SkipCheck string
+
+func (s SkipCheck) Error() string {
+	return string(s)
+}
+
+// RunCheck runs a self-test check. fn returns a detail for the report; an
+// error fails the check, unless it is a SkipCheck.
+func RunCheck(name string, fn func() (string, error)) SelfTestCheck {
+	start := time.Now()
+	detail, err := fn()
+	check := SelfTestCheck{
+		Name:       name,
+		Status:     SelfTestPass,
+		Detail:     detail,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+
+	var skip SkipCheck
+	switch {
+	case errors.As(err, &skip):
+		check.Status = SelfTestSkip
+		check.Detail = skip.Error()
+	case err != nil:
+		check.Status = SelfTestFail
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// CheckCollector runs one collection with the active metrics collector. The
+// scheduled scrape's rates then span the shorter gap since this one, which
+// they are normalized for.
+func (e *Executor) CheckCollector(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.scrapeTimeout)
+	defer cancel()
+
+	metrics, err := e.metricsCollector.Collect(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", e.metricsCollector.Name(), err)
+	}
+	return fmt.Sprintf("%s: cpu %.1f%%, %d disks", e.metricsCollector.Name(), metrics.CPUUsagePercent, len(metrics.Disks)), nil
+}
+
+// CheckExporter scrapes the exporter, for the exporter and hybrid sources
+func (e *Executor) CheckExporter(ctx context.Context) (string, error) {
+	if e.exporterURL == "" {
+		return "", SkipCheck("metrics source doesn't use an exporter")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.scrapeTimeout)
+	defer cancel()
+
+	body, err := scrapeExporter(ctx, e.httpClient, e.exporterURL, e.exporterRequest, e.logger)
+	if err != nil {
+		return "", err
+	}
+	body.Close()
+	return e.exporterURL, nil
+}
+
+// CheckScriptsDirectory lists the scripts directory, which also validates
+// its manifest
+func (e *Executor) CheckScriptsDirectory(scriptsDir string) (string, error) {
+	if scriptsDir == "" {
+		return "", SkipCheck("no scripts directory configured")
+	}
+
+	scripts, manifest, err := e.ListScripts(scriptsDir)
+	if err != nil {
+		return "", err
+	}
+	if manifest {
+		return fmt.Sprintf("%d scripts, %s present", len(scripts), ScriptManifestFile), nil
+	}
+	return fmt.Sprintf("%d scripts, no manifest", len(scripts)), nil
+}
+
+// CheckWritable writes, syncs and removes a file in dir, and reports the
+// volume's free space
+func CheckWritable(dir string) (string, error) {
+	if dir == "" {
+		return "", SkipCheck("not configured")
+	}
+
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create file in %s: %w", dir, err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("selftest\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write to %s: %w", dir, err)
+	}
+
+	free, err := DiskFree(dir)
+	if err != nil {
+		return dir, nil
+	}
+	return fmt.Sprintf("%s (%.1f GB free)", dir, float64(free)/(1<<30)), nil
+}
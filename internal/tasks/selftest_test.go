@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// TestRunCheck tests that check outcomes map to pass, fail and skip
+func TestRunCheck(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		detail string
+		err    error
+		status string
+	}{
+		{"pass", "fine", nil, SelfTestPass},
+		{"fail", "", errors.New("broken"), SelfTestFail},
+		{"skip", "", SkipCheck("not configured"), SelfTestSkip},
+	} {
+		check := RunCheck(tt.name, func() (string, error) { return tt.detail, tt.err })
+		if check.Name != tt.name || check.Status != tt.status {
+			t.Errorf("RunCheck(%s) = %+v, want status %q", tt.name, check, tt.status)
+		}
+	}
+
+	if check := RunCheck("fail", func() (string, error) { return "", errors.New("broken") }); check.Error != "broken" {
+		t.Errorf("failed check error = %q, want %q", check.Error, "broken")
+	}
+	if check := RunCheck("skip", func() (string, error) { return "", SkipCheck("not configured") }); check.Detail != "not configured" || check.Error != "" {
+		t.Errorf("skipped check = %+v, want the reason as detail", check)
+	}
+}
+
+// TestCheckWritable tests the write check leaves nothing behind
+func TestCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := CheckWritable(dir); err != nil {
+		t.Fatalf("CheckWritable() error = %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("CheckWritable() left %d files behind", len(entries))
+	}
+
+	if _, err := CheckWritable(filepath.Join(dir, "missing")); err == nil {
+		t.Error("CheckWritable() on a missing directory should fail")
+	}
+	var skip SkipCheck
+	if _, err := CheckWritable(""); !errors.As(err, &skip) {
+		t.Errorf("CheckWritable(\"\") error = %v, want a skip", err)
+	}
+}
+
+// TestSelfTestChecksSkip tests that checks not applicable to the config skip
+func TestSelfTestChecksSkip(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "http://localhost:9100/metrics")
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	var skip SkipCheck
+	if _, err := executor.CheckExporter(context.Background()); !errors.As(err, &skip) {
+		t.Errorf("CheckExporter() with builtin source error = %v, want a skip", err)
+	}
+	if _, err := executor.CheckScriptsDirectory(""); !errors.As(err, &skip) {
+		t.Errorf("CheckScriptsDirectory(\"\") error = %v, want a skip", err)
+	}
+	if _, err := executor.CheckScriptsDirectory(t.TempDir()); err != nil {
+		t.Errorf("CheckScriptsDirectory() error = %v", err)
+	}
+}
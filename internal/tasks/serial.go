@@ -0,0 +1,124 @@
+package tasks
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/serial"
+)
+
+// maxSerialResponse caps the bytes read in one serial exchange
+const maxSerialResponse = 64 * 1024
+
+// SerialRequest is a cmd.serial request: data to write to a port and how to
+// recognize the end of the response
+type SerialRequest struct {
+	Port      string `json:"port"`                // Device, as listed in commands.serial_ports
+	Data      string `json:"data"`                // Written first; empty = only listen
+	Encoding  string `json:"encoding,omitempty"`  // Of data, delimiter and the response: text (default), hex, base64
+	Delimiter string `json:"delimiter,omitempty"` // Response ends with this (e.g. "\r\n")
+	Length    int    `json:"length,omitempty"`    // Response is this many bytes
+	Idle      string `json:"idle,omitempty"`      // Response ends after this much silence (Go duration)
+	Timeout   string `json:"timeout,omitempty"`   // Go duration, at most commands.timeout (default)
+}
+
+// SerialResult is the response read from the port, encoded like the request
+type SerialResult struct {
+	Data     string `json:"data"`
+	Bytes    int    `json:"bytes"`
+	TimedOut bool   `json:"timed_out"` // The timeout passed before the framing was satisfied
+}
+
+// SerialExchange writes req.Data to a whitelisted serial port and reads the
+// response. The port is held exclusively (including from Modbus polls) for
+// the exchange. maxTimeout bounds and defaults the request's timeout.
+func (e *Executor) SerialExchange(req *SerialRequest, ports []config.SerialConfig, maxTimeout time.Duration) (*SerialResult, error) {
+	var port *config.SerialConfig
+	for i := range ports {
+		if ports[i].Device == req.Port {
+			port = &ports[i]
+			break
+		}
+	}
+	if port == nil {
+		return nil, fmt.Errorf("serial port not in allowed list: %s", req.Port)
+	}
+
+	switch req.Encoding {
+	case "", "text", "hex", "base64":
+	default:
+		return nil, fmt.Errorf("encoding must be text, hex, or base64 (got: %s)", req.Encoding)
+	}
+	data, err := decodeSerial(req.Data, req.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data: %w", err)
+	}
+	delimiter, err := decodeSerial(req.Delimiter, req.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delimiter: %w", err)
+	}
+	if req.Length < 0 || req.Length > maxSerialResponse {
+		return nil, fmt.Errorf("length must be between 0 and %d", maxSerialResponse)
+	}
+	framing := serial.Framing{Delimiter: delimiter, Length: req.Length, MaxBytes: maxSerialResponse}
+	if req.Idle != "" {
+		if framing.Idle, err = time.ParseDuration(req.Idle); err != nil || framing.Idle <= 0 {
+			return nil, fmt.Errorf("invalid idle: %s", req.Idle)
+		}
+	}
+	timeout := maxTimeout
+	if req.Timeout != "" {
+		if timeout, err = time.ParseDuration(req.Timeout); err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %s", req.Timeout)
+		}
+		if timeout > maxTimeout {
+			return nil, fmt.Errorf("timeout cannot exceed %v", maxTimeout)
+		}
+	}
+
+	defer serial.Lock(port.Device)()
+	conn, err := serial.Open(*port, serial.PollInterval)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, timedOut, err := serial.Exchange(conn, data, framing, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &SerialResult{
+		Data:     encodeSerial(resp, req.Encoding),
+		Bytes:    len(resp),
+		TimedOut: timedOut,
+	}, nil
+}
+
+// decodeSerial converts request text in the given encoding to bytes
+func decodeSerial(s, encoding string) ([]byte, error) {
+	switch encoding {
+	case "hex":
+		return hex.DecodeString(s)
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return []byte(s), nil
+	}
+}
+
+// encodeSerial converts response bytes to the request's encoding. Text
+// responses that aren't valid UTF-8 have invalid bytes replaced by JSON
+// marshaling, so binary protocols should use hex or base64.
+func encodeSerial(b []byte, encoding string) string {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString(b)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	default:
+		return string(b)
+	}
+}
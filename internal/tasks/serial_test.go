@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// TestSerialExchangeRejects covers the checks made before a port is opened
+func TestSerialExchangeRejects(t *testing.T) {
+	executor, err := NewExecutor(zap.NewNop(), 0, context.Background(), "builtin", "")
+	if err != nil {
+		t.Fatalf("NewExecutor() error = %v", err)
+	}
+	ports := []config.SerialConfig{{Device: "/dev/ttyUSB0"}}
+
+	tests := []struct {
+		name    string
+		req     SerialRequest
+		wantErr string
+	}{
+		{"port not allowed", SerialRequest{Port: "/dev/ttyS0"}, "not in allowed list"},
+		{"unknown encoding", SerialRequest{Port: "/dev/ttyUSB0", Encoding: "ascii"}, "encoding must be"},
+		{"bad hex", SerialRequest{Port: "/dev/ttyUSB0", Encoding: "hex", Data: "0g"}, "invalid data"},
+		{"bad base64 delimiter", SerialRequest{Port: "/dev/ttyUSB0", Encoding: "base64", Delimiter: "!!"}, "invalid delimiter"},
+		{"length too large", SerialRequest{Port: "/dev/ttyUSB0", Length: maxSerialResponse + 1}, "length must be"},
+		{"bad idle", SerialRequest{Port: "/dev/ttyUSB0", Idle: "soon"}, "invalid idle"},
+		{"timeout over limit", SerialRequest{Port: "/dev/ttyUSB0", Timeout: "1m"}, "cannot exceed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := executor.SerialExchange(&tt.req, ports, 30*time.Second)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SerialExchange() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSerialEncoding(t *testing.T) {
+	for _, encoding := range []string{"", "text", "hex", "base64"} {
+		in := []byte("\x01\x03OK\r\n")
+		got, err := decodeSerial(encodeSerial(in, encoding), encoding)
+		if err != nil || string(got) != string(in) {
+			t.Errorf("%q: round trip = %q, %v", encoding, got, err)
+		}
+	}
+}
@@ -1,25 +1,87 @@
 package tasks
 
-import "time"
+import (
+	"context"
+	"fmt"
+	"time"
+)
 
 // serviceCommandTimeout bounds external service-control commands (systemctl,
 // rc.d) so a hung service manager cannot block the NATS command handler
 // indefinitely. Matches the 30s wait used by the Windows SCM implementation.
 const serviceCommandTimeout = 30 * time.Second
 
+// serviceVerifyInterval is how often a service's status is checked while
+// waiting for it to reach the state an action asked for
+const serviceVerifyInterval = 500 * time.Millisecond
+
+// serviceSettleTime is how long a started service must keep running before
+// the start counts as a success, so a unit that crashes right after start
+// (and is restarted in a loop) is reported as failed
+const serviceSettleTime = 2 * time.Second
+
+// waitServiceState polls status until it reports desired, waiting up to
+// timeout for that, then until it has reported desired for settle in a row.
+// It returns the last status seen, with an error if desired wasn't reached
+// or didn't hold.
+func waitServiceState(ctx context.Context, status func() (string, error), desired string, timeout, settle time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	last := ServiceStatusUnknown
+	var reached time.Time
+	for {
+		if current, err := status(); err == nil {
+			last = current
+		}
+		now := time.Now()
+		switch {
+		case last == desired:
+			if reached.IsZero() {
+				reached = now
+			}
+			if now.Sub(reached) >= settle {
+				return last, nil
+			}
+		case !reached.IsZero():
+			return last, fmt.Errorf("did not stay %s (status: %s)", desired, last)
+		case now.After(deadline):
+			return last, fmt.Errorf("not %s after %v (status: %s)", desired, timeout, last)
+		}
+
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case <-time.After(serviceVerifyInterval):
+		}
+	}
+}
+
+// desiredServiceState returns the status an action should leave a service
+// in and how long it must hold
+func desiredServiceState(action string) (string, time.Duration) {
+	if action == "stop" {
+		return ServiceStatusStopped, 0
+	}
+	return ServiceStatusRunning, serviceSettleTime
+}
+
 // ServiceStatus represents the status of a system service
 // This structure is shared across all platforms (Windows, Linux, FreeBSD)
 type ServiceStatus struct {
 	Name   string `json:"name"`
 	Status string `json:"status"` // One of the ServiceStatus* constants below
+
+	Availability *ServiceAvailability `json:"availability,omitempty"` // tasks.service_check.availability; stamped by the scheduler
 }
 
 // ServiceStatusMessage is the telemetry payload for a service check.
 // Code/Location are stamped by the scheduler before publishing.
 type ServiceStatusMessage struct {
-	Code     string          `json:"code"`
-	Location string          `json:"location"`
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
 	Services []ServiceStatus `json:"services"`
+	IIS      []IISStatus     `json:"iis,omitempty"` // Whitelisted app pools and sites (commands.iis)
 	TS       string          `json:"ts"`
 }
 
@@ -8,15 +8,28 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // ControlService manages rc.d services on FreeBSD
 func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
+	result, _, err := e.controlService(name, action, allowedServices, serviceCommandTimeout)
+	return result, err
+}
+
+// controlService runs action on name, then waits up to verifyTimeout for
+// the state it asked for. It returns the result, the last status seen and
+// an error if the action failed or the state wasn't reached.
+func (e *Executor) controlService(name, action string, allowedServices []string, verifyTimeout time.Duration) (string, string, error) {
 	// Validate service is in whitelist
 	if !isServiceAllowed(name, allowedServices) {
-		return "", fmt.Errorf("service not in allowed list: %s", name)
+		return "", "", fmt.Errorf("service not in allowed list: %s", name)
+	}
+	if err := e.Unavailable("cmd.service"); err != nil {
+		return "", "", err
 	}
 
 	e.logger.Info("Controlling rc.d service",
@@ -25,34 +38,57 @@ func (e *Executor) ControlService(name, action string, allowedServices []string)
 
 	// Validate action
 	switch action {
-	case "start", "stop", "restart":
+	case "start", "stop", "restart", "reload":
 		// Valid actions
 	default:
-		return "", fmt.Errorf("invalid action: %s (must be start, stop, or restart)", action)
+		return "", "", fmt.Errorf("invalid action: %s (must be start, stop, restart, or reload)", action)
 	}
 
-	// Execute service command
-	ctx, cancel := context.WithTimeout(context.Background(), serviceCommandTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "service", name, action)
+	if pidfile, ok := e.reloadPidfiles[name]; ok && action == "reload" {
+		// The rc.d script has no reload command; the daemon reloads on SIGHUP
+		if err := signalPidfile(pidfile, syscall.SIGHUP); err != nil {
+			return "", "", fmt.Errorf("reload %s: %w", name, err)
+		}
+	} else {
+		// Execute service command
+		ctx, cancel := context.WithTimeout(context.Background(), serviceCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "service", name, action)
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
 
-	err := cmd.Run()
+		err := cmd.Run()
+		if err != nil {
+			e.logger.Error("service command failed",
+				zap.Error(err),
+				zap.String("stderr", stderr.String()))
+			return "", "", fmt.Errorf("service %s %s failed: %w: %s", name, action, err, stderr.String())
+		}
+	}
+
+	// rc.d scripts return once the daemon is launched, before one that
+	// crashes on start has exited, so poll until the state sticks
+	status, err := e.verifyServiceState(name, action, verifyTimeout)
 	if err != nil {
-		e.logger.Error("service command failed",
-			zap.Error(err),
-			zap.String("stderr", stderr.String()))
-		return "", fmt.Errorf("service %s %s failed: %w: %s", name, action, err, stderr.String())
+		e.logger.Error("Service did not reach desired state",
+			zap.String("service", name),
+			zap.String("action", action),
+			zap.String("status", status),
+			zap.Error(err))
+		return "", status, fmt.Errorf("service %s %s: service %w", name, action, err)
 	}
 
-	return fmt.Sprintf("Service %s %s successfully", name, action), nil
+	return fmt.Sprintf("Service %s %s successfully (status: %s)", name, action, status), status, nil
 }
 
 // GetServiceStatuses retrieves status for all configured services
 func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
+	if err := e.Unavailable("tasks.service_check"); err != nil {
+		return nil, err
+	}
+
 	var statuses []ServiceStatus
 
 	for _, name := range services {
@@ -73,6 +109,18 @@ func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error
 	return statuses, nil
 }
 
+// CheckServiceManager lists the enabled rc.d services, for cmd.selftest
+func (e *Executor) CheckServiceManager() (string, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, serviceCommandTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "service", "-e").Output()
+	if err != nil {
+		return "", fmt.Errorf("service -e failed: %w", err)
+	}
+	return fmt.Sprintf("rc.d: %d enabled services", len(strings.Fields(string(output)))), nil
+}
+
 // getServiceStatus queries rc.d for service status
 func (e *Executor) getServiceStatus(name string) (*ServiceStatus, error) {
 	// Use 'service <name> status' for status check
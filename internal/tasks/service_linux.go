@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os/exec"
 	"strings"
+	"syscall"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,9 +16,20 @@ import (
 
 // ControlService manages systemd services on Linux
 func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
+	result, _, err := e.controlService(name, action, allowedServices, serviceCommandTimeout)
+	return result, err
+}
+
+// controlService runs action on name, then waits up to verifyTimeout for
+// the state it asked for. It returns the result, the last status seen and
+// an error if the action failed or the state wasn't reached.
+func (e *Executor) controlService(name, action string, allowedServices []string, verifyTimeout time.Duration) (string, string, error) {
 	// Validate service is in whitelist
 	if !isServiceAllowed(name, allowedServices) {
-		return "", fmt.Errorf("service not in allowed list: %s", name)
+		return "", "", fmt.Errorf("service not in allowed list: %s", name)
+	}
+	if err := e.Unavailable("cmd.service"); err != nil {
+		return "", "", err
 	}
 
 	e.logger.Info("Controlling systemd service",
@@ -25,48 +37,57 @@ func (e *Executor) ControlService(name, action string, allowedServices []string)
 		zap.String("action", action))
 
 	switch action {
-	case "start", "stop", "restart":
+	case "start", "stop", "restart", "reload":
 		// Valid actions
 	default:
-		return "", fmt.Errorf("invalid action: %s (must be start, stop, or restart)", action)
+		return "", "", fmt.Errorf("invalid action: %s (must be start, stop, restart, or reload)", action)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), serviceCommandTimeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "systemctl", action, name)
-
-	// Execute systemctl command
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	err := cmd.Run()
-	if err != nil {
-		e.logger.Error("systemctl command failed",
-			zap.Error(err),
-			zap.String("stderr", stderr.String()))
-		return "", fmt.Errorf("systemctl %s %s failed: %w: %s", action, name, err, stderr.String())
-	}
+	if pidfile, ok := e.reloadPidfiles[name]; ok && action == "reload" {
+		// The unit has no ExecReload; the daemon reloads on SIGHUP
+		if err := signalPidfile(pidfile, syscall.SIGHUP); err != nil {
+			return "", "", fmt.Errorf("reload %s: %w", name, err)
+		}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), serviceCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "systemctl", action, name)
 
-	// Wait briefly and verify the service reached desired state
-	time.Sleep(500 * time.Millisecond)
+		// Execute systemctl command
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
 
-	status, statusErr := e.getServiceStatus(name)
-	if statusErr != nil {
-		e.logger.Warn("Failed to verify service status after action",
-			zap.Error(statusErr))
+		err := cmd.Run()
+		if err != nil {
+			e.logger.Error("systemctl command failed",
+				zap.Error(err),
+				zap.String("stderr", stderr.String()))
+			return "", "", fmt.Errorf("systemctl %s %s failed: %w: %s", action, name, err, stderr.String())
+		}
 	}
 
-	result := fmt.Sprintf("Service %s %s successfully", name, action)
-	if statusErr == nil {
-		result += fmt.Sprintf(" (status: %s)", status.Status)
+	// systemctl returns once the job is queued or done, before a unit that
+	// crashes on start has failed, so poll until the state sticks
+	status, err := e.verifyServiceState(name, action, verifyTimeout)
+	if err != nil {
+		e.logger.Error("Service did not reach desired state",
+			zap.String("service", name),
+			zap.String("action", action),
+			zap.String("status", status),
+			zap.Error(err))
+		return "", status, fmt.Errorf("systemctl %s %s: service %w", action, name, err)
 	}
 
-	return result, nil
+	return fmt.Sprintf("Service %s %s successfully (status: %s)", name, action, status), status, nil
 }
 
 // GetServiceStatuses retrieves status for all configured services
 func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
+	if err := e.Unavailable("tasks.service_check"); err != nil {
+		return nil, err
+	}
+
 	var statuses []ServiceStatus
 
 	for _, name := range services {
@@ -87,6 +108,24 @@ func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error
 	return statuses, nil
 }
 
+// CheckServiceManager asks systemd for the system state, for cmd.selftest.
+// A degraded system still answers, so only no answer fails the check.
+func (e *Executor) CheckServiceManager() (string, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, serviceCommandTimeout)
+	defer cancel()
+
+	// Exits non-zero for any state but running, so judge by the output
+	output, err := exec.CommandContext(ctx, "systemctl", "is-system-running").Output()
+	state := strings.TrimSpace(string(output))
+	if state == "" || state == "offline" {
+		if err == nil {
+			err = fmt.Errorf("no system state reported")
+		}
+		return "", fmt.Errorf("systemd unreachable: %w", err)
+	}
+	return "systemd: " + state, nil
+}
+
 // getServiceStatus queries systemd for service status
 func (e *Executor) getServiceStatus(name string) (*ServiceStatus, error) {
 	// Use systemctl show for machine-readable output
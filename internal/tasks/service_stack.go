@@ -0,0 +1,96 @@
+package tasks
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"go.uber.org/zap"
+)
+
+// ServiceStep is one service restarted by RestartServiceStack
+type ServiceStep struct {
+	Service    string `json:"service"`
+	Status     string `json:"status,omitempty"` // Last status seen after the restart
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ServiceDependents returns the services depending on name, directly or
+// not, in restart order: each after all of its dependencies. Ties keep
+// the order of commands.service_dependencies.services.
+func ServiceDependents(name string, deps []config.ServiceDependency) []string {
+	// Services affected by restarting name
+	affected := map[string]bool{name: true}
+	for changed := true; changed; {
+		changed = false
+		for _, dep := range deps {
+			if affected[dep.Service] {
+				continue
+			}
+			for _, parent := range dep.DependsOn {
+				if affected[parent] {
+					affected[dep.Service] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	// Each pass picks the first service none of whose affected dependencies
+	// is pending. Config validation rules out cycles, so one always is.
+	restarted := map[string]bool{name: true}
+	var order []string
+	for len(restarted) < len(affected) {
+		for _, dep := range deps {
+			if !affected[dep.Service] || restarted[dep.Service] {
+				continue
+			}
+			ready := !slices.ContainsFunc(dep.DependsOn, func(parent string) bool {
+				return affected[parent] && !restarted[parent]
+			})
+			if ready {
+				restarted[dep.Service] = true
+				order = append(order, dep.Service)
+				break
+			}
+		}
+	}
+	return order
+}
+
+// RestartServiceStack restarts name and then its dependents in order,
+// waiting up to deps.VerifyTimeout for each to be running (and to stay
+// running, see serviceSettleTime) before moving on. It stops at the first
+// service that fails to restart or run, returning the steps taken so far
+// with the error.
+func (e *Executor) RestartServiceStack(name string, deps config.ServiceDependenciesConfig, allowedServices []string) ([]ServiceStep, error) {
+	services := append([]string{name}, ServiceDependents(name, deps.Services)...)
+	e.logger.Info("Restarting service with its dependents",
+		zap.String("service", name),
+		zap.Strings("order", services))
+
+	var steps []ServiceStep
+	for _, service := range services {
+		start := time.Now()
+		step := ServiceStep{Service: service}
+		var err error
+		_, step.Status, err = e.controlService(service, "restart", allowedServices, deps.VerifyTimeout)
+		step.DurationMS = time.Since(start).Milliseconds()
+		if err != nil {
+			step.Error = err.Error()
+			steps = append(steps, step)
+			if len(steps) < len(services) {
+				e.logger.Warn("Stopping dependent restarts",
+					zap.String("service", service),
+					zap.Strings("skipped", services[len(steps):]),
+					zap.Error(err))
+			}
+			return steps, fmt.Errorf("restart of %s failed: %w", service, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
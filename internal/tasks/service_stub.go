@@ -2,14 +2,27 @@
 
 package tasks
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // ControlService is a stub for unsupported platforms
 func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
 	return "", fmt.Errorf("service control not supported on this platform")
 }
 
+// controlService is a stub for unsupported platforms
+func (e *Executor) controlService(name, action string, allowedServices []string, verifyTimeout time.Duration) (string, string, error) {
+	return "", "", fmt.Errorf("service control not supported on this platform")
+}
+
 // GetServiceStatuses is a stub for unsupported platforms
 func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error) {
 	return nil, fmt.Errorf("service status not supported on this platform")
 }
+
+// CheckServiceManager is a stub for unsupported platforms
+func (e *Executor) CheckServiceManager() (string, error) {
+	return "", SkipCheck("service control not supported on this platform")
+}
@@ -2,9 +2,13 @@ package tasks
 
 import (
 	"context"
+	"errors"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/stone-age-io/agent/internal/config"
 	"go.uber.org/zap"
 )
 
@@ -195,3 +199,73 @@ func TestControlService(t *testing.T) {
 		})
 	}
 }
+
+// TestServiceDependents tests that dependents come after all of their
+// dependencies and that unrelated services are left alone
+func TestServiceDependents(t *testing.T) {
+	deps := []config.ServiceDependency{
+		{Service: "app-worker", DependsOn: []string{"app-api", "redis"}},
+		{Service: "app-api", DependsOn: []string{"postgresql"}},
+		{Service: "app-web", DependsOn: []string{"app-api"}},
+		{Service: "metrics", DependsOn: []string{"redis"}},
+	}
+
+	tests := []struct {
+		service string
+		want    []string
+	}{
+		{"postgresql", []string{"app-api", "app-worker", "app-web"}},
+		{"app-api", []string{"app-worker", "app-web"}},
+		{"redis", []string{"app-worker", "metrics"}},
+		{"app-web", nil},
+		{"nginx", nil},
+	}
+
+	for _, tt := range tests {
+		if got := ServiceDependents(tt.service, deps); !slices.Equal(got, tt.want) {
+			t.Errorf("ServiceDependents(%q) = %v, want %v", tt.service, got, tt.want)
+		}
+	}
+}
+
+// TestWaitServiceState tests that a service must reach the desired state
+// and, with a settle time, keep it
+func TestWaitServiceState(t *testing.T) {
+	sequence := func(statuses ...string) func() (string, error) {
+		return func() (string, error) {
+			status := statuses[0]
+			if len(statuses) > 1 {
+				statuses = statuses[1:]
+			}
+			return status, nil
+		}
+	}
+
+	tests := []struct {
+		name       string
+		status     func() (string, error)
+		desired    string
+		timeout    time.Duration
+		settle     time.Duration
+		wantStatus string
+		wantErr    bool
+	}{
+		{"stopped", sequence(ServiceStatusStopping, ServiceStatusStopped), ServiceStatusStopped, time.Second, 0, ServiceStatusStopped, false},
+		{"running", sequence(ServiceStatusRunning), ServiceStatusRunning, time.Second, 500 * time.Millisecond, ServiceStatusRunning, false},
+		{"crash loop", sequence(ServiceStatusRunning, ServiceStatusStarting, ServiceStatusRunning), ServiceStatusRunning, 5 * time.Second, time.Second, ServiceStatusStarting, true},
+		{"never started", sequence(ServiceStatusError), ServiceStatusRunning, 100 * time.Millisecond, 0, ServiceStatusError, true},
+		{"no status", func() (string, error) { return "", errors.New("systemctl show failed") }, ServiceStatusRunning, 100 * time.Millisecond, 0, ServiceStatusUnknown, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := waitServiceState(context.Background(), tt.status, tt.desired, tt.timeout, tt.settle)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("waitServiceState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("waitServiceState() status = %q, want %q", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux || freebsd
+
+package tasks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// signalPidfile sends sig to the process whose PID is the first word of
+// pidfile, for commands.reload_pidfiles
+func signalPidfile(pidfile string, sig syscall.Signal) error {
+	data, err := os.ReadFile(pidfile)
+	if err != nil {
+		return fmt.Errorf("failed to read pidfile: %w", err)
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return fmt.Errorf("pidfile %s is empty", pidfile)
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 1 {
+		return fmt.Errorf("pidfile %s holds no valid PID (got: %q)", pidfile, fields[0])
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("failed to signal PID %d from %s: %w", pid, pidfile, err)
+	}
+	return nil
+}
+
+// verifyServiceState waits up to timeout for name to reach the state action
+// asked for, returning its last status
+func (e *Executor) verifyServiceState(name, action string, timeout time.Duration) (string, error) {
+	desired, settle := desiredServiceState(action)
+	return waitServiceState(e.ctx, func() (string, error) {
+		status, err := e.getServiceStatus(name)
+		if err != nil {
+			return "", err
+		}
+		return status.Status, nil
+	}, desired, timeout, settle)
+}
@@ -0,0 +1,45 @@
+//go:build linux || freebsd
+
+package tasks
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// TestSignalPidfile tests reading the PID from a pidfile. Signal 0 only
+// checks that the process exists.
+func TestSignalPidfile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		pidfile string
+		wantErr bool
+	}{
+		{"running", write("self.pid", strconv.Itoa(os.Getpid())+"\n"), false},
+		{"extra lines", write("multi.pid", strconv.Itoa(os.Getpid())+"\nworker\n"), false},
+		{"missing", filepath.Join(dir, "missing.pid"), true},
+		{"empty", write("empty.pid", "\n"), true},
+		{"not a number", write("text.pid", "nginx\n"), true},
+		{"init", write("init.pid", "1\n"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signalPidfile(tt.pidfile, syscall.Signal(0)); (err != nil) != tt.wantErr {
+				t.Errorf("signalPidfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
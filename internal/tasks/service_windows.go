@@ -13,26 +13,40 @@ import (
 
 // ControlService manages Windows services using the Windows Service Control Manager API
 func (e *Executor) ControlService(name, action string, allowedServices []string) (string, error) {
+	result, _, err := e.controlService(name, action, allowedServices, 0)
+	return result, err
+}
+
+// controlService runs action on name. With a verifyTimeout, it then waits
+// that long for the state the action asked for, as restarts of dependent
+// services do. It returns the result, the last status seen ("" when not
+// verified) and an error if the action failed or the state wasn't reached.
+func (e *Executor) controlService(name, action string, allowedServices []string, verifyTimeout time.Duration) (string, string, error) {
 	// Validate service is in whitelist
 	if !isServiceAllowed(name, allowedServices) {
-		return "", fmt.Errorf("service not in allowed list: %s", name)
+		return "", "", fmt.Errorf("service not in allowed list: %s", name)
 	}
 
 	e.logger.Info("Controlling Windows service",
 		zap.String("service", name),
 		zap.String("action", action))
 
+	// The SCM has no reload control; services reload only through their own tools
+	if action == "reload" {
+		return "", "", fmt.Errorf("reload is not supported for Windows services (use restart)")
+	}
+
 	// Connect to service manager
 	m, err := mgr.Connect()
 	if err != nil {
-		return "", fmt.Errorf("failed to connect to service manager: %w", err)
+		return "", "", fmt.Errorf("failed to connect to service manager: %w", err)
 	}
 	defer m.Disconnect()
 
 	// Open service
 	s, err := m.OpenService(name)
 	if err != nil {
-		return "", fmt.Errorf("failed to open service %s: %w", name, err)
+		return "", "", fmt.Errorf("failed to open service %s: %w", name, err)
 	}
 	defer s.Close()
 
@@ -41,54 +55,68 @@ func (e *Executor) ControlService(name, action string, allowedServices []string)
 	case "start":
 		err = s.Start()
 		if err != nil {
-			return "", fmt.Errorf("failed to start service: %w", err)
+			return "", "", fmt.Errorf("failed to start service: %w", err)
 		}
 	case "stop":
 		// Send stop control and wait for service to stop
 		status, err := s.Control(svc.Stop)
 		if err != nil {
-			return "", fmt.Errorf("failed to stop service: %w", err)
+			return "", "", fmt.Errorf("failed to stop service: %w", err)
 		}
 		// Wait for service to stop (with timeout)
 		timeout := time.Now().Add(30 * time.Second)
 		for status.State != svc.Stopped {
 			if time.Now().After(timeout) {
-				return "", fmt.Errorf("timeout waiting for service to stop")
+				return "", "", fmt.Errorf("timeout waiting for service to stop")
 			}
 			time.Sleep(300 * time.Millisecond)
 			status, err = s.Query()
 			if err != nil {
-				return "", fmt.Errorf("failed to query service status: %w", err)
+				return "", "", fmt.Errorf("failed to query service status: %w", err)
 			}
 		}
 	case "restart":
 		// Stop the service first
 		status, err := s.Control(svc.Stop)
 		if err != nil {
-			return "", fmt.Errorf("failed to stop service for restart: %w", err)
+			return "", "", fmt.Errorf("failed to stop service for restart: %w", err)
 		}
 		// Wait for service to stop
 		timeout := time.Now().Add(30 * time.Second)
 		for status.State != svc.Stopped {
 			if time.Now().After(timeout) {
-				return "", fmt.Errorf("timeout waiting for service to stop during restart")
+				return "", "", fmt.Errorf("timeout waiting for service to stop during restart")
 			}
 			time.Sleep(300 * time.Millisecond)
 			status, err = s.Query()
 			if err != nil {
-				return "", fmt.Errorf("failed to query service status during restart: %w", err)
+				return "", "", fmt.Errorf("failed to query service status during restart: %w", err)
 			}
 		}
 		// Start the service
 		err = s.Start()
 		if err != nil {
-			return "", fmt.Errorf("failed to start service after stop: %w", err)
+			return "", "", fmt.Errorf("failed to start service after stop: %w", err)
 		}
 	default:
-		return "", fmt.Errorf("invalid action: %s (must be start, stop, or restart)", action)
+		return "", "", fmt.Errorf("invalid action: %s (must be start, stop, restart, or reload)", action)
 	}
 
-	return fmt.Sprintf("Service %s %s successfully", name, action), nil
+	if verifyTimeout <= 0 {
+		return fmt.Sprintf("Service %s %s successfully", name, action), "", nil
+	}
+	desired, settle := desiredServiceState(action)
+	status, err := waitServiceState(e.ctx, func() (string, error) {
+		status, err := e.getServiceStatus(m, name)
+		if err != nil {
+			return "", err
+		}
+		return status.Status, nil
+	}, desired, verifyTimeout, settle)
+	if err != nil {
+		return "", status, fmt.Errorf("service %s %s: service %w", name, action, err)
+	}
+	return fmt.Sprintf("Service %s %s successfully (status: %s)", name, action, status), status, nil
 }
 
 // GetServiceStatuses retrieves status for all configured services
@@ -120,6 +148,22 @@ func (e *Executor) GetServiceStatuses(services []string) ([]ServiceStatus, error
 	return statuses, nil
 }
 
+// CheckServiceManager connects to the Service Control Manager and lists
+// services, for cmd.selftest
+func (e *Executor) CheckServiceManager() (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	services, err := m.ListServices()
+	if err != nil {
+		return "", fmt.Errorf("failed to list services: %w", err)
+	}
+	return fmt.Sprintf("SCM: %d services", len(services)), nil
+}
+
 // getServiceStatus queries Windows Service Control Manager for service status
 func (e *Executor) getServiceStatus(m *mgr.Mgr, name string) (*ServiceStatus, error) {
 	s, err := m.OpenService(name)
@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startupDialTimeout bounds one connection attempt to a startup target
+const startupDialTimeout = 5 * time.Second
+
+// startupInitialBackoff is the first retry delay; it doubles up to the
+// configured maximum
+const startupInitialBackoff = time.Second
+
+// StartupTarget is an endpoint the agent needs at startup. It is ready once
+// any of its addresses resolves and accepts a TCP connection.
+type StartupTarget struct {
+	Name  string   // nats, bootstrap or exporter
+	Addrs []string // host:port
+}
+
+// dialFunc opens a connection, as net.Dialer.DialContext does
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// StartupTargetFromURLs returns the target for the host:port of each URL.
+// URLs that don't parse are skipped; connecting to them reports the error.
+func StartupTargetFromURLs(name string, urls ...string) StartupTarget {
+	target := StartupTarget{Name: name}
+	for _, raw := range urls {
+		if addr := urlHostPort(raw); addr != "" {
+			target.Addrs = append(target.Addrs, addr)
+		}
+	}
+	return target
+}
+
+// urlHostPort returns host:port of a URL, filling in the scheme's default
+// port. NATS URLs may omit the scheme.
+func urlHostPort(raw string) string {
+	if !strings.Contains(raw, "://") {
+		raw = "nats://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "4222" // nats, tls
+	switch strings.ToLower(u.Scheme) {
+	case "http", "ws":
+		port = "80"
+	case "https", "wss":
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// WaitForStartup waits until every target is reachable, retrying with a
+// backoff doubling up to maxBackoff, for at most timeout. It returns the
+// targets still unreachable when time ran out; the agent then starts anyway
+// and lets the usual error handling report them.
+func WaitForStartup(ctx context.Context, targets []StartupTarget, timeout, maxBackoff time.Duration, logger *zap.Logger) []string {
+	dialer := &net.Dialer{Timeout: startupDialTimeout}
+	return waitForStartup(ctx, targets, timeout, maxBackoff, dialer.DialContext, logger)
+}
+
+func waitForStartup(ctx context.Context, targets []StartupTarget, timeout, maxBackoff time.Duration, dial dialFunc, logger *zap.Logger) []string {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	backoff := startupInitialBackoff
+	pending := targets
+	for attempt := 1; ; attempt++ {
+		var waiting []StartupTarget
+		for _, target := range pending {
+			if err := reachTarget(ctx, target, dial); err != nil {
+				if attempt == 1 {
+					logger.Info("Waiting for startup dependency", zap.String("target", target.Name), zap.Error(err))
+				} else {
+					logger.Debug("Startup dependency not reachable yet",
+						zap.String("target", target.Name),
+						zap.Int("attempt", attempt),
+						zap.Error(err))
+				}
+				waiting = append(waiting, target)
+			} else if attempt > 1 {
+				logger.Info("Startup dependency reachable",
+					zap.String("target", target.Name),
+					zap.Duration("waited", time.Since(start).Round(time.Second)))
+			}
+		}
+		pending = waiting
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			names := make([]string, len(pending))
+			for i, target := range pending {
+				names[i] = target.Name
+			}
+			return names
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// reachTarget connects to each of the target's addresses until one
+// answers
+func reachTarget(ctx context.Context, target StartupTarget, dial dialFunc) error {
+	if len(target.Addrs) == 0 {
+		return fmt.Errorf("no address to check")
+	}
+	var firstErr error
+	for _, addr := range target.Addrs {
+		conn, err := dial(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
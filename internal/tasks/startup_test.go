@@ -0,0 +1,108 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// TestURLHostPort tests default ports per scheme and schemeless NATS URLs
+func TestURLHostPort(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"nats://nats.example.com:4222", "nats.example.com:4222"},
+		{"nats.example.com", "nats.example.com:4222"},
+		{"tls://10.0.0.1", "10.0.0.1:4222"},
+		{"https://pb.example.com", "pb.example.com:443"},
+		{"http://localhost:9100/metrics", "localhost:9100"},
+		{"ws://[::1]", "[::1]:80"},
+		{"", ""},
+		{"https://", ""},
+	}
+
+	for _, tt := range tests {
+		if got := urlHostPort(tt.raw); got != tt.want {
+			t.Errorf("urlHostPort(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+// TestWaitForStartup tests that targets are retried until reachable and
+// that the ones still down when the wait runs out are returned
+func TestWaitForStartup(t *testing.T) {
+	failUntil := func(addr string, attempts int) dialFunc {
+		calls := 0
+		return func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address != addr {
+				return nil, errors.New("connection refused")
+			}
+			calls++
+			if calls < attempts {
+				return nil, errors.New("network is unreachable")
+			}
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		}
+	}
+
+	tests := []struct {
+		name    string
+		targets []StartupTarget
+		timeout time.Duration
+		dial    dialFunc
+		want    []string
+	}{
+		{
+			name:    "reachable at once",
+			targets: []StartupTarget{{Name: "nats", Addrs: []string{"nats:4222"}}},
+			timeout: time.Second,
+			dial:    failUntil("nats:4222", 1),
+		},
+		{
+			name:    "any address will do",
+			targets: []StartupTarget{{Name: "nats", Addrs: []string{"a:4222", "b:4222"}}},
+			timeout: time.Second,
+			dial:    failUntil("b:4222", 1),
+		},
+		{
+			name:    "reachable after a retry",
+			targets: []StartupTarget{{Name: "nats", Addrs: []string{"nats:4222"}}},
+			timeout: 5 * time.Second,
+			dial:    failUntil("nats:4222", 2),
+		},
+		{
+			name: "timed out",
+			targets: []StartupTarget{
+				{Name: "nats", Addrs: []string{"nats:4222"}},
+				{Name: "exporter", Addrs: []string{"localhost:9100"}},
+			},
+			timeout: 50 * time.Millisecond,
+			dial:    failUntil("nats:4222", 1),
+			want:    []string{"exporter"},
+		},
+		{
+			name:    "no addresses",
+			targets: []StartupTarget{{Name: "bootstrap"}},
+			timeout: 50 * time.Millisecond,
+			dial:    failUntil("", 1),
+			want:    []string{"bootstrap"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := waitForStartup(context.Background(), tt.targets, tt.timeout, time.Second, tt.dial, zap.NewNop())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("unreachable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
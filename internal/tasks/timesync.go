@@ -0,0 +1,257 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeSyncRefresh is how long a reading is reused, so a heartbeat every
+// few seconds doesn't run the time service's client each time
+const timeSyncRefresh = 5 * time.Minute
+
+// TimeSync is whether the clock follows a time server, from the device's
+// time service (tasks.heartbeat.time_sync). An unsynchronized clock breaks
+// certificate validation and event correlation.
+type TimeSync struct {
+	Service      string  `json:"service,omitempty"` // chrony, ntpd, systemd-timesyncd or w32time
+	Source       string  `json:"source,omitempty"`  // Server the clock follows, e.g. "192.168.1.1" or "time.windows.com"
+	Synchronized bool    `json:"synchronized"`
+	Stratum      int     `json:"stratum,omitempty"`
+	OffsetMs     float64 `json:"offset_ms,omitempty"` // Local clock ahead (+) or behind (-) the source
+	Error        string  `json:"error,omitempty"`     // Why no time service could be read
+}
+
+// timeSyncCache holds the last reading for timeSyncRefresh
+type timeSyncCache struct {
+	mu   sync.Mutex
+	last *TimeSync
+	at   time.Time
+}
+
+// TimeSync returns the clock's sync state, read at most every
+// timeSyncRefresh
+func (e *Executor) TimeSync(ctx context.Context) *TimeSync {
+	e.timeSync.mu.Lock()
+	defer e.timeSync.mu.Unlock()
+	if e.timeSync.last != nil && time.Since(e.timeSync.at) < timeSyncRefresh {
+		return e.timeSync.last
+	}
+	e.timeSync.last = readTimeSync(ctx, runTool, runtime.GOOS)
+	e.timeSync.at = time.Now()
+	return e.timeSync.last
+}
+
+// readTimeSync asks w32time on Windows; elsewhere chrony, then ntpd, then
+// systemd-timesyncd (Linux), using the first that answers
+func readTimeSync(ctx context.Context, run toolRunner, goos string) *TimeSync {
+	if goos == "windows" {
+		out, err := run(ctx, "w32tm", "/query", "/status", "/verbose")
+		if err != nil {
+			return &TimeSync{Service: "w32time", Error: err.Error()}
+		}
+		status, err := parseW32tmStatus(out)
+		if err != nil {
+			return &TimeSync{Service: "w32time", Error: err.Error()}
+		}
+		return status
+	}
+
+	type reader struct {
+		service string
+		read    func() (*TimeSync, error)
+	}
+	readers := []reader{
+		{"chrony", func() (*TimeSync, error) {
+			out, err := run(ctx, "chronyc", "-n", "tracking")
+			if err != nil {
+				return nil, err
+			}
+			return parseChronyTracking(out)
+		}},
+		{"ntpd", func() (*TimeSync, error) {
+			out, err := run(ctx, "ntpq", "-pn")
+			if err != nil {
+				return nil, err
+			}
+			return parseNtpqPeers(out)
+		}},
+	}
+	if goos == "linux" {
+		readers = append(readers, reader{"systemd-timesyncd", func() (*TimeSync, error) {
+			return readTimesyncd(ctx, run)
+		}})
+	}
+
+	// A client that is installed but can't reach its daemon is the likely
+	// answer if no other service is running, so its error is kept
+	var firstErr error
+	for _, r := range readers {
+		status, err := r.read()
+		if err == nil {
+			status.Service = r.service
+			return status
+		}
+		if firstErr == nil && !errors.Is(err, exec.ErrNotFound) {
+			firstErr = fmt.Errorf("%s: %w", r.service, err)
+		}
+	}
+	if firstErr == nil {
+		firstErr = errors.New("no time service found (chrony, ntpd or systemd-timesyncd)")
+	}
+	return &TimeSync{Error: firstErr.Error()}
+}
+
+// parseChronyTracking parses chronyc -n tracking:
+//
+//	Reference ID    : C0A80101 (192.168.1.1)
+//	Stratum         : 3
+//	System time     : 0.000012345 seconds fast of NTP time
+//	Leap status     : Normal
+func parseChronyTracking(out string) (*TimeSync, error) {
+	fields := colonFields(out)
+	leap, ok := fields["Leap status"]
+	if !ok {
+		return nil, errors.New("no leap status in chronyc tracking output")
+	}
+
+	status := &TimeSync{Synchronized: leap != "Not synchronised"}
+	if ref := fields["Reference ID"]; ref != "" {
+		if open := strings.Index(ref, "("); open >= 0 {
+			ref = strings.TrimSuffix(ref[open+1:], ")")
+		}
+		status.Source = ref
+	}
+	status.Stratum, _ = strconv.Atoi(fields["Stratum"])
+
+	// "0.000012345 seconds fast of NTP time" or "... slow of NTP time"
+	if parts := strings.Fields(fields["System time"]); len(parts) >= 3 {
+		if seconds, err := strconv.ParseFloat(parts[0], 64); err == nil {
+			if parts[2] == "slow" {
+				seconds = -seconds
+			}
+			status.OffsetMs = roundMs(seconds * 1000)
+		}
+	}
+	if !status.Synchronized {
+		status.Source = ""
+	}
+	return status, nil
+}
+
+// parseNtpqPeers parses ntpq -pn. The peer marked '*' is the one the clock
+// follows; without one the clock isn't synchronized.
+//
+//	     remote           refid      st t when poll reach   delay   offset  jitter
+//	==============================================================================
+//	*192.168.1.1     .GPS.            1 u   33   64  377    0.512   -0.123   0.045
+func parseNtpqPeers(out string) (*TimeSync, error) {
+	if !strings.Contains(out, "remote") {
+		return nil, errors.New("unrecognized ntpq output")
+	}
+	status := &TimeSync{}
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "*") {
+			continue
+		}
+		fields := strings.Fields(line[1:])
+		if len(fields) < 9 {
+			continue
+		}
+		status.Synchronized = true
+		status.Source = fields[0]
+		status.Stratum, _ = strconv.Atoi(fields[2])
+		if offset, err := strconv.ParseFloat(fields[8], 64); err == nil {
+			status.OffsetMs = roundMs(offset)
+		}
+		break
+	}
+	return status, nil
+}
+
+// readTimesyncd asks timedatectl whether systemd-timesyncd has synchronized
+// the clock, and from which server
+func readTimesyncd(ctx context.Context, run toolRunner) (*TimeSync, error) {
+	out, err := run(ctx, "timedatectl", "show", "-p", "NTP", "-p", "NTPSynchronized")
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			fields[key] = value
+		}
+	}
+	if fields["NTP"] != "yes" {
+		return nil, errors.New("systemd-timesyncd is not enabled")
+	}
+
+	status := &TimeSync{Synchronized: fields["NTPSynchronized"] == "yes"}
+	if status.Synchronized {
+		// show-timesync needs systemd 239; the server is optional
+		if server, err := run(ctx, "timedatectl", "show-timesync", "-p", "ServerName", "--value"); err == nil {
+			status.Source = strings.TrimSpace(server)
+		}
+	}
+	return status, nil
+}
+
+// parseW32tmStatus parses w32tm /query /status /verbose. Labels are those
+// of an English Windows install.
+//
+//	Leap Indicator: 0(no warning)
+//	Stratum: 4 (secondary reference - syncd by (S)NTP)
+//	Source: time.windows.com,0x9
+//	Phase Offset: 0.0001234s
+func parseW32tmStatus(out string) (*TimeSync, error) {
+	fields := colonFields(out)
+	leap, ok := fields["Leap Indicator"]
+	if !ok {
+		return nil, errors.New("unrecognized w32tm output (expects English labels)")
+	}
+
+	status := &TimeSync{Service: "w32time"}
+	stratum, _, _ := strings.Cut(fields["Stratum"], " ") // "4 (secondary reference ...)"
+	status.Stratum, _ = strconv.Atoi(stratum)
+	source, _, _ := strings.Cut(fields["Source"], ",") // "time.windows.com,0x9"
+	status.Source = strings.TrimSpace(source)
+
+	// Leap indicator 3 means not synchronized; the local CMOS clock and a
+	// free-running clock are no time server either
+	switch {
+	case strings.HasPrefix(leap, "3"), status.Stratum == 0,
+		strings.EqualFold(status.Source, "Local CMOS Clock"),
+		strings.EqualFold(status.Source, "Free-running System Clock"):
+		status.Source = ""
+	default:
+		status.Synchronized = true
+	}
+
+	if offset, err := strconv.ParseFloat(strings.TrimSuffix(fields["Phase Offset"], "s"), 64); err == nil {
+		status.OffsetMs = roundMs(offset * 1000)
+	}
+	return status, nil
+}
+
+// colonFields splits "Key : Value" lines into a map, trimming both sides
+func colonFields(out string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return fields
+}
+
+// roundMs rounds an offset to microseconds, in milliseconds
+func roundMs(ms float64) float64 {
+	return math.Round(ms*1000) / 1000
+}
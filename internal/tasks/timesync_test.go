@@ -0,0 +1,102 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const chronyTracking = `Reference ID    : C0A80101 (192.168.1.1)
+Stratum         : 3
+Ref time (UTC)  : Thu Oct 15 09:12:03 2026
+System time     : 0.000412345 seconds slow of NTP time
+Last offset     : -0.000021000 seconds
+Leap status     : Normal
+`
+
+const chronyUnsynced = `Reference ID    : 00000000 ()
+Stratum         : 0
+System time     : 0.000000000 seconds fast of NTP time
+Leap status     : Not synchronised
+`
+
+const ntpqPeers = `     remote           refid      st t when poll reach   delay   offset  jitter
+==============================================================================
++10.0.0.2        .PPS.            1 u   40   64  377    0.701    0.210   0.050
+*10.0.0.1        .GPS.            1 u   33   64  377    0.512   -0.123   0.045
+`
+
+const w32tmStatus = `Leap Indicator: 0(no warning)
+Stratum: 4 (secondary reference - syncd by (S)NTP)
+Precision: -23 (119.209ns per tick)
+ReferenceId: 0x14650039 (source IP:  20.101.57.9)
+Last Successful Sync Time: 10/15/2026 9:12:03 AM
+Source: time.windows.com,0x9
+Poll Interval: 10 (1024s)
+Phase Offset: 0.0012500s
+`
+
+// TestParseTimeSync tests each time service's output
+func TestParseTimeSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) (*TimeSync, error)
+		out   string
+		want  TimeSync
+	}{
+		{"chrony", parseChronyTracking, chronyTracking, TimeSync{Source: "192.168.1.1", Synchronized: true, Stratum: 3, OffsetMs: -0.412}},
+		{"chrony unsynced", parseChronyTracking, chronyUnsynced, TimeSync{}},
+		{"ntpq", parseNtpqPeers, ntpqPeers, TimeSync{Source: "10.0.0.1", Synchronized: true, Stratum: 1, OffsetMs: -0.123}},
+		{"ntpq no peer", parseNtpqPeers, strings.Replace(ntpqPeers, "*", " ", 1), TimeSync{}},
+		{"w32tm", parseW32tmStatus, w32tmStatus, TimeSync{Service: "w32time", Source: "time.windows.com", Synchronized: true, Stratum: 4, OffsetMs: 1.25}},
+		{"w32tm cmos", parseW32tmStatus, "Leap Indicator: 3(not synchronized)\nStratum: 0 (unspecified)\nSource: Local CMOS Clock\n", TimeSync{Service: "w32time"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(tt.out)
+			if err != nil {
+				t.Fatalf("parse error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseW32tmStatus("Indicateur de saut : 0\n"); err == nil {
+		t.Error("parseW32tmStatus() of unrecognized output, want error")
+	}
+}
+
+// TestReadTimeSync tests falling through to the first service that answers
+func TestReadTimeSync(t *testing.T) {
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		switch name {
+		case "chronyc":
+			return "", fmt.Errorf("chronyc failed: %w", exec.ErrNotFound)
+		case "ntpq":
+			return "", fmt.Errorf("ntpq failed: connection refused")
+		case "timedatectl":
+			if args[0] == "show-timesync" {
+				return "ntp.ubuntu.com\n", nil
+			}
+			return "NTP=yes\nNTPSynchronized=yes\n", nil
+		}
+		return "", exec.ErrNotFound
+	}
+
+	got := readTimeSync(context.Background(), run, "linux")
+	want := TimeSync{Service: "systemd-timesyncd", Source: "ntp.ubuntu.com", Synchronized: true}
+	if *got != want {
+		t.Errorf("readTimeSync() = %+v, want %+v", *got, want)
+	}
+
+	// Not on Linux: the ntpd client's error explains the missing answer
+	got = readTimeSync(context.Background(), run, "freebsd")
+	if got.Synchronized || !strings.HasPrefix(got.Error, "ntpd: ") {
+		t.Errorf("readTimeSync() = %+v, want the ntpd error", *got)
+	}
+}
@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// zoneinfoDir is where a zoneinfo path's zone name starts, e.g.
+// /usr/share/zoneinfo/Europe/Berlin
+const zoneinfoDir = "zoneinfo/"
+
+// localZoneName is read once: changing the system zone needs a restart of
+// the agent to take effect anyway, as Go loads time.Local at startup
+var localZoneName = sync.OnceValue(func() string {
+	return zoneName(os.Getenv("TZ"), os.Readlink, os.ReadFile, time.Local)
+})
+
+// LocalTimezone returns the device's time zone, as an IANA name where the
+// system records one (e.g. Europe/Berlin) or else its abbreviation, and
+// its current offset from UTC (e.g. +01:00), which changes with DST
+func LocalTimezone(now time.Time) (name, offset string) {
+	return localZoneName(), now.In(time.Local).Format("-07:00")
+}
+
+// zoneName finds the IANA name of the local zone: from TZ, the
+// /etc/localtime symlink (Linux, macOS), /etc/timezone (Debian) or
+// /var/db/zoneinfo (FreeBSD). Windows records none of these, so it falls
+// back to the zone's abbreviation.
+func zoneName(tz string, readlink func(string) (string, error), readFile func(string) ([]byte, error), loc *time.Location) string {
+	if tz = strings.TrimPrefix(tz, ":"); tz != "" {
+		if i := strings.LastIndex(tz, zoneinfoDir); i >= 0 {
+			tz = tz[i+len(zoneinfoDir):]
+		}
+		return tz
+	}
+	if target, err := readlink("/etc/localtime"); err == nil {
+		if i := strings.LastIndex(target, zoneinfoDir); i >= 0 {
+			return target[i+len(zoneinfoDir):]
+		}
+	}
+	for _, file := range []string{"/etc/timezone", "/var/db/zoneinfo"} {
+		if data, err := readFile(file); err == nil {
+			if name := strings.TrimSpace(string(data)); name != "" {
+				return name
+			}
+		}
+	}
+	abbreviation, _ := time.Now().In(loc).Zone()
+	return abbreviation
+}
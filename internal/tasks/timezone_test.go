@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestZoneName(t *testing.T) {
+	notFound := func(string) (string, error) { return "", errors.New("not found") }
+	noFile := func(string) ([]byte, error) { return nil, errors.New("not found") }
+	file := func(path, content string) func(string) ([]byte, error) {
+		return func(name string) ([]byte, error) {
+			if name == path {
+				return []byte(content), nil
+			}
+			return nil, errors.New("not found")
+		}
+	}
+	link := func(string) (string, error) { return "../usr/share/zoneinfo/America/New_York", nil }
+
+	tests := []struct {
+		name     string
+		tz       string
+		readlink func(string) (string, error)
+		readFile func(string) ([]byte, error)
+		want     string
+	}{
+		{"TZ", "Asia/Tokyo", link, noFile, "Asia/Tokyo"},
+		{"TZ file path", ":/usr/share/zoneinfo/Asia/Kolkata", link, noFile, "Asia/Kolkata"},
+		{"localtime symlink", "", link, noFile, "America/New_York"},
+		{"debian timezone file", "", notFound, file("/etc/timezone", "Europe/Berlin\n"), "Europe/Berlin"},
+		{"freebsd zoneinfo file", "", notFound, file("/var/db/zoneinfo", "Australia/Sydney\n"), "Australia/Sydney"},
+		{"abbreviation", "", notFound, noFile, "XYZ"},
+	}
+
+	loc := time.FixedZone("XYZ", 3*3600)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zoneName(tt.tz, tt.readlink, tt.readFile, loc); got != tt.want {
+				t.Errorf("zoneName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
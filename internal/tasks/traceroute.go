@@ -0,0 +1,226 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TracerouteTargetNATS traces the path to the connected NATS server
+const TracerouteTargetNATS = "nats"
+
+// TracerouteRequest is a cmd.traceroute request
+type TracerouteRequest struct {
+	Target  string `json:"target"`             // "nats" or a commands.traceroute.targets host
+	Mode    string `json:"mode,omitempty"`     // icmp (default), udp or tcp
+	Port    int    `json:"port,omitempty"`     // tcp only; default the NATS server's port for "nats", else 80
+	MaxHops int    `json:"max_hops,omitempty"` // Default and cap commands.traceroute.max_hops
+}
+
+// TracerouteHop is one hop of a traceroute
+type TracerouteHop struct {
+	Hop     int       `json:"hop"`
+	Address string    `json:"address,omitempty"` // First host to reply; empty if every probe was lost
+	RTTMs   []float64 `json:"rtt_ms"`            // One per reply; tracert's "<1 ms" is reported as 1
+	Lost    int       `json:"lost"`              // Probes without a reply
+	Note    string    `json:"note,omitempty"`    // e.g. !H (host unreachable) or tracert's "reports: ..."
+}
+
+// TracerouteResult is the path to a target
+type TracerouteResult struct {
+	Target      string          `json:"target"`
+	Destination string          `json:"destination"` // Address traced
+	Mode        string          `json:"mode"`
+	Port        int             `json:"port,omitempty"`
+	Hops        []TracerouteHop `json:"hops"`
+	Reached     bool            `json:"reached"`             // The last hop is the destination
+	TimedOut    bool            `json:"timed_out,omitempty"` // commands.timeout ended the trace; hops are partial
+	TS          string          `json:"ts"`
+}
+
+// Traceroute traces the path to the NATS server (natsURL, the connected
+// server) or a whitelisted host. A trace cut short by the command timeout
+// returns the hops found so far.
+func (e *Executor) Traceroute(req *TracerouteRequest, cfg *config.TracerouteConfig, natsURL string, timeout time.Duration) (*TracerouteResult, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, timeout)
+	defer cancel()
+	return traceroute(ctx, runTool, runtime.GOOS, req, cfg, natsURL)
+}
+
+func traceroute(ctx context.Context, run toolRunner, goos string, req *TracerouteRequest, cfg *config.TracerouteConfig, natsURL string) (*TracerouteResult, error) {
+	if !cfg.Enabled {
+		return nil, fmt.Errorf("traceroute is not enabled")
+	}
+
+	mode := req.Mode
+	if mode == "" {
+		mode = "icmp"
+	}
+	if mode != "icmp" && mode != "udp" && mode != "tcp" {
+		return nil, fmt.Errorf("invalid mode: %s (must be icmp, udp, or tcp)", mode)
+	}
+	if req.Port != 0 && (mode != "tcp" || req.Port < 1 || req.Port > 65535) {
+		return nil, fmt.Errorf("invalid port: %d (only tcp mode takes a port, 1-65535)", req.Port)
+	}
+
+	maxHops := cfg.MaxHops
+	if req.MaxHops != 0 {
+		if req.MaxHops < 1 {
+			return nil, fmt.Errorf("invalid max_hops: %d", req.MaxHops)
+		}
+		if req.MaxHops > cfg.MaxHops {
+			return nil, fmt.Errorf("max_hops %d exceeds commands.traceroute.max_hops (%d)", req.MaxHops, cfg.MaxHops)
+		}
+		maxHops = req.MaxHops
+	}
+
+	var host string
+	port := 80
+	if strings.EqualFold(req.Target, TracerouteTargetNATS) {
+		u, err := url.Parse(natsURL)
+		if natsURL == "" || err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("not connected to a NATS server")
+		}
+		host = u.Hostname()
+		if p, err := strconv.Atoi(u.Port()); err == nil {
+			port = p
+		}
+	} else {
+		i := slices.IndexFunc(cfg.Targets, func(target string) bool { return strings.EqualFold(target, req.Target) })
+		if i < 0 {
+			return nil, fmt.Errorf("traceroute target not in allowed list: %s", req.Target)
+		}
+		host = cfg.Targets[i]
+	}
+	if req.Port != 0 {
+		port = req.Port
+	}
+
+	name, args, err := tracerouteArgs(goos, mode, host, port, maxHops, cfg.ProbeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	out, err := run(ctx, name, args...)
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("%s not found (is it installed?)", name)
+		}
+		return nil, err
+	}
+
+	destination, hops := parseTraceroute(out)
+	if destination == "" {
+		destination = host
+	}
+	result := &TracerouteResult{
+		Target:      req.Target,
+		Destination: destination,
+		Mode:        mode,
+		Hops:        hops,
+		TimedOut:    timedOut,
+		TS:          utils.NowRFC3339(),
+	}
+	if mode == "tcp" {
+		result.Port = port
+	}
+	if len(hops) > 0 {
+		result.Reached = hops[len(hops)-1].Address == destination
+	}
+	return result, nil
+}
+
+// tracerouteArgs builds the command line: traceroute on Linux (icmp and tcp
+// need root) and FreeBSD, tracert (icmp only) on Windows. Three probes are
+// sent per hop, with numeric output.
+func tracerouteArgs(goos, mode, host string, port, maxHops int, probeTimeout time.Duration) (string, []string, error) {
+	hops := strconv.Itoa(maxHops)
+	switch goos {
+	case "windows":
+		if mode != "icmp" {
+			return "", nil, fmt.Errorf("only icmp traceroute is supported on Windows")
+		}
+		return "tracert", []string{"-d", "-h", hops, "-w", strconv.FormatInt(probeTimeout.Milliseconds(), 10), host}, nil
+	case "linux", "freebsd":
+		args := []string{"-n", "-q", "3", "-m", hops, "-w", strconv.Itoa(int(probeTimeout / time.Second))}
+		switch {
+		case mode == "icmp":
+			args = append(args, "-I")
+		case mode == "tcp" && goos == "linux":
+			args = append(args, "-T", "-p", strconv.Itoa(port))
+		case mode == "tcp":
+			// -e keeps the destination port fixed instead of counting up
+			args = append(args, "-P", "tcp", "-e", "-p", strconv.Itoa(port))
+		}
+		return "traceroute", append(args, host), nil
+	}
+	return "", nil, fmt.Errorf("traceroute not supported on platform: %s", goos)
+}
+
+// tracerouteDestination finds the traced address in the header line:
+// "traceroute to host (10.0.0.5), ..." or "Tracing route to host [10.0.0.5]"
+var tracerouteDestination = regexp.MustCompile(`[(\[]([0-9a-fA-F:.]+)[)\]]`)
+
+// parseTraceroute parses traceroute -n and tracert -d output, one hop per
+// line:
+//
+//	1  192.168.1.1  0.512 ms  0.480 ms  0.470 ms
+//	2  * * *
+//	3  10.0.0.1  5.103 ms !H  *  10.0.0.2  5.210 ms
+//	 4    <1 ms    <1 ms    <1 ms  10.0.0.5
+//	 5     *        *        *     Request timed out.
+//	 6  10.0.0.9  reports: Destination host unreachable.
+//
+// The other lines are headers, and the destination is taken from the first.
+func parseTraceroute(out string) (string, []TracerouteHop) {
+	var destination string
+	var hops []TracerouteHop
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			if m := tracerouteDestination.FindStringSubmatch(line); m != nil && destination == "" && net.ParseIP(m[1]) != nil {
+				destination = m[1]
+			}
+			continue
+		}
+
+		hop := TracerouteHop{Hop: n, RTTMs: []float64{}}
+		for i := 1; i < len(fields); i++ {
+			field := fields[i]
+			switch {
+			case field == "*":
+				hop.Lost++
+			case i+1 < len(fields) && fields[i+1] == "ms":
+				if rtt, err := strconv.ParseFloat(strings.TrimPrefix(field, "<"), 64); err == nil {
+					hop.RTTMs = append(hop.RTTMs, rtt)
+				}
+				i++
+			case strings.HasPrefix(field, "!"):
+				hop.Note = field
+			case field == "reports:":
+				hop.Note = strings.Join(fields[i:], " ")
+				i = len(fields)
+			case hop.Address == "" && net.ParseIP(field) != nil:
+				hop.Address = field
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return destination, hops
+}
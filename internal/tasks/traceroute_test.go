@@ -0,0 +1,165 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+const tracerouteOutput = `traceroute to nats.example.com (10.0.0.5), 30 hops max, 60 byte packets
+ 1  192.168.1.1  0.512 ms  0.480 ms  0.470 ms
+ 2  * * *
+ 3  172.16.0.1  5.103 ms !H  *  172.16.0.2  5.210 ms
+ 4  10.0.0.5  12.001 ms  11.870 ms  11.902 ms
+`
+
+const tracertOutput = `
+Tracing route to nats.example.com [10.0.0.5]
+over a maximum of 30 hops:
+
+  1    <1 ms    <1 ms    <1 ms  192.168.1.1
+  2     *        *        *     Request timed out.
+  3    14 ms    12 ms    13 ms  10.0.0.5
+
+Trace complete.
+`
+
+func TestParseTraceroute(t *testing.T) {
+	destination, hops := parseTraceroute(tracerouteOutput)
+	if destination != "10.0.0.5" || len(hops) != 4 {
+		t.Fatalf("parseTraceroute() = %s, %+v", destination, hops)
+	}
+	want := []TracerouteHop{
+		{Hop: 1, Address: "192.168.1.1", RTTMs: []float64{0.512, 0.48, 0.47}},
+		{Hop: 2, RTTMs: []float64{}, Lost: 3},
+		{Hop: 3, Address: "172.16.0.1", RTTMs: []float64{5.103, 5.21}, Lost: 1, Note: "!H"},
+		{Hop: 4, Address: "10.0.0.5", RTTMs: []float64{12.001, 11.87, 11.902}},
+	}
+	if !reflect.DeepEqual(hops, want) {
+		t.Errorf("parseTraceroute() hops = %+v, want %+v", hops, want)
+	}
+
+	destination, hops = parseTraceroute(tracertOutput)
+	if destination != "10.0.0.5" || len(hops) != 3 {
+		t.Fatalf("parseTraceroute(tracert) = %s, %+v", destination, hops)
+	}
+	if !reflect.DeepEqual(hops[0].RTTMs, []float64{1, 1, 1}) || hops[1].Lost != 3 || hops[1].Address != "" || hops[2].Address != "10.0.0.5" {
+		t.Errorf("parseTraceroute(tracert) hops = %+v", hops)
+	}
+
+	_, hops = parseTraceroute("  1  10.0.0.9  reports: Destination host unreachable.\n")
+	if len(hops) != 1 || hops[0].Address != "10.0.0.9" || hops[0].Note != "reports: Destination host unreachable." {
+		t.Errorf("parseTraceroute(reports) = %+v", hops)
+	}
+}
+
+func TestTracerouteArgs(t *testing.T) {
+	tests := []struct {
+		goos, mode string
+		want       string
+		wantErr    bool
+	}{
+		{"linux", "icmp", "traceroute -n -q 3 -m 20 -w 2 -I 10.0.0.5", false},
+		{"linux", "udp", "traceroute -n -q 3 -m 20 -w 2 10.0.0.5", false},
+		{"linux", "tcp", "traceroute -n -q 3 -m 20 -w 2 -T -p 4222 10.0.0.5", false},
+		{"freebsd", "tcp", "traceroute -n -q 3 -m 20 -w 2 -P tcp -e -p 4222 10.0.0.5", false},
+		{"windows", "icmp", "tracert -d -h 20 -w 2000 10.0.0.5", false},
+		{"windows", "tcp", "", true},
+		{"darwin", "icmp", "", true},
+	}
+	for _, tt := range tests {
+		name, args, err := tracerouteArgs(tt.goos, tt.mode, "10.0.0.5", 4222, 20, 2*time.Second)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("tracerouteArgs(%s, %s) error = %v, wantErr %v", tt.goos, tt.mode, err, tt.wantErr)
+			continue
+		}
+		if got := strings.TrimSpace(name + " " + strings.Join(args, " ")); !tt.wantErr && got != tt.want {
+			t.Errorf("tracerouteArgs(%s, %s) = %s, want %s", tt.goos, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestTraceroute(t *testing.T) {
+	cfg := &config.TracerouteConfig{Enabled: true, MaxHops: 30, ProbeTimeout: 2 * time.Second, Targets: []string{"gw.example.com"}}
+	var gotArgs []string
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		gotArgs = args
+		return tracerouteOutput, nil
+	}
+	trace := func(req TracerouteRequest) (*TracerouteResult, error) {
+		return traceroute(context.Background(), run, "linux", &req, cfg, "nats://nats.example.com:4222")
+	}
+
+	result, err := trace(TracerouteRequest{Target: "nats", Mode: "tcp"})
+	if err != nil {
+		t.Fatalf("traceroute() error = %v", err)
+	}
+	if !result.Reached || result.Destination != "10.0.0.5" || result.Port != 4222 || len(result.Hops) != 4 || result.TS == "" {
+		t.Errorf("traceroute() = %+v", result)
+	}
+	if got := strings.Join(gotArgs, " "); !strings.HasSuffix(got, "-T -p 4222 nats.example.com") {
+		t.Errorf("traceroute args = %s", got)
+	}
+
+	if _, err := trace(TracerouteRequest{Target: "GW.example.com", MaxHops: 5}); err != nil {
+		t.Fatalf("traceroute(target) error = %v", err)
+	}
+	if got := strings.Join(gotArgs, " "); got != "-n -q 3 -m 5 -w 2 -I gw.example.com" {
+		t.Errorf("traceroute args = %s", got)
+	}
+
+	for _, tt := range []struct {
+		req  TracerouteRequest
+		want string
+	}{
+		{TracerouteRequest{Target: "example.com"}, "not in allowed list"},
+		{TracerouteRequest{Target: "nats", Mode: "gre"}, "invalid mode"},
+		{TracerouteRequest{Target: "nats", Port: 443}, "invalid port"},
+		{TracerouteRequest{Target: "nats", MaxHops: 64}, "exceeds"},
+	} {
+		if _, err := trace(tt.req); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("traceroute(%+v) error = %v, want %q", tt.req, err, tt.want)
+		}
+	}
+
+	req := &TracerouteRequest{Target: "nats"}
+	if _, err := traceroute(context.Background(), run, "linux", req, cfg, ""); err == nil {
+		t.Error("traceroute(nats) while disconnected succeeded")
+	}
+	disabled := *cfg
+	disabled.Enabled = false
+	if _, err := traceroute(context.Background(), run, "linux", req, &disabled, "nats://nats.example.com:4222"); err == nil {
+		t.Error("traceroute() succeeded while disabled")
+	}
+
+	missing := func(ctx context.Context, name string, args ...string) (string, error) {
+		return "", fmt.Errorf("traceroute failed: %w", &exec.Error{Name: name, Err: exec.ErrNotFound})
+	}
+	if _, err := traceroute(context.Background(), missing, "linux", req, cfg, "nats://nats.example.com:4222"); err == nil || !strings.Contains(err.Error(), "traceroute not found") {
+		t.Errorf("traceroute() error = %v, want traceroute not found", err)
+	}
+}
+
+func TestTracerouteTimeout(t *testing.T) {
+	cfg := &config.TracerouteConfig{Enabled: true, MaxHops: 30, ProbeTimeout: time.Second}
+	partial := func(ctx context.Context, name string, args ...string) (string, error) {
+		<-ctx.Done()
+		return strings.Join(strings.Split(tracerouteOutput, "\n")[:3], "\n"), fmt.Errorf("traceroute failed: signal: killed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result, err := traceroute(ctx, partial, "linux", &TracerouteRequest{Target: "nats"}, cfg, "nats://10.0.0.5:4222")
+	if err != nil {
+		t.Fatalf("traceroute() error = %v, want partial hops", err)
+	}
+	if !result.TimedOut || result.Reached || len(result.Hops) != 2 {
+		t.Errorf("traceroute() = %+v, want 2 hops and timed_out", result)
+	}
+}
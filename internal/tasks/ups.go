@@ -0,0 +1,190 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+// TaskUPS is the task name of the UPS/battery poll
+const TaskUPS = "ups"
+
+// UPSSourceBattery names the Windows system battery in UPS statuses
+const UPSSourceBattery = "battery"
+
+// UPS power states, normalized across sources
+const (
+	UPSStatusOnline     = "online"      // On mains power
+	UPSStatusOnBattery  = "on_battery"  // Mains power lost
+	UPSStatusLowBattery = "low_battery" // On battery and about to shut down
+	UPSStatusUnknown    = "unknown"     // Could not be read
+)
+
+// UPSStatus is the power status of one UPS or battery, in system metrics
+// (ups) and power_change events
+type UPSStatus struct {
+	Name      string `json:"name"`                 // upsc target or battery
+	Status    string `json:"status"`               // One of the UPSStatus* constants
+	RawStatus string `json:"raw_status,omitempty"` // NUT ups.status, e.g. "OB LB"
+
+	ChargePercent  *float64 `json:"charge_percent,omitempty"`
+	RuntimeSeconds *int64   `json:"runtime_seconds,omitempty"` // Estimated time left on battery
+	LoadPercent    *float64 `json:"load_percent,omitempty"`
+	InputVoltage   *float64 `json:"input_voltage,omitempty"`
+	Charging       bool     `json:"charging,omitempty"`
+	ReplaceBattery bool     `json:"replace_battery,omitempty"` // The UPS asks for a new battery (NUT RB)
+
+	Error string `json:"error,omitempty"` // Why the status is unknown
+}
+
+// errBatteryUnsupported is returned by readBattery off Windows
+var errBatteryUnsupported = errors.New("battery status is only supported on Windows")
+
+// upsCache holds the latest poll for system metrics
+type upsCache struct {
+	mu       sync.Mutex
+	statuses []UPSStatus
+}
+
+// PollUPS reads every configured UPS and battery. The result is also kept
+// for the next system metrics payload.
+func (e *Executor) PollUPS(ctx context.Context, cfg *config.UPSConfig) []UPSStatus {
+	statuses := pollUPS(ctx, runTool, readBattery, cfg)
+	e.ups.mu.Lock()
+	e.ups.statuses = statuses
+	e.ups.mu.Unlock()
+	return statuses
+}
+
+// lastUPS returns the latest poll, nil if there was none
+func (e *Executor) lastUPS() []UPSStatus {
+	e.ups.mu.Lock()
+	defer e.ups.mu.Unlock()
+	return slices.Clone(e.ups.statuses)
+}
+
+func pollUPS(ctx context.Context, run toolRunner, battery func() (UPSStatus, error), cfg *config.UPSConfig) []UPSStatus {
+	statuses := make([]UPSStatus, 0, len(cfg.NUT)+1)
+	for _, target := range cfg.NUT {
+		out, err := run(ctx, "upsc", target)
+		if err != nil {
+			if errors.Is(err, exec.ErrNotFound) {
+				err = fmt.Errorf("upsc not found (is NUT installed?)")
+			}
+			statuses = append(statuses, UPSStatus{Name: target, Status: UPSStatusUnknown, Error: err.Error()})
+			continue
+		}
+		statuses = append(statuses, parseUPSC(target, out))
+	}
+	if cfg.Battery {
+		status, err := battery()
+		if err != nil {
+			status = UPSStatus{Name: UPSSourceBattery, Status: UPSStatusUnknown, Error: err.Error()}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// parseUPSC parses "upsc <ups>" output, one "variable: value" per line:
+//
+//	battery.charge: 100
+//	battery.runtime: 1800
+//	input.voltage: 230.0
+//	ups.load: 23
+//	ups.status: OL CHRG
+func parseUPSC(name, out string) UPSStatus {
+	status := UPSStatus{Name: name, Status: UPSStatusUnknown}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "ups.status":
+			status.RawStatus = value
+		case "battery.charge":
+			status.ChargePercent = parseUPSFloat(value)
+		case "battery.runtime":
+			if n := parseUPSFloat(value); n != nil {
+				seconds := int64(*n)
+				status.RuntimeSeconds = &seconds
+			}
+		case "ups.load":
+			status.LoadPercent = parseUPSFloat(value)
+		case "input.voltage":
+			status.InputVoltage = parseUPSFloat(value)
+		}
+	}
+
+	flags := strings.Fields(status.RawStatus)
+	switch {
+	case slices.Contains(flags, "OB") && slices.Contains(flags, "LB"):
+		status.Status = UPSStatusLowBattery
+	case slices.Contains(flags, "OB"):
+		status.Status = UPSStatusOnBattery
+	case slices.Contains(flags, "OL"):
+		status.Status = UPSStatusOnline
+	}
+	status.Charging = slices.Contains(flags, "CHRG")
+	status.ReplaceBattery = slices.Contains(flags, "RB")
+	if status.RawStatus == "" {
+		status.Error = "upsc reported no ups.status"
+	}
+	return status
+}
+
+func parseUPSFloat(value string) *float64 {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// SYSTEM_POWER_STATUS values
+const (
+	acLineOffline      = 0
+	acLineOnline       = 1
+	batteryFlagLow     = 2
+	batteryFlagCrit    = 4
+	batteryFlagCharge  = 8
+	batteryFlagNone    = 128
+	batteryUnknown     = 255
+	batteryTimeUnknown = 0xFFFFFFFF
+)
+
+// batteryStatus maps a Windows SYSTEM_POWER_STATUS to a UPSStatus
+func batteryStatus(acLine, flag, percent byte, lifetime uint32) (UPSStatus, error) {
+	if flag == batteryFlagNone {
+		return UPSStatus{}, fmt.Errorf("no system battery")
+	}
+	status := UPSStatus{Name: UPSSourceBattery, Status: UPSStatusUnknown}
+	switch acLine {
+	case acLineOnline:
+		status.Status = UPSStatusOnline
+	case acLineOffline:
+		status.Status = UPSStatusOnBattery
+		if flag != batteryUnknown && flag&(batteryFlagLow|batteryFlagCrit) != 0 {
+			status.Status = UPSStatusLowBattery
+		}
+	}
+	if percent != batteryUnknown {
+		charge := float64(percent)
+		status.ChargePercent = &charge
+	}
+	if lifetime != batteryTimeUnknown {
+		seconds := int64(lifetime)
+		status.RuntimeSeconds = &seconds
+	}
+	status.Charging = flag != batteryUnknown && flag&batteryFlagCharge != 0
+	return status, nil
+}
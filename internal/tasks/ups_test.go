@@ -0,0 +1,110 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stone-age-io/agent/internal/config"
+)
+
+func TestParseUPSC(t *testing.T) {
+	tests := []struct {
+		name      string
+		out       string
+		want      string
+		charging  bool
+		replace   bool
+		hasCharge bool
+	}{
+		{"online", "battery.charge: 100\nbattery.runtime: 1800\nups.load: 23\nups.status: OL\n", UPSStatusOnline, false, false, true},
+		{"charging", "battery.charge: 80\nups.status: OL CHRG\n", UPSStatusOnline, true, false, true},
+		{"on battery", "battery.charge: 64\nups.status: OB DISCHRG\n", UPSStatusOnBattery, false, false, true},
+		{"low battery", "battery.charge: 9\nups.status: OB LB\n", UPSStatusLowBattery, false, false, true},
+		{"replace battery", "ups.status: OL RB\n", UPSStatusOnline, false, true, false},
+		{"no status", "Init SSL without certificate database\nbattery.charge: 100\n", UPSStatusUnknown, false, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUPSC("rack", tt.out)
+			if got.Status != tt.want || got.Charging != tt.charging || got.ReplaceBattery != tt.replace || (got.ChargePercent != nil) != tt.hasCharge {
+				t.Errorf("parseUPSC() = %+v", got)
+			}
+			if tt.want == UPSStatusUnknown && got.Error == "" {
+				t.Error("unknown status without an error")
+			}
+		})
+	}
+
+	got := parseUPSC("rack", "battery.runtime: 1800\ninput.voltage: 229.5\nups.status: OL\n")
+	if got.RuntimeSeconds == nil || *got.RuntimeSeconds != 1800 || got.InputVoltage == nil || *got.InputVoltage != 229.5 {
+		t.Errorf("parseUPSC() = %+v, want runtime 1800 and voltage 229.5", got)
+	}
+}
+
+func TestBatteryStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		acLine   byte
+		flag     byte
+		percent  byte
+		lifetime uint32
+		want     string
+		charging bool
+		wantErr  bool
+	}{
+		{"online charging", acLineOnline, batteryFlagCharge, 90, batteryTimeUnknown, UPSStatusOnline, true, false},
+		{"on battery", acLineOffline, 1, 70, 1200, UPSStatusOnBattery, false, false},
+		{"low", acLineOffline, batteryFlagLow, 20, 300, UPSStatusLowBattery, false, false},
+		{"critical", acLineOffline, batteryFlagCrit, 4, 60, UPSStatusLowBattery, false, false},
+		{"unknown flags", acLineOffline, batteryUnknown, batteryUnknown, batteryTimeUnknown, UPSStatusOnBattery, false, false},
+		{"ac unknown", batteryUnknown, 1, 50, 600, UPSStatusUnknown, false, false},
+		{"no battery", acLineOnline, batteryFlagNone, batteryUnknown, batteryTimeUnknown, "", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := batteryStatus(tt.acLine, tt.flag, tt.percent, tt.lifetime)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("batteryStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.Status != tt.want || got.Charging != tt.charging {
+				t.Errorf("batteryStatus() = %+v, want %s", got, tt.want)
+			}
+			if (got.ChargePercent == nil) != (tt.percent == batteryUnknown) || (got.RuntimeSeconds == nil) != (tt.lifetime == batteryTimeUnknown) {
+				t.Errorf("batteryStatus() charge/runtime = %v/%v", got.ChargePercent, got.RuntimeSeconds)
+			}
+		})
+	}
+}
+
+func TestPollUPS(t *testing.T) {
+	cfg := &config.UPSConfig{NUT: []string{"rack", "door@10.0.0.5"}, Battery: true}
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		if args[0] == "rack" {
+			return "battery.charge: 100\nups.status: OL\n", nil
+		}
+		return "", fmt.Errorf("upsc failed: %w", &exec.Error{Name: name, Err: exec.ErrNotFound})
+	}
+	battery := func() (UPSStatus, error) { return UPSStatus{}, errBatteryUnsupported }
+
+	got := pollUPS(context.Background(), run, battery, cfg)
+	if len(got) != 3 {
+		t.Fatalf("pollUPS() = %d statuses, want 3", len(got))
+	}
+	if got[0].Name != "rack" || got[0].Status != UPSStatusOnline {
+		t.Errorf("rack = %+v", got[0])
+	}
+	if got[1].Status != UPSStatusUnknown || !strings.Contains(got[1].Error, "upsc not found") {
+		t.Errorf("door = %+v, want upsc not found", got[1])
+	}
+	if got[2].Name != UPSSourceBattery || got[2].Status != UPSStatusUnknown || got[2].Error == "" {
+		t.Errorf("battery = %+v", got[2])
+	}
+}
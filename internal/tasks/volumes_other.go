@@ -0,0 +1,8 @@
+//go:build !windows
+
+package tasks
+
+// folderMounts is Windows only; disk.Partitions lists every Unix mount
+func folderMounts() ([]string, error) {
+	return nil, nil
+}
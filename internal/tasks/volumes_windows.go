@@ -0,0 +1,117 @@
+//go:build windows
+
+package tasks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// folderMounts returns the mount paths of fixed volumes that have no drive
+// letter: volumes mounted into an NTFS folder ("D:\Data\Archive") and
+// cluster shared volumes ("C:\ClusterStorage\Volume1"). Drive letters are
+// left to disk.Partitions. Paths have no trailing backslash.
+func folderMounts() ([]string, error) {
+	seen := make(map[string]bool)
+	var mounts []string
+	add := func(mount string) {
+		mount = strings.TrimSuffix(mount, `\`)
+		if isDriveLetter(mount) || seen[strings.ToUpper(mount)] {
+			return
+		}
+		seen[strings.ToUpper(mount)] = true
+		mounts = append(mounts, mount)
+	}
+
+	err := forEachVolume(func(paths []string) {
+		for _, p := range paths {
+			if isFixedVolume(p) {
+				add(p)
+			}
+		}
+	})
+
+	// CSVs are mounted by the cluster service under the system drive's
+	// ClusterStorage folder and aren't listed as mount points of a local
+	// volume on every node. They are reparse points, which os doesn't
+	// report as directories; callers skip entries without free space.
+	csvRoot := filepath.Join(os.Getenv("SystemDrive")+`\`, "ClusterStorage")
+	if entries, csvErr := os.ReadDir(csvRoot); csvErr == nil {
+		for _, entry := range entries {
+			add(filepath.Join(csvRoot, entry.Name()))
+		}
+	}
+	return mounts, err
+}
+
+// forEachVolume calls fn with the mount paths of every volume on the system
+func forEachVolume(fn func(paths []string)) error {
+	name := make([]uint16, windows.MAX_PATH+1)
+	handle, err := windows.FindFirstVolume(&name[0], uint32(len(name)))
+	if err != nil {
+		return err
+	}
+	defer windows.FindVolumeClose(handle)
+
+	for {
+		if paths, err := volumePaths(&name[0]); err == nil {
+			fn(paths)
+		}
+		err := windows.FindNextVolume(handle, &name[0], uint32(len(name)))
+		if errors.Is(err, windows.ERROR_NO_MORE_FILES) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// volumePaths returns the mount paths of a volume GUID path
+func volumePaths(volume *uint16) ([]string, error) {
+	buf := make([]uint16, windows.MAX_PATH)
+	for {
+		var needed uint32
+		err := windows.GetVolumePathNamesForVolumeName(volume, &buf[0], uint32(len(buf)), &needed)
+		if errors.Is(err, windows.ERROR_MORE_DATA) {
+			buf = make([]uint16, needed)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+
+	// A double-NUL terminated list of NUL-terminated strings
+	var paths []string
+	for start, i := 0, 0; i < len(buf); i++ {
+		if buf[i] != 0 {
+			continue
+		}
+		if i == start {
+			break
+		}
+		paths = append(paths, windows.UTF16ToString(buf[start:i]))
+		start = i + 1
+	}
+	return paths, nil
+}
+
+// isFixedVolume reports whether the volume mounted at path is a local disk
+func isFixedVolume(path string) bool {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	return windows.GetDriveType(p) == windows.DRIVE_FIXED
+}
+
+// isDriveLetter reports whether mount is a bare drive letter ("C:")
+func isDriveLetter(mount string) bool {
+	return len(mount) == 2 && mount[1] == ':'
+}
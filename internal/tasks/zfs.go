@@ -0,0 +1,285 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stone-age-io/agent/internal/utils"
+)
+
+// TaskZFS is the task name of the ZFS pool health check
+const TaskZFS = "zfs"
+
+// ZFSHealthOnline is the health of a pool with all devices working
+const ZFSHealthOnline = "ONLINE"
+
+// maxZFSDatasets caps the datasets reported per payload
+const maxZFSDatasets = 200
+
+// zpoolTimeLayout is how zpool status prints scan times (ctime, local time)
+const zpoolTimeLayout = "Mon Jan _2 15:04:05 2006"
+
+// ZFSPool is the health of one imported pool
+type ZFSPool struct {
+	Name   string `json:"name"`
+	Health string `json:"health"` // ONLINE, DEGRADED, FAULTED, OFFLINE, UNAVAIL, REMOVED or SUSPENDED
+
+	SizeBytes            uint64  `json:"size_bytes"`
+	AllocatedBytes       uint64  `json:"allocated_bytes"`
+	FreeBytes            uint64  `json:"free_bytes"`
+	CapacityPercent      float64 `json:"capacity_percent"`
+	FragmentationPercent float64 `json:"fragmentation_percent"`
+
+	// Error counts of the pool's top row in zpool status, and the number of
+	// files with permanent (unrecoverable) errors
+	ReadErrors     uint64 `json:"read_errors"`
+	WriteErrors    uint64 `json:"write_errors"`
+	ChecksumErrors uint64 `json:"checksum_errors"`
+	DataErrors     uint64 `json:"data_errors"`
+
+	Scan            string  `json:"scan,omitempty"` // The zpool status scan line, e.g. "scrub repaired 0B in 00:01:02 with 0 errors on ..."
+	ScrubInProgress bool    `json:"scrub_in_progress"`
+	Resilvering     bool    `json:"resilvering"`
+	LastScrub       string  `json:"last_scrub,omitempty"`      // RFC3339 end of the last completed scrub; empty if unknown
+	ScrubAgeHours   float64 `json:"scrub_age_hours,omitempty"` // Since LastScrub
+
+	Devices []ZFSDevice `json:"devices,omitempty"` // Devices that are not ONLINE or have errors
+}
+
+// ZFSDevice is a pool member (disk, partition or vdev) that needs attention
+type ZFSDevice struct {
+	Name           string `json:"name"`
+	State          string `json:"state"`
+	ReadErrors     uint64 `json:"read_errors"`
+	WriteErrors    uint64 `json:"write_errors"`
+	ChecksumErrors uint64 `json:"checksum_errors"`
+}
+
+// ZFSDataset is the space used by a filesystem or volume (zfs.datasets)
+type ZFSDataset struct {
+	Name           string  `json:"name"`
+	UsedBytes      uint64  `json:"used_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+// ZFSMessage is published on {prefix}.{code}.telemetry.zfs after each check.
+// Code/Location/MessageMeta are stamped by the scheduler.
+type ZFSMessage struct {
+	Code     string `json:"code"`
+	Location string `json:"location"`
+	MessageMeta
+
+	Pools    []ZFSPool    `json:"pools"`
+	Datasets []ZFSDataset `json:"datasets,omitempty"`
+	TS       string       `json:"ts"`
+}
+
+// CollectZFS reads the health of every imported pool with the zpool tool,
+// and the space used per dataset if datasets is set
+func (e *Executor) CollectZFS(ctx context.Context, datasets bool) (*ZFSMessage, error) {
+	return collectZFS(ctx, runTool, datasets, time.Now())
+}
+
+func collectZFS(ctx context.Context, run toolRunner, datasets bool, now time.Time) (*ZFSMessage, error) {
+	out, err := run(ctx, "zpool", "list", "-Hp", "-o", "name,size,allocated,free,fragmentation,capacity,health")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("zpool not found (is ZFS installed?)")
+		}
+		return nil, err
+	}
+	msg := &ZFSMessage{Pools: parseZpoolList(out)}
+
+	if len(msg.Pools) > 0 {
+		out, err := run(ctx, "zpool", "status", "-p")
+		if err != nil {
+			return nil, err
+		}
+		parseZpoolStatus(out, msg.Pools, now)
+	}
+
+	if datasets {
+		out, err := run(ctx, "zfs", "list", "-Hp", "-t", "filesystem,volume", "-o", "name,used,available")
+		if err != nil {
+			return nil, err
+		}
+		msg.Datasets = parseZFSList(out)
+	}
+
+	msg.TS = utils.NowRFC3339()
+	return msg, nil
+}
+
+// parseZpoolList parses "zpool list -Hp -o
+// name,size,allocated,free,fragmentation,capacity,health". Anything else
+// (such as "no pools available") is skipped.
+func parseZpoolList(out string) []ZFSPool {
+	pools := []ZFSPool{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		pool := ZFSPool{Name: fields[0], Health: fields[6]}
+		pool.SizeBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		pool.AllocatedBytes, _ = strconv.ParseUint(fields[2], 10, 64)
+		pool.FreeBytes, _ = strconv.ParseUint(fields[3], 10, 64)
+		// "-" when the pool does not report fragmentation
+		pool.FragmentationPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[4], "%"), 64)
+		pool.CapacityPercent, _ = strconv.ParseFloat(strings.TrimSuffix(fields[5], "%"), 64)
+		pools = append(pools, pool)
+	}
+	return pools
+}
+
+// parseZpoolStatus adds error counts, problem devices and scrub state from
+// "zpool status -p" to the pools parsed from zpool list:
+//
+//	  pool: tank
+//	 state: DEGRADED
+//	  scan: scrub repaired 0B in 00:00:03 with 0 errors on Sun Oct 11 00:24:04 2026
+//	config:
+//
+//		NAME        STATE     READ WRITE CKSUM
+//		tank        DEGRADED     0     0     0
+//		  mirror-0  DEGRADED     0     0     0
+//		    sda     ONLINE       0     0     0
+//		    sdb     UNAVAIL      0     0     0  cannot open
+//
+//	errors: No known data errors
+func parseZpoolStatus(out string, pools []ZFSPool, now time.Time) {
+	byName := make(map[string]*ZFSPool, len(pools))
+	for i := range pools {
+		byName[pools[i].Name] = &pools[i]
+	}
+
+	var pool *ZFSPool
+	inConfig, header := false, false
+	for _, line := range strings.Split(out, "\n") {
+		trimmed := strings.TrimSpace(line)
+		key, value, _ := strings.Cut(trimmed, ":")
+		switch key {
+		case "pool":
+			pool = byName[strings.TrimSpace(value)]
+			inConfig, header = false, false
+			continue
+		case "scan":
+			if pool != nil {
+				parseZpoolScan(pool, strings.TrimSpace(value), now)
+			}
+			continue
+		case "config":
+			inConfig, header = true, false
+			continue
+		case "errors":
+			inConfig = false
+			if pool != nil {
+				fmt.Sscanf(strings.TrimSpace(value), "%d data errors", &pool.DataErrors)
+			}
+			continue
+		}
+		if pool == nil || !inConfig {
+			continue
+		}
+
+		// Group rows (logs, cache, spares) and spare devices have fewer
+		// columns and are skipped
+		fields := strings.Fields(trimmed)
+		if len(fields) > 0 && fields[0] == "NAME" {
+			header = true
+			continue
+		}
+		if !header || len(fields) < 5 {
+			continue
+		}
+		device := ZFSDevice{
+			Name:           fields[0],
+			State:          fields[1],
+			ReadErrors:     parseZFSCount(fields[2]),
+			WriteErrors:    parseZFSCount(fields[3]),
+			ChecksumErrors: parseZFSCount(fields[4]),
+		}
+		if device.Name == pool.Name {
+			pool.ReadErrors, pool.WriteErrors, pool.ChecksumErrors = device.ReadErrors, device.WriteErrors, device.ChecksumErrors
+			continue
+		}
+		if device.State != ZFSHealthOnline || device.ReadErrors+device.WriteErrors+device.ChecksumErrors > 0 {
+			pool.Devices = append(pool.Devices, device)
+		}
+	}
+}
+
+// parseZpoolScan reads the scrub and resilver state from a scan line
+func parseZpoolScan(pool *ZFSPool, scan string, now time.Time) {
+	pool.Scan = scan
+	switch {
+	case strings.HasPrefix(scan, "scrub in progress"):
+		pool.ScrubInProgress = true
+	case strings.HasPrefix(scan, "resilver in progress"):
+		pool.Resilvering = true
+	case strings.HasPrefix(scan, "scrub repaired"):
+		i := strings.LastIndex(scan, " on ")
+		if i < 0 {
+			return
+		}
+		finished, err := time.ParseInLocation(zpoolTimeLayout, strings.TrimSpace(scan[i+len(" on "):]), now.Location())
+		if err != nil {
+			return
+		}
+		pool.LastScrub = finished.UTC().Format(time.RFC3339)
+		if age := now.Sub(finished); age > 0 {
+			pool.ScrubAgeHours = age.Hours()
+		}
+	}
+}
+
+// parseZFSCount parses an error count, exact with -p or abbreviated (1.2K)
+// by older zpool versions
+func parseZFSCount(s string) uint64 {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n
+	}
+	multiplier := 1.0
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1e3
+	case 'M':
+		multiplier = 1e6
+	case 'G':
+		multiplier = 1e9
+	}
+	n, err := strconv.ParseFloat(strings.TrimRight(s, "KMG"), 64)
+	if err != nil {
+		return 0
+	}
+	return uint64(n * multiplier)
+}
+
+// parseZFSList parses "zfs list -Hp -o name,used,available", at most
+// maxZFSDatasets
+func parseZFSList(out string) []ZFSDataset {
+	datasets := []ZFSDataset{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		if len(datasets) == maxZFSDatasets {
+			break
+		}
+		ds := ZFSDataset{Name: fields[0]}
+		ds.UsedBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		ds.AvailableBytes, _ = strconv.ParseUint(fields[2], 10, 64)
+		if total := ds.UsedBytes + ds.AvailableBytes; total > 0 {
+			ds.UsedPercent = float64(ds.UsedBytes) / float64(total) * 100
+		}
+		datasets = append(datasets, ds)
+	}
+	return datasets
+}
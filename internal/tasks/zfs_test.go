@@ -0,0 +1,138 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const zpoolListOutput = "tank\t3985729650688\t1992864825344\t1992864825344\t12\t50\tDEGRADED\n" +
+	"backup\t1000000000000\t100000000000\t900000000000\t-\t10\tONLINE\n"
+
+const zpoolStatusOutput = `  pool: backup
+ state: ONLINE
+  scan: scrub in progress since Thu Oct 15 09:00:00 2026
+	1.2T / 2.0T scanned at 500M/s, 1.0T / 2.0T issued at 400M/s
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	backup      ONLINE       0     0     0
+	  sdc       ONLINE       0     0     0
+	spares
+	  sdd       AVAIL
+
+errors: No known data errors
+
+  pool: tank
+ state: DEGRADED
+status: One or more devices could not be used because the label is missing or
+	invalid.  Sufficient replicas exist for the pool to continue
+	functioning in a degraded state.
+action: Replace the device using 'zpool replace'.
+  scan: scrub repaired 0B in 00:10:03 with 0 errors on Sun Oct 11 00:24:00 2026
+config:
+
+	NAME                              STATE     READ WRITE CKSUM
+	tank                              DEGRADED     0     0     0
+	  mirror-0                        DEGRADED     0     0     0
+	    ata-WDC_WD40-part1            ONLINE       0     0     3
+	    1234567890123456789           UNAVAIL      0     0     0  was /dev/sdb1
+	logs
+	  nvme0n1                         ONLINE       0     0     0
+
+errors: 2 data errors, use '-v' for a list
+`
+
+func TestParseZpoolStatus(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 24, 0, 0, time.Local)
+	pools := parseZpoolList(zpoolListOutput)
+	if len(pools) != 2 {
+		t.Fatalf("parseZpoolList() = %d pools, want 2", len(pools))
+	}
+	parseZpoolStatus(zpoolStatusOutput, pools, now)
+
+	tank := pools[0]
+	if tank.Name != "tank" || tank.Health != "DEGRADED" || tank.CapacityPercent != 50 || tank.FragmentationPercent != 12 {
+		t.Errorf("tank = %+v", tank)
+	}
+	if tank.SizeBytes != 3985729650688 || tank.FreeBytes != 1992864825344 {
+		t.Errorf("tank sizes = %d/%d", tank.SizeBytes, tank.FreeBytes)
+	}
+	if tank.DataErrors != 2 {
+		t.Errorf("tank.DataErrors = %d, want 2", tank.DataErrors)
+	}
+	if tank.ScrubInProgress || tank.LastScrub == "" || tank.ScrubAgeHours != 108 {
+		t.Errorf("tank scrub = %v %q %v, want finished 108h ago", tank.ScrubInProgress, tank.LastScrub, tank.ScrubAgeHours)
+	}
+	got := make([]string, len(tank.Devices))
+	for i, d := range tank.Devices {
+		got[i] = fmt.Sprintf("%s %s %d", d.Name, d.State, d.ChecksumErrors)
+	}
+	want := "mirror-0 DEGRADED 0, ata-WDC_WD40-part1 ONLINE 3, 1234567890123456789 UNAVAIL 0"
+	if strings.Join(got, ", ") != want {
+		t.Errorf("tank.Devices = %s, want %s", strings.Join(got, ", "), want)
+	}
+
+	backup := pools[1]
+	if backup.Health != ZFSHealthOnline || backup.FragmentationPercent != 0 || len(backup.Devices) != 0 {
+		t.Errorf("backup = %+v", backup)
+	}
+	if !backup.ScrubInProgress || backup.LastScrub != "" || backup.DataErrors != 0 {
+		t.Errorf("backup scrub = %v %q, want in progress", backup.ScrubInProgress, backup.LastScrub)
+	}
+}
+
+func TestParseZFSCount(t *testing.T) {
+	for in, want := range map[string]uint64{"0": 0, "17": 17, "1.2K": 1200, "3M": 3000000, "bad": 0} {
+		if got := parseZFSCount(in); got != want {
+			t.Errorf("parseZFSCount(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestCollectZFS(t *testing.T) {
+	var calls []string
+	run := func(ctx context.Context, name string, args ...string) (string, error) {
+		calls = append(calls, name+" "+args[0])
+		switch name + " " + args[0] {
+		case "zpool list":
+			return zpoolListOutput, nil
+		case "zpool status":
+			return zpoolStatusOutput, nil
+		case "zfs list":
+			return "tank\t750\t250\ntank/vm\t0\t0\n", nil
+		}
+		return "", fmt.Errorf("unexpected command %s", name)
+	}
+
+	msg, err := collectZFS(context.Background(), run, true, time.Now())
+	if err != nil {
+		t.Fatalf("collectZFS() error = %v", err)
+	}
+	if len(msg.Pools) != 2 || len(msg.Datasets) != 2 || msg.TS == "" {
+		t.Fatalf("collectZFS() = %+v", msg)
+	}
+	if msg.Datasets[0].UsedPercent != 75 || msg.Datasets[1].UsedPercent != 0 {
+		t.Errorf("Datasets = %+v", msg.Datasets)
+	}
+
+	// No pools: nothing more to ask, and pools is empty rather than null
+	calls = nil
+	msg, err = collectZFS(context.Background(), func(ctx context.Context, name string, args ...string) (string, error) {
+		calls = append(calls, name)
+		return "no pools available\n", nil
+	}, false, time.Now())
+	if err != nil || msg.Pools == nil || len(msg.Pools) != 0 || len(calls) != 1 {
+		t.Errorf("collectZFS() without pools = %+v, %v (calls %v)", msg, err, calls)
+	}
+
+	_, err = collectZFS(context.Background(), func(ctx context.Context, name string, args ...string) (string, error) {
+		return "", fmt.Errorf("zpool list failed: %w", &exec.Error{Name: name, Err: exec.ErrNotFound})
+	}, false, time.Now())
+	if err == nil || !strings.Contains(err.Error(), "zpool not found") {
+		t.Errorf("collectZFS() without zpool error = %v", err)
+	}
+}